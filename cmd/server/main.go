@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/ndn/internal/container"
+	"github.com/ndn/internal/server"
+	"log"
+	"os"
+)
+
+func main() {
+	var (
+		opts           container.Options
+		migrateOnly    bool
+		validateConfig bool
+	)
+
+	flag.StringVar(&opts.ConfigPath, "config", envOr("NDN_CONFIG", "config.yaml"), "path to the config file (env NDN_CONFIG)")
+	flag.StringVar(&opts.Port, "port", os.Getenv("NDN_PORT"), "override server.port (env NDN_PORT)")
+	flag.StringVar(&opts.LogLevel, "log-level", os.Getenv("NDN_LOG_LEVEL"), "override logger.level (env NDN_LOG_LEVEL)")
+	flag.BoolVar(&migrateOnly, "migrate-only", false, "run database migrations and exit")
+	flag.BoolVar(&validateConfig, "validate-config", false, "validate the configuration and exit")
+	flag.Parse()
+
+	// Validate configuration only
+	if validateConfig {
+		if _, err := container.LoadConfig(opts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Printf("configuration %s is valid\n", opts.ConfigPath)
+		return
+	}
+
+	// Run migrations only
+	if migrateOnly {
+		if err := server.Migrate(opts); err != nil {
+			log.Printf("Migration failed: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Create and start server
+	srv, err := server.New(opts)
+	if err != nil {
+		log.Printf("Failed to create server: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := srv.Start(); err != nil {
+		log.Printf("Server error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// envOr returns the environment variable key, or fallback if it is unset
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,65 @@
+// Package apierror writes API errors as RFC 7807 problem details. Every
+// problem carries a stable machine-readable code for clients to act on, a
+// message in the locale of the request and the ID of the request, for
+// reporting it.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ndn/internal/i18n"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// FieldError is a request field that failed a validation rule
+type FieldError struct {
+	Field   string `json:"field" example:"release_year"`
+	Rule    string `json:"rule" example:"gte"`
+	Param   string `json:"param,omitempty" example:"1888"`
+	Message string `json:"message" example:"release_year must be at least 1888"`
+}
+
+// Problem is an RFC 7807 problem details object. Type is always
+// about:blank, so Title is the HTTP status text; Code tells problems of the
+// same status apart and Detail explains it in the request's locale. Fields
+// lists the invalid fields of a request that failed validation.
+type Problem struct {
+	Type      string       `json:"type" example:"about:blank"`
+	Title     string       `json:"title" example:"Not Found"`
+	Status    int          `json:"status" example:"404"`
+	Detail    string       `json:"detail" example:"Movie not found"`
+	Instance  string       `json:"instance,omitempty" example:"/api/movies/42"`
+	Code      string       `json:"code" example:"movie_not_found"`
+	RequestID string       `json:"request_id,omitempty" example:"api-1/Xb2Qk9pT3a-000042"`
+	Fields    []FieldError `json:"fields,omitempty"`
+}
+
+// New returns the problem of r with status and code. args are substituted
+// into the message of code as name/value pairs, see i18n.Message.
+func New(r *http.Request, status int, code string, args ...interface{}) *Problem {
+	return &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    i18n.Message(r.Context(), code, args...),
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// Write sends p as the response
+func (p *Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Write sends the problem of r with status and code as the response
+func Write(w http.ResponseWriter, r *http.Request, status int, code string, args ...interface{}) {
+	New(r, status, code, args...).Write(w)
+}
@@ -0,0 +1,137 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxStackDepth limits how many frames are captured per error
+const maxStackDepth = 32
+
+// Error wraps an underlying error with the operation that failed and the
+// stack at the point it was wrapped
+type Error struct {
+	Op    string
+	Err   error
+	stack []uintptr
+}
+
+// E wraps err with the given operation name, capturing the caller's stack.
+// The stack is only captured once, at the innermost wrap, so re-wrapping an
+// *Error keeps the original trace. E returns nil if err is nil.
+func E(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e := &Error{Op: op, Err: err}
+
+	var inner *Error
+	if !errors.As(err, &inner) {
+		pcs := make([]uintptr, maxStackDepth)
+		n := runtime.Callers(2, pcs)
+		e.stack = pcs[:n]
+	}
+
+	return e
+}
+
+// Errorf formats a new error and wraps it with the given operation name
+func Errorf(op string, format string, args ...interface{}) error {
+	err := E(op, fmt.Errorf(format, args...))
+	// Skip the extra frame added by Errorf itself
+	if e, ok := err.(*Error); ok && len(e.stack) > 0 {
+		e.stack = e.stack[1:]
+	}
+	return err
+}
+
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return e.Err.Error()
+	}
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace returns the program counters captured for this error chain. It
+// lets New Relic attach the original stack when the error is noticed.
+func (e *Error) StackTrace() []uintptr {
+	return stack(e)
+}
+
+// ErrorClass groups noticed errors by their outermost operation
+func (e *Error) ErrorClass() string {
+	return e.Op
+}
+
+// ErrorAttributes exposes the operation chain as telemetry attributes
+func (e *Error) ErrorAttributes() map[string]interface{} {
+	return map[string]interface{}{
+		"op": strings.Join(Ops(e), " > "),
+	}
+}
+
+// Ops returns the chain of operation names from outermost to innermost
+func Ops(err error) []string {
+	var ops []string
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.Op != "" {
+			ops = append(ops, e.Op)
+		}
+		err = errors.Unwrap(err)
+	}
+	return ops
+}
+
+// StackTrace returns the stack captured when err was first wrapped, one frame
+// per line, or an empty string if no stack was captured
+func StackTrace(err error) string {
+	pcs := stack(err)
+	if len(pcs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// stack returns the innermost captured stack in err's chain
+func stack(err error) []uintptr {
+	var pcs []uintptr
+	for err != nil {
+		if e, ok := err.(*Error); ok && e.stack != nil {
+			pcs = e.stack
+		}
+		err = errors.Unwrap(err)
+	}
+	return pcs
+}
+
+// Fields returns zap fields describing err, including its operation chain and
+// stack trace when available
+func Fields(err error) []zap.Field {
+	fields := []zap.Field{zap.Error(err)}
+	if ops := Ops(err); len(ops) > 0 {
+		fields = append(fields, zap.String("op", strings.Join(ops, " > ")))
+	}
+	if stack := StackTrace(err); stack != "" {
+		fields = append(fields, zap.String("stacktrace", stack))
+	}
+	return fields
+}
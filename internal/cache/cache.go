@@ -0,0 +1,164 @@
+// Package cache stores values shared by every API instance in Redis, so
+// frequent reads can skip the database. When caching is disabled the null
+// cache stands in and every read misses.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultTTL     = time.Minute
+	defaultTimeout = 200 * time.Millisecond
+	defaultPrefix  = "ndn:"
+)
+
+// Cache stores JSON-encoded values by key. Callers treat errors as misses
+// and fall back to the source of the value, so an unavailable cache slows
+// the API down but does not break it.
+type Cache interface {
+	// Get decodes the value of key into v, a pointer, and reports whether
+	// key was cached
+	Get(ctx context.Context, key string, v interface{}) (bool, error)
+	// Set caches v under key for ttl, or the configured TTL when ttl is zero
+	Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error
+	// Incr increments the counter at key, starting from zero, and returns
+	// its new value. Counters do not expire.
+	Incr(ctx context.Context, key string) (int64, error)
+	// Add caches v under key for ttl unless key is cached already, and
+	// reports whether it was added. Of concurrent Adds of a key, across
+	// every instance, only one succeeds.
+	Add(ctx context.Context, key string, v interface{}, ttl time.Duration) (bool, error)
+	// Ping checks that the cache is reachable
+	Ping(ctx context.Context) error
+	// Close releases the connections of the cache
+	Close() error
+}
+
+// New returns the Redis cache when enabled in configuration, and the null
+// cache otherwise
+func New(cfg config.CacheConfig) Cache {
+	if !cfg.Enabled {
+		return Null{}
+	}
+	return NewRedis(cfg)
+}
+
+// Redis is a Cache stored in Redis. Keys are namespaced by the configured
+// prefix, so several deployments can share a Redis database.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedis connects lazily to the Redis server of cfg
+func NewRedis(cfg config.CacheConfig) *Redis {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	prefix := cfg.Prefix
+	if prefix == "" {
+		prefix = defaultPrefix
+	}
+
+	return &Redis{
+		client: redis.NewClient(&redis.Options{
+			Addr:         cfg.Addr,
+			Password:     cfg.Password,
+			DB:           cfg.DB,
+			DialTimeout:  timeout,
+			ReadTimeout:  timeout,
+			WriteTimeout: timeout,
+		}),
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (c *Redis) Get(ctx context.Context, key string, v interface{}) (bool, error) {
+	data, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cache get %s: %w", key, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("cache decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (c *Redis) Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cache encode %s: %w", key, err)
+	}
+	if err := c.client.Set(ctx, c.prefix+key, data, ttl).Err(); err != nil {
+		return fmt.Errorf("cache set %s: %w", key, err)
+	}
+	return nil
+}
+
+func (c *Redis) Incr(ctx context.Context, key string) (int64, error) {
+	n, err := c.client.Incr(ctx, c.prefix+key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("cache incr %s: %w", key, err)
+	}
+	return n, nil
+}
+
+func (c *Redis) Add(ctx context.Context, key string, v interface{}, ttl time.Duration) (bool, error) {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false, fmt.Errorf("cache encode %s: %w", key, err)
+	}
+	added, err := c.client.SetNX(ctx, c.prefix+key, data, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("cache add %s: %w", key, err)
+	}
+	return added, nil
+}
+
+func (c *Redis) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+func (c *Redis) Close() error {
+	return c.client.Close()
+}
+
+// Null is the Cache used when caching is disabled. It stores nothing, so
+// every Get misses.
+type Null struct{}
+
+func (Null) Get(context.Context, string, interface{}) (bool, error) { return false, nil }
+
+func (Null) Set(context.Context, string, interface{}, time.Duration) error { return nil }
+
+func (Null) Incr(context.Context, string) (int64, error) { return 0, nil }
+
+func (Null) Add(context.Context, string, interface{}, time.Duration) (bool, error) { return true, nil }
+
+func (Null) Ping(context.Context) error { return nil }
+
+func (Null) Close() error { return nil }
@@ -0,0 +1,90 @@
+// Package conditional answers conditional GET requests of catalog routes,
+// sparing clients that poll them the body of responses they already have.
+// Responses are tagged with a weak ETag computed from their body, so a tag
+// changes with anything shown, such as a translation or a category name, and
+// requests whose If-None-Match lists the current tag get 304 Not Modified.
+package conditional
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Middleware tags the successful responses of GET requests with a weak ETag
+// and answers them with 304 Not Modified when If-None-Match matches it.
+// Responses are buffered, so it suits small JSON documents, not streams.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+			return
+		}
+
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			etag = ETag(rec.body.Bytes())
+			w.Header().Set("ETag", etag)
+		}
+		if Matches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Del("Content-Type")
+			w.Header().Del("Content-Length")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// ETag returns the weak entity tag of a response body
+func ETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Matches reports whether the If-None-Match header lists etag, or is *,
+// comparing tags weakly as RFC 9110 has for If-None-Match
+func Matches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// recorder holds back the status and body of a response, passing its
+// headers through
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	return r.body.Write(p)
+}
@@ -1,17 +1,48 @@
 package config
 
 import (
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 type Config struct {
-	Environment string         `yaml:"environment"`
-	Server      ServerConfig   `yaml:"server"`
-	Database    DatabaseConfig `yaml:"database"`
-	JWT         JWTConfig      `yaml:"jwt"`
-	NewRelic    NewRelicConfig `yaml:"newrelic"`
-	Logger      LoggerConfig   `yaml:"logger"`
+	Environment    string               `yaml:"environment"`
+	Server         ServerConfig         `yaml:"server"`
+	Database       DatabaseConfig       `yaml:"database"`
+	JWT            JWTConfig            `yaml:"jwt"`
+	LoginThrottle  LoginThrottleConfig  `yaml:"login_throttle"`
+	Password       PasswordConfig       `yaml:"password"`
+	Accounts       AccountsConfig       `yaml:"accounts"`
+	DataExport     DataExportConfig     `yaml:"data_export"`
+	NewRelic       NewRelicConfig       `yaml:"newrelic"`
+	OTel           OTelConfig           `yaml:"otel"`
+	ErrorReporting ErrorReportingConfig `yaml:"error_reporting"`
+	Logger         LoggerConfig         `yaml:"logger"`
+	Health         HealthConfig         `yaml:"health"`
+	Metrics        MetricsConfig        `yaml:"metrics"`
+	Cache          CacheConfig          `yaml:"cache"`
+	RateLimit      RateLimitConfig      `yaml:"rate_limit"`
+	Webhooks       WebhookConfig        `yaml:"webhooks"`
+	Replay         ReplayConfig         `yaml:"replay"`
+	Analytics      AnalyticsConfig      `yaml:"analytics"`
+	Export         ExportConfig         `yaml:"export"`
+	Embedding      EmbeddingConfig      `yaml:"embedding"`
+	Trending       TrendingConfig       `yaml:"trending"`
+	Workflow       WorkflowConfig       `yaml:"workflow"`
+	Trash          TrashConfig          `yaml:"trash"`
+	Moderation     ModerationConfig     `yaml:"moderation"`
+	Email          EmailConfig          `yaml:"email"`
+	OAuth          OAuthConfig          `yaml:"oauth"`
+	Storage        StorageConfig        `yaml:"storage"`
+	Video          VideoConfig          `yaml:"video"`
+	Playback       PlaybackConfig       `yaml:"playback"`
+	TMDB           TMDBConfig           `yaml:"tmdb"`
+	GRPC           GRPCConfig           `yaml:"grpc"`
+	Notifications  NotificationsConfig  `yaml:"notifications"`
+	Billing        BillingConfig        `yaml:"billing"`
+	Entitlements   EntitlementsConfig   `yaml:"entitlements"`
 }
 
 type ServerConfig struct {
@@ -19,19 +50,178 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
-	Host            string `yaml:"host"`
-	Port            string `yaml:"port"`
-	User            string `yaml:"user"`
-	Password        string `yaml:"password"`
-	Database        string `yaml:"database"`
-	SSLMode         string `yaml:"sslmode"`
-	MaxOpenConns    int    `yaml:"maxOpenConns"`
-	MaxIdleConns    int    `yaml:"maxIdleConns"`
-	ConnMaxLifetime int    `yaml:"connMaxLifetime"`
+	Host            string      `yaml:"host"`
+	Port            string      `yaml:"port"`
+	User            string      `yaml:"user"`
+	Password        string      `yaml:"password"`
+	Database        string      `yaml:"database"`
+	SSLMode         string      `yaml:"sslmode"`
+	MaxOpenConns    int         `yaml:"maxOpenConns"`
+	MaxIdleConns    int         `yaml:"maxIdleConns"`
+	ConnMaxLifetime int         `yaml:"connMaxLifetime"`
+	StartupRetry    RetryConfig `yaml:"startup_retry"`
+	// SlowQueryThreshold is how long a query may take before it is logged as
+	// slow; zero logs none
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold"`
+	// QueryTimeout bounds each query of requests, 5s by default; background
+	// jobs are not bound. StatementTimeout is the statement_timeout of every
+	// connection, jobs included, enforced by Postgres; zero sets none.
+	QueryTimeout     time.Duration `yaml:"query_timeout"`
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	Replicas         ReplicaConfig `yaml:"replicas"`
+}
+
+// ReplicaConfig lists read replicas of the database by connection URL. Public
+// catalog reads are spread over them, and replicas are checked every
+// CheckInterval (default 10s), skipped while unreachable or lagging more than
+// MaxLag (default 30s) behind the primary. Pool settings are the primary's.
+type ReplicaConfig struct {
+	URLs          []string      `yaml:"urls"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+	MaxLag        time.Duration `yaml:"max_lag"`
+}
+
+// RetryConfig retries with exponential backoff, from InitialInterval up to
+// MaxInterval, for up to MaxWait. Jitter, a fraction below 1, spreads each
+// delay randomly either way; MaxAttempts, if set, caps the attempts made.
+type RetryConfig struct {
+	InitialInterval time.Duration `yaml:"initial_interval"`
+	MaxInterval     time.Duration `yaml:"max_interval"`
+	MaxWait         time.Duration `yaml:"max_wait"`
+	Jitter          float64       `yaml:"jitter"`
+	MaxAttempts     int           `yaml:"max_attempts"`
 }
 
+// URL returns the PostgreSQL connection URL for this configuration
+func (d DatabaseConfig) URL() string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		d.User,
+		d.Password,
+		d.Host,
+		d.Port,
+		d.Database,
+		d.SSLMode,
+	)
+}
+
+// JWTConfig signs access tokens, which expire after AccessTTL, and sets how
+// long refresh tokens last before the user must log in again. Algorithm is
+// HS256 (the default), signing with Secret, or RS256, signing with the RSA
+// key named SigningKeyID among the jwt_signing_keys of the secrets file, or
+// the first of them. With RS256, tokens signed with Secret, if set, remain
+// valid.
 type JWTConfig struct {
-	Secret string `yaml:"secret"`
+	Secret       string        `yaml:"secret"`
+	Algorithm    string        `yaml:"algorithm"`
+	SigningKeyID string        `yaml:"signing_key_id"`
+	AccessTTL    time.Duration `yaml:"access_ttl"`
+	RefreshTTL   time.Duration `yaml:"refresh_ttl"`
+}
+
+// PasswordConfig sets how passwords are hashed, with Algorithm bcrypt (the
+// default) or argon2id, and what new passwords must be. Hashes made another
+// way, such as before the algorithm or its cost changed, keep working and
+// are rehashed when their user logs in.
+type PasswordConfig struct {
+	Algorithm  string         `yaml:"algorithm"`
+	BcryptCost int            `yaml:"bcrypt_cost"`
+	Argon2     Argon2Config   `yaml:"argon2"`
+	Policy     PasswordPolicy `yaml:"policy"`
+}
+
+// Argon2Config are the Argon2id parameters: Time passes over Memory KiB
+// with Threads lanes, deriving KeyLength bytes from a SaltLength byte salt.
+// Parameters left unset follow the OWASP recommendation of 19 MiB, two
+// passes and one lane.
+type Argon2Config struct {
+	Time       uint32 `yaml:"time"`
+	Memory     uint32 `yaml:"memory"`
+	Threads    uint8  `yaml:"threads"`
+	KeyLength  uint32 `yaml:"key_length"`
+	SaltLength uint32 `yaml:"salt_length"`
+}
+
+// PasswordPolicy is what passwords chosen at registration or reset must
+// be: at least MinLength characters, 8 by default, and at most MaxLength
+// bytes, 72 by default as bcrypt ignores the rest, with the character
+// classes required.
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length"`
+	MaxLength     int  `yaml:"max_length"`
+	RequireUpper  bool `yaml:"require_upper"`
+	RequireLower  bool `yaml:"require_lower"`
+	RequireDigit  bool `yaml:"require_digit"`
+	RequireSymbol bool `yaml:"require_symbol"`
+}
+
+// LoginThrottleConfig slows down password guessing when Enabled. Once an
+// email address, or an IP address, has FreeAttempts failed logins in a row,
+// each attempt must wait BaseDelay after the last failure, doubling with
+// every further failure up to MaxDelay. After LockoutAttempts failures the
+// account of an email address is locked for LockoutDuration, or until an
+// admin unlocks it; zero never locks. Failures are forgotten Window after
+// the last one. Durations left unset default to 1s, 15m, 30m and 1h.
+type LoginThrottleConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	FreeAttempts    int           `yaml:"free_attempts"`
+	BaseDelay       time.Duration `yaml:"base_delay"`
+	MaxDelay        time.Duration `yaml:"max_delay"`
+	LockoutAttempts int           `yaml:"lockout_attempts"`
+	LockoutDuration time.Duration `yaml:"lockout_duration"`
+	Window          time.Duration `yaml:"window"`
+}
+
+// AccountsConfig schedules the removal of accounts their users deleted.
+// They are kept, unusable, for DeletionGracePeriod (default 30 days), then
+// removed for good by a job running every PurgeInterval (default 1h).
+type AccountsConfig struct {
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period"`
+	PurgeInterval       time.Duration `yaml:"purge_interval"`
+}
+
+// DataExportConfig sets how the archives users export of their data are
+// built and kept. They are built by a worker polling every PollInterval
+// (default 10s); exports running longer than JobTimeout (default 10m) are
+// queued again. Archives are kept in the storage bucket for Retention
+// (default 7 days) and downloaded with links valid for LinkExpiry (default
+// 15m), issued each time the export's status is read.
+type DataExportConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	JobTimeout   time.Duration `yaml:"job_timeout"`
+	Retention    time.Duration `yaml:"retention"`
+	LinkExpiry   time.Duration `yaml:"link_expiry"`
+}
+
+// OTelConfig exports OpenTelemetry traces over OTLP when Enabled, e.g. to
+// Jaeger or Tempo. Protocol is grpc (the default, usually port 4317) or http
+// (usually port 4318). SampleRatio is the share of new traces recorded, all
+// of them when zero; traces started by a caller follow the caller's decision.
+type OTelConfig struct {
+	Enabled     bool              `yaml:"enabled"`
+	ServiceName string            `yaml:"service_name"`
+	Endpoint    string            `yaml:"endpoint"`
+	Protocol    string            `yaml:"protocol"`
+	Insecure    bool              `yaml:"insecure"`
+	Headers     map[string]string `yaml:"headers"`
+	SampleRatio float64           `yaml:"sample_ratio"`
+}
+
+// ErrorReportingConfig reports panics and server errors when Enabled, to
+// Sentry (the default Provider), whose DSN is the error_reporting_dsn
+// secret, or with the webhook provider as signed JSON posted to Endpoint,
+// the name of one of Webhooks.Endpoints. Responses with
+// a status in IgnoreStatuses, such as the 503 of a failing readiness check,
+// are not reported. BufferSize events (default 100) wait to be sent, each
+// within Timeout (default 5s).
+type ErrorReportingConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Provider       string        `yaml:"provider"`
+	Endpoint       string        `yaml:"endpoint"`
+	Environment    string        `yaml:"environment"`
+	Release        string        `yaml:"release"`
+	IgnoreStatuses []int         `yaml:"ignore_statuses"`
+	BufferSize     int           `yaml:"buffer_size"`
+	Timeout        time.Duration `yaml:"timeout"`
 }
 
 type NewRelicConfig struct {
@@ -46,12 +236,343 @@ type LoggerConfig struct {
 	Encoding string `yaml:"encoding"`
 }
 
+type HealthConfig struct {
+	CheckInterval time.Duration `yaml:"check_interval"`
+	CheckTimeout  time.Duration `yaml:"check_timeout"`
+}
+
+// MetricsConfig serves Prometheus metrics at Path, /metrics by default, when
+// Enabled
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+}
+
+// CacheConfig caches frequent reads, such as movie listings, in the Redis
+// server at Addr when Enabled. Cached values expire after TTL, a minute by
+// default, and are dropped as soon as the data behind them changes. Timeout
+// bounds each Redis call, so a slow cache falls back to the database quickly.
+type CacheConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Addr     string        `yaml:"addr"`
+	Password string        `yaml:"password"`
+	DB       int           `yaml:"db"`
+	Prefix   string        `yaml:"prefix"`
+	TTL      time.Duration `yaml:"ttl"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+// GRPCConfig serves the movie and user services over gRPC on Port, apart
+// from the HTTP API, for other internal services; empty Port disables it.
+// CertFile and KeyFile serve it over TLS. ClientCAFile enables mutual TLS:
+// clients presenting a certificate it signed are trusted without a bearer
+// token, and AllowedClients, when set, limits them to the listed common
+// or DNS names.
+type GRPCConfig struct {
+	Port           string   `yaml:"port"`
+	CertFile       string   `yaml:"cert_file"`
+	KeyFile        string   `yaml:"key_file"`
+	ClientCAFile   string   `yaml:"client_ca_file"`
+	AllowedClients []string `yaml:"allowed_clients"`
+}
+
+// NotificationsConfig tunes the WebSocket notifications channel. Clients
+// must authenticate within AuthTimeout of connecting, and are pinged every
+// PingInterval to detect dead connections.
+type NotificationsConfig struct {
+	AuthTimeout  time.Duration `yaml:"auth_timeout"`
+	PingInterval time.Duration `yaml:"ping_interval"`
+}
+
+// BillingConfig configures subscriptions billed through Stripe. SecretKey
+// is the Stripe API secret key; empty disables billing, and with it the
+// subscription check on playback. WebhookSecret is the signing secret of
+// the endpoint Stripe sends events to. SuccessURL and CancelURL are where
+// Checkout sends customers back to, and PortalReturnURL where the customer
+// portal does.
+type BillingConfig struct {
+	SecretKey       string        `yaml:"secret_key"`
+	WebhookSecret   string        `yaml:"webhook_secret"`
+	URL             string        `yaml:"url"`
+	SuccessURL      string        `yaml:"success_url"`
+	CancelURL       string        `yaml:"cancel_url"`
+	PortalReturnURL string        `yaml:"portal_return_url"`
+	Timeout         time.Duration `yaml:"timeout"`
+}
+
+// Entitlement is what subscribers of a plan may do when playing videos.
+// MaxHeight caps the height in pixels of the HLS renditions they stream and
+// MaxStreams how many videos they play at once, zero being no limit;
+// Downloads lets them download videos to watch offline.
+type Entitlement struct {
+	MaxHeight  int  `yaml:"max_height"`
+	MaxStreams int  `yaml:"max_streams"`
+	Downloads  bool `yaml:"downloads"`
+}
+
+// EntitlementsConfig maps plan codes to the Entitlement of their
+// subscribers. Subscribers of plans not listed get Default.
+type EntitlementsConfig struct {
+	Default Entitlement            `yaml:"default"`
+	Plans   map[string]Entitlement `yaml:"plans"`
+}
+
+// RateLimit allows Requests per Per duration
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+}
+
+type RateLimitConfig struct {
+	Enabled         bool                 `yaml:"enabled"`
+	Default         RateLimit            `yaml:"default"`
+	Groups          map[string]RateLimit `yaml:"groups"`
+	PlanMultipliers map[string]float64   `yaml:"plan_multipliers"`
+}
+
+// WebhookEndpoint is a subscriber that receives signed outbound webhooks
+type WebhookEndpoint struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+type WebhookConfig struct {
+	Timeout   time.Duration              `yaml:"timeout"`
+	Tolerance time.Duration              `yaml:"tolerance"`
+	Endpoints map[string]WebhookEndpoint `yaml:"endpoints"`
+	// Inbound maps the name of each provider we accept webhooks from to its
+	// signing secrets. More than one secret may be listed during rotation.
+	// Those of stripe are accepted along with Billing.WebhookSecret.
+	Inbound map[string][]string `yaml:"inbound"`
+}
+
+// ReplayConfig bounds how old a signed request may be and how long its
+// nonce is remembered
+type ReplayConfig struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// AnalyticsConfig sizes the asynchronous analytics write pipeline and
+// schedules the daily rollups
+type AnalyticsConfig struct {
+	BufferSize    int           `yaml:"buffer_size"`
+	BatchSize     int           `yaml:"batch_size"`
+	FlushInterval time.Duration `yaml:"flush_interval"`
+	// RollupInterval is how often daily stats are recomputed and RollupLookback
+	// how many past days are recomputed each time, to pick up late events
+	RollupInterval time.Duration `yaml:"rollup_interval"`
+	RollupLookback time.Duration `yaml:"rollup_lookback"`
+	// RawRetention is how long raw events are kept; zero keeps them forever
+	RawRetention time.Duration `yaml:"raw_retention"`
+}
+
+// ExportSink is an external warehouse analytics are shipped to. URL,
+// Database, Username and Password apply to ClickHouse; Project, Dataset and
+// CredentialsFile (a service account key) to BigQuery.
+type ExportSink struct {
+	Type            string `yaml:"type"`
+	URL             string `yaml:"url"`
+	Database        string `yaml:"database"`
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Project         string `yaml:"project"`
+	Dataset         string `yaml:"dataset"`
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+type ExportConfig struct {
+	Interval  time.Duration         `yaml:"interval"`
+	BatchSize int                   `yaml:"batch_size"`
+	Timeout   time.Duration         `yaml:"timeout"`
+	Sinks     map[string]ExportSink `yaml:"sinks"`
+}
+
+// EmbeddingConfig selects the provider movie embeddings are computed with. An
+// empty Provider disables embeddings and similar titles fall back to shared
+// categories.
+type EmbeddingConfig struct {
+	Provider  string        `yaml:"provider"`
+	URL       string        `yaml:"url"`
+	APIKey    string        `yaml:"api_key"`
+	Model     string        `yaml:"model"`
+	BatchSize int           `yaml:"batch_size"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+// TrendingConfig schedules the trending score and sets its default
+// parameters, which admins can override at runtime
+type TrendingConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	// HalfLife is the age at which a day's plays count for half, and Window
+	// how far back plays are counted at all
+	HalfLife time.Duration `yaml:"half_life"`
+	Window   time.Duration `yaml:"window"`
+	// AgeGravity is the exponent of the catalog age scores are divided by;
+	// zero stops older titles from being penalised
+	AgeGravity float64 `yaml:"age_gravity"`
+}
+
+// WorkflowConfig schedules the job publishing scheduled movies once their
+// publish_at has passed, every PublishInterval (default 1m)
+type WorkflowConfig struct {
+	PublishInterval time.Duration `yaml:"publish_interval"`
+}
+
+// TrashConfig schedules the removal of deleted movies and categories. They
+// are kept, restorable, for Retention (default 30 days), then removed for
+// good by a job running every PurgeInterval (default 1h).
+type TrashConfig struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// ModerationConfig sets how user-generated text is screened. Text containing
+// a blocked word is rejected; text containing a flagged word, more than
+// MaxLinks links (zero allows any number) or flagged by the external
+// Provider is accepted but queued for moderator review. An empty Provider
+// screens with the wordlists alone.
+type ModerationConfig struct {
+	BlockedWords []string      `yaml:"blocked_words"`
+	FlaggedWords []string      `yaml:"flagged_words"`
+	MaxLinks     int           `yaml:"max_links"`
+	Provider     string        `yaml:"provider"`
+	URL          string        `yaml:"url"`
+	APIKey       string        `yaml:"api_key"`
+	Model        string        `yaml:"model"`
+	Timeout      time.Duration `yaml:"timeout"`
+	// RejectCategories lists the provider categories that reject text
+	// outright instead of queueing it
+	RejectCategories []string `yaml:"reject_categories"`
+}
+
+// EmailConfig sets how transactional email, such as password reset links,
+// is sent. An empty SMTPHost logs messages instead of sending them, for
+// development. ResetURL is the page of the client app that completes a
+// password reset, and ConfirmEmailURL the one confirming a new email
+// address; the token is appended as their token query parameter.
+// Confirmation links expire after EmailChangeTTL (default 24h).
+type EmailConfig struct {
+	SMTPHost         string        `yaml:"smtp_host"`
+	SMTPPort         string        `yaml:"smtp_port"`
+	Username         string        `yaml:"username"`
+	Password         string        `yaml:"password"`
+	From             string        `yaml:"from"`
+	ResetURL         string        `yaml:"reset_url"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl"`
+	ConfirmEmailURL  string        `yaml:"confirm_email_url"`
+	EmailChangeTTL   time.Duration `yaml:"email_change_ttl"`
+}
+
+// OAuthConfig enables social login with the providers configured under
+// Providers, keyed by name (google or github). A provider without a client
+// ID is disabled. StateTTL is how long a user has to finish signing in with
+// the provider.
+type OAuthConfig struct {
+	StateTTL  time.Duration                  `yaml:"state_ttl"`
+	Timeout   time.Duration                  `yaml:"timeout"`
+	Providers map[string]OAuthProviderConfig `yaml:"providers"`
+}
+
+// OAuthProviderConfig holds the client registered with an OAuth provider.
+// RedirectURL must match the callback route registered there. Scopes
+// defaults to what is needed to read the user's name and verified email.
+type OAuthProviderConfig struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// StorageConfig stores uploaded files, such as movie posters, in Bucket of
+// the S3-compatible server at Endpoint, e.g. s3.amazonaws.com or a MinIO
+// server. PublicURL is the base URL objects are served from, usually a CDN
+// in front of the bucket, and defaults to the bucket's own URL. An empty
+// Endpoint disables uploads. MaxPosterSize and MaxAvatarSize are in bytes,
+// 5 and 2 MiB by default.
+type StorageConfig struct {
+	Endpoint      string        `yaml:"endpoint"`
+	Region        string        `yaml:"region"`
+	Bucket        string        `yaml:"bucket"`
+	AccessKey     string        `yaml:"access_key"`
+	SecretKey     string        `yaml:"secret_key"`
+	UseSSL        bool          `yaml:"use_ssl"`
+	PublicURL     string        `yaml:"public_url"`
+	MaxPosterSize int64         `yaml:"max_poster_size"`
+	MaxAvatarSize int64         `yaml:"max_avatar_size"`
+	Timeout       time.Duration `yaml:"timeout"`
+}
+
+// VideoConfig sets how uploaded videos are stored and transcoded. Videos
+// are uploaded to the storage bucket, directly or with a presigned URL valid
+// for UploadURLExpiry, and transcoded by a worker into the HLS Renditions.
+// Workers only run in instances with Transcode set, which need FFmpeg
+// (ffmpeg on the PATH by default) and room in WorkDir (the system temporary
+// directory by default). MaxUploadSize is in bytes; zero allows any size.
+type VideoConfig struct {
+	MaxUploadSize   int64         `yaml:"max_upload_size"`
+	UploadTimeout   time.Duration `yaml:"upload_timeout"`
+	UploadURLExpiry time.Duration `yaml:"upload_url_expiry"`
+	Transcode       bool          `yaml:"transcode"`
+	FFmpeg          string        `yaml:"ffmpeg"`
+	WorkDir         string        `yaml:"work_dir"`
+	PollInterval    time.Duration `yaml:"poll_interval"`
+	// JobTimeout bounds a transcode; jobs running longer, such as those of a
+	// worker that died, are queued again up to MaxAttempts times
+	JobTimeout      time.Duration     `yaml:"job_timeout"`
+	MaxAttempts     int               `yaml:"max_attempts"`
+	SegmentDuration time.Duration     `yaml:"segment_duration"`
+	Renditions      []RenditionConfig `yaml:"renditions"`
+}
+
+// RenditionConfig is one HLS rendition: the video scaled to Height pixels,
+// keeping its aspect ratio, and encoded at VideoBitrate and AudioBitrate,
+// in kbit/s
+type RenditionConfig struct {
+	Name         string `yaml:"name"`
+	Height       int    `yaml:"height"`
+	VideoBitrate int    `yaml:"video_bitrate"`
+	AudioBitrate int    `yaml:"audio_bitrate"`
+}
+
+// PlaybackConfig sets how signed playback URLs are issued. They are signed
+// with the StorageKey secret and expire after TTL. BaseURL is where they
+// point: empty for the API's own /api/stream route, which streams the
+// video from where it is stored, or a CDN that verifies tokens at its
+// edge. StreamTimeout bounds a single streamed response. LocalDir is the
+// directory videos stored as local files, with file: video URLs, are served
+// from; empty disables them. A stream counts against the concurrent streams
+// of its user's plan until StreamIdle after its player last fetched from
+// it. Download URLs expire after DownloadTTL.
+type PlaybackConfig struct {
+	TTL           time.Duration `yaml:"ttl"`
+	BaseURL       string        `yaml:"base_url"`
+	StreamTimeout time.Duration `yaml:"stream_timeout"`
+	LocalDir      string        `yaml:"local_dir"`
+	StreamIdle    time.Duration `yaml:"stream_idle"`
+	DownloadTTL   time.Duration `yaml:"download_ttl"`
+}
+
+// TMDBConfig configures movie imports from The Movie Database. APIKey is a
+// v4 API read access token or a v3 API key; empty disables imports.
+// Language is the TMDB language metadata is fetched in, and ImageURL the
+// base URL posters are served from, including the image size.
+type TMDBConfig struct {
+	APIKey   string        `yaml:"api_key"`
+	URL      string        `yaml:"url"`
+	ImageURL string        `yaml:"image_url"`
+	Language string        `yaml:"language"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
 func LoadConfig(configPath string) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
 
+	// Resolve ${VAR} references from the environment
+	data = []byte(os.ExpandEnv(string(data)))
+
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, err
@@ -0,0 +1,544 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minJWTSecretLength is the shortest HS256 secret accepted at startup
+const minJWTSecretLength = 32
+
+// ValidationError lists every problem found in a Config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e.Problems))
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+// Validate checks the configuration for missing, malformed and conflicting
+// values. It reports all problems at once rather than stopping at the first.
+func (c *Config) Validate() error {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Environment {
+	case "development", "staging", "production":
+	default:
+		add("environment: must be one of development, staging, production (got %q)", c.Environment)
+	}
+
+	if !validPort(c.Server.Port) {
+		add("server.port: must be a number between 1 and 65535 (got %q)", c.Server.Port)
+	}
+
+	// Database
+	if c.Database.Host == "" {
+		add("database.host: is required")
+	}
+	if !validPort(c.Database.Port) {
+		add("database.port: must be a number between 1 and 65535 (got %q)", c.Database.Port)
+	}
+	if c.Database.User == "" {
+		add("database.user: is required")
+	}
+	if c.Database.Database == "" {
+		add("database.database: is required")
+	}
+	switch c.Database.SSLMode {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+	default:
+		add("database.sslmode: must be one of disable, allow, prefer, require, verify-ca, verify-full (got %q)", c.Database.SSLMode)
+	}
+	if c.Database.MaxOpenConns < 0 || c.Database.MaxIdleConns < 0 || c.Database.ConnMaxLifetime < 0 {
+		add("database: connection pool settings must not be negative")
+	}
+	if c.Database.SlowQueryThreshold < 0 {
+		add("database.slow_query_threshold: must not be negative (got %s)", c.Database.SlowQueryThreshold)
+	}
+	if c.Database.QueryTimeout < 0 || c.Database.StatementTimeout < 0 {
+		add("database: query_timeout and statement_timeout must not be negative")
+	}
+	if q, st := c.Database.QueryTimeout, c.Database.StatementTimeout; q > 0 && st > 0 && st < q {
+		add("database.statement_timeout: (%s) must not be shorter than query_timeout (%s)", st, q)
+	}
+	for i, replicaURL := range c.Database.Replicas.URLs {
+		if u, err := url.Parse(replicaURL); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" {
+			add("database.replicas.urls[%d]: must be a postgres:// connection URL", i)
+		}
+	}
+	if r := c.Database.Replicas; r.CheckInterval < 0 || r.MaxLag < 0 {
+		add("database.replicas: check_interval and max_lag must not be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		add("database.maxIdleConns: (%d) must not exceed maxOpenConns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+	if r := c.Database.StartupRetry; r.InitialInterval > 0 && r.MaxInterval > 0 && r.InitialInterval > r.MaxInterval {
+		add("database.startup_retry: initial_interval (%s) must not exceed max_interval (%s)", r.InitialInterval, r.MaxInterval)
+	}
+	if r := c.Database.StartupRetry; r.Jitter < 0 || r.Jitter >= 1 {
+		add("database.startup_retry.jitter: must be at least 0 and below 1 (got %g)", r.Jitter)
+	}
+	if c.Database.StartupRetry.MaxAttempts < 0 {
+		add("database.startup_retry.max_attempts: must not be negative (got %d)", c.Database.StartupRetry.MaxAttempts)
+	}
+
+	// JWT
+	switch c.JWT.Algorithm {
+	case "", "HS256", "RS256":
+	default:
+		add("jwt.algorithm: must be HS256 or RS256 (got %q)", c.JWT.Algorithm)
+	}
+	switch {
+	case c.JWT.Secret == "" && c.JWT.Algorithm == "RS256":
+	case c.JWT.Secret == "":
+		add("jwt.secret: is required (set JWT_SECRET)")
+	case strings.Contains(c.JWT.Secret, "${"):
+		add("jwt.secret: contains an unresolved placeholder %q", c.JWT.Secret)
+	case len(c.JWT.Secret) < minJWTSecretLength:
+		add("jwt.secret: must be at least %d characters (got %d)", minJWTSecretLength, len(c.JWT.Secret))
+	}
+	if c.JWT.AccessTTL < 0 || c.JWT.RefreshTTL < 0 {
+		add("jwt: access_ttl and refresh_ttl must not be negative")
+	}
+	if c.JWT.AccessTTL > 0 && c.JWT.RefreshTTL > 0 && c.JWT.RefreshTTL < c.JWT.AccessTTL {
+		add("jwt.refresh_ttl: (%s) must not be shorter than access_ttl (%s)", c.JWT.RefreshTTL, c.JWT.AccessTTL)
+	}
+
+	// Passwords
+	switch c.Password.Algorithm {
+	case "", "bcrypt", "argon2id":
+	default:
+		add("password.algorithm: must be bcrypt or argon2id (got %q)", c.Password.Algorithm)
+	}
+	if cost := c.Password.BcryptCost; cost != 0 && (cost < 4 || cost > 31) {
+		add("password.bcrypt_cost: must be between 4 and 31 (got %d)", cost)
+	}
+	if p := c.Password.Policy; p.MinLength < 0 || p.MaxLength < 0 {
+		add("password.policy: min_length and max_length must not be negative")
+	}
+	if p := c.Password.Policy; p.MaxLength > 0 && p.MaxLength < p.MinLength {
+		add("password.policy.max_length: (%d) must not be less than min_length (%d)", p.MaxLength, p.MinLength)
+	}
+	if c.Password.Algorithm != "argon2id" && c.Password.Policy.MaxLength > 72 {
+		add("password.policy.max_length: must not exceed 72 with bcrypt (got %d)", c.Password.Policy.MaxLength)
+	}
+
+	// Login throttling
+	if t := c.LoginThrottle; t.FreeAttempts < 0 || t.BaseDelay < 0 || t.MaxDelay < 0 || t.LockoutAttempts < 0 || t.LockoutDuration < 0 || t.Window < 0 {
+		add("login_throttle: settings must not be negative")
+	}
+	if t := c.LoginThrottle; t.BaseDelay > 0 && t.MaxDelay > 0 && t.BaseDelay > t.MaxDelay {
+		add("login_throttle: base_delay (%s) must not exceed max_delay (%s)", t.BaseDelay, t.MaxDelay)
+	}
+
+	// Account deletion
+	if c.Accounts.DeletionGracePeriod < 0 || c.Accounts.PurgeInterval < 0 {
+		add("accounts: deletion_grace_period and purge_interval must not be negative")
+	}
+
+	// Data export
+	if e := c.DataExport; e.PollInterval < 0 || e.JobTimeout < 0 || e.Retention < 0 || e.LinkExpiry < 0 {
+		add("data_export: poll_interval, job_timeout, retention and link_expiry must not be negative")
+	}
+	if c.DataExport.LinkExpiry > 7*24*time.Hour {
+		add("data_export.link_expiry: must be at most 7 days (got %s)", c.DataExport.LinkExpiry)
+	}
+
+	// New Relic
+	if c.NewRelic.Enabled {
+		if c.NewRelic.AppName == "" {
+			add("newrelic.app_name: is required when newrelic is enabled")
+		}
+		if c.NewRelic.LicenseKey == "" || strings.Contains(c.NewRelic.LicenseKey, "${") {
+			add("newrelic.license_key: is required when newrelic is enabled (set NEW_RELIC_LICENSE_KEY or disable newrelic)")
+		}
+	}
+
+	// OpenTelemetry
+	if c.OTel.Enabled {
+		if c.OTel.Endpoint == "" {
+			add("otel.endpoint: is required when otel is enabled")
+		}
+		switch c.OTel.Protocol {
+		case "", "grpc", "http":
+		default:
+			add("otel.protocol: must be grpc or http (got %q)", c.OTel.Protocol)
+		}
+	}
+	if c.OTel.SampleRatio < 0 || c.OTel.SampleRatio > 1 {
+		add("otel.sample_ratio: must be between 0 and 1 (got %g)", c.OTel.SampleRatio)
+	}
+
+	// Error reporting
+	switch c.ErrorReporting.Provider {
+	case "", "sentry", "webhook":
+	default:
+		add("error_reporting.provider: must be sentry or webhook (got %q)", c.ErrorReporting.Provider)
+	}
+	if c.ErrorReporting.Enabled && c.ErrorReporting.Provider == "webhook" {
+		if _, ok := c.Webhooks.Endpoints[c.ErrorReporting.Endpoint]; !ok {
+			add("error_reporting.endpoint: must name one of webhooks.endpoints with the webhook provider (got %q)", c.ErrorReporting.Endpoint)
+		}
+	}
+	if c.ErrorReporting.BufferSize < 0 || c.ErrorReporting.Timeout < 0 {
+		add("error_reporting: buffer_size and timeout must not be negative")
+	}
+	for _, status := range c.ErrorReporting.IgnoreStatuses {
+		if status < 500 || status > 599 {
+			add("error_reporting.ignore_statuses: must be server error statuses (got %d)", status)
+		}
+	}
+
+	// Logger
+	switch c.Logger.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		add("logger.level: must be one of debug, info, warn, error (got %q)", c.Logger.Level)
+	}
+	switch c.Logger.Encoding {
+	case "json", "console":
+	default:
+		add("logger.encoding: must be json or console (got %q)", c.Logger.Encoding)
+	}
+
+	// Health
+	if c.Health.CheckInterval > 0 && c.Health.CheckTimeout > c.Health.CheckInterval {
+		add("health.check_timeout: (%s) must not exceed check_interval (%s)", c.Health.CheckTimeout, c.Health.CheckInterval)
+	}
+
+	// Metrics
+	if c.Metrics.Path != "" && !strings.HasPrefix(c.Metrics.Path, "/") {
+		add("metrics.path: must start with / (got %q)", c.Metrics.Path)
+	}
+
+	// Cache
+	if c.Cache.Enabled && c.Cache.Addr == "" {
+		add("cache.addr: is required when the cache is enabled")
+	}
+	if c.Cache.DB < 0 || c.Cache.TTL < 0 || c.Cache.Timeout < 0 {
+		add("cache: db, ttl and timeout must not be negative")
+	}
+
+	// Rate limiting
+	if c.RateLimit.Enabled {
+		limits := map[string]RateLimit{"default": c.RateLimit.Default}
+		for group, limit := range c.RateLimit.Groups {
+			limits["groups."+group] = limit
+		}
+		for name, limit := range limits {
+			if limit.Requests < 0 || (limit.Requests > 0 && limit.Per <= 0) {
+				add("rate_limit.%s: requests must not be negative and per must be a positive duration", name)
+			}
+		}
+		for plan, m := range c.RateLimit.PlanMultipliers {
+			if m <= 0 {
+				add("rate_limit.plan_multipliers.%s: must be greater than zero (got %v)", plan, m)
+			}
+		}
+	}
+
+	// Webhooks
+	if c.Webhooks.Timeout < 0 || c.Webhooks.Tolerance < 0 {
+		add("webhooks: timeout and tolerance must not be negative")
+	}
+	for name, ep := range c.Webhooks.Endpoints {
+		if !strings.HasPrefix(ep.URL, "http://") && !strings.HasPrefix(ep.URL, "https://") {
+			add("webhooks.endpoints.%s.url: must be an http(s) URL (got %q)", name, ep.URL)
+		}
+		if ep.Secret == "" || strings.Contains(ep.Secret, "${") {
+			add("webhooks.endpoints.%s.secret: is required", name)
+		}
+	}
+	for name, secrets := range c.Webhooks.Inbound {
+		if len(secrets) == 0 {
+			add("webhooks.inbound.%s: at least one secret is required", name)
+		}
+		for _, secret := range secrets {
+			if secret == "" || strings.Contains(secret, "${") {
+				add("webhooks.inbound.%s: contains an empty or unresolved secret", name)
+				break
+			}
+		}
+	}
+
+	// Replay protection
+	if c.Replay.Window < 0 {
+		add("replay.window: must not be negative (got %s)", c.Replay.Window)
+	}
+
+	// Analytics
+	if c.Analytics.BufferSize < 0 || c.Analytics.BatchSize < 0 || c.Analytics.FlushInterval < 0 {
+		add("analytics: buffer_size, batch_size and flush_interval must not be negative")
+	}
+	if c.Analytics.BufferSize > 0 && c.Analytics.BatchSize > c.Analytics.BufferSize {
+		add("analytics.batch_size: (%d) must not exceed buffer_size (%d)", c.Analytics.BatchSize, c.Analytics.BufferSize)
+	}
+	if c.Analytics.RollupInterval < 0 || c.Analytics.RollupLookback < 0 || c.Analytics.RawRetention < 0 {
+		add("analytics: rollup_interval, rollup_lookback and raw_retention must not be negative")
+	}
+	if c.Analytics.RawRetention > 0 && c.Analytics.RawRetention <= c.Analytics.RollupLookback {
+		add("analytics.raw_retention: (%s) must exceed rollup_lookback (%s)", c.Analytics.RawRetention, c.Analytics.RollupLookback)
+	}
+
+	// Warehouse export
+	if c.Export.Interval < 0 || c.Export.BatchSize < 0 || c.Export.Timeout < 0 {
+		add("export: interval, batch_size and timeout must not be negative")
+	}
+	for name, sink := range c.Export.Sinks {
+		switch sink.Type {
+		case "clickhouse":
+			if !strings.HasPrefix(sink.URL, "http://") && !strings.HasPrefix(sink.URL, "https://") {
+				add("export.sinks.%s.url: must be an http(s) URL (got %q)", name, sink.URL)
+			}
+			if sink.Database == "" {
+				add("export.sinks.%s.database: is required", name)
+			}
+		case "bigquery":
+			if sink.Project == "" || sink.Dataset == "" {
+				add("export.sinks.%s: project and dataset are required", name)
+			}
+			if sink.CredentialsFile == "" {
+				add("export.sinks.%s.credentials_file: is required", name)
+			}
+		default:
+			add("export.sinks.%s.type: must be clickhouse or bigquery (got %q)", name, sink.Type)
+		}
+	}
+
+	// Embeddings
+	switch c.Embedding.Provider {
+	case "":
+	case "openai", "ollama":
+		if c.Embedding.Model == "" {
+			add("embedding.model: is required")
+		}
+		if c.Embedding.URL != "" && !strings.HasPrefix(c.Embedding.URL, "http://") && !strings.HasPrefix(c.Embedding.URL, "https://") {
+			add("embedding.url: must be an http(s) URL (got %q)", c.Embedding.URL)
+		}
+	default:
+		add("embedding.provider: must be openai or ollama (got %q)", c.Embedding.Provider)
+	}
+	if c.Embedding.BatchSize < 0 || c.Embedding.Timeout < 0 {
+		add("embedding: batch_size and timeout must not be negative")
+	}
+
+	// Publication workflow
+	if c.Workflow.PublishInterval < 0 {
+		add("workflow: publish_interval must not be negative")
+	}
+
+	// Trash
+	if c.Trash.Retention < 0 || c.Trash.PurgeInterval < 0 {
+		add("trash: retention and purge_interval must not be negative")
+	}
+
+	// Trending
+	if c.Trending.Interval < 0 || c.Trending.HalfLife < 0 || c.Trending.Window < 0 || c.Trending.AgeGravity < 0 {
+		add("trending: interval, half_life, window and age_gravity must not be negative")
+	}
+	if c.Trending.Window > 0 && c.Trending.Window < 24*time.Hour {
+		add("trending.window: must be at least a day (got %s)", c.Trending.Window)
+	}
+
+	// Moderation
+	switch c.Moderation.Provider {
+	case "", "openai":
+	case "webhook":
+		if c.Moderation.URL == "" {
+			add("moderation.url: is required for the webhook provider")
+		}
+	default:
+		add("moderation.provider: must be openai or webhook (got %q)", c.Moderation.Provider)
+	}
+	if c.Moderation.URL != "" && !strings.HasPrefix(c.Moderation.URL, "http://") && !strings.HasPrefix(c.Moderation.URL, "https://") {
+		add("moderation.url: must be an http(s) URL (got %q)", c.Moderation.URL)
+	}
+	if c.Moderation.MaxLinks < 0 || c.Moderation.Timeout < 0 {
+		add("moderation: max_links and timeout must not be negative")
+	}
+	for _, word := range append(c.Moderation.BlockedWords, c.Moderation.FlaggedWords...) {
+		if strings.TrimSpace(word) == "" {
+			add("moderation: blocked_words and flagged_words must not contain empty entries")
+			break
+		}
+	}
+
+	// Email
+	if c.Email.SMTPHost != "" {
+		if !validPort(c.Email.SMTPPort) {
+			add("email.smtp_port: must be a number between 1 and 65535 (got %q)", c.Email.SMTPPort)
+		}
+		if c.Email.From == "" {
+			add("email.from: is required when smtp_host is set")
+		}
+	}
+	if !strings.HasPrefix(c.Email.ResetURL, "http://") && !strings.HasPrefix(c.Email.ResetURL, "https://") {
+		add("email.reset_url: must be an http(s) URL (got %q)", c.Email.ResetURL)
+	}
+	if !strings.HasPrefix(c.Email.ConfirmEmailURL, "http://") && !strings.HasPrefix(c.Email.ConfirmEmailURL, "https://") {
+		add("email.confirm_email_url: must be an http(s) URL (got %q)", c.Email.ConfirmEmailURL)
+	}
+	if c.Email.PasswordResetTTL < 0 || c.Email.EmailChangeTTL < 0 {
+		add("email: password_reset_ttl and email_change_ttl must not be negative")
+	}
+
+	// OAuth
+	for name, provider := range c.OAuth.Providers {
+		switch name {
+		case "google", "github":
+		default:
+			add("oauth.providers: unknown provider %q, must be google or github", name)
+			continue
+		}
+		if provider.ClientID == "" {
+			continue
+		}
+		if provider.ClientSecret == "" {
+			add("oauth.providers.%s.client_secret: is required when client_id is set", name)
+		}
+		if !strings.HasPrefix(provider.RedirectURL, "http://") && !strings.HasPrefix(provider.RedirectURL, "https://") {
+			add("oauth.providers.%s.redirect_url: must be an http(s) URL (got %q)", name, provider.RedirectURL)
+		}
+	}
+	if c.OAuth.StateTTL < 0 || c.OAuth.Timeout < 0 {
+		add("oauth: state_ttl and timeout must not be negative")
+	}
+
+	// Storage
+	if c.Storage.Endpoint != "" {
+		if strings.Contains(c.Storage.Endpoint, "://") {
+			add("storage.endpoint: must be a host[:port] without scheme (got %q)", c.Storage.Endpoint)
+		}
+		if c.Storage.Bucket == "" {
+			add("storage.bucket: is required when endpoint is set")
+		}
+	}
+	if c.Storage.PublicURL != "" && !strings.HasPrefix(c.Storage.PublicURL, "http://") && !strings.HasPrefix(c.Storage.PublicURL, "https://") {
+		add("storage.public_url: must be an http(s) URL (got %q)", c.Storage.PublicURL)
+	}
+	if c.Storage.MaxPosterSize < 0 || c.Storage.MaxAvatarSize < 0 || c.Storage.Timeout < 0 {
+		add("storage: max_poster_size, max_avatar_size and timeout must not be negative")
+	}
+
+	// Video
+	if c.Video.MaxUploadSize < 0 || c.Video.UploadTimeout < 0 || c.Video.UploadURLExpiry < 0 ||
+		c.Video.PollInterval < 0 || c.Video.JobTimeout < 0 || c.Video.MaxAttempts < 0 || c.Video.SegmentDuration < 0 {
+		add("video: sizes, durations and max_attempts must not be negative")
+	}
+	if c.Video.UploadURLExpiry > 7*24*time.Hour {
+		add("video.upload_url_expiry: must be at most 7 days (got %s)", c.Video.UploadURLExpiry)
+	}
+	if c.Video.Transcode && c.Storage.Endpoint == "" {
+		add("video.transcode: requires storage.endpoint")
+	}
+	renditions := make(map[string]bool)
+	for i, rendition := range c.Video.Renditions {
+		if rendition.Name == "" || strings.ContainsAny(rendition.Name, "/\\") {
+			add("video.renditions[%d].name: must be a non-empty name without slashes (got %q)", i, rendition.Name)
+		}
+		if renditions[rendition.Name] {
+			add("video.renditions[%d].name: %q is used more than once", i, rendition.Name)
+		}
+		renditions[rendition.Name] = true
+		if rendition.Height <= 0 || rendition.VideoBitrate <= 0 || rendition.AudioBitrate <= 0 {
+			add("video.renditions[%d]: height, video_bitrate and audio_bitrate must be positive", i)
+		}
+	}
+
+	// Playback
+	if c.Playback.TTL < 0 || c.Playback.StreamTimeout < 0 || c.Playback.StreamIdle < 0 || c.Playback.DownloadTTL < 0 {
+		add("playback: ttl, stream_timeout, stream_idle and download_ttl must not be negative")
+	}
+	if c.Playback.BaseURL != "" && !strings.HasPrefix(c.Playback.BaseURL, "http://") && !strings.HasPrefix(c.Playback.BaseURL, "https://") {
+		add("playback.base_url: must be an http(s) URL (got %q)", c.Playback.BaseURL)
+	}
+
+	// TMDB
+	if c.TMDB.URL != "" && !strings.HasPrefix(c.TMDB.URL, "http://") && !strings.HasPrefix(c.TMDB.URL, "https://") {
+		add("tmdb.url: must be an http(s) URL (got %q)", c.TMDB.URL)
+	}
+	if c.TMDB.ImageURL != "" && !strings.HasPrefix(c.TMDB.ImageURL, "http://") && !strings.HasPrefix(c.TMDB.ImageURL, "https://") {
+		add("tmdb.image_url: must be an http(s) URL (got %q)", c.TMDB.ImageURL)
+	}
+	if c.TMDB.Timeout < 0 {
+		add("tmdb.timeout: must not be negative")
+	}
+
+	// gRPC
+	if c.GRPC.Port != "" {
+		if !validPort(c.GRPC.Port) {
+			add("grpc.port: must be a number between 1 and 65535 (got %q)", c.GRPC.Port)
+		} else if c.GRPC.Port == c.Server.Port {
+			add("grpc.port: must differ from server.port (%s)", c.Server.Port)
+		}
+	}
+	if (c.GRPC.CertFile == "") != (c.GRPC.KeyFile == "") {
+		add("grpc: cert_file and key_file must be set together")
+	}
+	if c.GRPC.ClientCAFile != "" && c.GRPC.CertFile == "" {
+		add("grpc.client_ca_file: requires cert_file and key_file")
+	}
+	if len(c.GRPC.AllowedClients) > 0 && c.GRPC.ClientCAFile == "" {
+		add("grpc.allowed_clients: requires client_ca_file")
+	}
+
+	// Notifications
+	if c.Notifications.AuthTimeout < 0 || c.Notifications.PingInterval < 0 {
+		add("notifications: auth_timeout and ping_interval must not be negative")
+	}
+
+	// Billing
+	if c.Billing.SecretKey != "" {
+		if c.Billing.WebhookSecret == "" {
+			add("billing.webhook_secret: required when billing is enabled")
+		}
+		if !strings.HasPrefix(c.Billing.SuccessURL, "http://") && !strings.HasPrefix(c.Billing.SuccessURL, "https://") {
+			add("billing.success_url: must be an http(s) URL when billing is enabled (got %q)", c.Billing.SuccessURL)
+		}
+		if !strings.HasPrefix(c.Billing.CancelURL, "http://") && !strings.HasPrefix(c.Billing.CancelURL, "https://") {
+			add("billing.cancel_url: must be an http(s) URL when billing is enabled (got %q)", c.Billing.CancelURL)
+		}
+	}
+	if c.Billing.URL != "" && !strings.HasPrefix(c.Billing.URL, "http://") && !strings.HasPrefix(c.Billing.URL, "https://") {
+		add("billing.url: must be an http(s) URL (got %q)", c.Billing.URL)
+	}
+	if c.Billing.PortalReturnURL != "" && !strings.HasPrefix(c.Billing.PortalReturnURL, "http://") && !strings.HasPrefix(c.Billing.PortalReturnURL, "https://") {
+		add("billing.portal_return_url: must be an http(s) URL (got %q)", c.Billing.PortalReturnURL)
+	}
+	if c.Billing.Timeout < 0 {
+		add("billing.timeout: must not be negative")
+	}
+
+	// Entitlements
+	if c.Entitlements.Default.MaxHeight < 0 || c.Entitlements.Default.MaxStreams < 0 {
+		add("entitlements.default: max_height and max_streams must not be negative")
+	}
+	for plan, e := range c.Entitlements.Plans {
+		if e.MaxHeight < 0 || e.MaxStreams < 0 {
+			add("entitlements.plans.%s: max_height and max_streams must not be negative", plan)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n <= 65535
+}
@@ -5,25 +5,81 @@ import (
 	"database/sql"
 	"fmt"
 	_ "github.com/lib/pq"
+	"github.com/ndn/internal/cache"
 	"github.com/ndn/internal/config"
 	database2 "github.com/ndn/internal/database"
+	"github.com/ndn/internal/deprecation"
+	"github.com/ndn/internal/embedding"
+	"github.com/ndn/internal/entitlements"
+	"github.com/ndn/internal/errorreporting"
+	"github.com/ndn/internal/grpcserver"
 	handlers2 "github.com/ndn/internal/handlers"
+	"github.com/ndn/internal/health"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/jwtkeys"
 	"github.com/ndn/internal/logger"
+	"github.com/ndn/internal/metrics"
+	"github.com/ndn/internal/moderation"
+	newrelic2 "github.com/ndn/internal/newrelic"
+	"github.com/ndn/internal/notifications"
+	"github.com/ndn/internal/otel"
+	"github.com/ndn/internal/ratelimit"
+	"github.com/ndn/internal/replay"
+	"github.com/ndn/internal/retry"
+	"github.com/ndn/internal/secrets"
 	services2 "github.com/ndn/internal/services"
+	"github.com/ndn/internal/warehouse"
+	"github.com/ndn/internal/webhook"
 	"github.com/newrelic/go-agent/v3/newrelic"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"go.uber.org/dig"
 	"go.uber.org/zap"
+	"maps"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 )
 
+// Options holds command-line overrides applied when building the container
+type Options struct {
+	ConfigPath string
+	Port       string
+	LogLevel   string
+}
+
+// LoadConfig reads the config file, applies overrides and validates the result
+func LoadConfig(opts Options) (*config.Config, error) {
+	path := opts.ConfigPath
+	if path == "" {
+		path = "config.yaml"
+	}
+
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Port != "" {
+		cfg.Server.Port = opts.Port
+	}
+	if opts.LogLevel != "" {
+		cfg.Logger.Level = opts.LogLevel
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
 // BuildContainer sets up the dependency injection container
-func BuildContainer() *dig.Container {
+func BuildContainer(opts Options) *dig.Container {
 	container := dig.New()
 
 	// Core dependencies
-	provideCore(container)
+	provideCore(container, opts)
 
 	// Database layer
 	provideDatabase(container)
@@ -34,13 +90,24 @@ func BuildContainer() *dig.Container {
 	// Handlers layer
 	provideHandlers(container)
 
+	// gRPC server
+	must(container.Provide(func(
+		cfg *config.Config,
+		movieService *services2.MovieService,
+		userService *services2.UserService,
+		authService *services2.AuthService,
+		logger *zap.Logger,
+	) (*grpcserver.Server, error) {
+		return grpcserver.New(cfg.GRPC, movieService, userService, authService, logger)
+	}))
+
 	return container
 }
 
-func provideCore(container *dig.Container) {
+func provideCore(container *dig.Container, opts Options) {
 	// Provide config
 	must(container.Provide(func() (*config.Config, error) {
-		return config.LoadConfig("config.yaml")
+		return LoadConfig(opts)
 	}))
 
 	// Provide logger
@@ -48,15 +115,67 @@ func provideCore(container *dig.Container) {
 		return logger.NewLogger(cfg)
 	}))
 
-	// Provide NewRelic
-	must(container.Provide(func(cfg *config.Config) (*newrelic.Application, error) {
-		if !cfg.NewRelic.Enabled {
-			return nil, nil
+	// Provide NewRelic, a nil application unless enabled
+	must(container.Provide(newrelic2.NewNewRelicApp))
+
+	// Provide OpenTelemetry tracing, a no-op unless enabled
+	must(container.Provide(func(cfg *config.Config) (*otel.Tracing, error) {
+		return otel.New(context.Background(), cfg.OTel)
+	}))
+
+	// Provide the reporting of panics and server errors, which only recovers
+	// panics unless enabled with a DSN or webhook endpoint
+	must(container.Provide(func(cfg *config.Config, sender *webhook.Sender, logger *zap.Logger) (*errorreporting.Reporter, error) {
+		var dsn string
+		if cfg.ErrorReporting.Provider != errorreporting.ProviderWebhook {
+			dsn = errorReportingDSN(logger)
+			if cfg.ErrorReporting.Enabled && dsn == "" {
+				logger.Warn("no error reporting dsn secret, errors are not reported")
+			}
 		}
-		return newrelic.NewApplication(
-			newrelic.ConfigAppName(cfg.NewRelic.AppName),
-			newrelic.ConfigLicense(cfg.NewRelic.LicenseKey),
-		)
+		return errorreporting.New(cfg.ErrorReporting, dsn, sender, logger)
+	}))
+
+	// Provide Prometheus metrics, including the database pool stats
+	must(container.Provide(func(cfg *config.Config, db *sql.DB) *metrics.Metrics {
+		return metrics.New(cfg.Metrics, db)
+	}))
+
+	// Provide the cache of movie reads, a null cache unless enabled
+	must(container.Provide(func(cfg *config.Config) cache.Cache {
+		return cache.New(cfg.Cache)
+	}))
+
+	// Provide rate limiter, scaling the limits of subscribers by their plan
+	must(container.Provide(func(cfg *config.Config, billing *services2.BillingService) *ratelimit.Limiter {
+		limiter := ratelimit.NewLimiter(cfg.RateLimit)
+		limiter.SetPlanFunc(billing.RatePlan)
+		return limiter
+	}))
+
+	// Provide deprecated route tracking
+	must(container.Provide(deprecation.NewTracker))
+
+	// Provide nonce store for replay protection
+	must(container.Provide(func(cfg *config.Config, c cache.Cache) *replay.Store {
+		return replay.NewStore(cfg.Replay, c)
+	}))
+
+	// Provide webhook signing and verification
+	must(container.Provide(func(cfg *config.Config) *webhook.Sender {
+		return webhook.NewSender(cfg.Webhooks)
+	}))
+	must(container.Provide(func(cfg *config.Config, nonces *replay.Store, logger *zap.Logger) *webhook.Verifier {
+		webhooks := cfg.Webhooks
+		// Stripe signs its events with the billing webhook secret
+		if cfg.Billing.WebhookSecret != "" {
+			webhooks.Inbound = maps.Clone(webhooks.Inbound)
+			if webhooks.Inbound == nil {
+				webhooks.Inbound = make(map[string][]string)
+			}
+			webhooks.Inbound[webhook.ProviderStripe] = append(webhooks.Inbound[webhook.ProviderStripe], cfg.Billing.WebhookSecret)
+		}
+		return webhook.NewVerifier(webhooks, nonces, logger)
 	}))
 }
 
@@ -64,22 +183,11 @@ func provideDatabase(container *dig.Container) {
 	// Provide PostgreSQL connection
 	must(container.Provide(func(cfg *config.Config, logger *zap.Logger) (*sql.DB, error) {
 		// Construct database URL
-		dbURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-			cfg.Database.User,
-			cfg.Database.Password,
-			cfg.Database.Host,
-			cfg.Database.Port,
-			cfg.Database.Database,
-			cfg.Database.SSLMode,
-		)
-
-		// Run migrations first
-		if err := database2.RunMigrations(dbURL); err != nil {
-			return nil, fmt.Errorf("failed to run migrations: %v", err)
-		}
+		dbURL := cfg.Database.URL()
 
-		// Open PostgreSQL connection
-		sqldb, err := sql.Open("postgres", dbURL)
+		// Open PostgreSQL connection, with Postgres stopping statements
+		// running past the statement timeout. Migrations are not bound by it.
+		sqldb, err := sql.Open("postgres", withStatementTimeout(dbURL, cfg.Database.StatementTimeout))
 		if err != nil {
 			return nil, fmt.Errorf("failed to open database connection: %v", err)
 		}
@@ -89,27 +197,110 @@ func provideDatabase(container *dig.Container) {
 		sqldb.SetMaxIdleConns(cfg.Database.MaxIdleConns)
 		sqldb.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime))
 
-		// Verify connection
-		if err := sqldb.PingContext(context.Background()); err != nil {
+		// Wait for the database to accept connections
+		policy := retry.PolicyFromConfig(cfg.Database.StartupRetry)
+		if err := retry.Do(context.Background(), "database", policy, logger, sqldb.PingContext); err != nil {
 			sqldb.Close()
 			return nil, fmt.Errorf("failed to ping database: %v", err)
 		}
 
+		// Run migrations once the database is reachable
+		if err := database2.RunMigrations(dbURL); err != nil {
+			sqldb.Close()
+			return nil, fmt.Errorf("failed to run migrations: %v", err)
+		}
+
 		logger.Info("successfully connected to database")
 		return sqldb, nil
 	}))
 
 	// Provide bun.DB instance
-	must(container.Provide(func(sqldb *sql.DB, logger *zap.Logger) *bun.DB {
-		// Create bun.DB instance with PostgreSQL dialect
-		bundb := bun.NewDB(sqldb, pgdialect.New())
-		return bundb
+	must(container.Provide(func(cfg *config.Config, sqldb *sql.DB, tracing *otel.Tracing, nrApp *newrelic.Application, appMetrics *metrics.Metrics, logger *zap.Logger) *bun.DB {
+		return newBunDB(sqldb, cfg, tracing, nrApp, appMetrics, logger)
+	}))
+
+	// Provide the read replicas, instrumented like the primary. They are not
+	// waited for: reads go to the primary until they pass their first check.
+	must(container.Provide(func(cfg *config.Config, primary *bun.DB, tracing *otel.Tracing, nrApp *newrelic.Application, appMetrics *metrics.Metrics, logger *zap.Logger) (*database2.Replicas, error) {
+		replicas := database2.NewReplicas(primary, cfg.Database.Replicas, logger)
+		for _, replicaURL := range cfg.Database.Replicas.URLs {
+			u, err := url.Parse(replicaURL)
+			if err != nil {
+				return nil, fmt.Errorf("invalid read replica url: %v", err)
+			}
+			sqldb, err := sql.Open("postgres", withStatementTimeout(replicaURL, cfg.Database.StatementTimeout))
+			if err != nil {
+				return nil, fmt.Errorf("failed to open read replica connection: %v", err)
+			}
+			sqldb.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+			sqldb.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+			sqldb.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime))
+			replicas.Add(u.Host, newBunDB(sqldb, cfg, tracing, nrApp, appMetrics, logger))
+		}
+		return replicas, nil
+	}))
+
+	// Provide health checker with the database as a critical dependency,
+	// and the cache, without which reads fall back to the database, storage,
+	// the email server and the payment provider, those configured, as
+	// non-critical ones
+	must(container.Provide(func(
+		cfg *config.Config,
+		sqldb *sql.DB,
+		c cache.Cache,
+		storage *services2.StorageService,
+		email services2.EmailSender,
+		billing *services2.BillingService,
+		logger *zap.Logger,
+	) *health.Checker {
+		checker := health.NewChecker(cfg.Health, logger)
+		checker.Register(health.Dependency{
+			Name:     "database",
+			Critical: true,
+			Check:    sqldb.PingContext,
+		})
+		if cfg.Cache.Enabled {
+			checker.Register(health.Dependency{
+				Name:  "cache",
+				Check: c.Ping,
+			})
+		}
+		if storage.Enabled() {
+			checker.Register(health.Dependency{
+				Name:  "storage",
+				Check: storage.Ping,
+			})
+		}
+		if cfg.Email.SMTPHost != "" {
+			checker.Register(health.Dependency{
+				Name:  "email",
+				Check: email.Ping,
+			})
+		}
+		if billing.Enabled() {
+			checker.Register(health.Dependency{
+				Name:  "payment",
+				Check: billing.Ping,
+			})
+		}
+		return checker
 	}))
 
 	// Provide specific database repositories
 	must(container.Provide(database2.NewAuthDB))
 	must(container.Provide(database2.NewCategoryDB))
 	must(container.Provide(database2.NewUserDB))
+	must(container.Provide(database2.NewAPIKeyDB))
+	must(container.Provide(database2.NewAnalyticsDB))
+	must(container.Provide(database2.NewExportDB))
+	must(container.Provide(database2.NewEmbeddingDB))
+	must(container.Provide(database2.NewTrendingDB))
+	must(container.Provide(database2.NewRecommendationDB))
+	must(container.Provide(database2.NewSearchDB))
+	must(container.Provide(database2.NewSynonymDB))
+	must(container.Provide(database2.NewWatchHistoryDB))
+	must(container.Provide(database2.NewVideoDB))
+	must(container.Provide(database2.NewDataExportDB))
 
 }
 
@@ -117,26 +308,271 @@ func provideServices(container *dig.Container) {
 	// Auth service with JWT configuration
 	must(container.Provide(func(
 		authDB *database2.AuthDB,
+		emailSender services2.EmailSender,
+		hasher services2.PasswordHasher,
+		keys *jwtkeys.KeySet,
+		appMetrics *metrics.Metrics,
 		cfg *config.Config,
 		logger *zap.Logger,
 	) *services2.AuthService {
-		return services2.NewAuthService(authDB, cfg.JWT.Secret)
+		return services2.NewAuthService(authDB, emailSender, hasher, keys, appMetrics, cfg.JWT, cfg.Email, cfg.Password, cfg.LoginThrottle)
+	}))
+
+	// Keys signing access tokens
+	must(container.Provide(func(cfg *config.Config) (*jwtkeys.KeySet, error) {
+		var keys []jwtkeys.SigningKey
+		if cfg.JWT.Algorithm == jwtkeys.RS256 {
+			manager := secrets.GetManager()
+			if err := manager.LoadSecrets(); err != nil {
+				return nil, fmt.Errorf("RS256 requires signing keys in the secrets file: %w", err)
+			}
+			keys = manager.GetSecrets().JWTSigningKeys
+		}
+		return jwtkeys.NewKeySet(cfg.JWT.Algorithm, []byte(cfg.JWT.Secret), keys, cfg.JWT.SigningKeyID)
+	}))
+
+	// Password hashing with the configured algorithm
+	must(container.Provide(func(cfg *config.Config) (services2.PasswordHasher, error) {
+		return services2.NewPasswordHasher(cfg.Password)
+	}))
+
+	// Social login with the configured OAuth providers
+	must(container.Provide(func(
+		authDB *database2.AuthDB,
+		authService *services2.AuthService,
+		appMetrics *metrics.Metrics,
+		cfg *config.Config,
+	) *services2.OAuthService {
+		return services2.NewOAuthService(authDB, authService, appMetrics, cfg.OAuth)
+	}))
+
+	// Email sender, logging emails instead of sending them when no SMTP
+	// host is configured
+	must(container.Provide(func(
+		cfg *config.Config,
+		logger *zap.Logger,
+	) (services2.EmailSender, error) {
+		return services2.NewEmailSender(cfg.Email, logger)
 	}))
 
 	// Category service
 	must(container.Provide(func(
 		categoryDB *database2.CategoryDB,
+		replicas *database2.Replicas,
+		c cache.Cache,
 		logger *zap.Logger,
 	) *services2.CategoryService {
-		return services2.NewCategoryService(categoryDB)
+		return services2.NewCategoryService(categoryDB, replicas, c)
 	}))
 
 	// User service
 	must(container.Provide(func(
 		userDB *database2.UserDB,
+		hasher services2.PasswordHasher,
+		storageService *services2.StorageService,
+		cfg *config.Config,
 		logger *zap.Logger,
 	) *services2.UserService {
-		return services2.NewUserService(userDB)
+		return services2.NewUserService(userDB, hasher, storageService, cfg.Password, cfg.Accounts, logger)
+	}))
+
+	// Notifications pushed to WebSocket clients
+	must(container.Provide(func(db *bun.DB, cfg *config.Config, logger *zap.Logger) *notifications.Hub {
+		return notifications.NewHub(db, cfg.Database.URL(), cfg.Notifications, logger)
+	}))
+
+	// New releases streamed to clients of this instance
+	must(container.Provide(services2.NewReleaseFeed))
+
+	// Movie service
+	must(container.Provide(services2.NewMovieService))
+
+	// API key service
+	must(container.Provide(services2.NewAPIKeyService))
+
+	// Editorial boosts
+	must(container.Provide(services2.NewBoostService))
+	must(container.Provide(services2.NewCollectionService))
+	must(container.Provide(services2.NewFeaturedService))
+
+	// Audit log of admin mutations
+	must(container.Provide(services2.NewAuditService))
+
+	// Publication workflow
+	must(container.Provide(func(
+		db *bun.DB,
+		c cache.Cache,
+		hub *notifications.Hub,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.WorkflowService {
+		return services2.NewWorkflowService(db, c, hub, cfg.Workflow, logger)
+	}))
+
+	// Purge of deleted movies and categories
+	must(container.Provide(func(
+		db *bun.DB,
+		categoryDB *database2.CategoryDB,
+		c cache.Cache,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.TrashService {
+		return services2.NewTrashService(db, categoryDB, c, cfg.Trash, logger)
+	}))
+
+	// Watch history for resuming playback
+	must(container.Provide(services2.NewWatchHistoryService))
+
+	// Viewer profiles of accounts
+	must(container.Provide(services2.NewProfileService))
+
+	// Reviews, screened by the content filter
+	must(container.Provide(services2.NewReviewService))
+
+	// TV series with their seasons and episodes
+	must(container.Provide(services2.NewSeriesService))
+
+	// Recommendations with their reasons
+	must(container.Provide(services2.NewRecommendationService))
+
+	// Search across entities, expanded with the synonym dictionary
+	must(container.Provide(services2.NewSynonymService))
+	must(container.Provide(services2.NewSearchService))
+
+	// Analytics service with its asynchronous write pipeline
+	must(container.Provide(func(
+		analyticsDB *database2.AnalyticsDB,
+		appMetrics *metrics.Metrics,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.AnalyticsService {
+		return services2.NewAnalyticsService(analyticsDB, appMetrics, cfg.Analytics, logger)
+	}))
+
+	// Daily analytics rollups
+	must(container.Provide(func(
+		analyticsDB *database2.AnalyticsDB,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.RollupService {
+		return services2.NewRollupService(analyticsDB, cfg.Analytics, logger)
+	}))
+
+	// Analytics export to the configured warehouses
+	must(container.Provide(func(
+		analyticsDB *database2.AnalyticsDB,
+		exportDB *database2.ExportDB,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) (*services2.ExportService, error) {
+		sinks, err := warehouse.NewSinks(cfg.Export)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure export sinks: %w", err)
+		}
+		return services2.NewExportService(analyticsDB, exportDB, sinks, cfg.Export, cfg.Analytics, logger), nil
+	}))
+
+	// Movie embeddings from the configured provider
+	must(container.Provide(func(
+		embeddingDB *database2.EmbeddingDB,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) (*services2.EmbeddingService, error) {
+		provider, err := embedding.NewProvider(cfg.Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure embedding provider: %w", err)
+		}
+		return services2.NewEmbeddingService(embeddingDB, provider, cfg.Embedding, logger), nil
+	}))
+
+	// Content filter for user-generated text
+	must(container.Provide(func(
+		db *bun.DB,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) (*services2.ContentFilterService, error) {
+		provider, err := moderation.NewProvider(cfg.Moderation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure moderation provider: %w", err)
+		}
+		return services2.NewContentFilterService(db, provider, cfg.Moderation, logger), nil
+	}))
+
+	// Trending scores
+	must(container.Provide(func(
+		trendingDB *database2.TrendingDB,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.TrendingService {
+		return services2.NewTrendingService(trendingDB, cfg.Trending, logger)
+	}))
+
+	// Poster and other file storage
+	must(container.Provide(func(cfg *config.Config) (*services2.StorageService, error) {
+		return services2.NewStorageService(cfg.Storage)
+	}))
+
+	// Video uploads and transcoding
+	must(container.Provide(func(
+		videoDB *database2.VideoDB,
+		storageService *services2.StorageService,
+		c cache.Cache,
+		hub *notifications.Hub,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.VideoService {
+		return services2.NewVideoService(videoDB, storageService, c, hub, cfg.Video, logger)
+	}))
+
+	// Archives of the data users keep with us
+	must(container.Provide(func(
+		dataExportDB *database2.DataExportDB,
+		storageService *services2.StorageService,
+		hub *notifications.Hub,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.DataExportService {
+		return services2.NewDataExportService(dataExportDB, storageService, hub, cfg.DataExport, logger)
+	}))
+
+	// Signed playback URLs
+	must(container.Provide(func(
+		db *bun.DB,
+		movieService *services2.MovieService,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.PlaybackService {
+		key := storageKey(logger)
+		if key == "" {
+			logger.Warn("no storage key secret, playback is disabled")
+		}
+		return services2.NewPlaybackService(db, movieService, key, cfg.Playback, cfg.Video.Renditions)
+	}))
+
+	// Subtitle tracks, stored as WebVTT
+	must(container.Provide(services2.NewSubtitleService))
+
+	// Movie metadata imports from TMDB
+	must(container.Provide(func(
+		db *bun.DB,
+		movieService *services2.MovieService,
+		cfg *config.Config,
+	) *services2.ImportService {
+		return services2.NewImportService(db, integrations.NewTMDBClient(cfg.TMDB), movieService)
+	}))
+
+	// Subscriptions billed through Stripe
+	must(container.Provide(func(
+		db *bun.DB,
+		c cache.Cache,
+		cfg *config.Config,
+		logger *zap.Logger,
+	) *services2.BillingService {
+		if cfg.Billing.SecretKey == "" {
+			logger.Info("no Stripe secret key, billing is disabled and playback is not gated on subscriptions")
+		}
+		policy := entitlements.NewPolicy(cfg.Entitlements)
+		return services2.NewBillingService(db, integrations.NewStripeClient(cfg.Billing), policy, c, cfg.Billing, logger)
 	}))
 }
 
@@ -146,7 +582,7 @@ func provideHandlers(container *dig.Container) {
 		authService *services2.AuthService,
 		logger *zap.Logger,
 	) *handlers2.AuthHandler {
-		return handlers2.NewAuthHandler(authService)
+		return handlers2.NewAuthHandler(authService, logger)
 	}))
 
 	// Category handler
@@ -154,15 +590,18 @@ func provideHandlers(container *dig.Container) {
 		categoryService *services2.CategoryService,
 		logger *zap.Logger,
 	) *handlers2.CategoryHandler {
-		return handlers2.NewCategoryHandler(categoryService)
+		return handlers2.NewCategoryHandler(categoryService, logger)
 	}))
 
 	// Movie handler
 	must(container.Provide(func(
 		movieService *services2.MovieService,
+		embeddingService *services2.EmbeddingService,
+		trendingService *services2.TrendingService,
+		storageService *services2.StorageService,
 		logger *zap.Logger,
 	) *handlers2.MovieHandler {
-		return handlers2.NewMovieHandler(movieService)
+		return handlers2.NewMovieHandler(movieService, embeddingService, trendingService, storageService, logger)
 	}))
 
 	// User handler
@@ -170,8 +609,132 @@ func provideHandlers(container *dig.Container) {
 		userService *services2.UserService,
 		logger *zap.Logger,
 	) *handlers2.UserHandler {
-		return handlers2.NewUserHandler(userService)
+		return handlers2.NewUserHandler(userService, logger)
 	}))
+
+	// Health handler
+	must(container.Provide(handlers2.NewHealthHandler))
+
+	// API key handler
+	must(container.Provide(handlers2.NewAPIKeyHandler))
+
+	// Analytics handler
+	must(container.Provide(handlers2.NewAnalyticsHandler))
+
+	// Editorial boost handler
+	must(container.Provide(handlers2.NewBoostHandler))
+
+	// Recommendation handler
+	must(container.Provide(handlers2.NewRecommendationHandler))
+
+	// Search handler
+	must(container.Provide(handlers2.NewSearchHandler))
+
+	// Moderation handler
+	must(container.Provide(handlers2.NewModerationHandler))
+
+	// Publication workflow handler
+	must(container.Provide(handlers2.NewContentHandler))
+
+	// Watch history handler
+	must(container.Provide(handlers2.NewWatchHistoryHandler))
+
+	// Review handler
+	must(container.Provide(handlers2.NewReviewHandler))
+
+	// OAuth handler
+	must(container.Provide(handlers2.NewOAuthHandler))
+
+	// Series handler
+	must(container.Provide(handlers2.NewSeriesHandler))
+
+	// Video handler
+	must(container.Provide(handlers2.NewVideoHandler))
+
+	// Playback handler
+	must(container.Provide(handlers2.NewPlaybackHandler))
+
+	// Subtitle handler
+	must(container.Provide(handlers2.NewSubtitleHandler))
+
+	// Movie translation handler
+	must(container.Provide(handlers2.NewTranslationHandler))
+
+	// Import handler
+	must(container.Provide(handlers2.NewImportHandler))
+
+	// Notification handler
+	must(container.Provide(handlers2.NewNotificationHandler))
+
+	// Server-Sent Events handler
+	must(container.Provide(handlers2.NewEventHandler))
+
+	// Profile handler
+	must(container.Provide(handlers2.NewProfileHandler))
+
+	// Billing handler
+	must(container.Provide(handlers2.NewBillingHandler))
+
+	// User data exports
+	must(container.Provide(handlers2.NewDataExportHandler))
+
+	// Curated collections of movies
+	must(container.Provide(handlers2.NewCollectionHandler))
+
+	// Featured banners
+	must(container.Provide(handlers2.NewFeaturedHandler))
+
+	// Audit log handler
+	must(container.Provide(handlers2.NewAuditHandler))
+}
+
+// storageKey returns the StorageKey secret, from the secrets file or, when
+// there is none, the STORAGE_KEY environment variable
+func storageKey(logger *zap.Logger) string {
+	manager := secrets.GetManager()
+	if err := manager.LoadSecrets(); err != nil {
+		logger.Debug("secrets file not loaded", zap.Error(err))
+		return os.Getenv("STORAGE_KEY")
+	}
+	return manager.GetSecrets().StorageKey
+}
+
+// newBunDB returns a bun.DB with the PostgreSQL dialect over sqldb, its
+// queries bounded, counted, traced and recorded in New Relic
+func newBunDB(sqldb *sql.DB, cfg *config.Config, tracing *otel.Tracing, nrApp *newrelic.Application, appMetrics *metrics.Metrics, logger *zap.Logger) *bun.DB {
+	bundb := bun.NewDB(sqldb, pgdialect.New())
+	bundb.AddQueryHook(database2.NewQueryTimeoutHook(cfg.Database.QueryTimeout))
+	bundb.AddQueryHook(database2.NewQueryHook(cfg.Database.SlowQueryThreshold, appMetrics, logger))
+	tracing.InstrumentDB(bundb)
+	newrelic2.InstrumentDB(nrApp, bundb)
+	return bundb
+}
+
+// withStatementTimeout returns the connection URL dbURL with Postgres
+// stopping statements running longer than timeout, if set
+func withStatementTimeout(dbURL string, timeout time.Duration) string {
+	if timeout <= 0 {
+		return dbURL
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL
+	}
+	query := u.Query()
+	query.Set("statement_timeout", strconv.FormatInt(timeout.Milliseconds(), 10))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// errorReportingDSN returns the ErrorReportingDSN secret, from the secrets
+// file or, when there is none, the ERROR_REPORTING_DSN environment variable
+func errorReportingDSN(logger *zap.Logger) string {
+	manager := secrets.GetManager()
+	if err := manager.LoadSecrets(); err != nil {
+		logger.Debug("secrets file not loaded", zap.Error(err))
+		return os.Getenv("ERROR_REPORTING_DSN")
+	}
+	return manager.GetSecrets().ErrorReportingDSN
 }
 
 // must panics if err is not nil
@@ -0,0 +1,599 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type AnalyticsDB struct {
+	db *bun.DB
+}
+
+func NewAnalyticsDB(db *bun.DB) *AnalyticsDB {
+	return &AnalyticsDB{
+		db: db,
+	}
+}
+
+// InsertEvents writes a batch of events in a single statement
+func (d *AnalyticsDB) InsertEvents(ctx context.Context, events []*models.AnalyticsEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	_, err := d.db.NewInsert().
+		Model(&events).
+		Exec(ctx)
+
+	return err
+}
+
+// rollupEvents selects one day of raw events and the furthest position each
+// viewer reached per movie, which approximates their watch time. Viewers are
+// identified by user, then session, falling back to the single event.
+const rollupEvents = `
+WITH events AS (
+	SELECT * FROM analytics_events WHERE occurred_at >= ? AND occurred_at < ?
+), watched AS (
+	SELECT movie_id, user_id, MAX(position_seconds) AS seconds
+	FROM events
+	WHERE position_seconds IS NOT NULL
+	GROUP BY movie_id, user_id, COALESCE(user_id::text, session_id, id::text)
+)`
+
+const rollupMovies = rollupEvents + `
+INSERT INTO movie_daily_stats (movie_id, day, impressions, views, viewers, completions, watch_seconds)
+SELECT e.movie_id, CAST(? AS date),
+	COUNT(*) FILTER (WHERE e.type = 'impression'),
+	COUNT(*) FILTER (WHERE e.type = 'play_start'),
+	COUNT(DISTINCT COALESCE(e.user_id::text, e.session_id)) FILTER (WHERE e.type = 'play_start'),
+	COUNT(*) FILTER (WHERE e.type = 'complete'),
+	COALESCE((SELECT SUM(w.seconds) FROM watched w WHERE w.movie_id = e.movie_id), 0)
+FROM events e
+WHERE e.movie_id IS NOT NULL
+GROUP BY e.movie_id`
+
+const rollupUsers = rollupEvents + `
+INSERT INTO user_daily_stats (user_id, day, views, titles, completions, watch_seconds)
+SELECT e.user_id, CAST(? AS date),
+	COUNT(*) FILTER (WHERE e.type = 'play_start'),
+	COUNT(DISTINCT e.movie_id) FILTER (WHERE e.type = 'play_start'),
+	COUNT(*) FILTER (WHERE e.type = 'complete'),
+	COALESCE((SELECT SUM(w.seconds) FROM watched w WHERE w.user_id = e.user_id), 0)
+FROM events e
+WHERE e.user_id IS NOT NULL
+GROUP BY e.user_id`
+
+const rollupUserMovies = rollupEvents + `
+INSERT INTO user_movie_daily_stats (user_id, movie_id, day, completions, watch_seconds)
+SELECT e.user_id, e.movie_id, CAST(? AS date),
+	COUNT(*) FILTER (WHERE e.type = 'complete'),
+	COALESCE((SELECT SUM(w.seconds) FROM watched w WHERE w.user_id = e.user_id AND w.movie_id = e.movie_id), 0)
+FROM events e
+WHERE e.user_id IS NOT NULL AND e.movie_id IS NOT NULL
+GROUP BY e.user_id, e.movie_id`
+
+// RollupDay recomputes the per-movie and per-user stats of the UTC day
+// starting at day from raw events, replacing any earlier rollup of that day
+func (d *AnalyticsDB) RollupDay(ctx context.Context, day time.Time) error {
+	next := day.AddDate(0, 0, 1)
+
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*models.MovieDailyStats)(nil)).Where("day = ?", day).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model((*models.UserDailyStats)(nil)).Where("day = ?", day).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.NewDelete().Model((*models.UserMovieDailyStats)(nil)).Where("day = ?", day).Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, rollupMovies, day, next, day); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, rollupUsers, day, next, day); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, rollupUserMovies, day, next, day); err != nil {
+			return err
+		}
+
+		_, err := tx.NewInsert().
+			Model(&models.AnalyticsRollup{Day: day, RolledUpAt: time.Now()}).
+			On("CONFLICT (day) DO UPDATE").
+			Set("rolled_up_at = EXCLUDED.rolled_up_at").
+			Exec(ctx)
+		return err
+	})
+}
+
+// LastRollupDay returns the latest day that has been rolled up, or the zero
+// time if none has
+func (d *AnalyticsDB) LastRollupDay(ctx context.Context) (time.Time, error) {
+	var day time.Time
+	err := d.db.NewSelect().
+		Model((*models.AnalyticsRollup)(nil)).
+		ColumnExpr("day").
+		Order("day DESC").
+		Limit(1).
+		Scan(ctx, &day)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return day, err
+}
+
+// EarliestEventTime returns when the oldest stored event occurred, or the zero
+// time if there are no events
+func (d *AnalyticsDB) EarliestEventTime(ctx context.Context) (time.Time, error) {
+	var occurredAt time.Time
+	err := d.db.NewSelect().
+		Model((*models.AnalyticsEvent)(nil)).
+		ColumnExpr("occurred_at").
+		Order("occurred_at ASC").
+		Limit(1).
+		Scan(ctx, &occurredAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return occurredAt, err
+}
+
+// PruneEvents deletes raw events that occurred before the given time and returns how many
+// were removed
+func (d *AnalyticsDB) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.db.NewDelete().
+		Model((*models.AnalyticsEvent)(nil)).
+		Where("occurred_at < ?", before).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DailyActiveUsers counts users active on a day (DAU) and in the 30 days up
+// to and including it (MAU)
+type DailyActiveUsers struct {
+	Day time.Time `bun:"day"`
+	DAU int64     `bun:"dau"`
+	MAU int64     `bun:"mau"`
+}
+
+// SignupFunnel counts how far users who signed up in a period got
+type SignupFunnel struct {
+	Registered int64 `bun:"registered"`
+	Active     int64 `bun:"active"`    // any event
+	Watched    int64 `bun:"watched"`   // started a title
+	Completed  int64 `bun:"completed"` // finished a title
+	Returned   int64 `bun:"returned"`  // active on two or more days
+}
+
+// Cohort is the group of users who signed up in the week starting on Start
+type Cohort struct {
+	Start time.Time `bun:"cohort"`
+	Size  int64     `bun:"size"`
+}
+
+// CohortActivity counts users of a signup cohort active in a given week
+// after the cohort started
+type CohortActivity struct {
+	Cohort time.Time `bun:"cohort"`
+	Week   int       `bun:"week"`
+	Users  int64     `bun:"users"`
+}
+
+// DailyWatchTime sums playback across all titles for a day
+type DailyWatchTime struct {
+	Day          time.Time `bun:"day"`
+	Views        int64     `bun:"views"`
+	Completions  int64     `bun:"completions"`
+	WatchSeconds int64     `bun:"watch_seconds"`
+}
+
+// TitleStats sums a movie's daily stats over a period
+type TitleStats struct {
+	MovieID      int64  `bun:"movie_id"`
+	Title        string `bun:"title"`
+	Views        int64  `bun:"views"`
+	Viewers      int64  `bun:"viewers"`
+	Completions  int64  `bun:"completions"`
+	WatchSeconds int64  `bun:"watch_seconds"`
+}
+
+// Engagement summarises how a movie's viewers watched it over a period
+type Engagement struct {
+	Viewers      int64 `bun:"viewers"`
+	WatchSeconds int64 `bun:"watch_seconds"`
+	Completers   int64 `bun:"completers"` // viewers with a complete event
+	Rewatchers   int64 `bun:"rewatchers"` // completers who started the movie again afterwards
+}
+
+// MinuteViewers counts the viewers whose furthest position was in a given
+// minute of a movie
+type MinuteViewers struct {
+	Minute  int   `bun:"minute"`
+	Viewers int64 `bun:"viewers"`
+}
+
+// ReasonStats counts the events reported with a recommendation reason
+type ReasonStats struct {
+	Reason      string `bun:"reason"`
+	Impressions int64  `bun:"impressions"`
+	Clicks      int64  `bun:"clicks"`
+	Plays       int64  `bun:"plays"`
+}
+
+// engagementViewers selects a movie's playback events in a period and, per
+// viewer, the furthest position reached and the watch time, summed over the
+// days they watched on like the daily rollups
+const engagementViewers = `
+WITH events AS (
+	SELECT type, position_seconds, occurred_at, COALESCE(user_id::text, session_id, id::text) AS viewer
+	FROM analytics_events
+	WHERE movie_id = ? AND occurred_at >= ? AND occurred_at < ?
+		AND type IN ('play_start', 'heartbeat', 'pause', 'complete')
+), viewers AS (
+	SELECT viewer, MAX(seconds) AS furthest, SUM(seconds) AS watched
+	FROM (
+		SELECT viewer, MAX(COALESCE(position_seconds, 0)) AS seconds
+		FROM events
+		GROUP BY viewer, occurred_at::date
+	) days
+	GROUP BY viewer
+)`
+
+// MovieDuration returns the duration in minutes of a movie that has not been
+// deleted
+func (d *AnalyticsDB) MovieDuration(ctx context.Context, movieID int64) (int, error) {
+	var duration int
+	err := d.db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Column("duration").
+		Where("id = ?", movieID).
+		Scan(ctx, &duration)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("movie %w", ErrNotFound)
+	}
+	return duration, err
+}
+
+// MovieEngagement summarises playback of a movie from from until before to
+// from raw events
+func (d *AnalyticsDB) MovieEngagement(ctx context.Context, movieID int64, from, to time.Time) (*Engagement, error) {
+	engagement := new(Engagement)
+	err := d.db.NewRaw(engagementViewers+`, completions AS (
+			SELECT viewer, MIN(occurred_at) AS completed_at
+			FROM events
+			WHERE type = 'complete'
+			GROUP BY viewer
+		)
+		SELECT (SELECT COUNT(*) FROM viewers) AS viewers,
+			(SELECT COALESCE(SUM(watched), 0) FROM viewers) AS watch_seconds,
+			(SELECT COUNT(*) FROM completions) AS completers,
+			(SELECT COUNT(*) FROM completions c WHERE EXISTS (
+				SELECT 1 FROM events e
+				WHERE e.viewer = c.viewer AND e.type = 'play_start' AND e.occurred_at > c.completed_at
+			)) AS rewatchers`, movieID, from, to).
+		Scan(ctx, engagement)
+
+	return engagement, err
+}
+
+// FurthestMinutes counts a movie's viewers from from until before to by the
+// minute of the furthest position they reached, capped at maxMinute
+func (d *AnalyticsDB) FurthestMinutes(ctx context.Context, movieID int64, from, to time.Time, maxMinute int) ([]MinuteViewers, error) {
+	var minutes []MinuteViewers
+	err := d.db.NewRaw(engagementViewers+`
+		SELECT LEAST(furthest / 60, ?) AS minute, COUNT(*) AS viewers
+		FROM viewers
+		GROUP BY 1
+		ORDER BY 1`, movieID, from, to, maxMinute).
+		Scan(ctx, &minutes)
+
+	return minutes, err
+}
+
+// ActiveUsers returns DAU and MAU for each day from from to to, inclusive
+func (d *AnalyticsDB) ActiveUsers(ctx context.Context, from, to time.Time) ([]DailyActiveUsers, error) {
+	var days []DailyActiveUsers
+	err := d.db.NewRaw(`
+		SELECT d.day::date AS day,
+			(SELECT COUNT(*) FROM user_daily_stats s WHERE s.day = d.day::date) AS dau,
+			(SELECT COUNT(DISTINCT s.user_id) FROM user_daily_stats s
+				WHERE s.day > d.day::date - 30 AND s.day <= d.day::date) AS mau
+		FROM generate_series(CAST(? AS date), CAST(? AS date), interval '1 day') AS d(day)
+		ORDER BY d.day`, from, to).
+		Scan(ctx, &days)
+
+	return days, err
+}
+
+// MonthlyActiveUsers counts distinct users active from from to to, inclusive
+func (d *AnalyticsDB) MonthlyActiveUsers(ctx context.Context, from, to time.Time) (int64, error) {
+	var count int64
+	err := d.db.NewSelect().
+		Model((*models.UserDailyStats)(nil)).
+		ColumnExpr("COUNT(DISTINCT user_id)").
+		Where("day >= ?", from).
+		Where("day <= ?", to).
+		Scan(ctx, &count)
+
+	return count, err
+}
+
+// SignupFunnel follows users who signed up from from until before to
+func (d *AnalyticsDB) SignupFunnel(ctx context.Context, from, to time.Time) (*SignupFunnel, error) {
+	funnel := new(SignupFunnel)
+	err := d.db.NewRaw(`
+		SELECT COUNT(*) AS registered,
+			COUNT(*) FILTER (WHERE a.days > 0) AS active,
+			COUNT(*) FILTER (WHERE a.views > 0) AS watched,
+			COUNT(*) FILTER (WHERE a.completions > 0) AS completed,
+			COUNT(*) FILTER (WHERE a.days > 1) AS returned
+		FROM users u
+		LEFT JOIN LATERAL (
+			SELECT COUNT(*) AS days, COALESCE(SUM(views), 0) AS views, COALESCE(SUM(completions), 0) AS completions
+			FROM user_daily_stats s WHERE s.user_id = u.id
+		) a ON true
+		WHERE u.created_at >= ? AND u.created_at < ?`, from, to).
+		Scan(ctx, funnel)
+
+	return funnel, err
+}
+
+// Cohorts groups users who signed up from from until before to by the week,
+// starting on Monday, they signed up in
+func (d *AnalyticsDB) Cohorts(ctx context.Context, from, to time.Time) ([]Cohort, error) {
+	var cohorts []Cohort
+	err := d.db.NewRaw(`
+		SELECT date_trunc('week', created_at)::date AS cohort, COUNT(*) AS size
+		FROM users
+		WHERE created_at >= ? AND created_at < ?
+		GROUP BY cohort
+		ORDER BY cohort`, from, to).
+		Scan(ctx, &cohorts)
+
+	return cohorts, err
+}
+
+// CohortActivity counts, per weekly signup cohort, the users active in each
+// week since the cohort started
+func (d *AnalyticsDB) CohortActivity(ctx context.Context, from, to time.Time) ([]CohortActivity, error) {
+	var activity []CohortActivity
+	err := d.db.NewRaw(`
+		WITH cohorts AS (
+			SELECT id AS user_id, date_trunc('week', created_at)::date AS cohort
+			FROM users
+			WHERE created_at >= ? AND created_at < ?
+		)
+		SELECT c.cohort, (s.day - c.cohort) / 7 AS week, COUNT(DISTINCT c.user_id) AS users
+		FROM cohorts c
+		JOIN user_daily_stats s ON s.user_id = c.user_id AND s.day >= c.cohort
+		GROUP BY c.cohort, week
+		ORDER BY c.cohort, week`, from, to).
+		Scan(ctx, &activity)
+
+	return activity, err
+}
+
+// WatchTime returns playback totals per day from from to to, inclusive
+func (d *AnalyticsDB) WatchTime(ctx context.Context, from, to time.Time) ([]DailyWatchTime, error) {
+	var days []DailyWatchTime
+	err := d.db.NewSelect().
+		Model((*models.MovieDailyStats)(nil)).
+		ColumnExpr("day, SUM(views) AS views, SUM(completions) AS completions, SUM(watch_seconds) AS watch_seconds").
+		Where("day >= ?", from).
+		Where("day <= ?", to).
+		Group("day").
+		Order("day").
+		Scan(ctx, &days)
+
+	return days, err
+}
+
+// TopTitles returns the movies with the highest value of column from from to
+// to, inclusive. column must be one of the stats columns.
+func (d *AnalyticsDB) TopTitles(ctx context.Context, from, to time.Time, column string, limit int) ([]TitleStats, error) {
+	var titles []TitleStats
+	err := d.db.NewSelect().
+		TableExpr("movie_daily_stats AS mds").
+		Join("LEFT JOIN movies AS m ON m.id = mds.movie_id").
+		ColumnExpr("mds.movie_id, COALESCE(m.title, '') AS title").
+		ColumnExpr("SUM(mds.views) AS views, SUM(mds.viewers) AS viewers").
+		ColumnExpr("SUM(mds.completions) AS completions, SUM(mds.watch_seconds) AS watch_seconds").
+		Where("mds.day >= ?", from).
+		Where("mds.day <= ?", to).
+		Group("mds.movie_id", "m.title").
+		OrderExpr("? DESC, mds.movie_id", bun.Ident(column)).
+		Limit(limit).
+		Scan(ctx, &titles)
+
+	return titles, err
+}
+
+// EventsAfter returns up to limit events with an ID above afterID, oldest
+// first
+func (d *AnalyticsDB) EventsAfter(ctx context.Context, afterID int64, limit int) ([]*models.AnalyticsEvent, error) {
+	var events []*models.AnalyticsEvent
+	err := d.db.NewSelect().
+		Model(&events).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Scan(ctx)
+
+	return events, err
+}
+
+// FirstEventIDSince returns the ID of the first event stored that occurred at
+// or after t, or 0 if there is none
+func (d *AnalyticsDB) FirstEventIDSince(ctx context.Context, t time.Time) (int64, error) {
+	var id int64
+	err := d.db.NewSelect().
+		Model((*models.AnalyticsEvent)(nil)).
+		ColumnExpr("COALESCE(MIN(id), 0)").
+		Where("occurred_at >= ?", t).
+		Scan(ctx, &id)
+
+	return id, err
+}
+
+// FirstStatsDay returns the earliest day with movie stats, or the zero time if
+// nothing has been rolled up
+func (d *AnalyticsDB) FirstStatsDay(ctx context.Context) (time.Time, error) {
+	var day time.Time
+	err := d.db.NewSelect().
+		Model((*models.MovieDailyStats)(nil)).
+		ColumnExpr("day").
+		Order("day ASC").
+		Limit(1).
+		Scan(ctx, &day)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return day, err
+}
+
+// MovieStatsOn returns the per-movie stats of a day
+func (d *AnalyticsDB) MovieStatsOn(ctx context.Context, day time.Time) ([]*models.MovieDailyStats, error) {
+	var stats []*models.MovieDailyStats
+	err := d.db.NewSelect().
+		Model(&stats).
+		Where("day = ?", day).
+		Order("movie_id").
+		Scan(ctx)
+
+	return stats, err
+}
+
+// UserStatsOn returns the per-user stats of a day
+func (d *AnalyticsDB) UserStatsOn(ctx context.Context, day time.Time) ([]*models.UserDailyStats, error) {
+	var stats []*models.UserDailyStats
+	err := d.db.NewSelect().
+		Model(&stats).
+		Where("day = ?", day).
+		Order("user_id").
+		Scan(ctx)
+
+	return stats, err
+}
+
+// RecommendationReasons counts impressions, clicks and plays per
+// recommendation reason from from until before to, from raw events
+func (d *AnalyticsDB) RecommendationReasons(ctx context.Context, from, to time.Time) ([]ReasonStats, error) {
+	var reasons []ReasonStats
+	err := d.db.NewSelect().
+		Model((*models.AnalyticsEvent)(nil)).
+		ColumnExpr("reason").
+		ColumnExpr("COUNT(*) FILTER (WHERE type = 'impression') AS impressions").
+		ColumnExpr("COUNT(*) FILTER (WHERE type = 'recommendation_click') AS clicks").
+		ColumnExpr("COUNT(*) FILTER (WHERE type = 'play_start') AS plays").
+		Where("reason IS NOT NULL").
+		Where("occurred_at >= ?", from).
+		Where("occurred_at < ?", to).
+		Group("reason").
+		OrderExpr("clicks DESC, reason").
+		Scan(ctx, &reasons)
+
+	return reasons, err
+}
+
+// UserViewing sums up a user's playback over a period
+type UserViewing struct {
+	WatchSeconds    int64 `bun:"watch_seconds"`
+	TitlesWatched   int64 `bun:"titles_watched"`
+	TitlesCompleted int64 `bun:"titles_completed"`
+}
+
+// UserGenre is the playback of a user in one category over a period
+type UserGenre struct {
+	Category     string `bun:"category"`
+	Titles       int64  `bun:"titles"`
+	WatchSeconds int64  `bun:"watch_seconds"`
+}
+
+// UserStreak is a run of consecutive days a user watched something on
+type UserStreak struct {
+	Days int       `bun:"days"`
+	Last time.Time `bun:"last"`
+}
+
+// UserViewing sums up the playback of userID from from to to, inclusive
+func (d *AnalyticsDB) UserViewing(ctx context.Context, userID int64, from, to time.Time) (*UserViewing, error) {
+	viewing := new(UserViewing)
+	err := d.db.NewSelect().
+		Model((*models.UserMovieDailyStats)(nil)).
+		ColumnExpr("COALESCE(SUM(watch_seconds), 0) AS watch_seconds").
+		ColumnExpr("COUNT(DISTINCT movie_id) AS titles_watched").
+		ColumnExpr("COUNT(DISTINCT movie_id) FILTER (WHERE completions > 0) AS titles_completed").
+		Where("user_id = ?", userID).
+		Where("day >= ?", from).
+		Where("day <= ?", to).
+		Scan(ctx, viewing)
+
+	return viewing, err
+}
+
+// UserGenres returns up to limit categories userID spent the most time
+// watching from from to to, inclusive
+func (d *AnalyticsDB) UserGenres(ctx context.Context, userID int64, from, to time.Time, limit int) ([]UserGenre, error) {
+	var genres []UserGenre
+	err := d.db.NewRaw(`
+		SELECT c.name AS category, COUNT(DISTINCT s.movie_id) AS titles, SUM(s.watch_seconds) AS watch_seconds
+		FROM user_movie_daily_stats s
+		JOIN movie_categories mc ON mc.movie_id = s.movie_id
+		JOIN categories c ON c.id = mc.category_id AND c.hidden = false
+		WHERE s.user_id = ? AND s.day >= ? AND s.day <= ?
+		GROUP BY c.name
+		ORDER BY watch_seconds DESC, titles DESC, c.name ASC
+		LIMIT ?`, userID, from, to, limit).
+		Scan(ctx, &genres)
+
+	return genres, err
+}
+
+// UserActiveDays returns the days userID watched something on from from to
+// to, inclusive, in order
+func (d *AnalyticsDB) UserActiveDays(ctx context.Context, userID int64, from, to time.Time) ([]time.Time, error) {
+	var days []time.Time
+	err := d.db.NewSelect().
+		Model((*models.UserDailyStats)(nil)).
+		Column("day").
+		Where("user_id = ?", userID).
+		Where("day >= ?", from).
+		Where("day <= ?", to).
+		Where("views > 0 OR watch_seconds > 0").
+		Order("day ASC").
+		Scan(ctx, &days)
+
+	return days, err
+}
+
+// LatestUserStreak returns the most recent run of consecutive days userID
+// watched something on, up to and including day
+func (d *AnalyticsDB) LatestUserStreak(ctx context.Context, userID int64, day time.Time) (*UserStreak, error) {
+	streak := new(UserStreak)
+	err := d.db.NewRaw(`
+		WITH days AS (
+			SELECT day, day + CAST(ROW_NUMBER() OVER (ORDER BY day DESC) AS integer) AS run
+			FROM user_daily_stats
+			WHERE user_id = ? AND day <= ? AND (views > 0 OR watch_seconds > 0)
+		)
+		SELECT COUNT(*) AS days, MAX(day) AS last
+		FROM days
+		WHERE run = (SELECT run FROM days ORDER BY day DESC LIMIT 1)`, userID, day).
+		Scan(ctx, streak)
+
+	return streak, err
+}
@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type APIKeyDB struct {
+	db *bun.DB
+}
+
+func NewAPIKeyDB(db *bun.DB) *APIKeyDB {
+	return &APIKeyDB{
+		db: db,
+	}
+}
+
+func (d *APIKeyDB) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	_, err := d.db.NewInsert().
+		Model(key).
+		Exec(ctx)
+
+	return err
+}
+
+func (d *APIKeyDB) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	key := new(models.APIKey)
+	err := d.db.NewSelect().
+		Model(key).
+		Where("id = ?", id).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (d *APIKeyDB) GetAPIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	key := new(models.APIKey)
+	err := d.db.NewSelect().
+		Model(key).
+		Where("key_hash = ?", hash).
+		Where("revoked_at IS NULL").
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("api key %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (d *APIKeyDB) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := d.db.NewSelect().
+		Model(&keys).
+		Order("created_at DESC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (d *APIKeyDB) RevokeAPIKey(ctx context.Context, id int64) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.APIKey)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
+
+// ConsumeUsage adds one request to the key's counter for day, unless the
+// key has used up dailyQuota requests that day or monthlyQuota since month,
+// zero being no limit. Checking and counting is one statement: days before
+// day do not change, and concurrent requests wait on the counter of day and
+// check it again once it is counted, so quotas are never exceeded. It
+// returns the requests counted on day, and false when a quota is used up.
+func (d *APIKeyDB) ConsumeUsage(ctx context.Context, keyID int64, day, month time.Time, dailyQuota, monthlyQuota int) (int64, bool, error) {
+	var used int64
+	err := d.db.NewRaw(`
+		WITH earlier AS (
+			SELECT COALESCE(SUM(request_count), 0) AS used FROM api_key_usage
+			WHERE api_key_id = ?0 AND day >= ?2 AND day < ?1
+		)
+		INSERT INTO api_key_usage AS aku (api_key_id, day, request_count)
+		SELECT ?0, ?1, 1 FROM earlier WHERE ?4 = 0 OR earlier.used < ?4
+		ON CONFLICT (api_key_id, day) DO UPDATE SET request_count = aku.request_count + 1
+		WHERE (?3 = 0 OR aku.request_count < ?3)
+			AND (?4 = 0 OR (SELECT used FROM earlier) + aku.request_count < ?4)
+		RETURNING request_count`, keyID, day, month, dailyQuota, monthlyQuota).
+		Scan(ctx, &used)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return used, true, nil
+}
+
+// UsageSince returns per-day usage for a key from the given day onwards
+func (d *APIKeyDB) UsageSince(ctx context.Context, keyID int64, from time.Time) ([]*models.APIKeyUsage, error) {
+	var usage []*models.APIKeyUsage
+	err := d.db.NewSelect().
+		Model(&usage).
+		Where("api_key_id = ?", keyID).
+		Where("day >= ?", from).
+		Order("day ASC").
+		Scan(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// CountSince returns the total number of requests made with a key since day
+func (d *APIKeyDB) CountSince(ctx context.Context, keyID int64, from time.Time) (int64, error) {
+	var total int64
+	err := d.db.NewSelect().
+		Model((*models.APIKeyUsage)(nil)).
+		ColumnExpr("COALESCE(SUM(request_count), 0)").
+		Where("api_key_id = ?", keyID).
+		Where("day >= ?", from).
+		Scan(ctx, &total)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/ndn/internal/models"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -34,8 +36,8 @@ func (d *AuthDB) GetUser(ctx context.Context, id int64) (*models.User, error) {
 		Where("id = ?", id).
 		Scan(ctx)
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -51,8 +53,8 @@ func (d *AuthDB) GetUserByEmail(ctx context.Context, email string) (*models.User
 		Where("email = ?", email).
 		Scan(ctx)
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -61,9 +63,12 @@ func (d *AuthDB) GetUserByEmail(ctx context.Context, email string) (*models.User
 	return user, nil
 }
 
+// UserExists reports whether email is taken, by deleted accounts too until
+// they are purged
 func (d *AuthDB) UserExists(ctx context.Context, email string) (bool, error) {
 	exists, err := d.db.NewSelect().
 		Model((*models.User)(nil)).
+		WhereAllWithDeleted().
 		Where("email = ?", email).
 		Exists(ctx)
 
@@ -82,3 +87,536 @@ func (d *AuthDB) UpdateUser(ctx context.Context, user *models.User) error {
 
 	return err
 }
+
+// SetPassword replaces the password hash of the user with userID
+func (d *AuthDB) SetPassword(ctx context.Context, userID int64, passwordHash string, at time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("password = ?", passwordHash).
+		Set("updated_at = ?", at).
+		Where("id = ?", userID).
+		Exec(ctx)
+
+	return err
+}
+
+// ChangePassword replaces the password hash of the user with userID and
+// revokes the refresh tokens of their sessions other than keepSessionID,
+// so those must log in again
+func (d *AuthDB) ChangePassword(ctx context.Context, userID int64, passwordHash, keepSessionID string, at time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("password = ?", passwordHash).
+			Set("updated_at = ?", at).
+			Where("id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		q := tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", at).
+			Where("user_id = ?", userID).
+			Where("revoked_at IS NULL")
+		if keepSessionID != "" {
+			q = q.Where("session_id != ?", keepSessionID)
+		}
+		_, err = q.Exec(ctx)
+		return err
+	})
+}
+
+// CreateRefreshToken stores token and deletes the user's refresh tokens that
+// have expired, so they do not pile up
+func (d *AuthDB) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	_, err := d.db.NewDelete().
+		Model((*models.RefreshToken)(nil)).
+		Where("user_id = ?", token.UserID).
+		Where("expires_at < ?", token.CreatedAt).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.NewInsert().
+		Model(token).
+		Exec(ctx)
+
+	return err
+}
+
+func (d *AuthDB) GetRefreshTokenByHash(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	token := new(models.RefreshToken)
+	err := d.db.NewSelect().
+		Model(token).
+		Where("token_hash = ?", hash).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("refresh token %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RevokeRefreshToken revokes the token with id unless it already was, and
+// reports whether this call revoked it. Of concurrent exchanges of the same
+// token, only one succeeds.
+func (d *AuthDB) RevokeRefreshToken(ctx context.Context, id int64, at time.Time) (bool, error) {
+	res, err := d.db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", at).
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// RevokeSession revokes every refresh token of a session
+func (d *AuthDB) RevokeSession(ctx context.Context, sessionID string, at time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", at).
+		Where("session_id = ?", sessionID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+
+	return err
+}
+
+// RevokeUserSessions revokes every refresh token of a user
+func (d *AuthDB) RevokeUserSessions(ctx context.Context, userID int64, at time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.RefreshToken)(nil)).
+		Set("revoked_at = ?", at).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Exec(ctx)
+
+	return err
+}
+
+// DeleteAccount soft-deletes the account of userID at at, detaching their
+// reviews from it and revoking their sessions and password reset tokens
+func (d *AuthDB) DeleteAccount(ctx context.Context, userID int64, at time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("deleted_at = ?", at).
+			Set("updated_at = ?", at).
+			Where("id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("user %w", ErrNotFound)
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.Review)(nil)).
+			Set("user_id = NULL").
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", at).
+			Where("user_id = ?", userID).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*models.PasswordResetToken)(nil)).
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		return err
+	})
+}
+
+// activeSession filters devices, aliased dv, on their session having a
+// refresh token neither revoked nor expired at the time bound to it
+const activeSession = `EXISTS (SELECT 1 FROM refresh_tokens AS rt WHERE rt.session_id = dv.session_id AND rt.revoked_at IS NULL AND rt.expires_at > ?)`
+
+// SaveDevice records device for its session, or marks the device already
+// recorded for it as seen at device.LastSeenAt. Devices of the user whose
+// sessions ended are deleted, so they do not pile up.
+func (d *AuthDB) SaveDevice(ctx context.Context, device *models.Device) error {
+	_, err := d.db.NewDelete().
+		Model((*models.Device)(nil)).
+		Where("dv.user_id = ?", device.UserID).
+		Where("dv.session_id <> ?", device.SessionID).
+		Where("NOT "+activeSession, device.LastSeenAt).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.NewInsert().
+		Model(device).
+		On("CONFLICT (session_id) DO UPDATE").
+		Set("last_seen_at = EXCLUDED.last_seen_at").
+		Returning("id, user_agent, platform, created_at").
+		Exec(ctx)
+
+	return err
+}
+
+// ListDevices returns the devices of userID whose session is active at now,
+// most recently seen first
+func (d *AuthDB) ListDevices(ctx context.Context, userID int64, now time.Time) ([]models.Device, error) {
+	devices := make([]models.Device, 0)
+	err := d.db.NewSelect().
+		Model(&devices).
+		Where("dv.user_id = ?", userID).
+		Where(activeSession, now).
+		Order("dv.last_seen_at DESC").
+		Scan(ctx)
+
+	return devices, err
+}
+
+// GetDevice returns the device with id of userID whose session is active at
+// now
+func (d *AuthDB) GetDevice(ctx context.Context, userID, id int64, now time.Time) (*models.Device, error) {
+	device := new(models.Device)
+	err := d.db.NewSelect().
+		Model(device).
+		Where("dv.id = ?", id).
+		Where("dv.user_id = ?", userID).
+		Where(activeSession, now).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("device %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// RevokeDevice revokes the session of device and deletes it
+func (d *AuthDB) RevokeDevice(ctx context.Context, device *models.Device, at time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", at).
+			Where("session_id = ?", device.SessionID).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model(device).
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+}
+
+// GetLoginAttempts returns the failed logins counted for keys, for those
+// that have any
+func (d *AuthDB) GetLoginAttempts(ctx context.Context, keys []string) ([]models.LoginAttempt, error) {
+	attempts := make([]models.LoginAttempt, 0, len(keys))
+	err := d.db.NewSelect().
+		Model(&attempts).
+		Where("key IN (?)", bun.In(keys)).
+		Scan(ctx)
+
+	return attempts, err
+}
+
+// RecordLoginFailure counts a failed login at at for key and returns its
+// count, which restarts from one when the last failure was before
+// resetBefore. Counts whose last failure was before resetBefore and that
+// lock nothing are deleted, so they do not pile up.
+func (d *AuthDB) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginAttempt, error) {
+	_, err := d.db.NewDelete().
+		Model((*models.LoginAttempt)(nil)).
+		Where("last_failed_at < ?", resetBefore).
+		Where("locked_until IS NULL OR locked_until < ?", at).
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := &models.LoginAttempt{Key: key, Failures: 1, LastFailedAt: at}
+	_, err = d.db.NewInsert().
+		Model(attempt).
+		On("CONFLICT (key) DO UPDATE").
+		Set("failures = CASE WHEN la.last_failed_at < ? THEN 1 ELSE la.failures + 1 END", resetBefore).
+		Set("last_failed_at = EXCLUDED.last_failed_at").
+		Returning("failures, locked_until").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return attempt, nil
+}
+
+// LockLogin locks the logins counted under key until until
+func (d *AuthDB) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.LoginAttempt)(nil)).
+		Set("locked_until = ?", until).
+		Where("key = ?", key).
+		Exec(ctx)
+
+	return err
+}
+
+// ClearLoginAttempts forgets the failed logins counted under key, lifting
+// any lock
+func (d *AuthDB) ClearLoginAttempts(ctx context.Context, key string) error {
+	_, err := d.db.NewDelete().
+		Model((*models.LoginAttempt)(nil)).
+		Where("key = ?", key).
+		Exec(ctx)
+
+	return err
+}
+
+// RevokeAccessTokens stores revocation and deletes the revocations whose
+// tokens have all expired, so they do not pile up
+func (d *AuthDB) RevokeAccessTokens(ctx context.Context, revocation *models.RevokedToken, at time.Time) error {
+	_, err := d.db.NewDelete().
+		Model((*models.RevokedToken)(nil)).
+		Where("expires_at < ?", at).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.NewInsert().
+		Model(revocation).
+		On("CONFLICT (jti) DO NOTHING").
+		Exec(ctx)
+
+	return err
+}
+
+// AccessTokenRevoked reports whether the access token with jti, issued to
+// userID for sessionID at issuedAt, was revoked
+func (d *AuthDB) AccessTokenRevoked(ctx context.Context, jti string, userID int64, sessionID string, issuedAt time.Time) (bool, error) {
+	return accessTokenRevokedQuery(d.db, jti, userID, sessionID, issuedAt).Exists(ctx)
+}
+
+// accessTokenRevokedQuery selects the revocations of an access token
+func accessTokenRevokedQuery(db bun.IDB, jti string, userID int64, sessionID string, issuedAt time.Time) *bun.SelectQuery {
+	q := db.NewSelect().
+		Model((*models.RevokedToken)(nil)).
+		WhereGroup(" OR ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("user_id = ? AND issued_before > ?", userID, issuedAt).
+				Where("kept_session_id IS NULL OR kept_session_id <> ?", sessionID)
+		})
+	if jti != "" {
+		q = q.WhereOr("jti = ?", jti)
+	}
+	return q
+}
+
+// CreatePasswordResetToken stores token, replacing the user's earlier reset
+// tokens so only the latest link works
+func (d *AuthDB) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().
+			Model((*models.PasswordResetToken)(nil)).
+			Where("user_id = ?", token.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().
+			Model(token).
+			Exec(ctx)
+		return err
+	})
+}
+
+// ResetPassword uses the unexpired, unused reset token with hash to set the
+// user's password hash, and revokes every refresh token of the user so other
+// sessions must log in again. The token cannot be used again. It returns the
+// ID of the user.
+func (d *AuthDB) ResetPassword(ctx context.Context, hash, passwordHash string, at time.Time) (int64, error) {
+	var userID int64
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().
+			Model((*models.PasswordResetToken)(nil)).
+			Set("used_at = ?", at).
+			Where("token_hash = ?", hash).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", at).
+			Returning("user_id").
+			Scan(ctx, &userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("password reset token %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("password = ?", passwordHash).
+			Set("updated_at = ?", at).
+			Where("id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", at).
+			Where("user_id = ?", userID).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		return err
+	})
+	return userID, err
+}
+
+// CreateEmailChangeToken stores token, replacing the user's earlier email
+// change tokens so only the latest link works
+func (d *AuthDB) CreateEmailChangeToken(ctx context.Context, token *models.EmailChangeToken) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewDelete().
+			Model((*models.EmailChangeToken)(nil)).
+			Where("user_id = ?", token.UserID).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().
+			Model(token).
+			Exec(ctx)
+		return err
+	})
+}
+
+// ChangeEmail uses the unexpired, unused email change token with hash to
+// set the user's email to the one it confirms. The address is checked
+// again, as another account may have taken it since the change was asked
+// for, in which case ErrEmailTaken is returned and the token stays unused.
+// It returns the ID of the user.
+func (d *AuthDB) ChangeEmail(ctx context.Context, hash string, at time.Time) (int64, error) {
+	var userID int64
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		token := new(models.EmailChangeToken)
+		err := tx.NewUpdate().
+			Model(token).
+			Set("used_at = ?", at).
+			Where("token_hash = ?", hash).
+			Where("used_at IS NULL").
+			Where("expires_at > ?", at).
+			Returning("user_id, new_email").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("email change token %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		userID = token.UserID
+
+		taken, err := tx.NewSelect().
+			Model((*models.User)(nil)).
+			WhereAllWithDeleted().
+			Where("email = ?", token.NewEmail).
+			Where("id != ?", userID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrEmailTaken
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("email = ?", token.NewEmail).
+			Set("updated_at = ?", at).
+			Where("id = ?", userID).
+			Exec(ctx)
+		return err
+	})
+	return userID, err
+}
+
+// GetUserByIdentity returns the user linked to the account subject at an
+// OAuth provider
+func (d *AuthDB) GetUserByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
+	user := new(models.User)
+	err := d.db.NewSelect().
+		Model(user).
+		Join("JOIN user_identities AS ui ON ui.user_id = u.id").
+		Where("ui.provider = ?", provider).
+		Where("ui.subject = ?", subject).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity links identity to the user with its email, matched case
+// insensitively, creating newUser first when there is none. It returns the
+// linked user.
+func (d *AuthDB) LinkIdentity(ctx context.Context, identity *models.UserIdentity, newUser *models.User) (*models.User, error) {
+	user := new(models.User)
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Deleted accounts keep their email until they are purged
+		err := tx.NewSelect().
+			Model(user).
+			WhereAllWithDeleted().
+			Where("lower(email) = lower(?)", identity.Email).
+			Limit(1).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			user = newUser
+			_, err = tx.NewInsert().
+				Model(user).
+				Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		_, err = tx.NewInsert().
+			Model(identity).
+			On("CONFLICT (provider, subject) DO NOTHING").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
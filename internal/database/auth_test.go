@@ -0,0 +1,32 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessTokenRevokedQuerySparesKeptSession(t *testing.T) {
+	issuedAt := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	got := accessTokenRevokedQuery(newQueryDB(t), "jti-1", 7, "session-a", issuedAt).String()
+
+	_, where, ok := strings.Cut(got, " WHERE ")
+	if !ok {
+		t.Fatalf("query has no WHERE: %s", got)
+	}
+	want := "((user_id = 7 AND issued_before > '2026-10-16 12:00:00+00:00') AND (kept_session_id IS NULL OR kept_session_id <> 'session-a')) OR (jti = 'jti-1')"
+	if where != want {
+		t.Errorf("WHERE %s, want %s", where, want)
+	}
+}
+
+func TestAccessTokenRevokedQueryWithoutJTI(t *testing.T) {
+	got := accessTokenRevokedQuery(newQueryDB(t), "", 7, "", time.Now()).String()
+	if _, where, _ := strings.Cut(got, " WHERE "); strings.Contains(where, "jti") {
+		t.Errorf("query matches on an empty JTI: %s", got)
+	}
+	// Tokens without a session are revoked whatever session is kept
+	if !strings.Contains(got, "kept_session_id <> ''") {
+		t.Errorf("query does not compare the kept session: %s", got)
+	}
+}
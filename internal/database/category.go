@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/ndn/internal/models"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -19,12 +21,21 @@ func NewCategoryDB(db *bun.DB) *CategoryDB {
 	}
 }
 
-func (d *CategoryDB) GetCategories(ctx context.Context) ([]*models.Category, error) {
+// GetCategories returns categories in display order, leaving out hidden ones
+// unless includeHidden is set and deleted ones unless includeDeleted is
+func (d *CategoryDB) GetCategories(ctx context.Context, includeHidden, includeDeleted bool) ([]*models.Category, error) {
 	var categories []*models.Category
-	err := d.db.NewSelect().
+	query := d.db.NewSelect().
 		Model(&categories).
-		Order("name ASC").
-		Scan(ctx)
+		Order("display_order ASC", "name ASC")
+	if !includeHidden {
+		query.Where("hidden = false")
+	}
+	if includeDeleted {
+		query.WhereAllWithDeleted()
+	}
+
+	err := query.Scan(ctx)
 
 	if err != nil {
 		return nil, err
@@ -40,8 +51,45 @@ func (d *CategoryDB) GetCategory(ctx context.Context, id int64) (*models.Categor
 		Where("id = ?", id).
 		Scan(ctx)
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("category not found")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("category %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// GetCategoryWithDeleted returns the category with id, even if deleted
+func (d *CategoryDB) GetCategoryWithDeleted(ctx context.Context, id int64) (*models.Category, error) {
+	category := new(models.Category)
+	err := d.db.NewSelect().
+		Model(category).
+		Where("id = ?", id).
+		WhereAllWithDeleted().
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("category %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// GetCategoryBySlug returns the category with slug
+func (d *CategoryDB) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	category := new(models.Category)
+	err := d.db.NewSelect().
+		Model(category).
+		Where("slug = ?", slug).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("category %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -63,6 +111,14 @@ func (d *CategoryDB) CategoryExists(ctx context.Context, name string) (bool, err
 	return exists, nil
 }
 
+// SlugExists reports whether a category has slug
+func (d *CategoryDB) SlugExists(ctx context.Context, slug string) (bool, error) {
+	return d.db.NewSelect().
+		Model((*models.Category)(nil)).
+		Where("slug = ?", slug).
+		Exists(ctx)
+}
+
 func (d *CategoryDB) CreateCategory(ctx context.Context, category *models.Category) error {
 	_, err := d.db.NewInsert().
 		Model(category).
@@ -71,6 +127,117 @@ func (d *CategoryDB) CreateCategory(ctx context.Context, category *models.Catego
 	return err
 }
 
+// UpdateCategory renames category, changes its slug and moves it under its
+// parent, unless another category has its name or slug or the move would
+// nest it under itself. Movies and editorial boosts refer to categories by
+// name, so the ones of its old name are changed along in the same
+// transaction.
+func (d *CategoryDB) UpdateCategory(ctx context.Context, category *models.Category) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if category.ParentID != nil {
+			// Serialize moves, so two of them cannot make a cycle together
+			if _, err := tx.ExecContext(ctx, "LOCK TABLE categories IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+				return err
+			}
+		}
+
+		current := new(models.Category)
+		err := tx.NewSelect().
+			Model(current).
+			Where("id = ?", category.ID).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("category %w", ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		taken, err := tx.NewSelect().
+			Model((*models.Category)(nil)).
+			Where("name = ?", category.Name).
+			Where("id != ?", category.ID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrCategoryNameTaken
+		}
+		taken, err = tx.NewSelect().
+			Model((*models.Category)(nil)).
+			Where("slug = ?", category.Slug).
+			Where("id != ?", category.ID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrCategorySlugTaken
+		}
+		if category.ParentID != nil {
+			cycle, err := isAncestor(ctx, tx, category.ID, *category.ParentID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				return ErrCategoryCycle
+			}
+		}
+
+		_, err = tx.NewUpdate().
+			Model(category).
+			Column("name", "slug", "parent_id", "updated_at").
+			WherePK().
+			Returning("*").
+			Exec(ctx)
+		if err != nil || current.Name == category.Name {
+			return err
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.Movie)(nil)).
+			Set("categories = array_replace(categories, ?, ?)", current.Name, category.Name).
+			Where("? = ANY(categories)", current.Name).
+			WhereAllWithDeleted().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.EditorialBoost)(nil)).
+			Set("category = ?", category.Name).
+			Where("category = ?", current.Name).
+			Exec(ctx)
+		return err
+	})
+}
+
+// CreatesCycle reports whether making parentID the parent of id would nest
+// id under itself
+func (d *CategoryDB) CreatesCycle(ctx context.Context, id, parentID int64) (bool, error) {
+	return isAncestor(ctx, d.db, id, parentID)
+}
+
+// isAncestor reports whether ancestorID is id or one of the categories id
+// is nested under
+func isAncestor(ctx context.Context, db bun.IDB, ancestorID, id int64) (bool, error) {
+	var found bool
+	err := db.NewRaw(`
+		WITH RECURSIVE up AS (
+			SELECT id, parent_id FROM categories WHERE id = ?
+			UNION
+			SELECT c.id, c.parent_id FROM categories AS c JOIN up ON c.id = up.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM up WHERE id = ?)`,
+		id, ancestorID,
+	).Scan(ctx, &found)
+	return found, err
+}
+
+// DeleteCategory soft-deletes the category with id, which RestoreCategory
+// undoes until it is purged
 func (d *CategoryDB) DeleteCategory(ctx context.Context, id int64) error {
 	_, err := d.db.NewDelete().
 		Model((*models.Category)(nil)).
@@ -80,6 +247,41 @@ func (d *CategoryDB) DeleteCategory(ctx context.Context, id int64) error {
 	return err
 }
 
+// RestoreCategory undoes the soft delete of the category with id
+func (d *CategoryDB) RestoreCategory(ctx context.Context, id int64) error {
+	res, err := d.db.NewUpdate().
+		Model((*models.Category)(nil)).
+		Set("deleted_at = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		WhereDeleted().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("deleted category %w", ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeDeletedCategories removes the categories deleted before before for
+// good and returns how many it removed. Categories still the parent of a
+// deleted one are left for a later purge, after their sub-categories.
+func (d *CategoryDB) PurgeDeletedCategories(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.db.NewDelete().
+		Model((*models.Category)(nil)).
+		Where("c.deleted_at < ?", before).
+		Where("NOT EXISTS (SELECT 1 FROM categories AS sub WHERE sub.parent_id = c.id)").
+		WhereDeleted().
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (d *CategoryDB) CategoryInUse(ctx context.Context, id int64) (bool, error) {
 	exists, err := d.db.NewSelect().
 		Model((*models.MovieCategory)(nil)).
@@ -92,3 +294,150 @@ func (d *CategoryDB) CategoryInUse(ctx context.Context, id int64) (bool, error)
 
 	return exists, nil
 }
+
+// HasSubcategories reports whether any category is nested directly under id
+func (d *CategoryDB) HasSubcategories(ctx context.Context, id int64) (bool, error) {
+	return d.db.NewSelect().
+		Model((*models.Category)(nil)).
+		Where("parent_id = ?", id).
+		Exists(ctx)
+}
+
+func (d *CategoryDB) SetCategoryHidden(ctx context.Context, id int64, hidden bool) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.Category)(nil)).
+		Set("hidden = ?", hidden).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", id).
+		Exec(ctx)
+
+	return err
+}
+
+// ReorderCategories sets display_order to each ID's position in ids. Categories
+// not listed keep their order but sort after the listed ones.
+func (d *CategoryDB) ReorderCategories(ctx context.Context, ids []int64) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.Category)(nil)).
+			Set("display_order = display_order + ?", len(ids)).
+			Where("id NOT IN (?)", bun.In(ids)).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i, id := range ids {
+			_, err := tx.NewUpdate().
+				Model((*models.Category)(nil)).
+				Set("display_order = ?", i).
+				Set("updated_at = ?", time.Now()).
+				Where("id = ?", id).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CountCategories returns how many of ids exist
+func (d *CategoryDB) CountCategories(ctx context.Context, ids []int64) (int, error) {
+	return d.db.NewSelect().
+		Model((*models.Category)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Count(ctx)
+}
+
+// CategoryTotals sums up the catalog of a category
+type CategoryTotals struct {
+	ID            int64    `bun:"id"`
+	Name          string   `bun:"name"`
+	Hidden        bool     `bun:"hidden"`
+	Titles        int64    `bun:"titles"`
+	AverageRating *float64 `bun:"average_rating"` // nil when no title is rated
+	WatchSeconds  int64    `bun:"watch_seconds"`
+}
+
+// CategoryAdditions counts the titles added to a category in a period
+type CategoryAdditions struct {
+	CategoryID int64     `bun:"category_id"`
+	Period     time.Time `bun:"period"`
+	Added      int64     `bun:"added"`
+}
+
+// CategoryTotals returns the title count, average rating of rated titles and
+// total watch time from the daily rollups of every category, in display
+// order. Deleted movies are not counted.
+func (d *CategoryDB) CategoryTotals(ctx context.Context) ([]CategoryTotals, error) {
+	var totals []CategoryTotals
+	err := d.db.NewRaw(`
+		SELECT c.id, c.name, c.hidden,
+			COUNT(m.id) AS titles,
+			AVG(NULLIF(m.rating, 0)) AS average_rating,
+			COALESCE(SUM(w.watch_seconds), 0) AS watch_seconds
+		FROM categories c
+		LEFT JOIN movie_categories mc ON mc.category_id = c.id
+		LEFT JOIN movies m ON m.id = mc.movie_id AND m.deleted_at IS NULL
+		LEFT JOIN (
+			SELECT movie_id, SUM(watch_seconds) AS watch_seconds
+			FROM movie_daily_stats
+			GROUP BY movie_id
+		) w ON w.movie_id = m.id
+		GROUP BY c.id
+		ORDER BY c.display_order ASC, c.name ASC`).
+		Scan(ctx, &totals)
+
+	return totals, err
+}
+
+// CategoryAdditions counts the titles added to each category per unit (week
+// or month) since since, by when they were assigned to the category
+func (d *CategoryDB) CategoryAdditions(ctx context.Context, unit string, since time.Time) ([]CategoryAdditions, error) {
+	var additions []CategoryAdditions
+	err := d.db.NewRaw(`
+		SELECT mc.category_id, date_trunc(?, mc.created_at) AS period, COUNT(*) AS added
+		FROM movie_categories mc
+		JOIN movies m ON m.id = mc.movie_id AND m.deleted_at IS NULL
+		WHERE mc.created_at >= ?
+		GROUP BY mc.category_id, period`, unit, since).
+		Scan(ctx, &additions)
+
+	return additions, err
+}
+
+// LoadMovieCategories sets the CategoryRefs of movies to the categories
+// linked to them, in display order
+func LoadMovieCategories(ctx context.Context, db bun.IDB, movies []models.Movie) error {
+	if len(movies) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(movies))
+	for i := range movies {
+		ids[i] = movies[i].ID
+	}
+
+	var links []models.MovieCategory
+	err := db.NewSelect().
+		Model(&links).
+		Relation("Category").
+		Where("mc.movie_id IN (?)", bun.In(ids)).
+		OrderExpr("category.display_order, category.name").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	byMovie := make(map[int64][]models.Category, len(movies))
+	for _, link := range links {
+		byMovie[link.MovieID] = append(byMovie[link.MovieID], *link.Category)
+	}
+	for i := range movies {
+		movies[i].CategoryRefs = byMovie[movies[i].ID]
+		if movies[i].CategoryRefs == nil {
+			movies[i].CategoryRefs = []models.Category{}
+		}
+	}
+	return nil
+}
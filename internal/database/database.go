@@ -2,14 +2,40 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/models"
 
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
 )
 
+var (
+	// ErrNotFound is returned when a requested record does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrEmailTaken is returned when an email address is already some
+	// user's, deleted accounts included until they are purged
+	ErrEmailTaken = errors.New("email already registered")
+	// ErrCategoryNameTaken and ErrCategorySlugTaken are returned when
+	// another category already has a name or slug
+	ErrCategoryNameTaken = errors.New("category name already taken")
+	ErrCategorySlugTaken = errors.New("category slug already taken")
+	// ErrCategoryCycle is returned when a category would become a
+	// sub-category of itself or of one of its sub-categories
+	ErrCategoryCycle = errors.New("category cannot be nested under itself")
+)
+
+// Published limits a query of movies, aliased m, to those shown publicly:
+// published and, if they have an availability window, within it. Use it with
+// SelectQuery.Apply.
+func Published(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.Where("m.status = ?", models.MovieStatusPublished).
+		Where("m.available_from IS NULL OR m.available_from <= now()").
+		Where("m.available_until IS NULL OR m.available_until > now()")
+}
+
 func NewDB(cfg config.DatabaseConfig) (*bun.DB, error) {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
 		cfg.User,
@@ -0,0 +1,254 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// DataExportDB queues the archives users request of their data, and reads
+// the data that goes into them
+type DataExportDB struct {
+	db *bun.DB
+}
+
+func NewDataExportDB(db *bun.DB) *DataExportDB {
+	return &DataExportDB{
+		db: db,
+	}
+}
+
+// CreateExport queues export, unless its user already has one queued or
+// running, which is returned instead
+func (d *DataExportDB) CreateExport(ctx context.Context, export *models.DataExport) (*models.DataExport, error) {
+	result := export
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		// Serialize the requests of the user
+		_, err := tx.NewSelect().
+			Model((*models.User)(nil)).
+			Column("id").
+			Where("id = ?", export.UserID).
+			For("UPDATE").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		pending := new(models.DataExport)
+		err = tx.NewSelect().
+			Model(pending).
+			Where("user_id = ?", export.UserID).
+			Where("status IN (?)", bun.In([]string{models.DataExportQueued, models.DataExportRunning})).
+			Limit(1).
+			Scan(ctx)
+		if err == nil {
+			result = pending
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		_, err = tx.NewInsert().
+			Model(export).
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetExport returns the export id of userID
+func (d *DataExportDB) GetExport(ctx context.Context, userID, id int64) (*models.DataExport, error) {
+	export := new(models.DataExport)
+	err := d.db.NewSelect().
+		Model(export).
+		Where("id = ? AND user_id = ?", id, userID).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("data export %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// ClaimExport marks the oldest queued export running and returns it, or nil
+// when none is queued
+func (d *DataExportDB) ClaimExport(ctx context.Context, now time.Time) (*models.DataExport, error) {
+	export := new(models.DataExport)
+	err := d.db.NewRaw(`
+		UPDATE data_exports
+		SET status = ?, started_at = ?
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = ?
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.DataExportRunning, now, models.DataExportQueued,
+	).Scan(ctx, export)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// RequeueStale queues again the exports running since before startedBefore,
+// whose worker is presumed dead
+func (d *DataExportDB) RequeueStale(ctx context.Context, startedBefore time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.DataExport)(nil)).
+		Set("status = ?", models.DataExportQueued).
+		Set("started_at = NULL").
+		Where("status = ? AND started_at < ?", models.DataExportRunning, startedBefore).
+		Exec(ctx)
+	return err
+}
+
+// ReleaseExport queues again an export whose worker stopped before
+// finishing it
+func (d *DataExportDB) ReleaseExport(ctx context.Context, id int64) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.DataExport)(nil)).
+		Set("status = ?", models.DataExportQueued).
+		Set("started_at = NULL").
+		Where("id = ? AND status = ?", id, models.DataExportRunning).
+		Exec(ctx)
+	return err
+}
+
+// FinishExport records the outcome of a running export: its status, and
+// where its archive is stored or why it failed
+func (d *DataExportDB) FinishExport(ctx context.Context, export *models.DataExport) error {
+	_, err := d.db.NewUpdate().
+		Model(export).
+		Column("status", "object_key", "size", "error", "started_at", "finished_at", "expires_at").
+		WherePK().
+		Exec(ctx)
+	return err
+}
+
+// ExpiredExports returns the ready exports whose archives expired at now
+func (d *DataExportDB) ExpiredExports(ctx context.Context, now time.Time) ([]models.DataExport, error) {
+	var exports []models.DataExport
+	err := d.db.NewSelect().
+		Model(&exports).
+		Where("status = ? AND expires_at <= ?", models.DataExportReady, now).
+		Order("expires_at").
+		Scan(ctx)
+	return exports, err
+}
+
+// ExpireExport marks an export expired once its archive is deleted
+func (d *DataExportDB) ExpireExport(ctx context.Context, id int64) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.DataExport)(nil)).
+		Set("status = ?", models.DataExportExpired).
+		Set("object_key = NULL").
+		Where("id = ?", id).
+		Exec(ctx)
+	return err
+}
+
+// GetUser returns a user with their own profile
+func (d *DataExportDB) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	user := new(models.User)
+	err := d.db.NewSelect().
+		Model(user).
+		Relation("Profile").
+		Where("u.id = ?", id).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Profiles returns the viewer profiles of userID
+func (d *DataExportDB) Profiles(ctx context.Context, userID int64) ([]models.Profile, error) {
+	var profiles []models.Profile
+	err := d.db.NewSelect().
+		Model(&profiles).
+		Where("user_id = ?", userID).
+		Order("created_at", "id").
+		Scan(ctx)
+	return profiles, err
+}
+
+// Favorites returns the favorites of userID and of their profiles
+func (d *DataExportDB) Favorites(ctx context.Context, userID int64) ([]models.UserFavorite, error) {
+	var favorites []models.UserFavorite
+	err := d.db.NewSelect().
+		Model(&favorites).
+		Where("user_id = ?", userID).
+		Order("created_at", "id").
+		Scan(ctx)
+	return favorites, err
+}
+
+// WatchHistory returns the watch history of userID and of their profiles
+func (d *DataExportDB) WatchHistory(ctx context.Context, userID int64) ([]models.WatchHistory, error) {
+	var history []models.WatchHistory
+	err := d.db.NewSelect().
+		Model(&history).
+		Where("user_id = ?", userID).
+		Order("last_watched_at").
+		Scan(ctx)
+	return history, err
+}
+
+// Reviews returns the reviews written by userID
+func (d *DataExportDB) Reviews(ctx context.Context, userID int64) ([]models.Review, error) {
+	var reviews []models.Review
+	err := d.db.NewSelect().
+		Model(&reviews).
+		Where("user_id = ?", userID).
+		Order("created_at", "id").
+		Scan(ctx)
+	return reviews, err
+}
+
+// MovieTitles returns the titles of the movies with ids, deleted or not
+func (d *DataExportDB) MovieTitles(ctx context.Context, ids []int64) (map[int64]string, error) {
+	titles := make(map[int64]string, len(ids))
+	if len(ids) == 0 {
+		return titles, nil
+	}
+
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Column("id", "title").
+		WhereAllWithDeleted().
+		Where("id IN (?)", bun.In(ids)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, movie := range movies {
+		titles[movie.ID] = movie.Title
+	}
+	return titles, nil
+}
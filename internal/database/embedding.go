@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type EmbeddingDB struct {
+	db *bun.DB
+}
+
+func NewEmbeddingDB(db *bun.DB) *EmbeddingDB {
+	return &EmbeddingDB{
+		db: db,
+	}
+}
+
+// MoviesAfter returns up to limit movies with an ID above afterID, in ID
+// order
+func (d *EmbeddingDB) MoviesAfter(ctx context.Context, afterID int64, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
+
+// GetEmbeddings returns the stored embeddings of the given movies, without
+// the vectors themselves
+func (d *EmbeddingDB) GetEmbeddings(ctx context.Context, movieIDs []int64) ([]*models.MovieEmbedding, error) {
+	var embeddings []*models.MovieEmbedding
+	if len(movieIDs) == 0 {
+		return embeddings, nil
+	}
+
+	err := d.db.NewSelect().
+		Model(&embeddings).
+		Column("movie_id", "model", "source_hash", "updated_at").
+		Where("movie_id IN (?)", bun.In(movieIDs)).
+		Scan(ctx)
+
+	return embeddings, err
+}
+
+// SaveEmbeddings inserts or replaces the embeddings of a batch of movies
+func (d *EmbeddingDB) SaveEmbeddings(ctx context.Context, embeddings []*models.MovieEmbedding) error {
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, e := range embeddings {
+		e.UpdatedAt = now
+	}
+	_, err := d.db.NewInsert().
+		Model(&embeddings).
+		On("CONFLICT (movie_id) DO UPDATE").
+		Set("model = EXCLUDED.model").
+		Set("embedding = EXCLUDED.embedding").
+		Set("source_hash = EXCLUDED.source_hash").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+
+	return err
+}
+
+// SimilarMovies returns up to limit movies whose embeddings are nearest, by
+// cosine distance, to the embedding of movieID made with model
+func (d *EmbeddingDB) SimilarMovies(ctx context.Context, movieID int64, model string, limit int) ([]models.Movie, error) {
+	source := new(models.MovieEmbedding)
+	err := d.db.NewSelect().
+		Model(source).
+		Where("movie_id = ?", movieID).
+		Where("model = ?", model).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("embedding %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var movies []models.Movie
+	err = d.db.NewSelect().
+		Model(&movies).
+		Join("JOIN movie_embeddings AS me ON me.movie_id = m.id").
+		Where("me.model = ?", model).
+		Where("m.id != ?", movieID).
+		Apply(Published).
+		Where("vector_dims(me.embedding) = ?", len(source.Embedding)).
+		OrderExpr("me.embedding <=> ?::vector", source.Embedding).
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type ExportDB struct {
+	db *bun.DB
+}
+
+func NewExportDB(db *bun.DB) *ExportDB {
+	return &ExportDB{
+		db: db,
+	}
+}
+
+// GetCheckpoint returns the checkpoint of a sink, or a new one starting from
+// the beginning if the sink has never exported anything
+func (d *ExportDB) GetCheckpoint(ctx context.Context, sink string) (*models.ExportCheckpoint, error) {
+	checkpoint := new(models.ExportCheckpoint)
+	err := d.db.NewSelect().
+		Model(checkpoint).
+		Where("sink = ?", sink).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.ExportCheckpoint{Sink: sink}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return checkpoint, nil
+}
+
+func (d *ExportDB) SaveCheckpoint(ctx context.Context, checkpoint *models.ExportCheckpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	_, err := d.db.NewInsert().
+		Model(checkpoint).
+		On("CONFLICT (sink) DO UPDATE").
+		Set("last_event_id = EXCLUDED.last_event_id").
+		Set("last_day = EXCLUDED.last_day").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+
+	return err
+}
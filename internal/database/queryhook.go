@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ndn/internal/metrics"
+	"github.com/ndn/internal/requestlog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// maxLoggedQuery is the length slow queries are logged up to
+const maxLoggedQuery = 4 << 10
+
+var (
+	// sensitiveColumn matches the columns holding passwords and secrets, or
+	// their hashes
+	sensitiveColumn = regexp.MustCompile(`(?i)password|secret|token|pin_hash|key_hash`)
+	// stringLiteral matches the string literals of a query, in which '' is
+	// an escaped quote
+	stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+)
+
+// QueryHook counts and times every query run through a bun.DB by operation
+// and table, and logs those taking threshold or longer, zero logging none.
+// Logged queries touching passwords or secrets have their string values
+// redacted.
+type QueryHook struct {
+	threshold time.Duration
+	metrics   *metrics.Metrics
+	logger    *zap.Logger
+}
+
+func NewQueryHook(threshold time.Duration, m *metrics.Metrics, logger *zap.Logger) *QueryHook {
+	return &QueryHook{
+		threshold: threshold,
+		metrics:   m,
+		logger:    logger,
+	}
+}
+
+func (h *QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (h *QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	elapsed := time.Since(event.StartTime)
+	operation := event.Operation()
+	table := ""
+	if event.IQuery != nil {
+		table = strings.Trim(event.IQuery.GetTableName(), `"`)
+	}
+	// Queries finding no rows did not fail
+	failed := event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows)
+	slow := h.threshold > 0 && elapsed >= h.threshold
+
+	h.metrics.Query(operation, table, elapsed, failed, slow)
+	if !slow {
+		return
+	}
+
+	query := redactQuery(event.Query)
+	if len(query) > maxLoggedQuery {
+		query = query[:maxLoggedQuery] + "..."
+	}
+	fields := []zap.Field{
+		zap.String("operation", operation),
+		zap.String("table", table),
+		zap.Duration("elapsed", elapsed),
+		zap.String("query", query),
+	}
+	if failed {
+		fields = append(fields, zap.Error(event.Err))
+	}
+	requestlog.FromContext(ctx, h.logger).Warn("slow query", fields...)
+}
+
+// redactQuery replaces the string values of query with [redacted] if it
+// touches a column holding passwords or secrets
+func redactQuery(query string) string {
+	if !sensitiveColumn.MatchString(query) {
+		return query
+	}
+	return stringLiteral.ReplaceAllString(query, "'[redacted]'")
+}
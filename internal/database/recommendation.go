@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type RecommendationDB struct {
+	db *bun.DB
+}
+
+func NewRecommendationDB(db *bun.DB) *RecommendationDB {
+	return &RecommendationDB{
+		db: db,
+	}
+}
+
+// RecentlyWatched returns up to limit movies the user started playing, most
+// recently played first
+func (d *RecommendationDB) RecentlyWatched(ctx context.Context, userID int64, limit int) ([]models.Movie, error) {
+	plays := d.db.NewSelect().
+		TableExpr("analytics_events").
+		ColumnExpr("movie_id, MAX(occurred_at) AS played_at").
+		Where("user_id = ?", userID).
+		Where("type = 'play_start'").
+		Group("movie_id")
+
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Join("JOIN (?) AS p ON p.movie_id = m.id", plays).
+		Apply(Published).
+		OrderExpr("p.played_at DESC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
+
+// RecentFavorites returns up to limit of the favorite movies of the user, or
+// of their profile when profileID is not 0, most recently added first
+func (d *RecommendationDB) RecentFavorites(ctx context.Context, userID, profileID int64, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Join("JOIN user_favorites AS uf ON uf.movie_id = m.id").
+		Where("uf.user_id = ?", userID).
+		Where("COALESCE(uf.profile_id, 0) = ?", profileID).
+		Apply(Published).
+		Order("uf.created_at DESC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
+
+// FavoriteCategory returns the category the user has the most affinity
+// for: the category of the most movies they started playing since since or
+// marked as favorite, or "" if there are none. With profileID not 0, only
+// the favorites of that profile count.
+func (d *RecommendationDB) FavoriteCategory(ctx context.Context, userID, profileID int64, since time.Time) (string, error) {
+	var category string
+	err := d.db.NewRaw(`
+		SELECT c.category
+		FROM (
+			SELECT movie_id FROM analytics_events
+			WHERE user_id = ? AND type = 'play_start' AND occurred_at >= ?
+			UNION
+			SELECT movie_id FROM user_favorites
+			WHERE user_id = ? AND COALESCE(profile_id, 0) = ?
+		) AS liked
+		JOIN movies m ON m.id = liked.movie_id AND m.deleted_at IS NULL AND m.status = 'published'
+		CROSS JOIN LATERAL unnest(m.categories) AS c(category)
+		GROUP BY c.category
+		ORDER BY COUNT(*) DESC, c.category
+		LIMIT 1`, userID, since, userID, profileID).
+		Scan(ctx, &category)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return category, err
+}
+
+// PopularInCategory returns up to limit movies of a category by trending
+// score, then rating
+func (d *RecommendationDB) PopularInCategory(ctx context.Context, category string, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Join("LEFT JOIN movie_trending_scores AS mts ON mts.movie_id = m.id").
+		Where("? = ANY(m.categories)", category).
+		Apply(Published).
+		OrderExpr("mts.score DESC NULLS LAST, m.rating DESC, m.id ASC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
+
+// NewMovies returns up to limit movies added since since, newest first
+func (d *RecommendationDB) NewMovies(ctx context.Context, since time.Time, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Where("created_at >= ?", since).
+		Apply(Published).
+		Order("created_at DESC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/ndn/internal/config"
+	"sync/atomic"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// Defaults of ReplicaConfig
+const (
+	defaultReplicaCheckInterval = 10 * time.Second
+	defaultReplicaMaxLag        = 30 * time.Second
+)
+
+// replicaLagQuery returns how far a standby is behind its primary in
+// seconds, zero once it has replayed all it received, and NULL on a primary
+const replicaLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END`
+
+// Replicas routes reads that tolerate replication lag, such as the public
+// catalog, to read replicas of the primary database, round robin among the
+// healthy ones. Replicas are checked periodically and skipped while they are
+// unreachable or lag too far behind; reads go to the primary while none is
+// healthy, and until the first check. Writes, and reads that must see them,
+// always use the primary.
+type Replicas struct {
+	primary  *bun.DB
+	replicas []*replica
+	next     atomic.Uint64
+	interval time.Duration
+	maxLag   time.Duration
+	logger   *zap.Logger
+}
+
+type replica struct {
+	name    string
+	db      *bun.DB
+	healthy atomic.Bool
+}
+
+func NewReplicas(primary *bun.DB, cfg config.ReplicaConfig, logger *zap.Logger) *Replicas {
+	r := &Replicas{
+		primary:  primary,
+		interval: cfg.CheckInterval,
+		maxLag:   cfg.MaxLag,
+		logger:   logger,
+	}
+	if r.interval <= 0 {
+		r.interval = defaultReplicaCheckInterval
+	}
+	if r.maxLag <= 0 {
+		r.maxLag = defaultReplicaMaxLag
+	}
+	return r
+}
+
+// Add adds a replica, named in logs after name. It must be called before Run.
+func (r *Replicas) Add(name string, db *bun.DB) {
+	r.replicas = append(r.replicas, &replica{name: name, db: db})
+}
+
+// Reader returns the database to run reads on: the next healthy replica, or
+// the primary
+func (r *Replicas) Reader() *bun.DB {
+	n := len(r.replicas)
+	if n == 0 {
+		return r.primary
+	}
+	start := int(r.next.Add(1) % uint64(n))
+	for i := 0; i < n; i++ {
+		if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+			return rep.db
+		}
+	}
+	return r.primary
+}
+
+// Run checks the replicas until ctx is cancelled
+func (r *Replicas) Run(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Replicas) checkAll(ctx context.Context) {
+	for _, rep := range r.replicas {
+		err := r.check(ctx, rep)
+		healthy := err == nil
+		if rep.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			r.logger.Info("read replica available", zap.String("replica", rep.name))
+		} else {
+			r.logger.Warn("read replica unavailable, skipping it", zap.String("replica", rep.name), zap.Error(err))
+		}
+	}
+}
+
+// check reports whether rep is reachable and caught up with the primary
+func (r *Replicas) check(ctx context.Context, rep *replica) error {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+
+	var lag sql.NullFloat64
+	if err := rep.db.QueryRowContext(ctx, replicaLagQuery).Scan(&lag); err != nil {
+		return err
+	}
+	if behind := time.Duration(lag.Float64 * float64(time.Second)); behind > r.maxLag {
+		return fmt.Errorf("replica is %s behind", behind.Round(time.Second))
+	}
+	return nil
+}
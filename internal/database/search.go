@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"github.com/ndn/internal/models"
+	"strings"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+type SearchDB struct {
+	db *bun.DB
+}
+
+func NewSearchDB(db *bun.DB) *SearchDB {
+	return &SearchDB{
+		db: db,
+	}
+}
+
+// titleRank orders matches of a name column: names equal to a term first,
+// then those starting with one, then those containing one anywhere else
+const titleRank = "CASE WHEN LOWER(?0) = ANY(?1) THEN 0 WHEN ?0 ILIKE ANY(?2) THEN 1 WHEN ?0 ILIKE ANY(?3) THEN 2 ELSE 3 END"
+
+// searchPatterns holds the lower-cased terms of a search and the LIKE
+// patterns matching names that start with or contain one of them
+type searchPatterns struct {
+	exact, prefix, contains []string
+}
+
+func newSearchPatterns(terms []string) searchPatterns {
+	var p searchPatterns
+	for _, term := range terms {
+		term = strings.ToLower(term)
+		p.exact = append(p.exact, term)
+		p.prefix = append(p.prefix, term+"%")
+		p.contains = append(p.contains, "%"+term+"%")
+	}
+	return p
+}
+
+// rank returns the arguments of titleRank for column
+func (p searchPatterns) rank(column string) []interface{} {
+	return []interface{}{bun.Ident(column), pgdialect.Array(p.exact), pgdialect.Array(p.prefix), pgdialect.Array(p.contains)}
+}
+
+// SearchMovies returns up to limit movies whose title or description contains
+// any of terms, best title matches first, and how many movies match in total
+func (d *SearchDB) SearchMovies(ctx context.Context, terms []string, limit int) ([]models.Movie, int, error) {
+	p := newSearchPatterns(terms)
+
+	var movies []models.Movie
+	count, err := d.db.NewSelect().
+		Model(&movies).
+		Join("LEFT JOIN movie_trending_scores AS mts ON mts.movie_id = m.id").
+		Where("m.title ILIKE ANY(?0) OR m.description ILIKE ANY(?0)", pgdialect.Array(p.contains)).
+		Apply(Published).
+		OrderExpr(titleRank, p.rank("m.title")...).
+		OrderExpr("mts.score DESC NULLS LAST, m.rating DESC, m.id ASC").
+		Limit(limit).
+		ScanAndCount(ctx)
+
+	return movies, count, err
+}
+
+// SearchCategories returns up to limit visible categories whose name contains
+// any of terms, best matches first, and how many match in total
+func (d *SearchDB) SearchCategories(ctx context.Context, terms []string, limit int) ([]*models.Category, int, error) {
+	p := newSearchPatterns(terms)
+
+	var categories []*models.Category
+	count, err := d.db.NewSelect().
+		Model(&categories).
+		Where("c.hidden = false").
+		Where("c.name ILIKE ANY(?)", pgdialect.Array(p.contains)).
+		OrderExpr(titleRank, p.rank("c.name")...).
+		Order("c.display_order ASC", "c.name ASC").
+		Limit(limit).
+		ScanAndCount(ctx)
+
+	return categories, count, err
+}
+
+// SearchSeries returns up to limit series whose title or description
+// contains any of terms, best title matches first, and how many series match
+// in total
+func (d *SearchDB) SearchSeries(ctx context.Context, terms []string, limit int) ([]models.Series, int, error) {
+	var series []models.Series
+	count, err := searchSeriesQuery(d.db, &series, newSearchPatterns(terms), limit).ScanAndCount(ctx)
+	return series, count, err
+}
+
+// searchSeriesQuery selects the series matching p into dest, newer series
+// breaking ties between matches of the same rank
+func searchSeriesQuery(db bun.IDB, dest *[]models.Series, p searchPatterns, limit int) *bun.SelectQuery {
+	return db.NewSelect().
+		Model(dest).
+		Where("sr.title ILIKE ANY(?0) OR sr.description ILIKE ANY(?0)", pgdialect.Array(p.contains)).
+		OrderExpr(titleRank, p.rank("sr.title")...).
+		Order("sr.release_year DESC", "sr.title ASC", "sr.id ASC").
+		Limit(limit)
+}
+
+// SearchCollections returns up to limit visible collections whose title or
+// description contains any of terms, best title matches first, and how many
+// match in total
+func (d *SearchDB) SearchCollections(ctx context.Context, terms []string, limit int) ([]models.Collection, int, error) {
+	var collections []models.Collection
+	count, err := searchCollectionsQuery(d.db, &collections, newSearchPatterns(terms), limit).ScanAndCount(ctx)
+	return collections, count, err
+}
+
+// searchCollectionsQuery selects the visible collections matching p into
+// dest, in display order between matches of the same rank
+func searchCollectionsQuery(db bun.IDB, dest *[]models.Collection, p searchPatterns, limit int) *bun.SelectQuery {
+	return db.NewSelect().
+		Model(dest).
+		Where("col.hidden = false").
+		Where("col.title ILIKE ANY(?0) OR col.description ILIKE ANY(?0)", pgdialect.Array(p.contains)).
+		OrderExpr(titleRank, p.rank("col.title")...).
+		Order("col.display_order ASC", "col.title ASC", "col.id ASC").
+		Limit(limit)
+}
+
+// suggestions scores the movie and series titles, visible category names and
+// collection titles and synonym dictionary entries resembling ?0 by trigram
+// word similarity, keeping the best score of names differing only in case
+const suggestions = `
+SELECT suggestion FROM (
+	SELECT DISTINCT ON (LOWER(suggestion)) suggestion, score
+	FROM (
+		SELECT title AS suggestion, word_similarity(?0, LOWER(title)) AS score
+		FROM movies
+		WHERE deleted_at IS NULL AND status = 'published' AND ?0 <% LOWER(title)
+			AND (available_from IS NULL OR available_from <= now())
+			AND (available_until IS NULL OR available_until > now())
+		UNION ALL
+		SELECT title, word_similarity(?0, LOWER(title))
+		FROM series WHERE ?0 <% LOWER(title)
+		UNION ALL
+		SELECT name, word_similarity(?0, LOWER(name))
+		FROM categories WHERE hidden = false AND ?0 <% LOWER(name)
+		UNION ALL
+		SELECT title, word_similarity(?0, LOWER(title))
+		FROM collections WHERE hidden = false AND ?0 <% LOWER(title)
+		UNION ALL
+		SELECT term, word_similarity(?0, term)
+		FROM search_synonyms WHERE ?0 <% term
+		UNION ALL
+		SELECT alternative, word_similarity(?0, LOWER(alternative))
+		FROM search_synonyms, unnest(alternatives) AS alternative WHERE ?0 <% LOWER(alternative)
+	) candidates
+	WHERE LOWER(suggestion) <> ?0
+	ORDER BY LOWER(suggestion), score DESC
+) best
+ORDER BY score DESC, suggestion ASC
+LIMIT ?1`
+
+// Suggest returns up to limit movie and series titles, category names,
+// collection titles and synonym terms resembling term, most similar first,
+// for searches matching nothing
+func (d *SearchDB) Suggest(ctx context.Context, term string, limit int) ([]string, error) {
+	var names []string
+	err := d.db.NewRaw(suggestions, strings.ToLower(term), limit).Scan(ctx, &names)
+	return names, err
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"github.com/ndn/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// newQueryDB returns a database for building queries, never connected to
+func newQueryDB(t *testing.T) *bun.DB {
+	t.Helper()
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSearchGroupQueries(t *testing.T) {
+	db := newQueryDB(t)
+	p := newSearchPatterns([]string{"Star Trek", "ST"})
+
+	tests := []struct {
+		name  string
+		query *bun.SelectQuery
+		want  []string
+		order []string
+	}{
+		{
+			name:  "series",
+			query: searchSeriesQuery(db, new([]models.Series), p, 7),
+			want: []string{
+				`FROM "series" AS "sr"`,
+				`WHERE (sr.title ILIKE ANY('{"%star trek%","%st%"}') OR sr.description ILIKE ANY('{"%star trek%","%st%"}'))`,
+				"LIMIT 7",
+			},
+			order: []string{
+				`CASE WHEN LOWER("sr"."title") = ANY('{"star trek","st"}') THEN 0 WHEN "sr"."title" ILIKE ANY('{"star trek%","st%"}') THEN 1`,
+				`"sr"."release_year" DESC`,
+				`"sr"."title" ASC`,
+				`"sr"."id" ASC`,
+			},
+		},
+		{
+			name:  "collections",
+			query: searchCollectionsQuery(db, new([]models.Collection), p, 3),
+			want: []string{
+				`FROM "collections" AS "col"`,
+				"WHERE (col.hidden = false)",
+				`AND (col.title ILIKE ANY('{"%star trek%","%st%"}') OR col.description ILIKE ANY('{"%star trek%","%st%"}'))`,
+				"LIMIT 3",
+			},
+			order: []string{
+				`CASE WHEN LOWER("col"."title") = ANY('{"star trek","st"}') THEN 0 WHEN "col"."title" ILIKE ANY('{"star trek%","st%"}') THEN 1`,
+				`"col"."display_order" ASC`,
+				`"col"."title" ASC`,
+				`"col"."id" ASC`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.query.String()
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("query does not contain %s: %s", want, got)
+				}
+			}
+
+			_, order, ok := strings.Cut(got, "ORDER BY")
+			if !ok {
+				t.Fatalf("query is not ordered: %s", got)
+			}
+			last := -1
+			for _, want := range tt.order {
+				i := strings.Index(order, want)
+				if i < 0 {
+					t.Fatalf("ORDER BY does not contain %s: %s", want, order)
+				}
+				if i < last {
+					t.Errorf("ORDER BY has %s out of place: %s", want, order)
+				}
+				last = i
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type SynonymDB struct {
+	db *bun.DB
+}
+
+func NewSynonymDB(db *bun.DB) *SynonymDB {
+	return &SynonymDB{
+		db: db,
+	}
+}
+
+// GetSynonyms returns every synonym entry in term order
+func (d *SynonymDB) GetSynonyms(ctx context.Context) ([]*models.SearchSynonym, error) {
+	var synonyms []*models.SearchSynonym
+	err := d.db.NewSelect().
+		Model(&synonyms).
+		Order("term ASC").
+		Scan(ctx)
+
+	return synonyms, err
+}
+
+func (d *SynonymDB) GetSynonym(ctx context.Context, id int64) (*models.SearchSynonym, error) {
+	synonym := new(models.SearchSynonym)
+	err := d.db.NewSelect().
+		Model(synonym).
+		Where("id = ?", id).
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("synonym %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return synonym, nil
+}
+
+// SynonymExists reports whether an entry other than excludeID has term
+func (d *SynonymDB) SynonymExists(ctx context.Context, term string, excludeID int64) (bool, error) {
+	return d.db.NewSelect().
+		Model((*models.SearchSynonym)(nil)).
+		Where("term = ?", term).
+		Where("id != ?", excludeID).
+		Exists(ctx)
+}
+
+func (d *SynonymDB) CreateSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	now := time.Now()
+	synonym.CreatedAt = now
+	synonym.UpdatedAt = now
+	_, err := d.db.NewInsert().
+		Model(synonym).
+		Exec(ctx)
+
+	return err
+}
+
+func (d *SynonymDB) UpdateSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	synonym.UpdatedAt = time.Now()
+	err := d.db.NewUpdate().
+		Model(synonym).
+		Column("term", "alternatives", "updated_at").
+		WherePK().
+		Returning("created_at").
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("synonym %w", ErrNotFound)
+	}
+	return err
+}
+
+func (d *SynonymDB) DeleteSynonym(ctx context.Context, id int64) error {
+	result, err := d.db.NewDelete().
+		Model((*models.SearchSynonym)(nil)).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("synonym %w", ErrNotFound)
+	}
+	return nil
+}
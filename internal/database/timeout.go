@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// DefaultQueryTimeout bounds queries when no timeout is configured
+const DefaultQueryTimeout = 5 * time.Second
+
+type queryTimeoutKey struct{}
+
+// WithQueryTimeout bounds each query run with ctx, or a context derived from
+// it, to d instead of the default of the QueryTimeoutHook. Zero leaves them
+// unbounded, for background jobs whose queries may run long.
+func WithQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+type queryCancelKey struct{}
+
+// QueryTimeoutHook bounds each query run through a bun.DB, so a slow query
+// fails instead of holding its caller until the request times out. Queries
+// get the timeout of their context set with WithQueryTimeout, or the
+// default. Deadlines already on the context still apply when earlier.
+type QueryTimeoutHook struct {
+	timeout time.Duration
+}
+
+// NewQueryTimeoutHook bounds queries to timeout by default, or to
+// DefaultQueryTimeout when zero
+func NewQueryTimeoutHook(timeout time.Duration) *QueryTimeoutHook {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return &QueryTimeoutHook{timeout: timeout}
+}
+
+func (h *QueryTimeoutHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	timeout := h.timeout
+	if d, ok := ctx.Value(queryTimeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	if timeout <= 0 {
+		return ctx
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return context.WithValue(ctx, queryCancelKey{}, cancel)
+}
+
+func (h *QueryTimeoutHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if cancel, ok := ctx.Value(queryCancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
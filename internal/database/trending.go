@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type TrendingDB struct {
+	db *bun.DB
+}
+
+func NewTrendingDB(db *bun.DB) *TrendingDB {
+	return &TrendingDB{
+		db: db,
+	}
+}
+
+// GetSettings returns the trending settings saved by an admin, or nil if
+// none have been saved
+func (d *TrendingDB) GetSettings(ctx context.Context) (*models.TrendingSettings, error) {
+	settings := new(models.TrendingSettings)
+	err := d.db.NewSelect().
+		Model(settings).
+		Where("id = 1").
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (d *TrendingDB) SaveSettings(ctx context.Context, settings *models.TrendingSettings) error {
+	settings.ID = 1
+	settings.UpdatedAt = time.Now()
+	_, err := d.db.NewInsert().
+		Model(settings).
+		On("CONFLICT (id) DO UPDATE").
+		Set("half_life_hours = EXCLUDED.half_life_hours").
+		Set("window_days = EXCLUDED.window_days").
+		Set("age_gravity = EXCLUDED.age_gravity").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+
+	return err
+}
+
+// trendingScore scores a movie played within a window: each day's plays
+// decay exponentially with the day's age, and the sum is divided by the
+// movie's catalog age in days raised to the age gravity
+const trendingScore = `
+	SUM(s.views * EXP(-LN(2) * (CAST(? AS date) - s.day) / CAST(? AS double precision)))
+		/ POWER(1 + GREATEST(EXTRACT(EPOCH FROM (CAST(? AS timestamp) - m.created_at)) / 86400, 0), CAST(? AS double precision)),
+	?
+FROM movie_daily_stats s
+JOIN movies m ON m.id = s.movie_id AND m.deleted_at IS NULL
+WHERE s.day >= ? AND s.views > 0
+GROUP BY m.id, m.created_at`
+
+// computeScores scores every movie played within the configured window
+const computeScores = `
+INSERT INTO movie_trending_scores (movie_id, score, computed_at)
+SELECT m.id,` + trendingScore
+
+// computeWindowScores scores every movie played within a fixed window
+const computeWindowScores = `
+INSERT INTO movie_trending_window_scores (window_days, movie_id, score, computed_at)
+SELECT CAST(? AS integer), m.id,` + trendingScore
+
+// ComputeScores replaces all trending scores with ones computed as of now,
+// over the configured window and over each of windows, in days
+func (d *TrendingDB) ComputeScores(ctx context.Context, settings *models.TrendingSettings, windows []int, now time.Time) error {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	from := today.AddDate(0, 0, -settings.WindowDays)
+	halfLifeDays := settings.HalfLifeHours / 24
+
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewDelete().Model((*models.MovieTrendingScore)(nil)).Where("TRUE").Exec(ctx); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, computeScores, today, halfLifeDays, now, settings.AgeGravity, now, from); err != nil {
+			return err
+		}
+
+		if _, err := tx.NewDelete().Model((*models.MovieTrendingWindowScore)(nil)).Where("TRUE").Exec(ctx); err != nil {
+			return err
+		}
+		for _, days := range windows {
+			from := today.AddDate(0, 0, -days)
+			if _, err := tx.ExecContext(ctx, computeWindowScores, days, today, halfLifeDays, now, settings.AgeGravity, now, from); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TrendingMovies returns up to limit movies with the highest trending score
+func (d *TrendingDB) TrendingMovies(ctx context.Context, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Join("JOIN movie_trending_scores AS mts ON mts.movie_id = m.id").
+		Apply(Published).
+		OrderExpr("mts.score DESC, m.id ASC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
+
+// WindowTrendingMovies returns up to limit movies with the highest trending
+// score over the last windowDays days
+func (d *TrendingDB) WindowTrendingMovies(ctx context.Context, windowDays, limit int) ([]models.Movie, error) {
+	var movies []models.Movie
+	err := d.db.NewSelect().
+		Model(&movies).
+		Join("JOIN movie_trending_window_scores AS mtw ON mtw.movie_id = m.id AND mtw.window_days = ?", windowDays).
+		Apply(Published).
+		OrderExpr("mtw.score DESC, m.id ASC").
+		Limit(limit).
+		Scan(ctx)
+
+	return movies, err
+}
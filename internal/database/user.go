@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"github.com/ndn/internal/models"
+	"time"
 
 	"github.com/uptrace/bun"
 )
@@ -19,15 +21,17 @@ func NewUserDB(db *bun.DB) *UserDB {
 	}
 }
 
+// GetUser returns a user with their profile, if they have one
 func (d *UserDB) GetUser(ctx context.Context, id int64) (*models.User, error) {
 	user := new(models.User)
 	err := d.db.NewSelect().
 		Model(user).
-		Where("id = ?", id).
+		Relation("Profile").
+		Where("u.id = ?", id).
 		Scan(ctx)
 
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
 	}
 	if err != nil {
 		return nil, err
@@ -36,18 +40,72 @@ func (d *UserDB) GetUser(ctx context.Context, id int64) (*models.User, error) {
 	return user, nil
 }
 
-func (d *UserDB) ListUsers(ctx context.Context) ([]*models.User, error) {
-	var users []*models.User
+// GetUserWithDeleted returns the user with id, even if deleted
+func (d *UserDB) GetUserWithDeleted(ctx context.Context, id int64) (*models.User, error) {
+	user := new(models.User)
 	err := d.db.NewSelect().
-		Model(&users).
-		Order("created_at DESC").
+		Model(user).
+		Relation("Profile").
+		Where("u.id = ?", id).
+		WhereAllWithDeleted().
 		Scan(ctx)
 
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return user, nil
+}
+
+// UserFilter selects the users ListUsers returns. Zero fields match every
+// user.
+type UserFilter struct {
+	Query         string     // part of the email or name, in any case
+	IsAdmin       *bool      // admins only, or everyone else
+	CreatedAfter  *time.Time // created at or after
+	CreatedBefore *time.Time // created before
+	WithDeleted   bool       // deleted accounts too, until they are purged
+	Limit         int
+	Offset        int
+}
+
+// ListUsers returns a page of the users filter matches, newest first, and
+// how many match in total
+func (d *UserDB) ListUsers(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	var users []*models.User
+	query := d.db.NewSelect().
+		Model(&users)
+
+	if filter.Query != "" {
+		query.Where("u.email ILIKE ? OR u.name ILIKE ?",
+			"%"+filter.Query+"%", "%"+filter.Query+"%")
+	}
+	if filter.IsAdmin != nil {
+		query.Where("u.is_admin = ?", *filter.IsAdmin)
+	}
+	if filter.CreatedAfter != nil {
+		query.Where("u.created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		query.Where("u.created_at < ?", *filter.CreatedBefore)
+	}
+	if filter.WithDeleted {
+		query.WhereAllWithDeleted()
+	}
+
+	total, err := query.
+		Order("u.created_at DESC", "u.id DESC").
+		Limit(filter.Limit).
+		Offset(filter.Offset).
+		ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
 }
 
 func (d *UserDB) UpdateUser(ctx context.Context, user *models.User) error {
@@ -59,3 +117,207 @@ func (d *UserDB) UpdateUser(ctx context.Context, user *models.User) error {
 
 	return err
 }
+
+// SetAvatar sets the avatar URLs of the user with userID, creating their
+// profile if they have none yet
+func (d *UserDB) SetAvatar(ctx context.Context, userID int64, avatar string, urls map[string]string, at time.Time) error {
+	profile := &models.UserProfile{
+		UserID:     userID,
+		Avatar:     avatar,
+		AvatarURLs: urls,
+		CreatedAt:  at,
+		UpdatedAt:  at,
+	}
+	_, err := d.db.NewInsert().
+		Model(profile).
+		Column("user_id", "avatar", "avatar_urls", "created_at", "updated_at").
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("avatar = EXCLUDED.avatar").
+		Set("avatar_urls = EXCLUDED.avatar_urls").
+		Set("updated_at = EXCLUDED.updated_at").
+		Exec(ctx)
+	return err
+}
+
+// SaveProfileDetails stores the bio, avatar and date of birth of the user
+// of profile, creating their profile if they have none yet
+func (d *UserDB) SaveProfileDetails(ctx context.Context, profile *models.UserProfile) error {
+	_, err := d.db.NewInsert().
+		Model(profile).
+		Column("user_id", "bio", "avatar", "avatar_urls", "date_of_birth", "created_at", "updated_at").
+		On("CONFLICT (user_id) DO UPDATE").
+		Set("bio = EXCLUDED.bio").
+		Set("avatar = EXCLUDED.avatar").
+		Set("avatar_urls = EXCLUDED.avatar_urls").
+		Set("date_of_birth = EXCLUDED.date_of_birth").
+		Set("updated_at = EXCLUDED.updated_at").
+		Returning("*").
+		Exec(ctx)
+	return err
+}
+
+// SetRole changes the content workflow role of a user
+func (d *UserDB) SetRole(ctx context.Context, id int64, role string) (*models.User, error) {
+	user := &models.User{ID: id, Role: role}
+	err := d.db.NewUpdate().
+		Model(user).
+		Column("role").
+		Set("updated_at = ?", time.Now()).
+		WherePK().
+		Returning("*").
+		Scan(ctx)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %w", ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (d *UserDB) CreateUser(ctx context.Context, user *models.User) error {
+	_, err := d.db.NewInsert().
+		Model(user).
+		Exec(ctx)
+
+	return err
+}
+
+// UserExists reports whether email is taken, by deleted accounts too until
+// they are purged
+func (d *UserDB) UserExists(ctx context.Context, email string) (bool, error) {
+	return d.db.NewSelect().
+		Model((*models.User)(nil)).
+		WhereAllWithDeleted().
+		Where("email = ?", email).
+		Exists(ctx)
+}
+
+// SetStatus saves whether user is an admin and when, if ever, they were
+// suspended
+func (d *UserDB) SetStatus(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+	res, err := d.db.NewUpdate().
+		Model(user).
+		Column("is_admin", "suspended_at", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteUser soft-deletes the user with id at at and ends their sessions,
+// as when they delete their account themselves, but leaves their reviews
+// theirs so RestoreUser brings them back. PurgeDeletedUsers removes the
+// account for good later.
+func (d *UserDB) DeleteUser(ctx context.Context, id int64, at time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewUpdate().
+			Model((*models.User)(nil)).
+			Set("deleted_at = ?", at).
+			Set("updated_at = ?", at).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("user %w", ErrNotFound)
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.RefreshToken)(nil)).
+			Set("revoked_at = ?", at).
+			Where("user_id = ?", id).
+			Where("revoked_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*models.PasswordResetToken)(nil)).
+			Where("user_id = ?", id).
+			Exec(ctx)
+		return err
+	})
+}
+
+// RestoreUser undoes the deletion of the user with id, who can sign in
+// again. Reviews detached when they deleted their account themselves stay
+// without an author.
+func (d *UserDB) RestoreUser(ctx context.Context, id int64, at time.Time) error {
+	res, err := d.db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("deleted_at = NULL").
+		Set("updated_at = ?", at).
+		Where("id = ?", id).
+		WhereDeleted().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("deleted user %w", ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeDeletedUsers removes the accounts deleted before before for good,
+// with their favorites and watch history, and returns how many it removed.
+// The rest of their data, such as sessions, profiles and reviews, is deleted
+// by the database along with them.
+func (d *UserDB) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		n, err = deleteUsers(ctx, tx, "deleted_at < ?", before)
+		return err
+	})
+	return n, err
+}
+
+// deleteUsers deletes the users, soft-deleted or not, matching where, with
+// their favorites and watch history, and returns how many it deleted
+func deleteUsers(ctx context.Context, tx bun.Tx, where string, args ...interface{}) (int64, error) {
+	matching := tx.NewSelect().
+		Model((*models.User)(nil)).
+		Column("id").
+		WhereAllWithDeleted().
+		Where(where, args...)
+
+	_, err := tx.NewDelete().
+		Model((*models.UserFavorite)(nil)).
+		Where("user_id IN (?)", matching).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.NewDelete().
+		Model((*models.WatchHistory)(nil)).
+		Where("user_id IN (?)", matching).
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.NewDelete().
+		Model((*models.User)(nil)).
+		WhereAllWithDeleted().
+		Where(where, args...).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// VideoDB tracks the processing state of uploaded movie videos and the
+// queue of transcoding jobs
+type VideoDB struct {
+	db *bun.DB
+}
+
+func NewVideoDB(db *bun.DB) *VideoDB {
+	return &VideoDB{
+		db: db,
+	}
+}
+
+// GetVideo returns the video fields of a movie
+func (d *VideoDB) GetVideo(ctx context.Context, movieID int64) (*models.Movie, error) {
+	movie := new(models.Movie)
+	err := d.db.NewSelect().
+		Model(movie).
+		Column("id", "video_url", "video_status", "video_error", "video_source_key").
+		Where("id = ?", movieID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("movie %w", ErrNotFound)
+	}
+	return movie, err
+}
+
+// StartUpload marks the video of a movie as being uploaded to sourceKey,
+// clearing any previous error
+func (d *VideoDB) StartUpload(ctx context.Context, movieID int64, sourceKey string, now time.Time) error {
+	res, err := d.db.NewUpdate().
+		Model((*models.Movie)(nil)).
+		Set("video_status = ?", models.VideoStatusUploading).
+		Set("video_source_key = ?", sourceKey).
+		Set("video_error = NULL").
+		Set("updated_at = ?", now).
+		Where("id = ?", movieID).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("movie %w", ErrNotFound)
+	}
+	return nil
+}
+
+// FailUpload marks the upload to sourceKey as failed, unless another upload
+// has replaced it since
+func (d *VideoDB) FailUpload(ctx context.Context, movieID int64, sourceKey, reason string, now time.Time) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.Movie)(nil)).
+		Set("video_status = ?", models.VideoStatusFailed).
+		Set("video_error = ?", reason).
+		Set("updated_at = ?", now).
+		Where("id = ? AND video_source_key = ?", movieID, sourceKey).
+		Exec(ctx)
+	return err
+}
+
+// Enqueue queues the upload at sourceKey for transcoding and marks the
+// video of the movie as processing
+func (d *VideoDB) Enqueue(ctx context.Context, movieID int64, sourceKey string, now time.Time) (*models.TranscodeJob, error) {
+	job := &models.TranscodeJob{
+		MovieID:   movieID,
+		SourceKey: sourceKey,
+		Status:    models.TranscodeJobQueued,
+		CreatedAt: now,
+	}
+	err := d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if _, err := tx.NewInsert().Model(job).Exec(ctx); err != nil {
+			return err
+		}
+		_, err := tx.NewUpdate().
+			Model((*models.Movie)(nil)).
+			Set("video_status = ?", models.VideoStatusProcessing).
+			Set("video_error = NULL").
+			Set("updated_at = ?", now).
+			Where("id = ?", movieID).
+			Exec(ctx)
+		return err
+	})
+
+	return job, err
+}
+
+// LatestJob returns the most recent transcoding job of a movie, or nil if it
+// has none
+func (d *VideoDB) LatestJob(ctx context.Context, movieID int64) (*models.TranscodeJob, error) {
+	job := new(models.TranscodeJob)
+	err := d.db.NewSelect().
+		Model(job).
+		Where("movie_id = ?", movieID).
+		OrderExpr("created_at DESC, id DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// ClaimJob marks the oldest queued job as running and returns it, or nil if
+// none is queued. Jobs locked by another worker are skipped, so each job is
+// claimed once however many workers poll.
+func (d *VideoDB) ClaimJob(ctx context.Context, now time.Time) (*models.TranscodeJob, error) {
+	job := new(models.TranscodeJob)
+	err := d.db.NewRaw(`
+		UPDATE transcode_jobs
+		SET status = ?, attempts = attempts + 1, started_at = ?, error = NULL
+		WHERE id = (
+			SELECT id FROM transcode_jobs
+			WHERE status = ?
+			ORDER BY created_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.TranscodeJobRunning, now, models.TranscodeJobQueued,
+	).Scan(ctx, job)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ReleaseJob queues a running job again without counting the attempt, for
+// a worker that stops before finishing it
+func (d *VideoDB) ReleaseJob(ctx context.Context, jobID int64) error {
+	_, err := d.db.NewUpdate().
+		Model((*models.TranscodeJob)(nil)).
+		Set("status = ?", models.TranscodeJobQueued).
+		Set("attempts = attempts - 1").
+		Set("started_at = NULL").
+		Where("id = ? AND status = ?", jobID, models.TranscodeJobRunning).
+		Exec(ctx)
+	return err
+}
+
+// RequeueStale queues again the jobs running since before startedBefore,
+// whose worker is presumed dead, and fails those already claimed
+// maxAttempts times along with the videos of their movies
+func (d *VideoDB) RequeueStale(ctx context.Context, startedBefore time.Time, maxAttempts int, now time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewUpdate().
+			Model((*models.TranscodeJob)(nil)).
+			Set("status = ?", models.TranscodeJobQueued).
+			Where("status = ? AND started_at < ? AND attempts < ?", models.TranscodeJobRunning, startedBefore, maxAttempts).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		var failed []models.TranscodeJob
+		err = tx.NewRaw(`
+			UPDATE transcode_jobs
+			SET status = ?, error = ?, finished_at = ?
+			WHERE status = ? AND started_at < ?
+			RETURNING id, movie_id, source_key`,
+			models.TranscodeJobFailed, "timed out", now, models.TranscodeJobRunning, startedBefore,
+		).Scan(ctx, &failed)
+		if err != nil {
+			return err
+		}
+		for _, job := range failed {
+			if err := failVideo(ctx, tx, &job, "transcoding timed out", now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FinishJob records the outcome of a job: on success the movie is played
+// from videoURL, otherwise its video failed with jobErr. The movie is left
+// alone if a newer upload has replaced the job's.
+func (d *VideoDB) FinishJob(ctx context.Context, job *models.TranscodeJob, videoURL string, jobErr error, now time.Time) error {
+	return d.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		update := tx.NewUpdate().
+			Model((*models.TranscodeJob)(nil)).
+			Set("finished_at = ?", now).
+			Where("id = ?", job.ID)
+		if jobErr != nil {
+			update.Set("status = ?", models.TranscodeJobFailed).Set("error = ?", jobErr.Error())
+		} else {
+			update.Set("status = ?", models.TranscodeJobDone)
+		}
+		if _, err := update.Exec(ctx); err != nil {
+			return err
+		}
+
+		if jobErr != nil {
+			return failVideo(ctx, tx, job, "transcoding failed", now)
+		}
+		_, err := tx.NewUpdate().
+			Model((*models.Movie)(nil)).
+			Set("video_url = ?", videoURL).
+			Set("video_status = ?", models.VideoStatusReady).
+			Set("video_error = NULL").
+			Set("updated_at = ?", now).
+			Where("id = ? AND video_source_key = ?", job.MovieID, job.SourceKey).
+			Exec(ctx)
+		return err
+	})
+}
+
+// failVideo marks the video of the job's movie as failed, keeping the
+// video_url it had before
+func failVideo(ctx context.Context, tx bun.Tx, job *models.TranscodeJob, reason string, now time.Time) error {
+	_, err := tx.NewUpdate().
+		Model((*models.Movie)(nil)).
+		Set("video_status = ?", models.VideoStatusFailed).
+		Set("video_error = ?", reason).
+		Set("updated_at = ?", now).
+		Where("id = ? AND video_source_key = ?", job.MovieID, job.SourceKey).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+type WatchHistoryDB struct {
+	db *bun.DB
+}
+
+func NewWatchHistoryDB(db *bun.DB) *WatchHistoryDB {
+	return &WatchHistoryDB{
+		db: db,
+	}
+}
+
+// ContinueWatchingEntry is a movie a user started, with where they stopped
+type ContinueWatchingEntry struct {
+	models.Movie `bun:",extend"`
+
+	PositionSeconds int       `bun:"position_seconds"`
+	Device          string    `bun:"device"`
+	LastWatchedAt   time.Time `bun:"last_watched_at"`
+}
+
+// SaveProgress records where the user, or their profile, stopped in a
+// publicly shown movie, replacing their previous position in it
+func (d *WatchHistoryDB) SaveProgress(ctx context.Context, entry *models.WatchHistory) error {
+	exists, err := d.db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Where("m.id = ?", entry.MovieID).
+		Apply(Published).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("movie %w", ErrNotFound)
+	}
+
+	_, err = d.db.NewInsert().
+		Model(entry).
+		On("CONFLICT (user_id, (COALESCE(profile_id, 0)), movie_id) DO UPDATE").
+		Set("position_seconds = EXCLUDED.position_seconds").
+		Set("device = EXCLUDED.device").
+		Set("last_watched_at = EXCLUDED.last_watched_at").
+		Exec(ctx)
+
+	return err
+}
+
+// ContinueWatching returns up to limit publicly shown movies the user, or
+// their profile when profileID is not 0, started but stopped before
+// finishedFraction of their duration, most recently watched first
+func (d *WatchHistoryDB) ContinueWatching(ctx context.Context, userID, profileID int64, finishedFraction float64, limit int) ([]ContinueWatchingEntry, error) {
+	var entries []ContinueWatchingEntry
+	err := d.db.NewSelect().
+		Model(&entries).
+		ColumnExpr("m.*").
+		ColumnExpr("wh.position_seconds, wh.device, wh.last_watched_at").
+		Join("JOIN watch_history AS wh ON wh.movie_id = m.id").
+		Where("wh.user_id = ?", userID).
+		Where("COALESCE(wh.profile_id, 0) = ?", profileID).
+		Where("wh.position_seconds > 0").
+		Where("m.duration = 0 OR wh.position_seconds < m.duration * 60 * ?", finishedFraction).
+		Apply(Published).
+		OrderExpr("wh.last_watched_at DESC, m.id DESC").
+		Limit(limit).
+		Scan(ctx)
+
+	return entries, err
+}
@@ -0,0 +1,162 @@
+// Package deprecation marks routes as deprecated. Responses from a deprecated
+// route carry the Deprecation (RFC 9745), Sunset (RFC 8594) and Link headers,
+// and each client still calling it is logged so it can be contacted before
+// the route is removed.
+package deprecation
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ndn/internal/ratelimit"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// logInterval is how often usage of a deprecated route is logged per client
+const logInterval = time.Hour
+
+// Policy describes a deprecated route
+type Policy struct {
+	// Since is when the route was deprecated
+	Since time.Time
+	// Sunset is when the route stops working; zero if not yet scheduled
+	Sunset time.Time
+	// Successor links the route that replaces this one, e.g. /api/v2/movies
+	Successor string
+	// Docs links a page explaining the deprecation and how to migrate
+	Docs string
+}
+
+type usage struct {
+	route  string
+	client string
+	logged time.Time
+	count  int
+}
+
+// Tracker emits deprecation headers and logs which clients call deprecated
+// routes. Calls are counted per route and client and logged at most once per
+// hour, so a busy client does not flood the logs.
+type Tracker struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+	usage  map[string]*usage
+	now    func() time.Time
+}
+
+func NewTracker(logger *zap.Logger) *Tracker {
+	return &Tracker{
+		logger: logger,
+		usage:  make(map[string]*usage),
+		now:    time.Now,
+	}
+}
+
+// Deprecate returns middleware marking the routes it wraps as deprecated
+// under p. Use it at route registration:
+//
+//	r.With(deprecations.Deprecate(policy)).Get("/movies/top-rated", ...)
+func (t *Tracker) Deprecate(p Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", "@"+strconv.FormatInt(p.Since.Unix(), 10))
+			if !p.Sunset.IsZero() {
+				h.Set("Sunset", p.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if p.Successor != "" {
+				h.Add("Link", "<"+p.Successor+`>; rel="successor-version"`)
+			}
+			if p.Docs != "" {
+				h.Add("Link", "<"+p.Docs+`>; rel="deprecation"; type="text/html"`)
+			}
+
+			t.record(r, p)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// record counts a call and logs it if the client has not been logged for the
+// route within the last interval
+func (t *Tracker) record(r *http.Request, p Policy) {
+	route := r.Method + " " + r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = r.Method + " " + rctx.RoutePattern()
+	}
+	client := ratelimit.ClientKey(r)
+
+	t.mu.Lock()
+	now := t.now()
+	key := route + " " + client
+	u, ok := t.usage[key]
+	if !ok {
+		u = &usage{route: route, client: client}
+		t.usage[key] = u
+	}
+	u.count++
+	if ok && now.Sub(u.logged) < logInterval {
+		t.mu.Unlock()
+		return
+	}
+	count := u.count
+	u.logged = now
+	u.count = 0
+	t.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.String("route", route),
+		zap.String("client", client),
+		zap.Int("calls", count),
+		zap.String("user_agent", r.UserAgent()),
+	}
+	if !p.Sunset.IsZero() {
+		fields = append(fields, zap.Time("sunset", p.Sunset), zap.Bool("past_sunset", now.After(p.Sunset)))
+	}
+	t.logger.Warn("deprecated route called", fields...)
+}
+
+// Run forgets clients that stopped calling deprecated routes until ctx is
+// cancelled. Calls not yet logged are logged before a client is forgotten.
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(logInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.evict()
+		}
+	}
+}
+
+func (t *Tracker) evict() {
+	t.mu.Lock()
+	now := t.now()
+	var pending []*usage
+	for key, u := range t.usage {
+		if now.Sub(u.logged) < logInterval {
+			continue
+		}
+		if u.count > 0 {
+			pending = append(pending, u)
+		}
+		delete(t.usage, key)
+	}
+	t.mu.Unlock()
+
+	for _, u := range pending {
+		t.logger.Warn("deprecated route called",
+			zap.String("route", u.route),
+			zap.String("client", u.client),
+			zap.Int("calls", u.count),
+		)
+	}
+}
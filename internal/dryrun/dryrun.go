@@ -0,0 +1,81 @@
+// Package dryrun lets admins preview a mutation: the request is validated and
+// answered as usual, but nothing is committed. Services writing in a
+// transaction carry the change out and roll it back, so the response shows
+// what would have changed; others stop once the request has been validated.
+package dryrun
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/ndn/internal/apierror"
+)
+
+const (
+	// Param is the query parameter asking for a dry run, e.g. ?dry_run=true
+	Param = "dry_run"
+	// Header asks for a dry run like Param, and is echoed on responses to
+	// requests that were dry runs
+	Header = "Dry-Run"
+)
+
+type contextKey struct{}
+
+// Middleware marks requests with ?dry_run=true or a "Dry-Run: true" header
+// as dry runs. Services consult FromContext before committing a change.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dry, err := requested(r)
+		if err != nil {
+			sendError(w, r, "invalid_dry_run", http.StatusBadRequest)
+			return
+		}
+		if !dry {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set(Header, "true")
+		next.ServeHTTP(w, r.WithContext(WithDryRun(r.Context())))
+	})
+}
+
+// Unsupported rejects dry runs of routes whose changes cannot be previewed,
+// so they are never carried out by a request expecting a preview
+func Unsupported(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) {
+			w.Header().Del(Header)
+			sendError(w, r, "dry_run_unsupported", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithDryRun marks ctx as belonging to a dry run
+func WithDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKey{}, true)
+}
+
+// FromContext reports whether ctx belongs to a dry run
+func FromContext(ctx context.Context) bool {
+	dry, _ := ctx.Value(contextKey{}).(bool)
+	return dry
+}
+
+func requested(r *http.Request) (bool, error) {
+	value := r.URL.Query().Get(Param)
+	if value == "" {
+		value = r.Header.Get(Header)
+	}
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func sendError(w http.ResponseWriter, r *http.Request, code string, status int) {
+	apierror.Write(w, r, status, code)
+}
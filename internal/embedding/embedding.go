@@ -0,0 +1,61 @@
+// Package embedding turns text into vectors for semantic similarity. Each
+// embedding API is a Provider; which one is used is decided by configuration.
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+// Provider types accepted in configuration
+const (
+	TypeOpenAI = "openai"
+	TypeOllama = "ollama"
+)
+
+// Provider embeds texts with a single model. Vectors are returned in the
+// order of the texts and all have the same number of dimensions.
+type Provider interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewProvider builds the configured provider, or returns nil when no provider
+// is configured and embeddings are disabled
+func NewProvider(cfg config.EmbeddingConfig) (Provider, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	client := tracecontext.NewClient(&http.Client{Timeout: timeout})
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case TypeOpenAI:
+		return NewOpenAI(cfg, client), nil
+	case TypeOllama:
+		return NewOllama(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+}
+
+// checkVectors verifies a provider returned one vector per text
+func checkVectors(vectors [][]float32, texts []string) error {
+	if len(vectors) != len(texts) {
+		return fmt.Errorf("embedding provider returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	for _, v := range vectors {
+		if len(v) == 0 || len(v) != len(vectors[0]) {
+			return errors.New("embedding provider returned vectors of inconsistent dimensions")
+		}
+	}
+	return nil
+}
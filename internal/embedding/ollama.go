@@ -0,0 +1,76 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ndn/internal/config"
+)
+
+const defaultOllamaURL = "http://localhost:11434"
+
+// Ollama calls the /api/embed endpoint of a local Ollama server
+type Ollama struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+func NewOllama(cfg config.EmbeddingConfig, client *http.Client) *Ollama {
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if url == "" {
+		url = defaultOllamaURL
+	}
+	return &Ollama{
+		url:    url,
+		model:  cfg.Model,
+		client: client,
+	}
+}
+
+func (o *Ollama) Model() string {
+	return o.model
+}
+
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": o.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding request failed with %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+	if err := checkVectors(result.Embeddings, texts); err != nil {
+		return nil, err
+	}
+	return result.Embeddings, nil
+}
@@ -0,0 +1,92 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ndn/internal/config"
+)
+
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
+// OpenAI calls an OpenAI-compatible /embeddings endpoint, which most hosted
+// and self-hosted embedding servers also expose
+type OpenAI struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func NewOpenAI(cfg config.EmbeddingConfig, client *http.Client) *OpenAI {
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if url == "" {
+		url = defaultOpenAIURL
+	}
+	return &OpenAI{
+		url:    url,
+		apiKey: cfg.APIKey,
+		model:  cfg.Model,
+		client: client,
+	}
+}
+
+func (o *OpenAI) Model() string {
+	return o.model
+}
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model": o.model,
+		"input": texts,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request embeddings: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embedding request failed with %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %w", err)
+	}
+
+	sort.Slice(result.Data, func(i, j int) bool { return result.Data[i].Index < result.Data[j].Index })
+	vectors := make([][]float32, len(result.Data))
+	for i, d := range result.Data {
+		vectors[i] = d.Embedding
+	}
+	if err := checkVectors(vectors, texts); err != nil {
+		return nil, err
+	}
+	return vectors, nil
+}
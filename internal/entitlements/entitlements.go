@@ -0,0 +1,99 @@
+// Package entitlements maps subscription plans to what their subscribers
+// may do when playing videos, so playback gates features on the
+// Entitlements of a request rather than on plan codes.
+package entitlements
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+)
+
+// Capability is a feature of playback that plans may or may not include
+type Capability string
+
+const (
+	// Downloads lets users download videos to watch offline
+	Downloads Capability = "downloads"
+)
+
+// Entitlements are what a user may do when playing videos. MaxHeight caps
+// the height in pixels of the HLS renditions they may stream and
+// MaxStreams how many videos they may play at once; zero is no limit for
+// either. Plan is the code of the plan they come from, empty for users
+// whose playback is not gated on a subscription.
+type Entitlements struct {
+	Plan       string `json:"plan,omitempty" example:"standard"`
+	MaxHeight  int    `json:"max_height" example:"1080"`
+	MaxStreams int    `json:"max_streams" example:"2"`
+	Downloads  bool   `json:"downloads" example:"true"`
+}
+
+// Unlimited are the entitlements of admins, and of every user while billing
+// is disabled
+var Unlimited = Entitlements{Downloads: true}
+
+// Allows reports whether the entitlements include capability c
+func (e Entitlements) Allows(c Capability) bool {
+	switch c {
+	case Downloads:
+		return e.Downloads
+	}
+	return false
+}
+
+// Policy resolves the entitlements of subscribers of each plan
+type Policy struct {
+	plans    map[string]config.Entitlement
+	fallback config.Entitlement
+}
+
+func NewPolicy(cfg config.EntitlementsConfig) *Policy {
+	return &Policy{plans: cfg.Plans, fallback: cfg.Default}
+}
+
+// ForPlan returns the entitlements of subscribers of the plan with code,
+// or the default ones for plans that are not configured
+func (p *Policy) ForPlan(code string) Entitlements {
+	e, ok := p.plans[code]
+	if !ok {
+		e = p.fallback
+	}
+	return Entitlements{
+		Plan:       code,
+		MaxHeight:  e.MaxHeight,
+		MaxStreams: e.MaxStreams,
+		Downloads:  e.Downloads,
+	}
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying e
+func NewContext(ctx context.Context, e Entitlements) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// FromContext returns the entitlements in ctx, if any
+func FromContext(ctx context.Context) (Entitlements, bool) {
+	e, ok := ctx.Value(contextKey{}).(Entitlements)
+	return e, ok
+}
+
+// Require rejects requests whose entitlements, put in their context by an
+// earlier middleware, do not include capability c, answering 403
+// feature_not_in_plan. Requests without entitlements are rejected too.
+func Require(c Capability) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e, ok := FromContext(r.Context())
+			if !ok || !e.Allows(c) {
+				apierror.Write(w, r, http.StatusForbidden, "feature_not_in_plan", "feature", string(c))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
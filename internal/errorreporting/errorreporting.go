@@ -0,0 +1,434 @@
+// Package errorreporting reports panics and server errors to an error
+// tracker, Sentry or any service accepting signed JSON events on a webhook,
+// with
+// the stack trace, the request and the user it was made by. Its middleware
+// replaces middleware.Recoverer: it recovers panics, answering them with a
+// 500, and reports them and every other 5xx response once answered. Handlers
+// attach the error behind a 5xx with CaptureError, and AuthMiddleware the
+// authenticated user with SetUser, so reports carry them. Events are sent in
+// the background and dropped, not queued, when the tracker falls behind.
+package errorreporting
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/requestlog"
+	"github.com/ndn/internal/tracecontext"
+	"github.com/ndn/internal/webhook"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// Providers of error reports
+const (
+	ProviderSentry  = "sentry"
+	ProviderWebhook = "webhook"
+)
+
+// Levels of events
+const (
+	LevelFatal = "fatal"
+	LevelError = "error"
+)
+
+// WebhookEvent is the Webhook-Event of the events sent with the webhook
+// provider
+const WebhookEvent = "error.reported"
+
+const (
+	defaultBufferSize = 100
+	defaultTimeout    = 5 * time.Second
+	maxStackDepth     = 64
+)
+
+// Frame is a function call of a stack trace
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Request describes the request an event happened in
+type Request struct {
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Route     string `json:"route,omitempty"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+	TraceID   string `json:"trace_id,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// Event is a panic or server error reported. Type is the type of the error,
+// or panic, and Stack lists the calls leading to it, innermost first.
+type Event struct {
+	ID          string    `json:"id"`
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Type        string    `json:"type"`
+	Message     string    `json:"message"`
+	Stack       []Frame   `json:"stack,omitempty"`
+	Request     Request   `json:"request"`
+	UserID      int64     `json:"user_id,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	Release     string    `json:"release,omitempty"`
+
+	// trace is the trace the event happened in, continued by its delivery
+	trace  tracecontext.TraceContext
+	traced bool
+}
+
+// Reporter sends events to the configured tracker. When disabled its
+// middleware still recovers panics, but nothing is reported.
+type Reporter struct {
+	cfg    config.ErrorReportingConfig
+	send   func(ctx context.Context, event *Event) error
+	events chan *Event
+	logger *zap.Logger
+}
+
+// New returns a reporter sending events to Sentry, the project of dsn, or
+// with the webhook provider through sender to the endpoint named in cfg. It
+// is disabled unless enabled in cfg, and for Sentry given a DSN.
+func New(cfg config.ErrorReportingConfig, dsn string, sender *webhook.Sender, logger *zap.Logger) (*Reporter, error) {
+	r := &Reporter{cfg: cfg, logger: logger}
+	if !cfg.Enabled {
+		return r, nil
+	}
+
+	switch cfg.Provider {
+	case "", ProviderSentry:
+		if dsn == "" {
+			return r, nil
+		}
+		sentry, err := newSentry(dsn, tracecontext.NewClient(&http.Client{}))
+		if err != nil {
+			return nil, err
+		}
+		r.send = sentry.send
+	case ProviderWebhook:
+		r.send = sendWebhook(sender, cfg.Endpoint)
+	default:
+		return nil, fmt.Errorf("unknown error reporting provider %q", cfg.Provider)
+	}
+
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+	r.events = make(chan *Event, size)
+	return r, nil
+}
+
+// Enabled reports whether events are sent anywhere
+func (r *Reporter) Enabled() bool {
+	return r.send != nil
+}
+
+// Run sends the events reported until ctx is cancelled, then those still
+// queued
+func (r *Reporter) Run(ctx context.Context) {
+	if !r.Enabled() {
+		return
+	}
+	for {
+		select {
+		case event := <-r.events:
+			r.deliver(event)
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-r.events:
+					r.deliver(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Reporter) deliver(event *Event) {
+	timeout := r.cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if event.traced {
+		ctx = tracecontext.NewContext(ctx, event.trace)
+	}
+
+	if err := r.send(ctx, event); err != nil {
+		r.logger.Warn("failed to report error", zap.String("event_id", event.ID), zap.Error(err))
+	}
+}
+
+// report queues event to be sent, dropping it when the queue is full
+func (r *Reporter) report(event *Event) {
+	if !r.Enabled() {
+		return
+	}
+	event.ID = newEventID()
+	event.Time = time.Now().UTC()
+	event.Environment = r.cfg.Environment
+	event.Release = r.cfg.Release
+
+	select {
+	case r.events <- event:
+	default:
+		r.logger.Warn("error report dropped, queue full", zap.String("message", event.Message))
+	}
+}
+
+// ignored reports whether server errors with status are not reported
+func (r *Reporter) ignored(status int) bool {
+	return slices.Contains(r.cfg.IgnoreStatuses, status)
+}
+
+// scope collects what handlers learn about a request for its report
+type scope struct {
+	mu     sync.Mutex
+	userID int64
+	trace  tracecontext.TraceContext
+	traced bool
+	err    error
+}
+
+type contextKey struct{}
+
+// SetUser records the user the request ctx belongs to was made by. It does
+// nothing outside of the middleware.
+func SetUser(ctx context.Context, userID int64) {
+	if s, ok := ctx.Value(contextKey{}).(*scope); ok {
+		s.mu.Lock()
+		s.userID = userID
+		s.mu.Unlock()
+	}
+}
+
+// CaptureError records err as the cause of the request ctx belongs to
+// failing, reported with its stack trace if the request is answered with a
+// server error. The first error captured is kept.
+func CaptureError(ctx context.Context, err error) {
+	s, ok := ctx.Value(contextKey{}).(*scope)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+		s.trace, s.traced = tracecontext.FromContext(ctx)
+	}
+}
+
+// Middleware recovers panics, answering with a 500 unless the response has
+// begun, and reports them, and the requests answered with a server error, in
+// the background. It must come after middleware.RequestID, middleware.RealIP
+// and requestlog.Middleware, so panics are logged with the request.
+func (r *Reporter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		s := &scope{}
+		ctx := context.WithValue(req.Context(), contextKey{}, s)
+		req = req.WithContext(ctx)
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				if rvr == http.ErrAbortHandler {
+					// The handler is aborting the response on purpose
+					panic(rvr)
+				}
+				stack := callers(3)
+				requestlog.FromContext(ctx, r.logger).Error("panic recovered",
+					zap.Any("panic", rvr),
+					zap.Stack("stack"),
+				)
+				if ww.Status() == 0 && req.Header.Get("Connection") != "Upgrade" {
+					apierror.Write(ww, req, http.StatusInternalServerError, "internal_error")
+				}
+
+				event := r.newEvent(req, ww, s)
+				event.Level = LevelFatal
+				event.Type = "panic"
+				event.Message = fmt.Sprint(rvr)
+				if err, ok := rvr.(error); ok {
+					event.Type = errorType(err)
+				}
+				event.Stack = panicFrames(stack)
+				event.Request.Status = http.StatusInternalServerError
+				r.report(event)
+				return
+			}
+
+			if ww.Status() < http.StatusInternalServerError || r.ignored(ww.Status()) {
+				return
+			}
+			event := r.newEvent(req, ww, s)
+			event.Level = LevelError
+			if err := s.captured(); err != nil {
+				event.Type = errorType(err)
+				event.Message = err.Error()
+				event.Stack = errorFrames(err)
+			} else {
+				event.Type = "server_error"
+				event.Message = fmt.Sprintf("%s %s answered with %d", req.Method, event.Request.Route, ww.Status())
+			}
+			r.report(event)
+		}()
+
+		next.ServeHTTP(ww, req)
+	})
+}
+
+func (s *scope) captured() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// newEvent returns the event of req, without its error
+func (r *Reporter) newEvent(req *http.Request, ww middleware.WrapResponseWriter, s *scope) *Event {
+	route := req.URL.Path
+	if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var traceID string
+	if s.traced {
+		traceID = s.trace.TraceIDString()
+	}
+	return &Event{
+		Request: Request{
+			Method:    req.Method,
+			URL:       req.URL.RequestURI(),
+			Route:     route,
+			Status:    ww.Status(),
+			RequestID: middleware.GetReqID(req.Context()),
+			TraceID:   traceID,
+			IP:        req.RemoteAddr,
+			UserAgent: req.UserAgent(),
+		},
+		UserID: s.userID,
+		trace:  s.trace,
+		traced: s.traced,
+	}
+}
+
+// errorType names the innermost error of err's chain after its type
+func errorType(err error) string {
+	for {
+		inner := errors.Unwrap(err)
+		if inner == nil {
+			return fmt.Sprintf("%T", err)
+		}
+		err = inner
+	}
+}
+
+// errorFrames returns the stack captured when err was first wrapped with
+// apperrors, if any
+func errorFrames(err error) []Frame {
+	var stacked interface{ StackTrace() []uintptr }
+	if !errors.As(err, &stacked) {
+		return nil
+	}
+	return frames(stacked.StackTrace())
+}
+
+// callers returns the stack of the caller, skipping skip frames
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	return pcs[:runtime.Callers(skip, pcs)]
+}
+
+// panicFrames returns the frames of a stack captured while recovering from a
+// panic, from the call that panicked on
+func panicFrames(pcs []uintptr) []Frame {
+	all := frames(pcs)
+	for i, f := range all {
+		if f.Function == "runtime.gopanic" {
+			return all[i+1:]
+		}
+	}
+	return all
+}
+
+func frames(pcs []uintptr) []Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	var out []Frame
+	it := runtime.CallersFrames(pcs)
+	for {
+		frame, more := it.Next()
+		out = append(out, Frame{Function: frame.Function, File: frame.File, Line: frame.Line})
+		if !more {
+			return out
+		}
+	}
+}
+
+// sendWebhook returns a sender posting events as signed JSON to endpoint
+func sendWebhook(sender *webhook.Sender, endpoint string) func(ctx context.Context, event *Event) error {
+	return func(ctx context.Context, event *Event) error {
+		return sender.Send(ctx, endpoint, WebhookEvent, event)
+	}
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return errors.New("error tracker answered with " + strconv.Itoa(resp.StatusCode))
+	}
+	return nil
+}
+
+// newEventID returns a random 32 digit hex ID, as Sentry expects
+func newEventID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// inApp reports whether function belongs to this module
+func inApp(function string) bool {
+	return strings.HasPrefix(function, "github.com/ndn/")
+}
@@ -0,0 +1,134 @@
+package errorreporting
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// sentryClient sends events to the store endpoint of a Sentry project
+type sentryClient struct {
+	endpoint string
+	auth     string
+	client   *http.Client
+}
+
+// newSentry parses dsn, of the form https://<key>@<host>[/<path>]/<project>
+func newSentry(dsn string, client *http.Client) (*sentryClient, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %w", err)
+	}
+	key := u.User.Username()
+	path, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		path, project = "/"+project[:i], project[i+1:]
+	}
+	if key == "" || u.Host == "" || project == "" {
+		return nil, fmt.Errorf("invalid sentry dsn: want https://<key>@<host>/<project>")
+	}
+
+	return &sentryClient{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path, project),
+		auth:     "Sentry sentry_version=7, sentry_client=ndn-api/1.0, sentry_key=" + key,
+		client:   client,
+	}, nil
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Exception   sentryExceptions  `json:"exception"`
+	Request     sentryRequest     `json:"request"`
+	User        *sentryUser       `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+type sentryUser struct {
+	ID        string `json:"id,omitempty"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+func (c *sentryClient) send(ctx context.Context, event *Event) error {
+	se := sentryEvent{
+		EventID:     event.ID,
+		Timestamp:   event.Time.Format("2006-01-02T15:04:05.000Z"),
+		Level:       event.Level,
+		Platform:    "go",
+		Environment: event.Environment,
+		Release:     event.Release,
+		Transaction: event.Request.Method + " " + event.Request.Route,
+		Exception: sentryExceptions{Values: []sentryException{{
+			Type:  event.Type,
+			Value: event.Message,
+		}}},
+		Request: sentryRequest{
+			Method: event.Request.Method,
+			URL:    event.Request.URL,
+		},
+		Tags: map[string]string{
+			"status": strconv.Itoa(event.Request.Status),
+		},
+	}
+	if event.Request.UserAgent != "" {
+		se.Request.Headers = map[string]string{"User-Agent": event.Request.UserAgent}
+	}
+	if event.Request.RequestID != "" {
+		se.Tags["request_id"] = event.Request.RequestID
+	}
+	if event.Request.TraceID != "" {
+		se.Tags["trace_id"] = event.Request.TraceID
+	}
+	if event.UserID != 0 || event.Request.IP != "" {
+		se.User = &sentryUser{IPAddress: event.Request.IP}
+		if event.UserID != 0 {
+			se.User.ID = strconv.FormatInt(event.UserID, 10)
+		}
+	}
+
+	// Sentry lists frames outermost first
+	if n := len(event.Stack); n > 0 {
+		st := &sentryStacktrace{Frames: make([]sentryFrame, n)}
+		for i, f := range event.Stack {
+			st.Frames[n-1-i] = sentryFrame{Function: f.Function, AbsPath: f.File, Lineno: f.Line, InApp: inApp(f.Function)}
+		}
+		se.Exception.Values[0].Stacktrace = st
+	}
+
+	return postJSON(ctx, c.client, c.endpoint, http.Header{"X-Sentry-Auth": {c.auth}}, se)
+}
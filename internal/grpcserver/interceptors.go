@@ -0,0 +1,152 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"strings"
+
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/services"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type interceptors struct {
+	auth *services.AuthService
+	// allowedClients are the client certificate names accepted, any
+	// when empty
+	allowedClients map[string]bool
+	logger         *zap.Logger
+}
+
+// authenticate admits calls from clients presenting a certificate signed
+// by the client CA, which are trusted services, and calls carrying a valid
+// bearer token, which act as its user
+func (i *interceptors) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if cert, ok := clientCertificate(ctx); ok {
+		if !i.allowed(cert.Subject.CommonName, cert.DNSNames) {
+			return nil, status.Errorf(codes.PermissionDenied, "client certificate %q is not allowed", cert.Subject.CommonName)
+		}
+		return handler(ctx, req)
+	}
+
+	token := bearerToken(ctx)
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, "missing client certificate or bearer token")
+	}
+	userID, err := i.auth.ValidateToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) {
+			return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+		}
+		return nil, err
+	}
+	suspended, err := i.auth.IsSuspended(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if suspended {
+		return nil, status.Error(codes.PermissionDenied, "account suspended")
+	}
+	return handler(services.ContextWithUserID(ctx, userID), req)
+}
+
+func (i *interceptors) allowed(commonName string, dnsNames []string) bool {
+	if len(i.allowedClients) == 0 || i.allowedClients[commonName] {
+		return true
+	}
+	for _, name := range dnsNames {
+		if i.allowedClients[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// mapErrors turns the errors of services into gRPC statuses, logging the
+// unexpected ones
+func (i *interceptors) mapErrors(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return nil, err
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, notFoundMessage(err))
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil, status.FromContextError(err).Err()
+	}
+	var filterErr *services.MovieFilterError
+	if errors.As(err, &filterErr) {
+		return nil, status.Error(codes.InvalidArgument, filterErr.Error())
+	}
+
+	i.logger.Error("gRPC request failed", append(apperrors.Fields(err), zap.String("method", info.FullMethod))...)
+	return nil, status.Error(codes.Internal, "internal error")
+}
+
+// notFoundMessage returns what err says was not found, such as "movie not
+// found", without the operations it passed through
+func notFoundMessage(err error) string {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if errors.Unwrap(e) == database.ErrNotFound {
+			return e.Error()
+		}
+	}
+	return database.ErrNotFound.Error()
+}
+
+// recoverPanics turns panics into internal errors instead of crashing the
+// server
+func (i *interceptors) recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			i.logger.Error("gRPC request panicked", zap.String("method", info.FullMethod), zap.Any("panic", p), zap.Stack("stack"))
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// clientCertificate returns the certificate the client presented, verified
+// against the client CA
+func clientCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return tlsInfo.State.VerifiedChains[0][0], true
+}
+
+// bearerToken returns the token of the "authorization: Bearer <token>"
+// metadata of the call
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	for _, value := range md.Get("authorization") {
+		scheme, token, found := strings.Cut(value, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
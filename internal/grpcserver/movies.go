@@ -0,0 +1,93 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	ndnv1 "github.com/ndn/proto/ndn/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxPageSize caps the page size of ListMovies
+const maxPageSize = 100
+
+type movieServer struct {
+	ndnv1.UnimplementedMovieServiceServer
+	movies *services.MovieService
+}
+
+func (s *movieServer) GetMovie(ctx context.Context, req *ndnv1.GetMovieRequest) (*ndnv1.GetMovieResponse, error) {
+	if req.GetId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "id must be positive")
+	}
+
+	movie, err := s.movies.GetMovie(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &ndnv1.GetMovieResponse{Movie: movieMessage(movie)}, nil
+}
+
+func (s *movieServer) ListMovies(ctx context.Context, req *ndnv1.ListMoviesRequest) (*ndnv1.ListMoviesResponse, error) {
+	if req.GetPage() < 0 || req.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page and page_size must not be negative")
+	}
+
+	filter := services.MovieFilter{
+		Search:     req.GetSearch(),
+		SortBy:     req.GetSortBy(),
+		Categories: req.GetCategories(),
+		Page:       int(req.GetPage()),
+		PageSize:   min(int(req.GetPageSize()), maxPageSize),
+	}
+	if req.GetYear() != 0 {
+		year := int(req.GetYear())
+		filter.Year = &year
+	}
+
+	movies, total, err := s.movies.GetMovies(ctx, filter, services.MovieRelations{})
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ndnv1.ListMoviesResponse{
+		Movies: make([]*ndnv1.Movie, len(movies)),
+		Total:  int32(total),
+	}
+	for i := range movies {
+		response.Movies[i] = movieMessage(&movies[i])
+	}
+	return response, nil
+}
+
+func movieMessage(movie *models.Movie) *ndnv1.Movie {
+	return &ndnv1.Movie{
+		Id:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    int32(movie.ReleaseYear),
+		Duration:       int32(movie.Duration),
+		PosterUrl:      movie.PosterURL,
+		VideoUrl:       movie.VideoURL,
+		Categories:     movie.Categories,
+		Rating:         movie.Rating,
+		RatingCount:    int32(movie.RatingCount),
+		Status:         movie.Status,
+		AvailableFrom:  timestamp(movie.AvailableFrom),
+		AvailableUntil: timestamp(movie.AvailableUntil),
+		CreatedAt:      timestamppb.New(movie.CreatedAt),
+		UpdatedAt:      timestamppb.New(movie.UpdatedAt),
+	}
+}
+
+// timestamp converts an optional time, leaving the field unset when nil
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,126 @@
+// Package grpcserver serves the movie and user services of proto/ndn/v1
+// over gRPC, for internal services consuming the catalog without going
+// through the HTTP API.
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/services"
+	ndnv1 "github.com/ndn/proto/ndn/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Server is the gRPC server, listening on its own port
+type Server struct {
+	server *grpc.Server
+	port   string
+	logger *zap.Logger
+}
+
+// New returns the gRPC server configured by cfg, or nil when it is disabled
+func New(cfg config.GRPCConfig, movies *services.MovieService, users *services.UserService, auth *services.AuthService, logger *zap.Logger) (*Server, error) {
+	if cfg.Port == "" {
+		return nil, nil
+	}
+
+	creds, err := transportCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.CertFile == "" {
+		logger.Warn("gRPC server is not using TLS; bearer tokens are sent in plain text")
+	}
+
+	interceptors := &interceptors{
+		auth:           auth,
+		allowedClients: make(map[string]bool, len(cfg.AllowedClients)),
+		logger:         logger,
+	}
+	for _, name := range cfg.AllowedClients {
+		interceptors.allowedClients[name] = true
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(creds),
+		grpc.ChainUnaryInterceptor(interceptors.recoverPanics, interceptors.mapErrors, interceptors.authenticate),
+	)
+	ndnv1.RegisterMovieServiceServer(server, &movieServer{movies: movies})
+	ndnv1.RegisterUserServiceServer(server, &userServer{users: users, auth: auth})
+
+	return &Server{server: server, port: cfg.Port, logger: logger}, nil
+}
+
+// transportCredentials serves over TLS when a certificate is configured,
+// verifying the certificates clients present against the client CA
+func transportCredentials(cfg config.GRPCConfig) (credentials.TransportCredentials, error) {
+	if cfg.CertFile == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load gRPC certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gRPC client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in gRPC client CA %s", cfg.ClientCAFile)
+		}
+		// Clients without a certificate authenticate with a bearer token
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Serve accepts connections until Shutdown
+func (s *Server) Serve() error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", s.port))
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC: %w", err)
+	}
+
+	s.logger.Info("gRPC server starting", zap.String("port", s.port))
+	if err := s.server.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown stops accepting connections and waits for pending calls to
+// finish, cancelling them once ctx is done
+func (s *Server) Shutdown(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.server.Stop()
+		<-stopped
+	}
+}
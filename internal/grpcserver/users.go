@@ -0,0 +1,54 @@
+package grpcserver
+
+import (
+	"context"
+
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	ndnv1 "github.com/ndn/proto/ndn/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type userServer struct {
+	ndnv1.UnimplementedUserServiceServer
+	users *services.UserService
+	auth  *services.AuthService
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *ndnv1.GetUserRequest) (*ndnv1.GetUserResponse, error) {
+	if req.GetId() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "id must be positive")
+	}
+
+	// Services authenticated by certificate have no user and may look up
+	// anyone; users only themselves, unless they are admins
+	if userID := services.UserIDFromContext(ctx); userID != 0 && userID != req.GetId() {
+		isAdmin, err := s.auth.IsAdmin(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if !isAdmin {
+			return nil, status.Error(codes.PermissionDenied, "admin access required")
+		}
+	}
+
+	user, err := s.users.GetUser(ctx, req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return &ndnv1.GetUserResponse{User: userMessage(user)}, nil
+}
+
+func userMessage(user *models.User) *ndnv1.User {
+	return &ndnv1.User{
+		Id:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      user.Role,
+		IsAdmin:   user.IsAdmin,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	}
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// maxEventsBodySize bounds an ingestion request body
+const maxEventsBodySize = 256 << 10
+
+type AnalyticsHandler struct {
+	analyticsService *services.AnalyticsService
+	exportService    *services.ExportService
+	logger           *zap.Logger
+}
+
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService, exportService *services.ExportService, logger *zap.Logger) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsService: analyticsService,
+		exportService:    exportService,
+		logger:           logger,
+	}
+}
+
+type AnalyticsEventRequest struct {
+	Type            string     `json:"type" example:"play_start" enums:"impression,play_start,heartbeat,progress,pause,complete,search,search_click,recommendation_click"`
+	MovieID         int64      `json:"movie_id,omitempty" example:"42"`
+	SessionID       string     `json:"session_id,omitempty" example:"b7f1c2"`
+	PositionSeconds *int       `json:"position_seconds,omitempty" example:"120"`
+	Query           string     `json:"query,omitempty" example:"star wars"`
+	Reason          string     `json:"reason,omitempty" example:"because_you_watched"`
+	OccurredAt      *time.Time `json:"occurred_at,omitempty"`
+}
+
+type AnalyticsEventsRequest struct {
+	Events []AnalyticsEventRequest `json:"events"`
+}
+
+type AnalyticsEventsResponse struct {
+	Accepted int `json:"accepted" example:"25"`
+}
+
+// IngestEvents godoc
+// @Summary Ingest client analytics events
+// @Description Accept a batch of up to 100 client events (impression, play_start, heartbeat or its other name progress, pause, complete, search, search_click, recommendation_click). The batch is validated as a whole and written asynchronously. Every event but search requires movie_id. heartbeat, pause and complete require position_seconds, search and search_click require query and recommendation_click requires reason, the code of the recommendation reason the title was shown with, which impression and play_start may also carry. occurred_at defaults to the time of receipt. A bearer token is optional and attributes the events to the user.
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param request body AnalyticsEventsRequest true "Events"
+// @Success 202 {object} AnalyticsEventsResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Router /analytics/events [post]
+func (h *AnalyticsHandler) IngestEvents(w http.ResponseWriter, r *http.Request) {
+	var req AnalyticsEventsRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEventsBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	events := make([]*models.AnalyticsEvent, len(req.Events))
+	for i, e := range req.Events {
+		events[i] = &models.AnalyticsEvent{
+			Type:            e.Type,
+			MovieID:         e.MovieID,
+			SessionID:       e.SessionID,
+			PositionSeconds: e.PositionSeconds,
+			Query:           e.Query,
+			Reason:          e.Reason,
+		}
+		if e.OccurredAt != nil {
+			events[i].OccurredAt = *e.OccurredAt
+		}
+	}
+
+	userID := services.UserIDFromContext(r.Context())
+	if err := h.analyticsService.Ingest(r.Context(), userID, events); err != nil {
+		var eventErr *services.EventError
+		switch {
+		case errors.Is(err, services.ErrNoEvents):
+			sendError(w, r, CodeEventsRequired, http.StatusBadRequest)
+		case errors.Is(err, services.ErrTooManyEvents):
+			sendError(w, r, CodeTooManyEvents, http.StatusBadRequest, "max", services.MaxEventsPerBatch)
+		case errors.As(err, &eventErr):
+			sendError(w, r, CodeInvalidEvent, http.StatusUnprocessableEntity, "index", eventErr.Index, "detail", eventErr.Err)
+		case errors.Is(err, services.ErrIngestBacklog):
+			w.Header().Set("Retry-After", "5")
+			sendError(w, r, CodeIngestionOverloaded, http.StatusServiceUnavailable)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(AnalyticsEventsResponse{Accepted: len(events)})
+}
+
+// ActiveUsers godoc
+// @Summary Get daily and monthly active users
+// @Description Get DAU and trailing 30-day MAU for each day of the period, the average DAU, the MAU at the end of the period and stickiness (average DAU/MAU). A user is active on a day they reported any analytics event.
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.ActiveUsersReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/active-users [get]
+func (h *AnalyticsHandler) ActiveUsers(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.ActiveUsers(r.Context(), p)
+	})
+}
+
+// SignupFunnel godoc
+// @Summary Get the signup funnel
+// @Description Follow users who signed up during the period through being active, starting a title, completing a title and returning on a second day, with the conversion from each step to the next
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.SignupFunnelReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/signups [get]
+func (h *AnalyticsHandler) SignupFunnel(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.SignupFunnel(r.Context(), p)
+	})
+}
+
+// Retention godoc
+// @Summary Get retention cohorts
+// @Description Group users who signed up during the period into weekly cohorts and report how many of each cohort were active in every week since, up to the current week
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.RetentionReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/retention [get]
+func (h *AnalyticsHandler) Retention(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.Retention(r.Context(), p)
+	})
+}
+
+// WatchTime godoc
+// @Summary Get total watch time
+// @Description Get total views, completions and watch time over the period, overall and per day
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.WatchTimeReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/watch-time [get]
+func (h *AnalyticsHandler) WatchTime(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.WatchTime(r.Context(), p)
+	})
+}
+
+// TopTitles godoc
+// @Summary Get top titles
+// @Description Rank movies over the period by views, distinct viewers, completions or watch time
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Param metric query string false "Ranking metric: views, viewers, completions or watch_time (default: views)"
+// @Param limit query int false "Number of titles, at most 100 (default: 10)"
+// @Success 200 {object} services.TopTitlesReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/top-titles [get]
+func (h *AnalyticsHandler) TopTitles(w http.ResponseWriter, r *http.Request) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "views"
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.TopTitles(r.Context(), p, metric, limit)
+	})
+}
+
+// MovieEngagement godoc
+// @Summary Get engagement with a movie
+// @Description Get the drop-off curve (share of viewers still watching at each minute), average watch time per viewer, completion rate and rewatch rate of a movie over the period, computed from playback heartbeats. Raw events are only kept for the configured retention, so older periods are incomplete.
+// @Tags analytics
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.MovieEngagementReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/engagement [get]
+func (h *AnalyticsHandler) MovieEngagement(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.MovieEngagement(r.Context(), id, p)
+	})
+}
+
+// RecommendationReasons godoc
+// @Summary Get clicks per recommendation reason
+// @Description Count impressions, clicks and plays of recommended titles per recommendation reason over the period, from raw events, so only periods within raw event retention are covered
+// @Tags analytics
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: days before to)"
+// @Param to query string false "Last day, YYYY-MM-DD (default: today)"
+// @Param days query int false "Length of the period when from is not given (default: 30)"
+// @Success 200 {object} services.RecommendationReasonsReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/recommendation-reasons [get]
+func (h *AnalyticsHandler) RecommendationReasons(w http.ResponseWriter, r *http.Request) {
+	h.report(w, r, func(p services.Period) (interface{}, error) {
+		return h.analyticsService.RecommendationReasons(r.Context(), p)
+	})
+}
+
+// GetUserStats godoc
+// @Summary Get personal viewing statistics
+// @Description Get the authenticated user's watch time, titles watched and completed, active days, favorite genres and longest streak over a calendar month or year, plus their current streak, for a year in review. Viewing is counted once the day it happened on has been rolled up.
+// @Tags users
+// @Produce json
+// @Param period query string false "month or year (default: year)"
+// @Param year query int false "Year (default: this year)"
+// @Param month query int false "Month, 1-12, when period is month (default: this month)"
+// @Success 200 {object} services.ViewingStats
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/stats [get]
+func (h *AnalyticsHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	period, err := parseViewingPeriod(r, time.Now().UTC())
+	if err != nil {
+		sendError(w, r, CodeInvalidViewingPeriod, http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.analyticsService.UserStats(r.Context(), services.UserIDFromContext(r.Context()), period)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+type BackfillExportRequest struct {
+	From string `json:"from" example:"2024-01-01"`
+}
+
+// ListExports godoc
+// @Summary List warehouse export checkpoints
+// @Description Get, for every configured export sink, the ID of the last analytics event and the last daily rollup exported to it
+// @Tags analytics
+// @Produce json
+// @Success 200 {array} models.ExportCheckpoint
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/exports [get]
+func (h *AnalyticsHandler) ListExports(w http.ResponseWriter, r *http.Request) {
+	checkpoints, err := h.exportService.Checkpoints(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkpoints)
+}
+
+// BackfillExport godoc
+// @Summary Backfill a warehouse export
+// @Description Rewind an export sink so events that occurred and daily rollups from the given day on are exported again on its next run. Raw events already pruned by retention are not re-exported; rows are deduplicated by the warehouse where it supports it.
+// @Tags analytics
+// @Accept json
+// @Produce json
+// @Param sink path string true "Sink name"
+// @Param request body BackfillExportRequest true "First day to export again"
+// @Success 200 {object} models.ExportCheckpoint
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/analytics/exports/{sink}/backfill [post]
+func (h *AnalyticsHandler) BackfillExport(w http.ResponseWriter, r *http.Request) {
+	var req BackfillExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	from, err := time.Parse("2006-01-02", req.From)
+	if err != nil {
+		sendError(w, r, CodeInvalidFrom, http.StatusBadRequest)
+		return
+	}
+
+	checkpoint, err := h.exportService.Backfill(r.Context(), chi.URLParam(r, "sink"), from)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownSink):
+			sendError(w, r, CodeExportSinkNotFound, http.StatusNotFound)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checkpoint)
+}
+
+// report parses the requested period, runs build and writes its result
+func (h *AnalyticsHandler) report(w http.ResponseWriter, r *http.Request, build func(services.Period) (interface{}, error)) {
+	period, err := parsePeriod(r, time.Now())
+	if err != nil {
+		sendError(w, r, CodeInvalidPeriod, http.StatusBadRequest, "max", services.MaxReportDays)
+		return
+	}
+
+	report, err := build(period)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidMetric):
+			sendError(w, r, CodeInvalidMetric, http.StatusBadRequest)
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// parsePeriod reads the from, to and days query parameters. to defaults to
+// today and from to days (default 30) before to.
+func parsePeriod(r *http.Request, now time.Time) (services.Period, error) {
+	query := r.URL.Query()
+
+	to := now
+	if s := query.Get("to"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		to = t
+	}
+
+	days := 30
+	if s := query.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return services.Period{}, services.ErrInvalidPeriod
+		}
+		days = n
+	}
+	from := to.AddDate(0, 0, -(days - 1))
+	if s := query.Get("from"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		from = t
+	}
+
+	return services.NewPeriod(from, to)
+}
+
+// parseViewingPeriod reads the period, year and month query parameters,
+// defaulting to the current year, or month when period is month
+func parseViewingPeriod(r *http.Request, now time.Time) (services.Period, error) {
+	query := r.URL.Query()
+
+	kind := query.Get("period")
+	if kind == "" {
+		kind = services.ViewingPeriodYear
+	}
+	year, month := now.Year(), int(now.Month())
+	if s := query.Get("year"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		year = n
+	}
+	if s := query.Get("month"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		month = n
+	}
+
+	return services.ViewingPeriod(kind, year, month)
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader carries the partner API key on metered requests
+const APIKeyHeader = "X-API-Key"
+
+type APIKeyHandler struct {
+	apiKeyService *services.APIKeyService
+	logger        *zap.Logger
+}
+
+func NewAPIKeyHandler(apiKeyService *services.APIKeyService, logger *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyService: apiKeyService,
+		logger:        logger,
+	}
+}
+
+type CreateAPIKeyRequest struct {
+	Name         string `json:"name" example:"Acme partner integration"`
+	DailyQuota   int    `json:"daily_quota" example:"10000"`
+	MonthlyQuota int    `json:"monthly_quota" example:"250000"`
+}
+
+type APIKeyResponse struct {
+	ID           int64      `json:"id" example:"1"`
+	Name         string     `json:"name" example:"Acme partner integration"`
+	Prefix       string     `json:"prefix" example:"ndn_1a2b3c4d"`
+	DailyQuota   int        `json:"daily_quota" example:"10000"`
+	MonthlyQuota int        `json:"monthly_quota" example:"250000"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key" example:"ndn_1a2b3c4d5e6f..."`
+	// SigningSecret signs the mutations made with the key
+	SigningSecret string `json:"signing_secret" example:"9f86d081884c7d65..."`
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Issue a new partner API key with optional daily and monthly request quotas (0 means unlimited). The key and its signing secret are only returned once. Mutations made with the key carry X-Request-Timestamp, X-Request-Nonce and X-Request-Signature, the hex HMAC-SHA256 under the signing secret of "<timestamp>.<nonce>.<METHOD>.<path and query>.<hex SHA-256 of the body>".
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "API key details"
+// @Success 201 {object} CreateAPIKeyResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	key, raw, err := h.apiKeyService.CreateAPIKey(r.Context(), req.Name, req.DailyQuota, req.MonthlyQuota)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyNameRequired):
+			sendError(w, r, CodeAPIKeyNameRequired, http.StatusBadRequest)
+		case errors.Is(err, services.ErrInvalidQuota):
+			sendError(w, r, CodeNegativeQuota, http.StatusBadRequest)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := CreateAPIKeyResponse{
+		APIKeyResponse: APIKeyResponse{
+			ID:           key.ID,
+			Name:         key.Name,
+			Prefix:       key.Prefix,
+			DailyQuota:   key.DailyQuota,
+			MonthlyQuota: key.MonthlyQuota,
+			RevokedAt:    key.RevokedAt,
+			CreatedAt:    key.CreatedAt,
+		},
+		Key:           raw,
+		SigningSecret: key.SigningSecret,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description Get all partner API keys, including revoked ones
+// @Tags api-keys
+// @Produce json
+// @Success 200 {array} APIKeyResponse
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys [get]
+func (h *APIKeyHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.ListAPIKeys(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]APIKeyResponse, len(keys))
+	for i, key := range keys {
+		response[i] = APIKeyResponse{
+			ID:           key.ID,
+			Name:         key.Name,
+			Prefix:       key.Prefix,
+			DailyQuota:   key.DailyQuota,
+			MonthlyQuota: key.MonthlyQuota,
+			RevokedAt:    key.RevokedAt,
+			CreatedAt:    key.CreatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key so it can no longer be used
+// @Tags api-keys
+// @Param id path int true "API key ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidAPIKeyID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.apiKeyService.RevokeAPIKey(r.Context(), id); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeAPIKeyNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUsage godoc
+// @Summary Get API key usage
+// @Description Get the current daily and monthly quota usage of an API key and its per-day request counts for the last 30 days
+// @Tags api-keys
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} services.APIKeyUsageReport
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/api-keys/{id}/usage [get]
+func (h *APIKeyHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidAPIKeyID, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.apiKeyService.GetUsage(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeAPIKeyNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// QuotaMiddleware meters requests that carry an API key. Requests without
+// the X-API-Key header pass through untouched; an unknown or revoked key is
+// rejected with 401 and an exhausted quota with 429.
+func (h *APIKeyHandler) QuotaMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw := r.Header.Get(APIKeyHeader)
+		if raw == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, quota, err := h.apiKeyService.Consume(r.Context(), raw)
+		if quota.Limit > 0 {
+			w.Header().Set("X-Quota-Limit", strconv.Itoa(quota.Limit))
+			w.Header().Set("X-Quota-Remaining", strconv.FormatInt(quota.Remaining, 10))
+			w.Header().Set("X-Quota-Reset", strconv.FormatInt(quota.ResetsAt.Unix(), 10))
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrInvalidAPIKey):
+				sendError(w, r, CodeInvalidAPIKey, http.StatusUnauthorized)
+			case errors.Is(err, services.ErrQuotaExceeded):
+				retryAfter := int(time.Until(quota.ResetsAt).Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				sendError(w, r, CodeAPIKeyQuotaExceeded, http.StatusTooManyRequests)
+			default:
+				logError(h.logger, r, err)
+				sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx := services.ContextWithAPIKeyID(r.Context(), key.ID)
+		ctx = services.ContextWithAPIKeySigningSecret(ctx, key.SigningSecret)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
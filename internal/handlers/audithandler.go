@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/ndn/internal/dryrun"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+// maxAuditBody is the largest request body recorded in the audit log
+const maxAuditBody = 64 << 10
+
+type AuditHandler struct {
+	auditService *services.AuditService
+	logger       *zap.Logger
+}
+
+func NewAuditHandler(auditService *services.AuditService, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{
+		auditService: auditService,
+		logger:       logger,
+	}
+}
+
+// PaginatedAuditLogResponse is a page of the audit log
+type PaginatedAuditLogResponse struct {
+	Entries []models.AuditEntry `json:"entries"`
+	Total   int                 `json:"total"`
+	Page    int                 `json:"page"`
+}
+
+// Middleware records every successful mutation of the routes it wraps in the
+// audit log, with the client address and request ID. Services describing
+// their changes record them themselves, with the fields they changed; the
+// other requests are recorded here once answered, with their JSON body,
+// passwords and secrets left out, standing in for what changed. Dry runs
+// are not recorded.
+func (h *AuditHandler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := services.ContextWithAuditRequest(r.Context(), clientIP(r), middleware.GetReqID(r.Context()))
+		r = r.WithContext(ctx)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if dryrun.FromContext(ctx) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body := auditBody(r)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() >= http.StatusBadRequest || services.AuditRecorded(ctx) {
+			return
+		}
+
+		pattern := chi.RouteContext(ctx).RoutePattern()
+		entry := &models.AuditEntry{
+			Action:     strings.ToLower(r.Method),
+			EntityType: auditEntity(pattern),
+			Route:      r.Method + " " + pattern,
+			After:      body,
+		}
+		if id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64); err == nil {
+			entry.EntityID = id
+		}
+		if err := h.auditService.Record(ctx, entry); err != nil {
+			logError(h.logger, r, err)
+		}
+	})
+}
+
+// auditBody returns the fields of the JSON object r carries, if it is small
+// enough to record, with those holding passwords, secrets, tokens or PINs
+// redacted. The body is left for the handler to read.
+func auditBody(r *http.Request) map[string]interface{} {
+	if r.Body == nil || !strings.Contains(r.Header.Get("Content-Type"), "json") {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), r.Body))
+	if err != nil || len(data) > maxAuditBody {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	for key := range fields {
+		lower := strings.ToLower(key)
+		if lower == "pin" || strings.Contains(lower, "password") || strings.Contains(lower, "secret") || strings.Contains(lower, "token") {
+			fields[key] = "[redacted]"
+		}
+	}
+	return fields
+}
+
+// auditEntity names the entities of the admin route pattern after its first
+// segment under /admin in the singular, as services name them, e.g. movie
+// for /api/admin/movies/{id}/video and api_key for /api/admin/api-keys
+func auditEntity(pattern string) string {
+	_, rest, found := strings.Cut(pattern, "/admin/")
+	if !found {
+		return "admin"
+	}
+	entity, _, _ := strings.Cut(rest, "/")
+	entity = strings.ReplaceAll(entity, "-", "_")
+
+	switch {
+	case entity == "series" || entity == "analytics":
+		return entity
+	case strings.HasSuffix(entity, "ies"):
+		return strings.TrimSuffix(entity, "ies") + "y"
+	case strings.HasSuffix(entity, "s") && !strings.HasSuffix(entity, "ss"):
+		return strings.TrimSuffix(entity, "s")
+	}
+	return entity
+}
+
+// ListAuditLogs godoc
+// @Summary List the audit log
+// @Description Get a page of the mutations made by admins, newest first, with who made them, from which address and request, and the fields they changed. Changes services describe carry the values of the changed fields before and after; other requests carry their JSON body, passwords and secrets redacted, as after.
+// @Tags audit
+// @Produce json
+// @Param user_id query int false "Only changes made by this user"
+// @Param entity_type query string false "Only changes of this type of entity, e.g. movie, collection or plan"
+// @Param entity_id query int false "Only changes of the entity with this ID"
+// @Param action query string false "Only changes with this action, e.g. update_boost or post"
+// @Param from query string false "Only changes made at or after this time, RFC 3339 or YYYY-MM-DD"
+// @Param to query string false "Only changes made before this time, RFC 3339 or YYYY-MM-DD"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 50, max: 200)"
+// @Success 200 {object} PaginatedAuditLogResponse
+// @Failure 400 {object} apierror.Problem "Invalid filter"
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/audit-logs [get]
+func (h *AuditHandler) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	filter, param, err := parseAuditLogFilter(r)
+	if err != nil {
+		sendError(w, r, CodeInvalidAuditFilter, http.StatusBadRequest, "param", param)
+		return
+	}
+
+	entries, total, err := h.auditService.ListAuditLogs(r.Context(), filter)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PaginatedAuditLogResponse{
+		Entries: entries,
+		Total:   total,
+		Page:    filter.Page,
+	})
+}
+
+// parseAuditLogFilter reads the filter and page query parameters of
+// ListAuditLogs. On failure it returns the name of the invalid parameter.
+func parseAuditLogFilter(r *http.Request) (services.AuditLogFilter, string, error) {
+	query := r.URL.Query()
+	filter := services.AuditLogFilter{
+		EntityType: strings.TrimSpace(query.Get("entity_type")),
+		Action:     strings.TrimSpace(query.Get("action")),
+		Page:       1,
+	}
+
+	for _, p := range []struct {
+		name string
+		id   *int64
+	}{
+		{"user_id", &filter.ActorID},
+		{"entity_id", &filter.EntityID},
+	} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id <= 0 {
+			return filter, p.name, strconv.ErrSyntax
+		}
+		*p.id = id
+	}
+	for _, p := range []struct {
+		name string
+		time **time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return filter, p.name, err
+			}
+		}
+		*p.time = &t
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(query.Get("page_size")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+	return filter, "", nil
+}
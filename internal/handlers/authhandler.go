@@ -2,39 +2,119 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/errorreporting"
+	"github.com/ndn/internal/requestlog"
 	"github.com/ndn/internal/services"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.uber.org/zap"
 )
 
 type AuthHandler struct {
 	authService *services.AuthService
+	logger      *zap.Logger
 }
 
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
+func NewAuthHandler(authService *services.AuthService, logger *zap.Logger) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		logger:      logger,
 	}
 }
 
+// LoginRequest does not enforce the password length, so passwords set before
+// it was enforced at registration keep working
 type LoginRequest struct {
 	Email    string `json:"email" example:"user@example.com" validate:"required,email"`
-	Password string `json:"password" example:"password123" validate:"required,min=8"`
+	Password string `json:"password" example:"password123" validate:"required"`
 }
 
+// RegisterRequest leaves the password length to the password policy
 type RegisterRequest struct {
 	Email    string `json:"email" example:"user@example.com" validate:"required,email"`
-	Password string `json:"password" example:"password123" validate:"required,min=8"`
+	Password string `json:"password" example:"password123" validate:"required"`
 	Name     string `json:"name" example:"John Doe" validate:"required"`
 }
 
+// RefreshRequest carries the refresh token to exchange
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// LogoutRequest carries the refresh token of the session to end, which may
+// be left out when the access token to revoke is sent instead. With
+// AllSessions every session of the user is ended.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	AllSessions  bool   `json:"all_sessions,omitempty" example:"false"`
+}
+
+// ForgotPasswordRequest carries the email address of the account whose
+// password was forgotten
+type ForgotPasswordRequest struct {
+	Email string `json:"email" example:"user@example.com"`
+}
+
+// ResetPasswordRequest carries the token from a password reset email and
+// the new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+	Password string `json:"password" example:"newpassword123"`
+}
+
+// ChangePasswordRequest carries the user's current password and the new
+// one, whose length is left to the password policy
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" example:"password123" validate:"required"`
+	NewPassword     string `json:"new_password" example:"newpassword123" validate:"required"`
+}
+
+// ChangeEmailRequest carries the email address the user wants instead of
+// their current one
+type ChangeEmailRequest struct {
+	Email string `json:"email" example:"new@example.com" validate:"required,email"`
+}
+
+// ConfirmEmailRequest carries the token from an email change confirmation
+type ConfirmEmailRequest struct {
+	Token string `json:"token" example:"2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"`
+}
+
+// PasswordPolicyProblem is the problem of passwords lacking character
+// classes the password policy requires, listed in Missing
+type PasswordPolicyProblem struct {
+	*apierror.Problem
+	Missing []string `json:"missing" example:"uppercase,digit"`
+}
+
+// LoginBlockedProblem is the problem of logins refused after too many
+// failures, which may be tried again after RetryAfter seconds
+type LoginBlockedProblem struct {
+	*apierror.Problem
+	RetryAfter int `json:"retry_after" example:"30"`
+}
+
 type AuthResponse struct {
-	Token     string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
-	ExpiresIn int64  `json:"expires_in" example:"3600"`
-	UserID    int64  `json:"user_id" example:"1"`
-	Name      string `json:"name" example:"John Doe"`
-	Email     string `json:"email" example:"user@example.com"`
-	IsAdmin   bool   `json:"is_admin" example:"false"`
+	Token            string `json:"token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	ExpiresIn        int64  `json:"expires_in" example:"900"`
+	RefreshToken     string `json:"refresh_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in" example:"2592000"`
+	UserID           int64  `json:"user_id" example:"1"`
+	Name             string `json:"name" example:"John Doe"`
+	Email            string `json:"email" example:"user@example.com"`
+	IsAdmin          bool   `json:"is_admin" example:"false"`
+	ProfileID        int64  `json:"profile_id,omitempty" example:"3"` // the tokens act as, if any
 }
 
 // Register godoc
@@ -45,38 +125,35 @@ type AuthResponse struct {
 // @Produce json
 // @Param request body RegisterRequest true "Register request"
 // @Success 201 {object} AuthResponse
-// @Failure 400 {object} ErrorResponse "Invalid request parameters"
-// @Failure 409 {object} ErrorResponse "Email already exists"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} PasswordPolicyProblem "Invalid request parameters, or a password the password policy rejects"
+// @Failure 409 {object} apierror.Problem "Email already exists"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate request
-	if req.Email == "" || req.Password == "" || req.Name == "" {
-		h.sendError(w, "Email, password, and name are required", http.StatusBadRequest)
+	if !DecodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// Check if user exists
 	exists, err := h.authService.UserExists(r.Context(), req.Email)
 	if err != nil {
-		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 	if exists {
-		h.sendError(w, "Email already registered", http.StatusConflict)
+		sendError(w, r, CodeEmailTaken, http.StatusConflict)
 		return
 	}
 
 	// Register user
-	authResp, err := h.authService.Register(r.Context(), req.Email, req.Password, req.Name)
+	authResp, err := h.authService.Register(r.Context(), req.Email, req.Password, req.Name, r.UserAgent())
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		if !sendPasswordError(w, r, h.authService.PasswordPolicy(), err) {
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -92,31 +169,34 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param request body LoginRequest true "Login request"
 // @Success 200 {object} AuthResponse
-// @Failure 400 {object} ErrorResponse "Invalid request parameters"
-// @Failure 401 {object} ErrorResponse "Invalid credentials"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters"
+// @Failure 401 {object} apierror.Problem "Invalid credentials"
+// @Failure 403 {object} apierror.Problem "Account suspended"
+// @Failure 423 {object} LoginBlockedProblem "Account locked after too many failed logins"
+// @Failure 429 {object} LoginBlockedProblem "Too many failed logins, retry later"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	// Validate request
-	if req.Email == "" || req.Password == "" {
-		h.sendError(w, "Email and password are required", http.StatusBadRequest)
+	if !DecodeAndValidate(w, r, &req) {
 		return
 	}
 
 	// Login user
-	authResp, err := h.authService.Login(r.Context(), req.Email, req.Password)
+	authResp, err := h.authService.Login(r.Context(), req.Email, req.Password, r.UserAgent(), clientIP(r))
 	if err != nil {
-		if err == services.ErrInvalidCredentials {
-			h.sendError(w, "Invalid email or password", http.StatusUnauthorized)
-			return
+		var blocked *services.LoginBlockedError
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			sendError(w, r, CodeInvalidCredentials, http.StatusUnauthorized)
+		case errors.Is(err, services.ErrUserSuspended):
+			sendError(w, r, CodeAccountSuspended, http.StatusForbidden)
+		case errors.As(err, &blocked):
+			sendLoginBlocked(w, r, blocked)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		}
-		h.sendError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -125,63 +205,462 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 // Refresh godoc
 // @Summary Refresh access token
-// @Description Get a new access token using the refresh token
+// @Description Exchange a refresh token for a new access token and a new refresh token. The refresh token is rotated: the one sent stops working, and sending it again revokes the whole session.
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Security BearerAuth
+// @Param request body RefreshRequest true "Refresh request"
 // @Success 200 {object} AuthResponse
-// @Failure 401 {object} ErrorResponse "Invalid or expired token"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters"
+// @Failure 401 {object} apierror.Problem "Invalid, expired or revoked refresh token"
+// @Failure 403 {object} apierror.Problem "Account suspended"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Router /auth/refresh [post]
 func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
-	token := h.extractToken(r)
-	if token == "" {
-		h.sendError(w, "Missing authorization header", http.StatusUnauthorized)
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		sendError(w, r, CodeRefreshTokenRequired, http.StatusBadRequest)
 		return
 	}
 
-	authResp, err := h.authService.RefreshToken(r.Context(), token)
+	authResp, err := h.authService.RefreshToken(r.Context(), req.RefreshToken)
 	if err != nil {
-		if err == services.ErrInvalidToken {
-			h.sendError(w, "Invalid or expired token", http.StatusUnauthorized)
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrUserNotFound) {
+			sendError(w, r, CodeInvalidToken, http.StatusUnauthorized)
 			return
 		}
-		h.sendError(w, "Internal server error", http.StatusInternalServerError)
+		if errors.Is(err, services.ErrUserSuspended) {
+			sendError(w, r, CodeAccountSuspended, http.StatusForbidden)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	json.NewEncoder(w).Encode(authResp)
 }
 
+// Logout godoc
+// @Summary Logout
+// @Description Revoke the session of a refresh token and the access token in the Authorization header, if any, or every session and access token of their user with all_sessions. Other access tokens of the session stay valid until they expire.
+// @Tags auth
+// @Accept json
+// @Param request body LogoutRequest false "Logout request"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	// The body is optional when an access token is sent
+	var req LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	accessToken := h.extractToken(r)
+	if req.RefreshToken == "" && accessToken == "" {
+		sendError(w, r, CodeRefreshTokenRequired, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.Logout(r.Context(), req.RefreshToken, accessToken, req.AllSessions); err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Logout everywhere
+// @Description Revoke every session of the authenticated user and every access token issued to them, including the one of the request.
+// @Tags auth
+// @Security BearerAuth
+// @Success 204 "No Content"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if err := h.authService.LogoutAll(r.Context(), services.UserIDFromContext(r.Context())); err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use link to reset the password of the account with the given email. The response is the same whether or not the account exists.
+// @Tags auth
+// @Accept json
+// @Param request body ForgotPasswordRequest true "Forgot password request"
+// @Success 202 "Accepted"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		sendError(w, r, CodeEmailRequired, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ForgotPassword(r.Context(), req.Email); err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password using the token from a password reset email. The token works once, and every session of the user is logged out.
+// @Tags auth
+// @Accept json
+// @Param request body ResetPasswordRequest true "Reset password request"
+// @Success 204 "No Content"
+// @Failure 400 {object} PasswordPolicyProblem "Invalid request parameters, expired token, or a password the password policy rejects"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		sendError(w, r, CodeInvalidResetToken, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		switch {
+		case sendPasswordError(w, r, h.authService.PasswordPolicy(), err):
+		case errors.Is(err, services.ErrInvalidResetToken):
+			sendError(w, r, CodeInvalidResetToken, http.StatusBadRequest)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangePassword godoc
+// @Summary Change the password
+// @Description Replace the authenticated user's password, given the current one. The new password must meet the password policy and differ from the current one. Every other session is logged out and its access tokens revoked; this one stays signed in.
+// @Tags users
+// @Accept json
+// @Param request body ChangePasswordRequest true "Change password request"
+// @Success 204 "No Content"
+// @Failure 400 {object} PasswordPolicyProblem "Invalid request parameters, a wrong current password, or a new password the password policy rejects"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 429 {object} apierror.Problem "Too many requests"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /users/password [put]
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req ChangePasswordRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx := r.Context()
+	err := h.authService.ChangePassword(ctx, services.UserIDFromContext(ctx), services.SessionIDFromContext(ctx), req.CurrentPassword, req.NewPassword)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case sendPasswordError(w, r, h.authService.PasswordPolicy(), err):
+	case errors.Is(err, services.ErrWrongPassword):
+		sendError(w, r, CodeWrongPassword, http.StatusBadRequest)
+	case errors.Is(err, services.ErrPasswordReused):
+		sendError(w, r, CodePasswordReused, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
+
+// ChangeEmail godoc
+// @Summary Change the email address
+// @Description Email a single-use link confirming the new address to it, and tell the current address about the request. The email address only changes once the link is confirmed with POST /auth/confirm-email.
+// @Tags users
+// @Accept json
+// @Param request body ChangeEmailRequest true "Change email request"
+// @Success 202 "Accepted"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters, or the current address"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 409 {object} apierror.Problem "Email already exists"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /users/email [put]
+func (h *AuthHandler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	var req ChangeEmailRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	err := h.authService.RequestEmailChange(r.Context(), services.UserIDFromContext(r.Context()), req.Email)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusAccepted)
+	case errors.Is(err, services.ErrEmailUnchanged):
+		sendError(w, r, CodeEmailUnchanged, http.StatusBadRequest)
+	case errors.Is(err, services.ErrEmailTaken):
+		sendError(w, r, CodeEmailTaken, http.StatusConflict)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
+
+// ConfirmEmail godoc
+// @Summary Confirm a new email address
+// @Description Change the email address of the user to the one confirmed by the token from an email change confirmation. The token works once. The address is checked again, as another account may have taken it since.
+// @Tags auth
+// @Accept json
+// @Param request body ConfirmEmailRequest true "Confirm email request"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem "Invalid request parameters, or expired token"
+// @Failure 409 {object} apierror.Problem "Email already exists"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/confirm-email [post]
+func (h *AuthHandler) ConfirmEmail(w http.ResponseWriter, r *http.Request) {
+	var req ConfirmEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" {
+		sendError(w, r, CodeInvalidEmailChangeToken, http.StatusBadRequest)
+		return
+	}
+
+	err := h.authService.ConfirmEmailChange(r.Context(), req.Token)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, services.ErrInvalidEmailChangeToken):
+		sendError(w, r, CodeInvalidEmailChangeToken, http.StatusBadRequest)
+	case errors.Is(err, services.ErrEmailTaken):
+		sendError(w, r, CodeEmailTaken, http.StatusConflict)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
+
+// ListDevices godoc
+// @Summary List signed-in devices
+// @Description List the devices the authenticated user is signed in on, most recently seen first. The device of the request is marked current.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Device
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /users/devices [get]
+func (h *AuthHandler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	devices, err := h.authService.ListDevices(ctx, services.UserIDFromContext(ctx), services.SessionIDFromContext(ctx))
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(devices)
+}
+
+// RevokeDevice godoc
+// @Summary Sign out a device
+// @Description Sign the authenticated user out of a device, such as a lost phone, by revoking the refresh tokens of its session. Access tokens already issued to it stay valid until they expire.
+// @Tags users
+// @Security BearerAuth
+// @Param id path int true "Device ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem "Invalid device ID"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 404 {object} apierror.Problem "Device not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /users/devices/{id} [delete]
+func (h *AuthHandler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidDeviceID, http.StatusBadRequest)
+		return
+	}
+
+	err = h.authService.RevokeDevice(r.Context(), services.UserIDFromContext(r.Context()), id)
+	if errors.Is(err, services.ErrDeviceNotFound) {
+		sendError(w, r, CodeDeviceNotFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteAccount godoc
+// @Summary Delete the account
+// @Description Delete the authenticated user's account. It stops working at once: every session and access token is revoked, and reviews stay without an author. The account is removed for good, with favorites, watch history and the rest of its data, after the deletion grace period; until then its email address cannot be registered again.
+// @Tags users
+// @Security BearerAuth
+// @Success 204 "No Content"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /users/profile [delete]
+func (h *AuthHandler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	err := h.authService.DeleteAccount(r.Context(), services.UserIDFromContext(r.Context()))
+	if errors.Is(err, database.ErrNotFound) {
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user's account
+// @Description Forget the failed logins of a user, lifting the lock of their account and any wait before they can log in again.
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem "Invalid user ID"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/unlock [post]
+func (h *AuthHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
+		return
+	}
+
+	err = h.authService.UnlockUser(r.Context(), id)
+	if errors.Is(err, services.ErrUserNotFound) {
+		sendError(w, r, CodeUserNotFound, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS godoc
+// @Summary Get the token signing keys
+// @Description Get the public keys of the RS256 access tokens, as a JSON Web Key Set, for other services to verify tokens with. Tokens name their key in their kid header. The set is empty while tokens are signed with HS256.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} jwtkeys.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(h.authService.JWKS())
+}
+
 // AuthMiddleware godoc
 // @Summary Authentication middleware
-// @Description Middleware to authenticate requests using JWT token
+// @Description Middleware to authenticate requests using JWT token. Suspended users are refused.
 // @Security BearerAuth
 func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		token := h.extractToken(r)
 		if token == "" {
-			h.sendError(w, "Missing authorization header", http.StatusUnauthorized)
+			sendError(w, r, CodeMissingAuthorization, http.StatusUnauthorized)
 			return
 		}
 
-		userID, err := h.authService.ValidateToken(r.Context(), token)
+		claims, err := h.authService.ValidateTokenClaims(r.Context(), token)
 		if err != nil {
-			if err == services.ErrInvalidToken {
-				h.sendError(w, "Invalid or expired token", http.StatusUnauthorized)
+			if errors.Is(err, services.ErrInvalidToken) {
+				sendError(w, r, CodeInvalidToken, http.StatusUnauthorized)
 				return
 			}
-			h.sendError(w, "Internal server error", http.StatusInternalServerError)
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			return
+		}
+
+		suspended, err := h.authService.IsSuspended(r.Context(), claims.UserID)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeInvalidToken, http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			return
+		}
+		if suspended {
+			sendError(w, r, CodeAccountSuspended, http.StatusForbidden)
 			return
 		}
 
-		// Add user ID to context
-		ctx := services.ContextWithUserID(r.Context(), userID)
+		// Add user ID, session, and the profile selected if any, to context
+		ctx := services.ContextWithUserID(r.Context(), claims.UserID)
+		ctx = services.ContextWithSessionID(ctx, claims.SessionID)
+		if claims.ProfileID != 0 {
+			ctx = services.ContextWithProfileID(ctx, claims.ProfileID)
+		}
+		requestlog.AddFields(ctx, zap.Int64("user_id", claims.UserID))
+		errorreporting.SetUser(ctx, claims.UserID)
+		if txn := newrelic.FromContext(ctx); txn != nil {
+			txn.AddAttribute("user_id", claims.UserID)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// OptionalAuthMiddleware authenticates the request like AuthMiddleware when a
+// bearer token is present and lets anonymous requests through. A token that
+// is present but invalid is still rejected.
+func (h *AuthHandler) OptionalAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := h.AuthMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
 // AdminMiddleware godoc
 // @Summary Admin authorization middleware
 // @Description Middleware to check if the authenticated user is an admin
@@ -190,18 +669,19 @@ func (h *AuthHandler) AdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID := services.UserIDFromContext(r.Context())
 		if userID == 0 {
-			h.sendError(w, "Unauthorized", http.StatusUnauthorized)
+			sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
 			return
 		}
 
 		isAdmin, err := h.authService.IsAdmin(r.Context(), userID)
 		if err != nil {
-			h.sendError(w, "Internal server error", http.StatusInternalServerError)
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 			return
 		}
 
 		if !isAdmin {
-			h.sendError(w, "Admin access required", http.StatusForbidden)
+			sendError(w, r, CodeAdminRequired, http.StatusForbidden)
 			return
 		}
 
@@ -211,6 +691,57 @@ func (h *AuthHandler) AdminMiddleware(next http.Handler) http.Handler {
 
 // Helper functions
 
+// sendPasswordError answers err when it is a password policy rejects, and
+// reports whether it was
+func sendPasswordError(w http.ResponseWriter, r *http.Request, policy config.PasswordPolicy, err error) bool {
+	var weak *services.WeakPasswordError
+	switch {
+	case errors.Is(err, services.ErrPasswordTooShort):
+		sendError(w, r, CodePasswordTooShort, http.StatusBadRequest, "min", policy.MinLength)
+	case errors.Is(err, services.ErrPasswordTooLong):
+		sendError(w, r, CodePasswordTooLong, http.StatusBadRequest, "max", policy.MaxLength)
+	case errors.As(err, &weak):
+		problem := PasswordPolicyProblem{
+			Problem: apierror.New(r, http.StatusBadRequest, CodePasswordTooWeak),
+			Missing: weak.Missing,
+		}
+		w.Header().Set("Content-Type", apierror.ContentType)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(problem)
+	default:
+		return false
+	}
+	return true
+}
+
+// sendLoginBlocked answers a login refused after too many failures with 423
+// account_locked or 429 login_throttled, and when to retry
+func sendLoginBlocked(w http.ResponseWriter, r *http.Request, blocked *services.LoginBlockedError) {
+	status, code := http.StatusTooManyRequests, CodeLoginThrottled
+	if blocked.Locked {
+		status, code = http.StatusLocked, CodeAccountLocked
+	}
+	seconds := int(math.Ceil(blocked.RetryAfter.Seconds()))
+	problem := LoginBlockedProblem{
+		Problem:    apierror.New(r, status, code, "retry_after", seconds),
+		RetryAfter: seconds,
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.Header().Set("Content-Type", apierror.ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// clientIP is the address of the client of r, the one the RealIP
+// middleware found behind proxies
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 func (h *AuthHandler) extractToken(r *http.Request) string {
 	bearerToken := r.Header.Get("Authorization")
 	if bearerToken == "" {
@@ -224,9 +755,3 @@ func (h *AuthHandler) extractToken(r *http.Request) string {
 
 	return parts[1]
 }
-
-func (h *AuthHandler) sendError(w http.ResponseWriter, message string, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
-}
@@ -0,0 +1,541 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/entitlements"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// maxStripeEventSize caps the size of Stripe webhook payloads
+const maxStripeEventSize = 1 << 20
+
+type BillingHandler struct {
+	billingService *services.BillingService
+	logger         *zap.Logger
+}
+
+func NewBillingHandler(billingService *services.BillingService, logger *zap.Logger) *BillingHandler {
+	return &BillingHandler{
+		billingService: billingService,
+		logger:         logger,
+	}
+}
+
+// CheckoutRequest names the plan to subscribe to
+type CheckoutRequest struct {
+	Plan string `json:"plan" example:"premium" validate:"required"`
+}
+
+// PortalResponse is the customer portal session to redirect the user to
+type PortalResponse struct {
+	URL string `json:"url" example:"https://billing.stripe.com/p/session/test_a1b2c3"`
+}
+
+// PlanRequest is a subscription plan sold at a Stripe price. PriceCents and
+// Currency are what clients show; Stripe bills the price itself.
+type PlanRequest struct {
+	Name          string `json:"name" example:"Premium" validate:"required,max=100"`
+	StripePriceID string `json:"stripe_price_id" example:"price_1PqR2sT3uV4wX5yZ" validate:"required"`
+	PriceCents    int64  `json:"price_cents" example:"1799" validate:"gte=0"`
+	Currency      string `json:"currency" example:"usd" validate:"len=3"`
+	Interval      string `json:"interval" example:"month" validate:"oneof=month year"`
+	Active        bool   `json:"active" example:"true"`
+}
+
+// CouponRequest is a promo code taking PercentOff percent, or
+// AmountOffCents in Currency, off subscriptions started with Checkout, for
+// the first invoice (once), DurationMonths months (repeating) or every
+// invoice (forever). MaxRedemptions of zero allows any number.
+type CouponRequest struct {
+	Code           string     `json:"code" example:"WELCOME-50" validate:"required,max=50"`
+	Description    string     `json:"description,omitempty" example:"Half off the first month" validate:"max=200"`
+	PercentOff     int        `json:"percent_off,omitempty" example:"50" validate:"gte=0,lte=100"`
+	AmountOffCents int64      `json:"amount_off_cents,omitempty" example:"0" validate:"gte=0"`
+	Currency       string     `json:"currency,omitempty" example:""`
+	Duration       string     `json:"duration" example:"once" validate:"oneof=once repeating forever"`
+	DurationMonths int        `json:"duration_months,omitempty" example:"0" validate:"gte=0"`
+	MaxRedemptions int        `json:"max_redemptions" example:"100" validate:"gte=0"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" example:"2025-01-31T23:59:59Z"`
+}
+
+// CouponUpdateRequest replaces the terms of a coupon that can change after
+// it is created
+type CouponUpdateRequest struct {
+	Description    string     `json:"description,omitempty" example:"Half off the first month" validate:"max=200"`
+	MaxRedemptions int        `json:"max_redemptions" example:"200" validate:"gte=0"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" example:"2025-02-28T23:59:59Z"`
+	Active         bool       `json:"active" example:"true"`
+}
+
+// RedeemCouponRequest names the coupon to redeem
+type RedeemCouponRequest struct {
+	Code string `json:"code" example:"WELCOME-50" validate:"required"`
+}
+
+// EntitlementsMiddleware godoc
+// @Summary Entitlements middleware
+// @Description Middleware to resolve what the signed-in user may do when playing videos, from the plan of their subscription, for the playback handlers after it. While billing is enabled, users without an active subscription are rejected. Anonymous requests are left to the handler.
+// @Security BearerAuth
+func (h *BillingHandler) EntitlementsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := services.UserIDFromContext(r.Context())
+		if userID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e, err := h.billingService.Entitlements(r.Context(), userID)
+		if err != nil {
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			return
+		}
+		if e == nil {
+			sendError(w, r, CodeSubscriptionRequired, http.StatusPaymentRequired)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(entitlements.NewContext(r.Context(), *e)))
+	})
+}
+
+// GetPlans godoc
+// @Summary List plans
+// @Description Get the subscription plans on sale, cheapest first
+// @Tags billing
+// @Produce json
+// @Success 200 {array} models.Plan
+// @Failure 500 {object} apierror.Problem
+// @Router /billing/plans [get]
+func (h *BillingHandler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	h.listPlans(w, r, false)
+}
+
+// GetSubscription godoc
+// @Summary Get the subscription
+// @Description Get the authenticated user's latest subscription with its plan, whatever its status
+// @Tags billing
+// @Produce json
+// @Success 200 {object} models.Subscription
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /billing/subscription [get]
+func (h *BillingHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.billingService.Subscription(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sub)
+}
+
+// GetEntitlements godoc
+// @Summary Get the entitlements
+// @Description Get what the authenticated user may do when playing videos under the plan of their subscription: the tallest HLS renditions they may stream, how many videos they may play at once and whether they may download videos, zero being no limit. Admins, and every user while billing is disabled, have no limits.
+// @Tags billing
+// @Produce json
+// @Success 200 {object} entitlements.Entitlements
+// @Failure 401 {object} apierror.Problem
+// @Failure 402 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /billing/entitlements [get]
+func (h *BillingHandler) GetEntitlements(w http.ResponseWriter, r *http.Request) {
+	e, _ := entitlements.FromContext(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
+
+// Checkout godoc
+// @Summary Subscribe to a plan
+// @Description Start a Stripe Checkout session subscribing the authenticated user to a plan, and redirect them to its url. The subscription becomes active once Stripe reports the payment. A coupon the user redeemed discounts it. Subscribed users change plans in the customer portal instead.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Param request body CheckoutRequest true "Plan"
+// @Success 200 {object} integrations.CheckoutSession
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /billing/checkout [post]
+func (h *BillingHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	var req CheckoutRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	session, err := h.billingService.Checkout(r.Context(), services.UserIDFromContext(r.Context()), req.Plan)
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(session)
+}
+
+// Portal godoc
+// @Summary Open the customer portal
+// @Description Start a Stripe customer portal session where the authenticated user changes plan, cancels, updates payment methods and gets invoices, and redirect them to its url
+// @Tags billing
+// @Produce json
+// @Success 200 {object} PortalResponse
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /billing/portal [post]
+func (h *BillingHandler) Portal(w http.ResponseWriter, r *http.Request) {
+	url, err := h.billingService.Portal(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(PortalResponse{URL: url})
+}
+
+// Webhook godoc
+// @Summary Receive Stripe events
+// @Description Endpoint for Stripe webhook events, signed in the Stripe-Signature header with the billing webhook secret or a webhooks.inbound.stripe secret. Deliveries with a missing, stale or invalid signature, or already accepted, are rejected with 401. Checkout, subscription and invoice events update the subscription they are about; others are ignored. Failures answer 5xx so Stripe retries.
+// @Tags billing
+// @Accept json
+// @Param Stripe-Signature header string true "Stripe signature"
+// @Success 200
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Router /billing/webhook [post]
+func (h *BillingHandler) Webhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxStripeEventSize+1))
+	if err != nil || len(payload) > maxStripeEventSize {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	err = h.billingService.HandleWebhook(r.Context(), payload)
+	if errors.Is(err, integrations.ErrInvalidStripeEvent) {
+		h.logger.Warn("rejected stripe event", zap.Error(err))
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RedeemCoupon godoc
+// @Summary Redeem a coupon
+// @Description Redeem a promo code for the authenticated user. Its discount applies to the Checkout sessions they start until one completes. Each coupon is redeemed once per user, and a user holds one coupon at a time: redeeming another replaces the one not used yet.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Param request body RedeemCouponRequest true "Coupon"
+// @Success 200 {object} models.CouponRedemption
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 410 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /billing/coupons/redeem [post]
+func (h *BillingHandler) RedeemCoupon(w http.ResponseWriter, r *http.Request) {
+	var req RedeemCouponRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	redemption, err := h.billingService.RedeemCoupon(r.Context(), services.UserIDFromContext(r.Context()), req.Code)
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(redemption)
+}
+
+// ListCoupons godoc
+// @Summary List coupons
+// @Description Get every coupon with how many times it was redeemed, newest first
+// @Tags billing
+// @Produce json
+// @Success 200 {array} models.Coupon
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/coupons [get]
+func (h *BillingHandler) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := h.billingService.ListCoupons(r.Context())
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+// GetCoupon godoc
+// @Summary Get a coupon
+// @Description Get a coupon by code
+// @Tags billing
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Success 200 {object} models.Coupon
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/coupons/{code} [get]
+func (h *BillingHandler) GetCoupon(w http.ResponseWriter, r *http.Request) {
+	coupon, err := h.billingService.GetCoupon(r.Context(), chi.URLParam(r, "code"))
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// CreateCoupon godoc
+// @Summary Create a coupon
+// @Description Create a promo code, backed by a Stripe coupon, taking either percent_off percent or amount_off_cents in currency off subscriptions. Codes are case-insensitive. The discount cannot change afterwards.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Param request body CouponRequest true "Coupon"
+// @Success 201 {object} models.Coupon
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/coupons [post]
+func (h *BillingHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req CouponRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	coupon := &models.Coupon{
+		Code:           req.Code,
+		Description:    req.Description,
+		PercentOff:     req.PercentOff,
+		AmountOffCents: req.AmountOffCents,
+		Currency:       req.Currency,
+		Duration:       req.Duration,
+		DurationMonths: req.DurationMonths,
+		MaxRedemptions: req.MaxRedemptions,
+		Active:         true,
+	}
+	if req.ExpiresAt != nil {
+		coupon.ExpiresAt = *req.ExpiresAt
+	}
+	if err := h.billingService.CreateCoupon(r.Context(), coupon); err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// UpdateCoupon godoc
+// @Summary Update a coupon
+// @Description Replace the description, redemption limit, expiry and active flag of a coupon. Inactive and expired coupons cannot be redeemed; redemptions already made still apply.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Param code path string true "Coupon code"
+// @Param request body CouponUpdateRequest true "Coupon terms"
+// @Success 200 {object} models.Coupon
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/coupons/{code} [put]
+func (h *BillingHandler) UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req CouponUpdateRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	update := services.CouponUpdate{
+		Description:    req.Description,
+		MaxRedemptions: req.MaxRedemptions,
+		Active:         req.Active,
+	}
+	if req.ExpiresAt != nil {
+		update.ExpiresAt = *req.ExpiresAt
+	}
+	coupon, err := h.billingService.UpdateCoupon(r.Context(), chi.URLParam(r, "code"), update)
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// DeleteCoupon godoc
+// @Summary Delete a coupon
+// @Description Delete a coupon, its Stripe coupon and the redemptions not used yet. Subscriptions it already discounts keep their discount.
+// @Tags billing
+// @Param code path string true "Coupon code"
+// @Success 204
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/coupons/{code} [delete]
+func (h *BillingHandler) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	if err := h.billingService.DeleteCoupon(r.Context(), chi.URLParam(r, "code")); err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AdminGetPlans godoc
+// @Summary List all plans
+// @Description Get every subscription plan, including the ones no longer on sale
+// @Tags billing
+// @Produce json
+// @Success 200 {array} models.Plan
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/plans [get]
+func (h *BillingHandler) AdminGetPlans(w http.ResponseWriter, r *http.Request) {
+	h.listPlans(w, r, true)
+}
+
+// PutPlan godoc
+// @Summary Create or update a plan
+// @Description Create the subscription plan with code, or replace it. The code names the plan in rate_limit.plan_multipliers. Plans taken off sale keep their subscribers.
+// @Tags billing
+// @Accept json
+// @Produce json
+// @Param code path string true "Plan code"
+// @Param plan body PlanRequest true "Plan"
+// @Success 200 {object} models.Plan
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/plans/{code} [put]
+func (h *BillingHandler) PutPlan(w http.ResponseWriter, r *http.Request) {
+	var req PlanRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	plan := &models.Plan{
+		Code:          chi.URLParam(r, "code"),
+		Name:          req.Name,
+		StripePriceID: req.StripePriceID,
+		PriceCents:    req.PriceCents,
+		Currency:      req.Currency,
+		Interval:      req.Interval,
+		Active:        req.Active,
+	}
+	if err := h.billingService.PutPlan(r.Context(), plan); err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+func (h *BillingHandler) listPlans(w http.ResponseWriter, r *http.Request, all bool) {
+	plans, err := h.billingService.ListPlans(r.Context(), all)
+	if err != nil {
+		h.sendBillingError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+func (h *BillingHandler) sendBillingError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrBillingDisabled):
+		sendError(w, r, CodeBillingDisabled, http.StatusServiceUnavailable)
+	case errors.Is(err, services.ErrInvalidPlan):
+		sendError(w, r, CodeInvalidPlan, http.StatusBadRequest)
+	case errors.Is(err, services.ErrPlanNotFound):
+		sendError(w, r, CodePlanNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrPlanPriceTaken):
+		sendError(w, r, CodePlanPriceTaken, http.StatusConflict)
+	case errors.Is(err, services.ErrNoSubscription):
+		sendError(w, r, CodeSubscriptionNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrAlreadySubscribed):
+		sendError(w, r, CodeAlreadySubscribed, http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidCoupon):
+		sendError(w, r, CodeInvalidCoupon, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCouponNotFound):
+		sendError(w, r, CodeCouponNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrCouponCodeTaken):
+		sendError(w, r, CodeCouponCodeTaken, http.StatusConflict)
+	case errors.Is(err, services.ErrCouponExpired):
+		sendError(w, r, CodeCouponExpired, http.StatusGone)
+	case errors.Is(err, services.ErrCouponExhausted):
+		sendError(w, r, CodeCouponExhausted, http.StatusConflict)
+	case errors.Is(err, services.ErrCouponAlreadyRedeemed):
+		sendError(w, r, CodeCouponAlreadyRedeemed, http.StatusConflict)
+	case errors.Is(err, services.ErrCouponNotApplicable):
+		sendError(w, r, CodeCouponNotApplicable, http.StatusConflict)
+	case errors.Is(err, integrations.ErrStripeUnavailable), errors.Is(err, integrations.ErrStripeNotFound):
+		logError(h.logger, r, err)
+		sendError(w, r, CodeBillingUnavailable, http.StatusBadGateway)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type BoostHandler struct {
+	boostService *services.BoostService
+	logger       *zap.Logger
+}
+
+func NewBoostHandler(boostService *services.BoostService, logger *zap.Logger) *BoostHandler {
+	return &BoostHandler{
+		boostService: boostService,
+		logger:       logger,
+	}
+}
+
+// BoostRequest promotes a movie in search results for Query, in the row of
+// Category, or in the unfiltered catalog when both are empty
+type BoostRequest struct {
+	MovieID  int64      `json:"movie_id" example:"42"`
+	Query    string     `json:"query,omitempty" example:"christmas"`
+	Category string     `json:"category,omitempty" example:"Sci-Fi"`
+	Position int        `json:"position,omitempty" example:"1"` // pin to this 1-based position
+	Weight   float64    `json:"weight,omitempty" example:"0"`   // or rank ahead of unboosted movies
+	StartsAt *time.Time `json:"starts_at,omitempty" example:"2024-12-01T00:00:00Z"`
+	EndsAt   *time.Time `json:"ends_at,omitempty" example:"2024-12-27T00:00:00Z"`
+}
+
+func (req *BoostRequest) boost() *models.EditorialBoost {
+	boost := &models.EditorialBoost{
+		MovieID:  req.MovieID,
+		Query:    req.Query,
+		Category: req.Category,
+		Position: req.Position,
+		Weight:   req.Weight,
+	}
+	if req.StartsAt != nil {
+		boost.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		boost.EndsAt = *req.EndsAt
+	}
+	return boost
+}
+
+// ListBoosts godoc
+// @Summary List editorial boosts
+// @Description Get the boosts and pins applied to search results and movie listings
+// @Tags boosts
+// @Produce json
+// @Param active query bool false "Only list boosts in effect now"
+// @Success 200 {array} models.EditorialBoost
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/boosts [get]
+func (h *BoostHandler) ListBoosts(w http.ResponseWriter, r *http.Request) {
+	activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+
+	boosts, err := h.boostService.ListBoosts(r.Context(), activeOnly)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(boosts)
+}
+
+// CreateBoost godoc
+// @Summary Create an editorial boost
+// @Description Pin a movie to a position, or boost it by a weight, in search results for a query, in a category row or in the unfiltered catalog, optionally between starts_at and ends_at. Boosts only apply to the default sort order.
+// @Tags boosts
+// @Accept json
+// @Produce json
+// @Param request body BoostRequest true "Boost"
+// @Success 201 {object} models.EditorialBoost
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/boosts [post]
+func (h *BoostHandler) CreateBoost(w http.ResponseWriter, r *http.Request) {
+	var req BoostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	boost := req.boost()
+	if err := h.boostService.CreateBoost(r.Context(), boost); err != nil {
+		h.sendBoostError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(boost)
+}
+
+// UpdateBoost godoc
+// @Summary Update an editorial boost
+// @Description Replace a boost, including its schedule
+// @Tags boosts
+// @Accept json
+// @Produce json
+// @Param id path int true "Boost ID"
+// @Param request body BoostRequest true "Boost"
+// @Success 200 {object} models.EditorialBoost
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/boosts/{id} [put]
+func (h *BoostHandler) UpdateBoost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidBoostID, http.StatusBadRequest)
+		return
+	}
+
+	var req BoostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	boost := req.boost()
+	boost.ID = id
+	if err := h.boostService.UpdateBoost(r.Context(), boost); err != nil {
+		h.sendBoostError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(boost)
+}
+
+// DeleteBoost godoc
+// @Summary Delete an editorial boost
+// @Tags boosts
+// @Param id path int true "Boost ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/boosts/{id} [delete]
+func (h *BoostHandler) DeleteBoost(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidBoostID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.boostService.DeleteBoost(r.Context(), id); err != nil {
+		h.sendBoostError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *BoostHandler) sendBoostError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBoost):
+		sendError(w, r, CodeInvalidBoost, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeBoostNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
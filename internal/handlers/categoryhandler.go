@@ -2,58 +2,163 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
 	"github.com/ndn/internal/models"
 	"github.com/ndn/internal/services"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 type CategoryHandler struct {
 	categoryService *services.CategoryService
+	logger          *zap.Logger
 }
 
-func NewCategoryHandler(categoryService *services.CategoryService) *CategoryHandler {
+func NewCategoryHandler(categoryService *services.CategoryService, logger *zap.Logger) *CategoryHandler {
 	return &CategoryHandler{
 		categoryService: categoryService,
+		logger:          logger,
 	}
 }
 
 type CreateCategoryRequest struct {
-	Name string `json:"name" example:"Action"`
+	Name     string `json:"name" example:"Action"`
+	ParentID *int64 `json:"parent_id,omitempty" example:"1"`
 }
 
 type CategoryResponse struct {
-	ID   int64  `json:"id" example:"1"`
-	Name string `json:"name" example:"Action"`
+	ID           int64  `json:"id" example:"1"`
+	Name         string `json:"name" example:"Action"`
+	Slug         string `json:"slug" example:"action"`
+	ParentID     *int64 `json:"parent_id,omitempty" example:"1"`
+	DisplayOrder int    `json:"display_order" example:"0"`
+	Hidden       bool   `json:"hidden,omitempty" example:"false"`
+	// DeletedAt is when the category was deleted, listed to admins asking
+	// for deleted categories
+	DeletedAt *time.Time `json:"deleted_at,omitempty" example:"2024-01-02T00:00:00Z"`
+}
+
+// CategoryTreeResponse is a category with its sub-categories
+type CategoryTreeResponse struct {
+	CategoryResponse
+	Children []CategoryTreeResponse `json:"children"`
+}
+
+// CategoryListResponse is the categories in the list envelope. With tree=true
+// data holds the top-level categories as CategoryTreeResponse, and meta
+// counts them.
+type CategoryListResponse struct {
+	Data []CategoryResponse `json:"data"`
+	Meta ListMeta           `json:"meta"`
+}
+
+type UpdateCategoryRequest struct {
+	Name     string `json:"name" example:"Science Fiction"`
+	ParentID *int64 `json:"parent_id,omitempty" example:"1"` // top-level when omitted
+}
+
+type ReorderCategoriesRequest struct {
+	IDs []int64 `json:"ids" example:"3,1,2"`
+}
+
+type CategoryVisibilityRequest struct {
+	Hidden bool `json:"hidden" example:"true"`
 }
 
 // GetCategories godoc
 // @Summary Get all categories
-// @Description Get a list of all movie categories
+// @Description Get the visible movie categories in display order. With tree=true, top-level categories are returned with their sub-categories nested under children; sub-categories of hidden categories are left out.
 // @Tags categories
 // @Accept json
 // @Produce json
-// @Success 200 {array} CategoryResponse
-// @Failure 500 {object} ErrorResponse
+// @Param tree query bool false "Nest sub-categories under their parents"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
+// @Success 200 {object} CategoryListResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 500 {object} apierror.Problem
 // @Router /categories [get]
 func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
-	categories, err := h.categoryService.GetCategories(r.Context())
+	h.listCategories(w, r, false, false)
+}
+
+// AdminGetCategories godoc
+// @Summary Get all categories including hidden
+// @Description Get every movie category in display order, including hidden ones, and deleted ones with include_deleted=true. With tree=true, top-level categories are returned with their sub-categories nested under children.
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param tree query bool false "Nest sub-categories under their parents"
+// @Param include_deleted query bool false "Include deleted categories, with their deleted_at"
+// @Success 200 {object} CategoryListResponse
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories [get]
+func (h *CategoryHandler) AdminGetCategories(w http.ResponseWriter, r *http.Request) {
+	includeDeleted, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+	h.listCategories(w, r, true, includeDeleted)
+}
+
+func (h *CategoryHandler) listCategories(w http.ResponseWriter, r *http.Request, includeHidden, includeDeleted bool) {
+	categories, err := h.categoryService.GetCategories(r.Context(), includeHidden, includeDeleted)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := make([]CategoryResponse, len(categories))
 	for i, category := range categories {
 		response[i] = CategoryResponse{
-			ID:   category.ID,
-			Name: category.Name,
+			ID:           category.ID,
+			Name:         category.Name,
+			Slug:         category.Slug,
+			ParentID:     category.ParentID,
+			DisplayOrder: category.DisplayOrder,
+			Hidden:       category.Hidden,
+			DeletedAt:    category.DeletedAt,
 		}
 	}
 
-	json.NewEncoder(w).Encode(response)
+	if r.URL.Query().Get("tree") == "true" {
+		tree := categoryTree(response)
+		renderList(w, tree, len(tree))
+		return
+	}
+	renderList(w, response, len(response))
+}
+
+// categoryTree nests categories under their parents, keeping their order.
+// Categories whose parent is not listed are left out, along with their
+// sub-categories.
+func categoryTree(categories []CategoryResponse) []CategoryTreeResponse {
+	children := make(map[int64][]CategoryResponse)
+	var roots []CategoryResponse
+	for _, category := range categories {
+		if category.ParentID == nil {
+			roots = append(roots, category)
+		} else {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(categories []CategoryResponse) []CategoryTreeResponse
+	build = func(categories []CategoryResponse) []CategoryTreeResponse {
+		nodes := make([]CategoryTreeResponse, len(categories))
+		for i, category := range categories {
+			nodes[i] = CategoryTreeResponse{
+				CategoryResponse: category,
+				Children:         build(children[category.ID]),
+			}
+		}
+		return nodes
+	}
+	return build(roots)
 }
 
 // GetCategory godoc
@@ -63,26 +168,76 @@ func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request)
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
 // @Success 200 {object} CategoryResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Router /categories/{id} [get]
 func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		h.sendError(w, "Invalid category ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidCategoryID, http.StatusBadRequest)
 		return
 	}
 
-	category, err := h.categoryService.GetCategory(r.Context(), id)
+	category, err := h.categoryService.GetCategory(r.Context(), id, false)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := CategoryResponse{
-		ID:   category.ID,
-		Name: category.Name,
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetCategoryBySlug godoc
+// @Summary Get a category by slug
+// @Description Get a category by its slug, the URL-friendly form of its name
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param slug path string true "Category slug"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
+// @Success 200 {object} CategoryResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /categories/slug/{slug} [get]
+func (h *CategoryHandler) GetCategoryBySlug(w http.ResponseWriter, r *http.Request) {
+	category, err := h.categoryService.GetCategoryBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := CategoryResponse{
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -96,70 +251,320 @@ func (h *CategoryHandler) GetCategory(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param category body CreateCategoryRequest true "Category details"
 // @Success 201 {object} CategoryResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Security BearerAuth
 // @Router /admin/categories [post]
 func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	var req CreateCategoryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
 		return
 	}
 
 	if req.Name == "" {
-		h.sendError(w, "Category name is required", http.StatusBadRequest)
+		sendError(w, r, CodeCategoryNameRequired, http.StatusBadRequest)
 		return
 	}
 
 	category := &models.Category{
-		Name: req.Name,
+		Name:     req.Name,
+		ParentID: req.ParentID,
 	}
 
 	if err := h.categoryService.CreateCategory(r.Context(), category); err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		h.sendCategoryError(w, r, err)
 		return
 	}
 
 	response := CategoryResponse{
-		ID:   category.ID,
-		Name: category.Name,
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
 	}
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
 
+// UpdateCategory godoc
+// @Summary Update a category
+// @Description Rename a category and nest it under parent_id, or make it top-level when omitted. A category cannot be nested under itself or its sub-categories. Its slug changes to that of the new name, and the movies and editorial boosts of the category are moved to the new name, so filtering movies by the new name or slug finds them.
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param category body UpdateCategoryRequest true "Category details"
+// @Success 200 {object} CategoryResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories/{id} [put]
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCategoryID, http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		sendError(w, r, CodeCategoryNameRequired, http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.UpdateCategory(r.Context(), id, req.Name, req.ParentID)
+	if err != nil {
+		h.sendCategoryError(w, r, err)
+		return
+	}
+
+	response := CategoryResponse{
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
 // DeleteCategory godoc
 // @Summary Delete a category
-// @Description Delete a category by ID
+// @Description Delete a category no movie is in and without sub-categories. It can be restored until deleted categories are purged.
 // @Tags categories
 // @Accept json
 // @Produce json
 // @Param id path int true "Category ID"
 // @Success 204 "No Content"
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Security BearerAuth
 // @Router /admin/categories/{id} [delete]
 func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		h.sendError(w, "Invalid category ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidCategoryID, http.StatusBadRequest)
 		return
 	}
 
 	if err := h.categoryService.DeleteCategory(r.Context(), id); err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+		case errors.Is(err, services.ErrCategoryInUse):
+			sendError(w, r, CodeCategoryInUse, http.StatusConflict)
+		case errors.Is(err, services.ErrCategoryHasChildren):
+			sendError(w, r, CodeCategoryHasChildren, http.StatusConflict)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreCategory godoc
+// @Summary Restore a deleted category
+// @Description Undo the deletion of a category before it is purged. Fails if another category has taken its name or slug since, or its parent category is deleted.
+// @Tags categories
+// @Produce json
+// @Param id path int true "Category ID"
+// @Success 200 {object} CategoryResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories/{id}/restore [post]
+func (h *CategoryHandler) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCategoryID, http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.RestoreCategory(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrNotDeleted) {
+			sendError(w, r, CodeNotDeleted, http.StatusConflict)
+			return
+		}
+		h.sendCategoryError(w, r, err)
+		return
+	}
+
+	response := CategoryResponse{
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ReorderCategories godoc
+// @Summary Reorder categories
+// @Description Set the display order of categories. Listed categories come first in the given order; any not listed keep their relative order after them.
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param request body ReorderCategoriesRequest true "Category IDs in display order"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories/order [put]
+func (h *CategoryHandler) ReorderCategories(w http.ResponseWriter, r *http.Request) {
+	var req ReorderCategoriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.categoryService.ReorderCategories(r.Context(), req.IDs); err != nil {
+		if errors.Is(err, services.ErrInvalidCategoryOrder) {
+			sendError(w, r, CodeInvalidCategoryOrder, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (h *CategoryHandler) sendError(w http.ResponseWriter, message string, status int) {
+// SetCategoryVisibility godoc
+// @Summary Hide or show a category
+// @Description Hide a category from public listings without deleting it, or make it visible again
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param request body CategoryVisibilityRequest true "Visibility"
+// @Success 200 {object} CategoryResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories/{id}/visibility [put]
+func (h *CategoryHandler) SetCategoryVisibility(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCategoryID, http.StatusBadRequest)
+		return
+	}
+
+	var req CategoryVisibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.categoryService.SetCategoryHidden(r.Context(), id, req.Hidden)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := CategoryResponse{
+		ID:           category.ID,
+		Name:         category.Name,
+		Slug:         category.Slug,
+		ParentID:     category.ParentID,
+		DisplayOrder: category.DisplayOrder,
+		Hidden:       category.Hidden,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetCategoryStats godoc
+// @Summary Get catalog statistics per category
+// @Description Get every category with its title count, average rating of rated titles, total watch time and growth over the last weeks or months, to spot thin genres
+// @Tags categories
+// @Produce json
+// @Param interval query string false "week or month (default: month)"
+// @Param periods query int false "Number of intervals growth covers, at most 60 (default: 12)"
+// @Success 200 {array} services.CategoryStats
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/categories/stats [get]
+func (h *CategoryHandler) GetCategoryStats(w http.ResponseWriter, r *http.Request) {
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = services.StatsIntervalMonth
+	}
+
+	periods := services.DefaultStatsPeriods
+	if v := r.URL.Query().Get("periods"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			sendError(w, r, CodeInvalidPeriods, http.StatusBadRequest)
+			return
+		}
+		periods = n
+	}
+
+	stats, err := h.categoryService.CategoryStats(r.Context(), interval, periods)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidStatsInterval) {
+			sendError(w, r, CodeInvalidStatsInterval, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (h *CategoryHandler) sendCategoryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrCategoryExists):
+		sendError(w, r, CodeCategoryExists, http.StatusConflict)
+	case errors.Is(err, services.ErrCategorySlugTaken):
+		sendError(w, r, CodeCategorySlugTaken, http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidCategoryName):
+		sendError(w, r, CodeInvalidCategoryName, http.StatusBadRequest)
+	case errors.Is(err, services.ErrParentCategory):
+		sendError(w, r, CodeParentCategoryNotFound, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCategoryCycle):
+		sendError(w, r, CodeCategoryCycle, http.StatusBadRequest)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
 }
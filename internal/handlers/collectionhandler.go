@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type CollectionHandler struct {
+	collectionService *services.CollectionService
+	logger            *zap.Logger
+}
+
+func NewCollectionHandler(collectionService *services.CollectionService, logger *zap.Logger) *CollectionHandler {
+	return &CollectionHandler{
+		collectionService: collectionService,
+		logger:            logger,
+	}
+}
+
+// CollectionRequest creates or updates a collection. Its slug is made from
+// its title when omitted.
+type CollectionRequest struct {
+	Slug        string `json:"slug,omitempty" example:"staff-picks"`
+	Title       string `json:"title" example:"Staff Picks" validate:"required,max=255"`
+	Description string `json:"description,omitempty" example:"Favorites of the team"`
+	Hidden      bool   `json:"hidden,omitempty" example:"false"`
+}
+
+func (req *CollectionRequest) collection() *models.Collection {
+	return &models.Collection{
+		Slug:        req.Slug,
+		Title:       req.Title,
+		Description: req.Description,
+		Hidden:      req.Hidden,
+	}
+}
+
+type ReorderCollectionsRequest struct {
+	IDs []int64 `json:"ids" example:"3,1,2"`
+}
+
+// CollectionMoviesRequest lists the movies of a collection in order
+type CollectionMoviesRequest struct {
+	MovieIDs []int64 `json:"movie_ids" example:"42,7,19"`
+}
+
+// CollectionResponse is a visible collection with the movies in it
+type CollectionResponse struct {
+	ID          int64           `json:"id" example:"1"`
+	Slug        string          `json:"slug" example:"staff-picks"`
+	Title       string          `json:"title" example:"Staff Picks"`
+	Description string          `json:"description,omitempty" example:"Favorites of the team"`
+	Movies      []MovieResponse `json:"movies"`
+}
+
+func collectionResponse(row services.CollectionRow) CollectionResponse {
+	response := CollectionResponse{
+		ID:          row.ID,
+		Slug:        row.Slug,
+		Title:       row.Title,
+		Description: row.Description,
+		Movies:      make([]MovieResponse, len(row.Movies)),
+	}
+	for i, movie := range row.Movies {
+		response.Movies[i] = MovieResponse{
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
+		}
+	}
+	return response
+}
+
+// GetCollections godoc
+// @Summary Get the home page collections
+// @Description Get the visible collections in display order, each with its first published movies. Only movies within the rating ceiling of the profile are listed when signed in as one; collections left without movies are omitted.
+// @Tags collections
+// @Produce json
+// @Param limit query int false "Number of movies per collection, at most 50 (default: 20)"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
+// @Success 200 {array} CollectionResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 500 {object} apierror.Problem
+// @Router /collections [get]
+func (h *CollectionHandler) GetCollections(w http.ResponseWriter, r *http.Request) {
+	limit := services.DefaultCollectionMovies
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+			limit = min(l, services.MaxCollectionMovies)
+		}
+	}
+
+	rows, err := h.collectionService.PublishedCollections(r.Context(), limit)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]CollectionResponse, len(rows))
+	for i, row := range rows {
+		response[i] = collectionResponse(row)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetCollection godoc
+// @Summary Get a collection by slug
+// @Description Get a visible collection with all of its published movies, in order
+// @Tags collections
+// @Produce json
+// @Param slug path string true "Collection slug"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
+// @Success 200 {object} CollectionResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /collections/{slug} [get]
+func (h *CollectionHandler) GetCollection(w http.ResponseWriter, r *http.Request) {
+	row, err := h.collectionService.PublishedCollection(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collectionResponse(*row))
+}
+
+// AdminGetCollections godoc
+// @Summary Get all collections including hidden ones
+// @Description Get every collection in display order, with the IDs and positions of its movies
+// @Tags collections
+// @Produce json
+// @Success 200 {array} models.Collection
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections [get]
+func (h *CollectionHandler) AdminGetCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := h.collectionService.ListCollections(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collections)
+}
+
+// CreateCollection godoc
+// @Summary Create a collection
+// @Description Add an empty collection after the others. Its slug is made from its title unless given; slugs are lowercase letters and digits separated by hyphens.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param request body CollectionRequest true "Collection"
+// @Success 201 {object} models.Collection
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections [post]
+func (h *CollectionHandler) CreateCollection(w http.ResponseWriter, r *http.Request) {
+	var req CollectionRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	collection := req.collection()
+	if err := h.collectionService.CreateCollection(r.Context(), collection); err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collection)
+}
+
+// UpdateCollection godoc
+// @Summary Update a collection
+// @Description Replace the slug, title, description and visibility of a collection, keeping its place and movies
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param id path int true "Collection ID"
+// @Param request body CollectionRequest true "Collection"
+// @Success 200 {object} models.Collection
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections/{id} [put]
+func (h *CollectionHandler) UpdateCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCollectionID, http.StatusBadRequest)
+		return
+	}
+
+	var req CollectionRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	collection := req.collection()
+	collection.ID = id
+	if err := h.collectionService.UpdateCollection(r.Context(), collection); err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+// DeleteCollection godoc
+// @Summary Delete a collection
+// @Description Delete a collection; the movies in it are kept
+// @Tags collections
+// @Param id path int true "Collection ID"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections/{id} [delete]
+func (h *CollectionHandler) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCollectionID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.collectionService.DeleteCollection(r.Context(), id); err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReorderCollections godoc
+// @Summary Reorder collections
+// @Description Set the display order of collections. Listed collections come first in the given order; any not listed keep their relative order after them.
+// @Tags collections
+// @Accept json
+// @Param request body ReorderCollectionsRequest true "Collection IDs in display order"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections/order [put]
+func (h *CollectionHandler) ReorderCollections(w http.ResponseWriter, r *http.Request) {
+	var req ReorderCollectionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.collectionService.ReorderCollections(r.Context(), req.IDs); err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCollectionMovies godoc
+// @Summary Set the movies of a collection
+// @Description Replace the movies of a collection with movie_ids, in that order. Each movie must exist and be listed once, up to 200 movies.
+// @Tags collections
+// @Accept json
+// @Produce json
+// @Param id path int true "Collection ID"
+// @Param request body CollectionMoviesRequest true "Movie IDs in order"
+// @Success 200 {object} models.Collection
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/collections/{id}/movies [put]
+func (h *CollectionHandler) SetCollectionMovies(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidCollectionID, http.StatusBadRequest)
+		return
+	}
+
+	var req CollectionMoviesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	collection, err := h.collectionService.SetCollectionMovies(r.Context(), id, req.MovieIDs)
+	if err != nil {
+		h.sendCollectionError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collection)
+}
+
+func (h *CollectionHandler) sendCollectionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCollectionSlug):
+		sendError(w, r, CodeInvalidCollectionSlug, http.StatusBadRequest)
+	case errors.Is(err, services.ErrCollectionSlugTaken):
+		sendError(w, r, CodeCollectionSlugTaken, http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidCollectionOrder):
+		sendError(w, r, CodeInvalidCollectionOrder, http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidCollectionMovies):
+		sendError(w, r, CodeInvalidCollectionMovies, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeCollectionNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
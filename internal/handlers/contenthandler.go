@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// ContentHandler serves the publication workflow to editors, publishers
+// and admins
+type ContentHandler struct {
+	movieService    *services.MovieService
+	workflowService *services.WorkflowService
+	logger          *zap.Logger
+}
+
+func NewContentHandler(movieService *services.MovieService, workflowService *services.WorkflowService, logger *zap.Logger) *ContentHandler {
+	return &ContentHandler{
+		movieService:    movieService,
+		workflowService: workflowService,
+		logger:          logger,
+	}
+}
+
+// SetMovieStatusRequest is the publication status to move a movie to, and
+// when to publish it if scheduled
+type SetMovieStatusRequest struct {
+	Status    string     `json:"status" example:"in_review" enums:"draft,in_review,scheduled,published,archived"`
+	PublishAt *time.Time `json:"publish_at,omitempty" example:"2024-12-01T00:00:00Z"` // required to schedule
+}
+
+// ScheduleMovieRequest is when to publish a movie
+type ScheduleMovieRequest struct {
+	PublishAt *time.Time `json:"publish_at" example:"2024-12-01T00:00:00Z"`
+}
+
+// RoleMiddleware godoc
+// @Summary Content role middleware
+// @Description Middleware to check that the authenticated user is an editor, a publisher or an admin
+// @Security BearerAuth
+func (h *ContentHandler) RoleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := services.UserIDFromContext(r.Context())
+		if userID == 0 {
+			sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+			return
+		}
+
+		role, err := h.workflowService.ContentRole(r.Context(), userID)
+		if err != nil {
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			return
+		}
+		if role != models.RoleEditor && role != models.RolePublisher {
+			sendError(w, r, CodeContentRoleRequired, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// GetContentMovies godoc
+// @Summary List movies in the publication workflow
+// @Description Get the movies in a publication status, or every draft and movie in review when none is given, most recently updated first
+// @Tags content
+// @Produce json
+// @Param status query string false "draft, in_review, scheduled, published or archived"
+// @Success 200 {array} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /content/movies [get]
+func (h *ContentHandler) GetContentMovies(w http.ResponseWriter, r *http.Request) {
+	movies, err := h.workflowService.Movies(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movies)
+}
+
+// CreateDraft godoc
+// @Summary Create a draft movie
+// @Description Create a movie as a draft, which is not shown publicly until it has been reviewed and published
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param movie body CreateMovieRequest true "Movie details"
+// @Success 201 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /content/movies [post]
+func (h *ContentHandler) CreateDraft(w http.ResponseWriter, r *http.Request) {
+	var req CreateMovieRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	movie := &models.Movie{
+		Title:          req.Title,
+		Description:    req.Description,
+		ReleaseYear:    req.ReleaseYear,
+		Duration:       req.Duration,
+		PosterURL:      req.PosterURL,
+		VideoURL:       req.VideoURL,
+		CategoryRefs:   categoryRefs(req.CategoryIDs),
+		MaturityRating: req.MaturityRating,
+		Status:         models.MovieStatusDraft,
+		AvailableFrom:  req.AvailableFrom,
+		AvailableUntil: req.AvailableUntil,
+	}
+
+	if err := h.movieService.CreateMovie(r.Context(), movie); err != nil {
+		if errors.Is(err, services.ErrMovieExists) {
+			sendError(w, r, CodeMovieExists, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movie)
+}
+
+// UpdateDraft godoc
+// @Summary Update a movie in the publication workflow
+// @Description Update the details of a movie. Editors may only change drafts; publishers and admins may change a movie in any status.
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param movie body UpdateMovieRequest true "Movie details to update"
+// @Success 200 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /content/movies/{id} [put]
+func (h *ContentHandler) UpdateDraft(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	role, err := h.workflowService.ContentRole(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+	movie, err := h.movieService.GetMovie(r.Context(), id)
+	if err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+	if err := h.workflowService.CheckEditable(role, movie); err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+
+	req.apply(movie)
+	if err := h.movieService.UpdateMovie(r.Context(), movie); err != nil {
+		if errors.Is(err, services.ErrMovieTitleTaken) {
+			sendError(w, r, CodeMovieTitleTaken, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movie)
+}
+
+// SetMovieStatus godoc
+// @Summary Move a movie through the publication workflow
+// @Description Change the publication status of a movie. Editors may submit drafts for review and withdraw them; publishers and admins may also publish movies in review, schedule them to be published at publish_at, send them back to draft, archive published movies and revive archived ones. Scheduled movies are published by a background job once publish_at has passed, and may be rescheduled, published at once or sent back to review until then. Every change is recorded in the audit log.
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param request body SetMovieStatusRequest true "New status"
+// @Success 200 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /content/movies/{id}/status [put]
+func (h *ContentHandler) SetMovieStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	var req SetMovieStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.workflowService.SetStatus(r.Context(), id, req.Status, req.PublishAt)
+	if err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movie)
+}
+
+// PublishMovie godoc
+// @Summary Publish a movie
+// @Description Publish a movie in review, scheduled or archived at once
+// @Tags content
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/publish [post]
+func (h *ContentHandler) PublishMovie(w http.ResponseWriter, r *http.Request) {
+	h.moveMovie(w, r, models.MovieStatusPublished, nil)
+}
+
+// ScheduleMovie godoc
+// @Summary Schedule a movie
+// @Description Schedule a movie in review or archived to be published at publish_at, or move the publish_at of a scheduled movie
+// @Tags content
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param request body ScheduleMovieRequest true "Time to publish at"
+// @Success 200 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/schedule [post]
+func (h *ContentHandler) ScheduleMovie(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.PublishAt == nil {
+		sendError(w, r, CodeInvalidPublishAt, http.StatusBadRequest)
+		return
+	}
+
+	h.moveMovie(w, r, models.MovieStatusScheduled, req.PublishAt)
+}
+
+// ArchiveMovie godoc
+// @Summary Archive a movie
+// @Description Withdraw a published movie from public listings, keeping it to revive later
+// @Tags content
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {object} models.Movie
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/archive [post]
+func (h *ContentHandler) ArchiveMovie(w http.ResponseWriter, r *http.Request) {
+	h.moveMovie(w, r, models.MovieStatusArchived, nil)
+}
+
+// moveMovie moves the movie in the path to status, through the workflow
+func (h *ContentHandler) moveMovie(w http.ResponseWriter, r *http.Request, status string, publishAt *time.Time) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.workflowService.SetStatus(r.Context(), id, status, publishAt)
+	if err != nil {
+		h.sendWorkflowError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movie)
+}
+
+func (h *ContentHandler) sendWorkflowError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidMovieStatus):
+		sendError(w, r, CodeInvalidMovieStatus, http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidPublishAt):
+		sendError(w, r, CodeInvalidPublishAt, http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidTransition):
+		sendError(w, r, CodeInvalidTransition, http.StatusConflict)
+	case errors.Is(err, services.ErrMovieNotEditable):
+		sendError(w, r, CodeMovieNotEditable, http.StatusConflict)
+	case errors.Is(err, services.ErrTransitionForbidden):
+		sendError(w, r, CodeTransitionForbidden, http.StatusForbidden)
+	case errors.Is(err, services.ErrContentRoleRequired):
+		sendError(w, r, CodeContentRoleRequired, http.StatusForbidden)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
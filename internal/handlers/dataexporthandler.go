@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type DataExportHandler struct {
+	dataExportService *services.DataExportService
+	logger            *zap.Logger
+}
+
+func NewDataExportHandler(dataExportService *services.DataExportService, logger *zap.Logger) *DataExportHandler {
+	return &DataExportHandler{
+		dataExportService: dataExportService,
+		logger:            logger,
+	}
+}
+
+// RequestExport godoc
+// @Summary Export the user's data
+// @Description Queue an archive of the authenticated user's data: their account and viewer profiles, favorites, watch history and reviews, as JSON files in a ZIP archive. It is built in the background; poll the export at the Location returned until it is ready, or wait for the export.ready notification. While an export is queued or running, it is returned instead of queueing another.
+// @Tags users
+// @Produce json
+// @Success 202 {object} services.DataExportStatus
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/export [post]
+func (h *DataExportHandler) RequestExport(w http.ResponseWriter, r *http.Request) {
+	export, err := h.dataExportService.RequestExport(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendDataExportError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/api/users/export/%d", export.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+// GetExport godoc
+// @Summary Get a data export
+// @Description Get the status of one of the user's data exports: queued, running, ready, failed or expired. Once ready, download_url is a signed link the archive is downloaded from, without credentials, until download_expires_at; each request issues a new one. Archives are deleted at expires_at.
+// @Tags users
+// @Produce json
+// @Param id path int true "Data export ID"
+// @Success 200 {object} services.DataExportStatus
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/export/{id} [get]
+func (h *DataExportHandler) GetExport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidExportID, http.StatusBadRequest)
+		return
+	}
+
+	export, err := h.dataExportService.GetExport(r.Context(), services.UserIDFromContext(r.Context()), id)
+	if err != nil {
+		h.sendDataExportError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(export)
+}
+
+func (h *DataExportHandler) sendDataExportError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrDataExportNotFound):
+		sendError(w, r, CodeDataExportNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrStorageDisabled):
+		sendError(w, r, CodeStorageDisabled, http.StatusServiceUnavailable)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
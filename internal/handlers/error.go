@@ -1,6 +1,64 @@
 package handlers
 
-// ErrorResponse represents an error response
-type ErrorResponse struct {
-	Error string `json:"error" example:"Invalid request parameters"`
+import (
+	"errors"
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/errorreporting"
+	"github.com/ndn/internal/patch"
+	"github.com/ndn/internal/requestlog"
+	"github.com/ndn/internal/tracecontext"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"go.uber.org/zap"
+)
+
+// sendError writes a problem response with code and its message in the
+// request's locale. args are substituted into the message as name/value
+// pairs, see i18n.Message.
+func sendError(w http.ResponseWriter, r *http.Request, code string, status int, args ...interface{}) {
+	apierror.Write(w, r, status, code, args...)
+}
+
+// logError records an unexpected error with its operation chain and stack
+// trace, notices it on the request's New Relic transaction if present, and
+// captures it for the error report of the request.
+// It logs with the request-scoped logger, which carries the request ID and
+// user, when there is one. The error details are never sent to the client.
+func logError(logger *zap.Logger, r *http.Request, err error) {
+	fields := apperrors.Fields(err)
+	if reqLogger := requestlog.FromContext(r.Context(), nil); reqLogger != nil {
+		logger = reqLogger
+	} else {
+		fields = append(fields,
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.String("request_id", middleware.GetReqID(r.Context())),
+		)
+	}
+	if tc, ok := tracecontext.FromContext(r.Context()); ok {
+		fields = append(fields, zap.String("trace_id", tc.TraceIDString()))
+	}
+	logger.Error("request failed", fields...)
+
+	if txn := newrelic.FromContext(r.Context()); txn != nil {
+		txn.NoticeError(err)
+	}
+	errorreporting.CaptureError(r.Context(), err)
+}
+
+// sendPatchError maps a failure to apply a patch body to a client error
+func sendPatchError(w http.ResponseWriter, r *http.Request, err error) {
+	var opErr *patch.OperationError
+	switch {
+	case errors.Is(err, patch.ErrUnsupportedPatch):
+		sendError(w, r, CodeUnsupportedPatchType, http.StatusUnsupportedMediaType,
+			"types", patch.MergePatchContentType+" or "+patch.JSONPatchContentType)
+	case errors.As(err, &opErr):
+		sendError(w, r, CodePatchFailed, http.StatusUnprocessableEntity, "detail", opErr)
+	default:
+		sendError(w, r, CodeInvalidPatch, http.StatusBadRequest)
+	}
 }
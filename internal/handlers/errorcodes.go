@@ -0,0 +1,218 @@
+package handlers
+
+// Error codes sent with every error response. They are stable for clients to
+// act on; the messages they map to are translated in internal/i18n/locales.
+const (
+	CodeInternalError              = "internal_error"
+	CodeInvalidRequestBody         = "invalid_request_body"
+	CodeUnauthorized               = "unauthorized"
+	CodeMissingAuthorization       = "missing_authorization"
+	CodeInvalidToken               = "invalid_token"
+	CodeAdminRequired              = "admin_required"
+	CodeInvalidCredentials         = "invalid_credentials"
+	CodeCredentialsRequired        = "credentials_required"
+	CodeRegistrationFieldsRequired = "registration_fields_required"
+	CodeEmailTaken                 = "email_taken"
+	CodeInvalidAPIKey              = "invalid_api_key"
+	CodeInvalidAPIKeyID            = "invalid_api_key_id"
+	CodeAPIKeyNotFound             = "api_key_not_found"
+	CodeAPIKeyNameRequired         = "api_key_name_required"
+	CodeAPIKeyQuotaExceeded        = "api_key_quota_exceeded"
+	CodeNegativeQuota              = "negative_quota"
+	CodeInvalidUserID              = "invalid_user_id"
+	CodeUserNotFound               = "user_not_found"
+	CodeNameRequired               = "name_required"
+	CodeInvalidMovieID             = "invalid_movie_id"
+	CodeMovieNotFound              = "movie_not_found"
+	CodeMovieExists                = "movie_exists"
+	CodeMovieTitleTaken            = "movie_title_taken"
+	CodeTitleRequired              = "title_required"
+	CodeTitleCannotBeCleared       = "title_cannot_be_cleared"
+	CodeInvalidExternalID          = "invalid_external_id"
+	CodeMovieIDsRequired           = "movie_ids_required"
+	CodeTooManyMovieIDs            = "too_many_movie_ids"
+	CodeIDsOrFilterRequired        = "ids_or_filter_required"
+	CodeIDsAndFilter               = "ids_and_filter"
+	CodeTooManyFilterMatches       = "too_many_filter_matches"
+	CodeInvalidBulkAction          = "invalid_bulk_action"
+	CodeInvalidCategoryID          = "invalid_category_id"
+	CodeCategoryNotFound           = "category_not_found"
+	CodeCategoryExists             = "category_exists"
+	CodeCategoryNameRequired       = "category_name_required"
+	CodeCategoryInUse              = "category_in_use"
+	CodeInvalidCategoryOrder       = "invalid_category_order"
+	CodeInvalidStatsInterval       = "invalid_stats_interval"
+	CodeInvalidPeriods             = "invalid_periods"
+	CodeInvalidPatch               = "invalid_patch"
+	CodeUnsupportedPatchType       = "unsupported_patch_type"
+	CodePatchFailed                = "patch_failed"
+	CodeInvalidPatchedMovie        = "invalid_patched_movie"
+	CodeInvalidPatchedProfile      = "invalid_patched_profile"
+	CodeEmbeddingsDisabled         = "embeddings_disabled"
+	CodeEmbeddingJobRunning        = "embedding_job_running"
+	CodeInvalidTrendingSettings    = "invalid_trending_settings"
+	CodeInvalidBoostID             = "invalid_boost_id"
+	CodeBoostNotFound              = "boost_not_found"
+	CodeInvalidBoost               = "invalid_boost"
+	CodeInvalidSearchTerm          = "invalid_search_term"
+	CodeInvalidSearchTypes         = "invalid_search_types"
+	CodeInvalidSynonymID           = "invalid_synonym_id"
+	CodeSynonymNotFound            = "synonym_not_found"
+	CodeSynonymExists              = "synonym_exists"
+	CodeInvalidSynonym             = "invalid_synonym"
+	CodeInvalidFlagID              = "invalid_flag_id"
+	CodeFlagNotFound               = "flag_not_found"
+	CodeInvalidFlagStatus          = "invalid_flag_status"
+	CodeEventsRequired             = "events_required"
+	CodeTooManyEvents              = "too_many_events"
+	CodeInvalidEvent               = "invalid_event"
+	CodeIngestionOverloaded        = "ingestion_overloaded"
+	CodeInvalidPeriod              = "invalid_period"
+	CodeInvalidFrom                = "invalid_from"
+	CodeInvalidMetric              = "invalid_metric"
+	CodeExportSinkNotFound         = "export_sink_not_found"
+	CodeInvalidViewingPeriod       = "invalid_viewing_period"
+	CodeInvalidRole                = "invalid_role"
+	CodeContentRoleRequired        = "content_role_required"
+	CodeInvalidMovieStatus         = "invalid_movie_status"
+	CodeInvalidTransition          = "invalid_transition"
+	CodeTransitionForbidden        = "transition_forbidden"
+	CodeMovieNotEditable           = "movie_not_editable"
+	CodeInvalidAvailability        = "invalid_availability"
+	CodeInvalidProgress            = "invalid_progress"
+	CodeInvalidReviewID            = "invalid_review_id"
+	CodeInvalidReview              = "invalid_review"
+	CodeReviewExists               = "review_exists"
+	CodeReviewForbidden            = "review_forbidden"
+	CodeReviewNotFound             = "review_not_found"
+	CodeContentRejected            = "content_rejected"
+	CodeRefreshTokenRequired       = "refresh_token_required"
+	CodeEmailRequired              = "email_required"
+	CodeInvalidResetToken          = "invalid_reset_token"
+	CodePasswordTooShort           = "password_too_short"
+	CodeUnknownOAuthProvider       = "unknown_oauth_provider"
+	CodeInvalidOAuthState          = "invalid_oauth_state"
+	CodeOAuthDenied                = "oauth_denied"
+	CodeOAuthEmailUnverified       = "oauth_email_unverified"
+	CodeOAuthFailed                = "oauth_failed"
+	CodeValidationFailed           = "validation_failed"
+	CodeInvalidSeriesID            = "invalid_series_id"
+	CodeSeriesNotFound             = "series_not_found"
+	CodeSeriesExists               = "series_exists"
+	CodeInvalidSeasonID            = "invalid_season_id"
+	CodeInvalidSeasonNumber        = "invalid_season_number"
+	CodeSeasonNotFound             = "season_not_found"
+	CodeSeasonExists               = "season_exists"
+	CodeInvalidEpisodeID           = "invalid_episode_id"
+	CodeEpisodeNotFound            = "episode_not_found"
+	CodeEpisodeExists              = "episode_exists"
+	CodeStorageDisabled            = "storage_disabled"
+	CodePosterRequired             = "poster_required"
+	CodePosterTooLarge             = "poster_too_large"
+	CodeUnsupportedPosterType      = "unsupported_poster_type"
+	CodeUnsupportedVideoType       = "unsupported_video_type"
+	CodeVideoTooLarge              = "video_too_large"
+	CodeVideoProcessing            = "video_processing"
+	CodeVideoNotUploading          = "video_not_uploading"
+	CodeVideoNotUploaded           = "video_not_uploaded"
+	CodePlaybackDisabled           = "playback_disabled"
+	CodeNoVideo                    = "no_video"
+	CodeInvalidPlaybackToken       = "invalid_playback_token"
+	CodePlaybackTokenExpired       = "playback_token_expired"
+	CodeVideoFileNotFound          = "video_file_not_found"
+	CodeVideoUnavailable           = "video_unavailable"
+	CodeNotLocalVideo              = "not_local_video"
+	CodeLocalVideosDisabled        = "local_videos_disabled"
+	CodeSubtitleRequired           = "subtitle_required"
+	CodeSubtitleTooLarge           = "subtitle_too_large"
+	CodeInvalidSubtitle            = "invalid_subtitle"
+	CodeInvalidSubtitleLanguage    = "invalid_subtitle_language"
+	CodeInvalidSubtitleLabel       = "invalid_subtitle_label"
+	CodeSubtitleNotFound           = "subtitle_not_found"
+	CodeInvalidLocale              = "invalid_locale"
+	CodeInvalidTranslation         = "invalid_translation"
+	CodeTranslationNotFound        = "translation_not_found"
+	CodeInvalidTMDBID              = "invalid_tmdb_id"
+	CodeTMDBDisabled               = "tmdb_disabled"
+	CodeTMDBMovieNotFound          = "tmdb_movie_not_found"
+	CodeTMDBUnavailable            = "tmdb_unavailable"
+	CodeIncompleteTMDBMovie        = "incomplete_tmdb_movie"
+	CodeWebSocketRequired          = "websocket_required"
+	CodeInvalidAnnouncement        = "invalid_announcement"
+	CodeInvalidProfileID           = "invalid_profile_id"
+	CodeInvalidProfile             = "invalid_profile"
+	CodeProfileNotFound            = "profile_not_found"
+	CodeProfileNameTaken           = "profile_name_taken"
+	CodeTooManyProfiles            = "too_many_profiles"
+	CodeInvalidMaturityRating      = "invalid_maturity_rating"
+	CodeInvalidPIN                 = "invalid_pin"
+	CodePINRequired                = "pin_required"
+	CodeSubscriptionRequired       = "subscription_required"
+	CodeBillingDisabled            = "billing_disabled"
+	CodeBillingUnavailable         = "billing_unavailable"
+	CodeInvalidPlan                = "invalid_plan"
+	CodePlanNotFound               = "plan_not_found"
+	CodePlanPriceTaken             = "plan_price_taken"
+	CodeSubscriptionNotFound       = "subscription_not_found"
+	CodeAlreadySubscribed          = "already_subscribed"
+	CodeFeatureNotInPlan           = "feature_not_in_plan"
+	CodeTooManyStreams             = "too_many_streams"
+	CodeQualityNotInPlan           = "quality_not_in_plan"
+	CodeInvalidCoupon              = "invalid_coupon"
+	CodeCouponNotFound             = "coupon_not_found"
+	CodeCouponCodeTaken            = "coupon_code_taken"
+	CodeCouponExpired              = "coupon_expired"
+	CodeCouponExhausted            = "coupon_exhausted"
+	CodeCouponAlreadyRedeemed      = "coupon_already_redeemed"
+	CodeCouponNotApplicable        = "coupon_not_applicable"
+	CodeStreamNotFound             = "stream_not_found"
+	CodeStreamNotStarted           = "stream_not_started"
+	CodeInvalidDeviceID            = "invalid_device_id"
+	CodeDeviceNotFound             = "device_not_found"
+	CodeLoginThrottled             = "login_throttled"
+	CodeAccountLocked              = "account_locked"
+	CodePasswordTooLong            = "password_too_long"
+	CodePasswordTooWeak            = "password_too_weak"
+	CodeAccountSuspended           = "account_suspended"
+	CodeSelfModification           = "self_modification"
+	CodeUserStatusRequired         = "user_status_required"
+	CodeInvalidUserFilter          = "invalid_user_filter"
+	CodeAccountDeleted             = "account_deleted"
+	CodeInvalidExportID            = "invalid_export_id"
+	CodeDataExportNotFound         = "data_export_not_found"
+	CodeEmailUnchanged             = "email_unchanged"
+	CodeInvalidEmailChangeToken    = "invalid_email_change_token"
+	CodeWrongPassword              = "wrong_password"
+	CodePasswordReused             = "password_reused"
+	CodeAvatarRequired             = "avatar_required"
+	CodeAvatarTooLarge             = "avatar_too_large"
+	CodeAvatarDimensionsTooLarge   = "avatar_dimensions_too_large"
+	CodeUnsupportedAvatarType      = "unsupported_avatar_type"
+	CodeInvalidDateOfBirth         = "invalid_date_of_birth"
+	CodeCategorySlugTaken          = "category_slug_taken"
+	CodeInvalidCategoryName        = "invalid_category_name"
+	CodeParentCategoryNotFound     = "parent_category_not_found"
+	CodeCategoryCycle              = "category_cycle"
+	CodeCategoryHasChildren        = "category_has_children"
+	CodeUnknownCategory            = "unknown_category"
+	CodeCollectionNotFound         = "collection_not_found"
+	CodeInvalidCollectionID        = "invalid_collection_id"
+	CodeCollectionSlugTaken        = "collection_slug_taken"
+	CodeInvalidCollectionSlug      = "invalid_collection_slug"
+	CodeInvalidCollectionOrder     = "invalid_collection_order"
+	CodeInvalidCollectionMovies    = "invalid_collection_movies"
+	CodeInvalidTrendingWindow      = "invalid_trending_window"
+	CodeFeaturedSlotNotFound       = "featured_slot_not_found"
+	CodeInvalidFeaturedSlotID      = "invalid_featured_slot_id"
+	CodeInvalidFeaturedSlot        = "invalid_featured_slot"
+	CodeFeaturedTargetNotFound     = "featured_target_not_found"
+	CodeInvalidPublishAt           = "invalid_publish_at"
+	CodeNotDeleted                 = "not_deleted"
+	CodeInvalidAuditFilter         = "invalid_audit_filter"
+	CodeInvalidMovieFilter         = "invalid_movie_filter"
+	CodeEmptyMovieFilterRange      = "empty_movie_filter_range"
+	CodeConflictingMovieFilters    = "conflicting_movie_filters"
+	CodeInvalidMovieSort           = "invalid_movie_sort"
+	CodeUnknownMovieField          = "unknown_movie_field"
+	CodeUnknownMovieInclude        = "unknown_movie_include"
+)
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// eventKeepAlive is how often idle streams get a comment, so proxies
+	// keep them open and disconnected clients are noticed
+	eventKeepAlive = 15 * time.Second
+	// eventWriteWait bounds each write to a stream
+	eventWriteWait = 10 * time.Second
+	// eventRetry is how long browsers wait before reconnecting, in
+	// milliseconds
+	eventRetry = 5000
+	// releaseEvent is the type of the events of the releases stream
+	releaseEvent = "release"
+)
+
+type EventHandler struct {
+	releases *services.ReleaseFeed
+	logger   *zap.Logger
+}
+
+func NewEventHandler(releases *services.ReleaseFeed, logger *zap.Logger) *EventHandler {
+	return &EventHandler{
+		releases: releases,
+		logger:   logger,
+	}
+}
+
+// Releases godoc
+// @Summary Stream new releases
+// @Description Server-Sent Events stream with a "release" event, whose data is the movie, every time a movie is added to the public catalog. Only movies added after connecting are sent; use /movies/recently-added for the ones before. Movies scheduled for later are not sent when they become available.
+// @Tags movies
+// @Produce text/event-stream
+// @Success 200 {object} services.Release
+// @Failure 500 {object} apierror.Problem
+// @Router /events/releases [get]
+func (h *EventHandler) Releases(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	releases, unsubscribe := h.releases.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keep proxies such as nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) error {
+		// Each write gets its own deadline, past the server's write timeout
+		if err := rc.SetWriteDeadline(time.Now().Add(eventWriteWait)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	if err := write("retry: %d\n\n", eventRetry); err != nil {
+		h.logger.Warn("failed to start event stream", zap.Error(err))
+		return
+	}
+
+	// The stream outlasts the request timeout, which cancels the request's
+	// context, so a client that left is noticed when writing to it fails
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case release, ok := <-releases:
+			// The client fell behind or the server is shutting down; it
+			// reconnects after eventRetry
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(release)
+			if err != nil {
+				h.logger.Error("failed to encode release", zap.Error(err))
+				continue
+			}
+			if err := write("id: %d\nevent: %s\ndata: %s\n\n", release.ID, releaseEvent, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if err := write(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
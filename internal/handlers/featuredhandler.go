@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type FeaturedHandler struct {
+	featuredService *services.FeaturedService
+	logger          *zap.Logger
+}
+
+func NewFeaturedHandler(featuredService *services.FeaturedService, logger *zap.Logger) *FeaturedHandler {
+	return &FeaturedHandler{
+		featuredService: featuredService,
+		logger:          logger,
+	}
+}
+
+// FeaturedSlotRequest features a movie or a collection, one of MovieID and
+// CollectionID, in the banners of the home page
+type FeaturedSlotRequest struct {
+	MovieID      *int64     `json:"movie_id,omitempty" example:"42"`
+	CollectionID *int64     `json:"collection_id,omitempty" example:"3"`
+	Headline     string     `json:"headline,omitempty" example:"Now streaming"`
+	ImageURL     string     `json:"image_url,omitempty" example:"https://cdn.example.com/banners/42.jpg"`
+	Priority     int        `json:"priority,omitempty" example:"10"` // higher first
+	StartsAt     *time.Time `json:"starts_at,omitempty" example:"2024-12-01T00:00:00Z"`
+	EndsAt       *time.Time `json:"ends_at,omitempty" example:"2024-12-27T00:00:00Z"`
+}
+
+func (req *FeaturedSlotRequest) slot() *models.FeaturedSlot {
+	slot := &models.FeaturedSlot{
+		MovieID:      req.MovieID,
+		CollectionID: req.CollectionID,
+		Headline:     req.Headline,
+		ImageURL:     req.ImageURL,
+		Priority:     req.Priority,
+	}
+	if req.StartsAt != nil {
+		slot.StartsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil {
+		slot.EndsAt = *req.EndsAt
+	}
+	return slot
+}
+
+// FeaturedResponse is a banner of the home page, with the movie or the
+// collection it features
+type FeaturedResponse struct {
+	ID         int64                       `json:"id" example:"1"`
+	Headline   string                      `json:"headline" example:"Now streaming"`
+	ImageURL   string                      `json:"image_url,omitempty" example:"https://cdn.example.com/banners/42.jpg"`
+	Priority   int                         `json:"priority" example:"10"`
+	EndsAt     *time.Time                  `json:"ends_at,omitempty" example:"2024-12-27T00:00:00Z"`
+	Movie      *MovieResponse              `json:"movie,omitempty"`
+	Collection *FeaturedCollectionResponse `json:"collection,omitempty"`
+}
+
+// FeaturedCollectionResponse is a collection featured in a banner, whose
+// movies are listed by GET /collections/{slug}
+type FeaturedCollectionResponse struct {
+	ID          int64  `json:"id" example:"3"`
+	Slug        string `json:"slug" example:"staff-picks"`
+	Title       string `json:"title" example:"Staff Picks"`
+	Description string `json:"description,omitempty" example:"Favorites of the team"`
+}
+
+// GetFeatured godoc
+// @Summary Get the featured banners
+// @Description Get the banners of the home page in effect now, by descending priority, each featuring a movie or a collection. Banners of movies that are not published or above the rating ceiling of the profile, and of hidden collections, are left out.
+// @Tags featured
+// @Produce json
+// @Success 200 {array} FeaturedResponse
+// @Failure 500 {object} apierror.Problem
+// @Router /featured [get]
+func (h *FeaturedHandler) GetFeatured(w http.ResponseWriter, r *http.Request) {
+	items, err := h.featuredService.ActiveSlots(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]FeaturedResponse, len(items))
+	for i, item := range items {
+		response[i] = FeaturedResponse{
+			ID:       item.ID,
+			Headline: item.Headline,
+			ImageURL: item.ImageURL,
+			Priority: item.Priority,
+		}
+		if !item.EndsAt.IsZero() {
+			response[i].EndsAt = &item.EndsAt
+		}
+		if movie := item.Movie; movie != nil {
+			response[i].Movie = &MovieResponse{
+				ID:             movie.ID,
+				Title:          movie.Title,
+				Description:    movie.Description,
+				ReleaseYear:    movie.ReleaseYear,
+				Duration:       movie.Duration,
+				PosterURL:      movie.PosterURL,
+				Categories:     movieCategories(movie.CategoryRefs),
+				MaturityRating: movie.MaturityRating,
+				Rating:         movie.Rating,
+			}
+		}
+		if collection := item.Collection; collection != nil {
+			response[i].Collection = &FeaturedCollectionResponse{
+				ID:          collection.ID,
+				Slug:        collection.Slug,
+				Title:       collection.Title,
+				Description: collection.Description,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ListFeaturedSlots godoc
+// @Summary List featured slots
+// @Description Get every scheduled banner of the home page, by descending priority
+// @Tags featured
+// @Produce json
+// @Param active query bool false "Only list slots in effect now"
+// @Success 200 {array} models.FeaturedSlot
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/featured [get]
+func (h *FeaturedHandler) ListFeaturedSlots(w http.ResponseWriter, r *http.Request) {
+	activeOnly, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+
+	slots, err := h.featuredService.ListSlots(r.Context(), activeOnly)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slots)
+}
+
+// CreateFeaturedSlot godoc
+// @Summary Create a featured slot
+// @Description Feature a movie or a collection, one of movie_id and collection_id, in the banners of the home page, optionally between starts_at and ends_at. headline and image_url default to the title and poster of the target.
+// @Tags featured
+// @Accept json
+// @Produce json
+// @Param request body FeaturedSlotRequest true "Featured slot"
+// @Success 201 {object} models.FeaturedSlot
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/featured [post]
+func (h *FeaturedHandler) CreateFeaturedSlot(w http.ResponseWriter, r *http.Request) {
+	var req FeaturedSlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	slot := req.slot()
+	if err := h.featuredService.CreateSlot(r.Context(), slot); err != nil {
+		h.sendFeaturedError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(slot)
+}
+
+// UpdateFeaturedSlot godoc
+// @Summary Update a featured slot
+// @Description Replace a featured slot, including its schedule
+// @Tags featured
+// @Accept json
+// @Produce json
+// @Param id path int true "Featured slot ID"
+// @Param request body FeaturedSlotRequest true "Featured slot"
+// @Success 200 {object} models.FeaturedSlot
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/featured/{id} [put]
+func (h *FeaturedHandler) UpdateFeaturedSlot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidFeaturedSlotID, http.StatusBadRequest)
+		return
+	}
+
+	var req FeaturedSlotRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	slot := req.slot()
+	slot.ID = id
+	if err := h.featuredService.UpdateSlot(r.Context(), slot); err != nil {
+		h.sendFeaturedError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slot)
+}
+
+// DeleteFeaturedSlot godoc
+// @Summary Delete a featured slot
+// @Tags featured
+// @Param id path int true "Featured slot ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/featured/{id} [delete]
+func (h *FeaturedHandler) DeleteFeaturedSlot(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidFeaturedSlotID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.featuredService.DeleteSlot(r.Context(), id); err != nil {
+		h.sendFeaturedError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *FeaturedHandler) sendFeaturedError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFeaturedSlot):
+		sendError(w, r, CodeInvalidFeaturedSlot, http.StatusBadRequest)
+	case errors.Is(err, services.ErrFeaturedTargetNotFound):
+		sendError(w, r, CodeFeaturedTargetNotFound, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeFeaturedSlotNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/ndn/internal/health"
+	"net/http"
+)
+
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+// Live godoc
+// @Summary Liveness probe
+// @Description Reports that the process is running
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /health/live [get]
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "up"})
+}
+
+// Ready godoc
+// @Summary Readiness probe
+// @Description Reports per-dependency status. Returns 200 when up or degraded and 503 when a critical dependency is down
+// @Tags health
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /health/ready [get]
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	report := h.checker.Report()
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status == health.StatusDown {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type ImportHandler struct {
+	importService *services.ImportService
+	logger        *zap.Logger
+}
+
+func NewImportHandler(importService *services.ImportService, logger *zap.Logger) *ImportHandler {
+	return &ImportHandler{
+		importService: importService,
+		logger:        logger,
+	}
+}
+
+// TMDBImportResponse is a movie imported from TMDB. unmapped_genres lists
+// its TMDB genres that matched no local category, for admins to create.
+type TMDBImportResponse struct {
+	Movie          MovieResponse `json:"movie"`
+	Created        bool          `json:"created" example:"true"`
+	UnmappedGenres []string      `json:"unmapped_genres,omitempty" example:"Science Fiction"`
+}
+
+// ImportTMDB godoc
+// @Summary Import a movie from TMDB
+// @Description Create a movie from its metadata on The Movie Database (title, overview, release year, runtime, poster and genres), or update the movie imported before from the same TMDB ID. Genres become the local categories of the same name; the video, availability window and categories added locally are kept on updates. Safe to repeat.
+// @Tags movies
+// @Produce json
+// @Param tmdbID path int true "TMDB movie ID"
+// @Success 200 {object} TMDBImportResponse "Updated"
+// @Success 201 {object} TMDBImportResponse "Created"
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/import/tmdb/{tmdbID} [post]
+func (h *ImportHandler) ImportTMDB(w http.ResponseWriter, r *http.Request) {
+	tmdbID, err := strconv.ParseInt(chi.URLParam(r, "tmdbID"), 10, 64)
+	if err != nil || tmdbID <= 0 {
+		sendError(w, r, CodeInvalidTMDBID, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.importService.ImportTMDB(r.Context(), tmdbID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrImportDisabled):
+			sendError(w, r, CodeTMDBDisabled, http.StatusServiceUnavailable)
+		case errors.Is(err, integrations.ErrTMDBNotFound):
+			sendError(w, r, CodeTMDBMovieNotFound, http.StatusNotFound)
+		case errors.Is(err, integrations.ErrTMDBUnavailable):
+			logError(h.logger, r, err)
+			sendError(w, r, CodeTMDBUnavailable, http.StatusBadGateway)
+		case errors.Is(err, services.ErrIncompleteImport):
+			sendError(w, r, CodeIncompleteTMDBMovie, http.StatusUnprocessableEntity)
+		case errors.Is(err, services.ErrMovieTitleTaken):
+			sendError(w, r, CodeMovieTitleTaken, http.StatusConflict)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	movie := result.Movie
+	response := TMDBImportResponse{
+		Movie: MovieResponse{
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			VideoURL:       movie.VideoURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
+		},
+		Created:        result.Created,
+		UnmappedGenres: result.UnmappedGenres,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// ListMeta counts the items of a list response. Page, PageSize and
+// TotalPages are only set for paginated lists.
+type ListMeta struct {
+	Total      int `json:"total" example:"42"`
+	Page       int `json:"page,omitempty" example:"1"`
+	PageSize   int `json:"page_size,omitempty" example:"20"`
+	TotalPages int `json:"total_pages,omitempty" example:"3"`
+}
+
+// ListLinks are the URLs of the pages before and after a page of a list,
+// with the same query, left out at either end of the list
+type ListLinks struct {
+	Next string `json:"next,omitempty" example:"/api/movies?page=2&page_size=20"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// listResponse is the envelope every list response shares: the items in
+// data, their count in meta, and for pages the links to the pages next to it
+type listResponse struct {
+	Data  interface{} `json:"data"`
+	Meta  ListMeta    `json:"meta"`
+	Links *ListLinks  `json:"links,omitempty"`
+}
+
+// renderList writes a list that is not paginated, data being a slice
+func renderList(w http.ResponseWriter, data interface{}, total int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listResponse{
+		Data: data,
+		Meta: ListMeta{Total: total},
+	})
+}
+
+// renderPage writes the page of a paginated list holding data, out of total
+// items in pages of pageSize
+func renderPage(w http.ResponseWriter, r *http.Request, data interface{}, total, page, pageSize int) {
+	meta := ListMeta{Total: total, Page: page, PageSize: pageSize}
+	if pageSize > 0 {
+		meta.TotalPages = (total + pageSize - 1) / pageSize
+	}
+
+	links := &ListLinks{}
+	if page < meta.TotalPages {
+		links.Next = pageURL(r, page+1)
+	}
+	if page > 1 {
+		links.Prev = pageURL(r, min(page-1, max(meta.TotalPages, 1)))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(listResponse{
+		Data:  data,
+		Meta:  meta,
+		Links: links,
+	})
+}
+
+// pageURL returns the URL of r asking for another page
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	return r.URL.Path + "?" + query.Encode()
+}
+
+// effectivePageSize returns the size of the pages a service serves when
+// asked for requested items per page, def when not set and at most limit
+func effectivePageSize(requested, def, limit int) int {
+	if requested <= 0 {
+		return def
+	}
+	return min(requested, limit)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type ModerationHandler struct {
+	contentFilter *services.ContentFilterService
+	logger        *zap.Logger
+}
+
+func NewModerationHandler(contentFilter *services.ContentFilterService, logger *zap.Logger) *ModerationHandler {
+	return &ModerationHandler{
+		contentFilter: contentFilter,
+		logger:        logger,
+	}
+}
+
+// CheckTextRequest is text to run through the content filter
+type CheckTextRequest struct {
+	Text string `json:"text" example:"Get free money at www.example.com"`
+}
+
+// ResolveFlagRequest is a moderator's decision on a flag
+type ResolveFlagRequest struct {
+	Status string `json:"status" example:"approved" enums:"pending,approved,removed"`
+}
+
+// CheckText godoc
+// @Summary Check text against the content filter
+// @Description Get the verdict the content filter would reach on a text, to try out wordlist and provider settings. Nothing is stored.
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param request body CheckTextRequest true "Text"
+// @Success 200 {object} services.Screening
+// @Failure 400 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/moderation/check [post]
+func (h *ModerationHandler) CheckText(w http.ResponseWriter, r *http.Request) {
+	var req CheckTextRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.contentFilter.Check(r.Context(), req.Text))
+}
+
+// GetFlags godoc
+// @Summary List flagged content
+// @Description Get the user-generated text the content filter held for review, oldest first
+// @Tags moderation
+// @Produce json
+// @Param status query string false "pending, approved or removed (default: all)"
+// @Success 200 {array} models.ContentFlag
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/moderation/flags [get]
+func (h *ModerationHandler) GetFlags(w http.ResponseWriter, r *http.Request) {
+	flags, err := h.contentFilter.ListFlags(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		h.sendFlagError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flags)
+}
+
+// ResolveFlag godoc
+// @Summary Resolve flagged content
+// @Description Record whether flagged text was approved or removed, or reopen it with pending
+// @Tags moderation
+// @Accept json
+// @Produce json
+// @Param id path int true "Flag ID"
+// @Param request body ResolveFlagRequest true "Decision"
+// @Success 200 {object} models.ContentFlag
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/moderation/flags/{id} [put]
+func (h *ModerationHandler) ResolveFlag(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidFlagID, http.StatusBadRequest)
+		return
+	}
+
+	var req ResolveFlagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	flag, err := h.contentFilter.ResolveFlag(r.Context(), id, req.Status)
+	if err != nil {
+		h.sendFlagError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(flag)
+}
+
+func (h *ModerationHandler) sendFlagError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidFlagStatus):
+		sendError(w, r, CodeInvalidFlagStatus, http.StatusBadRequest)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeFlagNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
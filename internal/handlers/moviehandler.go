@@ -1,66 +1,339 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
 	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/patch"
 	"github.com/ndn/internal/services"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 type MovieHandler struct {
-	movieService *services.MovieService
+	movieService     *services.MovieService
+	embeddingService *services.EmbeddingService
+	trendingService  *services.TrendingService
+	storageService   *services.StorageService
+	logger           *zap.Logger
 }
 
-func NewMovieHandler(movieService *services.MovieService) *MovieHandler {
+func NewMovieHandler(movieService *services.MovieService, embeddingService *services.EmbeddingService, trendingService *services.TrendingService, storageService *services.StorageService, logger *zap.Logger) *MovieHandler {
 	return &MovieHandler{
-		movieService: movieService,
+		movieService:     movieService,
+		embeddingService: embeddingService,
+		trendingService:  trendingService,
+		storageService:   storageService,
+		logger:           logger,
 	}
 }
 
+// CreateMovieRequest is a movie's details. Duration is in minutes, and the
+// release year, when given, must fall between the first films and 2100.
 type CreateMovieRequest struct {
-	Title       string   `json:"title" example:"The Matrix"`
-	Description string   `json:"description" example:"A computer programmer discovers a mysterious world..."`
-	ReleaseYear int      `json:"release_year" example:"1999"`
-	Duration    int      `json:"duration" example:"136"`
-	PosterURL   string   `json:"poster_url" example:"https://example.com/matrix.jpg"`
-	VideoURL    string   `json:"video_url" example:"https://example.com/matrix.mp4"`
-	Categories  []string `json:"categories" example:"['Action', 'Sci-Fi']"`
+	Title          string     `json:"title" example:"The Matrix" validate:"required,max=255"`
+	Description    string     `json:"description" example:"A computer programmer discovers a mysterious world..."`
+	ReleaseYear    int        `json:"release_year" example:"1999" validate:"omitempty,gte=1888,lte=2100"`
+	Duration       int        `json:"duration" example:"136" validate:"gt=0"`
+	PosterURL      string     `json:"poster_url" example:"https://example.com/matrix.jpg" validate:"omitempty,http_url"`
+	VideoURL       string     `json:"video_url" example:"https://example.com/matrix.mp4" validate:"omitempty,video_url"`
+	CategoryIDs    []int64    `json:"category_ids" example:"1,3"`
+	MaturityRating string     `json:"maturity_rating,omitempty" example:"R" enums:"G,PG,PG-13,R,NC-17"`
+	AvailableFrom  *time.Time `json:"available_from,omitempty" example:"2026-11-01T00:00:00Z"`
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
 }
 
 type UpdateMovieRequest struct {
-	Title       *string   `json:"title,omitempty" example:"The Matrix Reloaded"`
-	Description *string   `json:"description,omitempty"`
-	ReleaseYear *int      `json:"release_year,omitempty" example:"2003"`
-	Duration    *int      `json:"duration,omitempty" example:"138"`
-	PosterURL   *string   `json:"poster_url,omitempty"`
-	VideoURL    *string   `json:"video_url,omitempty"`
-	Categories  *[]string `json:"categories,omitempty"`
+	Title          *string    `json:"title,omitempty" example:"The Matrix Reloaded"`
+	Description    *string    `json:"description,omitempty"`
+	ReleaseYear    *int       `json:"release_year,omitempty" example:"2003"`
+	Duration       *int       `json:"duration,omitempty" example:"138"`
+	PosterURL      *string    `json:"poster_url,omitempty"`
+	VideoURL       *string    `json:"video_url,omitempty"`
+	CategoryIDs    *[]int64   `json:"category_ids,omitempty"`
+	MaturityRating *string    `json:"maturity_rating,omitempty" example:"R" enums:"G,PG,PG-13,R,NC-17"`
+	AvailableFrom  *time.Time `json:"available_from,omitempty" example:"2026-11-01T00:00:00Z"`
+	AvailableUntil *time.Time `json:"available_until,omitempty"`
 }
 
+// apply copies the fields set in the request onto movie
+func (req UpdateMovieRequest) apply(movie *models.Movie) {
+	if req.Title != nil {
+		movie.Title = *req.Title
+	}
+	if req.Description != nil {
+		movie.Description = *req.Description
+	}
+	if req.ReleaseYear != nil {
+		movie.ReleaseYear = *req.ReleaseYear
+	}
+	if req.Duration != nil {
+		movie.Duration = *req.Duration
+	}
+	if req.PosterURL != nil {
+		movie.PosterURL = *req.PosterURL
+	}
+	if req.VideoURL != nil {
+		movie.VideoURL = *req.VideoURL
+	}
+	if req.CategoryIDs != nil {
+		movie.CategoryRefs = categoryRefs(*req.CategoryIDs)
+	}
+	if req.MaturityRating != nil {
+		movie.MaturityRating = *req.MaturityRating
+	}
+	if req.AvailableFrom != nil {
+		movie.AvailableFrom = req.AvailableFrom
+	}
+	if req.AvailableUntil != nil {
+		movie.AvailableUntil = req.AvailableUntil
+	}
+}
+
+// MovieResponse is a movie's details. VideoURL is only shown to admins;
+// players get a signed URL from POST /movies/{id}/play instead.
 type MovieResponse struct {
-	ID          int64    `json:"id" example:"1"`
-	Title       string   `json:"title" example:"The Matrix"`
-	Description string   `json:"description"`
-	ReleaseYear int      `json:"release_year" example:"1999"`
-	Duration    int      `json:"duration" example:"136"`
-	PosterURL   string   `json:"poster_url"`
-	VideoURL    string   `json:"video_url"`
-	Categories  []string `json:"categories"`
-	Rating      float64  `json:"rating" example:"4.8"`
+	ID          int64                   `json:"id" example:"1"`
+	Title       string                  `json:"title" example:"The Matrix"`
+	Description string                  `json:"description"`
+	ReleaseYear int                     `json:"release_year" example:"1999"`
+	Duration    int                     `json:"duration" example:"136"`
+	PosterURL   string                  `json:"poster_url"`
+	VideoURL    string                  `json:"video_url,omitempty"`
+	Categories  []MovieCategoryResponse `json:"categories"`
+	// MaturityRating is one of G, PG, PG-13, R or NC-17, omitted when unrated
+	MaturityRating string  `json:"maturity_rating,omitempty" example:"R"`
+	Rating         float64 `json:"rating" example:"4.8"`
+}
+
+// MovieCategoryResponse is a category of a movie
+type MovieCategoryResponse struct {
+	ID   int64  `json:"id" example:"1"`
+	Name string `json:"name" example:"Action"`
+	Slug string `json:"slug" example:"action"`
+}
+
+// movieCategories returns the responses of the categories of a movie
+func movieCategories(categories []models.Category) []MovieCategoryResponse {
+	response := make([]MovieCategoryResponse, len(categories))
+	for i, category := range categories {
+		response[i] = MovieCategoryResponse{ID: category.ID, Name: category.Name, Slug: category.Slug}
+	}
+	return response
+}
+
+// movieFields are the fields of MovieResponse clients may select with
+// ?fields=. id is always returned, and categories are selected with ?include=.
+var movieFields = map[string]bool{
+	"id":              true,
+	"title":           true,
+	"description":     true,
+	"release_year":    true,
+	"duration":        true,
+	"poster_url":      true,
+	"maturity_rating": true,
+	"rating":          true,
+}
+
+// movieShape is the fields and relations of movies a client asks for with
+// ?fields= and ?include=, both comma-separated. Without fields every field is
+// returned. Without include, categories are embedded unless fields is set.
+type movieShape struct {
+	fields    map[string]bool // nil for every field
+	relations services.MovieRelations
+}
+
+// parseMovieShape reads the fields and include query parameters, sending an
+// error and returning false when they name unknown fields or relations
+func parseMovieShape(w http.ResponseWriter, r *http.Request) (movieShape, bool) {
+	query := r.URL.Query()
+
+	var shape movieShape
+	if query.Has("fields") {
+		shape.fields = map[string]bool{"id": true}
+		for _, field := range strings.Split(query.Get("fields"), ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			if !movieFields[field] {
+				sendError(w, r, CodeUnknownMovieField, http.StatusBadRequest, "field", field)
+				return shape, false
+			}
+			shape.fields[field] = true
+		}
+	}
+
+	include := "categories"
+	if query.Has("include") {
+		include = query.Get("include")
+	} else if shape.fields != nil {
+		include = ""
+	}
+	for _, relation := range strings.Split(include, ",") {
+		switch strings.TrimSpace(relation) {
+		case "":
+		case "categories":
+			shape.relations.Categories = true
+		default:
+			sendError(w, r, CodeUnknownMovieInclude, http.StatusBadRequest, "include", strings.TrimSpace(relation))
+			return shape, false
+		}
+	}
+	return shape, true
+}
+
+// apply returns movie with only the fields and relations of the shape
+func (s movieShape) apply(movie MovieResponse) (interface{}, error) {
+	if s.fields == nil && s.relations.Categories {
+		return movie, nil
+	}
+
+	data, err := json.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	for key := range values {
+		if key == "categories" {
+			if !s.relations.Categories {
+				delete(values, key)
+			}
+			continue
+		}
+		if s.fields != nil && !s.fields[key] {
+			delete(values, key)
+		}
+	}
+	return values, nil
+}
+
+// categoryRefs returns the categories of a movie with IDs ids, for
+// MovieService to link the movie to
+func categoryRefs(ids []int64) []models.Category {
+	categories := make([]models.Category, len(ids))
+	for i, id := range ids {
+		categories[i].ID = id
+	}
+	return categories
+}
+
+// categoryIDs returns the IDs of categories
+func categoryIDs(categories []models.Category) []int64 {
+	ids := make([]int64, len(categories))
+	for i, category := range categories {
+		ids[i] = category.ID
+	}
+	return ids
+}
+
+// UpcomingMovieResponse is a movie with the time it becomes available
+type UpcomingMovieResponse struct {
+	MovieResponse
+	AvailableFrom time.Time `json:"available_from" example:"2026-11-01T00:00:00Z"`
+}
+
+// UpcomingDayResponse is the movies becoming available on a day
+type UpcomingDayResponse struct {
+	Day    string                  `json:"day" example:"2026-11-01"`
+	Movies []UpcomingMovieResponse `json:"movies"`
+}
+
+type BulkMovieRequest struct {
+	IDs []int64 `json:"ids" example:"1,2,3"`
+}
+
+type BulkMovieResponse struct {
+	Results   []services.BulkItemResult `json:"results"`
+	Succeeded int                       `json:"succeeded" example:"2"`
+	Skipped   int                       `json:"skipped" example:"1"`
+}
+
+// BulkCategoryFilter selects movies the same way GET /movies does
+type BulkCategoryFilter struct {
+	Search     string   `json:"search,omitempty" example:"matrix"`
+	Year       *int     `json:"year,omitempty" example:"1999"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+type BulkCategoryRequest struct {
+	CategoryID int64               `json:"category_id" example:"3"`
+	Action     string              `json:"action" example:"add" enums:"add,remove"`
+	IDs        []int64             `json:"ids,omitempty"`
+	Filter     *BulkCategoryFilter `json:"filter,omitempty"`
+}
+
+// MovieListResponse is a page of movies in the list envelope
+type MovieListResponse struct {
+	Data  []MovieResponse `json:"data"`
+	Meta  ListMeta        `json:"meta"`
+	Links ListLinks       `json:"links"`
 }
 
-type PaginatedMovieResponse struct {
-	Movies []MovieResponse `json:"movies"`
-	Total  int             `json:"total"`
-	Page   int             `json:"page"`
+// AdminMovieListResponse is a page of the admin movie listing in the list
+// envelope
+type AdminMovieListResponse struct {
+	Data  []models.Movie `json:"data"`
+	Meta  ListMeta       `json:"meta"`
+	Links ListLinks      `json:"links"`
+}
+
+// AdminGetMovies godoc
+// @Summary List every movie
+// @Description Get a page of the movies in any publication status, most recently updated first. Deleted movies are listed too, with their deleted_at, when include_deleted=true.
+// @Tags movies
+// @Produce json
+// @Param status query string false "draft, in_review, scheduled, published or archived"
+// @Param include_deleted query bool false "Include deleted movies"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 20, max: 100)"
+// @Success 200 {object} AdminMovieListResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies [get]
+func (h *MovieHandler) AdminGetMovies(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := services.AdminMovieFilter{Status: query.Get("status"), Page: 1}
+	filter.IncludeDeleted, _ = strconv.ParseBool(query.Get("include_deleted"))
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(query.Get("page_size")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+
+	movies, total, err := h.movieService.AdminListMovies(r.Context(), filter)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMovieStatus) {
+			sendError(w, r, CodeInvalidMovieStatus, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	renderPage(w, r, movies, total, filter.Page,
+		effectivePageSize(filter.PageSize, services.DefaultAdminMoviePageSize, services.MaxAdminMoviePageSize))
 }
 
 // GetMovies godoc
 // @Summary Get all movies
-// @Description Get a paginated list of movies with optional filtering
+// @Description Get a paginated list of movies with optional filtering. Sessions acting as a profile with a maximum content rating only get movies rated up to it. year cannot be combined with year_from or year_to, the lower bounds of ranges must not be above their upper bounds, and a category cannot be both included and excluded. fields and include shrink the movies to the fields and relations given.
 // @Tags movies
 // @Accept json
 // @Produce json
@@ -68,22 +341,32 @@ type PaginatedMovieResponse struct {
 // @Param page_size query int false "Page size (default: 10)"
 // @Param search query string false "Search term"
 // @Param year query int false "Filter by year"
+// @Param year_from query int false "Only movies released in or after this year"
+// @Param year_to query int false "Only movies released in or before this year"
+// @Param rating_gte query number false "Only movies rated at least this, from 0 to 10, leaving out unrated ones"
+// @Param duration_min query int false "Only movies lasting at least this many minutes"
+// @Param duration_max query int false "Only movies lasting at most this many minutes"
 // @Param categories query []string false "Filter by categories"
-// @Param sort_by query string false "Sort field (title, year, rating)"
-// @Success 200 {object} PaginatedMovieResponse
-// @Failure 500 {object} ErrorResponse
+// @Param exclude_categories query []string false "Leave out the movies of these categories and their sub-categories"
+// @Param exclude_ids query []int false "Leave out the movies with these IDs, at most 100"
+// @Param category query string false "Filter by category slug"
+// @Param max_maturity_rating query string false "Only movies rated up to this maturity rating, leaving out unrated ones" Enums(G, PG, PG-13, R, NC-17)
+// @Param sort_by query string false "Comma-separated sort keys, up to 3 of title, year, rating, duration and created_at, optionally followed by _asc or _desc, e.g. year_desc,title (default: created_at_desc)"
+// @Param fields query string false "Comma-separated fields of the movies to return, id always included: title, description, release_year, duration, poster_url, maturity_rating, rating (default: all)"
+// @Param include query string false "Comma-separated relations to embed: categories (default: categories, or none when fields is set)"
+// @Success 200 {object} MovieListResponse
+// @Failure 400 {object} apierror.Problem "Invalid or conflicting filters"
+// @Failure 500 {object} apierror.Problem
 // @Router /movies [get]
 func (h *MovieHandler) GetMovies(w http.ResponseWriter, r *http.Request) {
-	filter := services.MovieFilter{
-		Search:     r.URL.Query().Get("search"),
-		SortBy:     r.URL.Query().Get("sort_by"),
-		Categories: r.URL.Query()["categories"],
+	filter, param, err := parseMovieFilter(r)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieFilter, http.StatusBadRequest, "param", param)
+		return
 	}
-
-	if yearStr := r.URL.Query().Get("year"); yearStr != "" {
-		if year, err := strconv.Atoi(yearStr); err == nil {
-			filter.Year = &year
-		}
+	shape, ok := parseMovieShape(w, r)
+	if !ok {
+		return
 	}
 
 	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
@@ -102,74 +385,261 @@ func (h *MovieHandler) GetMovies(w http.ResponseWriter, r *http.Request) {
 		filter.PageSize = 10
 	}
 
-	movies, total, err := h.movieService.GetMovies(r.Context(), filter)
+	movies, total, err := h.movieService.GetMovies(r.Context(), filter, shape.relations)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		var filterErr *services.MovieFilterError
+		switch {
+		case !errors.As(err, &filterErr):
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		case errors.Is(err, services.ErrEmptyMovieFilterRange):
+			sendError(w, r, CodeEmptyMovieFilterRange, http.StatusBadRequest, "param", filterErr.Param, "other", filterErr.Other)
+		case errors.Is(err, services.ErrConflictingMovieFilters):
+			sendError(w, r, CodeConflictingMovieFilters, http.StatusBadRequest, "param", filterErr.Param, "other", filterErr.Other)
+		case errors.Is(err, services.ErrInvalidMovieSort):
+			sendError(w, r, CodeInvalidMovieSort, http.StatusBadRequest, "key", filterErr.Other)
+		default:
+			sendError(w, r, CodeInvalidMovieFilter, http.StatusBadRequest, "param", filterErr.Param)
+		}
 		return
 	}
 
-	response := PaginatedMovieResponse{
-		Movies: make([]MovieResponse, len(movies)),
-		Total:  total,
-		Page:   filter.Page,
+	response := make([]interface{}, len(movies))
+	for i, movie := range movies {
+		response[i], err = shape.apply(MovieResponse{
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
+		})
+		if err != nil {
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+			return
+		}
 	}
 
-	for i, movie := range movies {
-		response.Movies[i] = MovieResponse{
-			ID:          movie.ID,
-			Title:       movie.Title,
-			Description: movie.Description,
-			ReleaseYear: movie.ReleaseYear,
-			Duration:    movie.Duration,
-			PosterURL:   movie.PosterURL,
-			VideoURL:    movie.VideoURL,
-			Categories:  movie.Categories,
-			Rating:      movie.Rating,
+	renderPage(w, r, response, total, filter.Page, filter.PageSize)
+}
+
+// parseMovieFilter reads the filter query parameters of GetMovies. On
+// failure it returns the name of the parameter that is not a number.
+func parseMovieFilter(r *http.Request) (services.MovieFilter, string, error) {
+	query := r.URL.Query()
+	filter := services.MovieFilter{
+		Search:            query.Get("search"),
+		SortBy:            query.Get("sort_by"),
+		Categories:        query["categories"],
+		CategorySlug:      query.Get("category"),
+		ExcludeCategories: query["exclude_categories"],
+	}
+
+	if rating := query.Get("max_maturity_rating"); slices.Contains(models.ContentRatings, rating) {
+		filter.MaxMaturityRating = rating
+	}
+
+	for _, p := range []struct {
+		name  string
+		value **int
+	}{
+		{"year", &filter.Year},
+		{"year_from", &filter.YearFrom},
+		{"year_to", &filter.YearTo},
+		{"duration_min", &filter.DurationMin},
+		{"duration_max", &filter.DurationMax},
+	} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return filter, p.name, err
 		}
+		*p.value = &n
 	}
 
-	json.NewEncoder(w).Encode(response)
+	if s := query.Get("rating_gte"); s != "" {
+		rating, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return filter, "rating_gte", err
+		}
+		filter.RatingGTE = &rating
+	}
+
+	for _, s := range query["exclude_ids"] {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return filter, "exclude_ids", err
+		}
+		filter.ExcludeIDs = append(filter.ExcludeIDs, id)
+	}
+	return filter, "", nil
 }
 
 // GetMovie godoc
 // @Summary Get a movie by ID
-// @Description Get detailed information about a movie
+// @Description Get detailed information about a movie. fields and include shrink the response to the fields and relations given.
 // @Tags movies
 // @Accept json
 // @Produce json
 // @Param id path int true "Movie ID"
+// @Param fields query string false "Comma-separated fields to return, id always included: title, description, release_year, duration, poster_url, maturity_rating, rating (default: all)"
+// @Param include query string false "Comma-separated relations to embed: categories (default: categories, or none when fields is set)"
+// @Param If-None-Match header string false "ETag of the copy held, answered with 304 Not Modified while current"
 // @Success 200 {object} MovieResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Header 200 {string} ETag "Weak entity tag of the response"
+// @Success 304 "Not modified"
+// @Failure 400 {object} apierror.Problem "Unknown field or relation"
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Router /movies/{id} [get]
 func (h *MovieHandler) GetMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
 		return
 	}
 
-	movie, err := h.movieService.GetMovie(r.Context(), id)
+	shape, ok := parseMovieShape(w, r)
+	if !ok {
+		return
+	}
+
+	movie, err := h.movieService.GetLocalizedMovie(r.Context(), id, shape.relations)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
-	response := MovieResponse{
-		ID:          movie.ID,
-		Title:       movie.Title,
-		Description: movie.Description,
-		ReleaseYear: movie.ReleaseYear,
-		Duration:    movie.Duration,
-		PosterURL:   movie.PosterURL,
-		VideoURL:    movie.VideoURL,
-		Categories:  movie.Categories,
-		Rating:      movie.Rating,
+	response, err := shape.apply(MovieResponse{
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
+	})
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// BatchMovieResponse answers a batch lookup with one result per requested
+// ID, in the order requested
+type BatchMovieResponse struct {
+	Results []BatchMovieResult `json:"results"`
+}
+
+// BatchMovieResult is a movie of a batch lookup, or the ID not found
+type BatchMovieResult struct {
+	ID     int64          `json:"id" example:"1"`
+	Status string         `json:"status" example:"found"` // found or not_found
+	Movie  *MovieResponse `json:"movie,omitempty"`
+}
+
+// GetMoviesBatch godoc
+// @Summary Get many movies by ID
+// @Description Get up to 100 movies in one call, such as those of a watch history or playlist, with the IDs comma-separated in ids. Every ID gets a result, in the order given, with status found and the movie, or not_found for movies that do not exist, are not published or are above the rating ceiling of the profile.
+// @Tags movies
+// @Produce json
+// @Param ids query string true "Comma-separated movie IDs, at most 100"
+// @Success 200 {object} BatchMovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/batch [get]
+func (h *MovieHandler) GetMoviesBatch(w http.ResponseWriter, r *http.Request) {
+	var ids []int64
+	for _, s := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+			return
+		}
+		ids = append(ids, id)
+	}
+	h.batch(w, r, ids)
+}
+
+// PostMoviesBatch godoc
+// @Summary Get many movies by ID
+// @Description GET /movies/batch with the IDs in the body, for lists too long for a URL
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body BulkMovieRequest true "Movie IDs, at most 100"
+// @Success 200 {object} BatchMovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/batch [post]
+func (h *MovieHandler) PostMoviesBatch(w http.ResponseWriter, r *http.Request) {
+	var req BulkMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	h.batch(w, r, req.IDs)
+}
+
+func (h *MovieHandler) batch(w http.ResponseWriter, r *http.Request, ids []int64) {
+	movies, err := h.movieService.GetMoviesByIDs(r.Context(), ids)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoBulkItems):
+			sendError(w, r, CodeMovieIDsRequired, http.StatusBadRequest)
+		case errors.Is(err, services.ErrTooManyItems):
+			sendError(w, r, CodeTooManyMovieIDs, http.StatusBadRequest, "max", services.MaxBatchMovies)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := BatchMovieResponse{Results: make([]BatchMovieResult, len(ids))}
+	for i, id := range ids {
+		response.Results[i] = BatchMovieResult{ID: id, Status: services.BulkStatusNotFound}
+		if movie := movies[id]; movie != nil {
+			response.Results[i].Status = services.BulkStatusFound
+			response.Results[i].Movie = &MovieResponse{
+				ID:             movie.ID,
+				Title:          movie.Title,
+				Description:    movie.Description,
+				ReleaseYear:    movie.ReleaseYear,
+				Duration:       movie.Duration,
+				PosterURL:      movie.PosterURL,
+				Categories:     movieCategories(movie.CategoryRefs),
+				MaturityRating: movie.MaturityRating,
+				Rating:         movie.Rating,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // CreateMovie godoc
 // @Summary Create a new movie
 // @Description Create a new movie with the provided details
@@ -178,42 +648,63 @@ func (h *MovieHandler) GetMovie(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param movie body CreateMovieRequest true "Movie details"
 // @Success 201 {object} MovieResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Security BearerAuth
 // @Router /admin/movies [post]
 func (h *MovieHandler) CreateMovie(w http.ResponseWriter, r *http.Request) {
 	var req CreateMovieRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !DecodeAndValidate(w, r, &req) {
 		return
 	}
 
 	movie := &models.Movie{
-		Title:       req.Title,
-		Description: req.Description,
-		ReleaseYear: req.ReleaseYear,
-		Duration:    req.Duration,
-		PosterURL:   req.PosterURL,
-		VideoURL:    req.VideoURL,
-		Categories:  req.Categories,
+		Title:          req.Title,
+		Description:    req.Description,
+		ReleaseYear:    req.ReleaseYear,
+		Duration:       req.Duration,
+		PosterURL:      req.PosterURL,
+		VideoURL:       req.VideoURL,
+		CategoryRefs:   categoryRefs(req.CategoryIDs),
+		MaturityRating: req.MaturityRating,
+		AvailableFrom:  req.AvailableFrom,
+		AvailableUntil: req.AvailableUntil,
 	}
 
 	if err := h.movieService.CreateMovie(r.Context(), movie); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, services.ErrMovieExists) {
+			sendError(w, r, CodeMovieExists, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := MovieResponse{
-		ID:          movie.ID,
-		Title:       movie.Title,
-		Description: movie.Description,
-		ReleaseYear: movie.ReleaseYear,
-		Duration:    movie.Duration,
-		PosterURL:   movie.PosterURL,
-		VideoURL:    movie.VideoURL,
-		Categories:  movie.Categories,
-		Rating:      movie.Rating,
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -229,67 +720,289 @@ func (h *MovieHandler) CreateMovie(w http.ResponseWriter, r *http.Request) {
 // @Param id path int true "Movie ID"
 // @Param movie body UpdateMovieRequest true "Movie details to update"
 // @Success 200 {object} MovieResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Security BearerAuth
 // @Router /admin/movies/{id} [put]
 func (h *MovieHandler) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
 		return
 	}
 
 	var req UpdateMovieRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
 		return
 	}
 
 	movie, err := h.movieService.GetMovie(r.Context(), id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
-	if req.Title != nil {
-		movie.Title = *req.Title
+	req.apply(movie)
+
+	if err := h.movieService.UpdateMovie(r.Context(), movie); err != nil {
+		if errors.Is(err, services.ErrMovieTitleTaken) {
+			sendError(w, r, CodeMovieTitleTaken, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
 	}
-	if req.Description != nil {
-		movie.Description = *req.Description
+
+	response := MovieResponse{
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
 	}
-	if req.ReleaseYear != nil {
-		movie.ReleaseYear = *req.ReleaseYear
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpsertMovieByExternalID godoc
+// @Summary Create or update a movie by external ID
+// @Description Create a movie keyed on its external source and ID, or update the movie previously imported with that key. Safe to repeat, which lets importers re-run.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param source path string true "External source, e.g. tmdb"
+// @Param id path string true "ID of the movie in the external source"
+// @Param movie body CreateMovieRequest true "Movie details"
+// @Success 200 {object} MovieResponse "Updated"
+// @Success 201 {object} MovieResponse "Created"
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/by-external/{source}/{id} [put]
+func (h *MovieHandler) UpsertMovieByExternalID(w http.ResponseWriter, r *http.Request) {
+	source := chi.URLParam(r, "source")
+	externalID := chi.URLParam(r, "id")
+	if source == "" || len(source) > 64 || externalID == "" || len(externalID) > 255 {
+		sendError(w, r, CodeInvalidExternalID, http.StatusBadRequest)
+		return
 	}
-	if req.Duration != nil {
-		movie.Duration = *req.Duration
+
+	var req CreateMovieRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
 	}
-	if req.PosterURL != nil {
-		movie.PosterURL = *req.PosterURL
+
+	movie := &models.Movie{
+		Title:          req.Title,
+		Description:    req.Description,
+		ReleaseYear:    req.ReleaseYear,
+		Duration:       req.Duration,
+		PosterURL:      req.PosterURL,
+		VideoURL:       req.VideoURL,
+		CategoryRefs:   categoryRefs(req.CategoryIDs),
+		MaturityRating: req.MaturityRating,
+		ExternalSource: source,
+		ExternalID:     externalID,
+		AvailableFrom:  req.AvailableFrom,
+		AvailableUntil: req.AvailableUntil,
 	}
-	if req.VideoURL != nil {
-		movie.VideoURL = *req.VideoURL
+
+	created, err := h.movieService.UpsertMovieByExternalID(r.Context(), movie)
+	if err != nil {
+		if errors.Is(err, services.ErrMovieTitleTaken) {
+			sendError(w, r, CodeMovieTitleTaken, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := MovieResponse{
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
 	}
-	if req.Categories != nil {
-		movie.Categories = *req.Categories
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
 	}
+	json.NewEncoder(w).Encode(response)
+}
 
-	if err := h.movieService.UpdateMovie(r.Context(), movie); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// PatchMovie godoc
+// @Summary Patch a movie
+// @Description Apply a JSON Merge Patch (RFC 7386, application/merge-patch+json) or a JSON Patch (RFC 6902, application/json-patch+json) to a movie. Merge patch members set to null are cleared; JSON Patch allows precise array edits such as adding "/categories/-". Title cannot be cleared.
+// @Tags movies
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param movie body CreateMovieRequest true "Merge patch of the movie's fields, or an array of JSON Patch operations"
+// @Success 200 {object} MovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id} [patch]
+func (h *MovieHandler) PatchMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	movie, err := h.movieService.GetMovie(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	// Patch the movie's editable fields as a JSON document
+	current, err := json.Marshal(CreateMovieRequest{
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		CategoryIDs:    categoryIDs(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		AvailableFrom:  movie.AvailableFrom,
+		AvailableUntil: movie.AvailableUntil,
+	})
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	merged, err := patch.Apply(current, body, r.Header.Get("Content-Type"),
+		patch.MergePatchContentType, patch.JSONPatchContentType)
+	if err != nil {
+		sendPatchError(w, r, err)
+		return
+	}
+
+	var patched CreateMovieRequest
+	dec := json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		sendError(w, r, CodeInvalidPatchedMovie, http.StatusBadRequest, "detail", err)
+		return
+	}
+	if patched.Title == "" {
+		sendError(w, r, CodeTitleCannotBeCleared, http.StatusBadRequest)
+		return
+	}
+	if !validateRequest(w, r, &patched) {
+		return
+	}
+
+	movie.Title = patched.Title
+	movie.Description = patched.Description
+	movie.ReleaseYear = patched.ReleaseYear
+	movie.Duration = patched.Duration
+	movie.PosterURL = patched.PosterURL
+	movie.VideoURL = patched.VideoURL
+	movie.CategoryRefs = categoryRefs(patched.CategoryIDs)
+	movie.MaturityRating = patched.MaturityRating
+	movie.AvailableFrom = patched.AvailableFrom
+	movie.AvailableUntil = patched.AvailableUntil
+
+	if err := h.movieService.PatchMovie(r.Context(), movie); err != nil {
+		if errors.Is(err, services.ErrMovieTitleTaken) {
+			sendError(w, r, CodeMovieTitleTaken, http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidAvailability) {
+			sendError(w, r, CodeInvalidAvailability, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMaturityRating) {
+			sendError(w, r, CodeInvalidMaturityRating, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrUnknownCategory) {
+			sendError(w, r, CodeUnknownCategory, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := MovieResponse{
-		ID:          movie.ID,
-		Title:       movie.Title,
-		Description: movie.Description,
-		ReleaseYear: movie.ReleaseYear,
-		Duration:    movie.Duration,
-		PosterURL:   movie.PosterURL,
-		VideoURL:    movie.VideoURL,
-		Categories:  movie.Categories,
-		Rating:      movie.Rating,
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -297,32 +1010,310 @@ func (h *MovieHandler) UpdateMovie(w http.ResponseWriter, r *http.Request) {
 
 // DeleteMovie godoc
 // @Summary Delete a movie
-// @Description Delete a movie by ID
+// @Description Delete a movie by ID, keeping its categories and favorites. It can be restored until deleted movies are purged.
 // @Tags movies
 // @Accept json
 // @Produce json
 // @Param id path int true "Movie ID"
 // @Success 204 "No Content"
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
 // @Security BearerAuth
 // @Router /admin/movies/{id} [delete]
 func (h *MovieHandler) DeleteMovie(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid movie ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
 		return
 	}
 
 	if err := h.movieService.DeleteMovie(r.Context(), id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// RestoreMovie godoc
+// @Summary Restore a deleted movie
+// @Description Undo the deletion of a movie before it is purged
+// @Tags movies
+// @Param id path int true "Movie ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem "The movie is not deleted"
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/restore [post]
+func (h *MovieHandler) RestoreMovie(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.movieService.RestoreMovie(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+		case errors.Is(err, services.ErrNotDeleted):
+			sendError(w, r, CodeNotDeleted, http.StatusConflict)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// posterFormOverhead is the room left in upload bodies for the multipart
+// boundaries and headers around the poster itself
+const posterFormOverhead = 64 << 10
+
+// UploadPoster godoc
+// @Summary Upload a movie poster
+// @Description Upload a JPEG, PNG or WebP image as the poster of a movie. The image is stored in the configured bucket and the movie's poster_url is set to its public URL.
+// @Tags movies
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param poster formData file true "Poster image"
+// @Success 200 {object} MovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/poster [post]
+func (h *MovieHandler) UploadPoster(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	maxSize := h.storageService.MaxPosterSize()
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+posterFormOverhead)
+	file, _, err := r.FormFile("poster")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, r, CodePosterTooLarge, http.StatusRequestEntityTooLarge, "max", maxSize)
+			return
+		}
+		sendError(w, r, CodePosterRequired, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so oversized posters are rejected
+	// rather than truncated
+	image, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.movieService.GetMovie(r.Context(), id); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	url, err := h.storageService.StorePoster(r.Context(), id, image)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrStorageDisabled):
+			sendError(w, r, CodeStorageDisabled, http.StatusServiceUnavailable)
+		case errors.Is(err, services.ErrPosterTooLarge):
+			sendError(w, r, CodePosterTooLarge, http.StatusRequestEntityTooLarge, "max", maxSize)
+		case errors.Is(err, services.ErrUnsupportedImage):
+			sendError(w, r, CodeUnsupportedPosterType, http.StatusUnsupportedMediaType)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	movie, err := h.movieService.SetPosterURL(r.Context(), id, url)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := MovieResponse{
+		ID:             movie.ID,
+		Title:          movie.Title,
+		Description:    movie.Description,
+		ReleaseYear:    movie.ReleaseYear,
+		Duration:       movie.Duration,
+		PosterURL:      movie.PosterURL,
+		VideoURL:       movie.VideoURL,
+		Categories:     movieCategories(movie.CategoryRefs),
+		MaturityRating: movie.MaturityRating,
+		Rating:         movie.Rating,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// BulkDeleteMovies godoc
+// @Summary Bulk delete movies
+// @Description Soft-delete up to 500 movies in one transaction. Each ID is reported as deleted, not_found or already_deleted. Deleted movies can be brought back with bulk-restore.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body BulkMovieRequest true "Movie IDs"
+// @Success 200 {object} BulkMovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/bulk-delete [post]
+func (h *MovieHandler) BulkDeleteMovies(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, h.movieService.BulkDeleteMovies, services.BulkStatusDeleted)
+}
+
+// BulkRestoreMovies godoc
+// @Summary Bulk restore movies
+// @Description Restore up to 500 soft-deleted movies in one transaction. Each ID is reported as restored, not_found or not_deleted.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body BulkMovieRequest true "Movie IDs"
+// @Success 200 {object} BulkMovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/bulk-restore [post]
+func (h *MovieHandler) BulkRestoreMovies(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, h.movieService.BulkRestoreMovies, services.BulkStatusRestored)
+}
+
+func (h *MovieHandler) bulk(
+	w http.ResponseWriter,
+	r *http.Request,
+	apply func(ctx context.Context, ids []int64) ([]services.BulkItemResult, error),
+	success string,
+) {
+	var req BulkMovieRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	results, err := apply(r.Context(), req.IDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrNoBulkItems):
+			sendError(w, r, CodeMovieIDsRequired, http.StatusBadRequest)
+		case errors.Is(err, services.ErrTooManyItems):
+			sendError(w, r, CodeTooManyMovieIDs, http.StatusBadRequest, "max", services.MaxBulkItems)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := BulkMovieResponse{Results: results}
+	for _, result := range results {
+		if result.Status == success {
+			response.Succeeded++
+		} else {
+			response.Skipped++
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// BulkAssignCategory godoc
+// @Summary Bulk add or remove a category
+// @Description Add a category to, or remove it from, many movies at once. Movies are selected by an ID list (up to 500) or, if no IDs are given, by a filter (up to 5000 matches). Both the movie's categories and the category links are updated in one transaction.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body BulkCategoryRequest true "Category assignment"
+// @Success 200 {object} services.BulkCategoryResult
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/bulk-categories [post]
+func (h *MovieHandler) BulkAssignCategory(w http.ResponseWriter, r *http.Request) {
+	var req BulkCategoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	var add bool
+	switch req.Action {
+	case "add":
+		add = true
+	case "remove":
+	default:
+		sendError(w, r, CodeInvalidBulkAction, http.StatusBadRequest)
+		return
+	}
+
+	if len(req.IDs) > 0 && req.Filter != nil {
+		sendError(w, r, CodeIDsAndFilter, http.StatusBadRequest)
+		return
+	}
+
+	var filter *services.MovieFilter
+	if req.Filter != nil {
+		filter = &services.MovieFilter{
+			Search:     req.Filter.Search,
+			Year:       req.Filter.Year,
+			Categories: req.Filter.Categories,
+		}
+	}
+
+	result, err := h.movieService.BulkAssignCategory(r.Context(), req.CategoryID, add, req.IDs, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeCategoryNotFound, http.StatusNotFound)
+		case errors.Is(err, services.ErrNoBulkItems):
+			sendError(w, r, CodeIDsOrFilterRequired, http.StatusBadRequest)
+		case errors.Is(err, services.ErrTooManyItems):
+			sendError(w, r, CodeTooManyMovieIDs, http.StatusBadRequest, "max", services.MaxBulkItems)
+		case errors.Is(err, services.ErrTooManyMatches):
+			sendError(w, r, CodeTooManyFilterMatches, http.StatusBadRequest, "max", services.MaxBulkFilterMatches)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
 // GetTopRatedMovies godoc
 // @Summary Get top rated movies
 // @Description Get a list of top rated movies
@@ -331,7 +1322,7 @@ func (h *MovieHandler) DeleteMovie(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param limit query int false "Number of movies to return (default: 10)"
 // @Success 200 {array} MovieResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 500 {object} apierror.Problem
 // @Router /movies/top-rated [get]
 func (h *MovieHandler) GetTopRatedMovies(w http.ResponseWriter, r *http.Request) {
 	limit := 10
@@ -343,22 +1334,23 @@ func (h *MovieHandler) GetTopRatedMovies(w http.ResponseWriter, r *http.Request)
 
 	movies, err := h.movieService.GetTopRatedMovies(r.Context(), limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := make([]MovieResponse, len(movies))
 	for i, movie := range movies {
 		response[i] = MovieResponse{
-			ID:          movie.ID,
-			Title:       movie.Title,
-			Description: movie.Description,
-			ReleaseYear: movie.ReleaseYear,
-			Duration:    movie.Duration,
-			PosterURL:   movie.PosterURL,
-			VideoURL:    movie.VideoURL,
-			Categories:  movie.Categories,
-			Rating:      movie.Rating,
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
 		}
 	}
 
@@ -373,7 +1365,7 @@ func (h *MovieHandler) GetTopRatedMovies(w http.ResponseWriter, r *http.Request)
 // @Produce json
 // @Param limit query int false "Number of movies to return (default: 10)"
 // @Success 200 {array} MovieResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 500 {object} apierror.Problem
 // @Router /movies/recently-added [get]
 func (h *MovieHandler) GetRecentlyAddedMovies(w http.ResponseWriter, r *http.Request) {
 	limit := 10
@@ -385,24 +1377,351 @@ func (h *MovieHandler) GetRecentlyAddedMovies(w http.ResponseWriter, r *http.Req
 
 	movies, err := h.movieService.GetRecentlyAddedMovies(r.Context(), limit)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]MovieResponse, len(movies))
+	for i, movie := range movies {
+		response[i] = MovieResponse{
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetTrendingMovies godoc
+// @Summary Get trending movies
+// @Description Get the movies with the highest trending score: recent plays weighted by exponential decay, normalized by how long each movie has been in the catalog. Scores are recomputed periodically, over the configured window and over the last 1, 7 and 30 days.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param limit query int false "Number of movies to return (default: 10)"
+// @Param window query string false "Plays counted: 1d, 7d or 30d (default: the configured window)"
+// @Success 200 {array} MovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/trending [get]
+func (h *MovieHandler) GetTrendingMovies(w http.ResponseWriter, r *http.Request) {
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	var windowDays int
+	if window := r.URL.Query().Get("window"); window != "" {
+		days, err := strconv.Atoi(strings.TrimSuffix(window, "d"))
+		if err != nil || !strings.HasSuffix(window, "d") || !slices.Contains(services.TrendingWindows, days) {
+			sendError(w, r, CodeInvalidTrendingWindow, http.StatusBadRequest)
+			return
+		}
+		windowDays = days
+	}
+
+	movies, err := h.trendingService.TrendingMovies(r.Context(), windowDays, limit)
+	if err == nil {
+		err = h.movieService.LocalizeMovies(r.Context(), movies)
+	}
+	if err == nil {
+		err = h.movieService.LoadCategories(r.Context(), movies)
+	}
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := make([]MovieResponse, len(movies))
 	for i, movie := range movies {
 		response[i] = MovieResponse{
-			ID:          movie.ID,
-			Title:       movie.Title,
-			Description: movie.Description,
-			ReleaseYear: movie.ReleaseYear,
-			Duration:    movie.Duration,
-			PosterURL:   movie.PosterURL,
-			VideoURL:    movie.VideoURL,
-			Categories:  movie.Categories,
-			Rating:      movie.Rating,
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
 		}
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
+
+// GetUpcomingMovies godoc
+// @Summary Get upcoming releases
+// @Description Get the published movies whose availability window opens in a range of days, grouped by UTC day, for a coming soon calendar. Days without releases are left out.
+// @Tags movies
+// @Produce json
+// @Param from query string false "First day, YYYY-MM-DD (default: today)"
+// @Param to query string false "Last day, YYYY-MM-DD"
+// @Param days query int false "Number of days when to is not given (default: 30)"
+// @Success 200 {array} UpcomingDayResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/upcoming [get]
+func (h *MovieHandler) GetUpcomingMovies(w http.ResponseWriter, r *http.Request) {
+	period, err := parseUpcomingPeriod(r, time.Now())
+	if err != nil {
+		sendError(w, r, CodeInvalidPeriod, http.StatusBadRequest, "max", services.MaxReportDays)
+		return
+	}
+
+	days, err := h.movieService.UpcomingMovies(r.Context(), period)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]UpcomingDayResponse, len(days))
+	for i, day := range days {
+		response[i] = UpcomingDayResponse{
+			Day:    day.Day.Format("2006-01-02"),
+			Movies: make([]UpcomingMovieResponse, len(day.Movies)),
+		}
+		for j, movie := range day.Movies {
+			response[i].Movies[j] = UpcomingMovieResponse{
+				MovieResponse: MovieResponse{
+					ID:             movie.ID,
+					Title:          movie.Title,
+					Description:    movie.Description,
+					ReleaseYear:    movie.ReleaseYear,
+					Duration:       movie.Duration,
+					PosterURL:      movie.PosterURL,
+					Categories:     movieCategories(movie.CategoryRefs),
+					MaturityRating: movie.MaturityRating,
+					Rating:         movie.Rating,
+				},
+				AvailableFrom: *movie.AvailableFrom,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// parseUpcomingPeriod reads the from, to and days query parameters. from
+// defaults to today and to to days (default 30) after from.
+func parseUpcomingPeriod(r *http.Request, now time.Time) (services.Period, error) {
+	query := r.URL.Query()
+
+	from := now
+	if s := query.Get("from"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		from = t
+	}
+
+	days := 30
+	if s := query.Get("days"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return services.Period{}, services.ErrInvalidPeriod
+		}
+		days = n
+	}
+	to := from.AddDate(0, 0, days-1)
+	if s := query.Get("to"); s != "" {
+		t, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return services.Period{}, err
+		}
+		to = t
+	}
+
+	return services.NewPeriod(from, to)
+}
+
+// GetTrendingSettings godoc
+// @Summary Get trending settings
+// @Description Get the parameters trending scores are computed with. updated_at is zero while the configured defaults apply.
+// @Tags movies
+// @Produce json
+// @Success 200 {object} models.TrendingSettings
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/trending/settings [get]
+func (h *MovieHandler) GetTrendingSettings(w http.ResponseWriter, r *http.Request) {
+	settings, err := h.trendingService.Settings(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// UpdateTrendingSettings godoc
+// @Summary Update trending settings
+// @Description Set the half-life of plays in hours, the window of days plays are counted over and the exponent of the catalog age scores are divided by. Scores are recomputed with them right away.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body models.TrendingSettings true "Trending settings"
+// @Success 200 {object} models.TrendingSettings
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/trending/settings [put]
+func (h *MovieHandler) UpdateTrendingSettings(w http.ResponseWriter, r *http.Request) {
+	var settings models.TrendingSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.trendingService.UpdateSettings(r.Context(), &settings); err != nil {
+		if errors.Is(err, services.ErrInvalidTrendingSettings) {
+			sendError(w, r, CodeInvalidTrendingSettings, http.StatusBadRequest)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(settings)
+}
+
+// GetSimilarMovies godoc
+// @Summary Get similar movies
+// @Description Get the movies nearest to a movie by the embedding of its metadata. When embeddings are not configured or the movie has not been embedded yet, movies sharing its categories are returned instead.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param limit query int false "Number of movies to return (default: 10)"
+// @Success 200 {array} MovieResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/{id}/similar [get]
+func (h *MovieHandler) GetSimilarMovies(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	limit := 10
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	movies, err := h.embeddingService.SimilarMovies(r.Context(), id, limit)
+	if err == nil {
+		err = h.movieService.LocalizeMovies(r.Context(), movies)
+		if err == nil {
+			err = h.movieService.LoadCategories(r.Context(), movies)
+		}
+	} else if errors.Is(err, services.ErrEmbeddingsDisabled) || errors.Is(err, database.ErrNotFound) {
+		// GetRelatedMovies localizes the movies and loads their categories
+		// itself
+		movies, err = h.movieService.GetRelatedMovies(r.Context(), id, limit)
+	}
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]MovieResponse, len(movies))
+	for i, movie := range movies {
+		response[i] = MovieResponse{
+			ID:             movie.ID,
+			Title:          movie.Title,
+			Description:    movie.Description,
+			ReleaseYear:    movie.ReleaseYear,
+			Duration:       movie.Duration,
+			PosterURL:      movie.PosterURL,
+			Categories:     movieCategories(movie.CategoryRefs),
+			MaturityRating: movie.MaturityRating,
+			Rating:         movie.Rating,
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+type ComputeEmbeddingsRequest struct {
+	// Force re-embeds every movie, not only those whose metadata changed
+	Force bool `json:"force" example:"false"`
+}
+
+// GetEmbeddingJob godoc
+// @Summary Get the movie embedding job
+// @Description Get the progress of the current or last job computing movie embeddings
+// @Tags movies
+// @Produce json
+// @Success 200 {object} services.EmbeddingJob
+// @Security BearerAuth
+// @Router /admin/movies/embeddings [get]
+func (h *MovieHandler) GetEmbeddingJob(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.embeddingService.Job())
+}
+
+// ComputeEmbeddings godoc
+// @Summary Compute movie embeddings
+// @Description Start a background job (re)computing the embeddings similar movies are found by. Movies whose metadata is unchanged since their last embedding are skipped unless force is set.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param request body ComputeEmbeddingsRequest false "Job options"
+// @Success 202 {object} services.EmbeddingJob
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/embeddings [post]
+func (h *MovieHandler) ComputeEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req ComputeEmbeddingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.embeddingService.Start(req.Force)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmbeddingsDisabled):
+			sendError(w, r, CodeEmbeddingsDisabled, http.StatusServiceUnavailable)
+		case errors.Is(err, services.ErrEmbeddingJobRunning):
+			sendError(w, r, CodeEmbeddingJobRunning, http.StatusConflict)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/notifications"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	maxAnnouncementLength = 1000
+	// authMessageType is the type of the message clients authenticate with
+	authMessageType = "auth"
+)
+
+// upgrader accepts connections from any origin, as the CORS policy does.
+// Clients authenticate with a token sent over the connection rather than
+// cookies, so other sites cannot connect on their behalf.
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+	Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		sendError(w, r, CodeWebSocketRequired, status)
+	},
+}
+
+type NotificationHandler struct {
+	hub         *notifications.Hub
+	authService *services.AuthService
+	logger      *zap.Logger
+}
+
+func NewNotificationHandler(hub *notifications.Hub, authService *services.AuthService, logger *zap.Logger) *NotificationHandler {
+	return &NotificationHandler{
+		hub:         hub,
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+// AuthMessage is the first message clients send over the connection
+type AuthMessage struct {
+	Type  string `json:"type" example:"auth"`
+	Token string `json:"token" example:"eyJhbGciOiJIUzI1NiIs..."`
+}
+
+// ReadyMessage answers an AuthMessage with a valid token. Events follow.
+type ReadyMessage struct {
+	Type   string `json:"type" example:"ready"`
+	UserID int64  `json:"user_id" example:"1"`
+}
+
+// AnnouncementRequest is an announcement pushed to connected clients:
+// everyone by default, only admins, or only one user
+type AnnouncementRequest struct {
+	Message    string `json:"message" example:"Scheduled maintenance tonight at 02:00 UTC"`
+	AdminsOnly bool   `json:"admins_only,omitempty" example:"false"`
+	UserID     int64  `json:"user_id,omitempty" example:"0"`
+}
+
+// announcementNotification is the data of announcement events
+type announcementNotification struct {
+	Message string `json:"message"`
+}
+
+// Connect godoc
+// @Summary Receive notifications over WebSocket
+// @Description Upgrade to a WebSocket receiving notifications. Within the configured timeout, send {"type": "auth", "token": "<access token>"}; the server answers {"type": "ready"} and then pushes events as {"type", "data", "sent_at"}: movie.added to everyone, video.ready and video.failed to admins, and announcement. The connection is closed with code 1008 when authentication fails.
+// @Tags notifications
+// @Success 101
+// @Failure 400 {object} apierror.Problem
+// @Router /ws [get]
+func (h *NotificationHandler) Connect(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has answered already
+		return
+	}
+
+	// The connection outlives the request, and its timeout
+	go h.serve(conn)
+}
+
+func (h *NotificationHandler) serve(conn *websocket.Conn) {
+	userID, admin, err := h.authenticate(conn)
+	if err != nil {
+		code, reason := websocket.ClosePolicyViolation, "authentication required"
+		switch {
+		case errors.Is(err, services.ErrInvalidToken):
+			reason = "invalid token"
+		case !errors.Is(err, errAuthRequired):
+			h.logger.Error("notifications handshake failed", zap.Error(err))
+			code, reason = websocket.CloseInternalServerErr, "internal error"
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.WriteJSON(ReadyMessage{Type: "ready", UserID: userID}); err != nil {
+		conn.Close()
+		return
+	}
+	h.hub.Serve(conn, userID, admin)
+}
+
+var errAuthRequired = errors.New("authentication required")
+
+// authenticate reads the AuthMessage of a new connection and returns its
+// user and whether they are an admin
+func (h *NotificationHandler) authenticate(conn *websocket.Conn) (int64, bool, error) {
+	conn.SetReadLimit(4096)
+	conn.SetReadDeadline(time.Now().Add(h.hub.AuthTimeout()))
+
+	var msg AuthMessage
+	if err := conn.ReadJSON(&msg); err != nil || msg.Type != authMessageType || msg.Token == "" {
+		return 0, false, errAuthRequired
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userID, err := h.authService.ValidateToken(ctx, msg.Token)
+	if err != nil {
+		return 0, false, err
+	}
+	admin, err := h.authService.IsAdmin(ctx, userID)
+	if err != nil {
+		return 0, false, err
+	}
+	return userID, admin, nil
+}
+
+// Announce godoc
+// @Summary Send an announcement
+// @Description Push an announcement to the clients connected to /ws: everyone, only admins, or only the user with user_id. Clients not connected do not receive it later.
+// @Tags notifications
+// @Accept json
+// @Param announcement body AnnouncementRequest true "Announcement"
+// @Success 202
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/announcements [post]
+func (h *NotificationHandler) Announce(w http.ResponseWriter, r *http.Request) {
+	var req AnnouncementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	message := strings.TrimSpace(req.Message)
+	if message == "" || utf8.RuneCountInString(message) > maxAnnouncementLength || req.UserID < 0 {
+		sendError(w, r, CodeInvalidAnnouncement, http.StatusBadRequest, "max", maxAnnouncementLength)
+		return
+	}
+
+	audience := notifications.Everyone
+	if req.AdminsOnly {
+		audience.Admins = true
+	}
+	if req.UserID != 0 {
+		audience.UserID = req.UserID
+	}
+
+	if err := h.hub.Publish(r.Context(), audience, notifications.EventAnnouncement, announcementNotification{Message: message}); err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// oauthStateCookie holds the state of a sign in with an OAuth provider
+// between the login redirect and the callback
+const oauthStateCookie = "oauth_state"
+
+type OAuthHandler struct {
+	oauthService *services.OAuthService
+	logger       *zap.Logger
+}
+
+func NewOAuthHandler(oauthService *services.OAuthService, logger *zap.Logger) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+		logger:       logger,
+	}
+}
+
+// Login godoc
+// @Summary Log in with an OAuth provider
+// @Description Redirect to Google or GitHub to sign in. The provider redirects back to the callback route, which completes the login.
+// @Tags auth
+// @Param provider path string true "google or github"
+// @Success 302 "Found"
+// @Failure 404 {object} apierror.Problem "Unknown or disabled provider"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/oauth/{provider}/login [get]
+func (h *OAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	authURL, state, err := h.oauthService.AuthURL(provider)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownOAuthProvider) {
+			sendError(w, r, CodeUnknownOAuthProvider, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     strings.TrimSuffix(r.URL.Path, "login") + "callback",
+		MaxAge:   int(h.oauthService.StateTTL().Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback godoc
+// @Summary Complete a login with an OAuth provider
+// @Description Called by the provider after the user signs in. The provider account is linked to the user with the same verified email, or to a new user, the first time it is used.
+// @Tags auth
+// @Produce json
+// @Param provider path string true "google or github"
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} apierror.Problem "Invalid state or sign in denied"
+// @Failure 403 {object} apierror.Problem "Provider account has no verified email, or the account is suspended or deleted"
+// @Failure 404 {object} apierror.Problem "Unknown or disabled provider"
+// @Failure 502 {object} apierror.Problem "Provider rejected the sign in"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Router /auth/oauth/{provider}/callback [get]
+func (h *OAuthHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// The state is single use
+	cookie, err := r.Cookie(oauthStateCookie)
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: r.URL.Path, MaxAge: -1, HttpOnly: true})
+	if err != nil || query.Get("state") == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(query.Get("state"))) != 1 {
+		sendError(w, r, CodeInvalidOAuthState, http.StatusBadRequest)
+		return
+	}
+	if query.Get("error") != "" || query.Get("code") == "" {
+		sendError(w, r, CodeOAuthDenied, http.StatusBadRequest)
+		return
+	}
+
+	resp, err := h.oauthService.Callback(r.Context(), chi.URLParam(r, "provider"), query.Get("code"), r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnknownOAuthProvider):
+			sendError(w, r, CodeUnknownOAuthProvider, http.StatusNotFound)
+		case errors.Is(err, services.ErrOAuthEmailUnverified):
+			sendError(w, r, CodeOAuthEmailUnverified, http.StatusForbidden)
+		case errors.Is(err, services.ErrUserSuspended):
+			sendError(w, r, CodeAccountSuspended, http.StatusForbidden)
+		case errors.Is(err, services.ErrAccountDeleted):
+			sendError(w, r, CodeAccountDeleted, http.StatusForbidden)
+		case errors.Is(err, services.ErrOAuthExchange):
+			logError(h.logger, r, err)
+			sendError(w, r, CodeOAuthFailed, http.StatusBadGateway)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
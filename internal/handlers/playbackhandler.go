@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/playback"
+	"github.com/ndn/internal/services"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// streamedHeaders are the response headers passed on to players from
+// where videos are stored
+var streamedHeaders = []string{"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+
+type PlaybackHandler struct {
+	playbackService *services.PlaybackService
+	logger          *zap.Logger
+}
+
+func NewPlaybackHandler(playbackService *services.PlaybackService, logger *zap.Logger) *PlaybackHandler {
+	return &PlaybackHandler{
+		playbackService: playbackService,
+		logger:          logger,
+	}
+}
+
+// PlayRequest names the device a stream is played on. Both fields are
+// optional: device_id is an identifier the client keeps for the device, so
+// starting a stream on it replaces the one it was playing, and device a
+// label for the user.
+type PlayRequest struct {
+	DeviceID string `json:"device_id,omitempty" example:"b3f1c9e2-7a4d-4e8f-9c1a-2d5e6f7a8b9c" validate:"max=100"`
+	Device   string `json:"device,omitempty" example:"Living room TV" validate:"max=100"`
+}
+
+// StreamLimitProblem is the problem of plays refused because the user
+// already plays as many videos at once as their plan allows. It lists the
+// streams playing, which the user can end to play another.
+type StreamLimitProblem struct {
+	*apierror.Problem
+	MaxStreams    int                      `json:"max_streams" example:"2"`
+	ActiveStreams []models.PlaybackSession `json:"active_streams"`
+}
+
+// Play godoc
+// @Summary Get a playback URL
+// @Description Get a signed URL the video of a published movie can be played from until expires_at, and start a stream of it on the device in the optional body. For HLS videos the URL is the master playlist; the renditions and segments it lists are reached through the same token, up to the max_height of the user's plan. While playing, the player sends a heartbeat for session_id every heartbeat_interval seconds. Plans may limit how many videos are played at once; a stream ends once its player stops sending heartbeats and fetching from it for a while. Over the limit, the problem lists the active streams.
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param request body PlayRequest false "Device"
+// @Success 200 {object} services.Playback
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 402 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 429 {object} StreamLimitProblem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /movies/{id}/play [post]
+func (h *PlaybackHandler) Play(w http.ResponseWriter, r *http.Request) {
+	// The body is optional
+	var req PlayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if !validateRequest(w, r, &req) {
+		return
+	}
+
+	device := services.Device{ID: req.DeviceID, Name: req.Device}
+	h.issue(w, r, func(ctx context.Context, movieID int64, streamURL string) (*services.Playback, error) {
+		return h.playbackService.Play(ctx, movieID, streamURL, device)
+	})
+}
+
+// Download godoc
+// @Summary Get a download URL
+// @Description Get a signed URL the video of a published movie can be downloaded from to watch offline, like POST /movies/{id}/play but valid for longer and not counted as a stream. Only for plans that include downloads.
+// @Tags movies
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {object} services.Playback
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 402 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /movies/{id}/download [post]
+func (h *PlaybackHandler) Download(w http.ResponseWriter, r *http.Request) {
+	h.issue(w, r, h.playbackService.Download)
+}
+
+// issue answers with the URL issue signs for the movie in the path
+func (h *PlaybackHandler) issue(w http.ResponseWriter, r *http.Request, issue func(context.Context, int64, string) (*services.Playback, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	play, err := issue(r.Context(), id, requestOrigin(r)+"/api/stream")
+	if err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(play)
+}
+
+// ListStreams godoc
+// @Summary List active streams
+// @Description Get the streams the authenticated user is playing, on any device, oldest first
+// @Tags movies
+// @Produce json
+// @Success 200 {array} models.PlaybackSession
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /playback/sessions [get]
+func (h *PlaybackHandler) ListStreams(w http.ResponseWriter, r *http.Request) {
+	streams, err := h.playbackService.ListStreams(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(streams)
+}
+
+// Heartbeat godoc
+// @Summary Send a stream heartbeat
+// @Description Keep one of the authenticated user's streams active while its video plays. Players send one every heartbeat_interval seconds of their playback; once it answers 404, the stream has ended, by going idle or being ended from another device, and the player stops.
+// @Tags movies
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /playback/sessions/{id}/heartbeat [post]
+func (h *PlaybackHandler) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if err := h.playbackService.Heartbeat(r.Context(), services.UserIDFromContext(r.Context()), chi.URLParam(r, "id")); err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// EndStream godoc
+// @Summary End a stream
+// @Description End one of the authenticated user's streams, on any device, so it no longer counts against the concurrent streams of their plan. Its player stops at its next heartbeat.
+// @Tags movies
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /playback/sessions/{id} [delete]
+func (h *PlaybackHandler) EndStream(w http.ResponseWriter, r *http.Request) {
+	if err := h.playbackService.EndStream(r.Context(), services.UserIDFromContext(r.Context()), chi.URLParam(r, "id")); err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stream godoc
+// @Summary Stream a video
+// @Description Stream a file of the video a playback token grants access to: the video itself, or an HLS playlist or segment next to it. Range requests are supported, except on master playlists of tokens capped to a height, which list only the variants up to it. URLs come from POST /movies/{id}/play.
+// @Tags movies
+// @Produce octet-stream
+// @Param token path string true "Playback token"
+// @Param file path string true "File of the video"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 502 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Router /stream/{token}/{file} [get]
+func (h *PlaybackHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	// Streams may outlast the server's write timeout and the request
+	// timeout, so they get their own
+	if timeout := h.playbackService.StreamTimeout(); timeout > 0 {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			h.logger.Warn("failed to extend stream write deadline", zap.Error(err))
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+	}
+
+	resp, err := h.playbackService.Open(ctx, chi.URLParam(r, "token"), chi.URLParam(r, "*"), r.Header)
+	if err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusForbidden:
+		sendError(w, r, CodeVideoFileNotFound, http.StatusNotFound)
+		return
+	case resp.StatusCode >= http.StatusInternalServerError:
+		h.logger.Warn("video storage error", zap.Int("status", resp.StatusCode), zap.String("file", chi.URLParam(r, "*")))
+		sendError(w, r, CodeVideoUnavailable, http.StatusBadGateway)
+		return
+	}
+
+	for _, name := range streamedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			w.Header().Set(name, value)
+		}
+	}
+	// Responses are only valid for the token's holder
+	w.Header().Set("Cache-Control", "private")
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// StreamLocal godoc
+// @Summary Stream a local video file
+// @Description Stream the video of a published movie stored as a local file (a file: video URL) on self-hosted deployments. Range requests are supported, so players can seek. Requires the playback token of the movie as the token query parameter, as in the URLs from POST /movies/{id}/play, or a bearer token of a user playing a stream of the movie started there. The stream is kept active while it is read, and refused once it has ended.
+// @Tags movies
+// @Produce octet-stream
+// @Param movieID path int true "Movie ID"
+// @Param token query string false "Playback token"
+// @Param Range header string false "Byte range, such as bytes=0-1048575"
+// @Success 200 {file} binary
+// @Success 206 {file} binary
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 416 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Router /stream/{movieID} [get]
+func (h *PlaybackHandler) StreamLocal(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "movieID"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" && services.UserIDFromContext(r.Context()) == 0 {
+		sendError(w, r, CodeMissingAuthorization, http.StatusUnauthorized)
+		return
+	}
+
+	f, err := h.playbackService.OpenLocal(r.Context(), movieID, token)
+	if err != nil {
+		h.sendPlaybackError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+	if info.IsDir() {
+		sendError(w, r, CodeVideoFileNotFound, http.StatusNotFound)
+		return
+	}
+
+	// Whole files may outlast the server's write timeout
+	if timeout := h.playbackService.StreamTimeout(); timeout > 0 {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			h.logger.Warn("failed to extend stream write deadline", zap.Error(err))
+		}
+	}
+
+	w.Header().Set("Cache-Control", "private")
+	// ServeContent answers Range, If-Range and conditional requests
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+func (h *PlaybackHandler) sendPlaybackError(w http.ResponseWriter, r *http.Request, err error) {
+	var limit *services.StreamLimitError
+	switch {
+	case errors.Is(err, playback.ErrExpiredToken):
+		sendError(w, r, CodePlaybackTokenExpired, http.StatusForbidden)
+	case errors.Is(err, playback.ErrMalformedToken), errors.Is(err, playback.ErrInvalidToken):
+		sendError(w, r, CodeInvalidPlaybackToken, http.StatusForbidden)
+	case errors.Is(err, services.ErrStreamEnded):
+		sendError(w, r, CodeStreamNotFound, http.StatusForbidden)
+	case errors.Is(err, services.ErrNoActiveStream):
+		sendError(w, r, CodeStreamNotStarted, http.StatusForbidden)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrNoVideo):
+		sendError(w, r, CodeNoVideo, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidPlaybackFile), errors.Is(err, services.ErrVideoFileNotFound),
+		errors.Is(err, services.ErrLocalVideo), errors.Is(err, playback.ErrInvalidLocalPath):
+		sendError(w, r, CodeVideoFileNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrNotLocalVideo):
+		sendError(w, r, CodeNotLocalVideo, http.StatusNotFound)
+	case errors.Is(err, services.ErrLocalVideosDisabled):
+		sendError(w, r, CodeLocalVideosDisabled, http.StatusServiceUnavailable)
+	case errors.As(err, &limit):
+		problem := StreamLimitProblem{
+			Problem:       apierror.New(r, http.StatusTooManyRequests, CodeTooManyStreams, "max", limit.Max),
+			MaxStreams:    limit.Max,
+			ActiveStreams: limit.Streams,
+		}
+		w.Header().Set("Content-Type", apierror.ContentType)
+		w.WriteHeader(problem.Status)
+		json.NewEncoder(w).Encode(problem)
+	case errors.Is(err, services.ErrStreamNotFound):
+		sendError(w, r, CodeStreamNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrQualityNotInPlan):
+		sendError(w, r, CodeQualityNotInPlan, http.StatusForbidden)
+	case errors.Is(err, services.ErrPlaybackDisabled):
+		sendError(w, r, CodePlaybackDisabled, http.StatusServiceUnavailable)
+	case errors.Is(err, services.ErrVideoUnavailable):
+		logError(h.logger, r, err)
+		sendError(w, r, CodeVideoUnavailable, http.StatusBadGateway)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
+
+// requestOrigin is the scheme and host the client reached the API at,
+// trusting the X-Forwarded-Proto header of a TLS-terminating proxy
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
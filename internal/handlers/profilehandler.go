@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type ProfileHandler struct {
+	profileService *services.ProfileService
+	logger         *zap.Logger
+}
+
+func NewProfileHandler(profileService *services.ProfileService, logger *zap.Logger) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+		logger:         logger,
+	}
+}
+
+// ProfileRequest is a viewer profile. Kids profiles default to, and may not
+// exceed, a PG maximum content rating. PIN is the parental PIN of the
+// profile, needed to change IsKids or MaxContentRating once it has one.
+type ProfileRequest struct {
+	Name             string `json:"name" example:"Kids"`
+	Avatar           string `json:"avatar,omitempty" example:"https://cdn.example.com/avatars/robot.png"`
+	IsKids           bool   `json:"is_kids,omitempty" example:"true"`
+	MaxContentRating string `json:"max_content_rating,omitempty" example:"PG" enums:"G,PG,PG-13,R,NC-17"`
+	PIN              string `json:"pin,omitempty" example:"1234"`
+}
+
+// SelectProfileRequest carries the refresh token of the session to switch to
+// a profile, or back to the account itself when ProfileID is 0, and the
+// parental PIN of the profile if it needs one
+type SelectProfileRequest struct {
+	ProfileID    int64  `json:"profile_id,omitempty" example:"3"`
+	PIN          string `json:"pin,omitempty" example:"1234"`
+	RefreshToken string `json:"refresh_token" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// PINRequest sets the parental PIN of a profile, or removes it when PIN is
+// empty. CurrentPIN is needed when the profile has one already.
+type PINRequest struct {
+	PIN        string `json:"pin" example:"1234"`
+	CurrentPIN string `json:"current_pin,omitempty" example:"4321"`
+}
+
+// DeleteProfileRequest is the optional body of profile deletions
+type DeleteProfileRequest struct {
+	PIN string `json:"pin,omitempty" example:"1234"`
+}
+
+// ProfileResponse is a viewer profile, with whether it has a parental PIN
+type ProfileResponse struct {
+	models.Profile
+	HasPIN bool `json:"has_pin" example:"false"`
+}
+
+// GetProfiles godoc
+// @Summary List profiles
+// @Description Get the viewer profiles of the authenticated user's account, oldest first
+// @Tags profiles
+// @Produce json
+// @Success 200 {array} ProfileResponse
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles [get]
+func (h *ProfileHandler) GetProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles, err := h.profileService.ListProfiles(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	resp := make([]ProfileResponse, len(profiles))
+	for i := range profiles {
+		resp[i] = newProfileResponse(&profiles[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetProfile godoc
+// @Summary Get a profile
+// @Description Get one of the viewer profiles of the authenticated user's account
+// @Tags profiles
+// @Produce json
+// @Param id path int true "Profile ID"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles/{id} [get]
+func (h *ProfileHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(w, r)
+	if !ok {
+		return
+	}
+
+	profile, err := h.profileService.GetProfile(r.Context(), services.UserIDFromContext(r.Context()), id)
+	if err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfileResponse(profile))
+}
+
+// CreateProfile godoc
+// @Summary Create a profile
+// @Description Add a viewer profile to the authenticated user's account, which may have up to 5 profiles with distinct names. Each profile has its own favorites and watch history.
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Param profile body ProfileRequest true "Profile"
+// @Success 201 {object} ProfileResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles [post]
+func (h *ProfileHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	var req ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	profile := req.profile(services.UserIDFromContext(r.Context()), 0)
+	if err := h.profileService.CreateProfile(r.Context(), profile); err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newProfileResponse(profile))
+}
+
+// UpdateProfile godoc
+// @Summary Update a profile
+// @Description Replace the name, avatar, kids flag and maximum content rating of one of the authenticated user's profiles. Changing the kids flag or maximum content rating of a profile with a parental PIN takes the PIN.
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Param id path int true "Profile ID"
+// @Param profile body ProfileRequest true "Profile"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles/{id} [put]
+func (h *ProfileHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(w, r)
+	if !ok {
+		return
+	}
+
+	var req ProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	profile := req.profile(services.UserIDFromContext(r.Context()), id)
+	if err := h.profileService.UpdateProfile(r.Context(), profile, req.PIN); err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfileResponse(profile))
+}
+
+// DeleteProfile godoc
+// @Summary Delete a profile
+// @Description Delete one of the authenticated user's profiles together with its favorites and watch history. Deleting a profile with a parental PIN takes the PIN.
+// @Tags profiles
+// @Accept json
+// @Param id path int true "Profile ID"
+// @Param request body DeleteProfileRequest false "Parental PIN"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles/{id} [delete]
+func (h *ProfileHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional, for profiles without a PIN
+	var req DeleteProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.profileService.DeleteProfile(r.Context(), services.UserIDFromContext(r.Context()), id, req.PIN); err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SelectProfile godoc
+// @Summary Select a profile
+// @Description Exchange the session's refresh token for tokens acting as one of the authenticated user's profiles, or as the account itself when profile_id is 0 or omitted. The access token carries the profile in its profile_id claim, and favorites, watch history and recommendations follow it. Refreshing keeps the profile. The refresh token is rotated as with /auth/refresh. Selecting a profile with a parental PIN takes the PIN, unless it is a kids profile. Movie listings of the profile leave out movies above its maximum content rating, and unrated ones.
+// @Tags profiles
+// @Accept json
+// @Produce json
+// @Param request body SelectProfileRequest true "Profile selection"
+// @Success 200 {object} AuthResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles/select [post]
+func (h *ProfileHandler) SelectProfile(w http.ResponseWriter, r *http.Request) {
+	var req SelectProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.RefreshToken == "" {
+		sendError(w, r, CodeRefreshTokenRequired, http.StatusBadRequest)
+		return
+	}
+	if req.ProfileID < 0 {
+		sendError(w, r, CodeInvalidProfileID, http.StatusBadRequest)
+		return
+	}
+
+	authResp, err := h.profileService.SelectProfile(r.Context(), services.UserIDFromContext(r.Context()), req.ProfileID, req.PIN, req.RefreshToken)
+	if err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResp)
+}
+
+// SetProfilePIN godoc
+// @Summary Set a profile's parental PIN
+// @Description Set the parental PIN of one of the authenticated user's profiles to 4 digits, or remove it with an empty pin. Changing or removing a PIN takes the current one. The PIN guards the kids flag, maximum content rating and deletion of the profile, and selecting it unless it is a kids profile.
+// @Tags profiles
+// @Accept json
+// @Param id path int true "Profile ID"
+// @Param request body PINRequest true "Parental PIN"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 429 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profiles/{id}/pin [put]
+func (h *ProfileHandler) SetProfilePIN(w http.ResponseWriter, r *http.Request) {
+	id, ok := profileID(w, r)
+	if !ok {
+		return
+	}
+
+	var req PINRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.profileService.SetPIN(r.Context(), services.UserIDFromContext(r.Context()), id, req.PIN, req.CurrentPIN); err != nil {
+		h.sendProfileError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newProfileResponse(profile *models.Profile) ProfileResponse {
+	return ProfileResponse{Profile: *profile, HasPIN: profile.PINHash != ""}
+}
+
+func (req ProfileRequest) profile(userID, id int64) *models.Profile {
+	return &models.Profile{
+		ID:               id,
+		UserID:           userID,
+		Name:             req.Name,
+		Avatar:           req.Avatar,
+		IsKids:           req.IsKids,
+		MaxContentRating: req.MaxContentRating,
+	}
+}
+
+// profileID parses the profile ID in the path, writing an error when it is
+// invalid
+func profileID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidProfileID, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *ProfileHandler) sendProfileError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidProfile):
+		sendError(w, r, CodeInvalidProfile, http.StatusBadRequest, "max", services.MaxProfileNameLength)
+	case errors.Is(err, services.ErrProfileNotFound):
+		sendError(w, r, CodeProfileNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrProfileNameTaken):
+		sendError(w, r, CodeProfileNameTaken, http.StatusConflict)
+	case errors.Is(err, services.ErrInvalidPIN):
+		sendError(w, r, CodeInvalidPIN, http.StatusBadRequest, "length", services.PINLength)
+	case errors.Is(err, services.ErrPINRequired):
+		sendError(w, r, CodePINRequired, http.StatusForbidden)
+	case errors.Is(err, services.ErrTooManyProfiles):
+		sendError(w, r, CodeTooManyProfiles, http.StatusConflict, "max", services.MaxProfiles)
+	case errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrUserNotFound):
+		sendError(w, r, CodeInvalidToken, http.StatusUnauthorized)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
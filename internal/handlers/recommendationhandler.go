@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+type RecommendationHandler struct {
+	recommendationService *services.RecommendationService
+	logger                *zap.Logger
+}
+
+func NewRecommendationHandler(recommendationService *services.RecommendationService, logger *zap.Logger) *RecommendationHandler {
+	return &RecommendationHandler{
+		recommendationService: recommendationService,
+		logger:                logger,
+	}
+}
+
+// RecommendationResponse is a recommended movie with the reason it was
+// recommended. Clients label rows by reason and report reason.code on the
+// analytics events of the title.
+type RecommendationResponse struct {
+	Movie  MovieResponse   `json:"movie"`
+	Reason services.Reason `json:"reason"`
+}
+
+// GetRecommendations godoc
+// @Summary Get recommended movies
+// @Description Get recommended movies, each with the reason it was recommended: because_you_watched, because_you_liked, popular_in_category, new_this_week, trending or top_rated. Signed-in users get titles similar to what they watched and favorited and popular in their favourite category first; anonymous users get new, trending and top rated titles. Report the reason code on impression, play_start and recommendation_click events.
+// @Tags recommendations
+// @Produce json
+// @Param limit query int false "Number of movies to return, at most 100 (default: 20)"
+// @Success 200 {array} RecommendationResponse
+// @Failure 500 {object} apierror.Problem
+// @Router /recommendations [get]
+func (h *RecommendationHandler) GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	h.recommend(w, r)
+}
+
+// GetRecommendedMovies godoc
+// @Summary Get personalised movie recommendations
+// @Description Get movies recommended for the signed-in user from their watch history, favorites and category affinities, each with the reason it was recommended. Titles they already watched or favorited are left out.
+// @Tags recommendations
+// @Produce json
+// @Security BearerAuth
+// @Param limit query int false "Number of movies to return, at most 100 (default: 20)"
+// @Success 200 {array} RecommendationResponse
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/recommended [get]
+func (h *RecommendationHandler) GetRecommendedMovies(w http.ResponseWriter, r *http.Request) {
+	h.recommend(w, r)
+}
+
+// recommend writes the recommendations for the user of r, if signed in
+func (h *RecommendationHandler) recommend(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= services.MaxRecommendations {
+			limit = l
+		}
+	}
+
+	ctx := r.Context()
+	recs, err := h.recommendationService.Recommend(ctx, services.UserIDFromContext(ctx), services.ProfileIDFromContext(ctx), limit)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]RecommendationResponse, len(recs))
+	for i, rec := range recs {
+		response[i] = RecommendationResponse{
+			Movie: MovieResponse{
+				ID:             rec.Movie.ID,
+				Title:          rec.Movie.Title,
+				Description:    rec.Movie.Description,
+				ReleaseYear:    rec.Movie.ReleaseYear,
+				Duration:       rec.Movie.Duration,
+				PosterURL:      rec.Movie.PosterURL,
+				Categories:     movieCategories(rec.Movie.CategoryRefs),
+				MaturityRating: rec.Movie.MaturityRating,
+				Rating:         rec.Movie.Rating,
+			},
+			Reason: rec.Reason,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
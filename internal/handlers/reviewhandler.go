@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type ReviewHandler struct {
+	reviewService *services.ReviewService
+	logger        *zap.Logger
+}
+
+func NewReviewHandler(reviewService *services.ReviewService, logger *zap.Logger) *ReviewHandler {
+	return &ReviewHandler{
+		reviewService: reviewService,
+		logger:        logger,
+	}
+}
+
+// ReviewRequest is a score of a movie from 1 to 5 with optional text
+type ReviewRequest struct {
+	Score int    `json:"score" example:"4"`
+	Text  string `json:"text,omitempty" example:"Holds up remarkably well."`
+}
+
+type ReviewResponse struct {
+	ID        int64     `json:"id" example:"1"`
+	MovieID   int64     `json:"movie_id" example:"42"`
+	UserID    int64     `json:"user_id,omitempty" example:"7"` // none once its user deleted their account
+	UserName  string    `json:"user_name,omitempty" example:"Jane"`
+	Score     int       `json:"score" example:"4"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PaginatedReviewResponse struct {
+	Reviews []ReviewResponse `json:"reviews"`
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+}
+
+// GetReviews godoc
+// @Summary Get the reviews of a movie
+// @Description Get a page of a movie's reviews, newest first
+// @Tags reviews
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size, at most 100 (default: 20)"
+// @Success 200 {object} PaginatedReviewResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/{id}/reviews [get]
+func (h *ReviewHandler) GetReviews(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
+		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+			page = p
+		}
+	}
+	pageSize := 20
+	if pageSizeStr := r.URL.Query().Get("page_size"); pageSizeStr != "" {
+		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= services.MaxReviewPageSize {
+			pageSize = ps
+		}
+	}
+
+	reviews, total, err := h.reviewService.ListReviews(r.Context(), movieID, page, pageSize)
+	if err != nil {
+		h.sendReviewError(w, r, err)
+		return
+	}
+
+	response := PaginatedReviewResponse{
+		Reviews: make([]ReviewResponse, len(reviews)),
+		Total:   total,
+		Page:    page,
+	}
+	for i := range reviews {
+		response.Reviews[i] = newReviewResponse(&reviews[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateReview godoc
+// @Summary Review a movie
+// @Description Score a movie from 1 to 5 with optional text. Each user may review a movie once; the movie's rating becomes the average score of its reviews. Text is screened by the content filter.
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param review body ReviewRequest true "Review"
+// @Success 201 {object} ReviewResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /movies/{id}/reviews [post]
+func (h *ReviewHandler) CreateReview(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	review := &models.Review{
+		UserID:  services.UserIDFromContext(r.Context()),
+		MovieID: movieID,
+		Score:   req.Score,
+		Text:    req.Text,
+	}
+	if err := h.reviewService.CreateReview(r.Context(), review); err != nil {
+		h.sendReviewError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newReviewResponse(review))
+}
+
+// UpdateReview godoc
+// @Summary Update a review
+// @Description Change the score and text of the authenticated user's review of a movie
+// @Tags reviews
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param reviewID path int true "Review ID"
+// @Param review body ReviewRequest true "Review"
+// @Success 200 {object} ReviewResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /movies/{id}/reviews/{reviewID} [put]
+func (h *ReviewHandler) UpdateReview(w http.ResponseWriter, r *http.Request) {
+	movieID, reviewID, ok := reviewIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	review, err := h.reviewService.UpdateReview(r.Context(), services.UserIDFromContext(r.Context()),
+		movieID, reviewID, req.Score, req.Text)
+	if err != nil {
+		h.sendReviewError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newReviewResponse(review))
+}
+
+// DeleteReview godoc
+// @Summary Delete a review
+// @Description Delete the authenticated user's review of a movie. Admins may delete any review.
+// @Tags reviews
+// @Param id path int true "Movie ID"
+// @Param reviewID path int true "Review ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 403 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /movies/{id}/reviews/{reviewID} [delete]
+func (h *ReviewHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	movieID, reviewID, ok := reviewIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.reviewService.DeleteReview(r.Context(), services.UserIDFromContext(r.Context()), movieID, reviewID); err != nil {
+		h.sendReviewError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reviewIDs parses the movie and review IDs in the path, writing an error
+// when either is invalid
+func reviewIDs(w http.ResponseWriter, r *http.Request) (movieID, reviewID int64, ok bool) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return 0, 0, false
+	}
+	reviewID, err = strconv.ParseInt(chi.URLParam(r, "reviewID"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidReviewID, http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return movieID, reviewID, true
+}
+
+func newReviewResponse(review *models.Review) ReviewResponse {
+	response := ReviewResponse{
+		ID:        review.ID,
+		MovieID:   review.MovieID,
+		UserID:    review.UserID,
+		Score:     review.Score,
+		Text:      review.Text,
+		CreatedAt: review.CreatedAt,
+		UpdatedAt: review.UpdatedAt,
+	}
+	if review.User != nil {
+		response.UserName = review.User.Name
+	}
+	return response
+}
+
+func (h *ReviewHandler) sendReviewError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReview):
+		sendError(w, r, CodeInvalidReview, http.StatusBadRequest)
+	case errors.Is(err, services.ErrContentRejected):
+		sendError(w, r, CodeContentRejected, http.StatusUnprocessableEntity)
+	case errors.Is(err, services.ErrReviewExists):
+		sendError(w, r, CodeReviewExists, http.StatusConflict)
+	case errors.Is(err, services.ErrReviewForbidden):
+		sendError(w, r, CodeReviewForbidden, http.StatusForbidden)
+	case errors.Is(err, services.ErrReviewNotFound):
+		sendError(w, r, CodeReviewNotFound, http.StatusNotFound)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
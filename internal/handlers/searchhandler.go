@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type SearchHandler struct {
+	searchService  *services.SearchService
+	synonymService *services.SynonymService
+	logger         *zap.Logger
+}
+
+func NewSearchHandler(searchService *services.SearchService, synonymService *services.SynonymService, logger *zap.Logger) *SearchHandler {
+	return &SearchHandler{
+		searchService:  searchService,
+		synonymService: synonymService,
+		logger:         logger,
+	}
+}
+
+type MovieSearchGroup struct {
+	Total int             `json:"total" example:"12"`
+	Items []MovieResponse `json:"items"`
+}
+
+type SeriesSearchGroup struct {
+	Total int             `json:"total" example:"2"`
+	Items []models.Series `json:"items"`
+}
+
+type CategorySearchGroup struct {
+	Total int                `json:"total" example:"1"`
+	Items []CategoryResponse `json:"items"`
+}
+
+// CollectionSearchItem is a visible collection matching a search, without
+// its movies
+type CollectionSearchItem struct {
+	ID          int64  `json:"id" example:"1"`
+	Slug        string `json:"slug" example:"staff-picks"`
+	Title       string `json:"title" example:"Staff Picks"`
+	Description string `json:"description,omitempty" example:"Favorites of the team"`
+}
+
+type CollectionSearchGroup struct {
+	Total int                    `json:"total" example:"1"`
+	Items []CollectionSearchItem `json:"items"`
+}
+
+// SearchResponse groups search results by entity; groups that were not
+// requested are left out. Suggestions offers corrections when nothing
+// matched.
+type SearchResponse struct {
+	Query       string                 `json:"query" example:"matrix"`
+	Movies      *MovieSearchGroup      `json:"movies,omitempty"`
+	Series      *SeriesSearchGroup     `json:"series,omitempty"`
+	Categories  *CategorySearchGroup   `json:"categories,omitempty"`
+	Collections *CollectionSearchGroup `json:"collections,omitempty"`
+	Suggestions []string               `json:"suggestions,omitempty" example:"The Matrix"`
+}
+
+// SynonymRequest makes searches for Term also match its Alternatives
+type SynonymRequest struct {
+	Term         string   `json:"term" example:"sci fi"`
+	Alternatives []string `json:"alternatives" example:"science fiction,sci-fi"`
+}
+
+// Search godoc
+// @Summary Search all entities
+// @Description Search movies, series, categories and collections in one call. Each group holds its best matches, exact name matches first, then names starting with the term, then other matches, and the total number of matches. Ties go to trending and better rated movies, newer series and collections in display order. When nothing matches, suggestions lists similar titles, names and synonyms to offer as corrections.
+// @Tags search
+// @Produce json
+// @Param q query string true "Search term"
+// @Param types query string false "Comma-separated groups to search: movies, series, categories, collections (default: all)"
+// @Param limit query int false "Results per group, at most 50 (default: 5)"
+// @Param movies_limit query int false "Results in the movies group, overriding limit"
+// @Param series_limit query int false "Results in the series group, overriding limit"
+// @Param categories_limit query int false "Results in the categories group, overriding limit"
+// @Param collections_limit query int false "Results in the collections group, overriding limit"
+// @Success 200 {object} SearchResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /search [get]
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	groups := services.SearchGroups
+	if types := query.Get("types"); types != "" {
+		groups = strings.Split(types, ",")
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	limits := make(map[string]int, len(groups))
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" {
+			continue
+		}
+		limits[group] = limit
+		if n, err := strconv.Atoi(query.Get(group + "_limit")); err == nil {
+			limits[group] = n
+		}
+	}
+
+	term := query.Get("q")
+	results, err := h.searchService.Search(r.Context(), term, limits)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSearchTerm):
+			sendError(w, r, CodeInvalidSearchTerm, http.StatusBadRequest)
+		case errors.Is(err, services.ErrUnknownSearchType):
+			sendError(w, r, CodeInvalidSearchTypes, http.StatusBadRequest)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	response := SearchResponse{Query: strings.TrimSpace(term), Suggestions: results.Suggestions}
+	if _, ok := limits[services.SearchGroupMovies]; ok {
+		response.Movies = &MovieSearchGroup{Total: results.MoviesTotal, Items: make([]MovieResponse, len(results.Movies))}
+		for i, movie := range results.Movies {
+			response.Movies.Items[i] = MovieResponse{
+				ID:             movie.ID,
+				Title:          movie.Title,
+				Description:    movie.Description,
+				ReleaseYear:    movie.ReleaseYear,
+				Duration:       movie.Duration,
+				PosterURL:      movie.PosterURL,
+				Categories:     movieCategories(movie.CategoryRefs),
+				MaturityRating: movie.MaturityRating,
+				Rating:         movie.Rating,
+			}
+		}
+	}
+	if _, ok := limits[services.SearchGroupSeries]; ok {
+		response.Series = &SeriesSearchGroup{Total: results.SeriesTotal, Items: results.Series}
+		if response.Series.Items == nil {
+			response.Series.Items = []models.Series{}
+		}
+	}
+	if _, ok := limits[services.SearchGroupCategories]; ok {
+		response.Categories = &CategorySearchGroup{Total: results.CategoriesTotal, Items: make([]CategoryResponse, len(results.Categories))}
+		for i, category := range results.Categories {
+			response.Categories.Items[i] = CategoryResponse{
+				ID:           category.ID,
+				Name:         category.Name,
+				DisplayOrder: category.DisplayOrder,
+			}
+		}
+	}
+	if _, ok := limits[services.SearchGroupCollections]; ok {
+		response.Collections = &CollectionSearchGroup{Total: results.CollectionsTotal, Items: make([]CollectionSearchItem, len(results.Collections))}
+		for i, collection := range results.Collections {
+			response.Collections.Items[i] = CollectionSearchItem{
+				ID:          collection.ID,
+				Slug:        collection.Slug,
+				Title:       collection.Title,
+				Description: collection.Description,
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSynonyms godoc
+// @Summary List search synonyms
+// @Description Get the synonym dictionary searches are expanded with
+// @Tags search
+// @Produce json
+// @Success 200 {array} models.SearchSynonym
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/search/synonyms [get]
+func (h *SearchHandler) GetSynonyms(w http.ResponseWriter, r *http.Request) {
+	synonyms, err := h.synonymService.GetSynonyms(r.Context())
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(synonyms)
+}
+
+// CreateSynonym godoc
+// @Summary Create a search synonym
+// @Description Make searches containing a term as whole words also match the term replaced by each alternative: synonyms, alternate titles or the correct spelling of a misspelling. Terms are matched case-insensitively.
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param request body SynonymRequest true "Synonym"
+// @Success 201 {object} models.SearchSynonym
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/search/synonyms [post]
+func (h *SearchHandler) CreateSynonym(w http.ResponseWriter, r *http.Request) {
+	var req SynonymRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	synonym := &models.SearchSynonym{Term: req.Term, Alternatives: req.Alternatives}
+	if err := h.synonymService.CreateSynonym(r.Context(), synonym); err != nil {
+		h.sendSynonymError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(synonym)
+}
+
+// UpdateSynonym godoc
+// @Summary Update a search synonym
+// @Tags search
+// @Accept json
+// @Produce json
+// @Param id path int true "Synonym ID"
+// @Param request body SynonymRequest true "Synonym"
+// @Success 200 {object} models.SearchSynonym
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/search/synonyms/{id} [put]
+func (h *SearchHandler) UpdateSynonym(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSynonymID, http.StatusBadRequest)
+		return
+	}
+
+	var req SynonymRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	synonym := &models.SearchSynonym{ID: id, Term: req.Term, Alternatives: req.Alternatives}
+	if err := h.synonymService.UpdateSynonym(r.Context(), synonym); err != nil {
+		h.sendSynonymError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(synonym)
+}
+
+// DeleteSynonym godoc
+// @Summary Delete a search synonym
+// @Tags search
+// @Param id path int true "Synonym ID"
+// @Success 204
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/search/synonyms/{id} [delete]
+func (h *SearchHandler) DeleteSynonym(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSynonymID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.synonymService.DeleteSynonym(r.Context(), id); err != nil {
+		h.sendSynonymError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SearchHandler) sendSynonymError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSynonym):
+		sendError(w, r, CodeInvalidSynonym, http.StatusBadRequest)
+	case errors.Is(err, services.ErrSynonymExists):
+		sendError(w, r, CodeSynonymExists, http.StatusConflict)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeSynonymNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
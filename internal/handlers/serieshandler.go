@@ -0,0 +1,545 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type SeriesHandler struct {
+	seriesService *services.SeriesService
+	logger        *zap.Logger
+}
+
+func NewSeriesHandler(seriesService *services.SeriesService, logger *zap.Logger) *SeriesHandler {
+	return &SeriesHandler{
+		seriesService: seriesService,
+		logger:        logger,
+	}
+}
+
+// SeriesRequest is a series' details
+type SeriesRequest struct {
+	Title       string   `json:"title" example:"Dark" validate:"required,max=255"`
+	Description string   `json:"description" example:"A missing child sets four families on a frantic hunt for answers..."`
+	ReleaseYear int      `json:"release_year" example:"2017" validate:"omitempty,gte=1888,lte=2100"`
+	PosterURL   string   `json:"poster_url" example:"https://example.com/dark.jpg" validate:"omitempty,http_url"`
+	Categories  []string `json:"categories" example:"['Drama', 'Sci-Fi']"`
+}
+
+func (req *SeriesRequest) series() *models.Series {
+	return &models.Series{
+		Title:       req.Title,
+		Description: req.Description,
+		ReleaseYear: req.ReleaseYear,
+		PosterURL:   req.PosterURL,
+		Categories:  req.Categories,
+	}
+}
+
+// SeasonRequest is a season's details. Number is its position in the
+// series, from 1.
+type SeasonRequest struct {
+	Number      int    `json:"number" example:"1" validate:"gt=0"`
+	Title       string `json:"title,omitempty" example:"Season 1" validate:"max=255"`
+	Description string `json:"description,omitempty"`
+	ReleaseYear int    `json:"release_year,omitempty" example:"2017" validate:"omitempty,gte=1888,lte=2100"`
+	PosterURL   string `json:"poster_url,omitempty" validate:"omitempty,http_url"`
+}
+
+func (req *SeasonRequest) season() *models.Season {
+	return &models.Season{
+		Number:      req.Number,
+		Title:       req.Title,
+		Description: req.Description,
+		ReleaseYear: req.ReleaseYear,
+		PosterURL:   req.PosterURL,
+	}
+}
+
+// EpisodeRequest is an episode's details. Number is its position in the
+// season, from 1, and Duration is in minutes.
+type EpisodeRequest struct {
+	Number      int    `json:"number" example:"1" validate:"gt=0"`
+	Title       string `json:"title" example:"Secrets" validate:"required,max=255"`
+	Description string `json:"description,omitempty"`
+	Duration    int    `json:"duration" example:"51" validate:"gt=0"`
+	VideoURL    string `json:"video_url" example:"https://example.com/dark-s01e01.mp4" validate:"omitempty,http_url"`
+	AirDate     string `json:"air_date,omitempty" example:"2017-12-01" validate:"omitempty,datetime=2006-01-02"`
+}
+
+func (req *EpisodeRequest) episode() *models.Episode {
+	episode := &models.Episode{
+		Number:      req.Number,
+		Title:       req.Title,
+		Description: req.Description,
+		Duration:    req.Duration,
+		VideoURL:    req.VideoURL,
+	}
+	// The format is checked by validation
+	if airDate, err := time.Parse("2006-01-02", req.AirDate); err == nil {
+		episode.AirDate = &airDate
+	}
+	return episode
+}
+
+type PaginatedSeriesResponse struct {
+	Series []models.Series `json:"series"`
+	Total  int             `json:"total"`
+	Page   int             `json:"page"`
+}
+
+// ListSeries godoc
+// @Summary Get all series
+// @Description Get a paginated list of TV series, newest first, with optional filtering. Seasons are not included.
+// @Tags series
+// @Produce json
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 10)"
+// @Param search query string false "Search term"
+// @Param year query int false "Filter by year"
+// @Param categories query []string false "Filter by categories"
+// @Success 200 {object} PaginatedSeriesResponse
+// @Failure 500 {object} apierror.Problem
+// @Router /series [get]
+func (h *SeriesHandler) ListSeries(w http.ResponseWriter, r *http.Request) {
+	filter := services.SeriesFilter{
+		Search:     r.URL.Query().Get("search"),
+		Categories: r.URL.Query()["categories"],
+		Page:       1,
+		PageSize:   10,
+	}
+	if year, err := strconv.Atoi(r.URL.Query().Get("year")); err == nil {
+		filter.Year = &year
+	}
+	if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(r.URL.Query().Get("page_size")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+
+	series, total, err := h.seriesService.ListSeries(r.Context(), filter)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(PaginatedSeriesResponse{Series: series, Total: total, Page: filter.Page})
+}
+
+// GetSeries godoc
+// @Summary Get a series by ID
+// @Description Get a TV series with its seasons and their episodes, in order
+// @Tags series
+// @Produce json
+// @Param id path int true "Series ID"
+// @Success 200 {object} models.Series
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /series/{id} [get]
+func (h *SeriesHandler) GetSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeriesID, http.StatusBadRequest)
+		return
+	}
+
+	series, err := h.seriesService.GetSeries(r.Context(), id)
+	if err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// GetSeason godoc
+// @Summary Get a season of a series
+// @Description Get a season by its number in the series, with its episodes in order
+// @Tags series
+// @Produce json
+// @Param id path int true "Series ID"
+// @Param number path int true "Season number"
+// @Success 200 {object} models.Season
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /series/{id}/seasons/{number} [get]
+func (h *SeriesHandler) GetSeason(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeriesID, http.StatusBadRequest)
+		return
+	}
+	number, err := strconv.Atoi(chi.URLParam(r, "number"))
+	if err != nil || number <= 0 {
+		sendError(w, r, CodeInvalidSeasonNumber, http.StatusBadRequest)
+		return
+	}
+
+	season, err := h.seriesService.GetSeason(r.Context(), id, number)
+	if err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(season)
+}
+
+// GetEpisode godoc
+// @Summary Get an episode by ID
+// @Description Get an episode with its video URL and duration
+// @Tags series
+// @Produce json
+// @Param id path int true "Episode ID"
+// @Success 200 {object} models.Episode
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /episodes/{id} [get]
+func (h *SeriesHandler) GetEpisode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidEpisodeID, http.StatusBadRequest)
+		return
+	}
+
+	episode, err := h.seriesService.GetEpisode(r.Context(), id)
+	if err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(episode)
+}
+
+// CreateSeries godoc
+// @Summary Create a series
+// @Description Create a TV series. Seasons are added separately.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param request body SeriesRequest true "Series details"
+// @Success 201 {object} models.Series
+// @Failure 400 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/series [post]
+func (h *SeriesHandler) CreateSeries(w http.ResponseWriter, r *http.Request) {
+	var req SeriesRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	series := req.series()
+	if err := h.seriesService.CreateSeries(r.Context(), series); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(series)
+}
+
+// UpdateSeries godoc
+// @Summary Update a series
+// @Description Replace the details of a TV series. Its seasons are kept.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path int true "Series ID"
+// @Param request body SeriesRequest true "Series details"
+// @Success 200 {object} models.Series
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/series/{id} [put]
+func (h *SeriesHandler) UpdateSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeriesID, http.StatusBadRequest)
+		return
+	}
+
+	var req SeriesRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	series := req.series()
+	series.ID = id
+	if err := h.seriesService.UpdateSeries(r.Context(), series); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// DeleteSeries godoc
+// @Summary Delete a series
+// @Description Delete a TV series with all its seasons and episodes
+// @Tags series
+// @Param id path int true "Series ID"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/series/{id} [delete]
+func (h *SeriesHandler) DeleteSeries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeriesID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.seriesService.DeleteSeries(r.Context(), id); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateSeason godoc
+// @Summary Add a season to a series
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path int true "Series ID"
+// @Param request body SeasonRequest true "Season details"
+// @Success 201 {object} models.Season
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/series/{id}/seasons [post]
+func (h *SeriesHandler) CreateSeason(w http.ResponseWriter, r *http.Request) {
+	seriesID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeriesID, http.StatusBadRequest)
+		return
+	}
+
+	var req SeasonRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	season := req.season()
+	season.SeriesID = seriesID
+	if err := h.seriesService.CreateSeason(r.Context(), season); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(season)
+}
+
+// UpdateSeason godoc
+// @Summary Update a season
+// @Description Replace the details of a season, including its number. Its episodes are kept.
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path int true "Season ID"
+// @Param request body SeasonRequest true "Season details"
+// @Success 200 {object} models.Season
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/seasons/{id} [put]
+func (h *SeriesHandler) UpdateSeason(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeasonID, http.StatusBadRequest)
+		return
+	}
+
+	var req SeasonRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	season := req.season()
+	season.ID = id
+	if err := h.seriesService.UpdateSeason(r.Context(), season); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(season)
+}
+
+// DeleteSeason godoc
+// @Summary Delete a season
+// @Description Delete a season with its episodes
+// @Tags series
+// @Param id path int true "Season ID"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/seasons/{id} [delete]
+func (h *SeriesHandler) DeleteSeason(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeasonID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.seriesService.DeleteSeason(r.Context(), id); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateEpisode godoc
+// @Summary Add an episode to a season
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path int true "Season ID"
+// @Param request body EpisodeRequest true "Episode details"
+// @Success 201 {object} models.Episode
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/seasons/{id}/episodes [post]
+func (h *SeriesHandler) CreateEpisode(w http.ResponseWriter, r *http.Request) {
+	seasonID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidSeasonID, http.StatusBadRequest)
+		return
+	}
+
+	var req EpisodeRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	episode := req.episode()
+	episode.SeasonID = seasonID
+	if err := h.seriesService.CreateEpisode(r.Context(), episode); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(episode)
+}
+
+// UpdateEpisode godoc
+// @Summary Update an episode
+// @Description Replace the details of an episode, including its number
+// @Tags series
+// @Accept json
+// @Produce json
+// @Param id path int true "Episode ID"
+// @Param request body EpisodeRequest true "Episode details"
+// @Success 200 {object} models.Episode
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/episodes/{id} [put]
+func (h *SeriesHandler) UpdateEpisode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidEpisodeID, http.StatusBadRequest)
+		return
+	}
+
+	var req EpisodeRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	episode := req.episode()
+	episode.ID = id
+	if err := h.seriesService.UpdateEpisode(r.Context(), episode); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(episode)
+}
+
+// DeleteEpisode godoc
+// @Summary Delete an episode
+// @Tags series
+// @Param id path int true "Episode ID"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/episodes/{id} [delete]
+func (h *SeriesHandler) DeleteEpisode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidEpisodeID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.seriesService.DeleteEpisode(r.Context(), id); err != nil {
+		h.sendSeriesError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *SeriesHandler) sendSeriesError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrSeriesNotFound):
+		sendError(w, r, CodeSeriesNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrSeasonNotFound):
+		sendError(w, r, CodeSeasonNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrEpisodeNotFound):
+		sendError(w, r, CodeEpisodeNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrSeriesExists):
+		sendError(w, r, CodeSeriesExists, http.StatusConflict)
+	case errors.Is(err, services.ErrSeasonExists):
+		sendError(w, r, CodeSeasonExists, http.StatusConflict)
+	case errors.Is(err, services.ErrEpisodeExists):
+		sendError(w, r, CodeEpisodeExists, http.StatusConflict)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"github.com/ndn/internal/subtitle"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+// subtitleFormOverhead is room for the multipart framing and label field
+// around an uploaded subtitle track
+const subtitleFormOverhead = 16 << 10
+
+type SubtitleHandler struct {
+	subtitleService *services.SubtitleService
+	logger          *zap.Logger
+}
+
+func NewSubtitleHandler(subtitleService *services.SubtitleService, logger *zap.Logger) *SubtitleHandler {
+	return &SubtitleHandler{
+		subtitleService: subtitleService,
+		logger:          logger,
+	}
+}
+
+// SubtitleResponse is a subtitle track of a movie. url serves it as WebVTT,
+// for the src of a <track> element or an HLS subtitle rendition.
+type SubtitleResponse struct {
+	Language  string    `json:"language" example:"pt-BR"`
+	Label     string    `json:"label" example:"Português (Brasil)"`
+	Format    string    `json:"format" example:"srt"`
+	URL       string    `json:"url" example:"https://api.example.com/api/movies/42/subtitles/pt-BR"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetSubtitles godoc
+// @Summary List the subtitle tracks of a movie
+// @Description List the subtitle tracks available for a movie by language, so players can offer captions. Each track is served as WebVTT from its url.
+// @Tags subtitles
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {array} SubtitleResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/{id}/subtitles [get]
+func (h *SubtitleHandler) GetSubtitles(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	subtitles, err := h.subtitleService.ListSubtitles(r.Context(), movieID)
+	if err != nil {
+		h.sendSubtitleError(w, r, err)
+		return
+	}
+
+	response := make([]SubtitleResponse, len(subtitles))
+	for i := range subtitles {
+		response[i] = newSubtitleResponse(r, &subtitles[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetSubtitle godoc
+// @Summary Get a subtitle track
+// @Description Get the subtitle track of a movie in a language as WebVTT. Conditional requests are supported.
+// @Tags subtitles
+// @Produce text/vtt
+// @Param id path int true "Movie ID"
+// @Param language path string true "Language tag, such as en or pt-BR"
+// @Success 200 {string} string
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Router /movies/{id}/subtitles/{language} [get]
+func (h *SubtitleHandler) GetSubtitle(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	track, err := h.subtitleService.GetSubtitle(r.Context(), movieID, chi.URLParam(r, "language"))
+	if err != nil {
+		h.sendSubtitleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Language", track.Language)
+	http.ServeContent(w, r, track.Language+".vtt", track.UpdatedAt, bytes.NewReader([]byte(track.Content)))
+}
+
+// PutSubtitle godoc
+// @Summary Upload a subtitle track
+// @Description Upload an SRT or WebVTT file, in UTF-8, as the subtitle track of a movie in a language, replacing any track the movie has in that language. SRT is converted to WebVTT. label names the track in players and defaults to the language tag.
+// @Tags subtitles
+// @Accept multipart/form-data
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param language path string true "Language tag, such as en or pt-BR"
+// @Param subtitle formData file true "SRT or WebVTT file"
+// @Param label formData string false "Track label, such as English (CC)"
+// @Success 200 {object} SubtitleResponse
+// @Success 201 {object} SubtitleResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/subtitles/{language} [put]
+func (h *SubtitleHandler) PutSubtitle(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, services.MaxSubtitleSize+subtitleFormOverhead)
+	file, _, err := r.FormFile("subtitle")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, r, CodeSubtitleTooLarge, http.StatusRequestEntityTooLarge, "max", services.MaxSubtitleSize)
+			return
+		}
+		sendError(w, r, CodeSubtitleRequired, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so oversized tracks are rejected rather
+	// than truncated
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxSubtitleSize+1))
+	if err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	track, created, err := h.subtitleService.PutSubtitle(r.Context(), movieID, chi.URLParam(r, "language"), r.FormValue("label"), data)
+	if err != nil {
+		h.sendSubtitleError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(newSubtitleResponse(r, track))
+}
+
+// DeleteSubtitle godoc
+// @Summary Delete a subtitle track
+// @Description Delete the subtitle track of a movie in a language
+// @Tags subtitles
+// @Param id path int true "Movie ID"
+// @Param language path string true "Language tag, such as en or pt-BR"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/subtitles/{language} [delete]
+func (h *SubtitleHandler) DeleteSubtitle(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.subtitleService.DeleteSubtitle(r.Context(), movieID, chi.URLParam(r, "language")); err != nil {
+		h.sendSubtitleError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newSubtitleResponse(r *http.Request, track *models.Subtitle) SubtitleResponse {
+	return SubtitleResponse{
+		Language:  track.Language,
+		Label:     track.Label,
+		Format:    track.Format,
+		URL:       fmt.Sprintf("%s/api/movies/%d/subtitles/%s", requestOrigin(r), track.MovieID, url.PathEscape(track.Language)),
+		CreatedAt: track.CreatedAt,
+		UpdatedAt: track.UpdatedAt,
+	}
+}
+
+func (h *SubtitleHandler) sendSubtitleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrSubtitleNotFound):
+		sendError(w, r, CodeSubtitleNotFound, http.StatusNotFound)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidSubtitleLanguage):
+		sendError(w, r, CodeInvalidSubtitleLanguage, http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidSubtitleLabel):
+		sendError(w, r, CodeInvalidSubtitleLabel, http.StatusBadRequest)
+	case errors.Is(err, services.ErrSubtitleTooLarge):
+		sendError(w, r, CodeSubtitleTooLarge, http.StatusRequestEntityTooLarge, "max", services.MaxSubtitleSize)
+	case errors.Is(err, subtitle.ErrInvalidSubtitle):
+		sendError(w, r, CodeInvalidSubtitle, http.StatusUnprocessableEntity)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
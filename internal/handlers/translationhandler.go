@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type TranslationHandler struct {
+	movieService *services.MovieService
+	logger       *zap.Logger
+}
+
+func NewTranslationHandler(movieService *services.MovieService, logger *zap.Logger) *TranslationHandler {
+	return &TranslationHandler{
+		movieService: movieService,
+		logger:       logger,
+	}
+}
+
+// TranslationRequest is the title and description of a movie in a locale.
+// Either may be left empty to show the movie's own.
+type TranslationRequest struct {
+	Title       string `json:"title,omitempty" example:"Matrix"`
+	Description string `json:"description,omitempty" example:"Um hacker descobre a verdadeira natureza da realidade."`
+}
+
+// GetTranslations godoc
+// @Summary List the translations of a movie
+// @Description List the titles and descriptions of a movie in other locales, by locale
+// @Tags translations
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {array} models.MovieTranslation
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/translations [get]
+func (h *TranslationHandler) GetTranslations(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	translations, err := h.movieService.ListTranslations(r.Context(), movieID)
+	if err != nil {
+		h.sendTranslationError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(translations)
+}
+
+// PutTranslation godoc
+// @Summary Translate a movie
+// @Description Set the title and description of a movie in a locale, such as es or pt-BR, replacing any translation into it. Clients asking for the locale with Accept-Language or the lang query parameter get them in place of the movie's own; a translation into a language also serves its regional variants.
+// @Tags translations
+// @Accept json
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Param locale path string true "Locale, such as es or pt-BR"
+// @Param translation body TranslationRequest true "Translation"
+// @Success 200 {object} models.MovieTranslation
+// @Success 201 {object} models.MovieTranslation
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/translations/{locale} [put]
+func (h *TranslationHandler) PutTranslation(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	var req TranslationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	translation := &models.MovieTranslation{
+		MovieID:     movieID,
+		Locale:      chi.URLParam(r, "locale"),
+		Title:       req.Title,
+		Description: req.Description,
+	}
+	created, err := h.movieService.PutTranslation(r.Context(), translation)
+	if err != nil {
+		h.sendTranslationError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(translation)
+}
+
+// DeleteTranslation godoc
+// @Summary Delete a translation of a movie
+// @Description Delete the translation of a movie into a locale
+// @Tags translations
+// @Param id path int true "Movie ID"
+// @Param locale path string true "Locale, such as es or pt-BR"
+// @Success 204
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/translations/{locale} [delete]
+func (h *TranslationHandler) DeleteTranslation(w http.ResponseWriter, r *http.Request) {
+	movieID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.movieService.DeleteTranslation(r.Context(), movieID, chi.URLParam(r, "locale")); err != nil {
+		h.sendTranslationError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *TranslationHandler) sendTranslationError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrTranslationNotFound):
+		sendError(w, r, CodeTranslationNotFound, http.StatusNotFound)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidLocale):
+		sendError(w, r, CodeInvalidLocale, http.StatusBadRequest)
+	case errors.Is(err, services.ErrInvalidTranslation):
+		sendError(w, r, CodeInvalidTranslation, http.StatusBadRequest)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
@@ -1,21 +1,32 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/patch"
 	"github.com/ndn/internal/services"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 )
 
 type UserHandler struct {
 	userService *services.UserService
+	logger      *zap.Logger
 }
 
-func NewUserHandler(userService *services.UserService) *UserHandler {
+func NewUserHandler(userService *services.UserService, logger *zap.Logger) *UserHandler {
 	return &UserHandler{
 		userService: userService,
+		logger:      logger,
 	}
 }
 
@@ -23,13 +34,64 @@ type UpdateUserRequest struct {
 	Name string `json:"name" example:"John Doe" validate:"required"`
 }
 
+// SetUserRoleRequest is the content workflow role to give a user
+type SetUserRoleRequest struct {
+	Role string `json:"role" example:"editor" enums:"viewer,editor,publisher"`
+}
+
+// UserListResponse is a page of users in the list envelope
+type UserListResponse struct {
+	Data  []UserResponse `json:"data"`
+	Meta  ListMeta       `json:"meta"`
+	Links ListLinks      `json:"links"`
+}
+
+// CreateUserRequest is a user an admin creates, an admin too when IsAdmin
+type CreateUserRequest struct {
+	Email    string `json:"email" example:"user@example.com" validate:"required,email"`
+	Password string `json:"password" example:"password123" validate:"required"`
+	Name     string `json:"name" example:"John Doe" validate:"required"`
+	IsAdmin  bool   `json:"is_admin" example:"false"`
+}
+
+// UpdateUserStatusRequest promotes or demotes a user, and suspends or
+// activates them. Omitted fields are left as they are.
+type UpdateUserStatusRequest struct {
+	IsAdmin   *bool `json:"is_admin,omitempty" example:"true"`
+	Suspended *bool `json:"suspended,omitempty" example:"false"`
+}
+
 type UserResponse struct {
-	ID        int64  `json:"id" example:"1"`
-	Email     string `json:"email" example:"user@example.com"`
-	Name      string `json:"name" example:"John Doe"`
-	IsAdmin   bool   `json:"is_admin" example:"false"`
-	CreatedAt string `json:"created_at" example:"2024-01-01T00:00:00Z"`
-	UpdatedAt string `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	ID          int64  `json:"id" example:"1"`
+	Email       string `json:"email" example:"user@example.com"`
+	Name        string `json:"name" example:"John Doe"`
+	IsAdmin     bool   `json:"is_admin" example:"false"`
+	Role        string `json:"role" example:"viewer" enums:"viewer,editor,publisher"`
+	SuspendedAt string `json:"suspended_at,omitempty" example:"2024-01-02T00:00:00Z"` // when the user was suspended, if they are
+	DeletedAt   string `json:"deleted_at,omitempty" example:"2024-01-03T00:00:00Z"`   // when the account was deleted, until it is purged
+	CreatedAt   string `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt   string `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	// Avatar is the URL of the medium size of the user's avatar, and
+	// AvatarURLs those of the small, medium and large sizes
+	Avatar     string            `json:"avatar,omitempty" example:"https://cdn.example.com/avatars/users/1/9f86d081884c7d65/medium.jpg"`
+	AvatarURLs map[string]string `json:"avatar_urls,omitempty"`
+}
+
+// ProfileDetailsRequest replaces the personal details of the user. Empty
+// fields clear them.
+type ProfileDetailsRequest struct {
+	Bio         string `json:"bio" example:"Sci-fi fan" validate:"max=500"`
+	Avatar      string `json:"avatar" example:"https://example.com/me.jpg" validate:"omitempty,http_url"`
+	DateOfBirth string `json:"date_of_birth,omitempty" example:"1990-04-01"` // YYYY-MM-DD
+}
+
+// ProfileDetailsResponse is the personal details of the user
+type ProfileDetailsResponse struct {
+	Bio         string            `json:"bio" example:"Sci-fi fan"`
+	Avatar      string            `json:"avatar" example:"https://example.com/me.jpg"`
+	AvatarURLs  map[string]string `json:"avatar_urls,omitempty"` // of the uploaded avatar's sizes
+	DateOfBirth string            `json:"date_of_birth,omitempty" example:"1990-04-01"`
+	UpdatedAt   string            `json:"updated_at,omitempty" example:"2024-01-01T00:00:00Z"` // unset until first saved
 }
 
 // GetProfile godoc
@@ -39,34 +101,178 @@ type UserResponse struct {
 // @Accept json
 // @Produce json
 // @Success 200 {object} UserResponse
-// @Failure 401 {object} ErrorResponse "Unauthorized"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Security BearerAuth
 // @Router /users/profile [get]
 func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int64)
-	if !ok {
-		h.sendError(w, "Unauthorized", http.StatusUnauthorized)
+	userID := services.UserIDFromContext(r.Context())
+	if userID == 0 {
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
 		return
 	}
 
 	user, err := h.userService.GetUser(r.Context(), userID)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		h.sendUserError(w, r, err)
 		return
 	}
 
-	response := UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		IsAdmin:   user.IsAdmin,
-		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+// GetProfileDetails godoc
+// @Summary Get profile details
+// @Description Get the bio, avatar and date of birth of the authenticated user. They are empty until first set.
+// @Tags users
+// @Produce json
+// @Success 200 {object} ProfileDetailsResponse
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /users/profile/details [get]
+func (h *UserHandler) GetProfileDetails(w http.ResponseWriter, r *http.Request) {
+	profile, err := h.userService.GetProfileDetails(r.Context(), services.UserIDFromContext(r.Context()))
+	if err != nil {
+		h.sendUserError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newProfileDetailsResponse(profile))
+}
+
+// UpdateProfileDetails godoc
+// @Summary Update profile details
+// @Description Replace the bio, avatar URL and date of birth of the authenticated user; empty fields clear them. Setting an avatar URL other than the uploaded avatar's drops its avatar_urls.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body ProfileDetailsRequest true "Profile details"
+// @Success 200 {object} ProfileDetailsResponse
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /users/profile/details [put]
+func (h *UserHandler) UpdateProfileDetails(w http.ResponseWriter, r *http.Request) {
+	var req ProfileDetailsRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	details := services.ProfileDetails{Bio: req.Bio, Avatar: req.Avatar}
+	if req.DateOfBirth != "" {
+		dateOfBirth, err := time.Parse("2006-01-02", req.DateOfBirth)
+		if err != nil {
+			sendError(w, r, CodeInvalidDateOfBirth, http.StatusBadRequest)
+			return
+		}
+		details.DateOfBirth = &dateOfBirth
+	}
+
+	profile, err := h.userService.UpdateProfileDetails(r.Context(), services.UserIDFromContext(r.Context()), details)
+	if errors.Is(err, services.ErrInvalidDateOfBirth) {
+		sendError(w, r, CodeInvalidDateOfBirth, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.sendUserError(w, r, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newProfileDetailsResponse(profile))
+}
+
+func newProfileDetailsResponse(profile *models.UserProfile) ProfileDetailsResponse {
+	response := ProfileDetailsResponse{
+		Bio:        profile.Bio,
+		Avatar:     profile.Avatar,
+		AvatarURLs: profile.AvatarURLs,
+	}
+	if !profile.DateOfBirth.IsZero() {
+		response.DateOfBirth = profile.DateOfBirth.Format("2006-01-02")
+	}
+	if !profile.UpdatedAt.IsZero() {
+		response.UpdatedAt = profile.UpdatedAt.Format("2006-01-02T15:04:05Z")
+	}
+	return response
+}
+
+// avatarFormOverhead is the room left in upload bodies for the multipart
+// boundaries and headers around the avatar itself
+const avatarFormOverhead = 64 << 10
+
+// UploadAvatar godoc
+// @Summary Upload an avatar
+// @Description Upload a JPEG, PNG or GIF image as the authenticated user's avatar. It is cropped to a centered square and stored as a JPEG in small (64px), medium (256px) and large (512px) sizes, whose URLs the profile returns in avatar_urls; avatar is the medium one.
+// @Tags users
+// @Accept multipart/form-data
+// @Produce json
+// @Param avatar formData file true "Avatar image"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 422 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/profile/avatar [post]
+func (h *UserHandler) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	userID := services.UserIDFromContext(r.Context())
+	if userID == 0 {
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	maxSize := h.userService.MaxAvatarSize()
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+avatarFormOverhead)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, r, CodeAvatarTooLarge, http.StatusRequestEntityTooLarge, "max", maxSize)
+			return
+		}
+		sendError(w, r, CodeAvatarRequired, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so oversized avatars are rejected
+	// rather than truncated
+	image, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.SetAvatar(r.Context(), userID, image)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrStorageDisabled):
+			sendError(w, r, CodeStorageDisabled, http.StatusServiceUnavailable)
+		case errors.Is(err, services.ErrAvatarTooLarge):
+			sendError(w, r, CodeAvatarTooLarge, http.StatusRequestEntityTooLarge, "max", maxSize)
+		case errors.Is(err, services.ErrAvatarDimensions):
+			sendError(w, r, CodeAvatarDimensionsTooLarge, http.StatusUnprocessableEntity, "max", services.MaxAvatarDimension)
+		case errors.Is(err, services.ErrUnsupportedAvatar):
+			sendError(w, r, CodeUnsupportedAvatarType, http.StatusUnsupportedMediaType)
+		default:
+			h.sendUserError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
 // UpdateProfile godoc
@@ -77,46 +283,110 @@ func (h *UserHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param request body UpdateUserRequest true "Update request"
 // @Success 200 {object} UserResponse
-// @Failure 400 {object} ErrorResponse "Invalid request"
-// @Failure 401 {object} ErrorResponse "Unauthorized"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Security BearerAuth
 // @Router /users/profile [put]
 func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value("user_id").(int64)
-	if !ok {
-		h.sendError(w, "Unauthorized", http.StatusUnauthorized)
+	userID := services.UserIDFromContext(r.Context())
+	if userID == 0 {
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
 		return
 	}
 
 	var req UpdateUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, "Invalid request body", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
 		return
 	}
 
 	if req.Name == "" {
-		h.sendError(w, "Name is required", http.StatusBadRequest)
+		sendError(w, r, CodeNameRequired, http.StatusBadRequest)
 		return
 	}
 
 	user, err := h.userService.UpdateUser(r.Context(), userID, req.Name)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		h.sendUserError(w, r, err)
 		return
 	}
 
-	response := UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		IsAdmin:   user.IsAdmin,
-		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+// PatchProfile godoc
+// @Summary Patch user profile
+// @Description Apply a JSON Patch (RFC 6902, application/json-patch+json) or JSON Merge Patch (RFC 7386, application/merge-patch+json) to the authenticated user's profile
+// @Tags users
+// @Accept application/json-patch+json
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param request body UpdateUserRequest true "Patch of the profile fields, or an array of JSON Patch operations"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 415 {object} apierror.Problem "Unsupported patch media type"
+// @Failure 422 {object} apierror.Problem "Patch operation failed"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /users/profile [patch]
+func (h *UserHandler) PatchProfile(w http.ResponseWriter, r *http.Request) {
+	userID := services.UserIDFromContext(r.Context())
+	if userID == 0 {
+		sendError(w, r, CodeUnauthorized, http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil {
+		h.sendUserError(w, r, err)
+		return
+	}
+
+	current, err := json.Marshal(UpdateUserRequest{Name: user.Name})
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := patch.Apply(current, body, r.Header.Get("Content-Type"),
+		patch.JSONPatchContentType, patch.MergePatchContentType)
+	if err != nil {
+		sendPatchError(w, r, err)
+		return
+	}
+
+	var req UpdateUserRequest
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidPatchedProfile, http.StatusBadRequest, "detail", err)
+		return
+	}
+	if req.Name == "" {
+		sendError(w, r, CodeNameRequired, http.StatusBadRequest)
+		return
+	}
+
+	user, err = h.userService.UpdateUser(r.Context(), userID, req.Name)
+	if err != nil {
+		h.sendUserError(w, r, err)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
 // GetUser godoc
@@ -127,76 +397,366 @@ func (h *UserHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param id path int true "User ID"
 // @Success 200 {object} UserResponse
-// @Failure 400 {object} ErrorResponse "Invalid request"
-// @Failure 401 {object} ErrorResponse "Unauthorized"
-// @Failure 403 {object} ErrorResponse "Forbidden"
-// @Failure 404 {object} ErrorResponse "User not found"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Security BearerAuth
 // @Router /admin/users/{id} [get]
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		h.sendError(w, "Invalid user ID", http.StatusBadRequest)
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
 		return
 	}
 
 	user, err := h.userService.GetUser(r.Context(), id)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, database.ErrNotFound) {
+			sendError(w, r, CodeUserNotFound, http.StatusNotFound)
+			return
+		}
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
-	response := UserResponse{
-		ID:        user.ID,
-		Email:     user.Email,
-		Name:      user.Name,
-		IsAdmin:   user.IsAdmin,
-		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
 // ListUsers godoc
-// @Summary List all users
-// @Description Get a list of all users (admin only)
+// @Summary List users
+// @Description Get a page of the users, newest first, optionally only those whose email or name contains q, admins or non-admins, or those created in a period (admin only)
 // @Tags users
 // @Accept json
 // @Produce json
-// @Success 200 {array} UserResponse
-// @Failure 401 {object} ErrorResponse "Unauthorized"
-// @Failure 403 {object} ErrorResponse "Forbidden"
-// @Failure 500 {object} ErrorResponse "Internal server error"
+// @Param q query string false "Part of the email or name, in any case"
+// @Param is_admin query bool false "Only admins, or only non-admins"
+// @Param created_after query string false "Only users created at or after this time, RFC 3339 or YYYY-MM-DD"
+// @Param created_before query string false "Only users created before this time, RFC 3339 or YYYY-MM-DD"
+// @Param include_deleted query bool false "Include deleted accounts not yet purged, with their deleted_at"
+// @Param page query int false "Page number (default: 1)"
+// @Param page_size query int false "Page size (default: 20, max: 100)"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} apierror.Problem "Invalid filter"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden"
+// @Failure 500 {object} apierror.Problem "Internal server error"
 // @Security BearerAuth
 // @Router /admin/users [get]
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := h.userService.ListUsers(r.Context())
+	filter, param, err := parseUserFilter(r)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserFilter, http.StatusBadRequest, "param", param)
+		return
+	}
+
+	users, total, err := h.userService.ListUsers(r.Context(), filter)
 	if err != nil {
-		h.sendError(w, err.Error(), http.StatusInternalServerError)
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		return
 	}
 
 	response := make([]UserResponse, len(users))
 	for i, user := range users {
-		response[i] = UserResponse{
-			ID:        user.ID,
-			Email:     user.Email,
-			Name:      user.Name,
-			IsAdmin:   user.IsAdmin,
-			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
-			UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+		response[i] = newUserResponse(user)
+	}
+
+	renderPage(w, r, response, total, filter.Page,
+		effectivePageSize(filter.PageSize, services.DefaultUserPageSize, services.MaxUserPageSize))
+}
+
+// SetUserRole godoc
+// @Summary Set a user's content role
+// @Description Give a user the viewer, editor or publisher role in the publication workflow. Editors prepare draft movies and submit them for review; publishers approve, archive and revive them.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body SetUserRoleRequest true "Role"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/users/{id}/role [put]
+func (h *UserHandler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
+		return
+	}
+
+	var req SetUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.SetRole(r.Context(), id, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			sendError(w, r, CodeInvalidRole, http.StatusBadRequest)
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeUserNotFound, http.StatusNotFound)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create a user, or an admin with is_admin, without signing them in. The password must meet the password policy.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body CreateUserRequest true "User"
+// @Success 201 {object} UserResponse
+// @Failure 400 {object} PasswordPolicyProblem "Invalid request parameters, or a password the password policy rejects"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden"
+// @Failure 409 {object} apierror.Problem "Email already exists"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users [post]
+func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if !DecodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, err := h.userService.CreateUser(r.Context(), req.Email, req.Password, req.Name, req.IsAdmin)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailTaken):
+			sendError(w, r, CodeEmailTaken, http.StatusConflict)
+		case sendPasswordError(w, r, h.userService.PasswordPolicy(), err):
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 		}
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newUserResponse(user))
 }
 
-func (h *UserHandler) sendError(w http.ResponseWriter, message string, status int) {
+// UpdateUserStatus godoc
+// @Summary Promote, demote, suspend or activate a user
+// @Description Make a user an admin or take it back with is_admin, and suspend or activate them with suspended. Suspended users cannot sign in, and their tokens are refused until they are activated. Admins cannot demote or suspend themselves.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body UpdateUserStatusRequest true "Status"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden, or the admin's own account"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id} [patch]
+func (h *UserHandler) UpdateUserStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateUserStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+	if req.IsAdmin == nil && req.Suspended == nil {
+		sendError(w, r, CodeUserStatusRequired, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.UpdateStatus(r.Context(), id, services.UserStatusUpdate{
+		IsAdmin:   req.IsAdmin,
+		Suspended: req.Suspended,
+	})
+	if err != nil {
+		h.sendAdminUserError(w, r, err)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(ErrorResponse{Error: message})
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Delete a user, ending their sessions. The account can be restored during the deletion grace period, after which it is purged together with their favorites, watch history, profiles, reviews and subscriptions. Admins cannot delete themselves.
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden, or the admin's own account"
+// @Failure 404 {object} apierror.Problem "User not found"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id} [delete]
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.userService.DeleteUser(r.Context(), id); err != nil {
+		h.sendAdminUserError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreUser godoc
+// @Summary Restore a deleted user
+// @Description Undo the deletion of an account before it is purged, so its user can sign in again. Reviews detached when users delete their accounts themselves stay without an author.
+// @Tags users
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} UserResponse
+// @Failure 400 {object} apierror.Problem "Invalid request"
+// @Failure 401 {object} apierror.Problem "Unauthorized"
+// @Failure 403 {object} apierror.Problem "Forbidden"
+// @Failure 404 {object} apierror.Problem "User not found, or already purged"
+// @Failure 409 {object} apierror.Problem "User not deleted"
+// @Failure 500 {object} apierror.Problem "Internal server error"
+// @Security BearerAuth
+// @Router /admin/users/{id}/restore [post]
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidUserID, http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.userService.RestoreUser(r.Context(), id)
+	if err != nil {
+		h.sendAdminUserError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newUserResponse(user))
+}
+
+// sendAdminUserError maps a failure to change a user on an admin's behalf to
+// a problem response
+func (h *UserHandler) sendAdminUserError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, services.ErrSelfModification):
+		sendError(w, r, CodeSelfModification, http.StatusForbidden)
+	case errors.Is(err, services.ErrNotDeleted):
+		sendError(w, r, CodeNotDeleted, http.StatusConflict)
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeUserNotFound, http.StatusNotFound)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
+
+// parseUserFilter reads the filter and page query parameters of ListUsers.
+// On failure it returns the name of the invalid parameter.
+func parseUserFilter(r *http.Request) (services.UserFilter, string, error) {
+	query := r.URL.Query()
+	filter := services.UserFilter{
+		Query: strings.TrimSpace(query.Get("q")),
+		Page:  1,
+	}
+
+	if s := query.Get("is_admin"); s != "" {
+		isAdmin, err := strconv.ParseBool(s)
+		if err != nil {
+			return filter, "is_admin", err
+		}
+		filter.IsAdmin = &isAdmin
+	}
+	if s := query.Get("include_deleted"); s != "" {
+		includeDeleted, err := strconv.ParseBool(s)
+		if err != nil {
+			return filter, "include_deleted", err
+		}
+		filter.IncludeDeleted = includeDeleted
+	}
+	for _, p := range []struct {
+		name string
+		time **time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+	} {
+		s := query.Get(p.name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", s); err != nil {
+				return filter, p.name, err
+			}
+		}
+		*p.time = &t
+	}
+
+	if page, err := strconv.Atoi(query.Get("page")); err == nil && page > 0 {
+		filter.Page = page
+	}
+	if pageSize, err := strconv.Atoi(query.Get("page_size")); err == nil && pageSize > 0 {
+		filter.PageSize = pageSize
+	}
+	return filter, "", nil
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	response := UserResponse{
+		ID:        user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		IsAdmin:   user.IsAdmin,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		UpdatedAt: user.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+	if user.SuspendedAt != nil {
+		response.SuspendedAt = user.SuspendedAt.Format("2006-01-02T15:04:05Z")
+	}
+	if !user.DeletedAt.IsZero() {
+		response.DeletedAt = user.DeletedAt.Format("2006-01-02T15:04:05Z")
+	}
+	if user.Profile != nil {
+		response.Avatar = user.Profile.Avatar
+		response.AvatarURLs = user.Profile.AvatarURLs
+	}
+	return response
+}
+
+// sendUserError maps a failure to load or update the authenticated user,
+// e.g. one deleted since their token was issued, to a problem response
+func (h *UserHandler) sendUserError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		sendError(w, r, CodeUserNotFound, http.StatusNotFound)
+		return
+	}
+	logError(h.logger, r, err)
+	sendError(w, r, CodeInternalError, http.StatusInternalServerError)
 }
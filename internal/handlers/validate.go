@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/i18n"
+	"github.com/ndn/internal/playback"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// validate checks the validate struct tags of request bodies. Fields are
+// reported by their JSON names.
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// Only fails for an empty tag or a nil function
+	_ = v.RegisterValidation("video_url", validVideoURL)
+	return v
+}
+
+// validVideoURL accepts http(s) URLs and the file: URLs of local videos
+func validVideoURL(fl validator.FieldLevel) bool {
+	value := fl.Field().String()
+	if playback.IsLocal(value) {
+		_, err := playback.LocalPath(value)
+		return err == nil
+	}
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// DecodeAndValidate decodes the JSON body of r into v, a pointer to a
+// request struct, and checks its validate tags. On failure it writes a 400
+// response, listing each invalid field, and returns false.
+func DecodeAndValidate(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return false
+	}
+	return validateRequest(w, r, v)
+}
+
+// validateRequest checks the validate tags of v, writing a 400 response
+// listing each invalid field and returning false when any fails
+func validateRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := validate.Struct(v)
+	if err == nil {
+		return true
+	}
+
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return false
+	}
+
+	problem := apierror.New(r, http.StatusBadRequest, CodeValidationFailed)
+	for _, fe := range invalid {
+		problem.Fields = append(problem.Fields, apierror.FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(r, fe),
+		})
+	}
+	problem.Write(w)
+	return false
+}
+
+// fieldMessage describes a failed rule in the request's locale. Length rules
+// on strings and collections read differently from bounds on numbers.
+func fieldMessage(r *http.Request, fe validator.FieldError) string {
+	key := "validation_" + fe.Tag()
+	switch fe.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if fe.Tag() == "min" || fe.Tag() == "max" {
+			key += "_length"
+		}
+	}
+
+	args := []interface{}{"field", fe.Field(), "param", fe.Param()}
+	if message := i18n.Message(r.Context(), key, args...); message != key {
+		return message
+	}
+	return i18n.Message(r.Context(), "validation_invalid", args...)
+}
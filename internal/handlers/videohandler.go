@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+type VideoHandler struct {
+	videoService *services.VideoService
+	logger       *zap.Logger
+}
+
+func NewVideoHandler(videoService *services.VideoService, logger *zap.Logger) *VideoHandler {
+	return &VideoHandler{
+		videoService: videoService,
+		logger:       logger,
+	}
+}
+
+// GetVideo godoc
+// @Summary Get the video processing status of a movie
+// @Description Poll the processing status of a movie's uploaded video (uploading, processing, ready or failed) and its latest transcoding job. video_url is the video played, which stays the previous one until a new upload is ready.
+// @Tags videos
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 200 {object} services.VideoProcessing
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/video [get]
+func (h *VideoHandler) GetVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	video, err := h.videoService.Status(r.Context(), id)
+	if err != nil {
+		h.sendVideoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(video)
+}
+
+// UploadVideo godoc
+// @Summary Upload the video of a movie
+// @Description Upload a video file as the request body, with its video/* content type, and queue it for transcoding into HLS renditions. Large files are better uploaded to a presigned URL from POST /admin/movies/{id}/video/uploads. The movie keeps its current video until the new one is ready.
+// @Tags videos
+// @Accept video/mp4
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 202 {object} services.VideoProcessing
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 415 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/video [put]
+func (h *VideoHandler) UploadVideo(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	// Uploads outlast the server's read and write timeouts and the request
+	// timeout, so they get their own
+	timeout := h.videoService.UploadTimeout()
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(timeout)
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		h.logger.Warn("failed to extend upload read deadline", zap.Error(err))
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		h.logger.Warn("failed to extend upload write deadline", zap.Error(err))
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), timeout)
+	defer cancel()
+
+	body := r.Body
+	if max := h.videoService.MaxUploadSize(); max > 0 {
+		body = http.MaxBytesReader(w, r.Body, max)
+	}
+
+	video, err := h.videoService.Upload(ctx, id, r.Header.Get("Content-Type"), body, r.ContentLength)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendError(w, r, CodeVideoTooLarge, http.StatusRequestEntityTooLarge, "max", h.videoService.MaxUploadSize())
+			return
+		}
+		h.sendVideoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(video)
+}
+
+// CreateVideoUpload godoc
+// @Summary Start a video upload
+// @Description Start the upload of a new video for a movie and get a presigned URL to PUT the file to, straight to storage. Once uploaded, POST /admin/movies/{id}/video/uploads/complete queues it for transcoding.
+// @Tags videos
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 201 {object} services.VideoUpload
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/video/uploads [post]
+func (h *VideoHandler) CreateVideoUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.videoService.CreateUpload(r.Context(), id)
+	if err != nil {
+		h.sendVideoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(upload)
+}
+
+// CompleteVideoUpload godoc
+// @Summary Complete a video upload
+// @Description Queue the video uploaded to the presigned URL of the movie's current upload for transcoding into HLS renditions.
+// @Tags videos
+// @Produce json
+// @Param id path int true "Movie ID"
+// @Success 202 {object} services.VideoProcessing
+// @Failure 400 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 409 {object} apierror.Problem
+// @Failure 413 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Failure 503 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /admin/movies/{id}/video/uploads/complete [post]
+func (h *VideoHandler) CompleteVideoUpload(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		sendError(w, r, CodeInvalidMovieID, http.StatusBadRequest)
+		return
+	}
+
+	video, err := h.videoService.CompleteUpload(r.Context(), id)
+	if err != nil {
+		h.sendVideoError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(video)
+}
+
+func (h *VideoHandler) sendVideoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+	case errors.Is(err, services.ErrStorageDisabled):
+		sendError(w, r, CodeStorageDisabled, http.StatusServiceUnavailable)
+	case errors.Is(err, services.ErrUnsupportedVideo):
+		sendError(w, r, CodeUnsupportedVideoType, http.StatusUnsupportedMediaType)
+	case errors.Is(err, services.ErrVideoTooLarge):
+		sendError(w, r, CodeVideoTooLarge, http.StatusRequestEntityTooLarge, "max", h.videoService.MaxUploadSize())
+	case errors.Is(err, services.ErrVideoProcessing):
+		sendError(w, r, CodeVideoProcessing, http.StatusConflict)
+	case errors.Is(err, services.ErrVideoNotUploading):
+		sendError(w, r, CodeVideoNotUploading, http.StatusConflict)
+	case errors.Is(err, services.ErrVideoNotUploaded):
+		sendError(w, r, CodeVideoNotUploaded, http.StatusBadRequest)
+	default:
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type WatchHistoryHandler struct {
+	watchHistoryService *services.WatchHistoryService
+	logger              *zap.Logger
+}
+
+func NewWatchHistoryHandler(watchHistoryService *services.WatchHistoryService, logger *zap.Logger) *WatchHistoryHandler {
+	return &WatchHistoryHandler{
+		watchHistoryService: watchHistoryService,
+		logger:              logger,
+	}
+}
+
+// PlaybackProgressRequest is where playback of a movie stopped
+type PlaybackProgressRequest struct {
+	MovieID         int64  `json:"movie_id" example:"42"`
+	PositionSeconds int    `json:"position_seconds" example:"1830"`
+	Device          string `json:"device,omitempty" example:"living-room-tv"`
+}
+
+// ContinueWatchingResponse is an unfinished movie with where playback
+// should resume
+type ContinueWatchingResponse struct {
+	Movie           MovieResponse `json:"movie"`
+	PositionSeconds int           `json:"position_seconds" example:"1830"`
+	Device          string        `json:"device,omitempty" example:"living-room-tv"`
+	LastWatchedAt   time.Time     `json:"last_watched_at"`
+}
+
+// RecordProgress godoc
+// @Summary Record playback progress
+// @Description Save where the authenticated user stopped in a movie, replacing their previous position in it. Progress is kept per profile when the token selects one. Clients report progress periodically during playback and when it stops.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body PlaybackProgressRequest true "Playback progress"
+// @Success 200 {object} models.WatchHistory
+// @Failure 400 {object} apierror.Problem
+// @Failure 401 {object} apierror.Problem
+// @Failure 404 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/watch-history [post]
+func (h *WatchHistoryHandler) RecordProgress(w http.ResponseWriter, r *http.Request) {
+	var req PlaybackProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, r, CodeInvalidRequestBody, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	entry, err := h.watchHistoryService.RecordProgress(ctx,
+		services.UserIDFromContext(ctx), services.ProfileIDFromContext(ctx), req.MovieID, req.PositionSeconds, req.Device)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidProgress):
+			sendError(w, r, CodeInvalidProgress, http.StatusBadRequest)
+		case errors.Is(err, database.ErrNotFound):
+			sendError(w, r, CodeMovieNotFound, http.StatusNotFound)
+		default:
+			logError(h.logger, r, err)
+			sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
+}
+
+// GetContinueWatching godoc
+// @Summary Get the continue watching list
+// @Description Get the movies the authenticated user started but has not finished, most recently watched first, each with the position to resume playback from. Lists the selected profile's movies when the token selects one.
+// @Tags users
+// @Produce json
+// @Param limit query int false "Number of movies to return, at most 50 (default: 20)"
+// @Success 200 {array} ContinueWatchingResponse
+// @Failure 401 {object} apierror.Problem
+// @Failure 500 {object} apierror.Problem
+// @Security BearerAuth
+// @Router /users/continue-watching [get]
+func (h *WatchHistoryHandler) GetContinueWatching(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= services.MaxContinueWatching {
+			limit = l
+		}
+	}
+
+	ctx := r.Context()
+	items, err := h.watchHistoryService.ContinueWatching(ctx, services.UserIDFromContext(ctx), services.ProfileIDFromContext(ctx), limit)
+	if err != nil {
+		logError(h.logger, r, err)
+		sendError(w, r, CodeInternalError, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]ContinueWatchingResponse, len(items))
+	for i, item := range items {
+		response[i] = ContinueWatchingResponse{
+			Movie: MovieResponse{
+				ID:             item.Movie.ID,
+				Title:          item.Movie.Title,
+				Description:    item.Movie.Description,
+				ReleaseYear:    item.Movie.ReleaseYear,
+				Duration:       item.Movie.Duration,
+				PosterURL:      item.Movie.PosterURL,
+				Categories:     movieCategories(item.Movie.CategoryRefs),
+				MaturityRating: item.Movie.MaturityRating,
+				Rating:         item.Movie.Rating,
+			},
+			PositionSeconds: item.PositionSeconds,
+			Device:          item.Device,
+			LastWatchedAt:   item.LastWatchedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,224 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+	"go.uber.org/zap"
+)
+
+type Status string
+
+const (
+	// StatusUp means every dependency is healthy
+	StatusUp Status = "up"
+	// StatusDegraded means a non-critical dependency is down; the server keeps
+	// serving every request, the features needing it failing on their own
+	StatusDegraded Status = "degraded"
+	// StatusDown means a critical dependency is down; the server only serves
+	// reads
+	StatusDown Status = "down"
+)
+
+// CheckFunc reports whether a dependency is reachable
+type CheckFunc func(ctx context.Context) error
+
+// Dependency is an external system the server relies on
+type Dependency struct {
+	Name     string
+	Critical bool
+	Check    CheckFunc
+}
+
+type DependencyStatus struct {
+	Name      string    `json:"name" example:"database"`
+	Status    Status    `json:"status" example:"up"`
+	Critical  bool      `json:"critical" example:"true"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMs int64     `json:"latency_ms" example:"3"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type Report struct {
+	Status       Status             `json:"status" example:"up"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+	CheckedAt    time.Time          `json:"checked_at"`
+}
+
+// Checker periodically probes registered dependencies and keeps the latest
+// report so readiness requests never block on slow dependencies
+type Checker struct {
+	mu       sync.RWMutex
+	deps     []Dependency
+	report   Report
+	interval time.Duration
+	timeout  time.Duration
+	logger   *zap.Logger
+}
+
+func NewChecker(cfg config.HealthConfig, logger *zap.Logger) *Checker {
+	interval := cfg.CheckInterval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	timeout := cfg.CheckTimeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	return &Checker{
+		interval: interval,
+		timeout:  timeout,
+		logger:   logger,
+		report:   Report{Status: StatusUp},
+	}
+}
+
+// Register adds a dependency to be probed on every check
+func (c *Checker) Register(dep Dependency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deps = append(c.deps, dep)
+}
+
+// Run checks all dependencies immediately and then on every interval until
+// ctx is cancelled
+func (c *Checker) Run(ctx context.Context) {
+	c.Check(ctx)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// Check probes every dependency concurrently, stores and returns the report
+func (c *Checker) Check(ctx context.Context) Report {
+	c.mu.RLock()
+	deps := make([]Dependency, len(c.deps))
+	copy(deps, c.deps)
+	previous := c.report.Status
+	c.mu.RUnlock()
+
+	statuses := make([]DependencyStatus, len(deps))
+	var wg sync.WaitGroup
+	for i, dep := range deps {
+		wg.Add(1)
+		go func(i int, dep Dependency) {
+			defer wg.Done()
+			statuses[i] = c.checkOne(ctx, dep)
+		}(i, dep)
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:       StatusUp,
+		Dependencies: statuses,
+		CheckedAt:    time.Now(),
+	}
+	for _, s := range statuses {
+		if s.Status == StatusUp {
+			continue
+		}
+		if s.Critical {
+			report.Status = StatusDown
+		} else if report.Status == StatusUp {
+			report.Status = StatusDegraded
+		}
+	}
+
+	c.mu.Lock()
+	c.report = report
+	c.mu.Unlock()
+
+	if report.Status != previous {
+		c.logger.Warn("service health changed",
+			zap.String("from", string(previous)),
+			zap.String("to", string(report.Status)),
+		)
+	}
+
+	return report
+}
+
+func (c *Checker) checkOne(ctx context.Context, dep Dependency) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := dep.Check(ctx)
+
+	status := DependencyStatus{
+		Name:      dep.Name,
+		Status:    StatusUp,
+		Critical:  dep.Critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		status.Status = StatusDown
+		status.Error = err.Error()
+		c.logger.Warn("dependency check failed",
+			zap.String("dependency", dep.Name),
+			zap.Bool("critical", dep.Critical),
+			zap.Error(err),
+		)
+	}
+
+	return status
+}
+
+// Report returns the most recent health report
+func (c *Checker) Report() Report {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.report
+}
+
+// Status returns the most recent overall status
+func (c *Checker) Status() Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.report.Status
+}
+
+// ReadOnlyWhenDown rejects unsafe methods with 503 while a critical
+// dependency such as the database is down, so reads (possibly cached) keep
+// working but writes that would fail halfway are refused. A non-critical
+// dependency being down, such as email, payments or storage, only marks
+// responses with X-Service-Status: plays, heartbeats and analytics do not
+// need them. Routes that must stay writable whatever the health, such as
+// signing in, are mounted without it.
+func (c *Checker) ReadOnlyWhenDown(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+		if status != StatusUp {
+			w.Header().Set("X-Service-Status", string(status))
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if status == StatusDown {
+			w.Header().Set("Retry-After", "30")
+			apierror.Write(w, r, http.StatusServiceUnavailable, "read_only")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,202 @@
+// Package i18n translates user-facing messages into the locale resolved for
+// each request. Messages are keyed by stable codes that clients can act on;
+// the catalog of each supported locale is embedded from locales/<locale>.json.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when a request asks for no supported locale, and its
+// catalog is the fallback for messages missing from the others
+const DefaultLocale = "en"
+
+// LocaleParam is the query parameter that overrides Accept-Language
+const LocaleParam = "lang"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// catalogs maps each supported locale to its messages by code
+var catalogs = mustLoadCatalogs()
+
+type (
+	contextKey     struct{}
+	preferencesKey struct{}
+)
+
+func mustLoadCatalogs() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	catalogs := make(map[string]map[string]string, len(entries))
+	for _, e := range entries {
+		data, err := files.ReadFile("locales/" + e.Name())
+		if err != nil {
+			panic(err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", e.Name(), err))
+		}
+		catalogs[strings.TrimSuffix(e.Name(), path.Ext(e.Name()))] = messages
+	}
+	if catalogs[DefaultLocale] == nil {
+		panic("i18n: missing catalog for the default locale")
+	}
+	return catalogs
+}
+
+// Locales returns the supported locales in alphabetical order
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Middleware resolves the locale of each request and stores it in the
+// request context for Message
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := Resolve(r)
+		w.Header().Add("Vary", "Accept-Language")
+		ctx := WithPreferences(WithLocale(r.Context(), locale), Preferences(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Resolve returns the supported locale a request asks for: the lang query
+// parameter if supported, else the most preferred supported language of
+// Accept-Language, else DefaultLocale. Regional variants such as es-MX fall
+// back to their language.
+func Resolve(r *http.Request) string {
+	if locale, ok := match(r.URL.Query().Get(LocaleParam)); ok {
+		return locale
+	}
+
+	best, bestQ := DefaultLocale, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, q := parseWeighted(part)
+		if locale, ok := match(tag); ok && q > bestQ {
+			best, bestQ = locale, q
+		}
+	}
+	return best
+}
+
+// Preferences returns the language tags a request asks for, most preferred
+// first: the lang query parameter, then Accept-Language by quality. Unlike
+// Resolve it is not limited to the supported locales, for content such as
+// movie metadata that is translated into other languages.
+func Preferences(r *http.Request) []string {
+	var tags []string
+	if tag := strings.TrimSpace(r.URL.Query().Get(LocaleParam)); tag != "" {
+		tags = append(tags, tag)
+	}
+
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var accepted []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, q := parseWeighted(part)
+		if tag = strings.TrimSpace(tag); tag != "" && tag != "*" && q > 0 {
+			accepted = append(accepted, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].q > accepted[j].q })
+	for _, a := range accepted {
+		tags = append(tags, a.tag)
+	}
+	return tags
+}
+
+// WithPreferences returns a copy of ctx carrying the language tags of
+// Preferences
+func WithPreferences(ctx context.Context, tags []string) context.Context {
+	return context.WithValue(ctx, preferencesKey{}, tags)
+}
+
+// PreferencesFromContext returns the language tags the request of ctx asks
+// for, most preferred first, or none
+func PreferencesFromContext(ctx context.Context) []string {
+	tags, _ := ctx.Value(preferencesKey{}).([]string)
+	return tags
+}
+
+// WithLocale returns a copy of ctx carrying locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+// FromContext returns the locale resolved for the request of ctx, or
+// DefaultLocale
+func FromContext(ctx context.Context) string {
+	if locale, ok := ctx.Value(contextKey{}).(string); ok {
+		return locale
+	}
+	return DefaultLocale
+}
+
+// Message returns the message for code in the locale of ctx, falling back to
+// DefaultLocale and then to the code itself. args are name/value pairs
+// substituted for {name} placeholders, e.g. Message(ctx, "too_many", "max", 100).
+func Message(ctx context.Context, code string, args ...interface{}) string {
+	message, ok := catalogs[FromContext(ctx)][code]
+	if !ok {
+		if message, ok = catalogs[DefaultLocale][code]; !ok {
+			return code
+		}
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		message = strings.ReplaceAll(message, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return message
+}
+
+// match returns the supported locale for a language tag
+func match(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", false
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag, true
+	}
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		if _, ok := catalogs[tag[:i]]; ok {
+			return tag[:i], true
+		}
+	}
+	return "", false
+}
+
+// parseWeighted splits an Accept-Language entry such as "es-MX;q=0.8" into
+// its tag and quality, which defaults to 1
+func parseWeighted(part string) (string, float64) {
+	tag, params, _ := strings.Cut(part, ";")
+	q := 1.0
+	if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return tag, 0
+		}
+		q = parsed
+	}
+	return tag, q
+}
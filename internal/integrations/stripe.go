@@ -0,0 +1,352 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+const (
+	defaultStripeURL     = "https://api.stripe.com"
+	defaultStripeTimeout = 10 * time.Second
+	// stripeVersion pins the shape of the API objects read below, whatever
+	// the default version of the account
+	stripeVersion = "2024-06-20"
+)
+
+var (
+	ErrStripeNotFound = errors.New("not found on Stripe")
+	// ErrStripeUnavailable wraps failures to reach Stripe or unexpected
+	// responses from it
+	ErrStripeUnavailable = errors.New("Stripe is unavailable")
+	// ErrInvalidStripeEvent wraps webhook events that cannot be decoded
+	ErrInvalidStripeEvent = errors.New("invalid Stripe event")
+)
+
+// CheckoutParams describe a Checkout session subscribing a user to a price.
+// Customer is their Stripe customer, or empty for Checkout to create one
+// with CustomerEmail. Coupon is the ID of a Stripe coupon discounting the
+// subscription, if any.
+type CheckoutParams struct {
+	PriceID       string
+	UserID        int64
+	Customer      string
+	CustomerEmail string
+	SuccessURL    string
+	CancelURL     string
+	Coupon        string
+}
+
+// CouponParams describe a Stripe coupon taking PercentOff percent or
+// AmountOff, in the smallest unit of Currency, off invoices. Duration is
+// "once", "forever" or "repeating" for DurationInMonths.
+type CouponParams struct {
+	Name             string
+	PercentOff       int
+	AmountOff        int64
+	Currency         string
+	Duration         string
+	DurationInMonths int
+}
+
+// CheckoutSession is a Checkout session to redirect the customer to
+type CheckoutSession struct {
+	ID  string `json:"id" example:"cs_test_a1b2c3"`
+	URL string `json:"url" example:"https://checkout.stripe.com/c/pay/cs_test_a1b2c3"`
+}
+
+// StripeSubscription is the state of a subscription on Stripe. UserID is
+// the user it was created for through Checkout, zero for subscriptions
+// created elsewhere.
+type StripeSubscription struct {
+	ID                string
+	Customer          string
+	Status            string
+	PriceID           string
+	UserID            int64
+	CurrentPeriodEnd  time.Time
+	CancelAtPeriodEnd bool
+}
+
+// StripeEvent is a webhook event. Object is the raw object it is about.
+type StripeEvent struct {
+	ID      string
+	Type    string
+	Created time.Time
+	Object  json.RawMessage
+}
+
+// StripeClient creates Checkout and customer portal sessions and reads
+// subscriptions through the Stripe API, and decodes its webhook events.
+// Their signature is checked by webhook.Verifier before they get here.
+type StripeClient struct {
+	url       string
+	secretKey string
+	client    *http.Client
+}
+
+// NewStripeClient returns a client for the configured account, or nil when
+// no secret key is configured and billing is disabled
+func NewStripeClient(cfg config.BillingConfig) *StripeClient {
+	if cfg.SecretKey == "" {
+		return nil
+	}
+	baseURL := strings.TrimSuffix(cfg.URL, "/")
+	if baseURL == "" {
+		baseURL = defaultStripeURL
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultStripeTimeout
+	}
+
+	return &StripeClient{
+		url:       baseURL,
+		secretKey: cfg.SecretKey,
+		client:    tracecontext.NewClient(&http.Client{Timeout: timeout}),
+	}
+}
+
+// CreateCheckoutSession starts a Checkout session subscribing the user to
+// a price. The subscription carries the user's ID in its user_id metadata.
+func (c *StripeClient) CreateCheckoutSession(ctx context.Context, params CheckoutParams) (*CheckoutSession, error) {
+	userID := strconv.FormatInt(params.UserID, 10)
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", params.PriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	form.Set("client_reference_id", userID)
+	form.Set("metadata[user_id]", userID)
+	form.Set("subscription_data[metadata][user_id]", userID)
+	if params.Customer != "" {
+		form.Set("customer", params.Customer)
+	} else if params.CustomerEmail != "" {
+		form.Set("customer_email", params.CustomerEmail)
+	}
+	if params.Coupon != "" {
+		form.Set("discounts[0][coupon]", params.Coupon)
+	}
+
+	var session CheckoutSession
+	if err := c.do(ctx, http.MethodPost, "/v1/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// CreateCoupon creates a coupon and returns its ID
+func (c *StripeClient) CreateCoupon(ctx context.Context, params CouponParams) (string, error) {
+	form := url.Values{}
+	form.Set("name", params.Name)
+	form.Set("duration", params.Duration)
+	if params.DurationInMonths > 0 {
+		form.Set("duration_in_months", strconv.Itoa(params.DurationInMonths))
+	}
+	if params.PercentOff > 0 {
+		form.Set("percent_off", strconv.Itoa(params.PercentOff))
+	} else {
+		form.Set("amount_off", strconv.FormatInt(params.AmountOff, 10))
+		form.Set("currency", params.Currency)
+	}
+
+	var coupon struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/coupons", form, &coupon); err != nil {
+		return "", err
+	}
+	return coupon.ID, nil
+}
+
+// DeleteCoupon deletes the coupon with id, so no new subscriptions get it.
+// Subscriptions it already discounts keep their discount.
+func (c *StripeClient) DeleteCoupon(ctx context.Context, id string) error {
+	var deleted struct {
+		Deleted bool `json:"deleted"`
+	}
+	return c.do(ctx, http.MethodDelete, "/v1/coupons/"+url.PathEscape(id), nil, &deleted)
+}
+
+// CreatePortalSession returns the URL of a customer portal session for
+// customer, sending them back to returnURL, or the portal's default when
+// it is empty
+func (c *StripeClient) CreatePortalSession(ctx context.Context, customer, returnURL string) (string, error) {
+	form := url.Values{}
+	form.Set("customer", customer)
+	if returnURL != "" {
+		form.Set("return_url", returnURL)
+	}
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/v1/billing_portal/sessions", form, &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// Subscription fetches the current state of the subscription with id
+func (c *StripeClient) Subscription(ctx context.Context, id string) (*StripeSubscription, error) {
+	var result struct {
+		ID                string            `json:"id"`
+		Customer          string            `json:"customer"`
+		Status            string            `json:"status"`
+		CurrentPeriodEnd  int64             `json:"current_period_end"`
+		CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+		Metadata          map[string]string `json:"metadata"`
+		Items             struct {
+			Data []struct {
+				Price struct {
+					ID string `json:"id"`
+				} `json:"price"`
+			} `json:"data"`
+		} `json:"items"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/v1/subscriptions/"+url.PathEscape(id), nil, &result); err != nil {
+		return nil, err
+	}
+
+	sub := &StripeSubscription{
+		ID:                result.ID,
+		Customer:          result.Customer,
+		Status:            result.Status,
+		CurrentPeriodEnd:  time.Unix(result.CurrentPeriodEnd, 0).UTC(),
+		CancelAtPeriodEnd: result.CancelAtPeriodEnd,
+	}
+	// Checkout subscriptions have a single item
+	if len(result.Items.Data) > 0 {
+		sub.PriceID = result.Items.Data[0].Price.ID
+	}
+	sub.UserID, _ = strconv.ParseInt(result.Metadata["user_id"], 10, 64)
+	return sub, nil
+}
+
+// Ping checks that the Stripe API can be reached with the secret key, for
+// health checks
+func (c *StripeClient) Ping(ctx context.Context) error {
+	var balance struct {
+		Object string `json:"object"`
+	}
+	return c.do(ctx, http.MethodGet, "/v1/balance", nil, &balance)
+}
+
+// ParseEvent decodes the event of a verified webhook payload
+func (c *StripeClient) ParseEvent(payload []byte) (*StripeEvent, error) {
+	var result struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object json.RawMessage `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil || result.ID == "" {
+		return nil, fmt.Errorf("%w: malformed event", ErrInvalidStripeEvent)
+	}
+	return &StripeEvent{
+		ID:      result.ID,
+		Type:    result.Type,
+		Created: time.Unix(result.Created, 0).UTC(),
+		Object:  result.Data.Object,
+	}, nil
+}
+
+// ObjectID returns the ID of the event's object, such as the Checkout
+// session of checkout.session.completed events
+func (e *StripeEvent) ObjectID() string {
+	var object struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(e.Object, &object); err != nil {
+		return ""
+	}
+	return object.ID
+}
+
+// SubscriptionID returns the ID of the subscription the event's object is
+// or belongs to: a subscription, or a Checkout session or invoice of one.
+// It is empty for objects of no subscription.
+func (e *StripeEvent) SubscriptionID() string {
+	var object struct {
+		Object       string          `json:"object"`
+		ID           string          `json:"id"`
+		Subscription json.RawMessage `json:"subscription"`
+		// Invoices of newer API versions name it under their parent
+		Parent struct {
+			SubscriptionDetails struct {
+				Subscription string `json:"subscription"`
+			} `json:"subscription_details"`
+		} `json:"parent"`
+	}
+	if err := json.Unmarshal(e.Object, &object); err != nil {
+		return ""
+	}
+	if object.Object == "subscription" {
+		return object.ID
+	}
+
+	// Either an ID or, when expanded, the subscription itself
+	var id string
+	if err := json.Unmarshal(object.Subscription, &id); err == nil && id != "" {
+		return id
+	}
+	var expanded struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(object.Subscription, &expanded); err == nil && expanded.ID != "" {
+		return expanded.ID
+	}
+	return object.Parent.SubscriptionDetails.Subscription
+}
+
+// do sends a form-encoded request to the Stripe API and decodes the
+// response into out
+func (c *StripeClient) do(ctx context.Context, method, path string, form url.Values, out any) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to build Stripe request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	req.Header.Set("Stripe-Version", stripeVersion)
+	req.Header.Set("Accept", "application/json")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrStripeUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrStripeNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: request failed with %d: %s", ErrStripeUnavailable, resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%w: failed to decode response: %w", ErrStripeUnavailable, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package integrations talks to third-party services the catalog is
+// enriched from, such as The Movie Database.
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+const (
+	defaultTMDBURL      = "https://api.themoviedb.org/3"
+	defaultTMDBImageURL = "https://image.tmdb.org/t/p/w500"
+	defaultTMDBTimeout  = 10 * time.Second
+)
+
+var (
+	ErrTMDBNotFound = errors.New("movie not found on TMDB")
+	// ErrTMDBUnavailable wraps failures to reach TMDB or unexpected
+	// responses from it
+	ErrTMDBUnavailable = errors.New("TMDB is unavailable")
+)
+
+// TMDBMovie is the metadata of a movie on TMDB
+type TMDBMovie struct {
+	ID          int64
+	Title       string
+	Overview    string
+	ReleaseYear int
+	// Runtime is in minutes, zero when unknown
+	Runtime   int
+	PosterURL string
+	Genres    []string
+}
+
+// TMDBClient fetches movie metadata from the TMDB API
+type TMDBClient struct {
+	url      string
+	imageURL string
+	apiKey   string
+	language string
+	client   *http.Client
+}
+
+// NewTMDBClient returns a client for the configured API, or nil when no API
+// key is configured and imports are disabled
+func NewTMDBClient(cfg config.TMDBConfig) *TMDBClient {
+	if cfg.APIKey == "" {
+		return nil
+	}
+	baseURL := strings.TrimSuffix(cfg.URL, "/")
+	if baseURL == "" {
+		baseURL = defaultTMDBURL
+	}
+	imageURL := strings.TrimSuffix(cfg.ImageURL, "/")
+	if imageURL == "" {
+		imageURL = defaultTMDBImageURL
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTMDBTimeout
+	}
+
+	return &TMDBClient{
+		url:      baseURL,
+		imageURL: imageURL,
+		apiKey:   cfg.APIKey,
+		language: cfg.Language,
+		client:   tracecontext.NewClient(&http.Client{Timeout: timeout}),
+	}
+}
+
+// Movie fetches the movie with TMDB ID id
+func (c *TMDBClient) Movie(ctx context.Context, id int64) (*TMDBMovie, error) {
+	query := url.Values{}
+	if c.language != "" {
+		query.Set("language", c.language)
+	}
+	// v4 read access tokens are JWTs sent as bearer tokens; v3 keys go in
+	// the query
+	bearer := strings.Contains(c.apiKey, ".")
+	if !bearer {
+		query.Set("api_key", c.apiKey)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/movie/%d?%s", c.url, id, query.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build TMDB request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTMDBUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrTMDBNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: request failed with %d: %s", ErrTMDBUnavailable, resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var result struct {
+		ID          int64  `json:"id"`
+		Title       string `json:"title"`
+		Overview    string `json:"overview"`
+		ReleaseDate string `json:"release_date"`
+		Runtime     int    `json:"runtime"`
+		PosterPath  string `json:"poster_path"`
+		Genres      []struct {
+			Name string `json:"name"`
+		} `json:"genres"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%w: failed to decode movie: %w", ErrTMDBUnavailable, err)
+	}
+
+	movie := &TMDBMovie{
+		ID:       result.ID,
+		Title:    strings.TrimSpace(result.Title),
+		Overview: strings.TrimSpace(result.Overview),
+		Runtime:  result.Runtime,
+	}
+	// Release dates are YYYY-MM-DD, or empty for unreleased movies
+	if len(result.ReleaseDate) >= 4 {
+		movie.ReleaseYear, _ = strconv.Atoi(result.ReleaseDate[:4])
+	}
+	if result.PosterPath != "" {
+		movie.PosterURL = c.imageURL + "/" + strings.TrimPrefix(result.PosterPath, "/")
+	}
+	for _, genre := range result.Genres {
+		movie.Genres = append(movie.Genres, genre.Name)
+	}
+	return movie, nil
+}
@@ -0,0 +1,210 @@
+// Package jwtkeys holds the keys access tokens are signed and verified
+// with. Tokens are signed with HS256 and the shared JWT secret, or with
+// RS256 and the current RSA signing key, named in their kid header. Every
+// key configured verifies tokens, so a new signing key can be rotated in
+// while tokens signed with the previous one are still valid, and other
+// services can verify tokens with the public keys published as a JWKS.
+package jwtkeys
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// minRSABits is the smallest RSA signing key accepted
+const minRSABits = 2048
+
+var (
+	ErrUnknownKey = errors.New("unknown signing key")
+	ErrNoKeys     = errors.New("no signing keys")
+)
+
+// SigningKey is a PEM encoded RSA private key, in PKCS #1 or PKCS #8, and
+// the key ID tokens it signs carry
+type SigningKey struct {
+	ID         string `json:"kid"`
+	PrivateKey string `json:"private_key"`
+}
+
+// JWK is the public part of an RSA signing key, as published in a JWKS
+type JWK struct {
+	KeyType   string `json:"kty" example:"RSA"`
+	Use       string `json:"use" example:"sig"`
+	Algorithm string `json:"alg" example:"RS256"`
+	KeyID     string `json:"kid" example:"2024-06"`
+	N         string `json:"n"`
+	E         string `json:"e" example:"AQAB"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet signs tokens with its current key and verifies them with any of
+// its keys
+type KeySet struct {
+	algorithm string
+	secret    []byte
+	current   string
+	keys      map[string]*rsa.PrivateKey
+	order     []string
+}
+
+// NewKeySet returns the keys of algorithm, HS256 when empty. HS256 tokens
+// are signed with secret. RS256 tokens are signed with the key of
+// currentKID, or the first of keys when empty; tokens signed with secret,
+// when set, are still accepted, so a deployment can move from HS256 to
+// RS256 without logging everyone out.
+func NewKeySet(algorithm string, secret []byte, keys []SigningKey, currentKID string) (*KeySet, error) {
+	s := &KeySet{
+		algorithm: algorithm,
+		secret:    secret,
+		keys:      make(map[string]*rsa.PrivateKey, len(keys)),
+	}
+	if s.algorithm == "" {
+		s.algorithm = HS256
+	}
+
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("signing key without kid")
+		}
+		if _, ok := s.keys[key.ID]; ok {
+			return nil, fmt.Errorf("signing key %q listed twice", key.ID)
+		}
+		private, err := parseRSAKey(key.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", key.ID, err)
+		}
+		s.keys[key.ID] = private
+		s.order = append(s.order, key.ID)
+	}
+
+	switch s.algorithm {
+	case HS256:
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("%w: HS256 requires a secret", ErrNoKeys)
+		}
+	case RS256:
+		if len(s.order) == 0 {
+			return nil, fmt.Errorf("%w: RS256 requires an RSA signing key", ErrNoKeys)
+		}
+		s.current = currentKID
+		if s.current == "" {
+			s.current = s.order[0]
+		}
+		if _, ok := s.keys[s.current]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, s.current)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", s.algorithm)
+	}
+	return s, nil
+}
+
+// Sign returns the signed token of claims
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if s.algorithm == HS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.current
+	return token.SignedString(s.keys[s.current])
+}
+
+// Keyfunc returns the key verifying token: the secret for HS256 tokens,
+// and the public key named by the kid header for RS256 ones
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(s.secret) == 0 {
+			return nil, ErrUnknownKey
+		}
+		return s.secret, nil
+	case *jwt.SigningMethodRSA:
+		kid, _ := token.Header["kid"].(string)
+		key, ok := s.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		return &key.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+}
+
+// Methods lists the algorithms of the tokens the set verifies
+func (s *KeySet) Methods() []string {
+	var methods []string
+	if len(s.secret) > 0 {
+		methods = append(methods, HS256)
+	}
+	if len(s.keys) > 0 {
+		methods = append(methods, RS256)
+	}
+	return methods
+}
+
+// JWKS returns the public keys of the set, the current one first. HS256
+// secrets are never published, so the set is empty without RSA keys.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(s.order))}
+	if s.current != "" {
+		jwks.Keys = append(jwks.Keys, jwk(s.current, &s.keys[s.current].PublicKey))
+	}
+	for _, kid := range s.order {
+		if kid != s.current {
+			jwks.Keys = append(jwks.Keys, jwk(kid, &s.keys[kid].PublicKey))
+		}
+	}
+	return jwks
+}
+
+func jwk(kid string, key *rsa.PublicKey) JWK {
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: RS256,
+		KeyID:     kid,
+		N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// parseRSAKey decodes a PEM encoded RSA private key
+func parseRSAKey(data string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err8 != nil {
+			return nil, fmt.Errorf("not an RSA private key: %w", err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("not an RSA private key")
+		}
+	}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key of %d bits, fewer than %d", key.N.BitLen(), minRSABits)
+	}
+	return key, nil
+}
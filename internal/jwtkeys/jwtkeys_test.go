@@ -0,0 +1,243 @@
+package jwtkeys
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	testKeysOnce sync.Once
+	testKeys     map[string]*rsa.PrivateKey
+)
+
+// testKey returns the RSA key of kid, generated once per test binary
+func testKey(t *testing.T, kid string) *rsa.PrivateKey {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		testKeys = make(map[string]*rsa.PrivateKey)
+		for _, kid := range []string{"2024-01", "2024-06"} {
+			key, err := rsa.GenerateKey(rand.Reader, minRSABits)
+			if err != nil {
+				panic(err)
+			}
+			testKeys[kid] = key
+		}
+	})
+	key, ok := testKeys[kid]
+	if !ok {
+		t.Fatalf("no test key %q", kid)
+	}
+	return key
+}
+
+func pkcs1PEM(key *rsa.PrivateKey) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func pkcs8PEM(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func signingKeys(t *testing.T, kids ...string) []SigningKey {
+	t.Helper()
+	keys := make([]SigningKey, len(kids))
+	for i, kid := range kids {
+		keys[i] = SigningKey{ID: kid, PrivateKey: pkcs1PEM(testKey(t, kid))}
+	}
+	return keys
+}
+
+func newKeySet(t *testing.T, algorithm string, secret []byte, keys []SigningKey, current string) *KeySet {
+	t.Helper()
+	s, err := NewKeySet(algorithm, secret, keys, current)
+	if err != nil {
+		t.Fatalf("NewKeySet: %v", err)
+	}
+	return s
+}
+
+func sign(t *testing.T, s *KeySet) string {
+	t.Helper()
+	token, err := s.Sign(jwt.RegisteredClaims{Subject: "42"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return token
+}
+
+// verify parses token with s the way the auth service does
+func verify(s *KeySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, s.Keyfunc, jwt.WithValidMethods(s.Methods()))
+	return err
+}
+
+func TestKeyRotation(t *testing.T) {
+	secret := []byte("shared secret")
+	hs256 := newKeySet(t, HS256, secret, nil, "")
+	before := newKeySet(t, RS256, secret, signingKeys(t, "2024-01"), "")
+	during := newKeySet(t, RS256, secret, signingKeys(t, "2024-01", "2024-06"), "2024-06")
+	after := newKeySet(t, RS256, nil, signingKeys(t, "2024-06"), "")
+
+	tests := []struct {
+		name   string
+		signer *KeySet
+		kid    string
+		valid  []*KeySet
+		stale  []*KeySet
+	}{
+		{"HS256 secret", hs256, "", []*KeySet{hs256, before, during}, []*KeySet{after}},
+		{"first key", before, "2024-01", []*KeySet{before, during}, []*KeySet{hs256, after}},
+		{"rotated key", during, "2024-06", []*KeySet{during, after}, []*KeySet{hs256, before}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := sign(t, tt.signer)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if kid, _ := parsed.Header["kid"].(string); kid != tt.kid {
+				t.Errorf("token signed with kid %q, want %q", kid, tt.kid)
+			}
+
+			for i, s := range tt.valid {
+				if err := verify(s, token); err != nil {
+					t.Errorf("key set %d rejects the token: %v", i, err)
+				}
+			}
+			for i, s := range tt.stale {
+				if err := verify(s, token); err == nil {
+					t.Errorf("key set %d accepts the token", i)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyfuncRejectsUnknownKeys(t *testing.T) {
+	s := newKeySet(t, RS256, nil, signingKeys(t, "2024-01"), "")
+
+	// Signed with a key of the right ID the set does not hold
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.RegisteredClaims{Subject: "42"})
+	forged.Header["kid"] = "2024-01"
+	token, err := forged.SignedString(testKey(t, "2024-06"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if err := verify(s, token); err == nil {
+		t.Error("token signed with another key accepted")
+	}
+
+	forged.Header["kid"] = "2023-12"
+	token, err = forged.SignedString(testKey(t, "2024-01"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if err := verify(s, token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v for an unknown kid, want ErrUnknownKey", err)
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "42"})
+	token, err = hs.SignedString([]byte("guessed"))
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	if err := verify(s, token); err == nil {
+		t.Error("HS256 token accepted by a set without a secret")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	s := newKeySet(t, RS256, []byte("shared secret"), signingKeys(t, "2024-01", "2024-06"), "2024-06")
+
+	jwks := s.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(jwks.Keys))
+	}
+	for i, kid := range []string{"2024-06", "2024-01"} {
+		key := jwks.Keys[i]
+		if key.KeyID != kid {
+			t.Errorf("key %d is %q, want %q", i, key.KeyID, kid)
+		}
+		if key.KeyType != "RSA" || key.Use != "sig" || key.Algorithm != RS256 {
+			t.Errorf("key %q is %s/%s/%s, want RSA/sig/RS256", kid, key.KeyType, key.Use, key.Algorithm)
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			t.Fatalf("modulus of %q: %v", kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			t.Fatalf("exponent of %q: %v", kid, err)
+		}
+		public := rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if !public.Equal(&testKey(t, kid).PublicKey) {
+			t.Errorf("key %q does not match its signing key", kid)
+		}
+	}
+
+	if keys := newKeySet(t, HS256, []byte("shared secret"), nil, "").JWKS().Keys; len(keys) != 0 {
+		t.Errorf("HS256 set publishes %d keys", len(keys))
+	}
+}
+
+func TestNewKeySet(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		secret    []byte
+		keys      []SigningKey
+		current   string
+		err       error
+		ok        bool
+	}{
+		{name: "HS256 by default", secret: []byte("s"), ok: true},
+		{name: "PKCS #8 key", algorithm: RS256, keys: []SigningKey{{ID: "a", PrivateKey: pkcs8PEM(t, testKey(t, "2024-01"))}}, ok: true},
+		{name: "HS256 without secret", algorithm: HS256, err: ErrNoKeys},
+		{name: "RS256 without keys", algorithm: RS256, secret: []byte("s"), err: ErrNoKeys},
+		{name: "unknown current key", algorithm: RS256, keys: signingKeys(t, "2024-01"), current: "2024-06", err: ErrUnknownKey},
+		{name: "key without kid", algorithm: RS256, keys: []SigningKey{{PrivateKey: pkcs1PEM(testKey(t, "2024-01"))}}},
+		{name: "duplicate kid", algorithm: RS256, keys: append(signingKeys(t, "2024-01"), signingKeys(t, "2024-01")...)},
+		{name: "not PEM", algorithm: RS256, keys: []SigningKey{{ID: "a", PrivateKey: "secret"}}},
+		{name: "short key", algorithm: RS256, keys: []SigningKey{{ID: "a", PrivateKey: pkcs1PEM(small)}}},
+		{name: "unknown algorithm", algorithm: "ES256", secret: []byte("s")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeySet(tt.algorithm, tt.secret, tt.keys, tt.current)
+			switch {
+			case tt.ok:
+				if err != nil {
+					t.Errorf("NewKeySet: %v", err)
+				}
+			case err == nil:
+				t.Error("invalid keys accepted")
+			case tt.err != nil && !errors.Is(err, tt.err):
+				t.Errorf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
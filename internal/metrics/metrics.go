@@ -0,0 +1,185 @@
+// Package metrics exposes Prometheus metrics: HTTP requests by route and
+// status, database queries and the connection pool, and counters of what
+// users do, such as logins and plays.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/ndn/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ndn"
+
+// Login methods and results, the labels of the logins counter
+const (
+	LoginPassword = "password"
+	LoginOAuth    = "oauth"
+
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+// Metrics records the service's metrics in its own registry, so only what
+// is defined here, plus Go runtime and process stats, is exposed
+type Metrics struct {
+	cfg      config.MetricsConfig
+	registry *prometheus.Registry
+
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	logins        *prometheus.CounterVec
+	registrations prometheus.Counter
+	plays         prometheus.Counter
+	queries       *prometheus.CounterVec
+	queryDuration *prometheus.HistogramVec
+	slowQueries   *prometheus.CounterVec
+}
+
+// New creates the metrics, including the stats of the connection pool of db
+func New(cfg config.MetricsConfig, db *sql.DB) *Metrics {
+	m := &Metrics{
+		cfg:      cfg,
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time to serve HTTP requests by method, route pattern and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by method (password or oauth) and result.",
+		}, []string{"method", "result"}),
+		registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "registrations_total",
+			Help:      "Users registered, with a password or on first OAuth login.",
+		}),
+		plays: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "movie_plays_total",
+			Help:      "Movie plays reported by clients as play_start events.",
+		}),
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_queries_total",
+			Help:      "Database queries by operation, table and result.",
+		}, []string{"operation", "table", "result"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time to run database queries by operation and table.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+		}, []string{"operation", "table"}),
+		slowQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_slow_queries_total",
+			Help:      "Database queries slower than the slow query threshold by operation and table.",
+		}, []string{"operation", "table"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "postgres"),
+		m.requests,
+		m.duration,
+		m.logins,
+		m.registrations,
+		m.plays,
+		m.queries,
+		m.queryDuration,
+		m.slowQueries,
+	)
+	return m
+}
+
+// Enabled reports whether metrics are served
+func (m *Metrics) Enabled() bool {
+	return m.cfg.Enabled
+}
+
+// Path is where metrics are served, /metrics by default
+func (m *Metrics) Path() string {
+	if m.cfg.Path == "" {
+		return "/metrics"
+	}
+	return m.cfg.Path
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware counts and times requests. Requests are labelled by the chi
+// route pattern they matched, e.g. /api/movies/{id}, so IDs in paths do not
+// create a series each; requests matching no route share one label.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		labels := prometheus.Labels{"method": r.Method, "route": route, "status": strconv.Itoa(status)}
+		m.requests.With(labels).Inc()
+		m.duration.With(labels).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Login counts a login attempt with method
+func (m *Metrics) Login(method string, ok bool) {
+	result := resultSuccess
+	if !ok {
+		result = resultFailure
+	}
+	m.logins.WithLabelValues(method, result).Inc()
+}
+
+// Registration counts a new user
+func (m *Metrics) Registration() {
+	m.registrations.Inc()
+}
+
+// Query counts and times a database query with operation, e.g. SELECT, on
+// table, empty for raw queries
+func (m *Metrics) Query(operation, table string, elapsed time.Duration, failed, slow bool) {
+	result := resultSuccess
+	if failed {
+		result = resultFailure
+	}
+	m.queries.WithLabelValues(operation, table, result).Inc()
+	m.queryDuration.WithLabelValues(operation, table).Observe(elapsed.Seconds())
+	if slow {
+		m.slowQueries.WithLabelValues(operation, table).Inc()
+	}
+}
+
+// Plays counts n movie plays
+func (m *Metrics) Plays(n int) {
+	m.plays.Add(float64(n))
+}
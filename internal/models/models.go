@@ -2,21 +2,97 @@ package models
 
 import (
 	"context"
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/uptrace/bun"
 )
 
+// Roles of users in the content workflow. Admins may do anything either
+// role may.
+const (
+	RoleViewer    = "viewer"
+	RoleEditor    = "editor"
+	RolePublisher = "publisher"
+)
+
+// Publication states of a movie. Only published movies are shown publicly.
+const (
+	MovieStatusDraft     = "draft"
+	MovieStatusInReview  = "in_review"
+	MovieStatusScheduled = "scheduled" // published at PublishAt
+	MovieStatusPublished = "published"
+	MovieStatusArchived  = "archived"
+)
+
+// Processing states of a movie's uploaded video. The video is playable once
+// ready, from the HLS playlist set as the movie's VideoURL.
+const (
+	VideoStatusUploading  = "uploading"
+	VideoStatusProcessing = "processing"
+	VideoStatusReady      = "ready"
+	VideoStatusFailed     = "failed"
+)
+
+// Content ratings of movies, from the one suited to the youngest audience
+// up. Profiles may set the highest they are shown; kids profiles are limited
+// to ContentRatingPG.
+const (
+	ContentRatingG    = "G"
+	ContentRatingPG   = "PG"
+	ContentRatingPG13 = "PG-13"
+	ContentRatingR    = "R"
+	ContentRatingNC17 = "NC-17"
+)
+
+// ContentRatings lists the content ratings in order
+var ContentRatings = []string{ContentRatingG, ContentRatingPG, ContentRatingPG13, ContentRatingR, ContentRatingNC17}
+
+// Statuses of a subscription, as Stripe reports them
+const (
+	SubscriptionActive            = "active"
+	SubscriptionTrialing          = "trialing"
+	SubscriptionPastDue           = "past_due"
+	SubscriptionCanceled          = "canceled"
+	SubscriptionUnpaid            = "unpaid"
+	SubscriptionIncomplete        = "incomplete"
+	SubscriptionIncompleteExpired = "incomplete_expired"
+	SubscriptionPaused            = "paused"
+)
+
+// States of a transcoding job
+const (
+	TranscodeJobQueued  = "queued"
+	TranscodeJobRunning = "running"
+	TranscodeJobDone    = "done"
+	TranscodeJobFailed  = "failed"
+)
+
+// States of a data export
+const (
+	DataExportQueued  = "queued"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+	DataExportExpired = "expired"
+)
+
 type User struct {
 	bun.BaseModel `bun:"table:users,alias:u"`
 
-	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
-	Email     string    `bun:"email,unique,notnull" json:"email"`
-	Password  string    `bun:"password,notnull" json:"-"`
-	Name      string    `bun:"name,notnull" json:"name"`
-	IsAdmin   bool      `bun:"is_admin,notnull,default:false" json:"is_admin"`
-	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
-	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+	ID          int64      `bun:"id,pk,autoincrement" json:"id"`
+	Email       string     `bun:"email,unique,notnull" json:"email"`
+	Password    string     `bun:"password,notnull" json:"-"`
+	Name        string     `bun:"name,notnull" json:"name"`
+	IsAdmin     bool       `bun:"is_admin,notnull,default:false" json:"is_admin"`
+	Role        string     `bun:"role,notnull,default:'viewer'" json:"role"`
+	SuspendedAt *time.Time `bun:"suspended_at" json:"suspended_at,omitempty"` // while set, the user cannot sign in
+	DeletedAt   time.Time  `bun:"deleted_at,soft_delete,nullzero" json:"-"`   // by the user, removed for good after a grace period
+	CreatedAt   time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time  `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
 
 	Profile *UserProfile `bun:"rel:has-one,join:id=user_id" json:"profile,omitempty"`
 }
@@ -30,16 +106,94 @@ func (u *User) BeforeAppend(ctx context.Context, query *bun.InsertQuery) error {
 	return nil
 }
 
+// RefreshToken is an opaque, long-lived token exchanged for new access
+// tokens. Only its hash is stored. Tokens issued from one login share a
+// SessionID, and each is revoked once it has been exchanged. The tokens
+// exchanged for it act as its profile.
+type RefreshToken struct {
+	bun.BaseModel `bun:"table:refresh_tokens,alias:rt"`
+
+	ID        int64      `bun:"id,pk,autoincrement" json:"id"`
+	UserID    int64      `bun:"user_id,notnull" json:"user_id"`
+	SessionID string     `bun:"session_id,notnull" json:"session_id"`
+	ProfileID int64      `bun:"profile_id,nullzero" json:"profile_id,omitempty"` // the session acts as, if any
+	TokenHash string     `bun:"token_hash,notnull,unique" json:"-"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull" json:"expires_at"`
+	RevokedAt *time.Time `bun:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// RevokedToken revokes access tokens before they expire: the one with JTI
+// or, when IssuedBefore is set, every one of UserID issued before it but
+// those of KeptSessionID, if set. It is kept until ExpiresAt, when the
+// tokens it revokes have expired anyway.
+type RevokedToken struct {
+	bun.BaseModel `bun:"table:revoked_tokens,alias:rvt"`
+
+	ID           int64     `bun:"id,pk,autoincrement" json:"id"`
+	JTI          string    `bun:"jti,nullzero,unique" json:"jti,omitempty"`
+	UserID       int64     `bun:"user_id,notnull" json:"user_id"`
+	IssuedBefore time.Time `bun:"issued_before,nullzero" json:"issued_before,omitempty"`
+	// KeptSessionID is the session whose tokens IssuedBefore spares
+	KeptSessionID string    `bun:"kept_session_id,nullzero" json:"kept_session_id,omitempty"`
+	ExpiresAt     time.Time `bun:"expires_at,notnull" json:"expires_at"`
+}
+
+// PasswordResetToken is a single-use token emailed to a user to set a new
+// password. Only its hash is stored.
+type PasswordResetToken struct {
+	bun.BaseModel `bun:"table:password_reset_tokens,alias:prt"`
+
+	ID        int64      `bun:"id,pk,autoincrement" json:"id"`
+	UserID    int64      `bun:"user_id,notnull" json:"user_id"`
+	TokenHash string     `bun:"token_hash,notnull,unique" json:"-"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull" json:"expires_at"`
+	UsedAt    *time.Time `bun:"used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// EmailChangeToken is a single-use token emailed to the new address of a
+// user changing their email. The user's email becomes NewEmail once it is
+// confirmed. Only its hash is stored.
+type EmailChangeToken struct {
+	bun.BaseModel `bun:"table:email_change_tokens,alias:ect"`
+
+	ID        int64      `bun:"id,pk,autoincrement" json:"id"`
+	UserID    int64      `bun:"user_id,notnull" json:"user_id"`
+	NewEmail  string     `bun:"new_email,notnull" json:"new_email"`
+	TokenHash string     `bun:"token_hash,notnull,unique" json:"-"`
+	ExpiresAt time.Time  `bun:"expires_at,notnull" json:"expires_at"`
+	UsedAt    *time.Time `bun:"used_at" json:"used_at,omitempty"`
+	CreatedAt time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// UserIdentity links a user to their account at an OAuth provider, so they
+// can log in with it. Subject is the provider's ID for the account.
+type UserIdentity struct {
+	bun.BaseModel `bun:"table:user_identities,alias:ui"`
+
+	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID    int64     `bun:"user_id,notnull" json:"user_id"`
+	Provider  string    `bun:"provider,notnull" json:"provider"`
+	Subject   string    `bun:"subject,notnull" json:"subject"`
+	Email     string    `bun:"email,notnull" json:"email"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// UserProfile holds the personal details of a user. Avatar is the URL of
+// the default size of their uploaded avatar, and AvatarURLs that of every
+// size, by name.
 type UserProfile struct {
 	bun.BaseModel `bun:"table:user_profiles,alias:up"`
 
-	ID          int64     `bun:"id,pk,autoincrement" json:"id"`
-	UserID      int64     `bun:"user_id,unique,notnull" json:"user_id"`
-	Avatar      string    `bun:"avatar" json:"avatar"`
-	Bio         string    `bun:"bio" json:"bio"`
-	DateOfBirth time.Time `bun:"date_of_birth" json:"date_of_birth"`
-	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
-	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+	ID          int64             `bun:"id,pk,autoincrement" json:"id"`
+	UserID      int64             `bun:"user_id,unique,notnull" json:"user_id"`
+	Avatar      string            `bun:"avatar" json:"avatar"`
+	AvatarURLs  map[string]string `bun:"avatar_urls,type:jsonb" json:"avatar_urls,omitempty"`
+	Bio         string            `bun:"bio" json:"bio"`
+	DateOfBirth time.Time         `bun:"date_of_birth,nullzero" json:"date_of_birth"`
+	CreatedAt   time.Time         `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time         `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
 
 	User *User `bun:"rel:belongs-to,join:user_id=id" json:"user,omitempty"`
 }
@@ -53,20 +207,53 @@ func (up *UserProfile) BeforeAppend(ctx context.Context, query *bun.InsertQuery)
 	return nil
 }
 
+// Profile is one viewer of an account, with favorites and watch history of
+// their own. Access tokens select the profile they act as.
+type Profile struct {
+	bun.BaseModel `bun:"table:profiles,alias:pf"`
+
+	ID               int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID           int64     `bun:"user_id,notnull" json:"user_id"`
+	Name             string    `bun:"name,notnull" json:"name"`
+	Avatar           string    `bun:"avatar,notnull" json:"avatar"`
+	IsKids           bool      `bun:"is_kids,notnull" json:"is_kids"`
+	MaxContentRating string    `bun:"max_content_rating,nullzero" json:"max_content_rating,omitempty"` // any when empty
+	PINHash          string    `bun:"pin_hash,nullzero" json:"-"`                                      // of the parental PIN, if set
+	CreatedAt        time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt        time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
 type Movie struct {
 	bun.BaseModel `bun:"table:movies,alias:m"`
 
-	ID          int64     `bun:"id,pk,autoincrement" json:"id"`
-	Title       string    `bun:"title,notnull" json:"title"`
-	Description string    `bun:"description,notnull" json:"description"`
-	ReleaseYear int       `bun:"release_year,notnull" json:"release_year"`
-	Duration    int       `bun:"duration,notnull" json:"duration"` // in minutes
-	PosterURL   string    `bun:"poster_url,notnull" json:"poster_url"`
-	VideoURL    string    `bun:"video_url,notnull" json:"video_url"`
-	Categories  []string  `bun:"categories,array" json:"categories"`
-	Rating      float64   `bun:"rating" json:"rating"`
-	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
-	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+	ID             int64      `bun:"id,pk,autoincrement" json:"id"`
+	Title          string     `bun:"title,notnull" json:"title"`
+	Description    string     `bun:"description,notnull" json:"description"`
+	ReleaseYear    int        `bun:"release_year,notnull" json:"release_year"`
+	Duration       int        `bun:"duration,notnull" json:"duration"` // in minutes
+	PosterURL      string     `bun:"poster_url,notnull" json:"poster_url"`
+	VideoURL       string     `bun:"video_url,notnull" json:"video_url"`
+	Categories     []string   `bun:"categories,array" json:"categories"`                        // names of CategoryRefs, kept in step by MovieService
+	MaturityRating string     `bun:"maturity_rating,nullzero" json:"maturity_rating,omitempty"` // one of ContentRatings, if rated
+	Rating         float64    `bun:"rating" json:"rating"`
+	RatingCount    int        `bun:"rating_count,notnull,default:0" json:"rating_count"` // reviews averaged into Rating
+	ExternalSource string     `bun:"external_source,nullzero" json:"external_source,omitempty"`
+	ExternalID     string     `bun:"external_id,nullzero" json:"external_id,omitempty"` // unique per source
+	Status         string     `bun:"status,notnull,default:'published'" json:"status"`
+	PublishAt      *time.Time `bun:"publish_at" json:"publish_at,omitempty"`              // while scheduled
+	AvailableFrom  *time.Time `bun:"available_from" json:"available_from,omitempty"`      // shown publicly from, if published
+	AvailableUntil *time.Time `bun:"available_until" json:"available_until,omitempty"`    // and until
+	VideoStatus    string     `bun:"video_status,nullzero" json:"video_status,omitempty"` // of the uploaded video, if any
+	VideoError     string     `bun:"video_error,nullzero" json:"video_error,omitempty"`   // why processing failed
+	VideoSourceKey string     `bun:"video_source_key,nullzero" json:"-"`                  // storage key of the upload
+	CreatedAt      time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt      time.Time  `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+	DeletedAt      *time.Time `bun:"deleted_at,soft_delete,nullzero" json:"deleted_at,omitempty"` // restorable until purged
+
+	// CategoryRefs are the categories linked in movie_categories, loaded by
+	// database.LoadMovieCategories. On writes through MovieService, when
+	// not nil, they replace the categories of the movie by ID.
+	CategoryRefs []Category `bun:"-" json:"-"`
 }
 
 // BeforeAppend is called before the model is inserted/updated
@@ -83,6 +270,7 @@ type UserFavorite struct {
 
 	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
 	UserID    int64     `bun:"user_id,notnull" json:"user_id"`
+	ProfileID int64     `bun:"profile_id,nullzero" json:"profile_id,omitempty"` // the account's own when empty
 	MovieID   int64     `bun:"movie_id,notnull" json:"movie_id"`
 	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
 
@@ -90,13 +278,34 @@ type UserFavorite struct {
 	Movie *Movie `bun:"rel:belongs-to,join:movie_id=id" json:"movie,omitempty"`
 }
 
-type Category struct {
-	bun.BaseModel `bun:"table:categories,alias:c"`
+// Review is a user's score of a movie from 1 to 5, with optional text. The
+// movie's Rating is the average score of its reviews.
+type Review struct {
+	bun.BaseModel `bun:"table:reviews,alias:r"`
 
 	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
-	Name      string    `bun:"name,notnull,unique" json:"name"`
+	UserID    int64     `bun:"user_id,nullzero" json:"user_id,omitempty"` // none once its user deleted their account
+	MovieID   int64     `bun:"movie_id,notnull" json:"movie_id"`
+	Score     int       `bun:"score,notnull" json:"score"`
+	Text      string    `bun:"text,notnull" json:"text"`
 	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
 	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	User *User `bun:"rel:belongs-to,join:user_id=id" json:"user,omitempty"`
+}
+
+type Category struct {
+	bun.BaseModel `bun:"table:categories,alias:c"`
+
+	ID           int64      `bun:"id,pk,autoincrement" json:"id"`
+	Name         string     `bun:"name,notnull,unique" json:"name"`
+	Slug         string     `bun:"slug,notnull,unique" json:"slug"`
+	ParentID     *int64     `bun:"parent_id" json:"parent_id,omitempty"`
+	DisplayOrder int        `bun:"display_order,notnull,default:0" json:"display_order"`
+	Hidden       bool       `bun:"hidden,notnull,default:false" json:"hidden"`
+	CreatedAt    time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt    time.Time  `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+	DeletedAt    *time.Time `bun:"deleted_at,soft_delete,nullzero" json:"deleted_at,omitempty"` // restorable until purged
 }
 
 // BeforeAppend is called before the model is inserted/updated
@@ -118,3 +327,584 @@ type MovieCategory struct {
 	Movie    *Movie    `bun:"rel:belongs-to,join:movie_id=id" json:"movie,omitempty"`
 	Category *Category `bun:"rel:belongs-to,join:category_id=id" json:"category,omitempty"`
 }
+
+// Collection is a curated row of movies, such as Staff Picks, shown on the
+// home page in display order unless hidden
+type Collection struct {
+	bun.BaseModel `bun:"table:collections,alias:col"`
+
+	ID           int64     `bun:"id,pk,autoincrement" json:"id"`
+	Slug         string    `bun:"slug,notnull,unique" json:"slug"`
+	Title        string    `bun:"title,notnull" json:"title"`
+	Description  string    `bun:"description,notnull" json:"description"`
+	DisplayOrder int       `bun:"display_order,notnull,default:0" json:"display_order"`
+	Hidden       bool      `bun:"hidden,notnull,default:false" json:"hidden"`
+	CreatedAt    time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt    time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	Items []CollectionItem `bun:"rel:has-many,join:id=collection_id" json:"items,omitempty"`
+}
+
+// CollectionItem places a movie in a collection, at Position from 1
+type CollectionItem struct {
+	bun.BaseModel `bun:"table:collection_items,alias:ci"`
+
+	CollectionID int64     `bun:"collection_id,pk" json:"-"`
+	MovieID      int64     `bun:"movie_id,pk" json:"movie_id"`
+	Position     int       `bun:"position,notnull" json:"position"`
+	CreatedAt    time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+type APIKey struct {
+	bun.BaseModel `bun:"table:api_keys,alias:ak"`
+
+	ID      int64  `bun:"id,pk,autoincrement" json:"id"`
+	Name    string `bun:"name,notnull" json:"name"`
+	Prefix  string `bun:"prefix,notnull,unique" json:"prefix"`
+	KeyHash string `bun:"key_hash,notnull,unique" json:"-"`
+	// SigningSecret signs the mutations made with the key, see replay
+	SigningSecret string     `bun:"signing_secret,nullzero" json:"-"`
+	DailyQuota    int        `bun:"daily_quota,notnull" json:"daily_quota"`     // 0 means unlimited
+	MonthlyQuota  int        `bun:"monthly_quota,notnull" json:"monthly_quota"` // 0 means unlimited
+	RevokedAt     *time.Time `bun:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time  `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// BeforeAppend is called before the model is inserted/updated
+func (k *APIKey) BeforeAppend(ctx context.Context, query *bun.InsertQuery) error {
+	k.UpdatedAt = time.Now()
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+type APIKeyUsage struct {
+	bun.BaseModel `bun:"table:api_key_usage,alias:aku"`
+
+	APIKeyID     int64     `bun:"api_key_id,pk" json:"api_key_id"`
+	Day          time.Time `bun:"day,pk,type:date" json:"day"`
+	RequestCount int64     `bun:"request_count,notnull" json:"request_count"`
+}
+
+// AuditEntry records an admin mutation, with the fields it changed. Before
+// and After hold the values of those fields either side of the change;
+// mutations no service describes have the body of their request as After.
+type AuditEntry struct {
+	bun.BaseModel `bun:"table:audit_log,alias:al"`
+
+	ID         int64                  `bun:"id,pk,autoincrement" json:"id"`
+	ActorID    *int64                 `bun:"actor_id" json:"actor_id,omitempty"`
+	Action     string                 `bun:"action,notnull" json:"action"`
+	EntityType string                 `bun:"entity_type,notnull" json:"entity_type"`
+	EntityID   int64                  `bun:"entity_id,nullzero" json:"entity_id,omitempty"` // none when the route names no entity by ID
+	Route      string                 `bun:"route,nullzero" json:"route,omitempty"`         // e.g. PUT /api/admin/plans/{code}
+	IP         string                 `bun:"ip,nullzero" json:"ip,omitempty"`
+	RequestID  string                 `bun:"request_id,nullzero" json:"request_id,omitempty"`
+	Before     map[string]interface{} `bun:"before,type:jsonb" json:"before,omitempty"`
+	After      map[string]interface{} `bun:"after,type:jsonb" json:"after,omitempty"`
+	CreatedAt  time.Time              `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// AnalyticsEvent is a client-reported interaction with a title
+type AnalyticsEvent struct {
+	bun.BaseModel `bun:"table:analytics_events,alias:ae"`
+
+	ID              int64     `bun:"id,pk,autoincrement" json:"id"`
+	Type            string    `bun:"type,notnull" json:"type"`
+	UserID          *int64    `bun:"user_id" json:"user_id,omitempty"`
+	SessionID       string    `bun:"session_id,nullzero" json:"session_id,omitempty"`
+	MovieID         int64     `bun:"movie_id,nullzero" json:"movie_id,omitempty"` // 0 for search events
+	PositionSeconds *int      `bun:"position_seconds" json:"position_seconds,omitempty"`
+	Query           string    `bun:"query,nullzero" json:"query,omitempty"`
+	Reason          string    `bun:"reason,nullzero" json:"reason,omitempty"` // recommendation reason code
+	OccurredAt      time.Time `bun:"occurred_at,notnull" json:"occurred_at"`
+	ReceivedAt      time.Time `bun:"received_at,notnull,default:current_timestamp" json:"received_at"`
+}
+
+// MovieDailyStats aggregates a movie's analytics events for one UTC day
+type MovieDailyStats struct {
+	bun.BaseModel `bun:"table:movie_daily_stats,alias:mds"`
+
+	MovieID      int64     `bun:"movie_id,pk" json:"movie_id"`
+	Day          time.Time `bun:"day,pk,type:date" json:"day"`
+	Impressions  int64     `bun:"impressions,notnull" json:"impressions"`
+	Views        int64     `bun:"views,notnull" json:"views"`     // play_start events
+	Viewers      int64     `bun:"viewers,notnull" json:"viewers"` // distinct users or sessions
+	Completions  int64     `bun:"completions,notnull" json:"completions"`
+	WatchSeconds int64     `bun:"watch_seconds,notnull" json:"watch_seconds"`
+}
+
+// UserDailyStats aggregates a user's playback for one UTC day
+type UserDailyStats struct {
+	bun.BaseModel `bun:"table:user_daily_stats,alias:uds"`
+
+	UserID       int64     `bun:"user_id,pk" json:"user_id"`
+	Day          time.Time `bun:"day,pk,type:date" json:"day"`
+	Views        int64     `bun:"views,notnull" json:"views"`
+	Titles       int64     `bun:"titles,notnull" json:"titles"` // distinct movies started
+	Completions  int64     `bun:"completions,notnull" json:"completions"`
+	WatchSeconds int64     `bun:"watch_seconds,notnull" json:"watch_seconds"`
+}
+
+// UserMovieDailyStats aggregates a user's playback of one movie for one UTC
+// day
+type UserMovieDailyStats struct {
+	bun.BaseModel `bun:"table:user_movie_daily_stats,alias:umds"`
+
+	UserID       int64     `bun:"user_id,pk" json:"user_id"`
+	MovieID      int64     `bun:"movie_id,pk" json:"movie_id"`
+	Day          time.Time `bun:"day,pk,type:date" json:"day"`
+	Completions  int64     `bun:"completions,notnull" json:"completions"`
+	WatchSeconds int64     `bun:"watch_seconds,notnull" json:"watch_seconds"`
+}
+
+// AnalyticsRollup marks a day whose raw events have been aggregated
+type AnalyticsRollup struct {
+	bun.BaseModel `bun:"table:analytics_rollups,alias:ar"`
+
+	Day        time.Time `bun:"day,pk,type:date" json:"day"`
+	RolledUpAt time.Time `bun:"rolled_up_at,notnull,default:current_timestamp" json:"rolled_up_at"`
+}
+
+// ExportCheckpoint records how far analytics have been shipped to a
+// warehouse sink
+type ExportCheckpoint struct {
+	bun.BaseModel `bun:"table:export_checkpoints,alias:ec"`
+
+	Sink        string    `bun:"sink,pk" json:"sink"`
+	LastEventID int64     `bun:"last_event_id,notnull" json:"last_event_id"`
+	LastDay     time.Time `bun:"last_day,type:date,nullzero" json:"last_day,omitempty"` // last exported rollup day
+	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// MovieEmbedding is the vector a movie's metadata was embedded into
+type MovieEmbedding struct {
+	bun.BaseModel `bun:"table:movie_embeddings,alias:me"`
+
+	MovieID    int64     `bun:"movie_id,pk" json:"movie_id"`
+	Model      string    `bun:"model,notnull" json:"model"`
+	Embedding  Vector    `bun:"embedding,type:vector,notnull" json:"-"`
+	SourceHash string    `bun:"source_hash,notnull" json:"source_hash"` // SHA-256 of the embedded text
+	UpdatedAt  time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// TrendingSettings are the trending score parameters set by an admin. Until
+// the single row exists, the defaults from configuration apply.
+type TrendingSettings struct {
+	bun.BaseModel `bun:"table:trending_settings,alias:ts"`
+
+	ID            int       `bun:"id,pk" json:"-"`
+	HalfLifeHours float64   `bun:"half_life_hours,notnull" json:"half_life_hours"`
+	WindowDays    int       `bun:"window_days,notnull" json:"window_days"`
+	AgeGravity    float64   `bun:"age_gravity,notnull" json:"age_gravity"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero" json:"updated_at"` // zero while the configured defaults apply
+}
+
+// MovieTrendingScore is a movie's trending score as of the last computation
+type MovieTrendingScore struct {
+	bun.BaseModel `bun:"table:movie_trending_scores,alias:mts"`
+
+	MovieID    int64     `bun:"movie_id,pk" json:"movie_id"`
+	Score      float64   `bun:"score,notnull" json:"score"`
+	ComputedAt time.Time `bun:"computed_at,notnull" json:"computed_at"`
+}
+
+// MovieTrendingWindowScore is a movie's trending score over the last
+// WindowDays days as of the last computation
+type MovieTrendingWindowScore struct {
+	bun.BaseModel `bun:"table:movie_trending_window_scores,alias:mtw"`
+
+	WindowDays int       `bun:"window_days,pk" json:"window_days"`
+	MovieID    int64     `bun:"movie_id,pk" json:"movie_id"`
+	Score      float64   `bun:"score,notnull" json:"score"`
+	ComputedAt time.Time `bun:"computed_at,notnull" json:"computed_at"`
+}
+
+// EditorialBoost promotes a movie in one listing: search results for Query,
+// the row of Category, or the unfiltered catalog when both are empty. A
+// boost with a Position pins the movie there; otherwise its Weight ranks it
+// ahead of unboosted movies. It only applies between StartsAt and EndsAt.
+type EditorialBoost struct {
+	bun.BaseModel `bun:"table:editorial_boosts,alias:eb"`
+
+	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
+	MovieID   int64     `bun:"movie_id,notnull" json:"movie_id"`
+	Query     string    `bun:"query,nullzero" json:"query,omitempty"` // normalised search term
+	Category  string    `bun:"category,nullzero" json:"category,omitempty"`
+	Position  int       `bun:"position,nullzero" json:"position,omitempty"` // 1-based
+	Weight    float64   `bun:"weight,notnull" json:"weight,omitempty"`
+	StartsAt  time.Time `bun:"starts_at,nullzero" json:"starts_at,omitempty"`
+	EndsAt    time.Time `bun:"ends_at,nullzero" json:"ends_at,omitempty"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// FeaturedSlot features a movie or a collection, one of MovieID and
+// CollectionID, in the banners of the home page between StartsAt and EndsAt.
+// Slots with a higher Priority come first.
+type FeaturedSlot struct {
+	bun.BaseModel `bun:"table:featured_slots,alias:fs"`
+
+	ID           int64     `bun:"id,pk,autoincrement" json:"id"`
+	MovieID      *int64    `bun:"movie_id" json:"movie_id,omitempty"`
+	CollectionID *int64    `bun:"collection_id" json:"collection_id,omitempty"`
+	Headline     string    `bun:"headline,notnull" json:"headline,omitempty"`   // the title of the target when empty
+	ImageURL     string    `bun:"image_url,notnull" json:"image_url,omitempty"` // the poster of a movie when empty
+	Priority     int       `bun:"priority,notnull" json:"priority"`
+	StartsAt     time.Time `bun:"starts_at,nullzero" json:"starts_at,omitempty"`
+	EndsAt       time.Time `bun:"ends_at,nullzero" json:"ends_at,omitempty"`
+	CreatedAt    time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt    time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// SearchSynonym makes searches for Term also match its Alternatives, such as
+// synonyms, alternate titles or the correct spelling of a misspelling
+type SearchSynonym struct {
+	bun.BaseModel `bun:"table:search_synonyms,alias:ss"`
+
+	ID           int64     `bun:"id,pk,autoincrement" json:"id"`
+	Term         string    `bun:"term,notnull,unique" json:"term"` // normalised
+	Alternatives []string  `bun:"alternatives,array,notnull" json:"alternatives"`
+	CreatedAt    time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt    time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// ContentFlag is user-generated text the content filter accepted but held
+// for moderator review, with the reasons it was flagged
+type ContentFlag struct {
+	bun.BaseModel `bun:"table:content_flags,alias:cf"`
+
+	ID         int64      `bun:"id,pk,autoincrement" json:"id"`
+	EntityType string     `bun:"entity_type,notnull" json:"entity_type" example:"user_profile"`
+	EntityID   int64      `bun:"entity_id,notnull" json:"entity_id"`
+	Field      string     `bun:"field,notnull" json:"field" example:"bio"`
+	Content    string     `bun:"content,notnull" json:"content"`
+	Reasons    []string   `bun:"reasons,array,notnull" json:"reasons" example:"flagged_word:free money"`
+	Status     string     `bun:"status,notnull,default:'pending'" json:"status" example:"pending"`
+	ResolvedBy *int64     `bun:"resolved_by" json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `bun:"resolved_at" json:"resolved_at,omitempty"`
+	CreatedAt  time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+}
+
+// TranscodeJob converts the video uploaded for a movie, stored at SourceKey,
+// into HLS renditions. Attempts counts the times a worker claimed it.
+type TranscodeJob struct {
+	bun.BaseModel `bun:"table:transcode_jobs,alias:tj"`
+
+	ID         int64      `bun:"id,pk,autoincrement" json:"id"`
+	MovieID    int64      `bun:"movie_id,notnull" json:"movie_id"`
+	SourceKey  string     `bun:"source_key,notnull" json:"-"`
+	Status     string     `bun:"status,notnull,default:'queued'" json:"status" example:"running"`
+	Attempts   int        `bun:"attempts,notnull,default:0" json:"attempts"`
+	Error      string     `bun:"error,nullzero" json:"error,omitempty"`
+	CreatedAt  time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	StartedAt  *time.Time `bun:"started_at" json:"started_at,omitempty"`
+	FinishedAt *time.Time `bun:"finished_at" json:"finished_at,omitempty"`
+}
+
+// DataExport is an archive of a user's data, built in the background and
+// stored at ObjectKey until ExpiresAt, when it is deleted
+type DataExport struct {
+	bun.BaseModel `bun:"table:data_exports,alias:dx"`
+
+	ID         int64      `bun:"id,pk,autoincrement" json:"id"`
+	UserID     int64      `bun:"user_id,notnull" json:"-"`
+	Status     string     `bun:"status,notnull,default:'queued'" json:"status" example:"ready"`
+	ObjectKey  string     `bun:"object_key,nullzero" json:"-"`
+	Size       int64      `bun:"size,notnull,default:0" json:"size,omitempty"` // of the archive, in bytes
+	Error      string     `bun:"error,nullzero" json:"-"`
+	CreatedAt  time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	StartedAt  *time.Time `bun:"started_at" json:"started_at,omitempty"`
+	FinishedAt *time.Time `bun:"finished_at" json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time `bun:"expires_at" json:"expires_at,omitempty"`
+}
+
+// MovieTranslation is the title and description of a movie in a locale,
+// shown to clients asking for it. Empty fields fall back to the movie's own.
+type MovieTranslation struct {
+	bun.BaseModel `bun:"table:movie_translations,alias:mt"`
+
+	MovieID     int64     `bun:"movie_id,pk" json:"movie_id"`
+	Locale      string    `bun:"locale,pk" json:"locale" example:"pt-BR"`
+	Title       string    `bun:"title,notnull" json:"title" example:"Matrix"`
+	Description string    `bun:"description,notnull" json:"description"`
+	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// Subtitle is the subtitle track of a movie in one language. Content is
+// WebVTT whatever Format the track was uploaded in.
+type Subtitle struct {
+	bun.BaseModel `bun:"table:subtitles,alias:st"`
+
+	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
+	MovieID   int64     `bun:"movie_id,notnull" json:"movie_id"`
+	Language  string    `bun:"language,notnull" json:"language" example:"pt-BR"`
+	Label     string    `bun:"label,notnull" json:"label" example:"Português (Brasil)"`
+	Format    string    `bun:"format,notnull" json:"format" example:"srt"`
+	Content   string    `bun:"content,notnull" json:"-"`
+	CreatedAt time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// Vector is a pgvector value, written and read in its text form "[1,2,3]"
+type Vector []float32
+
+func (v Vector) Value() (driver.Value, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func (v *Vector) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	case nil:
+		*v = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Vector", src)
+	}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	vec := make(Vector, len(parts))
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return fmt.Errorf("invalid vector element %q: %w", part, err)
+		}
+		vec[i] = float32(f)
+	}
+	*v = vec
+	return nil
+}
+
+// WatchHistory is where a user, or one of their profiles, last stopped in a
+// movie, so playback can resume there
+type WatchHistory struct {
+	bun.BaseModel `bun:"table:watch_history,alias:wh"`
+
+	UserID          int64     `bun:"user_id,notnull" json:"user_id"`
+	ProfileID       int64     `bun:"profile_id,nullzero" json:"profile_id,omitempty"` // the account's own when empty
+	MovieID         int64     `bun:"movie_id,notnull" json:"movie_id"`
+	PositionSeconds int       `bun:"position_seconds,notnull" json:"position_seconds"`
+	Device          string    `bun:"device,notnull" json:"device,omitempty"`
+	LastWatchedAt   time.Time `bun:"last_watched_at,notnull,default:current_timestamp" json:"last_watched_at"`
+}
+
+// Series is a TV series, made of numbered seasons of episodes
+type Series struct {
+	bun.BaseModel `bun:"table:series,alias:sr"`
+
+	ID          int64     `bun:"id,pk,autoincrement" json:"id"`
+	Title       string    `bun:"title,notnull" json:"title"`
+	Description string    `bun:"description,notnull" json:"description"`
+	ReleaseYear int       `bun:"release_year,notnull" json:"release_year"`
+	PosterURL   string    `bun:"poster_url,notnull" json:"poster_url"`
+	Categories  []string  `bun:"categories,array" json:"categories"`
+	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	Seasons []*Season `bun:"rel:has-many,join:id=series_id" json:"seasons,omitempty"`
+}
+
+// Season is a numbered season of a series
+type Season struct {
+	bun.BaseModel `bun:"table:seasons,alias:sn"`
+
+	ID          int64     `bun:"id,pk,autoincrement" json:"id"`
+	SeriesID    int64     `bun:"series_id,notnull" json:"series_id"`
+	Number      int       `bun:"number,notnull" json:"number"`
+	Title       string    `bun:"title,notnull" json:"title"`
+	Description string    `bun:"description,notnull" json:"description"`
+	ReleaseYear int       `bun:"release_year,notnull" json:"release_year"`
+	PosterURL   string    `bun:"poster_url,notnull" json:"poster_url"`
+	CreatedAt   time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	Episodes []*Episode `bun:"rel:has-many,join:id=season_id" json:"episodes,omitempty"`
+}
+
+// Episode is a numbered episode of a season, played like a movie from its
+// own video. Duration is in minutes.
+type Episode struct {
+	bun.BaseModel `bun:"table:episodes,alias:ep"`
+
+	ID          int64      `bun:"id,pk,autoincrement" json:"id"`
+	SeasonID    int64      `bun:"season_id,notnull" json:"season_id"`
+	Number      int        `bun:"number,notnull" json:"number"`
+	Title       string     `bun:"title,notnull" json:"title"`
+	Description string     `bun:"description,notnull" json:"description"`
+	Duration    int        `bun:"duration,notnull" json:"duration"`
+	VideoURL    string     `bun:"video_url,notnull" json:"video_url"`
+	AirDate     *time.Time `bun:"air_date,type:date" json:"air_date,omitempty"`
+	CreatedAt   time.Time  `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time  `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// Plan is a subscription plan sold through Stripe at the price with
+// StripePriceID. Code names the plan in rate_limit.plan_multipliers.
+type Plan struct {
+	bun.BaseModel `bun:"table:plans,alias:pl"`
+
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	Code          string    `bun:"code,unique,notnull" json:"code"`
+	Name          string    `bun:"name,notnull" json:"name"`
+	StripePriceID string    `bun:"stripe_price_id,unique,notnull" json:"stripe_price_id"`
+	PriceCents    int64     `bun:"price_cents,notnull" json:"price_cents"`
+	Currency      string    `bun:"currency,notnull" json:"currency"`
+	Interval      string    `bun:"billing_interval,notnull" json:"interval"` // month or year
+	Active        bool      `bun:"active,notnull,default:true" json:"active"`
+	CreatedAt     time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// Subscription is a Stripe subscription of a user, kept up to date from
+// Stripe's webhook events. A user may have several over time.
+type Subscription struct {
+	bun.BaseModel `bun:"table:subscriptions,alias:sub"`
+
+	ID                   int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID               int64     `bun:"user_id,notnull" json:"user_id"`
+	PlanID               int64     `bun:"plan_id,nullzero" json:"plan_id,omitempty"` // none for prices of no plan
+	StripeCustomerID     string    `bun:"stripe_customer_id,notnull" json:"-"`
+	StripeSubscriptionID string    `bun:"stripe_subscription_id,unique,notnull" json:"-"`
+	Status               string    `bun:"status,notnull" json:"status"`
+	CurrentPeriodEnd     time.Time `bun:"current_period_end,notnull" json:"current_period_end"`
+	CancelAtPeriodEnd    bool      `bun:"cancel_at_period_end,notnull,default:false" json:"cancel_at_period_end"`
+	CreatedAt            time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt            time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+
+	Plan *Plan `bun:"rel:belongs-to,join:plan_id=id" json:"plan,omitempty"`
+}
+
+// BillingEvent records a Stripe event that was handled
+type BillingEvent struct {
+	bun.BaseModel `bun:"table:billing_events,alias:be"`
+
+	ID         string    `bun:"id,pk" json:"id"`
+	Type       string    `bun:"type,notnull" json:"type"`
+	ReceivedAt time.Time `bun:"received_at,notnull,default:current_timestamp" json:"received_at"`
+}
+
+// PlaybackSession is a stream a user started, counted against the concurrent
+// streams of their plan while its player keeps sending heartbeats or
+// fetching from it. ID is the hex SHA-256 of its playback token. DeviceID and
+// Device are the identifier and name the player gave for its device.
+type PlaybackSession struct {
+	bun.BaseModel `bun:"table:playback_sessions,alias:ps"`
+
+	ID         string    `bun:"id,pk" json:"id"`
+	UserID     int64     `bun:"user_id,notnull" json:"-"`
+	MovieID    int64     `bun:"movie_id,notnull" json:"movie_id"`
+	DeviceID   string    `bun:"device_id,nullzero" json:"device_id,omitempty"`
+	Device     string    `bun:"device,nullzero" json:"device,omitempty"`
+	StartedAt  time.Time `bun:"started_at,notnull,default:current_timestamp" json:"started_at"`
+	LastSeenAt time.Time `bun:"last_seen_at,notnull,default:current_timestamp" json:"last_seen_at"`
+	ExpiresAt  time.Time `bun:"expires_at,notnull" json:"expires_at"`
+}
+
+// EndedStream is a stream ended before its playback token expired, whose
+// token is refused until then. ID is the ID of its PlaybackSession.
+type EndedStream struct {
+	bun.BaseModel `bun:"table:ended_playback_streams,alias:eps"`
+
+	ID        string    `bun:"id,pk"`
+	ExpiresAt time.Time `bun:"expires_at,notnull"`
+}
+
+// Coupon durations: how long the discount of a coupon lasts on the
+// subscription it is redeemed for
+const (
+	CouponOnce      = "once"
+	CouponRepeating = "repeating"
+	CouponForever   = "forever"
+)
+
+// Coupon is a promo code discounting Checkout subscriptions by PercentOff
+// percent or AmountOffCents in Currency, for the first invoice (once), the
+// first DurationMonths months (repeating) or every invoice (forever). It
+// can be redeemed MaxRedemptions times, any number when zero, until
+// ExpiresAt, if set.
+type Coupon struct {
+	bun.BaseModel `bun:"table:coupons,alias:cp"`
+
+	ID             int64     `bun:"id,pk,autoincrement" json:"id"`
+	Code           string    `bun:"code,unique,notnull" json:"code"`
+	Description    string    `bun:"description,nullzero" json:"description,omitempty"`
+	PercentOff     int       `bun:"percent_off,nullzero" json:"percent_off,omitempty"`
+	AmountOffCents int64     `bun:"amount_off_cents,nullzero" json:"amount_off_cents,omitempty"`
+	Currency       string    `bun:"currency,nullzero" json:"currency,omitempty"`
+	Duration       string    `bun:"duration,notnull" json:"duration"`
+	DurationMonths int       `bun:"duration_months,nullzero" json:"duration_months,omitempty"`
+	MaxRedemptions int       `bun:"max_redemptions,notnull,default:0" json:"max_redemptions"`
+	TimesRedeemed  int       `bun:"times_redeemed,notnull,default:0" json:"times_redeemed"`
+	ExpiresAt      time.Time `bun:"expires_at,nullzero" json:"expires_at,omitempty"`
+	Active         bool      `bun:"active,notnull,default:true" json:"active"`
+	StripeCouponID string    `bun:"stripe_coupon_id,notnull" json:"-"`
+	CreatedAt      time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	UpdatedAt      time.Time `bun:"updated_at,notnull,default:current_timestamp" json:"updated_at"`
+}
+
+// CouponRedemption is a coupon redeemed by a user, applied to their
+// Checkout sessions until one of them completes, at UsedAt
+type CouponRedemption struct {
+	bun.BaseModel `bun:"table:coupon_redemptions,alias:cr"`
+
+	ID                int64     `bun:"id,pk,autoincrement" json:"id"`
+	CouponID          int64     `bun:"coupon_id,notnull" json:"coupon_id"`
+	UserID            int64     `bun:"user_id,notnull" json:"user_id"`
+	CheckoutSessionID string    `bun:"checkout_session_id,nullzero" json:"-"` // the latest it was applied to
+	RedeemedAt        time.Time `bun:"redeemed_at,notnull,default:current_timestamp" json:"redeemed_at"`
+	UsedAt            time.Time `bun:"used_at,nullzero" json:"used_at,omitempty"`
+
+	Coupon *Coupon `bun:"rel:belongs-to,join:coupon_id=id" json:"coupon,omitempty"`
+}
+
+// Device is a device a user signed in from, for one session of refresh
+// tokens. Platform is the operating system told by its UserAgent, and
+// LastSeenAt when the session last exchanged a refresh token. Current marks
+// the device of the request listing devices.
+type Device struct {
+	bun.BaseModel `bun:"table:devices,alias:dv"`
+
+	ID         int64     `bun:"id,pk,autoincrement" json:"id"`
+	UserID     int64     `bun:"user_id,notnull" json:"-"`
+	SessionID  string    `bun:"session_id,notnull,unique" json:"-"`
+	UserAgent  string    `bun:"user_agent,nullzero" json:"user_agent,omitempty"`
+	Platform   string    `bun:"platform,notnull" json:"platform"`
+	Current    bool      `bun:"-" json:"current"`
+	CreatedAt  time.Time `bun:"created_at,notnull,default:current_timestamp" json:"created_at"`
+	LastSeenAt time.Time `bun:"last_seen_at,notnull,default:current_timestamp" json:"last_seen_at"`
+}
+
+// LoginAttempt counts the failed password logins in a row for an email
+// address or from an IP address, keyed "email:" or "ip:" followed by it.
+// LockedUntil is when the account of an email address that failed too often
+// unlocks.
+type LoginAttempt struct {
+	bun.BaseModel `bun:"table:login_attempts,alias:la"`
+
+	Key          string    `bun:"key,pk" json:"key"`
+	Failures     int       `bun:"failures,notnull" json:"failures"`
+	LastFailedAt time.Time `bun:"last_failed_at,notnull" json:"last_failed_at"`
+	LockedUntil  time.Time `bun:"locked_until,nullzero" json:"locked_until,omitempty"`
+}
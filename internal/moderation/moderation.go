@@ -0,0 +1,89 @@
+// Package moderation screens user-generated text. Wordlists catch known
+// profanity and spam phrases locally; an external moderation API, selected
+// by configuration, classifies everything else.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+// Provider types accepted in configuration
+const (
+	TypeOpenAI  = "openai"
+	TypeWebhook = "webhook"
+)
+
+// Result is a provider's classification of a text. Categories lists what the
+// text was flagged for, e.g. harassment or spam.
+type Result struct {
+	Flagged    bool
+	Categories []string
+}
+
+// Provider classifies text with an external moderation API
+type Provider interface {
+	Moderate(ctx context.Context, text string) (Result, error)
+}
+
+// NewProvider builds the configured provider, or returns nil when no provider
+// is configured and text is screened with the wordlists alone
+func NewProvider(cfg config.ModerationConfig) (Provider, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	client := tracecontext.NewClient(&http.Client{Timeout: timeout})
+
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case TypeOpenAI:
+		return NewOpenAI(cfg, client), nil
+	case TypeWebhook:
+		return NewWebhook(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("unknown moderation provider %q", cfg.Provider)
+	}
+}
+
+// post sends body as JSON to url and decodes the JSON response into result
+func post(ctx context.Context, client *http.Client, url, apiKey string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode moderation request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build moderation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request moderation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("moderation request failed with %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode moderation result: %w", err)
+	}
+	return nil
+}
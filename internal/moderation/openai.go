@@ -0,0 +1,63 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/ndn/internal/config"
+)
+
+const defaultOpenAIURL = "https://api.openai.com/v1"
+
+// OpenAI calls an OpenAI-compatible /moderations endpoint
+type OpenAI struct {
+	url    string
+	apiKey string
+	model  string
+	client *http.Client
+}
+
+func NewOpenAI(cfg config.ModerationConfig, client *http.Client) *OpenAI {
+	url := strings.TrimSuffix(cfg.URL, "/")
+	if url == "" {
+		url = defaultOpenAIURL
+	}
+	return &OpenAI{
+		url:    url,
+		apiKey: cfg.APIKey,
+		model:  cfg.Model,
+		client: client,
+	}
+}
+
+func (o *OpenAI) Moderate(ctx context.Context, text string) (Result, error) {
+	body := map[string]interface{}{"input": text}
+	if o.model != "" {
+		body["model"] = o.model
+	}
+
+	var resp struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := post(ctx, o.client, o.url+"/moderations", o.apiKey, body, &resp); err != nil {
+		return Result{}, err
+	}
+	if len(resp.Results) == 0 {
+		return Result{}, errors.New("moderation provider returned no result")
+	}
+
+	result := Result{Flagged: resp.Results[0].Flagged}
+	for category, flagged := range resp.Results[0].Categories {
+		if flagged {
+			result.Categories = append(result.Categories, category)
+		}
+	}
+	sort.Strings(result.Categories)
+	return result, nil
+}
@@ -0,0 +1,36 @@
+package moderation
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ndn/internal/config"
+)
+
+// Webhook posts {"text": "..."} to a moderation service of our own, which
+// answers {"flagged": true, "categories": ["spam"]}. The API key, if any, is
+// sent as a bearer token.
+type Webhook struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+func NewWebhook(cfg config.ModerationConfig, client *http.Client) *Webhook {
+	return &Webhook{
+		url:    cfg.URL,
+		apiKey: cfg.APIKey,
+		client: client,
+	}
+}
+
+func (w *Webhook) Moderate(ctx context.Context, text string) (Result, error) {
+	var resp struct {
+		Flagged    bool     `json:"flagged"`
+		Categories []string `json:"categories"`
+	}
+	if err := post(ctx, w.client, w.url, w.apiKey, map[string]string{"text": text}, &resp); err != nil {
+		return Result{}, err
+	}
+	return Result{Flagged: resp.Flagged, Categories: resp.Categories}, nil
+}
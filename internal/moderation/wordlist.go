@@ -0,0 +1,75 @@
+package moderation
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// leet undoes the character substitutions commonly used to slip words past
+// filters, e.g. "h4t3" for "hate"
+var leet = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "@", "a", "$", "s",
+)
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)`)
+
+// Wordlist matches words and phrases in text as whole words, ignoring case,
+// punctuation and leetspeak substitutions
+type Wordlist struct {
+	entries map[string][][]string // keyed by their first word
+}
+
+func NewWordlist(words []string) *Wordlist {
+	w := &Wordlist{entries: make(map[string][][]string)}
+	for _, word := range words {
+		if tokens := tokenize(word); len(tokens) > 0 {
+			w.entries[tokens[0]] = append(w.entries[tokens[0]], tokens)
+		}
+	}
+	return w
+}
+
+// Match returns the entries of the wordlist found in text, each once, in the
+// order they first appear
+func (w *Wordlist) Match(text string) []string {
+	if len(w.entries) == 0 {
+		return nil
+	}
+
+	var matches []string
+	seen := make(map[string]bool)
+	tokens := tokenize(text)
+	for i, token := range tokens {
+		for _, entry := range w.entries[token] {
+			if i+len(entry) > len(tokens) || !equalTokens(tokens[i:i+len(entry)], entry) {
+				continue
+			}
+			if phrase := strings.Join(entry, " "); !seen[phrase] {
+				seen[phrase] = true
+				matches = append(matches, phrase)
+			}
+		}
+	}
+	return matches
+}
+
+// CountLinks returns how many web links text contains
+func CountLinks(text string) int {
+	return len(linkPattern.FindAllStringIndex(text, -1))
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(leet.Replace(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+}
+
+func equalTokens(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
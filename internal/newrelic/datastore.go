@@ -0,0 +1,48 @@
+package newrelic
+
+import (
+	"context"
+	"strings"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+	"github.com/uptrace/bun"
+)
+
+// InstrumentDB records a datastore segment on the New Relic transaction of
+// the context of each query run through db. Queries run outside of a
+// transaction are not recorded.
+func InstrumentDB(app *newrelic.Application, db *bun.DB) {
+	if app == nil {
+		return
+	}
+	db.AddQueryHook(queryHook{})
+}
+
+type segmentKey struct{}
+
+// queryHook is a bun.QueryHook timing queries as datastore segments
+type queryHook struct{}
+
+func (queryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	txn := newrelic.FromContext(ctx)
+	if txn == nil {
+		return ctx
+	}
+
+	segment := &newrelic.DatastoreSegment{
+		StartTime:          txn.StartSegmentNow(),
+		Product:            newrelic.DatastorePostgres,
+		Operation:          strings.ToUpper(event.Operation()),
+		ParameterizedQuery: event.Query,
+	}
+	if event.IQuery != nil {
+		segment.Collection = strings.Trim(event.IQuery.GetTableName(), `"`)
+	}
+	return context.WithValue(ctx, segmentKey{}, segment)
+}
+
+func (queryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	if segment, ok := ctx.Value(segmentKey{}).(*newrelic.DatastoreSegment); ok {
+		segment.End()
+	}
+}
@@ -1,12 +1,22 @@
+// Package newrelic instruments the API with New Relic APM: a transaction per
+// request, named after its route and carrying the request and user IDs, and
+// a datastore segment per query run within it.
 package newrelic
 
 import (
+	"bufio"
 	"github.com/ndn/internal/config"
+	"net"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/newrelic/go-agent/v3/newrelic"
 )
 
+// NewNewRelicApp connects to New Relic when enabled in configuration. It
+// returns a nil application otherwise, which the middleware and hooks of
+// this package accept.
 func NewNewRelicApp(cfg *config.Config) (*newrelic.Application, error) {
 	if !cfg.NewRelic.Enabled {
 		return nil, nil
@@ -25,7 +35,9 @@ func NewNewRelicApp(cfg *config.Config) (*newrelic.Application, error) {
 	return app, nil
 }
 
-// Middleware creates a Chi middleware for New Relic instrumentation
+// Middleware records a web transaction for each request, named after its
+// method and route pattern (e.g. GET /api/movies/{id}) once routed, with the
+// request ID as an attribute; AuthMiddleware adds the user ID. It must come after middleware.RequestID.
 func Middleware(app *newrelic.Application) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,14 +46,47 @@ func Middleware(app *newrelic.Application) func(next http.Handler) http.Handler
 				return
 			}
 
-			txn := app.StartTransaction(r.URL.Path)
+			txn := app.StartTransaction(r.Method + " " + r.URL.Path)
 			defer txn.End()
 
-			w = txn.SetWebResponse(w)
+			w = &responseWriter{ResponseWriter: txn.SetWebResponse(w), original: w}
 			txn.SetWebRequestHTTP(r)
+			txn.AddAttribute("request_id", middleware.GetReqID(r.Context()))
 			r = newrelic.RequestWithTransactionContext(r, txn)
 
 			next.ServeHTTP(w, r)
+
+			// Requests no route matched share a name, keeping names few
+			name := r.Method + " (unmatched)"
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				name = r.Method + " " + rctx.RoutePattern()
+			}
+			txn.SetName(name)
 		})
 	}
 }
+
+// responseWriter is the writer New Relic wraps responses in, recording their
+// status, made to unwrap to the writer it wraps. New Relic's own does not,
+// so http.ResponseController could not set deadlines through it, and streams
+// outlasting the server's write timeout were cut off.
+type responseWriter struct {
+	http.ResponseWriter
+	original http.ResponseWriter
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.original
+}
+
+func (w *responseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *responseWriter) FlushError() error {
+	return http.NewResponseController(w.original).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.original).Hijack()
+}
@@ -0,0 +1,105 @@
+package newrelic
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/newrelic/go-agent/v3/newrelic"
+)
+
+func newTestApp(t *testing.T) *newrelic.Application {
+	t.Helper()
+	app, err := newrelic.NewApplication(
+		newrelic.ConfigAppName("ndn-test"),
+		newrelic.ConfigLicense(strings.Repeat("0", 40)),
+		newrelic.ConfigEnabled(false),
+	)
+	if err != nil {
+		t.Fatalf("NewApplication: %v", err)
+	}
+	t.Cleanup(func() { app.Shutdown(time.Second) })
+	return app
+}
+
+func TestMiddlewareKeepsResponseController(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(rc *http.ResponseController) error
+	}{
+		{"SetWriteDeadline", func(rc *http.ResponseController) error {
+			return rc.SetWriteDeadline(time.Now().Add(time.Minute))
+		}},
+		{"SetReadDeadline", func(rc *http.ResponseController) error {
+			return rc.SetReadDeadline(time.Now().Add(time.Minute))
+		}},
+		{"Flush", func(rc *http.ResponseController) error {
+			return rc.Flush()
+		}},
+	}
+
+	app := newTestApp(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			handler := Middleware(app)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				errs <- tt.call(http.NewResponseController(w))
+			}))
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("GET: %v", err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if err := <-errs; err != nil {
+				t.Errorf("%s through the middleware: %v", tt.name, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewareStreamsPastWriteTimeout(t *testing.T) {
+	const writeTimeout = 100 * time.Millisecond
+
+	app := newTestApp(t)
+	handler := Middleware(app)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		for i := 0; i < 3; i++ {
+			if err := rc.SetWriteDeadline(time.Now().Add(time.Second)); err != nil {
+				t.Errorf("SetWriteDeadline: %v", err)
+				return
+			}
+			io.WriteString(w, "tick\n")
+			if err := rc.Flush(); err != nil {
+				t.Errorf("Flush: %v", err)
+				return
+			}
+			time.Sleep(writeTimeout)
+		}
+	}))
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("reading stream: %v", err)
+	}
+	if got := strings.Count(string(body), "tick"); got != 3 {
+		t.Errorf("got %d ticks before the stream ended, want 3", got)
+	}
+}
@@ -0,0 +1,103 @@
+package notifications
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// sendBuffer is how many events may queue for a client before it is
+	// disconnected for being too slow
+	sendBuffer = 32
+	// maxMessageSize bounds messages read from clients
+	maxMessageSize = 4096
+	writeWait      = 10 * time.Second
+)
+
+// client is a connection of an authenticated user
+type client struct {
+	conn     *websocket.Conn
+	userID   int64
+	admin    bool
+	messages chan []byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// send queues message for the client, disconnecting it when its queue is
+// full
+func (c *client) send(message []byte) {
+	select {
+	case c.messages <- message:
+	default:
+		c.close()
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Serve delivers the events for a user to conn, which they authenticated,
+// until either side closes it or the hub stops. Clients are pinged every
+// PingInterval and disconnected when they stop answering.
+func (h *Hub) Serve(conn *websocket.Conn, userID int64, admin bool) {
+	c := &client{
+		conn:     conn,
+		userID:   userID,
+		admin:    admin,
+		messages: make(chan []byte, sendBuffer),
+		done:     make(chan struct{}),
+	}
+	h.register(c)
+	defer h.unregister(c)
+	defer conn.Close()
+
+	go c.read(h.cfg.PingInterval + writeWait)
+	c.write(h.cfg.PingInterval)
+}
+
+// read discards what the client sends, which is only needed to process
+// pongs and close frames, and closes the client once the connection fails
+// or pongWait passes without a pong
+func (c *client) read(pongWait time.Duration) {
+	defer c.close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	for {
+		if _, _, err := c.conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// write sends queued events and pings until the client is closed
+func (c *client) write(pingInterval time.Duration) {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, ""), time.Now().Add(writeWait))
+			return
+		case message := <-c.messages:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
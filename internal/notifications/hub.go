@@ -0,0 +1,221 @@
+// Package notifications pushes events, such as new movies, finished
+// transcoding jobs and data exports, to clients connected over WebSocket.
+// Events are published with PostgreSQL NOTIFY, so every instance of the API
+// delivers them to the clients connected to it, and events published in a
+// transaction are only sent once it commits.
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/ndn/internal/config"
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// Event types
+const (
+	EventMovieAdded   = "movie.added"
+	EventVideoReady   = "video.ready"
+	EventVideoFailed  = "video.failed"
+	EventExportReady  = "export.ready"
+	EventExportFailed = "export.failed"
+	EventAnnouncement = "announcement"
+)
+
+const (
+	// channel is the PostgreSQL channel events are published on
+	channel = "ndn_notifications"
+	// maxPayloadSize keeps events under the 8000 byte limit of NOTIFY
+	maxPayloadSize = 7900
+
+	defaultAuthTimeout  = 10 * time.Second
+	defaultPingInterval = 30 * time.Second
+)
+
+var ErrEventTooLarge = errors.New("notification is too large")
+
+// Event is a notification as clients receive it
+type Event struct {
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	SentAt time.Time       `json:"sent_at"`
+}
+
+// Audience selects the clients an event is delivered to: everyone by
+// default, only admins, or only one user
+type Audience struct {
+	Admins bool  `json:"admins,omitempty"`
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+var (
+	Everyone = Audience{}
+	Admins   = Audience{Admins: true}
+)
+
+// User is the audience of events for a single user
+func User(id int64) Audience {
+	return Audience{UserID: id}
+}
+
+func (a Audience) includes(c *client) bool {
+	if a.UserID != 0 && a.UserID != c.userID {
+		return false
+	}
+	return !a.Admins || c.admin
+}
+
+// envelope is an event as published on the channel
+type envelope struct {
+	Audience Audience `json:"audience"`
+	Event    Event    `json:"event"`
+}
+
+// Hub tracks the clients connected to this instance and delivers the
+// events published by any instance to them
+type Hub struct {
+	db     *bun.DB
+	dsn    string
+	cfg    config.NotificationsConfig
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+}
+
+// NewHub publishes events through db and listens for them on a connection
+// of its own to dsn
+func NewHub(db *bun.DB, dsn string, cfg config.NotificationsConfig, logger *zap.Logger) *Hub {
+	if cfg.AuthTimeout <= 0 {
+		cfg.AuthTimeout = defaultAuthTimeout
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = defaultPingInterval
+	}
+
+	return &Hub{
+		db:      db,
+		dsn:     dsn,
+		cfg:     cfg,
+		logger:  logger,
+		now:     time.Now,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+// AuthTimeout is how long clients have to authenticate after connecting
+func (h *Hub) AuthTimeout() time.Duration {
+	return h.cfg.AuthTimeout
+}
+
+// Publish sends an event of type eventType with data to audience
+func (h *Hub) Publish(ctx context.Context, audience Audience, eventType string, data any) error {
+	return h.PublishTx(ctx, h.db, audience, eventType, data)
+}
+
+// PublishTx is Publish within the transaction tx, sending the event only
+// once tx commits
+func (h *Hub) PublishTx(ctx context.Context, tx bun.IDB, audience Audience, eventType string, data any) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	payload, err := json.Marshal(envelope{
+		Audience: audience,
+		Event:    Event{Type: eventType, Data: raw, SentAt: h.now()},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	if len(payload) > maxPayloadSize {
+		return ErrEventTooLarge
+	}
+
+	_, err = tx.ExecContext(ctx, "SELECT pg_notify(?, ?)", channel, string(payload))
+	return err
+}
+
+// Run listens for published events and delivers them until ctx is done,
+// then disconnects every client
+func (h *Hub) Run(ctx context.Context) {
+	listener := pq.NewListener(h.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			h.logger.Warn("notifications listener disconnected", zap.Error(err))
+		case pq.ListenerEventReconnected:
+			h.logger.Info("notifications listener reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			h.logger.Warn("notifications listener failed to connect", zap.Error(err))
+		}
+	})
+	defer listener.Close()
+	defer h.closeAll()
+
+	// Listen blocks until connected, so wait for it in the background
+	go func() {
+		if err := listener.Listen(channel); err != nil && ctx.Err() == nil {
+			h.logger.Error("failed to listen for notifications", zap.Error(err))
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// n is nil after reconnecting, when events may have been missed
+			if n != nil {
+				h.deliver(n.Extra)
+			}
+		}
+	}
+}
+
+func (h *Hub) deliver(payload string) {
+	var env envelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil {
+		h.logger.Warn("ignoring malformed notification", zap.Error(err))
+		return
+	}
+	message, err := json.Marshal(env.Event)
+	if err != nil {
+		h.logger.Warn("ignoring malformed notification", zap.Error(err))
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		if env.Audience.includes(c) {
+			c.send(message)
+		}
+	}
+}
+
+func (h *Hub) register(c *client) {
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+}
+
+func (h *Hub) unregister(c *client) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+func (h *Hub) closeAll() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.clients {
+		c.close()
+	}
+}
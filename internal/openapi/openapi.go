@@ -0,0 +1,369 @@
+// Package openapi builds an OpenAPI 3 document from the routes registered on
+// a chi router. Paths, methods and authentication requirements come from the
+// router itself; request and response types are bound to handlers with
+// Describe, so the served spec always matches what is actually mounted.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ndn/internal/apierror"
+)
+
+// Param documents a query parameter
+type Param struct {
+	Name        string
+	Type        string // string, integer, number, boolean or array
+	Description string
+	Required    bool
+}
+
+// Operation describes a handler. Request and Response are example values
+// whose types are reflected into JSON schemas; either may be nil.
+type Operation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	Query       []Param
+	Request     interface{}
+	RequestType string // media type of Request, defaults to application/json
+	Response    interface{}
+	Status      int // success status, defaults to 200
+	Deprecated  bool
+}
+
+// Generator collects operation bindings and builds the document on demand
+type Generator struct {
+	mu         sync.Mutex
+	title      string
+	version    string
+	ops        map[uintptr]Operation
+	secure     map[uintptr]string
+	deprecated map[uintptr]bool
+}
+
+func NewGenerator(title, version string) *Generator {
+	return &Generator{
+		title:      title,
+		version:    version,
+		ops:        make(map[uintptr]Operation),
+		secure:     make(map[uintptr]string),
+		deprecated: make(map[uintptr]bool),
+	}
+}
+
+// Describe binds op to handler. Handlers are matched by function identity, so
+// pass the same method value that is registered on the router.
+func (g *Generator) Describe(handler http.HandlerFunc, op Operation) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ops[funcID(handler)] = op
+}
+
+// Secure marks routes behind mw as requiring the given security scheme, e.g.
+// the bearer-token authentication middleware. note is added to the
+// description of those routes, for instance to say admin access is needed.
+func (g *Generator) Secure(mw func(http.Handler) http.Handler, note string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.secure[funcID(mw)] = note
+}
+
+// Deprecated marks routes behind mw as deprecated. Middlewares returned by
+// the same function share an identity, so one instance covers them all.
+func (g *Generator) Deprecated(mw func(http.Handler) http.Handler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.deprecated[funcID(mw)] = true
+}
+
+// Handler generates the document from routes and returns a handler serving
+// it as JSON. Call it once every route has been registered, typically at the
+// end of router setup, so the document reflects the complete router.
+func (g *Generator) Handler(routes chi.Routes) (http.HandlerFunc, error) {
+	doc, err := g.Generate(routes)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}, nil
+}
+
+// Generate walks routes and returns the OpenAPI document
+func (g *Generator) Generate(routes chi.Routes) (map[string]interface{}, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	schemas := newSchemaSet()
+	paths := make(map[string]map[string]interface{})
+
+	err := walk(routes, "", nil, func(method, route string, handler http.Handler, middlewares []func(http.Handler) http.Handler) error {
+		path, params := convertPath(route)
+		if strings.Contains(path, "*") {
+			// Catch-all routes such as the Swagger UI are not API operations
+			return nil
+		}
+
+		op, described := g.ops[handlerID(handler)]
+		operation := map[string]interface{}{
+			"operationId": operationID(handler, method, path),
+			"responses":   map[string]interface{}{},
+		}
+
+		summary := op.Summary
+		if summary == "" {
+			summary = humanize(handlerName(handler))
+		}
+		operation["summary"] = summary
+		if len(op.Tags) > 0 {
+			operation["tags"] = op.Tags
+		} else if tag := firstSegment(path); tag != "" {
+			operation["tags"] = []string{tag}
+		}
+		if op.Deprecated {
+			operation["deprecated"] = true
+		}
+
+		description := op.Description
+		for _, mw := range middlewares {
+			if g.deprecated[funcID(mw)] {
+				operation["deprecated"] = true
+			}
+			note, ok := g.secure[funcID(mw)]
+			if !ok {
+				continue
+			}
+			operation["security"] = []map[string][]string{{"BearerAuth": {}}}
+			if note != "" {
+				description = strings.TrimSpace(description + " " + note)
+			}
+		}
+		if description != "" {
+			operation["description"] = description
+		}
+
+		var parameters []map[string]interface{}
+		for _, name := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]string{"type": "string"},
+			})
+		}
+		for _, q := range op.Query {
+			schema := map[string]interface{}{"type": q.Type}
+			if q.Type == "array" {
+				schema["items"] = map[string]string{"type": "string"}
+			}
+			parameters = append(parameters, map[string]interface{}{
+				"name":        q.Name,
+				"in":          "query",
+				"required":    q.Required,
+				"description": q.Description,
+				"schema":      schema,
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if described && op.Request != nil {
+			mediaType := op.RequestType
+			if mediaType == "" {
+				mediaType = "application/json"
+			}
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					mediaType: map[string]interface{}{"schema": schemas.of(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if described && op.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.of(reflect.TypeOf(op.Response))},
+			}
+		}
+		responses := operation["responses"].(map[string]interface{})
+		responses[strconv.Itoa(status)] = success
+		responses["default"] = map[string]interface{}{
+			"description": "Error",
+			"content": map[string]interface{}{
+				apierror.ContentType: map[string]interface{}{"schema": schemas.of(reflect.TypeOf(apierror.Problem{}))},
+			},
+		}
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(method)] = operation
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   g.title,
+			"version": g.version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas.defs,
+			"securitySchemes": map[string]interface{}{
+				"BearerAuth": map[string]string{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}, nil
+}
+
+type walkFunc func(method, route string, handler http.Handler, middlewares []func(http.Handler) http.Handler) error
+
+// walk visits every endpoint like chi.Walk, but also collects middlewares
+// that inline groups (r.Group, r.With) apply to mounted sub-routers, which
+// chi.Walk drops. Without them, routes such as /users/* inside an
+// authenticated group would not be marked as secured.
+func walk(r chi.Routes, prefix string, parent []func(http.Handler) http.Handler, fn walkFunc) error {
+	for _, route := range r.Routes() {
+		mws := append(append([]func(http.Handler) http.Handler{}, parent...), r.Middlewares()...)
+		pattern := strings.Replace(prefix+route.Pattern, "/*/", "/", -1)
+
+		if route.SubRoutes != nil {
+			for _, h := range route.Handlers {
+				if chain, ok := h.(*chi.ChainHandler); ok {
+					mws = append(mws, chain.Middlewares...)
+				}
+				break
+			}
+			if err := walk(route.SubRoutes, strings.TrimSuffix(pattern, "/*"), mws, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for method, handler := range route.Handlers {
+			if method == "*" {
+				continue
+			}
+			endpointMws := mws
+			if chain, ok := handler.(*chi.ChainHandler); ok {
+				handler = chain.Endpoint
+				endpointMws = append(append([]func(http.Handler) http.Handler{}, mws...), chain.Middlewares...)
+			}
+			if err := fn(method, pattern, handler, endpointMws); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var paramPattern = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// convertPath turns a chi pattern into an OpenAPI path, dropping regexp
+// constraints and trailing slashes, and returns its parameter names
+func convertPath(route string) (string, []string) {
+	var params []string
+	path := paramPattern.ReplaceAllStringFunc(route, func(m string) string {
+		name := paramPattern.FindStringSubmatch(m)[1]
+		params = append(params, name)
+		return "{" + name + "}"
+	})
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path, params
+}
+
+// handlerID identifies the function behind a routed handler
+func handlerID(h http.Handler) uintptr {
+	if hf, ok := h.(http.HandlerFunc); ok {
+		return funcID(hf)
+	}
+	return 0
+}
+
+func funcID(fn interface{}) uintptr {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return 0
+	}
+	return v.Pointer()
+}
+
+// handlerName returns the method name of a handler, e.g. "GetMovie"
+func handlerName(h http.Handler) string {
+	id := handlerID(h)
+	if id == 0 {
+		return ""
+	}
+	fn := runtime.FuncForPC(id)
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	return strings.TrimSuffix(name, "-fm")
+}
+
+func operationID(h http.Handler, method, path string) string {
+	if name := handlerName(h); name != "" && !strings.HasPrefix(name, "func") {
+		return name
+	}
+	return strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path)
+}
+
+var upperRun = regexp.MustCompile(`([a-z0-9])([A-Z])`)
+
+// humanize turns "GetTopRatedMovies" into "Get top rated movies"
+func humanize(name string) string {
+	if name == "" || strings.HasPrefix(name, "func") {
+		return ""
+	}
+	spaced := strings.ToLower(upperRun.ReplaceAllString(name, "$1 $2"))
+	return strings.ToUpper(spaced[:1]) + spaced[1:]
+}
+
+// firstSegment returns the resource a path belongs to, skipping the /api and
+// /admin prefixes, e.g. "movies" for /api/admin/movies/{id}
+func firstSegment(path string) string {
+	for _, seg := range strings.Split(path, "/") {
+		switch seg {
+		case "", "api", "admin":
+			continue
+		}
+		if strings.HasPrefix(seg, "{") {
+			return ""
+		}
+		return seg
+	}
+	return ""
+}
@@ -0,0 +1,121 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	bytesType      = reflect.TypeOf([]byte(nil))
+)
+
+// schemaSet reflects Go types into JSON schemas, registering named structs as
+// reusable components
+type schemaSet struct {
+	defs map[string]interface{}
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{defs: make(map[string]interface{})}
+}
+
+func (s *schemaSet) of(t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return map[string]string{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]interface{}{}
+	case bytesType:
+		// Byte fields only appear in file uploads
+		return map[string]string{"type": "string", "format": "binary"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]string{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]string{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]string{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]string{"type": "number"}
+	case reflect.String:
+		return map[string]string{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		name := schemaName(t)
+		if _, ok := s.defs[name]; !ok {
+			// Reserve the name first so recursive types terminate
+			s.defs[name] = map[string]interface{}{}
+			s.defs[name] = s.object(t)
+		}
+		return map[string]string{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func (s *schemaSet) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	s.addFields(t, properties)
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+func (s *schemaSet) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name are flattened like encoding/json does
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				s.addFields(ft, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = s.of(field.Type)
+	}
+}
+
+// schemaName qualifies a type name with its package, e.g. handlers.MovieResponse
+func schemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if pkg == "" {
+		return t.Name()
+	}
+	return pkg + "." + t.Name()
+}
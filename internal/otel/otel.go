@@ -0,0 +1,142 @@
+// Package otel traces requests and database queries with OpenTelemetry and
+// exports the spans over OTLP, so traces can go to Jaeger, Tempo or any
+// other OTLP collector instead of, or as well as, New Relic.
+package otel
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/extra/bunotel"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	gootel "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing records spans when enabled in configuration. When disabled, its
+// middleware and hooks do nothing.
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+}
+
+// New starts exporting spans to the configured OTLP endpoint and installs
+// the tracer provider and W3C trace context propagation globally
+func New(ctx context.Context, cfg config.OTelConfig) (*Tracing, error) {
+	if !cfg.Enabled {
+		return &Tracing{}, nil
+	}
+
+	var client otlptrace.Client
+	switch cfg.Protocol {
+	case "", "grpc":
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint), otlptracegrpc.WithHeaders(cfg.Headers)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		client = otlptracegrpc.NewClient(opts...)
+	case "http":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint), otlptracehttp.WithHeaders(cfg.Headers)}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		client = otlptracehttp.NewClient(opts...)
+	default:
+		return nil, fmt.Errorf("unknown otel protocol %q", cfg.Protocol)
+	}
+
+	exporter, err := otlptrace.New(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create otlp exporter: %w", err)
+	}
+
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = "ndn-api"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe otel resource: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+
+	gootel.SetTracerProvider(provider)
+	gootel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return &Tracing{provider: provider}, nil
+}
+
+// Enabled reports whether spans are recorded
+func (t *Tracing) Enabled() bool {
+	return t.provider != nil
+}
+
+// Middleware records a server span for each request, continuing the trace
+// of the caller if any. Spans are named after the chi route pattern, e.g.
+// GET /api/movies/{id}. The span also becomes the request's trace context,
+// so logs and outbound calls carry its IDs.
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	if !t.Enabled() {
+		return next
+	}
+
+	traced := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := trace.SpanContextFromContext(r.Context())
+		if sc.IsValid() {
+			r = r.WithContext(tracecontext.NewContext(r.Context(), tracecontext.TraceContext{
+				TraceID:    sc.TraceID(),
+				SpanID:     sc.SpanID(),
+				Flags:      byte(sc.TraceFlags()),
+				TraceState: sc.TraceState().String(),
+			}))
+		}
+
+		next.ServeHTTP(w, r)
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRoute(rctx.RoutePattern()))
+		}
+	})
+	return otelhttp.NewHandler(traced, "http.server", otelhttp.WithTracerProvider(t.provider))
+}
+
+// InstrumentDB records a span for each query run through db
+func (t *Tracing) InstrumentDB(db *bun.DB) {
+	if !t.Enabled() {
+		return
+	}
+	db.AddQueryHook(bunotel.NewQueryHook(bunotel.WithDBName("postgres")))
+}
+
+// Shutdown exports the spans still buffered and stops the exporter
+func (t *Tracing) Shutdown(ctx context.Context) error {
+	if !t.Enabled() {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
@@ -0,0 +1,300 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONPatchContentType is the media type of RFC 6902 JSON Patch bodies
+const JSONPatchContentType = "application/json-patch+json"
+
+// maxOperations caps the number of operations accepted in one patch
+const maxOperations = 100
+
+// Operation is a single RFC 6902 operation
+type Operation struct {
+	Op    string          `json:"op" example:"add"`
+	Path  string          `json:"path" example:"/categories/-"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty" swaggertype:"object"`
+}
+
+// OperationError reports which operation of a patch failed and why
+type OperationError struct {
+	Index int
+	Op    string
+	Err   string
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s): %s", e.Index, e.Op, e.Err)
+}
+
+// DecodeJSONPatch parses an RFC 6902 patch document
+func DecodeJSONPatch(body []byte) ([]Operation, error) {
+	var ops []Operation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, ErrInvalidPatch
+	}
+	if len(ops) > maxOperations {
+		return nil, fmt.Errorf("%w: at most %d operations are allowed", ErrInvalidPatch, maxOperations)
+	}
+	return ops, nil
+}
+
+// ApplyJSONPatch applies ops to doc in order. The patch is atomic: if any
+// operation fails, an *OperationError is returned and doc is not modified.
+func ApplyJSONPatch(doc []byte, ops []Operation) ([]byte, error) {
+	var root interface{}
+	if err := json.Unmarshal(doc, &root); err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		var err error
+		root, err = apply(root, op)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.Op, Err: err.Error()}
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func apply(root interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("value is required")
+		}
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value")
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if _, err := get(root, path); err != nil {
+				return nil, err
+			}
+			if root, err = remove(root, path); err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("test failed at %q", op.Path)
+			}
+			return root, nil
+		}
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("cannot move a value into one of its children")
+			}
+			if root, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+		return add(root, path, value)
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path member %q not found", token)
+			}
+			node = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path member %q not found", token)
+		}
+	}
+	return node, nil
+}
+
+// add inserts value at path and returns the (possibly replaced) root
+func add(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+		return root, nil
+	case []interface{}:
+		i := len(p)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(p)); err != nil {
+				return nil, err
+			}
+		}
+		grown := append(p, nil)
+		copy(grown[i+1:], grown[i:])
+		grown[i] = value
+		return replaceAt(root, path[:len(path)-1], grown)
+	default:
+		return nil, fmt.Errorf("cannot add to a non-container at %q", last)
+	}
+}
+
+// remove deletes the value at path and returns the (possibly replaced) root
+func remove(root interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the whole document")
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := p[last]; !ok {
+			return nil, fmt.Errorf("path member %q not found", last)
+		}
+		delete(p, last)
+		return root, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		shrunk := append(p[:i:i], p[i+1:]...)
+		return replaceAt(root, path[:len(path)-1], shrunk)
+	default:
+		return nil, fmt.Errorf("path member %q not found", last)
+	}
+}
+
+// replaceAt stores value at path. Arrays change identity when resized, so
+// their parent has to be updated to point at the new slice.
+func replaceAt(root interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[last] = value
+	case []interface{}:
+		i, err := arrayIndex(last, len(p)-1)
+		if err != nil {
+			return nil, err
+		}
+		p[i] = value
+	}
+	return root, nil
+}
+
+// arrayIndex parses token as an index in [0, max]
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return 0, fmt.Errorf("array index %q out of range", token)
+	}
+	return i, nil
+}
+
+func isPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			c[k] = deepCopy(val)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, val := range t {
+			c[i] = deepCopy(val)
+		}
+		return c
+	default:
+		return v
+	}
+}
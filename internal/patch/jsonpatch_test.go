@@ -0,0 +1,121 @@
+package patch
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a":1}`, `[{"op":"add","path":"/b","value":2}]`, `{"a":1,"b":2}`},
+		{"add replaces member", `{"a":1}`, `[{"op":"add","path":"/a","value":[2]}]`, `{"a":[2]}`},
+		{"add to array", `{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2,3]}`},
+		{"append to array", `{"a":[1]}`, `[{"op":"add","path":"/a/-","value":2}]`, `{"a":[1,2]}`},
+		{"add at array end", `{"a":[1]}`, `[{"op":"add","path":"/a/1","value":2}]`, `{"a":[1,2]}`},
+		{"add nested", `{"a":{"b":[]}}`, `[{"op":"add","path":"/a/b/-","value":{"c":1}}]`, `{"a":{"b":[{"c":1}]}}`},
+		{"add whole document", `{"a":1}`, `[{"op":"add","path":"","value":{"b":2}}]`, `{"b":2}`},
+		{"remove member", `{"a":1,"b":2}`, `[{"op":"remove","path":"/a"}]`, `{"b":2}`},
+		{"remove from array", `{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/1"}]`, `{"a":[1,3]}`},
+		{"remove nested array item", `{"a":[[1,2]]}`, `[{"op":"remove","path":"/a/0/0"}]`, `{"a":[[2]]}`},
+		{"replace member", `{"a":1}`, `[{"op":"replace","path":"/a","value":"x"}]`, `{"a":"x"}`},
+		{"replace array item", `{"a":[1,2]}`, `[{"op":"replace","path":"/a/0","value":9}]`, `{"a":[9,2]}`},
+		{"replace whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+		{"move member", `{"a":{"b":1},"c":{}}`, `[{"op":"move","from":"/a/b","path":"/c/d"}]`, `{"a":{},"c":{"d":1}}`},
+		{"move array item", `{"a":[1,2,3]}`, `[{"op":"move","from":"/a/0","path":"/a/-"}]`, `{"a":[2,3,1]}`},
+		{"copy member", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`},
+		{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`},
+		{"test passes", `{"a":[1,{"b":"c"}]}`, `[{"op":"test","path":"/a","value":[1,{"b":"c"}]}]`, `{"a":[1,{"b":"c"}]}`},
+		{"test then replace", `{"a":1}`, `[{"op":"test","path":"/a","value":1},{"op":"replace","path":"/a","value":2}]`, `{"a":2}`},
+		{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`},
+		{"escaped tilde", `{"m~n":1}`, `[{"op":"remove","path":"/m~0n"}]`, `{}`},
+		{"escapes unescaped in order", `{}`, `[{"op":"add","path":"/~01","value":1}]`, `{"~1":1}`},
+		{"empty member name", `{"":1}`, `[{"op":"replace","path":"/","value":2}]`, `{"":2}`},
+		{"escaped from", `{"a/b":1}`, `[{"op":"move","from":"/a~1b","path":"/c~0d"}]`, `{"c~d":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodeJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("DecodeJSONPatch: %v", err)
+			}
+			got, err := ApplyJSONPatch([]byte(tt.doc), ops)
+			if err != nil {
+				t.Fatalf("ApplyJSONPatch: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		index int
+		err   string
+	}{
+		{"test fails", `{"a":1}`, `[{"op":"test","path":"/a","value":2}]`, 0, "test failed"},
+		{"test of missing member", `{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, 0, "not found"},
+		{"test fails after others", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/b","value":"2"}]`, 1, "test failed"},
+		{"remove missing member", `{"a":1}`, `[{"op":"remove","path":"/b"}]`, 0, "not found"},
+		{"remove whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, 0, "whole document"},
+		{"replace missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":1}]`, 0, "not found"},
+		{"add past array end", `{"a":[1]}`, `[{"op":"add","path":"/a/2","value":1}]`, 0, "out of range"},
+		{"leading zero index", `{"a":[1,2]}`, `[{"op":"remove","path":"/a/01"}]`, 0, "invalid array index"},
+		{"add to missing parent", `{}`, `[{"op":"add","path":"/a/b","value":1}]`, 0, "not found"},
+		{"move into child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, 0, "children"},
+		{"copy from missing", `{}`, `[{"op":"copy","from":"/a","path":"/b"}]`, 0, "not found"},
+		{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, 0, "value is required"},
+		{"path without slash", `{}`, `[{"op":"add","path":"a","value":1}]`, 0, "invalid path"},
+		{"unknown op", `{}`, `[{"op":"merge","path":"/a","value":1}]`, 0, "unsupported op"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops, err := DecodeJSONPatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("DecodeJSONPatch: %v", err)
+			}
+			got, err := ApplyJSONPatch([]byte(tt.doc), ops)
+			var opErr *OperationError
+			if !errors.As(err, &opErr) {
+				t.Fatalf("got %s, %v, want an *OperationError", got, err)
+			}
+			if opErr.Index != tt.index {
+				t.Errorf("operation %d failed, want %d", opErr.Index, tt.index)
+			}
+			if !strings.Contains(opErr.Err, tt.err) {
+				t.Errorf("got error %q, want one containing %q", opErr.Err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"not JSON", `[{"op":`},
+		{"not an array", `{"op":"add","path":"/a","value":1}`},
+		{"too many operations", "[" + strings.Repeat(`{"op":"test","path":"","value":1},`, maxOperations) + `{"op":"test","path":"","value":1}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeJSONPatch([]byte(tt.patch)); !errors.Is(err, ErrInvalidPatch) {
+				t.Errorf("got %v, want ErrInvalidPatch", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package patch
+
+import "encoding/json"
+
+// MergePatchContentType is the media type of RFC 7386 JSON Merge Patch bodies
+const MergePatchContentType = "application/merge-patch+json"
+
+// MergePatch applies an RFC 7386 merge patch to doc and returns the result.
+// Object members in patch replace those in doc, null members remove them and
+// any non-object patch replaces doc entirely.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, ErrInvalidPatch
+	}
+	if len(doc) > 0 {
+		if err := json.Unmarshal(doc, &target); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(mergeValue(target, p))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergeValue(targetObj[key], value)
+	}
+	return targetObj
+}
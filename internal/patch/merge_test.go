@@ -0,0 +1,67 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual reports whether a and b hold the same JSON value
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var va, vb interface{}
+	if err := json.Unmarshal(a, &va); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &vb); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func TestMergePatch(t *testing.T) {
+	// The examples of RFC 7386, appendix A
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"replace member", `{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"add member", `{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{"remove member", `{"a":"b"}`, `{"a":null}`, `{}`},
+		{"remove one of two", `{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{"replace array", `{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{"replace with array", `{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{"merge nested", `{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{"arrays are replaced whole", `{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{"array patch replaces doc", `["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{"object patch replaces array", `{"a":"b"}`, `["c"]`, `["c"]`},
+		{"null patch", `{"a":"foo"}`, `null`, `null`},
+		{"string patch", `{"a":"foo"}`, `"bar"`, `"bar"`},
+		{"null members of doc kept", `{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{"object patch on array", `[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{"nested null on missing", `{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{"empty doc", ``, `{"a":1}`, `{"a":1}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("MergePatch: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchInvalidPatch(t *testing.T) {
+	_, err := MergePatch([]byte(`{"a":1}`), []byte(`{"a":`))
+	if !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("got %v, want ErrInvalidPatch", err)
+	}
+}
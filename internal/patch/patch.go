@@ -0,0 +1,42 @@
+// Package patch applies partial updates to JSON documents, supporting JSON
+// Merge Patch (RFC 7386) and JSON Patch (RFC 6902)
+package patch
+
+import (
+	"errors"
+	"mime"
+)
+
+var (
+	ErrInvalidPatch     = errors.New("invalid patch document")
+	ErrUnsupportedPatch = errors.New("unsupported patch media type")
+)
+
+// Apply patches doc with body according to contentType, which must be one of
+// the media types listed in accepted
+func Apply(doc, body []byte, contentType string, accepted ...string) ([]byte, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	supported := false
+	for _, a := range accepted {
+		if a == mediaType {
+			supported = true
+		}
+	}
+	if !supported {
+		return nil, ErrUnsupportedPatch
+	}
+
+	switch mediaType {
+	case MergePatchContentType:
+		return MergePatch(doc, body)
+	case JSONPatchContentType:
+		ops, err := DecodeJSONPatch(body)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyJSONPatch(doc, ops)
+	default:
+		return nil, ErrUnsupportedPatch
+	}
+}
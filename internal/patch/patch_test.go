@@ -0,0 +1,72 @@
+package patch
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	doc := []byte(`{"title":"Alien","year":1979}`)
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		accepted    []string
+		want        string
+		err         error
+	}{
+		{
+			name:        "merge patch",
+			body:        `{"year":1980}`,
+			contentType: MergePatchContentType,
+			accepted:    []string{MergePatchContentType, JSONPatchContentType},
+			want:        `{"title":"Alien","year":1980}`,
+		},
+		{
+			name:        "JSON patch",
+			body:        `[{"op":"remove","path":"/year"}]`,
+			contentType: JSONPatchContentType,
+			accepted:    []string{MergePatchContentType, JSONPatchContentType},
+			want:        `{"title":"Alien"}`,
+		},
+		{
+			name:        "media type parameters",
+			body:        `{"year":null}`,
+			contentType: MergePatchContentType + "; charset=utf-8",
+			accepted:    []string{MergePatchContentType},
+			want:        `{"title":"Alien"}`,
+		},
+		{
+			name:        "media type not accepted",
+			body:        `[{"op":"remove","path":"/year"}]`,
+			contentType: JSONPatchContentType,
+			accepted:    []string{MergePatchContentType},
+			err:         ErrUnsupportedPatch,
+		},
+		{
+			name:        "plain JSON",
+			body:        `{"year":1980}`,
+			contentType: "application/json",
+			accepted:    []string{"application/json"},
+			err:         ErrUnsupportedPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(doc, []byte(tt.body), tt.contentType, tt.accepted...)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package playback
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// LocalScheme prefixes the video URLs of videos stored as local files, such
+// as "file:movies/matrix.mp4", whose path is relative to the directory
+// local videos are served from
+const LocalScheme = "file:"
+
+var ErrInvalidLocalPath = errors.New("invalid local video path")
+
+// IsLocal reports whether videoURL refers to a local file
+func IsLocal(videoURL string) bool {
+	return strings.HasPrefix(videoURL, LocalScheme)
+}
+
+// LocalPath returns the path of a local video URL, relative to the
+// directory of local videos. Absolute paths and paths leaving the directory
+// are rejected.
+func LocalPath(videoURL string) (string, error) {
+	name := strings.TrimPrefix(videoURL, LocalScheme)
+	if !IsLocal(videoURL) || name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return "", ErrInvalidLocalPath
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidLocalPath
+		}
+	}
+	return path.Clean(name), nil
+}
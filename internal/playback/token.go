@@ -0,0 +1,99 @@
+// Package playback signs and verifies the tokens of playback URLs. A token
+// grants access to the video of one movie until it expires, so video URLs
+// can be handed to players without exposing where videos are stored. It may
+// also cap the quality the video can be streamed in.
+package playback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMalformedToken = errors.New("malformed playback token")
+	ErrInvalidToken   = errors.New("playback token signature does not match")
+	ErrExpiredToken   = errors.New("playback token has expired")
+)
+
+// Grant is what a token grants access to: the video of MovieID, in HLS
+// renditions up to MaxHeight pixels tall, or any when it is zero
+type Grant struct {
+	MovieID   int64
+	MaxHeight int
+}
+
+// Compute returns the hex HMAC-SHA256 of "<movieID>.<expires>" under key,
+// expires being in Unix seconds. CDN edges verify tokens by recomputing it.
+func Compute(key []byte, movieID, expires int64) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(movieID, 10) + "." + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ComputeCapped returns the hex HMAC-SHA256 of
+// "<movieID>.<expires>.<maxHeight>" under key, the signature of tokens
+// capped to renditions up to maxHeight pixels tall
+func ComputeCapped(key []byte, movieID, expires int64, maxHeight int) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.FormatInt(movieID, 10) + "." + strconv.FormatInt(expires, 10) + "." + strconv.Itoa(maxHeight)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns a token for the video of movieID valid until expires, in the
+// form "<movieID>.<expires>.<signature>". Tokens are URL path safe.
+func Sign(key []byte, movieID int64, expires time.Time) string {
+	ts := expires.Unix()
+	return strconv.FormatInt(movieID, 10) + "." + strconv.FormatInt(ts, 10) + "." + Compute(key, movieID, ts)
+}
+
+// SignGrant returns a token for grant valid until expires. Grants of any
+// height get the tokens of Sign; capped ones are in the form
+// "<movieID>.<expires>.<maxHeight>.<signature>".
+func SignGrant(key []byte, grant Grant, expires time.Time) string {
+	if grant.MaxHeight <= 0 {
+		return Sign(key, grant.MovieID, expires)
+	}
+	ts := expires.Unix()
+	return strconv.FormatInt(grant.MovieID, 10) + "." + strconv.FormatInt(ts, 10) + "." +
+		strconv.Itoa(grant.MaxHeight) + "." + ComputeCapped(key, grant.MovieID, ts, grant.MaxHeight)
+}
+
+// Verify checks token against key and returns what it grants, unless it
+// expired before now
+func Verify(key []byte, token string, now time.Time) (Grant, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 && len(parts) != 4 {
+		return Grant{}, ErrMalformedToken
+	}
+	movieID, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Grant{}, ErrMalformedToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Grant{}, ErrMalformedToken
+	}
+
+	grant := Grant{MovieID: movieID}
+	expected := Compute(key, movieID, expires)
+	if len(parts) == 4 {
+		grant.MaxHeight, err = strconv.Atoi(parts[2])
+		if err != nil || grant.MaxHeight <= 0 {
+			return Grant{}, ErrMalformedToken
+		}
+		expected = ComputeCapped(key, movieID, expires, grant.MaxHeight)
+	}
+
+	if !hmac.Equal([]byte(parts[len(parts)-1]), []byte(expected)) {
+		return Grant{}, ErrInvalidToken
+	}
+	if now.Unix() >= expires {
+		return Grant{}, ErrExpiredToken
+	}
+	return grant, nil
+}
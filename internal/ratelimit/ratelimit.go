@@ -0,0 +1,179 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/services"
+)
+
+// DefaultGroup is the route group used when a group has no limit configured
+const DefaultGroup = "default"
+
+// PlanFunc resolves the subscription plan of the caller, used to scale limits
+type PlanFunc func(ctx context.Context) string
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	capacity float64
+}
+
+// Limiter applies token-bucket limits per route group and client
+type Limiter struct {
+	mu      sync.Mutex
+	cfg     config.RateLimitConfig
+	buckets map[string]*bucket
+	plan    PlanFunc
+	now     func() time.Time
+}
+
+func NewLimiter(cfg config.RateLimitConfig) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		buckets: make(map[string]*bucket),
+		plan:    func(context.Context) string { return "" },
+		now:     time.Now,
+	}
+}
+
+// SetPlanFunc installs the resolver used to apply per-plan multipliers
+func (l *Limiter) SetPlanFunc(fn PlanFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.plan = fn
+}
+
+// Run evicts idle buckets until ctx is cancelled
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.evict()
+		}
+	}
+}
+
+func (l *Limiter) evict() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > 10*time.Minute {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitFor returns the configured limit of a group, falling back to default
+func (l *Limiter) limitFor(group string) config.RateLimit {
+	if limit, ok := l.cfg.Groups[group]; ok {
+		return limit
+	}
+	return l.cfg.Default
+}
+
+// Allow takes a token for key in group and reports whether the request may
+// proceed, the limit applied, the remaining tokens and when to retry
+func (l *Limiter) Allow(ctx context.Context, group, key string) (bool, int, int, time.Duration) {
+	limit := l.limitFor(group)
+	if limit.Requests <= 0 || limit.Per <= 0 {
+		return true, 0, 0, 0
+	}
+
+	// The plan may take a query to resolve, so it is not done under the lock
+	l.mu.Lock()
+	planOf := l.plan
+	l.mu.Unlock()
+	plan := planOf(ctx)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	multiplier := 1.0
+	if m, ok := l.cfg.PlanMultipliers[plan]; ok && m > 0 {
+		multiplier = m
+	}
+
+	capacity := math.Max(1, math.Floor(float64(limit.Requests)*multiplier))
+	rate := capacity / limit.Per.Seconds()
+	now := l.now()
+
+	id := group + ":" + plan + ":" + key
+	b, ok := l.buckets[id]
+	if !ok || b.capacity != capacity {
+		b = &bucket{tokens: capacity, last: now, capacity: capacity}
+		l.buckets[id] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, int(capacity), 0, wait
+	}
+
+	b.tokens--
+	return true, int(capacity), int(b.tokens), 0
+}
+
+// Middleware limits requests in the given route group. Authenticated callers
+// are keyed by user ID, partner integrations by API key and everyone else by
+// client IP, so it must come after the middleware authenticating them for
+// per-user limits and plan multipliers to apply.
+func (l *Limiter) Middleware(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !l.cfg.Enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			allowed, limit, remaining, retryAfter := l.Allow(r.Context(), group, ClientKey(r))
+			if limit > 0 {
+				w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit))
+				w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+			}
+
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				apierror.Write(w, r, http.StatusTooManyRequests, "rate_limited")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientKey identifies the caller of r: the authenticated user, the partner API
+// key or, failing both, the client IP
+func ClientKey(r *http.Request) string {
+	if userID := services.UserIDFromContext(r.Context()); userID != 0 {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	if keyID := services.APIKeyIDFromContext(r.Context()); keyID != 0 {
+		return "key:" + strconv.FormatInt(keyID, 10)
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,229 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/services"
+	"github.com/ndn/internal/webhook"
+)
+
+const (
+	// TimestampHeader carries the unix time a request was created at
+	TimestampHeader = "X-Request-Timestamp"
+	// NonceHeader carries a client-chosen value unique to each request
+	NonceHeader = "X-Request-Nonce"
+	// SignatureHeader carries the signature of a request, see Sign
+	SignatureHeader = "X-Request-Signature"
+
+	maxNonceLength = 128
+	// maxSignedBody caps the size of the bodies of signed requests, which
+	// are read whole to be checked
+	maxSignedBody = 1 << 20
+)
+
+var (
+	ErrMissingNonce   = errors.New("missing request nonce")
+	ErrStaleTimestamp = errors.New("request timestamp outside the replay window")
+	ErrReplayed       = errors.New("request nonce already used")
+)
+
+// nonceKeyPrefix namespaces nonces in the shared cache
+const nonceKeyPrefix = "nonce:"
+
+// Store remembers nonces for the length of the replay window. A request whose
+// timestamp falls outside the window is rejected outright, so a nonce only has
+// to be remembered until its timestamp ages out. Nonces are kept in the
+// shared cache, so a request replayed to another instance is rejected too;
+// with caching disabled they are kept in memory, which only protects a single
+// instance.
+type Store struct {
+	mu     sync.Mutex
+	window time.Duration
+	shared cache.Cache
+	seen   map[string]time.Time
+	now    func() time.Time
+}
+
+func NewStore(cfg config.ReplayConfig, c cache.Cache) *Store {
+	window := cfg.Window
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	s := &Store{
+		window: window,
+		seen:   make(map[string]time.Time),
+		now:    time.Now,
+	}
+	if _, disabled := c.(cache.Null); !disabled {
+		s.shared = c
+	}
+	return s
+}
+
+// Use checks that ts is within the window and records nonce, returning
+// ErrReplayed if it was already used
+func (s *Store) Use(ctx context.Context, nonce string, ts time.Time) error {
+	return s.UseWithin(ctx, nonce, ts, s.window)
+}
+
+// UseWithin is Use for requests whose timestamps may be window away from
+// now, such as webhooks verified with their own tolerance
+func (s *Store) UseWithin(ctx context.Context, nonce string, ts time.Time, window time.Duration) error {
+	if nonce == "" {
+		return ErrMissingNonce
+	}
+
+	now := s.now()
+	if drift := now.Sub(ts); drift > window || drift < -window {
+		return ErrStaleTimestamp
+	}
+	// Once ts ages out of the window the request is rejected as stale, so
+	// the nonce is remembered until then
+	expires := ts.Add(window)
+
+	if s.shared != nil {
+		added, err := s.shared.Add(ctx, nonceKeyPrefix+nonce, ts.Unix(), expires.Sub(now))
+		if err != nil {
+			return err
+		}
+		if !added {
+			return ErrReplayed
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if seenUntil, ok := s.seen[nonce]; ok && now.Before(seenUntil) {
+		return ErrReplayed
+	}
+	s.seen[nonce] = expires
+	return nil
+}
+
+// Run evicts expired nonces kept in memory until ctx is cancelled
+func (s *Store) Run(ctx context.Context) {
+	if s.shared != nil {
+		return
+	}
+	ticker := time.NewTicker(s.window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.evict()
+		}
+	}
+}
+
+func (s *Store) evict() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for nonce, expires := range s.seen {
+		if !now.Before(expires) {
+			delete(s.seen, nonce)
+		}
+	}
+}
+
+// Sign returns the signature of a request made at ts with nonce: the hex
+// HMAC-SHA256 under the signing secret of its API key of
+// "<ts>.<nonce>.<METHOD>.<path and query>.<hex SHA-256 of body>", as in
+// webhook.Compute. The API key itself travels with every request, so it
+// cannot sign them.
+func Sign(secret string, ts int64, nonce, method, uri string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return webhook.Compute(secret, ts, []byte(nonce+"."+method+"."+uri+"."+hex.EncodeToString(sum[:])))
+}
+
+// Middleware requires mutation requests made with an API key to carry a
+// fresh timestamp, an unused nonce and a signature of both and of the
+// request, so a captured request cannot be sent again with a new nonce.
+// Safe methods and requests without an API key are passed through.
+func (s *Store) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		keyID := services.APIKeyIDFromContext(r.Context())
+		if keyID == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		unix, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		if err != nil {
+			sendError(w, r, "invalid_timestamp", http.StatusBadRequest, "header", TimestampHeader)
+			return
+		}
+
+		nonce := r.Header.Get(NonceHeader)
+		if nonce == "" || len(nonce) > maxNonceLength {
+			sendError(w, r, "invalid_nonce", http.StatusBadRequest, "header", NonceHeader)
+			return
+		}
+
+		secret := services.APIKeySigningSecretFromContext(r.Context())
+		if secret == "" {
+			sendError(w, r, "api_key_cannot_sign", http.StatusForbidden)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBody+1))
+		if err != nil {
+			sendError(w, r, "invalid_request_body", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxSignedBody {
+			sendError(w, r, "signed_body_too_large", http.StatusRequestEntityTooLarge, "max", maxSignedBody)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		expected := Sign(secret, unix, nonce, r.Method, r.URL.RequestURI(), body)
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get(SignatureHeader))) {
+			sendError(w, r, "invalid_request_signature", http.StatusUnauthorized, "header", SignatureHeader)
+			return
+		}
+
+		// Scope nonces per key so clients cannot collide with each other
+		err = s.Use(r.Context(), "key:"+strconv.FormatInt(keyID, 10)+":"+nonce, time.Unix(unix, 0))
+		switch {
+		case errors.Is(err, ErrStaleTimestamp), errors.Is(err, ErrReplayed):
+			sendError(w, r, "replayed_request", http.StatusUnauthorized)
+			return
+		case err != nil:
+			// Without the shared store a replay cannot be told apart
+			sendError(w, r, "replay_check_unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func sendError(w http.ResponseWriter, r *http.Request, code string, status int, args ...interface{}) {
+	apierror.Write(w, r, status, code, args...)
+}
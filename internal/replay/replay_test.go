@@ -0,0 +1,130 @@
+package replay
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/services"
+)
+
+const testSecret = "0123456789abcdef"
+
+type signedRequest struct {
+	secret string
+	ts     int64
+	nonce  string
+	method string
+	uri    string
+	body   string
+	sig    string
+}
+
+func newSignedRequest(now time.Time, nonce, body string) signedRequest {
+	req := signedRequest{
+		secret: testSecret,
+		ts:     now.Unix(),
+		nonce:  nonce,
+		method: http.MethodPost,
+		uri:    "/api/movies?notify=1",
+		body:   body,
+	}
+	req.sig = Sign(req.secret, req.ts, req.nonce, req.method, req.uri, []byte(req.body))
+	return req
+}
+
+func (sr signedRequest) build() *http.Request {
+	r := httptest.NewRequest(sr.method, sr.uri, strings.NewReader(sr.body))
+	r.Header.Set(TimestampHeader, strconv.FormatInt(sr.ts, 10))
+	r.Header.Set(NonceHeader, sr.nonce)
+	r.Header.Set(SignatureHeader, sr.sig)
+	ctx := services.ContextWithAPIKeyID(r.Context(), 7)
+	ctx = services.ContextWithAPIKeySigningSecret(ctx, sr.secret)
+	return r.WithContext(ctx)
+}
+
+func TestMiddlewareRequiresSignature(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	store := NewStore(config.ReplayConfig{Window: time.Minute}, cache.Null{})
+	store.now = func() time.Time { return now }
+
+	var gotBody string
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	original := newSignedRequest(now, "nonce-1", `{"title":"Heat"}`)
+
+	changedNonce := original
+	changedNonce.nonce = "nonce-2"
+
+	tamperedBody := newSignedRequest(now, "nonce-3", `{"title":"Heat"}`)
+	tamperedBody.body = `{"title":"Ronin"}`
+
+	otherPath := newSignedRequest(now, "nonce-4", `{}`)
+	otherPath.uri = "/api/movies/1"
+
+	laterTimestamp := newSignedRequest(now, "nonce-5", `{}`)
+	laterTimestamp.ts++
+
+	missing := newSignedRequest(now, "nonce-6", `{}`)
+	missing.sig = ""
+
+	noSecret := newSignedRequest(now, "nonce-7", `{}`)
+	noSecret.secret = ""
+
+	tests := []struct {
+		name string
+		req  signedRequest
+		want int
+	}{
+		{"signed", original, http.StatusNoContent},
+		{"replayed", original, http.StatusUnauthorized},
+		{"replayed with a new nonce", changedNonce, http.StatusUnauthorized},
+		{"tampered body", tamperedBody, http.StatusUnauthorized},
+		{"other path", otherPath, http.StatusUnauthorized},
+		{"other timestamp", laterTimestamp, http.StatusUnauthorized},
+		{"missing signature", missing, http.StatusUnauthorized},
+		{"key without a secret", noSecret, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req.build())
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if gotBody != original.body {
+		t.Errorf("handler read body %q, want %q", gotBody, original.body)
+	}
+}
+
+func TestMiddlewarePassesSafeAndKeylessRequests(t *testing.T) {
+	store := NewStore(config.ReplayConfig{}, cache.Null{})
+	handler := store.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	keyless := httptest.NewRequest(http.MethodPost, "/api/movies", strings.NewReader("{}"))
+	safe := httptest.NewRequest(http.MethodGet, "/api/movies", nil)
+	safe = safe.WithContext(services.ContextWithAPIKeyID(safe.Context(), 7))
+
+	for _, r := range []*http.Request{keyless, safe} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("%s %s: status = %d, want %d", r.Method, r.URL, rec.Code, http.StatusNoContent)
+		}
+	}
+}
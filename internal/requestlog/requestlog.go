@@ -0,0 +1,99 @@
+// Package requestlog logs HTTP requests with zap: one structured entry per
+// request once it is answered, and a request-scoped logger in the request
+// context, carrying the request ID, method and path, for handlers and
+// services to log with. Fields learned while the request is handled, such as
+// the user ID once authenticated, are added with AddFields and appear both on
+// the request-scoped logger and on the final entry.
+package requestlog
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+type contextKey struct{}
+
+// requestLogger is the logger of a request, extended as fields are added
+type requestLogger struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+}
+
+func (l *requestLogger) get() *zap.Logger {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.logger
+}
+
+// Middleware logs every request to base once answered, with its method,
+// path, route, status, latency, response size, client address and request
+// ID, and the fields added while it was handled. Server errors are logged at
+// error level, other requests at info. It must come after
+// middleware.RequestID and middleware.RealIP.
+func Middleware(base *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			l := &requestLogger{logger: base.With(
+				zap.String("request_id", middleware.GetReqID(r.Context())),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+			)}
+			ctx := context.WithValue(r.Context(), contextKey{}, l)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				fields := []zap.Field{
+					zap.Int("status", status),
+					zap.Duration("latency", time.Since(start)),
+					zap.Int("bytes", ww.BytesWritten()),
+					zap.String("ip", r.RemoteAddr),
+				}
+				if rctx := chi.RouteContext(ctx); rctx != nil {
+					if pattern := rctx.RoutePattern(); pattern != "" {
+						fields = append(fields, zap.String("route", pattern))
+					}
+				}
+
+				if status >= http.StatusInternalServerError {
+					l.get().Error("request", fields...)
+				} else {
+					l.get().Info("request", fields...)
+				}
+			}()
+
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		})
+	}
+}
+
+// FromContext returns the logger of the request ctx belongs to, or fallback
+// outside of requests
+func FromContext(ctx context.Context, fallback *zap.Logger) *zap.Logger {
+	if l, ok := ctx.Value(contextKey{}).(*requestLogger); ok {
+		return l.get()
+	}
+	return fallback
+}
+
+// AddFields adds fields to the logger of the request ctx belongs to and to
+// its final entry. It does nothing outside of requests.
+func AddFields(ctx context.Context, fields ...zap.Field) {
+	l, ok := ctx.Value(contextKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+	l.mu.Lock()
+	l.logger = l.logger.With(fields...)
+	l.mu.Unlock()
+}
@@ -0,0 +1,101 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"go.uber.org/zap"
+)
+
+// Policy controls how long and how often an operation is retried. Jitter
+// spreads each delay randomly by up to that fraction of it either way, so
+// instances starting together do not retry in step. MaxAttempts caps the
+// attempts made; zero retries until MaxWait.
+type Policy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxWait         time.Duration
+	Jitter          float64
+	MaxAttempts     int
+}
+
+// PolicyFromConfig builds a Policy, filling in defaults for unset values
+func PolicyFromConfig(cfg config.RetryConfig) Policy {
+	p := Policy{
+		InitialInterval: cfg.InitialInterval,
+		MaxInterval:     cfg.MaxInterval,
+		MaxWait:         cfg.MaxWait,
+		Jitter:          cfg.Jitter,
+		MaxAttempts:     cfg.MaxAttempts,
+	}
+	if p.InitialInterval <= 0 {
+		p.InitialInterval = 500 * time.Millisecond
+	}
+	if p.MaxInterval <= 0 {
+		p.MaxInterval = 10 * time.Second
+	}
+	if p.MaxWait <= 0 {
+		p.MaxWait = time.Minute
+	}
+	return p
+}
+
+// Do calls fn until it succeeds, ctx is cancelled, the policy's MaxWait
+// elapses or MaxAttempts are made, doubling the delay between attempts up to
+// MaxInterval, give or take the jitter. Each failed attempt is logged so slow
+// dependencies are visible during boot.
+func Do(ctx context.Context, name string, p Policy, logger *zap.Logger, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, p.MaxWait)
+	defer cancel()
+
+	start := time.Now()
+	delay := p.InitialInterval
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("dependency available",
+					zap.String("dependency", name),
+					zap.Int("attempts", attempt),
+					zap.Duration("waited", time.Since(start)),
+				)
+			}
+			return nil
+		}
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return fmt.Errorf("%s not ready after %d attempts: %w", name, attempt, err)
+		}
+
+		wait := p.jittered(delay)
+		logger.Warn("dependency not ready, retrying",
+			zap.String("dependency", name),
+			zap.Int("attempt", attempt),
+			zap.Duration("retry_in", wait),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready after %s: %w", name, time.Since(start).Round(time.Second), err)
+		case <-time.After(wait):
+		}
+
+		delay *= 2
+		if delay > p.MaxInterval {
+			delay = p.MaxInterval
+		}
+	}
+}
+
+// jittered returns delay spread randomly by up to the policy's jitter
+func (p Policy) jittered(delay time.Duration) time.Duration {
+	if p.Jitter <= 0 {
+		return delay
+	}
+	return delay + time.Duration((rand.Float64()*2-1)*p.Jitter*float64(delay))
+}
@@ -0,0 +1,901 @@
+package routes
+
+import (
+	"github.com/ndn/internal/deprecation"
+	"github.com/ndn/internal/entitlements"
+	handlers2 "github.com/ndn/internal/handlers"
+	"github.com/ndn/internal/health"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/jwtkeys"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/openapi"
+	"github.com/ndn/internal/patch"
+	"github.com/ndn/internal/services"
+	"net/http"
+)
+
+// describeRoutes binds request and response types to the handlers mounted in
+// SetupRoutes. Paths, methods and authentication come from the router itself,
+// so only what cannot be inferred from it is declared here.
+func describeRoutes(
+	gen *openapi.Generator,
+	deprecations *deprecation.Tracker,
+	authHandler *handlers2.AuthHandler,
+	movieHandler *handlers2.MovieHandler,
+	categoryHandler *handlers2.CategoryHandler,
+	userHandler *handlers2.UserHandler,
+	healthHandler *handlers2.HealthHandler,
+	apiKeyHandler *handlers2.APIKeyHandler,
+	analyticsHandler *handlers2.AnalyticsHandler,
+	boostHandler *handlers2.BoostHandler,
+	recommendationHandler *handlers2.RecommendationHandler,
+	searchHandler *handlers2.SearchHandler,
+	moderationHandler *handlers2.ModerationHandler,
+	contentHandler *handlers2.ContentHandler,
+	historyHandler *handlers2.WatchHistoryHandler,
+	reviewHandler *handlers2.ReviewHandler,
+	oauthHandler *handlers2.OAuthHandler,
+	seriesHandler *handlers2.SeriesHandler,
+	videoHandler *handlers2.VideoHandler,
+	playbackHandler *handlers2.PlaybackHandler,
+	subtitleHandler *handlers2.SubtitleHandler,
+	translationHandler *handlers2.TranslationHandler,
+	importHandler *handlers2.ImportHandler,
+	notificationHandler *handlers2.NotificationHandler,
+	eventHandler *handlers2.EventHandler,
+	profileHandler *handlers2.ProfileHandler,
+	billingHandler *handlers2.BillingHandler,
+	dataExportHandler *handlers2.DataExportHandler,
+	collectionHandler *handlers2.CollectionHandler,
+	featuredHandler *handlers2.FeaturedHandler,
+	auditHandler *handlers2.AuditHandler,
+) {
+	gen.Secure(authHandler.AuthMiddleware, "")
+	gen.Secure(authHandler.AdminMiddleware, "Requires admin access.")
+	gen.Secure(contentHandler.RoleMiddleware, "Requires the editor or publisher role, or admin access.")
+	gen.Deprecated(deprecations.Deprecate(deprecation.Policy{}))
+
+	limit := []openapi.Param{{Name: "limit", Type: "integer", Description: "Number of movies to return (default: 10)"}}
+	movieFields := openapi.Param{Name: "fields", Type: "string", Description: "Comma-separated fields of the movies to return, id always included: title, description, release_year, duration, poster_url, maturity_rating, rating (default: all)"}
+	movieInclude := openapi.Param{Name: "include", Type: "string", Description: "Comma-separated relations to embed: categories (default: categories, or none when fields is set)"}
+
+	// Health
+	gen.Describe(healthHandler.Live, openapi.Operation{Summary: "Liveness probe", Tags: []string{"health"}, Response: map[string]string{}})
+	gen.Describe(healthHandler.Ready, openapi.Operation{Summary: "Readiness probe", Tags: []string{"health"}, Response: health.Report{}})
+
+	// Auth
+	gen.Describe(authHandler.JWKS, openapi.Operation{
+		Summary:     "Get the token signing keys",
+		Description: "Public keys of RS256 access tokens as a JSON Web Key Set; empty with HS256.",
+		Response:    jwtkeys.JWKS{},
+	})
+	gen.Describe(authHandler.Register, openapi.Operation{Summary: "Register a new user", Request: handlers2.RegisterRequest{}, Response: handlers2.AuthResponse{}, Status: http.StatusCreated})
+	gen.Describe(authHandler.Login, openapi.Operation{
+		Summary:     "Login user",
+		Description: "After repeated failures for an email or IP address, logins answer 429 until retry_after seconds have passed, and eventually 423 while the account is locked.",
+		Request:     handlers2.LoginRequest{},
+		Response:    handlers2.AuthResponse{},
+	})
+	gen.Describe(authHandler.Refresh, openapi.Operation{
+		Summary:     "Refresh access token",
+		Description: "Rotates the refresh token; sending a used one again revokes its session.",
+		Request:     handlers2.RefreshRequest{},
+		Response:    handlers2.AuthResponse{},
+	})
+	gen.Describe(authHandler.Logout, openapi.Operation{
+		Summary:     "Logout",
+		Description: "Revokes the session of the refresh token and the access token in the Authorization header, either of which may be left out.",
+		Request:     handlers2.LogoutRequest{},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(authHandler.LogoutAll, openapi.Operation{Summary: "Logout everywhere", Description: "Revokes every session and access token of the user.", Status: http.StatusNoContent})
+	gen.Describe(authHandler.ForgotPassword, openapi.Operation{Summary: "Request a password reset", Request: handlers2.ForgotPasswordRequest{}, Status: http.StatusAccepted})
+	gen.Describe(authHandler.ResetPassword, openapi.Operation{Summary: "Reset a password", Request: handlers2.ResetPasswordRequest{}, Status: http.StatusNoContent})
+	gen.Describe(authHandler.ConfirmEmail, openapi.Operation{
+		Summary:     "Confirm a new email address",
+		Description: "Uses up the token from an email change confirmation and changes the user's email address to the one it confirms, unless another account took it meanwhile.",
+		Request:     handlers2.ConfirmEmailRequest{},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(oauthHandler.Login, openapi.Operation{
+		Summary:     "Log in with an OAuth provider",
+		Description: "Redirects to the provider (google or github) to sign in.",
+		Status:      http.StatusFound,
+	})
+	gen.Describe(oauthHandler.Callback, openapi.Operation{
+		Summary:     "Complete a login with an OAuth provider",
+		Description: "Links the provider account to the user with the same verified email, or a new user, the first time it is used.",
+		Query: []openapi.Param{
+			{Name: "code", Type: "string", Description: "Authorization code", Required: true},
+			{Name: "state", Type: "string", Description: "State from the login redirect", Required: true},
+		},
+		Response: handlers2.AuthResponse{},
+	})
+
+	// Movies
+	gen.Describe(movieHandler.GetMovies, openapi.Operation{
+		Summary:     "Get movies",
+		Description: "year cannot be combined with year_from or year_to, the lower bounds of ranges must not be above their upper bounds, and a category cannot be both included and excluded; such filters are rejected with 400.",
+		Query: []openapi.Param{
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size (default: 10)"},
+			{Name: "search", Type: "string", Description: "Search term"},
+			{Name: "year", Type: "integer", Description: "Filter by year"},
+			{Name: "year_from", Type: "integer", Description: "Only movies released in or after this year"},
+			{Name: "year_to", Type: "integer", Description: "Only movies released in or before this year"},
+			{Name: "rating_gte", Type: "number", Description: "Only movies rated at least this, from 0 to 10, leaving out unrated ones"},
+			{Name: "duration_min", Type: "integer", Description: "Only movies lasting at least this many minutes"},
+			{Name: "duration_max", Type: "integer", Description: "Only movies lasting at most this many minutes"},
+			{Name: "categories", Type: "array", Description: "Filter by categories"},
+			{Name: "exclude_categories", Type: "array", Description: "Leave out the movies of these categories and their sub-categories"},
+			{Name: "exclude_ids", Type: "array", Description: "Leave out the movies with these IDs, at most 100"},
+			{Name: "category", Type: "string", Description: "Filter by category slug"},
+			{Name: "max_maturity_rating", Type: "string", Description: "Only movies rated up to this maturity rating (G, PG, PG-13, R or NC-17), leaving out unrated ones"},
+			{Name: "sort_by", Type: "string", Description: "Comma-separated sort keys, up to 3 of title, year, rating, duration and created_at, optionally followed by _asc or _desc, e.g. year_desc,title (default: created_at_desc)"},
+			movieFields,
+			movieInclude,
+		},
+		Response: handlers2.MovieListResponse{},
+	})
+	gen.Describe(movieHandler.GetMoviesBatch, openapi.Operation{
+		Summary:     "Get many movies by ID",
+		Description: "Up to 100 movies, one result per ID in the order given, with status found and the movie or not_found.",
+		Query:       []openapi.Param{{Name: "ids", Type: "string", Description: "Comma-separated movie IDs, at most 100"}},
+		Response:    handlers2.BatchMovieResponse{},
+	})
+	gen.Describe(movieHandler.PostMoviesBatch, openapi.Operation{
+		Summary:     "Get many movies by ID",
+		Description: "GET /movies/batch with the IDs in the body, for lists too long for a URL.",
+		Request:     handlers2.BulkMovieRequest{},
+		Response:    handlers2.BatchMovieResponse{},
+	})
+	gen.Describe(movieHandler.GetMovie, openapi.Operation{
+		Summary:     "Get a movie by ID",
+		Description: "fields and include shrink the response to the fields and relations given.",
+		Query:       []openapi.Param{movieFields, movieInclude},
+		Response:    handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.GetTopRatedMovies, openapi.Operation{Summary: "Get top rated movies", Query: limit, Response: []handlers2.MovieResponse{}})
+	gen.Describe(movieHandler.GetRecentlyAddedMovies, openapi.Operation{Summary: "Get recently added movies", Query: limit, Response: []handlers2.MovieResponse{}})
+	gen.Describe(movieHandler.GetTrendingMovies, openapi.Operation{
+		Summary: "Get trending movies",
+		Query: append(limit, openapi.Param{
+			Name: "window", Type: "string", Description: "Plays counted: 1d, 7d or 30d (default: the configured window)",
+		}),
+		Response: []handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.GetUpcomingMovies, openapi.Operation{
+		Summary:     "Get upcoming releases",
+		Description: "Published movies whose availability window opens in the range, grouped by day.",
+		Query: []openapi.Param{
+			{Name: "from", Type: "string", Description: "First day, YYYY-MM-DD (default: today)"},
+			{Name: "to", Type: "string", Description: "Last day, YYYY-MM-DD"},
+			{Name: "days", Type: "integer", Description: "Number of days when to is not given (default: 30)"},
+		},
+		Response: []handlers2.UpcomingDayResponse{},
+	})
+	gen.Describe(movieHandler.GetSimilarMovies, openapi.Operation{
+		Summary:     "Get similar movies",
+		Description: "Nearest movies by embedding, or movies sharing categories when none is available.",
+		Query:       limit,
+		Response:    []handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.CreateMovie, openapi.Operation{Summary: "Create a new movie", Request: handlers2.CreateMovieRequest{}, Response: handlers2.MovieResponse{}, Status: http.StatusCreated})
+	gen.Describe(movieHandler.UpdateMovie, openapi.Operation{Summary: "Update a movie", Request: handlers2.UpdateMovieRequest{}, Response: handlers2.MovieResponse{}})
+	gen.Describe(movieHandler.PatchMovie, openapi.Operation{
+		Summary:     "Patch a movie",
+		Description: "Accepts application/json-patch+json as well.",
+		Request:     handlers2.CreateMovieRequest{},
+		RequestType: patch.MergePatchContentType,
+		Response:    handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.UpsertMovieByExternalID, openapi.Operation{
+		Summary:     "Create or update a movie by external ID",
+		Description: "Responds with 201 when the movie was created.",
+		Request:     handlers2.CreateMovieRequest{},
+		Response:    handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.AdminGetMovies, openapi.Operation{
+		Summary: "List every movie",
+		Query: []openapi.Param{
+			{Name: "status", Type: "string", Description: "draft, in_review, scheduled, published or archived"},
+			{Name: "include_deleted", Type: "boolean", Description: "Include deleted movies, with their deleted_at"},
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size (default: 20, max: 100)"},
+		},
+		Response: handlers2.AdminMovieListResponse{},
+	})
+	gen.Describe(movieHandler.DeleteMovie, openapi.Operation{Summary: "Delete a movie", Description: "The movie can be restored until deleted movies are purged.", Status: http.StatusNoContent})
+	gen.Describe(movieHandler.RestoreMovie, openapi.Operation{Summary: "Restore a deleted movie", Status: http.StatusNoContent})
+	gen.Describe(movieHandler.UploadPoster, openapi.Operation{
+		Summary:     "Upload a movie poster",
+		Description: "Stores a JPEG, PNG or WebP image, sent as the poster form field, and sets the movie's poster_url to its public URL.",
+		Request: struct {
+			Poster []byte `json:"poster"`
+		}{},
+		RequestType: "multipart/form-data",
+		Response:    handlers2.MovieResponse{},
+	})
+	gen.Describe(movieHandler.BulkDeleteMovies, openapi.Operation{Summary: "Delete movies in bulk", Request: handlers2.BulkMovieRequest{}, Response: handlers2.BulkMovieResponse{}})
+	gen.Describe(movieHandler.BulkRestoreMovies, openapi.Operation{Summary: "Restore deleted movies in bulk", Request: handlers2.BulkMovieRequest{}, Response: handlers2.BulkMovieResponse{}})
+	gen.Describe(movieHandler.GetEmbeddingJob, openapi.Operation{Summary: "Get the movie embedding job", Response: services.EmbeddingJob{}})
+	gen.Describe(movieHandler.ComputeEmbeddings, openapi.Operation{
+		Summary:     "Compute movie embeddings",
+		Description: "Starts a background job; unchanged movies are skipped unless force is set.",
+		Request:     handlers2.ComputeEmbeddingsRequest{},
+		Response:    services.EmbeddingJob{},
+		Status:      http.StatusAccepted,
+	})
+	gen.Describe(movieHandler.GetTrendingSettings, openapi.Operation{Summary: "Get trending settings", Response: models.TrendingSettings{}})
+	gen.Describe(movieHandler.UpdateTrendingSettings, openapi.Operation{
+		Summary:     "Update trending settings",
+		Description: "Scores are recomputed with the new settings right away.",
+		Request:     models.TrendingSettings{},
+		Response:    models.TrendingSettings{},
+	})
+	gen.Describe(movieHandler.BulkAssignCategory, openapi.Operation{Summary: "Add or remove a category on many movies", Request: handlers2.BulkCategoryRequest{}, Response: services.BulkCategoryResult{}})
+
+	// Reviews
+	gen.Describe(reviewHandler.GetReviews, openapi.Operation{
+		Summary: "Get the reviews of a movie",
+		Query: []openapi.Param{
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size, at most 100 (default: 20)"},
+		},
+		Response: handlers2.PaginatedReviewResponse{},
+	})
+	gen.Describe(reviewHandler.CreateReview, openapi.Operation{
+		Summary:     "Review a movie",
+		Description: "One review per user and movie; the movie's rating is the average score of its reviews.",
+		Request:     handlers2.ReviewRequest{},
+		Response:    handlers2.ReviewResponse{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(reviewHandler.UpdateReview, openapi.Operation{Summary: "Update a review", Request: handlers2.ReviewRequest{}, Response: handlers2.ReviewResponse{}})
+	gen.Describe(reviewHandler.DeleteReview, openapi.Operation{Summary: "Delete a review", Description: "Admins may delete any review.", Status: http.StatusNoContent})
+
+	// Categories
+	categoryTree := []openapi.Param{{Name: "tree", Type: "boolean", Description: "Nest sub-categories under their parents, in children"}}
+	gen.Describe(categoryHandler.GetCategories, openapi.Operation{Summary: "Get all categories", Query: categoryTree, Response: handlers2.CategoryListResponse{}})
+	gen.Describe(categoryHandler.GetCategory, openapi.Operation{Summary: "Get a category by ID", Response: handlers2.CategoryResponse{}})
+	gen.Describe(categoryHandler.GetCategoryBySlug, openapi.Operation{Summary: "Get a category by slug", Response: handlers2.CategoryResponse{}})
+	gen.Describe(categoryHandler.AdminGetCategories, openapi.Operation{
+		Summary: "Get all categories including hidden ones",
+		Query: append(categoryTree,
+			openapi.Param{Name: "include_deleted", Type: "boolean", Description: "Include deleted categories, with their deleted_at"}),
+		Response: handlers2.CategoryListResponse{},
+	})
+	gen.Describe(categoryHandler.CreateCategory, openapi.Operation{Summary: "Create a new category", Request: handlers2.CreateCategoryRequest{}, Response: handlers2.CategoryResponse{}, Status: http.StatusCreated})
+	gen.Describe(categoryHandler.UpdateCategory, openapi.Operation{
+		Summary:     "Update a category",
+		Description: "Renames the category and nests it under parent_id, or makes it top-level. The slug changes to that of the new name, and the movies and editorial boosts of the category move to the new name.",
+		Request:     handlers2.UpdateCategoryRequest{},
+		Response:    handlers2.CategoryResponse{},
+	})
+	gen.Describe(categoryHandler.ReorderCategories, openapi.Operation{Summary: "Reorder categories", Request: handlers2.ReorderCategoriesRequest{}, Status: http.StatusNoContent})
+	gen.Describe(categoryHandler.SetCategoryVisibility, openapi.Operation{Summary: "Hide or show a category", Request: handlers2.CategoryVisibilityRequest{}, Response: handlers2.CategoryResponse{}})
+	gen.Describe(categoryHandler.DeleteCategory, openapi.Operation{Summary: "Delete a category", Description: "The category can be restored until deleted categories are purged.", Status: http.StatusNoContent})
+	gen.Describe(categoryHandler.RestoreCategory, openapi.Operation{Summary: "Restore a deleted category", Response: handlers2.CategoryResponse{}})
+	gen.Describe(categoryHandler.GetCategoryStats, openapi.Operation{
+		Summary:     "Get catalog statistics per category",
+		Description: "Title count, average rating of rated titles, total watch time and growth over time of every category.",
+		Query: []openapi.Param{
+			{Name: "interval", Type: "string", Description: "week or month (default: month)"},
+			{Name: "periods", Type: "integer", Description: "Number of intervals growth covers, at most 60 (default: 12)"},
+		},
+		Response: []services.CategoryStats{},
+	})
+
+	// Users
+	gen.Describe(userHandler.GetProfile, openapi.Operation{Summary: "Get user profile", Response: handlers2.UserResponse{}})
+	gen.Describe(userHandler.UpdateProfile, openapi.Operation{Summary: "Update user profile", Request: handlers2.UpdateUserRequest{}, Response: handlers2.UserResponse{}})
+	gen.Describe(userHandler.PatchProfile, openapi.Operation{
+		Summary:     "Patch user profile",
+		Description: "Accepts application/merge-patch+json as well.",
+		Request:     []patch.Operation{},
+		RequestType: patch.JSONPatchContentType,
+		Response:    handlers2.UserResponse{},
+	})
+	gen.Describe(analyticsHandler.GetUserStats, openapi.Operation{
+		Summary:     "Get personal viewing statistics",
+		Description: "Watch time, titles watched and completed, favorite genres and streaks over a calendar month or year.",
+		Query: []openapi.Param{
+			{Name: "period", Type: "string", Description: "month or year (default: year)"},
+			{Name: "year", Type: "integer", Description: "Year (default: this year)"},
+			{Name: "month", Type: "integer", Description: "Month, 1-12, when period is month (default: this month)"},
+		},
+		Response: services.ViewingStats{},
+	})
+	gen.Describe(historyHandler.RecordProgress, openapi.Operation{
+		Summary:     "Record playback progress",
+		Description: "Replaces the user's previous position in the movie.",
+		Request:     handlers2.PlaybackProgressRequest{},
+		Response:    models.WatchHistory{},
+	})
+	gen.Describe(historyHandler.GetContinueWatching, openapi.Operation{
+		Summary:  "Get the continue watching list",
+		Query:    []openapi.Param{{Name: "limit", Type: "integer", Description: "Number of movies to return, at most 50 (default: 20)"}},
+		Response: []handlers2.ContinueWatchingResponse{},
+	})
+	gen.Describe(authHandler.DeleteAccount, openapi.Operation{
+		Summary:     "Delete the account",
+		Description: "Every session and access token is revoked at once, and reviews stay without an author. The account is removed for good, with the rest of its data, after the deletion grace period.",
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(userHandler.GetProfileDetails, openapi.Operation{
+		Summary:     "Get profile details",
+		Description: "The bio, avatar and date of birth of the user, empty until first set.",
+		Response:    handlers2.ProfileDetailsResponse{},
+	})
+	gen.Describe(userHandler.UpdateProfileDetails, openapi.Operation{
+		Summary:     "Update profile details",
+		Description: "Replaces the bio, avatar URL and date of birth (YYYY-MM-DD); empty fields clear them.",
+		Request:     handlers2.ProfileDetailsRequest{},
+		Response:    handlers2.ProfileDetailsResponse{},
+	})
+	gen.Describe(userHandler.UploadAvatar, openapi.Operation{
+		Summary:     "Upload an avatar",
+		Description: "Stores a JPEG, PNG or GIF image, sent as the avatar form field, cropped to a square in small, medium and large sizes, returned in avatar_urls.",
+		Request: struct {
+			Avatar []byte `json:"avatar"`
+		}{},
+		RequestType: "multipart/form-data",
+		Response:    handlers2.UserResponse{},
+	})
+	gen.Describe(authHandler.ChangePassword, openapi.Operation{
+		Summary:     "Change the password",
+		Description: "Takes the current password. The new one must meet the password policy and differ from it. Every other session is logged out.",
+		Request:     handlers2.ChangePasswordRequest{},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(authHandler.ChangeEmail, openapi.Operation{
+		Summary:     "Change the email address",
+		Description: "Emails a confirmation link to the new address and tells the current one. The address only changes once the link is confirmed.",
+		Request:     handlers2.ChangeEmailRequest{},
+		Status:      http.StatusAccepted,
+	})
+	gen.Describe(authHandler.ListDevices, openapi.Operation{
+		Summary:     "List signed-in devices",
+		Description: "Most recently seen first. The device of the request is marked current.",
+		Response:    []models.Device{},
+	})
+	gen.Describe(authHandler.RevokeDevice, openapi.Operation{
+		Summary:     "Sign out a device",
+		Description: "Revokes the refresh tokens of the device's session. Access tokens already issued to it stay valid until they expire.",
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(dataExportHandler.RequestExport, openapi.Operation{
+		Summary:     "Export the user's data",
+		Description: "Queues a ZIP archive of the account and viewer profiles, favorites, watch history and reviews, as JSON files, built in the background. Poll the export at the Location returned. While an export is queued or running, it is returned instead.",
+		Response:    services.DataExportStatus{},
+		Status:      http.StatusAccepted,
+	})
+	gen.Describe(dataExportHandler.GetExport, openapi.Operation{
+		Summary:     "Get a data export",
+		Description: "Once ready, download_url is a signed link to the archive, valid until download_expires_at. Each request issues a new one until the archive expires.",
+		Response:    services.DataExportStatus{},
+	})
+
+	// Viewer profiles
+	profiles := []string{"profiles"}
+	gen.Describe(profileHandler.GetProfiles, openapi.Operation{Summary: "List profiles", Tags: profiles, Response: []handlers2.ProfileResponse{}})
+	gen.Describe(profileHandler.GetProfile, openapi.Operation{Summary: "Get a profile", Tags: profiles, Response: handlers2.ProfileResponse{}})
+	gen.Describe(profileHandler.CreateProfile, openapi.Operation{
+		Summary:     "Create a profile",
+		Description: "An account may have up to 5 profiles with distinct names, each with its own favorites and watch history.",
+		Tags:        profiles,
+		Request:     handlers2.ProfileRequest{},
+		Response:    handlers2.ProfileResponse{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(profileHandler.UpdateProfile, openapi.Operation{
+		Summary:     "Update a profile",
+		Description: "Changing the kids flag or maximum content rating of a profile with a parental PIN takes the PIN.",
+		Tags:        profiles,
+		Request:     handlers2.ProfileRequest{},
+		Response:    handlers2.ProfileResponse{},
+	})
+	gen.Describe(profileHandler.DeleteProfile, openapi.Operation{
+		Summary:     "Delete a profile",
+		Description: "Deleting a profile with a parental PIN takes the PIN.",
+		Tags:        profiles,
+		Request:     handlers2.DeleteProfileRequest{},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(profileHandler.SetProfilePIN, openapi.Operation{
+		Summary:     "Set a profile's parental PIN",
+		Description: "Sets the 4-digit parental PIN of the profile, or removes it when pin is empty. Changing or removing a PIN takes the current one.",
+		Tags:        profiles,
+		Request:     handlers2.PINRequest{},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(profileHandler.SelectProfile, openapi.Operation{
+		Summary:     "Select a profile",
+		Description: "Exchanges the session's refresh token for tokens acting as the profile, or as the account itself when profile_id is 0. Refreshing keeps the profile. Profiles with a parental PIN take it, unless they are kids profiles, and movie listings leave out movies above the profile's maximum content rating.",
+		Tags:        profiles,
+		Request:     handlers2.SelectProfileRequest{},
+		Response:    handlers2.AuthResponse{},
+	})
+
+	// Billing
+	billing := []string{"billing"}
+	gen.Describe(billingHandler.GetPlans, openapi.Operation{Summary: "List plans", Tags: billing, Response: []models.Plan{}})
+	gen.Describe(billingHandler.GetSubscription, openapi.Operation{Summary: "Get the subscription", Tags: billing, Response: models.Subscription{}})
+	gen.Describe(billingHandler.GetEntitlements, openapi.Operation{
+		Summary:     "Get the entitlements",
+		Description: "What the user's plan lets them do when playing videos; zero max_height and max_streams are no limit.",
+		Tags:        billing,
+		Response:    entitlements.Entitlements{},
+	})
+	gen.Describe(billingHandler.Checkout, openapi.Operation{
+		Summary:     "Subscribe to a plan",
+		Description: "Starts a Stripe Checkout session; redirect the user to its url. The subscription becomes active once Stripe reports the payment.",
+		Tags:        billing,
+		Request:     handlers2.CheckoutRequest{},
+		Response:    integrations.CheckoutSession{},
+	})
+	gen.Describe(billingHandler.Portal, openapi.Operation{
+		Summary:     "Open the customer portal",
+		Description: "Starts a Stripe customer portal session, where the user changes plan, cancels and gets invoices; redirect them to its url.",
+		Tags:        billing,
+		Response:    handlers2.PortalResponse{},
+	})
+	gen.Describe(billingHandler.Webhook, openapi.Operation{
+		Summary:     "Receive Stripe events",
+		Description: "Stripe webhook endpoint, verified by the Stripe-Signature header. Checkout, subscription and invoice events update the subscription they are about.",
+		Tags:        billing,
+	})
+	gen.Describe(billingHandler.AdminGetPlans, openapi.Operation{Summary: "List all plans", Tags: billing, Response: []models.Plan{}})
+	gen.Describe(billingHandler.PutPlan, openapi.Operation{
+		Summary:     "Create or update a plan",
+		Description: "The code names the plan in rate_limit.plan_multipliers.",
+		Tags:        billing,
+		Request:     handlers2.PlanRequest{},
+		Response:    models.Plan{},
+	})
+	gen.Describe(billingHandler.RedeemCoupon, openapi.Operation{
+		Summary:     "Redeem a coupon",
+		Description: "The coupon's discount applies to the user's Checkout sessions until one completes. A user holds one coupon at a time.",
+		Tags:        billing,
+		Request:     handlers2.RedeemCouponRequest{},
+		Response:    models.CouponRedemption{},
+	})
+	gen.Describe(billingHandler.ListCoupons, openapi.Operation{Summary: "List coupons", Tags: billing, Response: []models.Coupon{}})
+	gen.Describe(billingHandler.GetCoupon, openapi.Operation{Summary: "Get a coupon", Tags: billing, Response: models.Coupon{}})
+	gen.Describe(billingHandler.CreateCoupon, openapi.Operation{
+		Summary:     "Create a coupon",
+		Description: "Takes either percent_off percent or amount_off_cents in currency off subscriptions. The discount cannot change afterwards.",
+		Tags:        billing,
+		Request:     handlers2.CouponRequest{},
+		Response:    models.Coupon{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(billingHandler.UpdateCoupon, openapi.Operation{
+		Summary:  "Update a coupon",
+		Tags:     billing,
+		Request:  handlers2.CouponUpdateRequest{},
+		Response: models.Coupon{},
+	})
+	gen.Describe(billingHandler.DeleteCoupon, openapi.Operation{Summary: "Delete a coupon", Tags: billing, Status: http.StatusNoContent})
+	gen.Describe(userHandler.ListUsers, openapi.Operation{
+		Summary: "List users",
+		Query: []openapi.Param{
+			{Name: "q", Type: "string", Description: "Part of the email or name, in any case"},
+			{Name: "is_admin", Type: "boolean", Description: "Only admins, or only non-admins"},
+			{Name: "created_after", Type: "string", Description: "Only users created at or after this time, RFC 3339 or YYYY-MM-DD"},
+			{Name: "created_before", Type: "string", Description: "Only users created before this time, RFC 3339 or YYYY-MM-DD"},
+			{Name: "include_deleted", Type: "boolean", Description: "Include deleted accounts not yet purged, with their deleted_at"},
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size (default: 20, max: 100)"},
+		},
+		Response: handlers2.UserListResponse{},
+	})
+	gen.Describe(userHandler.GetUser, openapi.Operation{Summary: "Get a user by ID", Response: handlers2.UserResponse{}})
+	gen.Describe(userHandler.CreateUser, openapi.Operation{Summary: "Create a user", Request: handlers2.CreateUserRequest{}, Response: handlers2.UserResponse{}, Status: http.StatusCreated})
+	gen.Describe(userHandler.UpdateUserStatus, openapi.Operation{
+		Summary:     "Promote, demote, suspend or activate a user",
+		Description: "Suspended users cannot sign in, and their tokens are refused until they are activated. Admins cannot demote or suspend themselves.",
+		Request:     handlers2.UpdateUserStatusRequest{},
+		Response:    handlers2.UserResponse{},
+	})
+	gen.Describe(userHandler.DeleteUser, openapi.Operation{Summary: "Delete a user", Description: "Their sessions end at once. The account can be restored during the deletion grace period, then is purged with their favorites, watch history, profiles and reviews. Admins cannot delete themselves.", Status: http.StatusNoContent})
+	gen.Describe(userHandler.RestoreUser, openapi.Operation{Summary: "Restore a deleted user", Response: handlers2.UserResponse{}})
+	gen.Describe(userHandler.SetUserRole, openapi.Operation{Summary: "Set a user's content role", Request: handlers2.SetUserRoleRequest{}, Response: handlers2.UserResponse{}})
+	gen.Describe(authHandler.UnlockUser, openapi.Operation{Summary: "Unlock a user's account", Description: "Forgets the user's failed logins.", Status: http.StatusNoContent})
+
+	// API keys
+	gen.Describe(apiKeyHandler.CreateAPIKey, openapi.Operation{Summary: "Create an API key", Request: handlers2.CreateAPIKeyRequest{}, Response: handlers2.CreateAPIKeyResponse{}, Status: http.StatusCreated})
+	gen.Describe(apiKeyHandler.ListAPIKeys, openapi.Operation{Summary: "List API keys", Response: []handlers2.APIKeyResponse{}})
+	gen.Describe(apiKeyHandler.RevokeAPIKey, openapi.Operation{Summary: "Revoke an API key", Status: http.StatusNoContent})
+	gen.Describe(apiKeyHandler.GetUsage, openapi.Operation{Summary: "Get API key usage", Response: services.APIKeyUsageReport{}})
+
+	// Analytics
+	gen.Describe(analyticsHandler.IngestEvents, openapi.Operation{
+		Summary:     "Ingest client analytics events",
+		Description: "A bearer token is optional and attributes the events to the user.",
+		Request:     handlers2.AnalyticsEventsRequest{},
+		Response:    handlers2.AnalyticsEventsResponse{},
+		Status:      http.StatusAccepted,
+	})
+
+	period := []openapi.Param{
+		{Name: "from", Type: "string", Description: "First day, YYYY-MM-DD"},
+		{Name: "to", Type: "string", Description: "Last day, YYYY-MM-DD (default: today)"},
+		{Name: "days", Type: "integer", Description: "Length of the period when from is not given (default: 30)"},
+	}
+	gen.Describe(analyticsHandler.ActiveUsers, openapi.Operation{Summary: "Get daily and monthly active users", Query: period, Response: services.ActiveUsersReport{}})
+	gen.Describe(analyticsHandler.SignupFunnel, openapi.Operation{Summary: "Get the signup funnel", Query: period, Response: services.SignupFunnelReport{}})
+	gen.Describe(analyticsHandler.Retention, openapi.Operation{Summary: "Get retention cohorts", Query: period, Response: services.RetentionReport{}})
+	gen.Describe(analyticsHandler.WatchTime, openapi.Operation{Summary: "Get total watch time", Query: period, Response: services.WatchTimeReport{}})
+	gen.Describe(analyticsHandler.TopTitles, openapi.Operation{
+		Summary: "Get top titles",
+		Query: append(period,
+			openapi.Param{Name: "metric", Type: "string", Description: "views, viewers, completions or watch_time (default: views)"},
+			openapi.Param{Name: "limit", Type: "integer", Description: "Number of titles, at most 100 (default: 10)"},
+		),
+		Response: services.TopTitlesReport{},
+	})
+	gen.Describe(analyticsHandler.MovieEngagement, openapi.Operation{
+		Summary:     "Get engagement with a movie",
+		Description: "Computed from playback heartbeats within raw event retention.",
+		Query:       period,
+		Response:    services.MovieEngagementReport{},
+	})
+	gen.Describe(analyticsHandler.RecommendationReasons, openapi.Operation{
+		Summary:     "Get clicks per recommendation reason",
+		Description: "Computed from raw events within retention.",
+		Query:       period,
+		Response:    services.RecommendationReasonsReport{},
+	})
+	gen.Describe(analyticsHandler.ListExports, openapi.Operation{Summary: "List warehouse export checkpoints", Response: []models.ExportCheckpoint{}})
+	gen.Describe(analyticsHandler.BackfillExport, openapi.Operation{
+		Summary:     "Backfill a warehouse export",
+		Description: "Rows from the given day on are exported again on the sink's next run.",
+		Request:     handlers2.BackfillExportRequest{},
+		Response:    models.ExportCheckpoint{},
+	})
+
+	// Editorial boosts
+	gen.Describe(boostHandler.ListBoosts, openapi.Operation{
+		Summary:  "List editorial boosts",
+		Query:    []openapi.Param{{Name: "active", Type: "boolean", Description: "Only list boosts in effect now"}},
+		Response: []models.EditorialBoost{},
+	})
+	gen.Describe(boostHandler.CreateBoost, openapi.Operation{
+		Summary:     "Create an editorial boost",
+		Description: "Boosts only apply to the default sort order.",
+		Request:     handlers2.BoostRequest{},
+		Response:    models.EditorialBoost{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(boostHandler.UpdateBoost, openapi.Operation{Summary: "Update an editorial boost", Request: handlers2.BoostRequest{}, Response: models.EditorialBoost{}})
+	gen.Describe(boostHandler.DeleteBoost, openapi.Operation{Summary: "Delete an editorial boost", Status: http.StatusNoContent})
+
+	// Collections
+	gen.Describe(collectionHandler.GetCollections, openapi.Operation{
+		Summary:     "Get the home page collections",
+		Description: "The visible collections in display order, each with its first published movies within the rating ceiling of the profile. Collections left without movies are omitted.",
+		Query: []openapi.Param{
+			{Name: "limit", Type: "integer", Description: "Number of movies per collection, at most 50 (default: 20)"},
+		},
+		Response: []handlers2.CollectionResponse{},
+	})
+	gen.Describe(collectionHandler.GetCollection, openapi.Operation{Summary: "Get a collection by slug", Response: handlers2.CollectionResponse{}})
+	gen.Describe(collectionHandler.AdminGetCollections, openapi.Operation{Summary: "Get all collections including hidden ones", Response: []models.Collection{}})
+	gen.Describe(collectionHandler.CreateCollection, openapi.Operation{
+		Summary:     "Create a collection",
+		Description: "Adds an empty collection after the others. The slug is made from the title unless given.",
+		Request:     handlers2.CollectionRequest{},
+		Response:    models.Collection{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(collectionHandler.UpdateCollection, openapi.Operation{Summary: "Update a collection", Request: handlers2.CollectionRequest{}, Response: models.Collection{}})
+	gen.Describe(collectionHandler.ReorderCollections, openapi.Operation{Summary: "Reorder collections", Request: handlers2.ReorderCollectionsRequest{}, Status: http.StatusNoContent})
+	gen.Describe(collectionHandler.SetCollectionMovies, openapi.Operation{
+		Summary:     "Set the movies of a collection",
+		Description: "Replaces the movies of the collection with movie_ids, in that order.",
+		Request:     handlers2.CollectionMoviesRequest{},
+		Response:    models.Collection{},
+	})
+	gen.Describe(collectionHandler.DeleteCollection, openapi.Operation{Summary: "Delete a collection", Status: http.StatusNoContent})
+
+	// Featured banners
+	gen.Describe(featuredHandler.GetFeatured, openapi.Operation{
+		Summary:     "Get the featured banners",
+		Description: "The banners in effect now, by descending priority, each featuring a published movie within the rating ceiling of the profile or a visible collection.",
+		Response:    []handlers2.FeaturedResponse{},
+	})
+	gen.Describe(featuredHandler.ListFeaturedSlots, openapi.Operation{
+		Summary:  "List featured slots",
+		Query:    []openapi.Param{{Name: "active", Type: "boolean", Description: "Only list slots in effect now"}},
+		Response: []models.FeaturedSlot{},
+	})
+	gen.Describe(featuredHandler.CreateFeaturedSlot, openapi.Operation{
+		Summary:     "Create a featured slot",
+		Description: "Features a movie or a collection, one of movie_id and collection_id, optionally between starts_at and ends_at.",
+		Request:     handlers2.FeaturedSlotRequest{},
+		Response:    models.FeaturedSlot{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(featuredHandler.UpdateFeaturedSlot, openapi.Operation{Summary: "Update a featured slot", Request: handlers2.FeaturedSlotRequest{}, Response: models.FeaturedSlot{}})
+	gen.Describe(featuredHandler.DeleteFeaturedSlot, openapi.Operation{Summary: "Delete a featured slot", Status: http.StatusNoContent})
+
+	// Audit log
+	gen.Describe(auditHandler.ListAuditLogs, openapi.Operation{
+		Summary:     "List the audit log",
+		Description: "Mutations made by admins, newest first. Changes services describe carry the changed fields before and after; other requests carry their JSON body, secrets redacted, as after.",
+		Query: []openapi.Param{
+			{Name: "user_id", Type: "integer", Description: "Only changes made by this user"},
+			{Name: "entity_type", Type: "string", Description: "Only changes of this type of entity, e.g. movie, collection or plan"},
+			{Name: "entity_id", Type: "integer", Description: "Only changes of the entity with this ID"},
+			{Name: "action", Type: "string", Description: "Only changes with this action, e.g. update_boost or post"},
+			{Name: "from", Type: "string", Description: "Only changes made at or after this time, RFC 3339 or YYYY-MM-DD"},
+			{Name: "to", Type: "string", Description: "Only changes made before this time, RFC 3339 or YYYY-MM-DD"},
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size (default: 50, max: 200)"},
+		},
+		Response: handlers2.PaginatedAuditLogResponse{},
+	})
+
+	// TV series
+	series := []string{"series"}
+	gen.Describe(seriesHandler.ListSeries, openapi.Operation{
+		Summary:     "Get series",
+		Description: "Newest first. Seasons are not included.",
+		Tags:        series,
+		Query: []openapi.Param{
+			{Name: "page", Type: "integer", Description: "Page number (default: 1)"},
+			{Name: "page_size", Type: "integer", Description: "Page size (default: 10)"},
+			{Name: "search", Type: "string", Description: "Search term"},
+			{Name: "year", Type: "integer", Description: "Filter by year"},
+			{Name: "categories", Type: "array", Description: "Filter by categories"},
+		},
+		Response: handlers2.PaginatedSeriesResponse{},
+	})
+	gen.Describe(seriesHandler.GetSeries, openapi.Operation{Summary: "Get a series with its seasons and episodes", Tags: series, Response: models.Series{}})
+	gen.Describe(seriesHandler.GetSeason, openapi.Operation{Summary: "Get a season of a series by number", Tags: series, Response: models.Season{}})
+	gen.Describe(seriesHandler.GetEpisode, openapi.Operation{Summary: "Get an episode by ID", Tags: series, Response: models.Episode{}})
+	gen.Describe(seriesHandler.CreateSeries, openapi.Operation{Summary: "Create a series", Tags: series, Request: handlers2.SeriesRequest{}, Response: models.Series{}, Status: http.StatusCreated})
+	gen.Describe(seriesHandler.UpdateSeries, openapi.Operation{Summary: "Update a series", Tags: series, Request: handlers2.SeriesRequest{}, Response: models.Series{}})
+	gen.Describe(seriesHandler.DeleteSeries, openapi.Operation{Summary: "Delete a series with its seasons and episodes", Tags: series, Status: http.StatusNoContent})
+	gen.Describe(seriesHandler.CreateSeason, openapi.Operation{Summary: "Add a season to a series", Tags: series, Request: handlers2.SeasonRequest{}, Response: models.Season{}, Status: http.StatusCreated})
+	gen.Describe(seriesHandler.UpdateSeason, openapi.Operation{Summary: "Update a season", Tags: series, Request: handlers2.SeasonRequest{}, Response: models.Season{}})
+	gen.Describe(seriesHandler.DeleteSeason, openapi.Operation{Summary: "Delete a season with its episodes", Tags: series, Status: http.StatusNoContent})
+	gen.Describe(seriesHandler.CreateEpisode, openapi.Operation{Summary: "Add an episode to a season", Tags: series, Request: handlers2.EpisodeRequest{}, Response: models.Episode{}, Status: http.StatusCreated})
+	gen.Describe(seriesHandler.UpdateEpisode, openapi.Operation{Summary: "Update an episode", Tags: series, Request: handlers2.EpisodeRequest{}, Response: models.Episode{}})
+	gen.Describe(seriesHandler.DeleteEpisode, openapi.Operation{Summary: "Delete an episode", Tags: series, Status: http.StatusNoContent})
+
+	// Recommendations
+	gen.Describe(recommendationHandler.GetRecommendations, openapi.Operation{
+		Summary:     "Get recommended movies",
+		Description: "Each movie comes with the reason it was recommended. A bearer token is optional and personalises the recommendations.",
+		Query:       []openapi.Param{{Name: "limit", Type: "integer", Description: "Number of movies to return, at most 100 (default: 20)"}},
+		Response:    []handlers2.RecommendationResponse{},
+	})
+	gen.Describe(recommendationHandler.GetRecommendedMovies, openapi.Operation{
+		Summary:     "Get personalised movie recommendations",
+		Description: "Recommendations for the signed-in user from their watch history, favorites and category affinities. Titles they already watched or favorited are left out.",
+		Query:       []openapi.Param{{Name: "limit", Type: "integer", Description: "Number of movies to return, at most 100 (default: 20)"}},
+		Response:    []handlers2.RecommendationResponse{},
+	})
+
+	// Search
+	gen.Describe(searchHandler.Search, openapi.Operation{
+		Summary:     "Search all entities",
+		Description: "Movies, series, categories and collections, grouped. When nothing matches, suggestions lists similar titles, names and synonyms to offer as corrections.",
+		Query: []openapi.Param{
+			{Name: "q", Type: "string", Description: "Search term"},
+			{Name: "types", Type: "string", Description: "Comma-separated groups to search: movies, series, categories, collections (default: all)"},
+			{Name: "limit", Type: "integer", Description: "Results per group, at most 50 (default: 5)"},
+			{Name: "movies_limit", Type: "integer", Description: "Results in the movies group, overriding limit"},
+			{Name: "series_limit", Type: "integer", Description: "Results in the series group, overriding limit"},
+			{Name: "categories_limit", Type: "integer", Description: "Results in the categories group, overriding limit"},
+			{Name: "collections_limit", Type: "integer", Description: "Results in the collections group, overriding limit"},
+		},
+		Response: handlers2.SearchResponse{},
+	})
+	gen.Describe(searchHandler.GetSynonyms, openapi.Operation{Summary: "List search synonyms", Response: []models.SearchSynonym{}})
+	gen.Describe(searchHandler.CreateSynonym, openapi.Operation{
+		Summary:     "Create a search synonym",
+		Description: "Searches containing the term as whole words also match it replaced by each alternative.",
+		Request:     handlers2.SynonymRequest{},
+		Response:    models.SearchSynonym{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(searchHandler.UpdateSynonym, openapi.Operation{Summary: "Update a search synonym", Request: handlers2.SynonymRequest{}, Response: models.SearchSynonym{}})
+	gen.Describe(searchHandler.DeleteSynonym, openapi.Operation{Summary: "Delete a search synonym", Status: http.StatusNoContent})
+
+	// Moderation
+	gen.Describe(moderationHandler.CheckText, openapi.Operation{
+		Summary:     "Check text against the content filter",
+		Description: "Returns the verdict the content filter would reach on a text. Nothing is stored.",
+		Request:     handlers2.CheckTextRequest{},
+		Response:    services.Screening{},
+	})
+	gen.Describe(moderationHandler.GetFlags, openapi.Operation{
+		Summary:  "List flagged content",
+		Query:    []openapi.Param{{Name: "status", Type: "string", Description: "pending, approved or removed (default: all)"}},
+		Response: []models.ContentFlag{},
+	})
+	gen.Describe(moderationHandler.ResolveFlag, openapi.Operation{Summary: "Resolve flagged content", Request: handlers2.ResolveFlagRequest{}, Response: models.ContentFlag{}})
+
+	// Publication workflow
+	gen.Describe(contentHandler.GetContentMovies, openapi.Operation{
+		Summary:  "List movies in the publication workflow",
+		Query:    []openapi.Param{{Name: "status", Type: "string", Description: "draft, in_review, scheduled, published or archived (default: draft and in_review)"}},
+		Response: []models.Movie{},
+	})
+	gen.Describe(contentHandler.CreateDraft, openapi.Operation{Summary: "Create a draft movie", Request: handlers2.CreateMovieRequest{}, Response: models.Movie{}, Status: http.StatusCreated})
+	gen.Describe(contentHandler.UpdateDraft, openapi.Operation{
+		Summary:     "Update a movie in the publication workflow",
+		Description: "Editors may only change drafts.",
+		Request:     handlers2.UpdateMovieRequest{},
+		Response:    models.Movie{},
+	})
+	gen.Describe(contentHandler.SetMovieStatus, openapi.Operation{
+		Summary:     "Move a movie through the publication workflow",
+		Description: "Editors submit drafts for review and withdraw them; publishers publish, schedule, send back, archive and revive movies. Scheduling takes publish_at.",
+		Request:     handlers2.SetMovieStatusRequest{},
+		Response:    models.Movie{},
+	})
+	gen.Describe(contentHandler.PublishMovie, openapi.Operation{Summary: "Publish a movie", Response: models.Movie{}})
+	gen.Describe(contentHandler.ScheduleMovie, openapi.Operation{
+		Summary:     "Schedule a movie",
+		Description: "The movie is published by a background job once publish_at has passed.",
+		Request:     handlers2.ScheduleMovieRequest{},
+		Response:    models.Movie{},
+	})
+	gen.Describe(contentHandler.ArchiveMovie, openapi.Operation{Summary: "Archive a movie", Response: models.Movie{}})
+
+	// Video uploads
+	videos := []string{"videos"}
+	gen.Describe(videoHandler.GetVideo, openapi.Operation{
+		Summary:     "Get the video processing status of a movie",
+		Description: "Poll until status is ready or failed. video_url stays the previous video until a new upload is ready.",
+		Tags:        videos,
+		Response:    services.VideoProcessing{},
+	})
+	gen.Describe(videoHandler.UploadVideo, openapi.Operation{
+		Summary:     "Upload the video of a movie",
+		Description: "Send the file as the body, with its video/* content type, to queue it for transcoding into HLS renditions. Prefer presigned uploads for large files.",
+		Tags:        videos,
+		Request:     []byte{},
+		RequestType: "video/*",
+		Response:    services.VideoProcessing{},
+		Status:      http.StatusAccepted,
+	})
+	gen.Describe(videoHandler.CreateVideoUpload, openapi.Operation{
+		Summary:     "Start a presigned video upload",
+		Description: "Returns a URL to PUT the video file to, straight to storage. Complete the upload once the file is there.",
+		Tags:        videos,
+		Response:    services.VideoUpload{},
+		Status:      http.StatusCreated,
+	})
+	gen.Describe(videoHandler.CompleteVideoUpload, openapi.Operation{
+		Summary:  "Complete a presigned video upload",
+		Tags:     videos,
+		Response: services.VideoProcessing{},
+		Status:   http.StatusAccepted,
+	})
+
+	// Playback
+	gen.Describe(playbackHandler.Play, openapi.Operation{
+		Summary:     "Get a signed playback URL",
+		Description: "The URL expires at expires_at. For HLS videos it is the master playlist, whose renditions and segments are reached through the same token, up to the max_height of the user's plan. While billing is enabled, only users with an active subscription get one, and no more than their plan's concurrent streams; the 429 problem lists the active_streams. Players send a heartbeat for session_id every heartbeat_interval seconds.",
+		Tags:        []string{"movies"},
+		Request:     handlers2.PlayRequest{},
+		Response:    services.Playback{},
+	})
+	gen.Describe(playbackHandler.ListStreams, openapi.Operation{Summary: "List active streams", Tags: []string{"movies"}, Response: []models.PlaybackSession{}})
+	gen.Describe(playbackHandler.Heartbeat, openapi.Operation{
+		Summary:     "Send a stream heartbeat",
+		Description: "Keeps a stream active while its video plays. A 404 means the stream has ended and the player stops.",
+		Tags:        []string{"movies"},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(playbackHandler.EndStream, openapi.Operation{
+		Summary:     "End a stream",
+		Description: "Frees its place among the concurrent streams of the user's plan. Its player stops at its next heartbeat.",
+		Tags:        []string{"movies"},
+		Status:      http.StatusNoContent,
+	})
+	gen.Describe(playbackHandler.Download, openapi.Operation{
+		Summary:     "Get a signed download URL",
+		Description: "Like the playback URL, but valid for playback.download_ttl and not counted as a stream, so players can keep the video to watch offline. Only for plans that include downloads.",
+		Tags:        []string{"movies"},
+		Response:    services.Playback{},
+	})
+	gen.Describe(playbackHandler.Stream, openapi.Operation{
+		Summary:     "Stream a video",
+		Description: "Streams the video a playback token grants access to, or an HLS playlist or segment next to it. Range requests are supported.",
+		Tags:        []string{"movies"},
+	})
+	gen.Describe(playbackHandler.StreamLocal, openapi.Operation{
+		Summary:     "Stream a local video file",
+		Description: "Streams the video of a movie stored as a local file, for signed-in users with an active subscription while billing is enabled, or holders of a playback token of the movie. Range requests are supported, so players can seek.",
+		Tags:        []string{"movies"},
+		Query: []openapi.Param{
+			{Name: "token", Type: "string", Description: "Playback token, when not signed in"},
+		},
+	})
+
+	// Subtitles
+	subtitles := []string{"subtitles"}
+	gen.Describe(subtitleHandler.GetSubtitles, openapi.Operation{
+		Summary:     "List the subtitle tracks of a movie",
+		Description: "Each track is served as WebVTT from its url, for players to offer as captions.",
+		Tags:        subtitles,
+		Response:    []handlers2.SubtitleResponse{},
+	})
+	gen.Describe(subtitleHandler.GetSubtitle, openapi.Operation{
+		Summary:     "Get a subtitle track as WebVTT",
+		Description: "Responds with text/vtt. Conditional requests are supported.",
+		Tags:        subtitles,
+	})
+	gen.Describe(subtitleHandler.PutSubtitle, openapi.Operation{
+		Summary:     "Upload a subtitle track",
+		Description: "Stores an SRT or WebVTT file in UTF-8, sent as the subtitle form field, as the movie's track in the language, converting SRT to WebVTT. Replaces any track in that language.",
+		Tags:        subtitles,
+		Request: struct {
+			Subtitle []byte `json:"subtitle"`
+			Label    string `json:"label,omitempty"`
+		}{},
+		RequestType: "multipart/form-data",
+		Response:    handlers2.SubtitleResponse{},
+	})
+	gen.Describe(subtitleHandler.DeleteSubtitle, openapi.Operation{
+		Summary: "Delete a subtitle track",
+		Tags:    subtitles,
+		Status:  http.StatusNoContent,
+	})
+
+	// Movie translations
+	translations := []string{"translations"}
+	gen.Describe(translationHandler.GetTranslations, openapi.Operation{
+		Summary:  "List the translations of a movie",
+		Tags:     translations,
+		Response: []models.MovieTranslation{},
+	})
+	gen.Describe(translationHandler.PutTranslation, openapi.Operation{
+		Summary:     "Translate a movie",
+		Description: "Sets the title and description shown to clients asking for the locale with Accept-Language or the lang query parameter. Empty fields fall back to the movie's own.",
+		Tags:        translations,
+		Request:     handlers2.TranslationRequest{},
+		Response:    models.MovieTranslation{},
+	})
+	gen.Describe(translationHandler.DeleteTranslation, openapi.Operation{
+		Summary: "Delete a translation of a movie",
+		Tags:    translations,
+		Status:  http.StatusNoContent,
+	})
+
+	// Imports
+	gen.Describe(importHandler.ImportTMDB, openapi.Operation{
+		Summary:     "Import a movie from TMDB",
+		Description: "Creates or updates the movie imported from the TMDB ID, mapping its genres to local categories. Responds with 201 when the movie was created.",
+		Response:    handlers2.TMDBImportResponse{},
+	})
+
+	// Notifications
+	notifications := []string{"notifications"}
+	gen.Describe(notificationHandler.Connect, openapi.Operation{
+		Summary:     "Receive notifications over WebSocket",
+		Description: "Upgrades to a WebSocket. Clients send an auth message with their access token, are answered with a ready message, then receive events: movie.added, video.ready and video.failed (admins only) and announcement.",
+		Tags:        notifications,
+		Status:      http.StatusSwitchingProtocols,
+	})
+	gen.Describe(notificationHandler.Announce, openapi.Operation{
+		Summary:     "Send an announcement",
+		Description: "Pushes an announcement event to the connected clients: everyone, only admins, or only the user with user_id.",
+		Tags:        notifications,
+		Request:     handlers2.AnnouncementRequest{},
+		Status:      http.StatusAccepted,
+	})
+
+	// Server-Sent Events
+	gen.Describe(eventHandler.Releases, openapi.Operation{
+		Summary:     "Stream new releases",
+		Description: "A text/event-stream with a release event, whose data is the movie, every time a movie is added to the public catalog. Only movies added after connecting are sent.",
+		Tags:        []string{"movies"},
+	})
+}
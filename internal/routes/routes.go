@@ -1,101 +1,481 @@
 package routes
 
 import (
+	"github.com/ndn/internal/conditional"
+	"github.com/ndn/internal/deprecation"
+	"github.com/ndn/internal/dryrun"
+	"github.com/ndn/internal/entitlements"
+	"github.com/ndn/internal/errorreporting"
 	handlers2 "github.com/ndn/internal/handlers"
+	"github.com/ndn/internal/health"
+	"github.com/ndn/internal/i18n"
+	"github.com/ndn/internal/metrics"
+	newrelic2 "github.com/ndn/internal/newrelic"
+	"github.com/ndn/internal/openapi"
+	"github.com/ndn/internal/otel"
+	"github.com/ndn/internal/ratelimit"
+	"github.com/ndn/internal/replay"
+	"github.com/ndn/internal/requestlog"
+	"github.com/ndn/internal/tracecontext"
+	"github.com/ndn/internal/webhook"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/newrelic/go-agent/v3/newrelic"
 	httpSwagger "github.com/swaggo/http-swagger/v2"
+	"go.uber.org/zap"
 )
 
-// SetupRoutes configures all the routes for the application
+// SetupRoutes configures all the routes for the application. The OpenAPI
+// document served at /openapi.json is generated from the resulting router.
 func SetupRoutes(
 	authHandler *handlers2.AuthHandler,
 	movieHandler *handlers2.MovieHandler,
 	categoryHandler *handlers2.CategoryHandler,
 	userHandler *handlers2.UserHandler,
-) *chi.Mux {
+	healthHandler *handlers2.HealthHandler,
+	apiKeyHandler *handlers2.APIKeyHandler,
+	analyticsHandler *handlers2.AnalyticsHandler,
+	boostHandler *handlers2.BoostHandler,
+	recommendationHandler *handlers2.RecommendationHandler,
+	searchHandler *handlers2.SearchHandler,
+	moderationHandler *handlers2.ModerationHandler,
+	contentHandler *handlers2.ContentHandler,
+	historyHandler *handlers2.WatchHistoryHandler,
+	reviewHandler *handlers2.ReviewHandler,
+	oauthHandler *handlers2.OAuthHandler,
+	seriesHandler *handlers2.SeriesHandler,
+	videoHandler *handlers2.VideoHandler,
+	playbackHandler *handlers2.PlaybackHandler,
+	subtitleHandler *handlers2.SubtitleHandler,
+	translationHandler *handlers2.TranslationHandler,
+	importHandler *handlers2.ImportHandler,
+	notificationHandler *handlers2.NotificationHandler,
+	eventHandler *handlers2.EventHandler,
+	profileHandler *handlers2.ProfileHandler,
+	billingHandler *handlers2.BillingHandler,
+	dataExportHandler *handlers2.DataExportHandler,
+	collectionHandler *handlers2.CollectionHandler,
+	featuredHandler *handlers2.FeaturedHandler,
+	auditHandler *handlers2.AuditHandler,
+	checker *health.Checker,
+	limiter *ratelimit.Limiter,
+	nonces *replay.Store,
+	webhooks *webhook.Verifier,
+	deprecations *deprecation.Tracker,
+	appMetrics *metrics.Metrics,
+	tracing *otel.Tracing,
+	reporter *errorreporting.Reporter,
+	nrApp *newrelic.Application,
+	logger *zap.Logger,
+) (*chi.Mux, error) {
 	r := chi.NewRouter()
 
-	// Basic middleware
-	r.Use(middleware.Logger)
-	r.Use(middleware.Recoverer)
+	// Basic middleware. Requests are logged with their ID and client
+	// address, and panics recovered inside so they are logged as 500s;
+	// panics and server errors are reported with the request and user.
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
+	r.Use(requestlog.Middleware(logger))
+	r.Use(reporter.Middleware)
+	r.Use(appMetrics.Middleware)
+	r.Use(tracecontext.Middleware)
+	r.Use(tracing.Middleware)
+	r.Use(newrelic2.Middleware(nrApp))
+	r.Use(i18n.Middleware)
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	// CORS middleware
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Traceparent", "Tracestate", handlers2.APIKeyHeader, replay.TimestampHeader, replay.NonceHeader, replay.SignatureHeader, dryrun.Header},
+		ExposedHeaders:   []string{"Link", "Deprecation", "Sunset", "X-Quota-Limit", "X-Quota-Remaining", "X-Quota-Reset", dryrun.Header},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	// Prometheus metrics
+	if appMetrics.Enabled() {
+		r.Handle(appMetrics.Path(), appMetrics.Handler())
+	}
+
 	// Swagger documentation
 	r.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
 	))
 
-	// API routes
+	gen := openapi.NewGenerator("NDN API", "1.0")
+	describeRoutes(gen, deprecations, authHandler, movieHandler, categoryHandler, userHandler, healthHandler, apiKeyHandler, analyticsHandler, boostHandler, recommendationHandler, searchHandler, moderationHandler, contentHandler, historyHandler, reviewHandler, oauthHandler, seriesHandler, videoHandler, playbackHandler, subtitleHandler, translationHandler, importHandler, notificationHandler, eventHandler, profileHandler, billingHandler, dataExportHandler, collectionHandler, featuredHandler, auditHandler)
+
+	// Health probes
+	r.Get("/health/live", healthHandler.Live)
+	r.Get("/health/ready", healthHandler.Ready)
+
+	// Public keys of access tokens, for other services
+	r.Get("/.well-known/jwks.json", authHandler.JWKS)
+
+	// API routes. Routes being retired are registered with
+	// r.With(deprecations.Deprecate(deprecation.Policy{...})) so callers are
+	// told about the replacement and still-active clients are logged.
 	r.Route("/api", func(r chi.Router) {
-		// Public routes
+		// Meter partner requests before rate limiting so limits apply per key
+		r.Use(apiKeyHandler.QuotaMiddleware)
+		// Reject replayed mutations made with an API key
+		r.Use(nonces.Middleware)
+
+		// Routes kept writable whatever the health of the dependencies, so
+		// users can still sign in and no event from Stripe is refused
 		r.Group(func(r chi.Router) {
+			r.Use(limiter.Middleware(ratelimit.DefaultGroup))
+
 			// Auth routes
-			r.Post("/auth/register", authHandler.Register)
-			r.Post("/auth/login", authHandler.Login)
-			r.Post("/auth/refresh", authHandler.Refresh)
+			r.Group(func(r chi.Router) {
+				r.Use(limiter.Middleware("auth"))
+
+				r.Post("/auth/register", authHandler.Register)
+				r.Post("/auth/login", authHandler.Login)
+				r.Post("/auth/refresh", authHandler.Refresh)
+				r.Post("/auth/logout", authHandler.Logout)
+				r.With(authHandler.AuthMiddleware).Post("/auth/logout-all", authHandler.LogoutAll)
+				r.Post("/auth/forgot-password", authHandler.ForgotPassword)
+				r.Post("/auth/reset-password", authHandler.ResetPassword)
+				r.Post("/auth/confirm-email", authHandler.ConfirmEmail)
+				r.Get("/auth/oauth/{provider}/login", oauthHandler.Login)
+				r.Get("/auth/oauth/{provider}/callback", oauthHandler.Callback)
+			})
+
+			// Events from Stripe, verified by their signature
+			r.With(webhooks.Middleware(webhook.ProviderStripe)).Post("/billing/webhook", billingHandler.Webhook)
+		})
+
+		// Public routes, limited by client IP or API key. Like every route
+		// below, they refuse writes while a critical dependency is down.
+		r.Group(func(r chi.Router) {
+			r.Use(checker.ReadOnlyWhenDown)
+			r.Use(limiter.Middleware(ratelimit.DefaultGroup))
+
+			// Notifications, authenticated over the connection
+			r.Get("/ws", notificationHandler.Connect)
+
+			// Server-Sent Events
+			r.Get("/events/releases", eventHandler.Releases)
 
 			// Movie routes
-			r.Get("/movies", movieHandler.GetMovies)
-			r.Get("/movies/{id}", movieHandler.GetMovie)
+			// Restricted to the rating ceiling of the profile, when signed in
+			// as one
+			r.With(authHandler.OptionalAuthMiddleware, limiter.Middleware("search")).Get("/movies", movieHandler.GetMovies)
+			r.With(authHandler.OptionalAuthMiddleware).Get("/movies/batch", movieHandler.GetMoviesBatch)
+			r.With(authHandler.OptionalAuthMiddleware).Post("/movies/batch", movieHandler.PostMoviesBatch)
+			r.With(conditional.Middleware).Get("/movies/{id}", movieHandler.GetMovie)
 			r.Get("/movies/top-rated", movieHandler.GetTopRatedMovies)
 			r.Get("/movies/recently-added", movieHandler.GetRecentlyAddedMovies)
+			r.Get("/movies/trending", movieHandler.GetTrendingMovies)
+			r.Get("/movies/upcoming", movieHandler.GetUpcomingMovies)
+			r.Get("/movies/{id}/similar", movieHandler.GetSimilarMovies)
+			r.Get("/movies/{id}/reviews", reviewHandler.GetReviews)
+			r.Get("/movies/{id}/subtitles", subtitleHandler.GetSubtitles)
+			r.Get("/movies/{id}/subtitles/{language}", subtitleHandler.GetSubtitle)
+
+			// Search across movies and categories
+			r.With(limiter.Middleware("search")).Get("/search", searchHandler.Search)
+
+			// TV series routes
+			r.Get("/series", seriesHandler.ListSeries)
+			r.Get("/series/{id}", seriesHandler.GetSeries)
+			r.Get("/series/{id}/seasons/{number}", seriesHandler.GetSeason)
+			r.Get("/episodes/{id}", seriesHandler.GetEpisode)
 
 			// Category routes
-			r.Get("/categories", categoryHandler.GetCategories)
-			r.Get("/categories/{id}", categoryHandler.GetCategory)
+			r.With(conditional.Middleware).Get("/categories", categoryHandler.GetCategories)
+			r.With(conditional.Middleware).Get("/categories/{id}", categoryHandler.GetCategory)
+			r.With(conditional.Middleware).Get("/categories/slug/{slug}", categoryHandler.GetCategoryBySlug)
+
+			// Curated collections, the rows of the home page. Restricted to
+			// the rating ceiling of the profile, when signed in as one
+			r.With(authHandler.OptionalAuthMiddleware, conditional.Middleware).Get("/collections", collectionHandler.GetCollections)
+			r.With(authHandler.OptionalAuthMiddleware, conditional.Middleware).Get("/collections/{slug}", collectionHandler.GetCollection)
+			r.With(authHandler.OptionalAuthMiddleware).Get("/featured", featuredHandler.GetFeatured)
+
+			// Recommendations, personalised when signed in
+			r.With(authHandler.OptionalAuthMiddleware).Get("/recommendations", recommendationHandler.GetRecommendations)
+
+			// Client analytics, attributed to the user when signed in
+			r.With(authHandler.OptionalAuthMiddleware, limiter.Middleware("analytics")).
+				Post("/analytics/events", analyticsHandler.IngestEvents)
+
+			// Video streams, authorised by the signed token in their path
+			r.Get("/stream/{token}/*", playbackHandler.Stream)
+			// Local video files, by playback token or for signed-in
+			// subscribers playing a stream of them
+			r.With(authHandler.OptionalAuthMiddleware, billingHandler.EntitlementsMiddleware).
+				Get("/stream/{movieID}", playbackHandler.StreamLocal)
+
+			// Subscription plans
+			r.Get("/billing/plans", billingHandler.GetPlans)
 		})
 
-		// Protected routes
+		// Protected routes, limited by user and scaled by their plan
 		r.Group(func(r chi.Router) {
+			r.Use(checker.ReadOnlyWhenDown)
 			r.Use(authHandler.AuthMiddleware)
+			r.Use(limiter.Middleware(ratelimit.DefaultGroup))
+
+			// Personalised recommendations
+			r.Get("/movies/recommended", recommendationHandler.GetRecommendedMovies)
+
+			// Signed playback URLs, for subscribers, and download URLs for
+			// the ones whose plan includes downloads
+			r.Group(func(r chi.Router) {
+				r.Use(limiter.Middleware("playback"))
+				r.Use(billingHandler.EntitlementsMiddleware)
+
+				r.Post("/movies/{id}/play", playbackHandler.Play)
+				r.With(entitlements.Require(entitlements.Downloads)).Post("/movies/{id}/download", playbackHandler.Download)
+			})
+
+			// Streams being played, kept active by their players' heartbeats
+			r.Route("/playback/sessions", func(r chi.Router) {
+				r.Get("/", playbackHandler.ListStreams)
+				r.Post("/{id}/heartbeat", playbackHandler.Heartbeat)
+				r.Delete("/{id}", playbackHandler.EndStream)
+			})
+
+			// Subscriptions, and what their plan entitles to
+			r.Get("/billing/subscription", billingHandler.GetSubscription)
+			r.With(billingHandler.EntitlementsMiddleware).Get("/billing/entitlements", billingHandler.GetEntitlements)
+			r.Post("/billing/checkout", billingHandler.Checkout)
+			r.Post("/billing/portal", billingHandler.Portal)
+			r.Post("/billing/coupons/redeem", billingHandler.RedeemCoupon)
 
 			// User routes
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/profile", userHandler.GetProfile)
 				r.Put("/profile", userHandler.UpdateProfile)
+				r.Patch("/profile", userHandler.PatchProfile)
+				r.Delete("/profile", authHandler.DeleteAccount)
+				r.With(dryrun.Unsupported).Post("/profile/avatar", userHandler.UploadAvatar)
+				r.Get("/profile/details", userHandler.GetProfileDetails)
+				r.With(dryrun.Unsupported).Put("/profile/details", userHandler.UpdateProfileDetails)
+				r.With(dryrun.Unsupported).Put("/email", authHandler.ChangeEmail)
+				// Takes the current password, limited against guessing
+				r.With(dryrun.Unsupported, limiter.Middleware("auth")).Put("/password", authHandler.ChangePassword)
+				r.Get("/stats", analyticsHandler.GetUserStats)
+				r.Post("/watch-history", historyHandler.RecordProgress)
+				r.Get("/continue-watching", historyHandler.GetContinueWatching)
+
+				// Devices signed in, which can be signed out
+				r.Get("/devices", authHandler.ListDevices)
+				r.Delete("/devices/{id}", authHandler.RevokeDevice)
+
+				// Archives of the user's data
+				r.With(dryrun.Unsupported).Post("/export", dataExportHandler.RequestExport)
+				r.Get("/export/{id}", dataExportHandler.GetExport)
+
+				// Viewer profiles
+				r.Get("/profiles", profileHandler.GetProfiles)
+				r.Post("/profiles", profileHandler.CreateProfile)
+				r.Get("/profiles/{id}", profileHandler.GetProfile)
+				// Routes taking a parental PIN, limited against guessing
+				r.Group(func(r chi.Router) {
+					r.Use(limiter.Middleware("pin"))
+					r.Post("/profiles/select", profileHandler.SelectProfile)
+					r.Put("/profiles/{id}", profileHandler.UpdateProfile)
+					r.Delete("/profiles/{id}", profileHandler.DeleteProfile)
+					r.Put("/profiles/{id}/pin", profileHandler.SetProfilePIN)
+				})
+			})
+
+			// Reviews by the authenticated user
+			r.Post("/movies/{id}/reviews", reviewHandler.CreateReview)
+			r.Put("/movies/{id}/reviews/{reviewID}", reviewHandler.UpdateReview)
+			r.Delete("/movies/{id}/reviews/{reviewID}", reviewHandler.DeleteReview)
+
+			// Publication workflow for editors and publishers
+			r.Route("/content", func(r chi.Router) {
+				r.Use(contentHandler.RoleMiddleware)
+
+				r.Get("/movies", contentHandler.GetContentMovies)
+				r.Post("/movies", contentHandler.CreateDraft)
+				r.Put("/movies/{id}", contentHandler.UpdateDraft)
+				r.Put("/movies/{id}/status", contentHandler.SetMovieStatus)
 			})
 
 			// Admin routes
 			r.Route("/admin", func(r chi.Router) {
 				r.Use(authHandler.AdminMiddleware)
+				r.Use(dryrun.Middleware)
+				r.Use(auditHandler.Middleware)
 
 				// Movie management
 				r.Route("/movies", func(r chi.Router) {
+					r.Get("/", movieHandler.AdminGetMovies)
 					r.Post("/", movieHandler.CreateMovie)
+					r.Post("/bulk-delete", movieHandler.BulkDeleteMovies)
+					r.Post("/bulk-restore", movieHandler.BulkRestoreMovies)
+					r.Post("/bulk-categories", movieHandler.BulkAssignCategory)
+					r.Get("/embeddings", movieHandler.GetEmbeddingJob)
+					r.With(dryrun.Unsupported).Post("/embeddings", movieHandler.ComputeEmbeddings)
+					r.Put("/by-external/{source}/{id}", movieHandler.UpsertMovieByExternalID)
+					r.Post("/import/tmdb/{tmdbID}", importHandler.ImportTMDB)
 					r.Put("/{id}", movieHandler.UpdateMovie)
+					r.Patch("/{id}", movieHandler.PatchMovie)
 					r.Delete("/{id}", movieHandler.DeleteMovie)
+					r.Post("/{id}/restore", movieHandler.RestoreMovie)
+					r.Post("/{id}/publish", contentHandler.PublishMovie)
+					r.Post("/{id}/schedule", contentHandler.ScheduleMovie)
+					r.Post("/{id}/archive", contentHandler.ArchiveMovie)
+					r.With(dryrun.Unsupported).Post("/{id}/poster", movieHandler.UploadPoster)
+					r.Get("/{id}/video", videoHandler.GetVideo)
+					r.With(dryrun.Unsupported).Put("/{id}/video", videoHandler.UploadVideo)
+					r.With(dryrun.Unsupported).Post("/{id}/video/uploads", videoHandler.CreateVideoUpload)
+					r.With(dryrun.Unsupported).Post("/{id}/video/uploads/complete", videoHandler.CompleteVideoUpload)
+					r.Put("/{id}/subtitles/{language}", subtitleHandler.PutSubtitle)
+					r.Delete("/{id}/subtitles/{language}", subtitleHandler.DeleteSubtitle)
+					r.Get("/{id}/translations", translationHandler.GetTranslations)
+					r.Put("/{id}/translations/{locale}", translationHandler.PutTranslation)
+					r.Delete("/{id}/translations/{locale}", translationHandler.DeleteTranslation)
+					r.Get("/{id}/engagement", analyticsHandler.MovieEngagement)
+				})
+
+				// TV series management
+				r.Route("/series", func(r chi.Router) {
+					r.Post("/", seriesHandler.CreateSeries)
+					r.Put("/{id}", seriesHandler.UpdateSeries)
+					r.Delete("/{id}", seriesHandler.DeleteSeries)
+					r.Post("/{id}/seasons", seriesHandler.CreateSeason)
+				})
+				r.Route("/seasons", func(r chi.Router) {
+					r.Put("/{id}", seriesHandler.UpdateSeason)
+					r.Delete("/{id}", seriesHandler.DeleteSeason)
+					r.Post("/{id}/episodes", seriesHandler.CreateEpisode)
+				})
+				r.Route("/episodes", func(r chi.Router) {
+					r.Put("/{id}", seriesHandler.UpdateEpisode)
+					r.Delete("/{id}", seriesHandler.DeleteEpisode)
+				})
+
+				// Editorial boosts and pins
+				r.Route("/boosts", func(r chi.Router) {
+					r.Get("/", boostHandler.ListBoosts)
+					r.Post("/", boostHandler.CreateBoost)
+					r.Put("/{id}", boostHandler.UpdateBoost)
+					r.Delete("/{id}", boostHandler.DeleteBoost)
+				})
+
+				// Curated collections
+				r.Route("/collections", func(r chi.Router) {
+					r.Get("/", collectionHandler.AdminGetCollections)
+					r.Post("/", collectionHandler.CreateCollection)
+					r.Put("/order", collectionHandler.ReorderCollections)
+					r.Put("/{id}", collectionHandler.UpdateCollection)
+					r.Put("/{id}/movies", collectionHandler.SetCollectionMovies)
+					r.Delete("/{id}", collectionHandler.DeleteCollection)
+				})
+
+				// Featured banners
+				r.Route("/featured", func(r chi.Router) {
+					r.Get("/", featuredHandler.ListFeaturedSlots)
+					r.Post("/", featuredHandler.CreateFeaturedSlot)
+					r.Put("/{id}", featuredHandler.UpdateFeaturedSlot)
+					r.Delete("/{id}", featuredHandler.DeleteFeaturedSlot)
 				})
 
+				// Moderation queue of flagged user-generated text
+				r.Route("/moderation", func(r chi.Router) {
+					r.Post("/check", moderationHandler.CheckText)
+					r.Get("/flags", moderationHandler.GetFlags)
+					r.Put("/flags/{id}", moderationHandler.ResolveFlag)
+				})
+
+				// Search synonym dictionary
+				r.Route("/search/synonyms", func(r chi.Router) {
+					r.Get("/", searchHandler.GetSynonyms)
+					r.Post("/", searchHandler.CreateSynonym)
+					r.Put("/{id}", searchHandler.UpdateSynonym)
+					r.Delete("/{id}", searchHandler.DeleteSynonym)
+				})
+
+				// Announcements pushed to connected clients
+				r.With(dryrun.Unsupported).Post("/announcements", notificationHandler.Announce)
+
+				// Trending score parameters
+				r.Get("/trending/settings", movieHandler.GetTrendingSettings)
+				r.Put("/trending/settings", movieHandler.UpdateTrendingSettings)
+
 				// Category management
 				r.Route("/categories", func(r chi.Router) {
+					r.Get("/", categoryHandler.AdminGetCategories)
 					r.Post("/", categoryHandler.CreateCategory)
+					r.Get("/stats", categoryHandler.GetCategoryStats)
+					r.Put("/order", categoryHandler.ReorderCategories)
+					r.Put("/{id}", categoryHandler.UpdateCategory)
+					r.Put("/{id}/visibility", categoryHandler.SetCategoryVisibility)
 					r.Delete("/{id}", categoryHandler.DeleteCategory)
+					r.Post("/{id}/restore", categoryHandler.RestoreCategory)
 				})
 
 				// User management
 				r.Route("/users", func(r chi.Router) {
 					r.Get("/", userHandler.ListUsers)
+					r.Post("/", userHandler.CreateUser)
 					r.Get("/{id}", userHandler.GetUser)
+					r.Patch("/{id}", userHandler.UpdateUserStatus)
+					r.Delete("/{id}", userHandler.DeleteUser)
+					r.Post("/{id}/restore", userHandler.RestoreUser)
+					r.Put("/{id}/role", userHandler.SetUserRole)
+					r.Post("/{id}/unlock", authHandler.UnlockUser)
+				})
+
+				// Subscription plans
+				r.Route("/plans", func(r chi.Router) {
+					r.Get("/", billingHandler.AdminGetPlans)
+					r.Put("/{code}", billingHandler.PutPlan)
 				})
+
+				// Promo codes, backed by Stripe coupons
+				r.Route("/coupons", func(r chi.Router) {
+					r.Get("/", billingHandler.ListCoupons)
+					r.With(dryrun.Unsupported).Post("/", billingHandler.CreateCoupon)
+					r.Get("/{code}", billingHandler.GetCoupon)
+					r.Put("/{code}", billingHandler.UpdateCoupon)
+					r.With(dryrun.Unsupported).Delete("/{code}", billingHandler.DeleteCoupon)
+				})
+
+				// API key management
+				r.Route("/api-keys", func(r chi.Router) {
+					r.With(dryrun.Unsupported).Post("/", apiKeyHandler.CreateAPIKey)
+					r.Get("/", apiKeyHandler.ListAPIKeys)
+					r.Delete("/{id}", apiKeyHandler.RevokeAPIKey)
+					r.Get("/{id}/usage", apiKeyHandler.GetUsage)
+				})
+
+				// Analytics reports
+				r.Route("/analytics", func(r chi.Router) {
+					r.Get("/active-users", analyticsHandler.ActiveUsers)
+					r.Get("/signups", analyticsHandler.SignupFunnel)
+					r.Get("/retention", analyticsHandler.Retention)
+					r.Get("/watch-time", analyticsHandler.WatchTime)
+					r.Get("/top-titles", analyticsHandler.TopTitles)
+					r.Get("/recommendation-reasons", analyticsHandler.RecommendationReasons)
+					r.Get("/exports", analyticsHandler.ListExports)
+					r.With(dryrun.Unsupported).Post("/exports/{sink}/backfill", analyticsHandler.BackfillExport)
+				})
+
+				// Audit log of admin mutations
+				r.Get("/audit-logs", auditHandler.ListAuditLogs)
 			})
 		})
 	})
 
-	return r
+	// OpenAPI document, generated last so it covers every route above
+	spec, err := gen.Handler(r)
+	if err != nil {
+		return nil, err
+	}
+	r.Get("/openapi.json", spec)
+
+	return r, nil
 }
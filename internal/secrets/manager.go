@@ -3,6 +3,7 @@ package secrets
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/ndn/internal/jwtkeys"
 	"os"
 	"path/filepath"
 	"sync"
@@ -19,6 +20,12 @@ type Secrets struct {
 	AdminAPIKey   string `json:"admin_api_key"`
 	StorageKey    string `json:"storage_key"`
 	EncryptionKey string `json:"encryption_key"`
+	// ErrorReportingDSN is the DSN of the Sentry project panics and server
+	// errors are reported to
+	ErrorReportingDSN string `json:"error_reporting_dsn,omitempty"`
+	// JWTSigningKeys are the RSA keys of RS256 access tokens. Keys retired
+	// from signing stay listed until the tokens they signed have expired.
+	JWTSigningKeys []jwtkeys.SigningKey `json:"jwt_signing_keys,omitempty"`
 }
 
 var (
@@ -72,6 +79,9 @@ func (m *Manager) LoadSecrets() error {
 	if envEncryption := os.Getenv("ENCRYPTION_KEY"); envEncryption != "" {
 		secrets.EncryptionKey = envEncryption
 	}
+	if envDSN := os.Getenv("ERROR_REPORTING_DSN"); envDSN != "" {
+		secrets.ErrorReportingDSN = envDSN
+	}
 
 	m.secrets = &secrets
 	return nil
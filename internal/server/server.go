@@ -2,12 +2,25 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/ndn/internal/config"
 	"github.com/ndn/internal/container"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/deprecation"
+	"github.com/ndn/internal/errorreporting"
+	"github.com/ndn/internal/grpcserver"
 	handlers2 "github.com/ndn/internal/handlers"
+	"github.com/ndn/internal/health"
+	"github.com/ndn/internal/metrics"
+	"github.com/ndn/internal/notifications"
+	"github.com/ndn/internal/otel"
+	"github.com/ndn/internal/ratelimit"
+	"github.com/ndn/internal/replay"
 	"github.com/ndn/internal/routes"
+	"github.com/ndn/internal/services"
+	"github.com/ndn/internal/webhook"
 	"net/http"
 	"os"
 	"os/signal"
@@ -20,17 +33,37 @@ import (
 )
 
 type Server struct {
-	router *chi.Mux
-	logger *zap.Logger
-	nrApp  *newrelic.Application
-	config *config.Config
-	server *http.Server
+	router       *chi.Mux
+	logger       *zap.Logger
+	nrApp        *newrelic.Application
+	config       *config.Config
+	checker      *health.Checker
+	limiter      *ratelimit.Limiter
+	nonces       *replay.Store
+	deprecations *deprecation.Tracker
+	tracing      *otel.Tracing
+	reporter     *errorreporting.Reporter
+	replicas     *database.Replicas
+	analytics    *services.AnalyticsService
+	rollups      *services.RollupService
+	exports      *services.ExportService
+	embeddings   *services.EmbeddingService
+	trending     *services.TrendingService
+	workflow     *services.WorkflowService
+	trash        *services.TrashService
+	users        *services.UserService
+	videos       *services.VideoService
+	dataExports  *services.DataExportService
+	hub          *notifications.Hub
+	releases     *services.ReleaseFeed
+	server       *http.Server
+	grpc         *grpcserver.Server // nil when disabled
 }
 
 // New creates a new server instance with all dependencies
-func New() (*Server, error) {
+func New(opts container.Options) (*Server, error) {
 	// Initialize container with all dependencies
-	c := container.BuildContainer()
+	c := container.BuildContainer(opts)
 
 	// Get dependencies from container
 	var (
@@ -53,36 +86,194 @@ func New() (*Server, error) {
 
 	// Get handlers
 	var (
-		authHandler     *handlers2.AuthHandler
-		movieHandler    *handlers2.MovieHandler
-		categoryHandler *handlers2.CategoryHandler
-		userHandler     *handlers2.UserHandler
+		authHandler         *handlers2.AuthHandler
+		movieHandler        *handlers2.MovieHandler
+		categoryHandler     *handlers2.CategoryHandler
+		userHandler         *handlers2.UserHandler
+		healthHandler       *handlers2.HealthHandler
+		apiKeyHandler       *handlers2.APIKeyHandler
+		analyticsHandler    *handlers2.AnalyticsHandler
+		boostHandler        *handlers2.BoostHandler
+		recHandler          *handlers2.RecommendationHandler
+		searchHandler       *handlers2.SearchHandler
+		modHandler          *handlers2.ModerationHandler
+		contentHandler      *handlers2.ContentHandler
+		historyHandler      *handlers2.WatchHistoryHandler
+		reviewHandler       *handlers2.ReviewHandler
+		oauthHandler        *handlers2.OAuthHandler
+		seriesHandler       *handlers2.SeriesHandler
+		videoHandler        *handlers2.VideoHandler
+		playbackHandler     *handlers2.PlaybackHandler
+		subtitleHandler     *handlers2.SubtitleHandler
+		translationHandler  *handlers2.TranslationHandler
+		importHandler       *handlers2.ImportHandler
+		notificationHandler *handlers2.NotificationHandler
+		eventHandler        *handlers2.EventHandler
+		profileHandler      *handlers2.ProfileHandler
+		billingHandler      *handlers2.BillingHandler
+		dataExportHandler   *handlers2.DataExportHandler
+		collectionHandler   *handlers2.CollectionHandler
+		featuredHandler     *handlers2.FeaturedHandler
+		auditHandler        *handlers2.AuditHandler
+		checker             *health.Checker
+		limiter             *ratelimit.Limiter
+		nonces              *replay.Store
+		webhooks            *webhook.Verifier
+		deprecations        *deprecation.Tracker
+		appMetrics          *metrics.Metrics
+		tracing             *otel.Tracing
+		reporter            *errorreporting.Reporter
+		replicas            *database.Replicas
+		analytics           *services.AnalyticsService
+		rollups             *services.RollupService
+		exports             *services.ExportService
+		embeddings          *services.EmbeddingService
+		trending            *services.TrendingService
+		workflow            *services.WorkflowService
+		trash               *services.TrashService
+		users               *services.UserService
+		videos              *services.VideoService
+		dataExports         *services.DataExportService
+		hub                 *notifications.Hub
+		releases            *services.ReleaseFeed
+		grpcServer          *grpcserver.Server
 	)
 
 	if err := c.Invoke(func(
-		ah *handlers2.AuthHandler, mh *handlers2.MovieHandler, ch *handlers2.CategoryHandler, uh *handlers2.UserHandler) {
+		ah *handlers2.AuthHandler, mh *handlers2.MovieHandler, ch *handlers2.CategoryHandler, uh *handlers2.UserHandler,
+		hh *handlers2.HealthHandler, kh *handlers2.APIKeyHandler, hc *health.Checker, rl *ratelimit.Limiter,
+		ns *replay.Store, wv *webhook.Verifier, dt *deprecation.Tracker, am *metrics.Metrics, tr *otel.Tracing, er *errorreporting.Reporter, rp *database.Replicas, eh *handlers2.AnalyticsHandler, es *services.AnalyticsService,
+		rs *services.RollupService, xs *services.ExportService, ms *services.EmbeddingService,
+		ts *services.TrendingService, us *services.UserService, vs *services.VideoService, ds *services.DataExportService, wf *services.WorkflowService, tb *services.TrashService, bh *handlers2.BoostHandler,
+		rh *handlers2.RecommendationHandler, sh *handlers2.SearchHandler, oh *handlers2.ModerationHandler,
+		wh *handlers2.ContentHandler, vh *handlers2.WatchHistoryHandler,
+		vw *handlers2.ReviewHandler, oa *handlers2.OAuthHandler, sr *handlers2.SeriesHandler, vd *handlers2.VideoHandler, pb *handlers2.PlaybackHandler, st *handlers2.SubtitleHandler, mt *handlers2.TranslationHandler, im *handlers2.ImportHandler, nh *handlers2.NotificationHandler, ev *handlers2.EventHandler, ph *handlers2.ProfileHandler, blh *handlers2.BillingHandler, deh *handlers2.DataExportHandler, clh *handlers2.CollectionHandler, fh *handlers2.FeaturedHandler, adh *handlers2.AuditHandler, nt *notifications.Hub, rf *services.ReleaseFeed, gs *grpcserver.Server) {
 		authHandler = ah
 		movieHandler = mh
 		categoryHandler = ch
 		userHandler = uh
+		healthHandler = hh
+		apiKeyHandler = kh
+		checker = hc
+		limiter = rl
+		nonces = ns
+		webhooks = wv
+		deprecations = dt
+		appMetrics = am
+		tracing = tr
+		reporter = er
+		replicas = rp
+		analyticsHandler = eh
+		analytics = es
+		rollups = rs
+		exports = xs
+		embeddings = ms
+		trending = ts
+		workflow = wf
+		trash = tb
+		users = us
+		videos = vs
+		dataExports = ds
+		boostHandler = bh
+		recHandler = rh
+		searchHandler = sh
+		modHandler = oh
+		contentHandler = wh
+		historyHandler = vh
+		reviewHandler = vw
+		oauthHandler = oa
+		seriesHandler = sr
+		videoHandler = vd
+		playbackHandler = pb
+		subtitleHandler = st
+		translationHandler = mt
+		importHandler = im
+		notificationHandler = nh
+		eventHandler = ev
+		profileHandler = ph
+		billingHandler = blh
+		dataExportHandler = deh
+		collectionHandler = clh
+		featuredHandler = fh
+		auditHandler = adh
+		hub = nt
+		releases = rf
+		grpcServer = gs
 	}); err != nil {
 		return nil, fmt.Errorf("failed to get handlers: %v", err)
 	}
 
 	// Setup routes
-	router := routes.SetupRoutes(
+	router, err := routes.SetupRoutes(
 		authHandler,
 		movieHandler,
 		categoryHandler,
 		userHandler,
+		healthHandler,
+		apiKeyHandler,
+		analyticsHandler,
+		boostHandler,
+		recHandler,
+		searchHandler,
+		modHandler,
+		contentHandler,
+		historyHandler,
+		reviewHandler,
+		oauthHandler,
+		seriesHandler,
+		videoHandler,
+		playbackHandler,
+		subtitleHandler,
+		translationHandler,
+		importHandler,
+		notificationHandler,
+		eventHandler,
+		profileHandler,
+		billingHandler,
+		dataExportHandler,
+		collectionHandler,
+		featuredHandler,
+		auditHandler,
+		checker,
+		limiter,
+		nonces,
+		webhooks,
+		deprecations,
+		appMetrics,
+		tracing,
+		reporter,
+		nrApp,
+		logger,
 	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup routes: %v", err)
+	}
 
 	// Create server instance
 	srv := &Server{
-		router: router,
-		logger: logger,
-		nrApp:  nrApp,
-		config: cfg,
+		router:       router,
+		logger:       logger,
+		nrApp:        nrApp,
+		config:       cfg,
+		checker:      checker,
+		limiter:      limiter,
+		nonces:       nonces,
+		deprecations: deprecations,
+		tracing:      tracing,
+		reporter:     reporter,
+		replicas:     replicas,
+		analytics:    analytics,
+		rollups:      rollups,
+		exports:      exports,
+		embeddings:   embeddings,
+		trending:     trending,
+		workflow:     workflow,
+		trash:        trash,
+		users:        users,
+		videos:       videos,
+		dataExports:  dataExports,
+		hub:          hub,
+		releases:     releases,
 		server: &http.Server{
 			Addr:         fmt.Sprintf(":%s", cfg.Server.Port),
 			Handler:      router,
@@ -90,13 +281,74 @@ func New() (*Server, error) {
 			WriteTimeout: 15 * time.Second,
 			IdleTimeout:  60 * time.Second,
 		},
+		grpc: grpcServer,
 	}
 
 	return srv, nil
 }
 
+// Migrate waits for the database, applies pending migrations and returns
+// without starting the HTTP server
+func Migrate(opts container.Options) error {
+	c := container.BuildContainer(opts)
+
+	// Resolving the connection runs the migrations
+	if err := c.Invoke(func(db *sql.DB) error {
+		return db.Close()
+	}); err != nil {
+		return fmt.Errorf("failed to run migrations: %v", err)
+	}
+	return nil
+}
+
 // Start begins serving the HTTP server and handles graceful shutdown
 func (s *Server) Start() error {
+	// Start background workers, whose queries may run long, so are not
+	// bound by the query timeout
+	bgCtx, stopBackground := context.WithCancel(database.WithQueryTimeout(context.Background(), 0))
+	defer stopBackground()
+	go s.checker.Run(bgCtx)
+	go s.replicas.Run(bgCtx)
+	go s.limiter.Run(bgCtx)
+	go s.nonces.Run(bgCtx)
+	go s.deprecations.Run(bgCtx)
+	go s.rollups.Run(bgCtx)
+	go s.exports.Run(bgCtx)
+	go s.embeddings.Run(bgCtx)
+	go s.trending.Run(bgCtx)
+	go s.workflow.Run(bgCtx)
+	go s.trash.Run(bgCtx)
+	go s.users.Run(bgCtx)
+	go s.hub.Run(bgCtx)
+
+	// The analytics pipeline flushes queued events once stopped, so wait
+	// for it before exiting
+	analyticsDone := make(chan struct{})
+	go func() {
+		s.analytics.Run(bgCtx)
+		close(analyticsDone)
+	}()
+
+	// Transcoding jobs and data exports interrupted by shutdown are queued
+	// again for another worker, so wait for that too
+	videosDone := make(chan struct{})
+	go func() {
+		s.videos.Run(bgCtx)
+		close(videosDone)
+	}()
+	dataExportsDone := make(chan struct{})
+	go func() {
+		s.dataExports.Run(bgCtx)
+		close(dataExportsDone)
+	}()
+
+	// Errors of the last requests are still reported once stopped
+	reporterDone := make(chan struct{})
+	go func() {
+		s.reporter.Run(bgCtx)
+		close(reporterDone)
+	}()
+
 	// Start server
 	go func() {
 		s.logger.Info("server starting", zap.String("port", s.config.Server.Port))
@@ -105,6 +357,15 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	// Serve internal services over gRPC on its own port
+	if s.grpc != nil {
+		go func() {
+			if err := s.grpc.Serve(); err != nil {
+				s.logger.Fatal("gRPC server failed to start", zap.Error(err))
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -116,9 +377,28 @@ func (s *Server) Start() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	// Shutdown waits for event streams, so end them first
+	s.releases.Close()
 	if err := s.server.Shutdown(ctx); err != nil {
 		return fmt.Errorf("server forced to shutdown: %v", err)
 	}
+	if s.grpc != nil {
+		s.grpc.Shutdown(ctx)
+	}
+
+	stopBackground()
+	<-analyticsDone
+	<-videosDone
+	<-dataExportsDone
+	<-reporterDone
+
+	// Export the spans still buffered
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		s.logger.Warn("failed to flush traces", zap.Error(err))
+	}
+	if s.nrApp != nil {
+		s.nrApp.Shutdown(10 * time.Second)
+	}
 
 	s.logger.Info("server exited properly")
 	return nil
@@ -0,0 +1,412 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"time"
+)
+
+const (
+	// MaxReportDays is the longest period an analytics report may cover
+	MaxReportDays = 366
+	// MaxTopTitles caps the number of titles in a top titles report
+	MaxTopTitles = 100
+
+	// mauDays is the trailing window monthly active users are counted over
+	mauDays = 30
+	// maxDropOffMinutes bounds the drop-off curve of movies without a duration
+	maxDropOffMinutes = 600
+)
+
+var (
+	ErrInvalidPeriod = errors.New("invalid report period")
+	ErrInvalidMetric = errors.New("invalid report metric")
+)
+
+// topTitleMetrics maps the metrics titles can be ranked by to stats columns
+var topTitleMetrics = map[string]string{
+	"views":       "views",
+	"viewers":     "viewers",
+	"completions": "completions",
+	"watch_time":  "watch_seconds",
+}
+
+// Period is a range of whole UTC days, both ends inclusive
+type Period struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// NewPeriod returns the period from the day of from to the day of to. It
+// must not be reversed or longer than MaxReportDays.
+func NewPeriod(from, to time.Time) (Period, error) {
+	p := Period{From: startOfDay(from), To: startOfDay(to)}
+	if p.To.Before(p.From) || p.days() > MaxReportDays {
+		return Period{}, ErrInvalidPeriod
+	}
+	return p, nil
+}
+
+func (p Period) days() int {
+	return int(p.To.Sub(p.From).Hours()/24) + 1
+}
+
+// end returns the exclusive end of the period
+func (p Period) end() time.Time {
+	return p.To.AddDate(0, 0, 1)
+}
+
+type ActiveUsersDay struct {
+	Day time.Time `json:"day"`
+	DAU int64     `json:"dau" example:"1200"`
+	MAU int64     `json:"mau" example:"15000"`
+}
+
+type ActiveUsersReport struct {
+	Period     Period           `json:"period"`
+	Days       []ActiveUsersDay `json:"days"`
+	AverageDAU float64          `json:"average_dau" example:"1180.5"`
+	// MAU counts distinct users active in the last 30 days of the period
+	MAU int64 `json:"mau" example:"15000"`
+	// Stickiness is average DAU over MAU
+	Stickiness float64 `json:"stickiness" example:"0.079"`
+}
+
+type FunnelStep struct {
+	Name  string `json:"name" example:"watched"`
+	Users int64  `json:"users" example:"640"`
+	// Conversion is the share of the previous step's users who reached this one
+	Conversion float64 `json:"conversion" example:"0.64"`
+}
+
+type SignupFunnelReport struct {
+	Period Period       `json:"period"`
+	Steps  []FunnelStep `json:"steps"`
+}
+
+type RetentionCohort struct {
+	Start time.Time `json:"start"`
+	Size  int64     `json:"size" example:"250"`
+	// Active and Rates hold, per week since signup, the number and share of
+	// the cohort active that week
+	Active []int64   `json:"active"`
+	Rates  []float64 `json:"rates"`
+}
+
+type RetentionReport struct {
+	Period  Period            `json:"period"`
+	Cohorts []RetentionCohort `json:"cohorts"`
+}
+
+type WatchTimeDay struct {
+	Day          time.Time `json:"day"`
+	Views        int64     `json:"views" example:"3400"`
+	Completions  int64     `json:"completions" example:"1200"`
+	WatchSeconds int64     `json:"watch_seconds" example:"8640000"`
+}
+
+type WatchTimeReport struct {
+	Period         Period         `json:"period"`
+	Views          int64          `json:"views" example:"102000"`
+	Completions    int64          `json:"completions" example:"36000"`
+	WatchSeconds   int64          `json:"watch_seconds" example:"259200000"`
+	CompletionRate float64        `json:"completion_rate" example:"0.35"`
+	Days           []WatchTimeDay `json:"days"`
+}
+
+type TopTitle struct {
+	MovieID        int64   `json:"movie_id" example:"42"`
+	Title          string  `json:"title" example:"The Matrix"`
+	Views          int64   `json:"views" example:"5400"`
+	Viewers        int64   `json:"viewers" example:"4100"`
+	Completions    int64   `json:"completions" example:"2900"`
+	WatchSeconds   int64   `json:"watch_seconds" example:"24000000"`
+	CompletionRate float64 `json:"completion_rate" example:"0.54"`
+}
+
+type TopTitlesReport struct {
+	Period Period     `json:"period"`
+	Metric string     `json:"metric" example:"views"`
+	Titles []TopTitle `json:"titles"`
+}
+
+type ReasonClicks struct {
+	Reason      string `json:"reason" example:"because_you_watched"`
+	Impressions int64  `json:"impressions" example:"12000"`
+	Clicks      int64  `json:"clicks" example:"840"`
+	Plays       int64  `json:"plays" example:"610"`
+	// ClickThroughRate is clicks over impressions
+	ClickThroughRate float64 `json:"click_through_rate" example:"0.07"`
+}
+
+type RecommendationReasonsReport struct {
+	Period  Period         `json:"period"`
+	Reasons []ReasonClicks `json:"reasons"`
+}
+
+type DropOffPoint struct {
+	Minute  int   `json:"minute" example:"10"`
+	Viewers int64 `json:"viewers" example:"820"`
+	// Percent is the share of all viewers, 0 to 100, still watching at this minute
+	Percent float64 `json:"percent" example:"82.5"`
+}
+
+type MovieEngagementReport struct {
+	Period              Period  `json:"period"`
+	MovieID             int64   `json:"movie_id" example:"42"`
+	DurationMinutes     int     `json:"duration_minutes" example:"136"`
+	Viewers             int64   `json:"viewers" example:"1000"`
+	AverageWatchSeconds float64 `json:"average_watch_seconds" example:"4210.5"`
+	CompletionRate      float64 `json:"completion_rate" example:"0.41"`
+	// RewatchRate is the share of viewers who completed the movie and then
+	// started it again
+	RewatchRate float64        `json:"rewatch_rate" example:"0.08"`
+	DropOff     []DropOffPoint `json:"drop_off"`
+}
+
+// MovieEngagement reports how far viewers got into a movie over the period,
+// their average watch time and how many rewatched it. It is computed from raw
+// playback events, so only periods within raw event retention are complete.
+func (s *AnalyticsService) MovieEngagement(ctx context.Context, movieID int64, p Period) (*MovieEngagementReport, error) {
+	const op = "AnalyticsService.MovieEngagement"
+
+	duration, err := s.db.MovieDuration(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	engagement, err := s.db.MovieEngagement(ctx, movieID, p.From, p.end())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	maxMinute := duration
+	if maxMinute <= 0 {
+		maxMinute = maxDropOffMinutes
+	}
+	minutes, err := s.db.FurthestMinutes(ctx, movieID, p.From, p.end(), maxMinute)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	report := &MovieEngagementReport{
+		Period:          p,
+		MovieID:         movieID,
+		DurationMinutes: duration,
+		Viewers:         engagement.Viewers,
+		CompletionRate:  ratio(engagement.Completers, engagement.Viewers),
+		RewatchRate:     ratio(engagement.Rewatchers, engagement.Completers),
+		DropOff:         []DropOffPoint{},
+	}
+	if engagement.Viewers > 0 {
+		report.AverageWatchSeconds = float64(engagement.WatchSeconds) / float64(engagement.Viewers)
+	}
+	if len(minutes) == 0 {
+		return report, nil
+	}
+
+	// Viewers still watching at a minute are those whose furthest position
+	// is in that minute or a later one
+	last := minutes[len(minutes)-1].Minute
+	if duration <= 0 {
+		maxMinute = last
+	}
+	reached := make([]int64, maxMinute+1)
+	for _, m := range minutes {
+		reached[m.Minute] = m.Viewers
+	}
+	for i := len(reached) - 2; i >= 0; i-- {
+		reached[i] += reached[i+1]
+	}
+
+	report.DropOff = make([]DropOffPoint, len(reached))
+	for i, viewers := range reached {
+		report.DropOff[i] = DropOffPoint{
+			Minute:  i,
+			Viewers: viewers,
+			Percent: 100 * ratio(viewers, reached[0]),
+		}
+	}
+	return report, nil
+}
+
+// ActiveUsers reports daily and monthly active users over the period
+func (s *AnalyticsService) ActiveUsers(ctx context.Context, p Period) (*ActiveUsersReport, error) {
+	const op = "AnalyticsService.ActiveUsers"
+
+	rows, err := s.db.ActiveUsers(ctx, p.From, p.To)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	mau, err := s.db.MonthlyActiveUsers(ctx, p.To.AddDate(0, 0, -(mauDays-1)), p.To)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	report := &ActiveUsersReport{Period: p, Days: make([]ActiveUsersDay, len(rows)), MAU: mau}
+	var dauTotal int64
+	var stickiness float64
+	for i, row := range rows {
+		report.Days[i] = ActiveUsersDay{Day: row.Day, DAU: row.DAU, MAU: row.MAU}
+		dauTotal += row.DAU
+		stickiness += ratio(row.DAU, row.MAU)
+	}
+	if len(rows) > 0 {
+		report.AverageDAU = float64(dauTotal) / float64(len(rows))
+		report.Stickiness = stickiness / float64(len(rows))
+	}
+	return report, nil
+}
+
+// SignupFunnel follows users who signed up during the period from
+// registration to returning on a second day
+func (s *AnalyticsService) SignupFunnel(ctx context.Context, p Period) (*SignupFunnelReport, error) {
+	funnel, err := s.db.SignupFunnel(ctx, p.From, p.end())
+	if err != nil {
+		return nil, apperrors.E("AnalyticsService.SignupFunnel", err)
+	}
+
+	counts := []struct {
+		name  string
+		users int64
+	}{
+		{"registered", funnel.Registered},
+		{"active", funnel.Active},
+		{"watched", funnel.Watched},
+		{"completed", funnel.Completed},
+		{"returned", funnel.Returned},
+	}
+
+	report := &SignupFunnelReport{Period: p, Steps: make([]FunnelStep, len(counts))}
+	for i, c := range counts {
+		step := FunnelStep{Name: c.name, Users: c.users, Conversion: 1}
+		if i > 0 {
+			step.Conversion = ratio(c.users, counts[i-1].users)
+		}
+		report.Steps[i] = step
+	}
+	return report, nil
+}
+
+// Retention reports weekly retention of the cohorts of users who signed up
+// during the period, up to the current week
+func (s *AnalyticsService) Retention(ctx context.Context, p Period) (*RetentionReport, error) {
+	const op = "AnalyticsService.Retention"
+
+	cohorts, err := s.db.Cohorts(ctx, p.From, p.end())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	activity, err := s.db.CohortActivity(ctx, p.From, p.end())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	today := startOfDay(s.now())
+	report := &RetentionReport{Period: p, Cohorts: make([]RetentionCohort, len(cohorts))}
+	index := make(map[time.Time]int, len(cohorts))
+	for i, c := range cohorts {
+		weeks := int(today.Sub(c.Start).Hours()/24)/7 + 1
+		report.Cohorts[i] = RetentionCohort{
+			Start:  c.Start,
+			Size:   c.Size,
+			Active: make([]int64, weeks),
+			Rates:  make([]float64, weeks),
+		}
+		index[c.Start.UTC()] = i
+	}
+
+	for _, a := range activity {
+		i, ok := index[a.Cohort.UTC()]
+		if !ok || a.Week < 0 || a.Week >= len(report.Cohorts[i].Active) {
+			continue
+		}
+		cohort := &report.Cohorts[i]
+		cohort.Active[a.Week] = a.Users
+		cohort.Rates[a.Week] = ratio(a.Users, cohort.Size)
+	}
+	return report, nil
+}
+
+// WatchTime reports total playback over the period and per day
+func (s *AnalyticsService) WatchTime(ctx context.Context, p Period) (*WatchTimeReport, error) {
+	rows, err := s.db.WatchTime(ctx, p.From, p.To)
+	if err != nil {
+		return nil, apperrors.E("AnalyticsService.WatchTime", err)
+	}
+
+	report := &WatchTimeReport{Period: p, Days: make([]WatchTimeDay, len(rows))}
+	for i, row := range rows {
+		report.Days[i] = WatchTimeDay{
+			Day:          row.Day,
+			Views:        row.Views,
+			Completions:  row.Completions,
+			WatchSeconds: row.WatchSeconds,
+		}
+		report.Views += row.Views
+		report.Completions += row.Completions
+		report.WatchSeconds += row.WatchSeconds
+	}
+	report.CompletionRate = ratio(report.Completions, report.Views)
+	return report, nil
+}
+
+// TopTitles ranks movies by metric (views, viewers, completions or
+// watch_time) over the period
+func (s *AnalyticsService) TopTitles(ctx context.Context, p Period, metric string, limit int) (*TopTitlesReport, error) {
+	column, ok := topTitleMetrics[metric]
+	if !ok {
+		return nil, ErrInvalidMetric
+	}
+	if limit <= 0 || limit > MaxTopTitles {
+		limit = 10
+	}
+
+	rows, err := s.db.TopTitles(ctx, p.From, p.To, column, limit)
+	if err != nil {
+		return nil, apperrors.E("AnalyticsService.TopTitles", err)
+	}
+
+	report := &TopTitlesReport{Period: p, Metric: metric, Titles: make([]TopTitle, len(rows))}
+	for i, row := range rows {
+		report.Titles[i] = TopTitle{
+			MovieID:        row.MovieID,
+			Title:          row.Title,
+			Views:          row.Views,
+			Viewers:        row.Viewers,
+			Completions:    row.Completions,
+			WatchSeconds:   row.WatchSeconds,
+			CompletionRate: ratio(row.Completions, row.Views),
+		}
+	}
+	return report, nil
+}
+
+// RecommendationReasons reports how often titles recommended for each reason
+// were shown, clicked and played over the period, from raw events
+func (s *AnalyticsService) RecommendationReasons(ctx context.Context, p Period) (*RecommendationReasonsReport, error) {
+	rows, err := s.db.RecommendationReasons(ctx, p.From, p.end())
+	if err != nil {
+		return nil, apperrors.E("AnalyticsService.RecommendationReasons", err)
+	}
+
+	report := &RecommendationReasonsReport{Period: p, Reasons: make([]ReasonClicks, len(rows))}
+	for i, row := range rows {
+		report.Reasons[i] = ReasonClicks{
+			Reason:           row.Reason,
+			Impressions:      row.Impressions,
+			Clicks:           row.Clicks,
+			Plays:            row.Plays,
+			ClickThroughRate: ratio(row.Clicks, row.Impressions),
+		}
+	}
+	return report, nil
+}
+
+// ratio returns n/d, or 0 when d is 0
+func ratio(n, d int64) float64 {
+	if d == 0 {
+		return 0
+	}
+	return float64(n) / float64(d)
+}
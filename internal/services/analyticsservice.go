@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/metrics"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Client event types accepted by the ingestion endpoint
+const (
+	EventImpression  = "impression"
+	EventPlayStart   = "play_start"
+	EventHeartbeat   = "heartbeat"
+	EventPause       = "pause"
+	EventComplete    = "complete"
+	EventSearchClick = "search_click"
+	// EventSearch is a search being run, reported with its query and no movie
+	EventSearch = "search"
+	// EventProgress is accepted as another name for EventHeartbeat, and
+	// stored as one
+	EventProgress = "progress"
+	// EventRecommendationClick is a recommended title being opened; its
+	// reason is the code of the recommendation reason it was shown with
+	EventRecommendationClick = "recommendation_click"
+)
+
+const (
+	// MaxEventsPerBatch caps the number of events in one ingestion request
+	MaxEventsPerBatch = 100
+
+	maxSessionIDLength = 64
+	maxQueryLength     = 256
+	maxReasonLength    = 64
+	// maxEventAge and maxClockSkew bound how far occurred_at may be from now
+	maxEventAge  = 7 * 24 * time.Hour
+	maxClockSkew = 5 * time.Minute
+	// drainTimeout bounds the final flush when the pipeline stops
+	drainTimeout = 10 * time.Second
+)
+
+var (
+	ErrNoEvents       = errors.New("no events given")
+	ErrTooManyEvents  = errors.New("too many events in one batch")
+	ErrIngestBacklog  = errors.New("analytics pipeline is full")
+	ErrUnknownEvent   = errors.New("unknown event type")
+	ErrInvalidEvent   = errors.New("invalid event")
+	ErrEventOutOfDate = errors.New("event time is too far from now")
+)
+
+// EventError reports which event of a batch failed validation
+type EventError struct {
+	Index int
+	Err   error
+}
+
+func (e *EventError) Error() string {
+	return fmt.Sprintf("event %d: %v", e.Index, e.Err)
+}
+
+func (e *EventError) Unwrap() error {
+	return e.Err
+}
+
+// AnalyticsService validates client events and writes them asynchronously.
+// Ingest only queues events; Run batches them into the database so request
+// latency does not depend on write throughput.
+type AnalyticsService struct {
+	db            *database.AnalyticsDB
+	metrics       *metrics.Metrics
+	logger        *zap.Logger
+	queue         chan *models.AnalyticsEvent
+	batchSize     int
+	flushInterval time.Duration
+	now           func() time.Time
+}
+
+func NewAnalyticsService(db *database.AnalyticsDB, m *metrics.Metrics, cfg config.AnalyticsConfig, logger *zap.Logger) *AnalyticsService {
+	bufferSize := cfg.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = 10000
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 2 * time.Second
+	}
+
+	return &AnalyticsService{
+		db:            db,
+		metrics:       m,
+		logger:        logger,
+		queue:         make(chan *models.AnalyticsEvent, bufferSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		now:           time.Now,
+	}
+}
+
+// Ingest validates a batch of events reported by userID (0 for anonymous
+// clients) and queues it for writing. The batch is rejected as a whole if any
+// event is invalid, and ErrIngestBacklog is returned when the queue cannot
+// take it.
+func (s *AnalyticsService) Ingest(ctx context.Context, userID int64, events []*models.AnalyticsEvent) error {
+	if len(events) == 0 {
+		return ErrNoEvents
+	}
+	if len(events) > MaxEventsPerBatch {
+		return ErrTooManyEvents
+	}
+
+	now := s.now().UTC()
+	for i, event := range events {
+		if err := s.validateEvent(event, now); err != nil {
+			return &EventError{Index: i, Err: err}
+		}
+		if userID != 0 {
+			event.UserID = &userID
+		}
+		event.ReceivedAt = now
+	}
+
+	if cap(s.queue)-len(s.queue) < len(events) {
+		return ErrIngestBacklog
+	}
+	plays := 0
+	for _, event := range events {
+		select {
+		case s.queue <- event:
+		case <-ctx.Done():
+			s.metrics.Plays(plays)
+			return ctx.Err()
+		}
+		if event.Type == EventPlayStart {
+			plays++
+		}
+	}
+	s.metrics.Plays(plays)
+	return nil
+}
+
+func (s *AnalyticsService) validateEvent(event *models.AnalyticsEvent, now time.Time) error {
+	if event.Type == EventProgress {
+		event.Type = EventHeartbeat
+	}
+	switch event.Type {
+	case EventImpression, EventPlayStart, EventHeartbeat, EventPause, EventComplete, EventSearch, EventSearchClick, EventRecommendationClick:
+	default:
+		return fmt.Errorf("%w %q", ErrUnknownEvent, event.Type)
+	}
+
+	if event.Type == EventSearch {
+		if event.MovieID != 0 || event.PositionSeconds != nil {
+			return fmt.Errorf("%w: movie_id and position_seconds are not allowed for %s", ErrInvalidEvent, event.Type)
+		}
+	} else if event.MovieID <= 0 {
+		return fmt.Errorf("%w: movie_id is required", ErrInvalidEvent)
+	}
+	if len(event.SessionID) > maxSessionIDLength {
+		return fmt.Errorf("%w: session_id must be at most %d characters", ErrInvalidEvent, maxSessionIDLength)
+	}
+	if event.PositionSeconds != nil && *event.PositionSeconds < 0 {
+		return fmt.Errorf("%w: position_seconds must not be negative", ErrInvalidEvent)
+	}
+
+	switch event.Type {
+	case EventHeartbeat, EventPause, EventComplete:
+		if event.PositionSeconds == nil {
+			return fmt.Errorf("%w: position_seconds is required for %s", ErrInvalidEvent, event.Type)
+		}
+	case EventSearch, EventSearchClick:
+		if event.Query == "" {
+			return fmt.Errorf("%w: query is required for %s", ErrInvalidEvent, event.Type)
+		}
+	case EventRecommendationClick:
+		if event.Reason == "" {
+			return fmt.Errorf("%w: reason is required for %s", ErrInvalidEvent, event.Type)
+		}
+	}
+	if event.Query != "" && event.Type != EventSearch && event.Type != EventSearchClick {
+		return fmt.Errorf("%w: query is only allowed for %s and %s", ErrInvalidEvent, EventSearch, EventSearchClick)
+	}
+	if len(event.Query) > maxQueryLength {
+		return fmt.Errorf("%w: query must be at most %d characters", ErrInvalidEvent, maxQueryLength)
+	}
+	switch event.Type {
+	case EventImpression, EventPlayStart, EventRecommendationClick:
+	default:
+		if event.Reason != "" {
+			return fmt.Errorf("%w: reason is only allowed for %s, %s and %s", ErrInvalidEvent, EventImpression, EventPlayStart, EventRecommendationClick)
+		}
+	}
+	if len(event.Reason) > maxReasonLength {
+		return fmt.Errorf("%w: reason must be at most %d characters", ErrInvalidEvent, maxReasonLength)
+	}
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = now
+	}
+	event.OccurredAt = event.OccurredAt.UTC()
+	if event.OccurredAt.After(now.Add(maxClockSkew)) || event.OccurredAt.Before(now.Add(-maxEventAge)) {
+		return ErrEventOutOfDate
+	}
+	return nil
+}
+
+// Run writes queued events in batches until ctx is cancelled, then flushes
+// whatever is still queued before returning
+func (s *AnalyticsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.AnalyticsEvent, 0, s.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			s.drain(batch)
+			return
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				batch = s.flush(ctx, batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(ctx, batch)
+		}
+	}
+}
+
+// drain writes the pending batch and everything left in the queue
+func (s *AnalyticsService) drain(batch []*models.AnalyticsEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	for {
+		select {
+		case event := <-s.queue:
+			batch = append(batch, event)
+			if len(batch) >= s.batchSize {
+				batch = s.flush(ctx, batch)
+			}
+		default:
+			s.flush(ctx, batch)
+			return
+		}
+	}
+}
+
+// flush writes batch and returns it emptied. Events that cannot be written
+// are dropped and logged rather than retried, so a database outage cannot
+// back up into request handling.
+func (s *AnalyticsService) flush(ctx context.Context, batch []*models.AnalyticsEvent) []*models.AnalyticsEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+	if err := s.db.InsertEvents(ctx, batch); err != nil {
+		s.logger.Error("failed to write analytics events",
+			zap.Int("events", len(batch)),
+			zap.Error(err),
+		)
+	}
+	return batch[:0]
+}
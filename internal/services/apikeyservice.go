@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
+	"github.com/ndn/internal/models"
+	"time"
+)
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrQuotaExceeded      = errors.New("api key quota exceeded")
+	ErrInvalidQuota       = errors.New("quota must not be negative")
+	ErrAPIKeyNameRequired = errors.New("api key name is required")
+)
+
+// apiKeyPrefix marks keys issued by this service so they are easy to spot
+const apiKeyPrefix = "ndn_"
+
+// usageHistoryDays is how many days of per-day usage are reported
+const usageHistoryDays = 30
+
+type APIKeyService struct {
+	db  *database.APIKeyDB
+	now func() time.Time
+}
+
+func NewAPIKeyService(db *database.APIKeyDB) *APIKeyService {
+	return &APIKeyService{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// QuotaStatus describes how much of a quota window has been used. A Limit of
+// zero means the window is unlimited.
+type QuotaStatus struct {
+	Limit     int       `json:"limit" example:"10000"`
+	Used      int64     `json:"used" example:"1234"`
+	Remaining int64     `json:"remaining" example:"8766"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+type APIKeyUsageReport struct {
+	APIKeyID int64                 `json:"api_key_id" example:"1"`
+	Daily    QuotaStatus           `json:"daily"`
+	Monthly  QuotaStatus           `json:"monthly"`
+	History  []*models.APIKeyUsage `json:"history"`
+}
+
+// CreateAPIKey issues a new key and returns it together with the plaintext
+// secret. Only a hash is stored, so the secret cannot be recovered later.
+// The key's SigningSecret, which clients sign mutations with, is returned
+// once too.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, name string, dailyQuota, monthlyQuota int) (*models.APIKey, string, error) {
+	const op = "APIKeyService.CreateAPIKey"
+
+	if name == "" {
+		return nil, "", ErrAPIKeyNameRequired
+	}
+	if dailyQuota < 0 || monthlyQuota < 0 {
+		return nil, "", ErrInvalidQuota
+	}
+
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", apperrors.Errorf(op, "failed to generate key: %w", err)
+	}
+	raw := apiKeyPrefix + hex.EncodeToString(secret)
+
+	signingSecret, err := randomHex(32)
+	if err != nil {
+		return nil, "", apperrors.Errorf(op, "failed to generate signing secret: %w", err)
+	}
+
+	key := &models.APIKey{
+		Name:          name,
+		Prefix:        raw[:len(apiKeyPrefix)+8],
+		KeyHash:       hashAPIKey(raw),
+		SigningSecret: signingSecret,
+		DailyQuota:    dailyQuota,
+		MonthlyQuota:  monthlyQuota,
+	}
+	if err := s.db.CreateAPIKey(ctx, key); err != nil {
+		return nil, "", apperrors.E(op, err)
+	}
+
+	return key, raw, nil
+}
+
+func (s *APIKeyService) GetAPIKey(ctx context.Context, id int64) (*models.APIKey, error) {
+	key, err := s.db.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, apperrors.E("APIKeyService.GetAPIKey", err)
+	}
+	return key, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	keys, err := s.db.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, apperrors.E("APIKeyService.ListAPIKeys", err)
+	}
+	return keys, nil
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id int64) error {
+	const op = "APIKeyService.RevokeAPIKey"
+
+	if _, err := s.db.GetAPIKey(ctx, id); err != nil {
+		return apperrors.E(op, err)
+	}
+	if dryrun.FromContext(ctx) {
+		return nil
+	}
+	if err := s.db.RevokeAPIKey(ctx, id); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// Consume authenticates a raw key, checks its daily and monthly quotas and
+// records the request, in one statement so concurrent requests cannot
+// exceed them. It returns the key and its daily quota status after the
+// request was counted. ErrQuotaExceeded is returned without recording usage
+// when either quota is used up.
+func (s *APIKeyService) Consume(ctx context.Context, raw string) (*models.APIKey, QuotaStatus, error) {
+	const op = "APIKeyService.Consume"
+
+	key, err := s.db.GetAPIKeyByHash(ctx, hashAPIKey(raw))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, QuotaStatus{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, QuotaStatus{}, apperrors.E(op, err)
+	}
+
+	today := startOfDay(s.now())
+	usedToday, ok, err := s.db.ConsumeUsage(ctx, key.ID, today, startOfMonth(today), key.DailyQuota, key.MonthlyQuota)
+	if err != nil {
+		return nil, QuotaStatus{}, apperrors.E(op, err)
+	}
+	if ok {
+		return key, newQuotaStatus(key.DailyQuota, usedToday, today.AddDate(0, 0, 1)), nil
+	}
+
+	daily, monthly, err := s.quotas(ctx, key)
+	if err != nil {
+		return nil, QuotaStatus{}, apperrors.E(op, err)
+	}
+	if exhausted(monthly) && !exhausted(daily) {
+		return key, monthly, ErrQuotaExceeded
+	}
+	return key, daily, ErrQuotaExceeded
+}
+
+// GetUsage reports the key's current quota windows and the last 30 days of
+// per-day request counts
+func (s *APIKeyService) GetUsage(ctx context.Context, id int64) (*APIKeyUsageReport, error) {
+	const op = "APIKeyService.GetUsage"
+
+	key, err := s.db.GetAPIKey(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	daily, monthly, err := s.quotas(ctx, key)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	from := startOfDay(s.now()).AddDate(0, 0, -(usageHistoryDays - 1))
+	history, err := s.db.UsageSince(ctx, key.ID, from)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	return &APIKeyUsageReport{
+		APIKeyID: key.ID,
+		Daily:    daily,
+		Monthly:  monthly,
+		History:  history,
+	}, nil
+}
+
+func (s *APIKeyService) quotas(ctx context.Context, key *models.APIKey) (QuotaStatus, QuotaStatus, error) {
+	today := startOfDay(s.now())
+	month := startOfMonth(today)
+
+	usedToday, err := s.db.CountSince(ctx, key.ID, today)
+	if err != nil {
+		return QuotaStatus{}, QuotaStatus{}, err
+	}
+	usedMonth, err := s.db.CountSince(ctx, key.ID, month)
+	if err != nil {
+		return QuotaStatus{}, QuotaStatus{}, err
+	}
+
+	daily := newQuotaStatus(key.DailyQuota, usedToday, today.AddDate(0, 0, 1))
+	monthly := newQuotaStatus(key.MonthlyQuota, usedMonth, month.AddDate(0, 1, 0))
+	return daily, monthly, nil
+}
+
+func newQuotaStatus(limit int, used int64, resetsAt time.Time) QuotaStatus {
+	status := QuotaStatus{Limit: limit, Used: used, ResetsAt: resetsAt}
+	if limit > 0 && used < int64(limit) {
+		status.Remaining = int64(limit) - used
+	}
+	return status
+}
+
+func exhausted(q QuotaStatus) bool {
+	return q.Limit > 0 && q.Used >= int64(q.Limit)
+}
+
+// startOfDay truncates t to midnight UTC, the boundary quotas reset on
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// startOfMonth truncates t to the first of its month UTC, the boundary
+// monthly quotas reset on
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Context functions
+
+const (
+	apiKeyIDKey            contextKey = "api_key_id"
+	apiKeySigningSecretKey contextKey = "api_key_signing_secret"
+)
+
+func ContextWithAPIKeyID(ctx context.Context, keyID int64) context.Context {
+	return context.WithValue(ctx, apiKeyIDKey, keyID)
+}
+
+func APIKeyIDFromContext(ctx context.Context) int64 {
+	keyID, _ := ctx.Value(apiKeyIDKey).(int64)
+	return keyID
+}
+
+// ContextWithAPIKeySigningSecret records the signing secret of the API key
+// the request was made with
+func ContextWithAPIKeySigningSecret(ctx context.Context, secret string) context.Context {
+	return context.WithValue(ctx, apiKeySigningSecretKey, secret)
+}
+
+// APIKeySigningSecretFromContext returns the signing secret of the API key
+// of the request, empty for keys without one
+func APIKeySigningSecretFromContext(ctx context.Context) string {
+	secret, _ := ctx.Value(apiKeySigningSecretKey).(string)
+	return secret
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/ndn/internal/models"
+	"reflect"
+
+	"github.com/uptrace/bun"
+)
+
+// Audit actions
+const (
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+
+	AuditActionAddCategory    = "add_category"
+	AuditActionRemoveCategory = "remove_category"
+)
+
+// ErrNotDeleted is returned when restoring a movie, category or user that is
+// not deleted
+var ErrNotDeleted = errors.New("not deleted")
+
+type auditRequestKey struct{}
+
+// auditRequest is the admin request mutations are made in
+type auditRequest struct {
+	ip        string
+	requestID string
+	recorded  bool // whether a service recorded an entry for it
+}
+
+// ContextWithAuditRequest records the client address and ID of the request
+// ctx belongs to, which the audit entries recorded in it carry
+func ContextWithAuditRequest(ctx context.Context, ip, requestID string) context.Context {
+	return context.WithValue(ctx, auditRequestKey{}, &auditRequest{ip: ip, requestID: requestID})
+}
+
+// AuditRecorded reports whether a service recorded an audit entry for the
+// request ctx belongs to
+func AuditRecorded(ctx context.Context) bool {
+	req, _ := ctx.Value(auditRequestKey{}).(*auditRequest)
+	return req != nil && req.recorded
+}
+
+// recordAudit writes an audit entry for a mutation made by the user in ctx.
+// Pass the transaction the mutation runs in so both commit together.
+func recordAudit(ctx context.Context, db bun.IDB, action, entityType string, entityID int64) error {
+	return recordChange(ctx, db, action, entityType, entityID, nil, nil)
+}
+
+// recordChange is recordAudit for a change of the entity from before to
+// after, either of which may be nil for creations and deletions. Only the
+// fields whose JSON differs between the two are kept.
+func recordChange(ctx context.Context, db bun.IDB, action, entityType string, entityID int64, before, after interface{}) error {
+	entry := &models.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+	}
+	var err error
+	if entry.Before, entry.After, err = auditDiff(before, after); err != nil {
+		return err
+	}
+
+	return insertAuditEntry(ctx, db, entry)
+}
+
+// insertAuditEntry writes entry, made by the user in ctx in the request ctx
+// belongs to, if any
+func insertAuditEntry(ctx context.Context, db bun.IDB, entry *models.AuditEntry) error {
+	if userID := UserIDFromContext(ctx); userID != 0 {
+		entry.ActorID = &userID
+	}
+	if req, _ := ctx.Value(auditRequestKey{}).(*auditRequest); req != nil {
+		entry.IP, entry.RequestID = req.ip, req.requestID
+		req.recorded = true
+	}
+
+	_, err := db.NewInsert().Model(entry).Exec(ctx)
+	return err
+}
+
+// auditDiff returns the fields of the JSON forms of before and after whose
+// values differ, with their values in each. Fields missing on one side, as
+// all are for nil, are left out of it.
+func auditDiff(before, after interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	from, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	to, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for key, value := range from {
+		if other, ok := to[key]; ok && reflect.DeepEqual(value, other) {
+			delete(from, key)
+			delete(to, key)
+		}
+	}
+	if len(from) == 0 {
+		from = nil
+	}
+	if len(to) == 0 {
+		to = nil
+	}
+	return from, to, nil
+}
+
+// auditFields returns the fields of the JSON object v is encoded as
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Sizes of the pages of ListAuditLogs
+const (
+	defaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+// AuditLogFilter selects the entries ListAuditLogs returns. Zero fields
+// match every entry.
+type AuditLogFilter struct {
+	ActorID    int64      // made by this user
+	EntityType string     // of this type of entity, e.g. movie or collection
+	EntityID   int64      // of the entity with this ID
+	Action     string     // such as update_boost, or post for plain requests
+	From       *time.Time // made at or after
+	To         *time.Time // made before
+	Page       int
+	PageSize   int
+}
+
+// AuditService records the mutations admins make and lists them. Services
+// describing their changes record them in the same transaction; every other
+// admin request is recorded through Record once it succeeded.
+type AuditService struct {
+	db *bun.DB
+}
+
+func NewAuditService(db *bun.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// Record writes entry for a mutation made by the user in ctx, stamped with
+// the client and ID of the request ctx belongs to
+func (s *AuditService) Record(ctx context.Context, entry *models.AuditEntry) error {
+	if err := insertAuditEntry(ctx, s.db, entry); err != nil {
+		return apperrors.E("AuditService.Record", err)
+	}
+	return nil
+}
+
+// ListAuditLogs returns a page of the entries filter matches, newest first,
+// and how many match in total. Pages hold 50 entries unless set, and at
+// most MaxAuditPageSize.
+func (s *AuditService) ListAuditLogs(ctx context.Context, filter AuditLogFilter) ([]models.AuditEntry, int, error) {
+	const op = "AuditService.ListAuditLogs"
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = defaultAuditPageSize
+	}
+	filter.PageSize = min(filter.PageSize, MaxAuditPageSize)
+
+	var entries []models.AuditEntry
+	query := s.db.NewSelect().
+		Model(&entries).
+		OrderExpr("al.created_at DESC, al.id DESC").
+		Limit(filter.PageSize).
+		Offset((filter.Page - 1) * filter.PageSize)
+	if filter.ActorID != 0 {
+		query.Where("al.actor_id = ?", filter.ActorID)
+	}
+	if filter.EntityType != "" {
+		query.Where("al.entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		query.Where("al.entity_id = ?", filter.EntityID)
+	}
+	if filter.Action != "" {
+		query.Where("al.action = ?", filter.Action)
+	}
+	if filter.From != nil {
+		query.Where("al.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query.Where("al.created_at < ?", *filter.To)
+	}
+
+	total, err := query.ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	return entries, total, nil
+}
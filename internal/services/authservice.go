@@ -2,192 +2,717 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
 	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/jwtkeys"
+	"github.com/ndn/internal/metrics"
 	"github.com/ndn/internal/models"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrInvalidToken       = errors.New("invalid or expired token")
 	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidResetToken  = errors.New("invalid or expired password reset token")
+	ErrPasswordTooShort   = errors.New("password too short")
+	// ErrInvalidEmailChangeToken is returned when confirming an email
+	// change with an unknown, used or expired token
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+	ErrEmailUnchanged          = errors.New("new email is the current one")
+	ErrWrongPassword           = errors.New("current password is incorrect")
+	ErrPasswordReused          = errors.New("new password is the current one")
 )
 
 type contextKey string
 
 const (
-	userIDKey contextKey = "user_id"
+	userIDKey    contextKey = "user_id"
+	profileIDKey contextKey = "profile_id"
+	sessionIDKey contextKey = "session_id"
 )
 
+// Lifetimes of access, refresh, password reset and email change tokens
+// when not configured
+const (
+	defaultAccessTTL        = 15 * time.Minute
+	defaultRefreshTTL       = 30 * 24 * time.Hour
+	defaultPasswordResetTTL = time.Hour
+	defaultEmailChangeTTL   = 24 * time.Hour
+)
+
+// AuthService issues short-lived JWT access tokens together with opaque
+// refresh tokens stored server-side. A refresh token is rotated every time it
+// is exchanged, and sessions can be revoked by logging out. Users who forget
+// their password are emailed a single-use reset link, and users changing
+// their email confirm the new address with a link sent to it. A session may act as
+// one of the user's profiles, selected with ProfileService.SelectProfile; its
+// access tokens then carry the profile's ID. Each session is recorded as a
+// device, which its user can sign out from another one. Failed password
+// logins slow down further attempts for the same email or IP address, and
+// eventually lock the account for a while. Passwords are hashed with the
+// configured PasswordHasher, and rehashed on login when their hash is
+// outdated.
 type AuthService struct {
-	db        *database.AuthDB
-	jwtSecret []byte
+	db               *database.AuthDB
+	email            EmailSender
+	hasher           PasswordHasher
+	policy           config.PasswordPolicy
+	metrics          *metrics.Metrics
+	keys             *jwtkeys.KeySet
+	accessTTL        time.Duration
+	refreshTTL       time.Duration
+	resetURL         string
+	passwordResetTTL time.Duration
+	confirmEmailURL  string
+	emailChangeTTL   time.Duration
+	throttle         config.LoginThrottleConfig
+	now              func() time.Time
 }
 
 type Claims struct {
-	UserID  int64  `json:"user_id"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
+	UserID    int64  `json:"user_id"`
+	Email     string `json:"email"`
+	IsAdmin   bool   `json:"is_admin"`
+	ProfileID int64  `json:"profile_id,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// IssuedAtMicros is the issue time in Unix microseconds, as iat only
+	// has whole seconds
+	IssuedAtMicros int64 `json:"iat_us,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewAuthService(db *database.AuthDB, jwtSecret string) *AuthService {
+// issuedAt is when the token was issued: to the microsecond, or at the
+// start of its second for tokens issued without iat_us
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAtMicros != 0 {
+		return time.UnixMicro(c.IssuedAtMicros)
+	}
+	return c.IssuedAt.Time
+}
+
+func NewAuthService(db *database.AuthDB, email EmailSender, hasher PasswordHasher, keys *jwtkeys.KeySet, m *metrics.Metrics, cfg config.JWTConfig, emailCfg config.EmailConfig, passwordCfg config.PasswordConfig, throttleCfg config.LoginThrottleConfig) *AuthService {
+	accessTTL := cfg.AccessTTL
+	if accessTTL <= 0 {
+		accessTTL = defaultAccessTTL
+	}
+	refreshTTL := cfg.RefreshTTL
+	if refreshTTL <= 0 {
+		refreshTTL = defaultRefreshTTL
+	}
+	passwordResetTTL := emailCfg.PasswordResetTTL
+	if passwordResetTTL <= 0 {
+		passwordResetTTL = defaultPasswordResetTTL
+	}
+	emailChangeTTL := emailCfg.EmailChangeTTL
+	if emailChangeTTL <= 0 {
+		emailChangeTTL = defaultEmailChangeTTL
+	}
+
 	return &AuthService{
-		db:        db,
-		jwtSecret: []byte(jwtSecret),
+		db:               db,
+		email:            email,
+		hasher:           hasher,
+		policy:           passwordPolicy(passwordCfg.Policy),
+		metrics:          m,
+		keys:             keys,
+		accessTTL:        accessTTL,
+		refreshTTL:       refreshTTL,
+		resetURL:         emailCfg.ResetURL,
+		passwordResetTTL: passwordResetTTL,
+		confirmEmailURL:  emailCfg.ConfirmEmailURL,
+		emailChangeTTL:   emailChangeTTL,
+		throttle:         loginThrottle(throttleCfg),
+		now:              time.Now,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, email, password, name string) (*AuthResponse, error) {
+// Register creates a user and starts a session on the device with
+// userAgent. The password must meet the password policy.
+func (s *AuthService) Register(ctx context.Context, email, password, name, userAgent string) (*AuthResponse, error) {
+	const op = "AuthService.Register"
+
+	if err := checkPassword(s.policy, password); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return nil, apperrors.Errorf(op, "failed to hash password: %w", err)
 	}
 
 	// Create user
 	user := &models.User{
 		Email:    email,
-		Password: string(hashedPassword),
+		Password: hashedPassword,
 		Name:     name,
 		IsAdmin:  false,
 	}
 
 	if err := s.db.CreateUser(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, apperrors.Errorf(op, "failed to create user: %w", err)
 	}
+	s.metrics.Registration()
 
-	// Generate token
-	token, expiresIn, err := s.generateToken(user)
+	// Start a session
+	resp, err := s.issueTokens(ctx, user, "", 0, userAgent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, apperrors.E(op, err)
 	}
-
-	return &AuthResponse{
-		Token:     token,
-		ExpiresIn: expiresIn,
-		UserID:    user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		IsAdmin:   user.IsAdmin,
-	}, nil
+	return resp, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, email, password string) (*AuthResponse, error) {
-	// Get user by email
+// Login starts a session of the user with email and password on the device
+// with userAgent. Logins from ip, or for email, that failed too often are
+// refused with a *LoginBlockedError before the password is checked.
+func (s *AuthService) Login(ctx context.Context, email, password, userAgent, ip string) (*AuthResponse, error) {
+	const op = "AuthService.Login"
+
+	keys := s.loginKeys(email, ip)
+	if err := s.checkLogin(ctx, keys); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	// Get user by email, then verify password
 	user, err := s.db.GetUserByEmail(ctx, email)
-	if err != nil {
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, apperrors.E(op, err)
+	}
+	if err != nil || !s.hasher.Verify(user.Password, password) {
+		s.metrics.Login(metrics.LoginPassword, false)
+		if err := s.recordLoginFailure(ctx, keys); err != nil {
+			return nil, apperrors.E(op, err)
+		}
 		return nil, ErrInvalidCredentials
 	}
+	s.metrics.Login(metrics.LoginPassword, true)
+	if len(keys) > 0 {
+		if err := s.db.ClearLoginAttempts(ctx, keys[0]); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+	}
 
-	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, ErrInvalidCredentials
+	// Upgrade the hash to the configured algorithm and cost
+	if s.hasher.NeedsRehash(user.Password) {
+		hashedPassword, err := s.hasher.Hash(password)
+		if err != nil {
+			return nil, apperrors.Errorf(op, "failed to hash password: %w", err)
+		}
+		if err := s.db.SetPassword(ctx, user.ID, hashedPassword, s.now()); err != nil {
+			return nil, apperrors.E(op, err)
+		}
 	}
 
-	// Generate token
-	token, expiresIn, err := s.generateToken(user)
+	// Start a session
+	resp, err := s.issueTokens(ctx, user, "", 0, userAgent)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return nil, apperrors.E(op, err)
 	}
+	return resp, nil
+}
 
-	return &AuthResponse{
-		Token:     token,
-		ExpiresIn: expiresIn,
-		UserID:    user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		IsAdmin:   user.IsAdmin,
-	}, nil
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token in the same session. The old refresh token stops working. A
+// refresh token presented again after it was exchanged may have been stolen,
+// so its whole session is revoked.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*AuthResponse, error) {
+	const op = "AuthService.RefreshToken"
+
+	token, err := s.redeemRefreshToken(ctx, op, refreshToken, 0)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.db.GetUser(ctx, token.UserID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	resp, err := s.issueTokens(ctx, user, token.SessionID, token.ProfileID, "")
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return resp, nil
 }
 
-func (s *AuthService) RefreshToken(ctx context.Context, token string) (*AuthResponse, error) {
-	// Parse and validate token
-	claims, err := s.parseToken(token)
+// switchProfile exchanges a refresh token of userID like RefreshToken, for
+// tokens acting as profileID, or as the account itself when it is 0. The
+// profile must belong to the user.
+func (s *AuthService) switchProfile(ctx context.Context, refreshToken string, userID, profileID int64) (*AuthResponse, error) {
+	const op = "AuthService.switchProfile"
+
+	token, err := s.redeemRefreshToken(ctx, op, refreshToken, userID)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.db.GetUser(ctx, token.UserID)
 	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	resp, err := s.issueTokens(ctx, user, token.SessionID, profileID, "")
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return resp, nil
+}
+
+// redeemRefreshToken revokes refreshToken, which must be valid and, unless
+// userID is 0, belong to userID, so it cannot be exchanged again. Tokens
+// presented after they were revoked revoke their whole session.
+func (s *AuthService) redeemRefreshToken(ctx context.Context, op, refreshToken string, userID int64) (*models.RefreshToken, error) {
+	token, err := s.db.GetRefreshTokenByHash(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if userID != 0 && token.UserID != userID {
 		return nil, ErrInvalidToken
 	}
 
-	// Get user
-	user, err := s.db.GetUser(ctx, claims.UserID)
+	now := s.now()
+	if token.RevokedAt != nil {
+		if err := s.db.RevokeSession(ctx, token.SessionID, now); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		return nil, ErrInvalidToken
+	}
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidToken
+	}
+
+	// Only one of concurrent exchanges of the token wins; treat the others
+	// as reuse
+	revoked, err := s.db.RevokeRefreshToken(ctx, token.ID, now)
 	if err != nil {
-		return nil, ErrUserNotFound
+		return nil, apperrors.E(op, err)
+	}
+	if !revoked {
+		if err := s.db.RevokeSession(ctx, token.SessionID, now); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		return nil, ErrInvalidToken
 	}
+	return token, nil
+}
 
-	// Generate new token
-	newToken, expiresIn, err := s.generateToken(user)
+// Logout revokes the session of a refresh token and the access token
+// accessToken, either of which may be empty, or every session and access
+// token of their user when allSessions is set. Other access tokens of the
+// session remain valid until they expire. Unknown tokens are ignored.
+func (s *AuthService) Logout(ctx context.Context, refreshToken, accessToken string, allSessions bool) error {
+	const op = "AuthService.Logout"
+
+	if accessToken != "" {
+		claims, err := s.parseToken(accessToken)
+		if err == nil && allSessions {
+			return s.LogoutAll(ctx, claims.UserID)
+		}
+		if err == nil && claims.ID != "" && claims.ExpiresAt != nil {
+			err = s.db.RevokeAccessTokens(ctx, &models.RevokedToken{
+				JTI:       claims.ID,
+				UserID:    claims.UserID,
+				ExpiresAt: claims.ExpiresAt.Time,
+			}, s.now())
+			if err != nil {
+				return apperrors.E(op, err)
+			}
+		}
+	}
+	if refreshToken == "" {
+		return nil
+	}
+
+	token, err := s.db.GetRefreshTokenByHash(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return apperrors.E(op, err)
 	}
 
-	return &AuthResponse{
-		Token:     newToken,
-		ExpiresIn: expiresIn,
+	if allSessions {
+		return s.LogoutAll(ctx, token.UserID)
+	}
+	if err := s.db.RevokeSession(ctx, token.SessionID, s.now()); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// LogoutAll revokes every session of userID and every access token issued
+// to them so far
+func (s *AuthService) LogoutAll(ctx context.Context, userID int64) error {
+	const op = "AuthService.LogoutAll"
+
+	now := s.now()
+	if err := s.db.RevokeUserSessions(ctx, userID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.revokeAccessTokens(ctx, userID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// DeleteAccount deletes the account of userID at their request. It can no
+// longer be used at once: every session and access token of the user is
+// revoked, and their reviews stay without an author. The account is removed
+// for good, with the rest of the user's data, once the deletion grace period
+// is over.
+func (s *AuthService) DeleteAccount(ctx context.Context, userID int64) error {
+	const op = "AuthService.DeleteAccount"
+
+	now := s.now()
+	if err := s.db.DeleteAccount(ctx, userID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.revokeAccessTokens(ctx, userID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ForgotPassword emails the user with email a link to reset their password,
+// replacing any link sent before. Nothing is sent to an unknown address, but
+// no error is returned either, so callers cannot tell which addresses have
+// accounts.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	const op = "AuthService.ForgotPassword"
+
+	user, err := s.db.GetUserByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	raw, err := randomHex(32)
+	if err != nil {
+		return apperrors.Errorf(op, "failed to generate reset token: %w", err)
+	}
+	now := s.now()
+	token := &models.PasswordResetToken{
 		UserID:    user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		IsAdmin:   user.IsAdmin,
-	}, nil
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: now.Add(s.passwordResetTTL),
+		CreatedAt: now,
+	}
+	if err := s.db.CreatePasswordResetToken(ctx, token); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	link := s.resetURL + "?token=" + url.QueryEscape(raw)
+	err = s.email.Send(ctx, Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s and works once.\n\n%s\n\nIf you did not ask to reset your password, you can ignore this email.\n",
+			user.Name, s.passwordResetTTL, link),
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password, which must meet the password policy,
+// using a token from a reset email and logs the user out of every session,
+// revoking their access tokens too
+func (s *AuthService) ResetPassword(ctx context.Context, token, password string) error {
+	const op = "AuthService.ResetPassword"
+
+	if err := checkPassword(s.policy, password); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return apperrors.Errorf(op, "failed to hash password: %w", err)
+	}
+
+	now := s.now()
+	userID, err := s.db.ResetPassword(ctx, hashRefreshToken(token), hashedPassword, now)
+	if errors.Is(err, database.ErrNotFound) {
+		return apperrors.E(op, ErrInvalidResetToken)
+	}
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.revokeAccessTokens(ctx, userID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ChangePassword replaces the password of userID, who must give their
+// current one, with newPassword, which must meet the password policy and
+// differ from it. Every session of the user but sessionID, the one asking,
+// is logged out, and the access tokens issued to them are revoked.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int64, sessionID, currentPassword, newPassword string) error {
+	const op = "AuthService.ChangePassword"
+
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if !s.hasher.Verify(user.Password, currentPassword) {
+		return apperrors.E(op, ErrWrongPassword)
+	}
+	if newPassword == currentPassword {
+		return apperrors.E(op, ErrPasswordReused)
+	}
+	if err := checkPassword(s.policy, newPassword); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	hashedPassword, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return apperrors.Errorf(op, "failed to hash password: %w", err)
+	}
+	now := s.now()
+	if err := s.db.ChangePassword(ctx, userID, hashedPassword, sessionID, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.db.RevokeAccessTokens(ctx, s.accessTokensRevocation(userID, sessionID, now), now); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// RequestEmailChange emails newEmail a link confirming it as the email of
+// userID, replacing any link sent before, and tells the current address
+// about the request. The email only changes once the link is confirmed
+// with ConfirmEmailChange.
+func (s *AuthService) RequestEmailChange(ctx context.Context, userID int64, newEmail string) error {
+	const op = "AuthService.RequestEmailChange"
+
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return apperrors.E(op, ErrEmailUnchanged)
+	}
+	taken, err := s.db.UserExists(ctx, newEmail)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if taken {
+		return apperrors.E(op, ErrEmailTaken)
+	}
+
+	raw, err := randomHex(32)
+	if err != nil {
+		return apperrors.Errorf(op, "failed to generate email change token: %w", err)
+	}
+	now := s.now()
+	token := &models.EmailChangeToken{
+		UserID:    user.ID,
+		NewEmail:  newEmail,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: now.Add(s.emailChangeTTL),
+		CreatedAt: now,
+	}
+	if err := s.db.CreateEmailChangeToken(ctx, token); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	link := s.confirmEmailURL + "?token=" + url.QueryEscape(raw)
+	err = s.email.Send(ctx, Email{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to confirm %s as the email address of your account. It expires in %s and works once.\n\n%s\n\nIf you did not ask to change your email address, you can ignore this email.\n",
+			user.Name, newEmail, s.emailChangeTTL, link),
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err = s.email.Send(ctx, Email{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nWe were asked to change the email address of your account to %s. It changes once the link we sent there is confirmed.\n\nIf you did not ask for this, change your password to keep your account safe.\n",
+			user.Name, newEmail),
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange changes the email of a user to the address confirmed
+// by token, from a link sent by RequestEmailChange. It fails with
+// ErrEmailTaken when another account took the address meanwhile.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) error {
+	const op = "AuthService.ConfirmEmailChange"
+
+	_, err := s.db.ChangeEmail(ctx, hashRefreshToken(token), s.now())
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return apperrors.E(op, ErrInvalidEmailChangeToken)
+	case errors.Is(err, database.ErrEmailTaken):
+		return apperrors.E(op, ErrEmailTaken)
+	case err != nil:
+		return apperrors.E(op, err)
+	}
+	return nil
 }
 
 func (s *AuthService) ValidateToken(ctx context.Context, token string) (int64, error) {
-	claims, err := s.parseToken(token)
+	claims, err := s.ValidateTokenClaims(ctx, token)
 	if err != nil {
-		return 0, ErrInvalidToken
+		return 0, err
 	}
 	return claims.UserID, nil
 }
 
+// ValidateTokenClaims is ValidateToken returning every claim of the token,
+// such as the profile it acts as. Revoked tokens are invalid.
+func (s *AuthService) ValidateTokenClaims(ctx context.Context, token string) (*Claims, error) {
+	claims, err := s.parseToken(token)
+	if err != nil || claims.IssuedAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	revoked, err := s.db.AccessTokenRevoked(ctx, claims.ID, claims.UserID, claims.SessionID, claims.issuedAt())
+	if err != nil {
+		return nil, apperrors.E("AuthService.ValidateTokenClaims", err)
+	}
+	if revoked {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys access tokens are verified with
+func (s *AuthService) JWKS() jwtkeys.JWKS {
+	return s.keys.JWKS()
+}
+
 func (s *AuthService) UserExists(ctx context.Context, email string) (bool, error) {
-	return s.db.UserExists(ctx, email)
+	exists, err := s.db.UserExists(ctx, email)
+	if err != nil {
+		return false, apperrors.E("AuthService.UserExists", err)
+	}
+	return exists, nil
 }
 
 func (s *AuthService) IsAdmin(ctx context.Context, userID int64) (bool, error) {
 	user, err := s.db.GetUser(ctx, userID)
 	if err != nil {
-		return false, err
+		return false, apperrors.E("AuthService.IsAdmin", err)
 	}
 	return user.IsAdmin, nil
 }
 
+// IsSuspended reports whether the user with userID is suspended, and may not
+// use the tokens they were issued before
+func (s *AuthService) IsSuspended(ctx context.Context, userID int64) (bool, error) {
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return false, apperrors.E("AuthService.IsSuspended", err)
+	}
+	return user.SuspendedAt != nil, nil
+}
+
 // Helper functions
 
-func (s *AuthService) generateToken(user *models.User) (string, int64, error) {
-	// Token expiration time (24 hours)
-	expirationTime := time.Now().Add(24 * time.Hour)
-	expiresIn := int64(time.Until(expirationTime).Seconds())
+// issueTokens returns a new access token and refresh token for user, acting
+// as profileID unless it is 0. The refresh token continues sessionID, or
+// starts a new session on the device with userAgent when it is empty.
+// Suspended users get ErrUserSuspended instead, and deleted accounts
+// ErrAccountDeleted.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User, sessionID string, profileID int64, userAgent string) (*AuthResponse, error) {
+	if !user.DeletedAt.IsZero() {
+		return nil, ErrAccountDeleted
+	}
+	if user.SuspendedAt != nil {
+		return nil, ErrUserSuspended
+	}
 
-	claims := &Claims{
-		UserID:  user.ID,
-		Email:   user.Email,
-		IsAdmin: user.IsAdmin,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	var err error
+	if sessionID == "" {
+		if sessionID, err = randomHex(16); err != nil {
+			return nil, fmt.Errorf("failed to generate session: %w", err)
+		}
 	}
+	accessToken, err := s.generateToken(user, profileID, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	refreshToken, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := s.now()
+	token := &models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		ProfileID: profileID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}
+	if err := s.db.CreateRefreshToken(ctx, token); err != nil {
+		return nil, err
+	}
+	if err := s.saveDevice(ctx, user.ID, sessionID, userAgent, now); err != nil {
+		return nil, err
+	}
+
+	return &AuthResponse{
+		Token:            accessToken,
+		ExpiresIn:        int64(s.accessTTL.Seconds()),
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(s.refreshTTL.Seconds()),
+		UserID:           user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		IsAdmin:          user.IsAdmin,
+		ProfileID:        profileID,
+	}, nil
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(s.jwtSecret)
+func (s *AuthService) generateToken(user *models.User, profileID int64, sessionID string) (string, error) {
+	jti, err := randomHex(16)
 	if err != nil {
-		return "", 0, err
+		return "", err
+	}
+
+	now := s.now()
+	claims := &Claims{
+		UserID:         user.ID,
+		Email:          user.Email,
+		IsAdmin:        user.IsAdmin,
+		ProfileID:      profileID,
+		SessionID:      sessionID,
+		IssuedAtMicros: now.UnixMicro(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
 	}
 
-	return tokenString, expiresIn, nil
+	return s.keys.Sign(claims)
 }
 
 func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
 
 	if err != nil {
 		return nil, err
@@ -200,6 +725,40 @@ func (s *AuthService) parseToken(tokenString string) (*Claims, error) {
 	return nil, ErrInvalidToken
 }
 
+// revokeAccessTokens revokes every access token issued to userID before
+// now, to the microsecond tokens record their issue time in, so tokens
+// issued right after, such as on signing in again, keep working
+func (s *AuthService) revokeAccessTokens(ctx context.Context, userID int64, now time.Time) error {
+	return s.db.RevokeAccessTokens(ctx, s.accessTokensRevocation(userID, "", now), now)
+}
+
+// accessTokensRevocation revokes the access tokens issued to userID before
+// now, as revokeAccessTokens does, but those of keptSessionID unless empty
+func (s *AuthService) accessTokensRevocation(userID int64, keptSessionID string, now time.Time) *models.RevokedToken {
+	before := now.Truncate(time.Microsecond)
+	return &models.RevokedToken{
+		UserID:        userID,
+		IssuedBefore:  before,
+		KeptSessionID: keptSessionID,
+		ExpiresAt:     before.Add(s.accessTTL),
+	}
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashRefreshToken hashes an opaque token, such as a refresh or password
+// reset token, for storage
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
 // Context functions
 
 func ContextWithUserID(ctx context.Context, userID int64) context.Context {
@@ -211,13 +770,41 @@ func UserIDFromContext(ctx context.Context) int64 {
 	return userID
 }
 
+// ContextWithProfileID records the profile of the user the request acts as
+func ContextWithProfileID(ctx context.Context, profileID int64) context.Context {
+	return context.WithValue(ctx, profileIDKey, profileID)
+}
+
+// ProfileIDFromContext returns the profile the request acts as, or 0 when
+// it acts as the account itself
+func ProfileIDFromContext(ctx context.Context) int64 {
+	profileID, _ := ctx.Value(profileIDKey).(int64)
+	return profileID
+}
+
+// ContextWithSessionID records the session whose access token authenticated
+// the request
+func ContextWithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFromContext returns the session of the request, or an empty
+// string for access tokens issued before they carried one
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey).(string)
+	return sessionID
+}
+
 // Response types
 
 type AuthResponse struct {
-	Token     string `json:"token"`
-	ExpiresIn int64  `json:"expires_in"`
-	UserID    int64  `json:"user_id"`
-	Name      string `json:"name"`
-	Email     string `json:"email"`
-	IsAdmin   bool   `json:"is_admin"`
+	Token            string `json:"token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in"`
+	UserID           int64  `json:"user_id"`
+	Name             string `json:"name"`
+	Email            string `json:"email"`
+	IsAdmin          bool   `json:"is_admin"`
+	ProfileID        int64  `json:"profile_id,omitempty"`
 }
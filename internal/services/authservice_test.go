@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAccessTokensRevocation(t *testing.T) {
+	s := &AuthService{accessTTL: 15 * time.Minute}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 123456789, time.UTC)
+	before := time.Date(2026, 10, 16, 12, 0, 0, 123456000, time.UTC)
+
+	tests := []struct {
+		name string
+		kept string
+	}{
+		{"password change", "session-a"},
+		{"every session", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.accessTokensRevocation(7, tt.kept, now)
+			if got.UserID != 7 || got.JTI != "" {
+				t.Errorf("revocation = %+v, want every token of user 7", got)
+			}
+			if got.KeptSessionID != tt.kept {
+				t.Errorf("KeptSessionID = %q, want %q", got.KeptSessionID, tt.kept)
+			}
+			if !got.IssuedBefore.Equal(before) {
+				t.Errorf("IssuedBefore = %v, want %v", got.IssuedBefore, before)
+			}
+			if want := before.Add(15 * time.Minute); !got.ExpiresAt.Equal(want) {
+				t.Errorf("ExpiresAt = %v, want %v, when the last token revoked expires", got.ExpiresAt, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"image"
+	"image/color"
+	_ "image/gif" // registers GIF decoding
+	"image/jpeg"
+	_ "image/png" // registers PNG decoding
+	"net/http"
+)
+
+const (
+	// DefaultMaxAvatarSize is the largest avatar accepted, 2 MiB, unless
+	// configured otherwise
+	DefaultMaxAvatarSize = 2 << 20
+	// MaxAvatarDimension is the largest width or height of avatars
+	// accepted, in pixels, which bounds the memory decoding them takes
+	MaxAvatarDimension = 4096
+
+	// DefaultAvatarSize names the size stored as the profile's avatar
+	DefaultAvatarSize = "medium"
+
+	avatarQuality = 90
+)
+
+var (
+	ErrAvatarTooLarge    = errors.New("avatar is too large")
+	ErrAvatarDimensions  = errors.New("avatar dimensions are too large")
+	ErrUnsupportedAvatar = errors.New("unsupported avatar image type")
+)
+
+// avatarTypes are the image types accepted as avatars, which the standard
+// library decodes
+var avatarTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// AvatarSizes are the square sizes, in pixels, avatars are stored in
+var AvatarSizes = []struct {
+	Name string
+	Size int
+}{
+	{"small", 64},
+	{DefaultAvatarSize, 256},
+	{"large", 512},
+}
+
+// MaxAvatarSize is the largest avatar accepted, in bytes
+func (s *StorageService) MaxAvatarSize() int64 {
+	if s.cfg.MaxAvatarSize <= 0 {
+		return DefaultMaxAvatarSize
+	}
+	return s.cfg.MaxAvatarSize
+}
+
+// StoreAvatar crops image to a centered square, stores it as a JPEG in each
+// of the AvatarSizes as an avatar of userID, and returns their public URLs
+// by size name. JPEG, PNG and GIF images are accepted, detected from their
+// content. Images smaller than a size are not enlarged to it.
+func (s *StorageService) StoreAvatar(ctx context.Context, userID int64, data []byte) (map[string]string, error) {
+	const op = "StorageService.StoreAvatar"
+
+	if s.client == nil {
+		return nil, apperrors.E(op, ErrStorageDisabled)
+	}
+	if int64(len(data)) > s.MaxAvatarSize() {
+		return nil, apperrors.E(op, ErrAvatarTooLarge)
+	}
+	if !avatarTypes[http.DetectContentType(data)] {
+		return nil, apperrors.E(op, ErrUnsupportedAvatar)
+	}
+
+	// Check the dimensions before decoding the pixels
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, apperrors.E(op, ErrUnsupportedAvatar)
+	}
+	if cfg.Width > MaxAvatarDimension || cfg.Height > MaxAvatarDimension {
+		return nil, apperrors.E(op, ErrAvatarDimensions)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, apperrors.E(op, fmt.Errorf("%w: %v", ErrUnsupportedAvatar, err))
+	}
+	if src.Bounds().Empty() {
+		return nil, apperrors.E(op, ErrUnsupportedAvatar)
+	}
+
+	name, err := randomHex(8)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, squareThumbnail(src, size.Size), &jpeg.Options{Quality: avatarQuality}); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		key := fmt.Sprintf("avatars/users/%d/%s/%s.jpg", userID, name, size.Name)
+		if err := s.put(ctx, key, "image/jpeg", buf.Bytes()); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		urls[size.Name] = s.objectURL(key)
+	}
+	return urls, nil
+}
+
+// squareThumbnail crops the centered square of src and scales it down to
+// size pixels, or the square's own size when smaller, averaging the source
+// pixels each covers. Transparent pixels are laid over white, as JPEG has
+// no transparency.
+func squareThumbnail(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0, y0 := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+	if size > side {
+		size = side
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for dy := 0; dy < size; dy++ {
+		sy0, sy1 := y0+dy*side/size, y0+(dy+1)*side/size
+		for dx := 0; dx < size; dx++ {
+			sx0, sx1 := x0+dx*side/size, x0+(dx+1)*side/size
+
+			var r, g, bl, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					// Colors are alpha-premultiplied, so adding the
+					// missing alpha lays them over white
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(dx, dy, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
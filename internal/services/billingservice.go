@@ -0,0 +1,517 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/entitlements"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/models"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrBillingDisabled   = errors.New("billing is not configured")
+	ErrInvalidPlan       = errors.New("invalid plan")
+	ErrPlanPriceTaken    = errors.New("stripe price already used by another plan")
+	ErrAlreadySubscribed = errors.New("already subscribed")
+	// ErrPlanNotFound is a database.ErrNotFound for plans that do not exist
+	// or are not active
+	ErrPlanNotFound = fmt.Errorf("plan %w", database.ErrNotFound)
+	// ErrNoSubscription is a database.ErrNotFound for users who never
+	// subscribed
+	ErrNoSubscription = fmt.Errorf("subscription %w", database.ErrNotFound)
+)
+
+// planCodePattern is what plan codes look like, such as "premium"
+var planCodePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// entitledStatuses are the subscription statuses that grant playback, with
+// the entitlements of the subscription's plan.
+// Past due subscriptions keep it while Stripe retries the payment.
+var entitledStatuses = []string{models.SubscriptionActive, models.SubscriptionTrialing, models.SubscriptionPastDue}
+
+// billingEventTypes are the Stripe events that change a subscription.
+// Others are acknowledged and ignored.
+var billingEventTypes = []string{
+	"checkout.session.completed",
+	"customer.subscription.created",
+	"customer.subscription.updated",
+	"customer.subscription.deleted",
+	"customer.subscription.paused",
+	"customer.subscription.resumed",
+	"invoice.paid",
+	"invoice.payment_failed",
+}
+
+// BillingService sells subscription plans through Stripe. Customers pay in
+// Stripe Checkout and manage their subscription in the customer portal;
+// Stripe's webhook events keep the local copy of their subscriptions up to
+// date, which playback is gated on: subscribers get the entitlements of
+// their plan.
+type BillingService struct {
+	db     *bun.DB
+	stripe *integrations.StripeClient
+	policy *entitlements.Policy
+	cache  cache.Cache
+	cfg    config.BillingConfig
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// NewBillingService bills through stripe, nil when billing is disabled.
+// policy maps the plans of subscribers to their entitlements.
+func NewBillingService(db *bun.DB, stripe *integrations.StripeClient, policy *entitlements.Policy, c cache.Cache, cfg config.BillingConfig, logger *zap.Logger) *BillingService {
+	return &BillingService{db: db, stripe: stripe, policy: policy, cache: c, cfg: cfg, logger: logger, now: time.Now}
+}
+
+// Enabled reports whether billing is configured. Without it, playback is
+// not gated on subscriptions.
+func (s *BillingService) Enabled() bool {
+	return s.stripe != nil
+}
+
+// ListPlans returns the plans in order of price, only the active ones
+// unless all is set
+func (s *BillingService) ListPlans(ctx context.Context, all bool) ([]models.Plan, error) {
+	const op = "BillingService.ListPlans"
+
+	plans := make([]models.Plan, 0)
+	query := s.db.NewSelect().Model(&plans).Order("price_cents", "id")
+	if !all {
+		query.Where("active")
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return plans, nil
+}
+
+// PutPlan creates the plan with the code of plan, or replaces its name,
+// price and active flag
+func (s *BillingService) PutPlan(ctx context.Context, plan *models.Plan) error {
+	const op = "BillingService.PutPlan"
+
+	plan.Name = strings.TrimSpace(plan.Name)
+	plan.StripePriceID = strings.TrimSpace(plan.StripePriceID)
+	plan.Currency = strings.ToLower(plan.Currency)
+	if !planCodePattern.MatchString(plan.Code) || plan.Name == "" || len(plan.Name) > 100 ||
+		plan.StripePriceID == "" || plan.PriceCents < 0 || len(plan.Currency) != 3 ||
+		(plan.Interval != "month" && plan.Interval != "year") {
+		return apperrors.E(op, ErrInvalidPlan)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		taken, err := tx.NewSelect().
+			Model((*models.Plan)(nil)).
+			Where("stripe_price_id = ? AND code != ?", plan.StripePriceID, plan.Code).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrPlanPriceTaken
+		}
+
+		now := s.now()
+		plan.CreatedAt = now
+		plan.UpdatedAt = now
+		_, err = tx.NewInsert().
+			Model(plan).
+			On("CONFLICT (code) DO UPDATE").
+			Set("name = EXCLUDED.name").
+			Set("stripe_price_id = EXCLUDED.stripe_price_id").
+			Set("price_cents = EXCLUDED.price_cents").
+			Set("currency = EXCLUDED.currency").
+			Set("billing_interval = EXCLUDED.billing_interval").
+			Set("active = EXCLUDED.active").
+			Set("updated_at = EXCLUDED.updated_at").
+			Returning("id, created_at").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// Subscription returns the latest subscription of userID with its plan
+func (s *BillingService) Subscription(ctx context.Context, userID int64) (*models.Subscription, error) {
+	const op = "BillingService.Subscription"
+
+	sub, err := s.latestSubscription(ctx, userID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return sub, nil
+}
+
+// Entitlements returns what userID may do when playing videos: anything
+// when billing is disabled or they are an admin, and otherwise what the
+// plan of their active, trialing or past due subscription includes. It is
+// nil for users without such a subscription, who may not play videos.
+func (s *BillingService) Entitlements(ctx context.Context, userID int64) (*entitlements.Entitlements, error) {
+	const op = "BillingService.Entitlements"
+
+	if !s.Enabled() {
+		return &entitlements.Unlimited, nil
+	}
+	admin, err := s.db.NewSelect().
+		Model((*models.User)(nil)).
+		Where("id = ? AND is_admin", userID).
+		Exists(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if admin {
+		return &entitlements.Unlimited, nil
+	}
+
+	sub := new(models.Subscription)
+	err = s.db.NewSelect().
+		Model(sub).
+		Relation("Plan").
+		Where("sub.user_id = ?", userID).
+		Where("sub.status IN (?)", bun.In(entitledStatuses)).
+		Order("sub.created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	// Subscriptions to prices of no plan get the default entitlements
+	var code string
+	if sub.Plan != nil {
+		code = sub.Plan.Code
+	}
+	e := s.policy.ForPlan(code)
+	return &e, nil
+}
+
+// Ping checks that Stripe can be reached, for health checks
+func (s *BillingService) Ping(ctx context.Context) error {
+	if !s.Enabled() {
+		return ErrBillingDisabled
+	}
+	return s.stripe.Ping(ctx)
+}
+
+// ratePlanTTL is how long the plan of a user is cached for rate limiting,
+// so a change of plan applies to their limits within it
+const ratePlanTTL = time.Minute
+
+// RatePlan returns the code of the plan of the user authenticated in ctx,
+// which rate_limit.plan_multipliers scale their limits by. It is empty for
+// anonymous callers, users without an entitled subscription, and when the
+// plan cannot be read, who all get the base limits.
+func (s *BillingService) RatePlan(ctx context.Context) string {
+	userID := UserIDFromContext(ctx)
+	if userID == 0 || !s.Enabled() {
+		return ""
+	}
+
+	key := fmt.Sprintf("billing:rate_plan:%d", userID)
+	var code string
+	if ok, err := s.cache.Get(ctx, key, &code); err == nil && ok {
+		return code
+	}
+	err := s.db.NewSelect().
+		ColumnExpr("pl.code").
+		TableExpr("subscriptions AS sub").
+		Join("JOIN plans AS pl ON pl.id = sub.plan_id").
+		Where("sub.user_id = ?", userID).
+		Where("sub.status IN (?)", bun.In(entitledStatuses)).
+		OrderExpr("sub.created_at DESC").
+		Limit(1).
+		Scan(ctx, &code)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logger.Warn("failed to read plan for rate limiting", zap.Int64("user_id", userID), zap.Error(err))
+		return ""
+	}
+	// Best effort: the plan is read again on the next request otherwise
+	_ = s.cache.Set(ctx, key, code, ratePlanTTL)
+	return code
+}
+
+// Checkout starts a Checkout session subscribing userID to the active plan
+// with code, discounted by the coupon they redeemed, if any. Subscribed
+// users change plans in the customer portal instead.
+func (s *BillingService) Checkout(ctx context.Context, userID int64, code string) (*integrations.CheckoutSession, error) {
+	const op = "BillingService.Checkout"
+
+	if !s.Enabled() {
+		return nil, apperrors.E(op, ErrBillingDisabled)
+	}
+
+	plan := new(models.Plan)
+	err := s.db.NewSelect().
+		Model(plan).
+		Where("code = ? AND active", code).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, ErrPlanNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	subscribed, err := s.subscribed(ctx, userID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if subscribed {
+		return nil, apperrors.E(op, ErrAlreadySubscribed)
+	}
+
+	params := integrations.CheckoutParams{
+		PriceID:    plan.StripePriceID,
+		UserID:     userID,
+		SuccessURL: s.cfg.SuccessURL,
+		CancelURL:  s.cfg.CancelURL,
+	}
+	// Users who subscribed before keep their Stripe customer
+	sub, err := s.latestSubscription(ctx, userID)
+	switch {
+	case err == nil:
+		params.Customer = sub.StripeCustomerID
+	case errors.Is(err, ErrNoSubscription):
+		user := new(models.User)
+		if err := s.db.NewSelect().Model(user).Column("email").Where("id = ?", userID).Scan(ctx); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		params.CustomerEmail = user.Email
+	default:
+		return nil, apperrors.E(op, err)
+	}
+
+	redemption, err := s.pendingRedemption(ctx, userID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if redemption != nil {
+		if redemption.Coupon.AmountOffCents > 0 && redemption.Coupon.Currency != plan.Currency {
+			return nil, apperrors.E(op, ErrCouponNotApplicable)
+		}
+		params.Coupon = redemption.Coupon.StripeCouponID
+	}
+
+	session, err := s.stripe.CreateCheckoutSession(ctx, params)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	// The redemption is used once the session completes
+	if redemption != nil {
+		_, err = s.db.NewUpdate().
+			Model(redemption).
+			Set("checkout_session_id = ?", session.ID).
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+	}
+	return session, nil
+}
+
+// Portal returns the URL of a customer portal session where userID manages
+// their subscription, payment methods and invoices
+func (s *BillingService) Portal(ctx context.Context, userID int64) (string, error) {
+	const op = "BillingService.Portal"
+
+	if !s.Enabled() {
+		return "", apperrors.E(op, ErrBillingDisabled)
+	}
+	sub, err := s.latestSubscription(ctx, userID)
+	if err != nil {
+		return "", apperrors.E(op, err)
+	}
+
+	url, err := s.stripe.CreatePortalSession(ctx, sub.StripeCustomerID, s.cfg.PortalReturnURL)
+	if err != nil {
+		return "", apperrors.E(op, err)
+	}
+	return url, nil
+}
+
+// HandleWebhook applies a Stripe webhook event given its payload, whose
+// signature was verified by the route. Whatever the event says, the subscription it is
+// about is fetched from Stripe, so events applied out of order still leave
+// its latest state. Events are applied once; redeliveries are ignored.
+func (s *BillingService) HandleWebhook(ctx context.Context, payload []byte) error {
+	const op = "BillingService.HandleWebhook"
+
+	if !s.Enabled() {
+		return apperrors.E(op, ErrBillingDisabled)
+	}
+	event, err := s.stripe.ParseEvent(payload)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if !slices.Contains(billingEventTypes, event.Type) {
+		return nil
+	}
+
+	handled, err := s.db.NewSelect().
+		Model((*models.BillingEvent)(nil)).
+		Where("id = ?", event.ID).
+		Exists(ctx)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if handled {
+		return nil
+	}
+
+	var sub *models.Subscription
+	if id := event.SubscriptionID(); id != "" {
+		if sub, err = s.fetchSubscription(ctx, id); err != nil {
+			return apperrors.E(op, err)
+		}
+	}
+
+	err = s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewInsert().
+			Model(&models.BillingEvent{ID: event.ID, Type: event.Type, ReceivedAt: s.now()}).
+			On("CONFLICT (id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		// A concurrent delivery of the same event got there first
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		// Coupons applied to a completed Checkout session are used up
+		if event.Type == "checkout.session.completed" {
+			_, err = tx.NewUpdate().
+				Model((*models.CouponRedemption)(nil)).
+				Set("used_at = ?", s.now()).
+				Where("checkout_session_id = ? AND used_at IS NULL", event.ObjectID()).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+		if sub == nil {
+			return nil
+		}
+
+		_, err = tx.NewInsert().
+			Model(sub).
+			On("CONFLICT (stripe_subscription_id) DO UPDATE").
+			Set("plan_id = EXCLUDED.plan_id").
+			Set("stripe_customer_id = EXCLUDED.stripe_customer_id").
+			Set("status = EXCLUDED.status").
+			Set("current_period_end = EXCLUDED.current_period_end").
+			Set("cancel_at_period_end = EXCLUDED.cancel_at_period_end").
+			Set("updated_at = EXCLUDED.updated_at").
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// fetchSubscription returns the current state of the Stripe subscription
+// with id as a local subscription, or nil when it belongs to no user
+func (s *BillingService) fetchSubscription(ctx context.Context, id string) (*models.Subscription, error) {
+	remote, err := s.stripe.Subscription(ctx, id)
+	if errors.Is(err, integrations.ErrStripeNotFound) {
+		s.logger.Warn("stripe event for unknown subscription", zap.String("subscription", id))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscriptions created in the Stripe dashboard have no user_id, but
+	// may be of a customer who subscribed through Checkout before
+	userID := remote.UserID
+	if userID == 0 {
+		err := s.db.NewSelect().
+			Model((*models.Subscription)(nil)).
+			Column("user_id").
+			Where("stripe_customer_id = ?", remote.Customer).
+			Order("created_at DESC").
+			Limit(1).
+			Scan(ctx, &userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.logger.Warn("stripe subscription of no user", zap.String("subscription", id), zap.String("customer", remote.Customer))
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Prices of no plan leave the plan empty; the subscription still counts
+	var planID int64
+	err = s.db.NewSelect().
+		Model((*models.Plan)(nil)).
+		Column("id").
+		Where("stripe_price_id = ?", remote.PriceID).
+		Scan(ctx, &planID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	now := s.now()
+	return &models.Subscription{
+		UserID:               userID,
+		PlanID:               planID,
+		StripeCustomerID:     remote.Customer,
+		StripeSubscriptionID: remote.ID,
+		Status:               remote.Status,
+		CurrentPeriodEnd:     remote.CurrentPeriodEnd,
+		CancelAtPeriodEnd:    remote.CancelAtPeriodEnd,
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}, nil
+}
+
+// subscribed reports whether userID has a subscription in one of the
+// entitledStatuses
+func (s *BillingService) subscribed(ctx context.Context, userID int64) (bool, error) {
+	return s.db.NewSelect().
+		Model((*models.Subscription)(nil)).
+		Where("user_id = ?", userID).
+		Where("status IN (?)", bun.In(entitledStatuses)).
+		Exists(ctx)
+}
+
+func (s *BillingService) latestSubscription(ctx context.Context, userID int64) (*models.Subscription, error) {
+	sub := new(models.Subscription)
+	err := s.db.NewSelect().
+		Model(sub).
+		Relation("Plan").
+		Where("sub.user_id = ?", userID).
+		Order("sub.created_at DESC").
+		Limit(1).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoSubscription
+	}
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// maxBoostPosition is the furthest position a movie can be pinned to
+const maxBoostPosition = 100
+
+// Audit actions and entity type of editorial boosts
+const (
+	AuditActionCreateBoost = "create_boost"
+	AuditActionUpdateBoost = "update_boost"
+	AuditActionDeleteBoost = "delete_boost"
+
+	auditEntityBoost = "editorial_boost"
+)
+
+var ErrInvalidBoost = errors.New("invalid editorial boost")
+
+// BoostService manages the editorial boosts and pins consulted by
+// MovieService.GetMovies. Every change is recorded in the audit log and
+// drops the cached movie listings.
+type BoostService struct {
+	db    *bun.DB
+	cache cache.Cache
+	now   func() time.Time
+}
+
+func NewBoostService(db *bun.DB, c cache.Cache) *BoostService {
+	return &BoostService{db: db, cache: c, now: time.Now}
+}
+
+// ListBoosts returns every boost, or only those in effect now when
+// activeOnly is set, grouped by listing
+func (s *BoostService) ListBoosts(ctx context.Context, activeOnly bool) ([]models.EditorialBoost, error) {
+	var boosts []models.EditorialBoost
+	query := s.db.NewSelect().
+		Model(&boosts).
+		OrderExpr("query NULLS FIRST, category NULLS FIRST, position NULLS LAST, weight DESC, id ASC")
+	if activeOnly {
+		activeAt(query, s.now())
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, apperrors.E("BoostService.ListBoosts", err)
+	}
+	return boosts, nil
+}
+
+func (s *BoostService) CreateBoost(ctx context.Context, boost *models.EditorialBoost) error {
+	const op = "BoostService.CreateBoost"
+
+	if err := validateBoost(boost); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := boostedMovieExists(ctx, tx, boost.MovieID); err != nil {
+			return err
+		}
+
+		now := s.now()
+		boost.CreatedAt = now
+		boost.UpdatedAt = now
+		if _, err := tx.NewInsert().Model(boost).Exec(ctx); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditActionCreateBoost, auditEntityBoost, boost.ID, nil, boost)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+func (s *BoostService) UpdateBoost(ctx context.Context, boost *models.EditorialBoost) error {
+	const op = "BoostService.UpdateBoost"
+
+	if err := validateBoost(boost); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := boostedMovieExists(ctx, tx, boost.MovieID); err != nil {
+			return err
+		}
+
+		before := &models.EditorialBoost{ID: boost.ID}
+		err := tx.NewSelect().Model(before).WherePK().For("UPDATE").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("boost %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		boost.UpdatedAt = s.now()
+		err = tx.NewUpdate().
+			Model(boost).
+			ExcludeColumn("created_at").
+			WherePK().
+			Returning("created_at").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("boost %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditActionUpdateBoost, auditEntityBoost, boost.ID, before, boost)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+func (s *BoostService) DeleteBoost(ctx context.Context, id int64) error {
+	const op = "BoostService.DeleteBoost"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*models.EditorialBoost)(nil)).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("boost %w", database.ErrNotFound)
+		}
+		return recordAudit(ctx, tx, AuditActionDeleteBoost, auditEntityBoost, id)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+// validateBoost normalises the listing of a boost and checks it either pins
+// or weighs the movie, within a consistent schedule
+func validateBoost(boost *models.EditorialBoost) error {
+	boost.Query = normalizeSearchTerm(boost.Query)
+	boost.Category = strings.TrimSpace(boost.Category)
+
+	switch {
+	case boost.MovieID <= 0:
+		return fmt.Errorf("%w: movie_id is required", ErrInvalidBoost)
+	case boost.Query != "" && boost.Category != "":
+		return fmt.Errorf("%w: set query or category, not both", ErrInvalidBoost)
+	case (boost.Position > 0) == (boost.Weight > 0):
+		return fmt.Errorf("%w: set either a position or a positive weight", ErrInvalidBoost)
+	case boost.Position < 0 || boost.Position > maxBoostPosition:
+		return fmt.Errorf("%w: position must be between 1 and %d", ErrInvalidBoost, maxBoostPosition)
+	case boost.Weight < 0:
+		return fmt.Errorf("%w: weight must not be negative", ErrInvalidBoost)
+	case !boost.StartsAt.IsZero() && !boost.EndsAt.IsZero() && !boost.EndsAt.After(boost.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidBoost)
+	}
+	return nil
+}
+
+func boostedMovieExists(ctx context.Context, db bun.IDB, movieID int64) error {
+	exists, err := db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Where("id = ?", movieID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("movie %w", database.ErrNotFound)
+	}
+	return nil
+}
+
+// activeAt restricts a boost query to boosts scheduled to apply at t
+func activeAt(query *bun.SelectQuery, t time.Time) *bun.SelectQuery {
+	return query.
+		Where("starts_at IS NULL OR starts_at <= ?", t).
+		Where("ends_at IS NULL OR ends_at > ?", t)
+}
+
+// boostListing returns the query and category the boosts of the listing
+// shown for filter are keyed by. Boosts only apply to the default order, as
+// an explicit sort asked for by the client takes precedence.
+func boostListing(filter MovieFilter) (query, category string, ok bool) {
+	if filter.SortBy != "" || filter.CategoryID != nil || filter.CategorySlug != "" {
+		return "", "", false
+	}
+
+	switch {
+	case filter.Search != "":
+		return normalizeSearchTerm(filter.Search), "", true
+	case len(filter.Categories) == 1:
+		return "", filter.Categories[0], true
+	case len(filter.Categories) == 0:
+		return "", "", true
+	default:
+		return "", "", false
+	}
+}
+
+// activeBoosts returns the boosts in effect now for a listing, pins in
+// position order and weighted boosts by descending weight
+func activeBoosts(ctx context.Context, db bun.IDB, query, category string, now time.Time) (pins, weighted []models.EditorialBoost, err error) {
+	var boosts []models.EditorialBoost
+	q := db.NewSelect().Model(&boosts)
+	if query != "" {
+		q.Where("query = ?", query)
+	} else {
+		q.Where("query IS NULL")
+	}
+	if category != "" {
+		q.Where("LOWER(category) = LOWER(?)", category)
+	} else {
+		q.Where("category IS NULL")
+	}
+	activeAt(q, now).OrderExpr("position NULLS LAST, weight DESC, id ASC")
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, nil, err
+	}
+	for _, b := range boosts {
+		if b.Position > 0 {
+			pins = append(pins, b)
+		} else {
+			weighted = append(weighted, b)
+		}
+	}
+	return pins, weighted, nil
+}
+
+// pinnedMovie is a movie pinned at a 0-based position of a listing
+type pinnedMovie struct {
+	movie models.Movie
+	at    int
+}
+
+// placePins sorts pins by position and moves them so no two share a
+// position and all fall within a listing of total movies
+func placePins(pins []pinnedMovie, total int) {
+	sort.SliceStable(pins, func(i, j int) bool { return pins[i].at < pins[j].at })
+	for i := 1; i < len(pins); i++ {
+		if pins[i].at <= pins[i-1].at {
+			pins[i].at = pins[i-1].at + 1
+		}
+	}
+	for i := len(pins) - 1; i >= 0; i-- {
+		if last := total - (len(pins) - i); pins[i].at > last {
+			pins[i].at = last
+		}
+	}
+}
+
+// paginatePinned returns the page [offset, offset+limit) of a listing made of
+// placed pins with the organic results filling every other position. organic
+// fetches organic results by offset and limit.
+func paginatePinned(pins []pinnedMovie, offset, limit int, organic func(offset, limit int) ([]models.Movie, error)) ([]models.Movie, error) {
+	before := 0
+	for _, p := range pins {
+		if p.at < offset {
+			before++
+		}
+	}
+
+	rest, err := organic(offset-before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	page := make([]models.Movie, 0, limit)
+	next := before
+	for pos := offset; pos < offset+limit; pos++ {
+		switch {
+		case next < len(pins) && pins[next].at == pos:
+			page = append(page, pins[next].movie)
+			next++
+		case len(rest) > 0:
+			page = append(page, rest[0])
+			rest = rest[1:]
+		default:
+			return page, nil
+		}
+	}
+	return page, nil
+}
@@ -2,66 +2,465 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
 	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
 	"github.com/ndn/internal/models"
+	"time"
 )
 
+// Intervals category growth can be reported by
+const (
+	StatsIntervalWeek  = "week"
+	StatsIntervalMonth = "month"
+)
+
+const (
+	// DefaultStatsPeriods is how many intervals category growth covers by
+	// default, and MaxStatsPeriods the most it may cover
+	DefaultStatsPeriods = 12
+	MaxStatsPeriods     = 60
+)
+
+var (
+	ErrCategoryExists       = errors.New("category already exists")
+	ErrCategoryInUse        = errors.New("category is being used by movies")
+	ErrInvalidCategoryOrder = errors.New("category order must list existing categories once each")
+	ErrInvalidStatsInterval = errors.New("invalid category stats interval")
+	ErrCategorySlugTaken    = errors.New("another category has the slug of this name")
+	ErrInvalidCategoryName  = errors.New("category name must contain a letter or digit")
+	ErrParentCategory       = errors.New("parent category not found")
+	ErrCategoryCycle        = errors.New("category cannot be nested under itself or its sub-categories")
+	ErrCategoryHasChildren  = errors.New("category has sub-categories")
+)
+
+// CategoryGrowth is how many titles a category gained in the period starting
+// at Period, and how many it had at the end of it
+type CategoryGrowth struct {
+	Period time.Time `json:"period"`
+	Added  int64     `json:"added" example:"4"`
+	Titles int64     `json:"titles" example:"36"`
+}
+
+// CategoryStats sums up the catalog of a category for content managers
+type CategoryStats struct {
+	ID            int64            `json:"id" example:"1"`
+	Name          string           `json:"name" example:"Sci-Fi"`
+	Hidden        bool             `json:"hidden"`
+	Titles        int64            `json:"titles" example:"36"`
+	AverageRating *float64         `json:"average_rating" example:"7.4"` // null when no title is rated
+	WatchSeconds  int64            `json:"watch_seconds" example:"5400000"`
+	Growth        []CategoryGrowth `json:"growth"`
+}
+
+// CategoryService manages categories. Public reads, of categories that are
+// neither hidden nor deleted, go to a read replica; the rest, and reads made
+// before changing a category, go to the primary.
 type CategoryService struct {
-	db *database.CategoryDB
+	db       *database.CategoryDB
+	replicas *database.Replicas
+	cache    cache.Cache
+	now      func() time.Time
 }
 
-func NewCategoryService(db *database.CategoryDB) *CategoryService {
+func NewCategoryService(db *database.CategoryDB, replicas *database.Replicas, c cache.Cache) *CategoryService {
 	return &CategoryService{
-		db: db,
+		db:       db,
+		replicas: replicas,
+		cache:    c,
+		now:      time.Now,
 	}
 }
 
-func (s *CategoryService) GetCategories(ctx context.Context) ([]*models.Category, error) {
-	return s.db.GetCategories(ctx)
+// replica returns the categories of a read replica, for public reads
+func (s *CategoryService) replica() *database.CategoryDB {
+	return database.NewCategoryDB(s.replicas.Reader())
 }
 
-func (s *CategoryService) GetCategory(ctx context.Context, id int64) (*models.Category, error) {
+// GetCategories returns categories in display order. Hidden categories are
+// only included when includeHidden is set, and deleted ones when
+// includeDeleted is.
+func (s *CategoryService) GetCategories(ctx context.Context, includeHidden, includeDeleted bool) ([]*models.Category, error) {
+	const op = "CategoryService.GetCategories"
+
+	db := s.db
+	if !includeHidden && !includeDeleted {
+		db = s.replica()
+	}
+	categories, err := db.GetCategories(ctx, includeHidden, includeDeleted)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return categories, nil
+}
+
+// GetCategory returns a category by ID. A hidden category is reported as not
+// found unless includeHidden is set.
+func (s *CategoryService) GetCategory(ctx context.Context, id int64, includeHidden bool) (*models.Category, error) {
+	const op = "CategoryService.GetCategory"
+
+	db := s.db
+	if !includeHidden {
+		db = s.replica()
+	}
+	category, err := db.GetCategory(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if category.Hidden && !includeHidden {
+		return nil, apperrors.E(op, fmt.Errorf("category %w", database.ErrNotFound))
+	}
+	return category, nil
+}
+
+// GetCategoryBySlug returns a category by slug. A hidden category is
+// reported as not found.
+func (s *CategoryService) GetCategoryBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	const op = "CategoryService.GetCategoryBySlug"
+
+	category, err := s.replica().GetCategoryBySlug(ctx, slug)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if category.Hidden {
+		return nil, apperrors.E(op, fmt.Errorf("category %w", database.ErrNotFound))
+	}
+	return category, nil
+}
+
+// SetCategoryHidden hides a category from public listings, or shows it again
+func (s *CategoryService) SetCategoryHidden(ctx context.Context, id int64, hidden bool) (*models.Category, error) {
+	const op = "CategoryService.SetCategoryHidden"
+
 	category, err := s.db.GetCategory(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get category: %w", err)
+		return nil, apperrors.E(op, err)
+	}
+
+	if !dryrun.FromContext(ctx) {
+		if err := s.db.SetCategoryHidden(ctx, id, hidden); err != nil {
+			return nil, apperrors.E(op, err)
+		}
 	}
+
+	category.Hidden = hidden
 	return category, nil
 }
 
+// ReorderCategories makes ids the display order of categories. Categories not
+// listed are placed after the listed ones.
+func (s *CategoryService) ReorderCategories(ctx context.Context, ids []int64) error {
+	const op = "CategoryService.ReorderCategories"
+
+	if len(ids) == 0 {
+		return ErrInvalidCategoryOrder
+	}
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return ErrInvalidCategoryOrder
+		}
+		seen[id] = true
+	}
+
+	count, err := s.db.CountCategories(ctx, ids)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if count != len(ids) {
+		return ErrInvalidCategoryOrder
+	}
+
+	if dryrun.FromContext(ctx) {
+		return nil
+	}
+
+	if err := s.db.ReorderCategories(ctx, ids); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
 func (s *CategoryService) CreateCategory(ctx context.Context, category *models.Category) error {
+	const op = "CategoryService.CreateCategory"
+
+	category.Slug = Slugify(category.Name)
+	if category.Slug == "" {
+		return ErrInvalidCategoryName
+	}
+
 	exists, err := s.db.CategoryExists(ctx, category.Name)
 	if err != nil {
-		return fmt.Errorf("failed to check category existence: %w", err)
+		return apperrors.E(op, err)
 	}
 	if exists {
-		return fmt.Errorf("category already exists")
+		return ErrCategoryExists
+	}
+	exists, err = s.db.SlugExists(ctx, category.Slug)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if exists {
+		return ErrCategorySlugTaken
+	}
+	if err := s.checkParent(ctx, 0, category.ParentID); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	if dryrun.FromContext(ctx) {
+		return nil
 	}
 
 	if err := s.db.CreateCategory(ctx, category); err != nil {
-		return fmt.Errorf("failed to create category: %w", err)
+		return apperrors.E(op, err)
 	}
 	return nil
 }
 
+// UpdateCategory renames a category, which changes its slug to that of the
+// new name, and nests it under parentID, or makes it top-level when nil.
+// Movies and editorial boosts of the category are moved to the new name, so
+// filtering movies by either the name or the slug keeps finding them.
+func (s *CategoryService) UpdateCategory(ctx context.Context, id int64, name string, parentID *int64) (*models.Category, error) {
+	const op = "CategoryService.UpdateCategory"
+
+	slug := Slugify(name)
+	if slug == "" {
+		return nil, ErrInvalidCategoryName
+	}
+
+	category, err := s.db.GetCategory(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if name != category.Name {
+		exists, err := s.db.CategoryExists(ctx, name)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if exists {
+			return nil, ErrCategoryExists
+		}
+	}
+	if slug != category.Slug {
+		exists, err := s.db.SlugExists(ctx, slug)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if exists {
+			return nil, ErrCategorySlugTaken
+		}
+	}
+	if err := s.checkParent(ctx, id, parentID); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	category.Name, category.Slug, category.ParentID, category.UpdatedAt = name, slug, parentID, s.now()
+	if dryrun.FromContext(ctx) {
+		return category, nil
+	}
+
+	err = s.db.UpdateCategory(ctx, category)
+	switch {
+	case errors.Is(err, database.ErrCategoryNameTaken):
+		return nil, ErrCategoryExists
+	case errors.Is(err, database.ErrCategorySlugTaken):
+		return nil, ErrCategorySlugTaken
+	case errors.Is(err, database.ErrCategoryCycle):
+		return nil, ErrCategoryCycle
+	case err != nil:
+		return nil, apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return category, nil
+}
+
+// checkParent checks that parentID, when set, is an existing category the
+// category id can be nested under. id is 0 for new categories.
+func (s *CategoryService) checkParent(ctx context.Context, id int64, parentID *int64) error {
+	if parentID == nil {
+		return nil
+	}
+	if _, err := s.db.GetCategory(ctx, *parentID); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			return ErrParentCategory
+		}
+		return err
+	}
+	if id == 0 {
+		return nil
+	}
+
+	cycle, err := s.db.CreatesCycle(ctx, id, *parentID)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return ErrCategoryCycle
+	}
+	return nil
+}
+
+// DeleteCategory soft-deletes a category no movie is in and with no
+// sub-categories. It can be restored until the trash is purged.
 func (s *CategoryService) DeleteCategory(ctx context.Context, id int64) error {
+	const op = "CategoryService.DeleteCategory"
+
 	// Check if category exists
 	_, err := s.db.GetCategory(ctx, id)
 	if err != nil {
-		return fmt.Errorf("category not found: %w", err)
+		return apperrors.E(op, err)
 	}
 
 	// Check if category is being used by movies
 	inUse, err := s.db.CategoryInUse(ctx, id)
 	if err != nil {
-		return fmt.Errorf("failed to check category usage: %w", err)
+		return apperrors.E(op, err)
 	}
 	if inUse {
-		return fmt.Errorf("category is being used by movies")
+		return ErrCategoryInUse
+	}
+
+	hasChildren, err := s.db.HasSubcategories(ctx, id)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if hasChildren {
+		return ErrCategoryHasChildren
+	}
+
+	if dryrun.FromContext(ctx) {
+		return nil
 	}
 
 	if err := s.db.DeleteCategory(ctx, id); err != nil {
-		return fmt.Errorf("failed to delete category: %w", err)
+		return apperrors.E(op, err)
 	}
 	return nil
 }
+
+// RestoreCategory undoes the soft delete of a category, unless another
+// category took its name or slug since or its parent is deleted too
+func (s *CategoryService) RestoreCategory(ctx context.Context, id int64) (*models.Category, error) {
+	const op = "CategoryService.RestoreCategory"
+
+	category, err := s.db.GetCategoryWithDeleted(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if category.DeletedAt == nil {
+		return nil, apperrors.E(op, ErrNotDeleted)
+	}
+
+	exists, err := s.db.CategoryExists(ctx, category.Name)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if exists {
+		return nil, ErrCategoryExists
+	}
+	exists, err = s.db.SlugExists(ctx, category.Slug)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if exists {
+		return nil, ErrCategorySlugTaken
+	}
+	if err := s.checkParent(ctx, 0, category.ParentID); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	category.DeletedAt, category.UpdatedAt = nil, s.now()
+	if dryrun.FromContext(ctx) {
+		return category, nil
+	}
+
+	if err := s.db.RestoreCategory(ctx, id); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return category, nil
+}
+
+// CategoryStats returns every category with its title count, average rating,
+// total watch time and growth over the last periods weeks or months, oldest
+// first. Titles removed from a category leave no trace, so the title counts
+// of past periods are worked back from the current count.
+func (s *CategoryService) CategoryStats(ctx context.Context, interval string, periods int) ([]CategoryStats, error) {
+	const op = "CategoryService.CategoryStats"
+
+	starts, err := statsPeriods(s.now(), interval, periods)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	totals, err := s.db.CategoryTotals(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	additions, err := s.db.CategoryAdditions(ctx, interval, starts[0])
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	added := make(map[int64]map[int64]int64) // category ID -> period start -> titles added
+	for _, a := range additions {
+		if added[a.CategoryID] == nil {
+			added[a.CategoryID] = make(map[int64]int64)
+		}
+		added[a.CategoryID][a.Period.Unix()] = a.Added
+	}
+
+	stats := make([]CategoryStats, len(totals))
+	for i, t := range totals {
+		growth := make([]CategoryGrowth, len(starts))
+		titles := t.Titles
+		for j := len(starts) - 1; j >= 0; j-- {
+			n := added[t.ID][starts[j].Unix()]
+			growth[j] = CategoryGrowth{Period: starts[j], Added: n, Titles: titles}
+			titles -= n
+		}
+
+		stats[i] = CategoryStats{
+			ID:            t.ID,
+			Name:          t.Name,
+			Hidden:        t.Hidden,
+			Titles:        t.Titles,
+			AverageRating: t.AverageRating,
+			WatchSeconds:  t.WatchSeconds,
+			Growth:        growth,
+		}
+	}
+	return stats, nil
+}
+
+// statsPeriods returns the UTC starts of the last n weeks (from Monday, like
+// date_trunc) or months up to now, oldest first
+func statsPeriods(now time.Time, interval string, n int) ([]time.Time, error) {
+	if n < 1 || n > MaxStatsPeriods {
+		return nil, fmt.Errorf("%w: periods must be between 1 and %d", ErrInvalidStatsInterval, MaxStatsPeriods)
+	}
+
+	day := startOfDay(now)
+	var step func(t time.Time, k int) time.Time
+	var current time.Time
+	switch interval {
+	case StatsIntervalWeek:
+		current = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		step = func(t time.Time, k int) time.Time { return t.AddDate(0, 0, 7*k) }
+	case StatsIntervalMonth:
+		current = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		step = func(t time.Time, k int) time.Time { return t.AddDate(0, k, 0) }
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidStatsInterval, interval)
+	}
+
+	starts := make([]time.Time, n)
+	for i := range starts {
+		starts[i] = step(current, i-(n-1))
+	}
+	return starts, nil
+}
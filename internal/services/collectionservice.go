@@ -0,0 +1,509 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	// DefaultCollectionMovies is how many movies of each collection are
+	// listed unless asked otherwise
+	DefaultCollectionMovies = 20
+	// MaxCollectionMovies is the most movies of each collection listed at once
+	MaxCollectionMovies = 50
+	// MaxCollectionItems is the most movies a collection holds
+	MaxCollectionItems = 200
+)
+
+// Audit actions and entity type of collections
+const (
+	AuditActionCreateCollection   = "create_collection"
+	AuditActionUpdateCollection   = "update_collection"
+	AuditActionDeleteCollection   = "delete_collection"
+	AuditActionReorderCollections = "reorder_collections"
+	AuditActionSetCollectionItems = "set_collection_movies"
+
+	auditEntityCollection = "collection"
+)
+
+var (
+	ErrCollectionSlugTaken     = errors.New("collection slug is already taken")
+	ErrInvalidCollectionSlug   = errors.New("invalid collection slug")
+	ErrInvalidCollectionOrder  = errors.New("invalid collection order")
+	ErrInvalidCollectionMovies = errors.New("invalid collection movies")
+)
+
+// CollectionRow is a collection with the movies it shows, in position
+type CollectionRow struct {
+	models.Collection
+	Movies []models.Movie
+}
+
+// CollectionService manages the curated collections of movies the home page
+// is built from. Admins order the collections and the movies in them; viewers
+// only see visible collections and, in them, the published movies their
+// profile may watch.
+type CollectionService struct {
+	db     *bun.DB
+	movies *MovieService
+	now    func() time.Time
+}
+
+func NewCollectionService(db *bun.DB, movies *MovieService) *CollectionService {
+	return &CollectionService{db: db, movies: movies, now: time.Now}
+}
+
+// ListCollections returns every collection, hidden or not, in display
+// order, with its items by position
+func (s *CollectionService) ListCollections(ctx context.Context) ([]models.Collection, error) {
+	var collections []models.Collection
+	err := s.db.NewSelect().
+		Model(&collections).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ci.position")
+		}).
+		Order("col.display_order", "col.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E("CollectionService.ListCollections", err)
+	}
+	return collections, nil
+}
+
+// GetCollection returns a collection, hidden or not, with its items by
+// position
+func (s *CollectionService) GetCollection(ctx context.Context, id int64) (*models.Collection, error) {
+	collection, err := getCollection(ctx, s.db, id)
+	if err != nil {
+		return nil, apperrors.E("CollectionService.GetCollection", err)
+	}
+	return collection, nil
+}
+
+// CreateCollection adds a collection after the others. Its slug is made
+// from its title unless given.
+func (s *CollectionService) CreateCollection(ctx context.Context, collection *models.Collection) error {
+	const op = "CollectionService.CreateCollection"
+
+	if err := prepareCollection(collection); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := collectionSlugFree(ctx, tx, collection.Slug, 0); err != nil {
+			return err
+		}
+
+		err := tx.NewSelect().
+			Model((*models.Collection)(nil)).
+			ColumnExpr("COALESCE(MAX(display_order) + 1, 0)").
+			Scan(ctx, &collection.DisplayOrder)
+		if err != nil {
+			return err
+		}
+
+		now := s.now()
+		collection.CreatedAt = now
+		collection.UpdatedAt = now
+		collection.Items = nil
+		if _, err := tx.NewInsert().Model(collection).Exec(ctx); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditActionCreateCollection, auditEntityCollection, collection.ID, nil, collection)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateCollection changes the slug, title, description and visibility of a
+// collection, keeping its place and movies
+func (s *CollectionService) UpdateCollection(ctx context.Context, collection *models.Collection) error {
+	const op = "CollectionService.UpdateCollection"
+
+	if err := prepareCollection(collection); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := collectionSlugFree(ctx, tx, collection.Slug, collection.ID); err != nil {
+			return err
+		}
+		before, err := getCollection(ctx, tx, collection.ID)
+		if err != nil {
+			return err
+		}
+
+		collection.UpdatedAt = s.now()
+		err = tx.NewUpdate().
+			Model(collection).
+			Column("slug", "title", "description", "hidden", "updated_at").
+			WherePK().
+			Returning("display_order, created_at").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("collection %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		updated, err := getCollection(ctx, tx, collection.ID)
+		if err != nil {
+			return err
+		}
+		*collection = *updated
+		return recordChange(ctx, tx, AuditActionUpdateCollection, auditEntityCollection, collection.ID, before, collection)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// DeleteCollection deletes a collection; the movies in it are kept
+func (s *CollectionService) DeleteCollection(ctx context.Context, id int64) error {
+	const op = "CollectionService.DeleteCollection"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*models.Collection)(nil)).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("collection %w", database.ErrNotFound)
+		}
+		return recordAudit(ctx, tx, AuditActionDeleteCollection, auditEntityCollection, id)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ReorderCollections puts the collections ids first, in that order; the
+// others follow in their current order
+func (s *CollectionService) ReorderCollections(ctx context.Context, ids []int64) error {
+	const op = "CollectionService.ReorderCollections"
+
+	if len(ids) == 0 || hasDuplicates(ids) {
+		return apperrors.E(op, ErrInvalidCollectionOrder)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		count, err := tx.NewSelect().
+			Model((*models.Collection)(nil)).
+			Where("id IN (?)", bun.In(ids)).
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		if count != len(ids) {
+			return ErrInvalidCollectionOrder
+		}
+
+		_, err = tx.NewUpdate().
+			Model((*models.Collection)(nil)).
+			Set("display_order = display_order + ?", len(ids)).
+			Where("id NOT IN (?)", bun.In(ids)).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		now := s.now()
+		for i, id := range ids {
+			_, err := tx.NewUpdate().
+				Model((*models.Collection)(nil)).
+				Set("display_order = ?", i).
+				Set("updated_at = ?", now).
+				Where("id = ?", id).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := recordAudit(ctx, tx, AuditActionReorderCollections, auditEntityCollection, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// SetCollectionMovies replaces the movies of a collection with movieIDs, in
+// that order. Each movie must exist and be listed once.
+func (s *CollectionService) SetCollectionMovies(ctx context.Context, id int64, movieIDs []int64) (*models.Collection, error) {
+	const op = "CollectionService.SetCollectionMovies"
+
+	if len(movieIDs) > MaxCollectionItems || hasDuplicates(movieIDs) {
+		return nil, apperrors.E(op, ErrInvalidCollectionMovies)
+	}
+
+	var collection *models.Collection
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		now := s.now()
+		result, err := tx.NewUpdate().
+			Model((*models.Collection)(nil)).
+			Set("updated_at = ?", now).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("collection %w", database.ErrNotFound)
+		}
+
+		if len(movieIDs) > 0 {
+			count, err := tx.NewSelect().
+				Model((*models.Movie)(nil)).
+				Where("id IN (?)", bun.In(movieIDs)).
+				Count(ctx)
+			if err != nil {
+				return err
+			}
+			if count != len(movieIDs) {
+				return ErrInvalidCollectionMovies
+			}
+		}
+
+		_, err = tx.NewDelete().
+			Model((*models.CollectionItem)(nil)).
+			Where("collection_id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if len(movieIDs) > 0 {
+			items := make([]models.CollectionItem, len(movieIDs))
+			for i, movieID := range movieIDs {
+				items[i] = models.CollectionItem{CollectionID: id, MovieID: movieID, Position: i + 1, CreatedAt: now}
+			}
+			if _, err := tx.NewInsert().Model(&items).Exec(ctx); err != nil {
+				return err
+			}
+		}
+		if err := recordAudit(ctx, tx, AuditActionSetCollectionItems, auditEntityCollection, id); err != nil {
+			return err
+		}
+
+		collection, err = getCollection(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return collection, nil
+}
+
+// PublishedCollections returns the visible collections in display order,
+// each with up to limit of its movies the viewer may watch. Collections left
+// without any are skipped.
+func (s *CollectionService) PublishedCollections(ctx context.Context, limit int) ([]CollectionRow, error) {
+	const op = "CollectionService.PublishedCollections"
+
+	var collections []models.Collection
+	err := s.db.NewSelect().
+		Model(&collections).
+		Where("col.hidden = false").
+		Order("col.display_order", "col.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	rows, err := s.rows(ctx, collections, limit)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	visible := rows[:0]
+	for _, row := range rows {
+		if len(row.Movies) > 0 {
+			visible = append(visible, row)
+		}
+	}
+	return visible, nil
+}
+
+// PublishedCollection returns a visible collection by slug, with the movies
+// in it the viewer may watch
+func (s *CollectionService) PublishedCollection(ctx context.Context, slug string) (*CollectionRow, error) {
+	const op = "CollectionService.PublishedCollection"
+
+	collection := new(models.Collection)
+	err := s.db.NewSelect().
+		Model(collection).
+		Where("col.slug = ? AND col.hidden = false", slug).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, fmt.Errorf("collection %w", database.ErrNotFound))
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	rows, err := s.rows(ctx, []models.Collection{*collection}, MaxCollectionItems)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return &rows[0], nil
+}
+
+// rows gathers up to limit of the published movies of each collection, by
+// position, leaving out those above the rating ceiling of the profile
+func (s *CollectionService) rows(ctx context.Context, collections []models.Collection, limit int) ([]CollectionRow, error) {
+	rows := make([]CollectionRow, len(collections))
+	if len(collections) == 0 {
+		return rows, nil
+	}
+
+	ids := make([]int64, len(collections))
+	for i, collection := range collections {
+		ids[i] = collection.ID
+		rows[i].Collection = collection
+	}
+
+	ceiling, err := profileRatingCeiling(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []models.CollectionItem
+	query := s.db.NewSelect().
+		Model(&items).
+		Column("ci.collection_id", "ci.movie_id", "ci.position").
+		Join("JOIN movies AS m ON m.id = ci.movie_id").
+		Where("ci.collection_id IN (?)", bun.In(ids)).
+		Where("m.deleted_at IS NULL").
+		Order("ci.collection_id", "ci.position")
+	database.Published(query)
+	if ceiling != "" {
+		query.Where("m.maturity_rating IN (?)", bun.In(ratingsUpTo(ceiling)))
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+
+	perCollection := make(map[int64][]int64, len(collections))
+	seen := make(map[int64]bool)
+	var movieIDs []int64
+	for _, item := range items {
+		if limit > 0 && len(perCollection[item.CollectionID]) >= limit {
+			continue
+		}
+		perCollection[item.CollectionID] = append(perCollection[item.CollectionID], item.MovieID)
+		if !seen[item.MovieID] {
+			seen[item.MovieID] = true
+			movieIDs = append(movieIDs, item.MovieID)
+		}
+	}
+	if len(movieIDs) == 0 {
+		return rows, nil
+	}
+
+	var movies []models.Movie
+	err = s.db.NewSelect().
+		Model(&movies).
+		Where("m.id IN (?)", bun.In(movieIDs)).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.movies.LocalizeMovies(ctx, movies); err != nil {
+		return nil, err
+	}
+	if err := s.movies.LoadCategories(ctx, movies); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]models.Movie, len(movies))
+	for _, movie := range movies {
+		byID[movie.ID] = movie
+	}
+	for i := range rows {
+		for _, movieID := range perCollection[rows[i].ID] {
+			if movie, ok := byID[movieID]; ok {
+				rows[i].Movies = append(rows[i].Movies, movie)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// getCollection returns a collection with its items by position
+func getCollection(ctx context.Context, db bun.IDB, id int64) (*models.Collection, error) {
+	collection := new(models.Collection)
+	err := db.NewSelect().
+		Model(collection).
+		Relation("Items", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ci.position")
+		}).
+		Where("col.id = ?", id).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("collection %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// prepareCollection trims a collection and makes its slug from its title
+// when missing, checking the slug is one Slugify would make
+func prepareCollection(collection *models.Collection) error {
+	collection.Title = strings.TrimSpace(collection.Title)
+	collection.Description = strings.TrimSpace(collection.Description)
+	collection.Slug = strings.TrimSpace(collection.Slug)
+	if collection.Slug == "" {
+		collection.Slug = Slugify(collection.Title)
+	}
+	if collection.Slug == "" || Slugify(collection.Slug) != collection.Slug {
+		return ErrInvalidCollectionSlug
+	}
+	return nil
+}
+
+// collectionSlugFree checks no other collection than id uses slug
+func collectionSlugFree(ctx context.Context, db bun.IDB, slug string, id int64) error {
+	exists, err := db.NewSelect().
+		Model((*models.Collection)(nil)).
+		Where("slug = ? AND id <> ?", slug, id).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrCollectionSlugTaken
+	}
+	return nil
+}
+
+// hasDuplicates reports whether ids lists an id more than once
+func hasDuplicates(ids []int64) bool {
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return true
+		}
+		seen[id] = true
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/moderation"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// Content filter verdicts
+const (
+	VerdictAllow  = "allow"
+	VerdictFlag   = "flag"
+	VerdictReject = "reject"
+)
+
+// Reasons text is flagged or rejected for. Word and category reasons are
+// followed by the word or category, e.g. "blocked_word:idiot".
+const (
+	FilterReasonBlockedWord           = "blocked_word"
+	FilterReasonFlaggedWord           = "flagged_word"
+	FilterReasonTooManyLinks          = "too_many_links"
+	FilterReasonModeration            = "moderation"
+	FilterReasonModerationUnavailable = "moderation_unavailable"
+)
+
+// Statuses of a content flag in the moderation queue
+const (
+	FlagStatusPending  = "pending"
+	FlagStatusApproved = "approved"
+	FlagStatusRemoved  = "removed"
+)
+
+// Audit action and entity type of moderation decisions
+const (
+	AuditActionResolveFlag = "resolve_content_flag"
+
+	auditEntityContentFlag = "content_flag"
+)
+
+var (
+	ErrContentRejected   = errors.New("content rejected by the content filter")
+	ErrInvalidFlagStatus = errors.New("invalid content flag status")
+)
+
+// Screening is the content filter's verdict on a text
+type Screening struct {
+	Verdict string   `json:"verdict" example:"flag"`
+	Reasons []string `json:"reasons,omitempty" example:"too_many_links"`
+}
+
+// ContentFilterService screens user-generated text against the configured
+// wordlists and moderation provider before it is stored. Services storing
+// user text call Screen before writing it and Flag, in the same transaction,
+// once it has an ID.
+type ContentFilterService struct {
+	db               *bun.DB
+	blocked          *moderation.Wordlist
+	flagged          *moderation.Wordlist
+	maxLinks         int
+	provider         moderation.Provider
+	rejectCategories map[string]bool
+	logger           *zap.Logger
+	now              func() time.Time
+}
+
+// NewContentFilterService returns a service using provider, which is nil
+// when text is screened with the wordlists alone
+func NewContentFilterService(db *bun.DB, provider moderation.Provider, cfg config.ModerationConfig, logger *zap.Logger) *ContentFilterService {
+	rejectCategories := make(map[string]bool, len(cfg.RejectCategories))
+	for _, category := range cfg.RejectCategories {
+		rejectCategories[category] = true
+	}
+
+	return &ContentFilterService{
+		db:               db,
+		blocked:          moderation.NewWordlist(cfg.BlockedWords),
+		flagged:          moderation.NewWordlist(cfg.FlaggedWords),
+		maxLinks:         cfg.MaxLinks,
+		provider:         provider,
+		rejectCategories: rejectCategories,
+		logger:           logger,
+		now:              time.Now,
+	}
+}
+
+// Check returns the verdict on text. Blocked words reject it without asking
+// the provider. When the provider cannot be reached the text is flagged, so
+// a moderator sees it rather than it going unchecked.
+func (s *ContentFilterService) Check(ctx context.Context, text string) Screening {
+	if strings.TrimSpace(text) == "" {
+		return Screening{Verdict: VerdictAllow}
+	}
+
+	if words := s.blocked.Match(text); len(words) > 0 {
+		return Screening{Verdict: VerdictReject, Reasons: prefixReasons(FilterReasonBlockedWord, words)}
+	}
+
+	screening := Screening{Verdict: VerdictAllow}
+	flag := func(reasons ...string) {
+		screening.Verdict = VerdictFlag
+		screening.Reasons = append(screening.Reasons, reasons...)
+	}
+	if words := s.flagged.Match(text); len(words) > 0 {
+		flag(prefixReasons(FilterReasonFlaggedWord, words)...)
+	}
+	if s.maxLinks > 0 && moderation.CountLinks(text) > s.maxLinks {
+		flag(FilterReasonTooManyLinks)
+	}
+
+	if s.provider == nil {
+		return screening
+	}
+	result, err := s.provider.Moderate(ctx, text)
+	if err != nil {
+		s.logger.Warn("moderation provider failed, flagging text for review", zap.Error(err))
+		flag(FilterReasonModerationUnavailable)
+		return screening
+	}
+	if !result.Flagged {
+		return screening
+	}
+
+	reasons := prefixReasons(FilterReasonModeration, result.Categories)
+	if len(reasons) == 0 {
+		reasons = []string{FilterReasonModeration}
+	}
+	for _, category := range result.Categories {
+		if s.rejectCategories[category] {
+			return Screening{Verdict: VerdictReject, Reasons: reasons}
+		}
+	}
+	flag(reasons...)
+	return screening
+}
+
+// Screen checks text before it is stored and returns ErrContentRejected when
+// it must not be. Flagged text is allowed; pass the screening to Flag once it
+// is stored.
+func (s *ContentFilterService) Screen(ctx context.Context, text string) (Screening, error) {
+	screening := s.Check(ctx, text)
+	if screening.Verdict == VerdictReject {
+		return screening, apperrors.E("ContentFilterService.Screen",
+			fmt.Errorf("%w: %s", ErrContentRejected, strings.Join(screening.Reasons, ", ")))
+	}
+	return screening, nil
+}
+
+// Flag queues text stored as field of an entity for moderator review when its
+// screening flagged it, and does nothing otherwise. Pass the transaction the
+// text is stored in so both commit together.
+func (s *ContentFilterService) Flag(ctx context.Context, db bun.IDB, entityType string, entityID int64, field, text string, screening Screening) error {
+	if screening.Verdict != VerdictFlag {
+		return nil
+	}
+
+	flag := &models.ContentFlag{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Field:      field,
+		Content:    text,
+		Reasons:    screening.Reasons,
+		Status:     FlagStatusPending,
+		CreatedAt:  s.now(),
+	}
+	if _, err := db.NewInsert().Model(flag).Exec(ctx); err != nil {
+		return apperrors.E("ContentFilterService.Flag", err)
+	}
+	return nil
+}
+
+// ListFlags returns the flags with status, or every flag when status is
+// empty, oldest first so the queue is worked through in order
+func (s *ContentFilterService) ListFlags(ctx context.Context, status string) ([]models.ContentFlag, error) {
+	const op = "ContentFilterService.ListFlags"
+
+	var flags []models.ContentFlag
+	query := s.db.NewSelect().Model(&flags).OrderExpr("created_at ASC, id ASC")
+	if status != "" {
+		if !validFlagStatus(status) {
+			return nil, apperrors.E(op, ErrInvalidFlagStatus)
+		}
+		query.Where("status = ?", status)
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return flags, nil
+}
+
+// ResolveFlag records a moderator's decision on a flag: approved keeps the
+// text, removed means it was taken down. Setting pending reopens the flag.
+func (s *ContentFilterService) ResolveFlag(ctx context.Context, id int64, status string) (*models.ContentFlag, error) {
+	const op = "ContentFilterService.ResolveFlag"
+
+	if !validFlagStatus(status) {
+		return nil, apperrors.E(op, ErrInvalidFlagStatus)
+	}
+
+	flag := &models.ContentFlag{ID: id, Status: status}
+	if status != FlagStatusPending {
+		now := s.now()
+		flag.ResolvedAt = &now
+		if userID := UserIDFromContext(ctx); userID != 0 {
+			flag.ResolvedBy = &userID
+		}
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewUpdate().
+			Model(flag).
+			Column("status", "resolved_by", "resolved_at").
+			WherePK().
+			Returning("*").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("content flag %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return recordAudit(ctx, tx, AuditActionResolveFlag, auditEntityContentFlag, id)
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return flag, nil
+}
+
+func validFlagStatus(status string) bool {
+	switch status {
+	case FlagStatusPending, FlagStatusApproved, FlagStatusRemoved:
+		return true
+	}
+	return false
+}
+
+func prefixReasons(prefix string, values []string) []string {
+	reasons := make([]string, len(values))
+	for i, v := range values {
+		reasons[i] = prefix + ":" + v
+	}
+	return reasons
+}
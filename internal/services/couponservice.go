@@ -0,0 +1,337 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/models"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+const maxCouponDescriptionLength = 200
+
+var (
+	ErrInvalidCoupon         = errors.New("invalid coupon")
+	ErrCouponCodeTaken       = errors.New("coupon code already taken")
+	ErrCouponExpired         = errors.New("coupon has expired")
+	ErrCouponExhausted       = errors.New("coupon has no redemptions left")
+	ErrCouponAlreadyRedeemed = errors.New("coupon already redeemed")
+	// ErrCouponNotApplicable is returned by Checkout when the coupon the user
+	// redeemed takes an amount off in another currency than the plan's
+	ErrCouponNotApplicable = errors.New("coupon does not apply to the plan")
+	// ErrCouponNotFound is a database.ErrNotFound for coupons that do not
+	// exist or, when redeemed, are not active
+	ErrCouponNotFound = fmt.Errorf("coupon %w", database.ErrNotFound)
+)
+
+// couponCodePattern is what coupon codes look like once upper-cased, such
+// as "WELCOME-50"
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,49}$`)
+
+// CouponUpdate replaces the terms of a coupon that can change after it is
+// created. Its discount cannot, as Stripe coupons are immutable.
+type CouponUpdate struct {
+	Description    string
+	MaxRedemptions int
+	ExpiresAt      time.Time
+	Active         bool
+}
+
+// ListCoupons returns every coupon, newest first
+func (s *BillingService) ListCoupons(ctx context.Context) ([]models.Coupon, error) {
+	const op = "BillingService.ListCoupons"
+
+	coupons := make([]models.Coupon, 0)
+	if err := s.db.NewSelect().Model(&coupons).Order("id DESC").Scan(ctx); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return coupons, nil
+}
+
+// GetCoupon returns the coupon with code, whatever its case
+func (s *BillingService) GetCoupon(ctx context.Context, code string) (*models.Coupon, error) {
+	const op = "BillingService.GetCoupon"
+
+	coupon, err := couponByCode(ctx, s.db, code)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return coupon, nil
+}
+
+// CreateCoupon validates coupon, creates the Stripe coupon behind it and
+// stores it. Codes are upper-cased and unique.
+func (s *BillingService) CreateCoupon(ctx context.Context, coupon *models.Coupon) error {
+	const op = "BillingService.CreateCoupon"
+
+	if !s.Enabled() {
+		return apperrors.E(op, ErrBillingDisabled)
+	}
+	if err := normalizeCoupon(coupon); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	taken, err := s.db.NewSelect().
+		Model((*models.Coupon)(nil)).
+		Where("code = ?", coupon.Code).
+		Exists(ctx)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if taken {
+		return apperrors.E(op, ErrCouponCodeTaken)
+	}
+
+	coupon.StripeCouponID, err = s.stripe.CreateCoupon(ctx, integrations.CouponParams{
+		Name:             coupon.Code,
+		PercentOff:       coupon.PercentOff,
+		AmountOff:        coupon.AmountOffCents,
+		Currency:         coupon.Currency,
+		Duration:         coupon.Duration,
+		DurationInMonths: coupon.DurationMonths,
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	now := s.now()
+	coupon.TimesRedeemed = 0
+	coupon.CreatedAt = now
+	coupon.UpdatedAt = now
+	if _, err := s.db.NewInsert().Model(coupon).Exec(ctx); err != nil {
+		// Do not leave a Stripe coupon nothing refers to
+		if err := s.stripe.DeleteCoupon(context.WithoutCancel(ctx), coupon.StripeCouponID); err != nil {
+			s.logger.Warn("failed to delete orphaned stripe coupon", zap.String("coupon", coupon.StripeCouponID), zap.Error(err))
+		}
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateCoupon replaces the description, redemption limit, expiry and
+// active flag of the coupon with code. Redemptions already made are kept.
+func (s *BillingService) UpdateCoupon(ctx context.Context, code string, update CouponUpdate) (*models.Coupon, error) {
+	const op = "BillingService.UpdateCoupon"
+
+	update.Description = strings.TrimSpace(update.Description)
+	if len(update.Description) > maxCouponDescriptionLength || update.MaxRedemptions < 0 {
+		return nil, apperrors.E(op, ErrInvalidCoupon)
+	}
+
+	coupon, err := couponByCode(ctx, s.db, code)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	coupon.Description = update.Description
+	coupon.MaxRedemptions = update.MaxRedemptions
+	coupon.ExpiresAt = update.ExpiresAt
+	coupon.Active = update.Active
+	coupon.UpdatedAt = s.now()
+
+	_, err = s.db.NewUpdate().
+		Model(coupon).
+		Column("description", "max_redemptions", "expires_at", "active", "updated_at").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return coupon, nil
+}
+
+// DeleteCoupon deletes the coupon with code and its Stripe coupon, with the
+// redemptions not used yet. Subscriptions it already discounts keep their
+// discount.
+func (s *BillingService) DeleteCoupon(ctx context.Context, code string) error {
+	const op = "BillingService.DeleteCoupon"
+
+	if !s.Enabled() {
+		return apperrors.E(op, ErrBillingDisabled)
+	}
+	coupon, err := couponByCode(ctx, s.db, code)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err = s.stripe.DeleteCoupon(ctx, coupon.StripeCouponID)
+	if err != nil && !errors.Is(err, integrations.ErrStripeNotFound) {
+		return apperrors.E(op, err)
+	}
+	if _, err := s.db.NewDelete().Model(coupon).WherePK().Exec(ctx); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// RedeemCoupon redeems the active coupon with code for userID, discounting
+// the subscriptions they start with Checkout until one does. Each user
+// redeems a coupon once, and holds one coupon at a time: redeeming another
+// gives back the redemption of the one they have not used yet.
+func (s *BillingService) RedeemCoupon(ctx context.Context, userID int64, code string) (*models.CouponRedemption, error) {
+	const op = "BillingService.RedeemCoupon"
+
+	if !s.Enabled() {
+		return nil, apperrors.E(op, ErrBillingDisabled)
+	}
+	subscribed, err := s.subscribed(ctx, userID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if subscribed {
+		return nil, apperrors.E(op, ErrAlreadySubscribed)
+	}
+
+	redemption := &models.CouponRedemption{UserID: userID}
+	err = runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the coupon, so concurrent redemptions cannot exceed its limit
+		coupon := new(models.Coupon)
+		err := tx.NewSelect().
+			Model(coupon).
+			Where("code = ? AND active", strings.ToUpper(strings.TrimSpace(code))).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCouponNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		now := s.now()
+		if !coupon.ExpiresAt.IsZero() && !now.Before(coupon.ExpiresAt) {
+			return ErrCouponExpired
+		}
+		redeemed, err := tx.NewSelect().
+			Model((*models.CouponRedemption)(nil)).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if redeemed {
+			return ErrCouponAlreadyRedeemed
+		}
+		if coupon.MaxRedemptions > 0 && coupon.TimesRedeemed >= coupon.MaxRedemptions {
+			return ErrCouponExhausted
+		}
+
+		// Give back the coupon the user holds
+		var released []int64
+		err = tx.NewDelete().
+			Model((*models.CouponRedemption)(nil)).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Returning("coupon_id").
+			Scan(ctx, &released)
+		if err != nil {
+			return err
+		}
+		if len(released) > 0 {
+			_, err = tx.NewUpdate().
+				Model((*models.Coupon)(nil)).
+				Set("times_redeemed = times_redeemed - 1").
+				Where("id IN (?)", bun.In(released)).
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		redemption.CouponID = coupon.ID
+		redemption.RedeemedAt = now
+		if _, err := tx.NewInsert().Model(redemption).Exec(ctx); err != nil {
+			return err
+		}
+		coupon.TimesRedeemed++
+		_, err = tx.NewUpdate().
+			Model(coupon).
+			Column("times_redeemed").
+			WherePK().
+			Exec(ctx)
+		redemption.Coupon = coupon
+		return err
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return redemption, nil
+}
+
+// pendingRedemption returns the redemption userID has not used yet with its
+// coupon, or nil when they hold none
+func (s *BillingService) pendingRedemption(ctx context.Context, userID int64) (*models.CouponRedemption, error) {
+	redemption := new(models.CouponRedemption)
+	err := s.db.NewSelect().
+		Model(redemption).
+		Relation("Coupon").
+		Where("cr.user_id = ? AND cr.used_at IS NULL", userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return redemption, nil
+}
+
+func couponByCode(ctx context.Context, db bun.IDB, code string) (*models.Coupon, error) {
+	coupon := new(models.Coupon)
+	err := db.NewSelect().
+		Model(coupon).
+		Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// normalizeCoupon upper-cases the code and lower-cases the currency of
+// coupon and validates it. A coupon takes either a percentage or an amount
+// in a currency off, and only repeating coupons last a number of months.
+func normalizeCoupon(coupon *models.Coupon) error {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	coupon.Description = strings.TrimSpace(coupon.Description)
+	coupon.Currency = strings.ToLower(coupon.Currency)
+	if !couponCodePattern.MatchString(coupon.Code) || len(coupon.Description) > maxCouponDescriptionLength ||
+		coupon.MaxRedemptions < 0 {
+		return ErrInvalidCoupon
+	}
+
+	switch {
+	case coupon.PercentOff != 0 && coupon.AmountOffCents != 0:
+		return ErrInvalidCoupon
+	case coupon.PercentOff != 0:
+		if coupon.PercentOff < 1 || coupon.PercentOff > 100 || coupon.Currency != "" {
+			return ErrInvalidCoupon
+		}
+	case coupon.AmountOffCents <= 0 || len(coupon.Currency) != 3:
+		return ErrInvalidCoupon
+	}
+
+	switch coupon.Duration {
+	case models.CouponRepeating:
+		if coupon.DurationMonths <= 0 {
+			return ErrInvalidCoupon
+		}
+	case models.CouponOnce, models.CouponForever:
+		if coupon.DurationMonths != 0 {
+			return ErrInvalidCoupon
+		}
+	default:
+		return ErrInvalidCoupon
+	}
+	return nil
+}
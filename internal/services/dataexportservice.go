@@ -0,0 +1,363 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/notifications"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Data export settings when not configured
+const (
+	defaultExportPoll       = 10 * time.Second
+	defaultExportTimeout    = 10 * time.Minute
+	defaultExportRetention  = 7 * 24 * time.Hour
+	defaultExportLinkExpiry = 15 * time.Minute
+)
+
+var ErrDataExportNotFound = errors.New("data export not found")
+
+// DataExportStatus is a data export and, once it is ready, the link its
+// archive is downloaded from until DownloadExpiresAt
+type DataExportStatus struct {
+	*models.DataExport
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+}
+
+// exportedAccount is profile.json in data export archives
+type exportedAccount struct {
+	User     *models.User     `json:"user"`
+	Profiles []models.Profile `json:"profiles"`
+}
+
+// exportedFavorite is an entry of favorites.json in data export archives
+type exportedFavorite struct {
+	models.UserFavorite
+	MovieTitle string `json:"movie_title,omitempty"`
+}
+
+// exportedWatch is an entry of watch_history.json in data export archives
+type exportedWatch struct {
+	models.WatchHistory
+	MovieTitle string `json:"movie_title,omitempty"`
+}
+
+// exportedReview is an entry of reviews.json in data export archives
+type exportedReview struct {
+	models.Review
+	MovieTitle string `json:"movie_title,omitempty"`
+}
+
+// DataExportService builds archives of the data users keep with us: their
+// account and profiles, favorites, watch history and reviews. Exports are
+// queued in the database and built by Run, which stores the archives in the
+// storage bucket until they expire.
+type DataExportService struct {
+	db            *database.DataExportDB
+	storage       *StorageService
+	notifications *notifications.Hub
+	cfg           config.DataExportConfig
+	logger        *zap.Logger
+	wake          chan struct{}
+	now           func() time.Time
+}
+
+func NewDataExportService(db *database.DataExportDB, storage *StorageService, hub *notifications.Hub, cfg config.DataExportConfig, logger *zap.Logger) *DataExportService {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultExportPoll
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = defaultExportTimeout
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = defaultExportRetention
+	}
+	if cfg.LinkExpiry <= 0 {
+		cfg.LinkExpiry = defaultExportLinkExpiry
+	}
+
+	return &DataExportService{
+		db:            db,
+		storage:       storage,
+		notifications: hub,
+		cfg:           cfg,
+		logger:        logger,
+		wake:          make(chan struct{}, 1),
+		now:           time.Now,
+	}
+}
+
+// RequestExport queues an export of the data of userID. While one is
+// queued or running, it is returned instead of queueing another.
+func (s *DataExportService) RequestExport(ctx context.Context, userID int64) (*DataExportStatus, error) {
+	const op = "DataExportService.RequestExport"
+
+	if !s.storage.Enabled() {
+		return nil, apperrors.E(op, ErrStorageDisabled)
+	}
+	export, err := s.db.CreateExport(ctx, &models.DataExport{
+		UserID:    userID,
+		Status:    models.DataExportQueued,
+		CreatedAt: s.now(),
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return &DataExportStatus{DataExport: export}, nil
+}
+
+// GetExport returns an export of userID, with a fresh download link once
+// its archive is ready
+func (s *DataExportService) GetExport(ctx context.Context, userID, id int64) (*DataExportStatus, error) {
+	const op = "DataExportService.GetExport"
+
+	export, err := s.db.GetExport(ctx, userID, id)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, apperrors.E(op, ErrDataExportNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	status := &DataExportStatus{DataExport: export}
+	now := s.now()
+	if export.Status != models.DataExportReady || export.ExpiresAt == nil || !export.ExpiresAt.After(now) {
+		if export.Status == models.DataExportReady {
+			// Not deleted yet, but no longer downloadable
+			export.Status = models.DataExportExpired
+		}
+		return status, nil
+	}
+	if !s.storage.Enabled() {
+		return nil, apperrors.E(op, ErrStorageDisabled)
+	}
+
+	// Links never outlive the archive
+	expiry := s.cfg.LinkExpiry
+	if left := export.ExpiresAt.Sub(now); left < expiry {
+		expiry = left
+	}
+	url, err := s.storage.presignDownload(ctx, export.ObjectKey, expiry, fmt.Sprintf("ndn-export-%d.zip", export.ID))
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	expiresAt := now.Add(expiry)
+	status.DownloadURL, status.DownloadExpiresAt = url, &expiresAt
+	return status, nil
+}
+
+// Run builds queued exports, one at a time, and deletes expired archives
+// until ctx is cancelled. It does nothing without storage.
+func (s *DataExportService) Run(ctx context.Context) {
+	if !s.storage.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.db.RequeueStale(ctx, s.now().Add(-s.cfg.JobTimeout)); err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to requeue stale data exports", zap.Error(err))
+		}
+		for ctx.Err() == nil {
+			export, err := s.db.ClaimExport(ctx, s.now())
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("failed to claim data export", zap.Error(err))
+				}
+				break
+			}
+			if export == nil {
+				break
+			}
+			s.process(ctx, export)
+		}
+		if err := s.expire(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to delete expired data exports", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// process builds the archive of a claimed export and records the outcome.
+// An export interrupted by shutdown is released for another worker instead.
+func (s *DataExportService) process(ctx context.Context, export *models.DataExport) {
+	logger := s.logger.With(zap.Int64("export_id", export.ID), zap.Int64("user_id", export.UserID))
+
+	jobCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+	key, size, err := s.build(jobCtx, export)
+	cancel()
+
+	// Record the outcome even when shutting down
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		if err := s.db.ReleaseExport(finishCtx, export.ID); err != nil {
+			logger.Error("failed to release data export", zap.Error(err))
+		}
+		return
+	}
+
+	now := s.now()
+	export.FinishedAt = &now
+	event := notifications.EventExportReady
+	if err != nil {
+		logger.Error("data export failed", zap.Error(err))
+		export.Status, export.Error = models.DataExportFailed, err.Error()
+		event = notifications.EventExportFailed
+	} else {
+		expiresAt := now.Add(s.cfg.Retention)
+		export.Status, export.ObjectKey, export.Size, export.ExpiresAt = models.DataExportReady, key, size, &expiresAt
+	}
+	if err := s.db.FinishExport(finishCtx, export); err != nil {
+		logger.Error("failed to record data export", zap.Error(err))
+		return
+	}
+
+	if err := s.notifications.Publish(finishCtx, notifications.User(export.UserID), event, exportNotification{ExportID: export.ID}); err != nil {
+		logger.Warn("failed to publish data export notification", zap.Error(err))
+	}
+}
+
+// build gathers the data of the user of export into a ZIP archive of JSON
+// files and stores it, returning its key and size
+func (s *DataExportService) build(ctx context.Context, export *models.DataExport) (string, int64, error) {
+	const op = "DataExportService.build"
+
+	user, err := s.db.GetUser(ctx, export.UserID)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	profiles, err := s.db.Profiles(ctx, export.UserID)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	favorites, err := s.db.Favorites(ctx, export.UserID)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	history, err := s.db.WatchHistory(ctx, export.UserID)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	reviews, err := s.db.Reviews(ctx, export.UserID)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+
+	seen := make(map[int64]bool)
+	var movieIDs []int64
+	addMovie := func(id int64) {
+		if !seen[id] {
+			seen[id] = true
+			movieIDs = append(movieIDs, id)
+		}
+	}
+	for _, f := range favorites {
+		addMovie(f.MovieID)
+	}
+	for _, h := range history {
+		addMovie(h.MovieID)
+	}
+	for _, r := range reviews {
+		addMovie(r.MovieID)
+	}
+	titles, err := s.db.MovieTitles(ctx, movieIDs)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+
+	exportedFavorites := make([]exportedFavorite, len(favorites))
+	for i, f := range favorites {
+		exportedFavorites[i] = exportedFavorite{UserFavorite: f, MovieTitle: titles[f.MovieID]}
+	}
+	exportedHistory := make([]exportedWatch, len(history))
+	for i, h := range history {
+		exportedHistory[i] = exportedWatch{WatchHistory: h, MovieTitle: titles[h.MovieID]}
+	}
+	exportedReviews := make([]exportedReview, len(reviews))
+	for i, r := range reviews {
+		exportedReviews[i] = exportedReview{Review: r, MovieTitle: titles[r.MovieID]}
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", exportedAccount{User: user, Profiles: profiles}},
+		{"favorites.json", exportedFavorites},
+		{"watch_history.json", exportedHistory},
+		{"reviews.json", exportedReviews},
+	}
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: s.now()})
+		if err != nil {
+			return "", 0, apperrors.E(op, err)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return "", 0, apperrors.E(op, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+
+	name, err := randomHex(16)
+	if err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	key := fmt.Sprintf("exports/users/%d/%s.zip", export.UserID, name)
+	size := int64(buf.Len())
+	if err := s.storage.upload(ctx, key, "application/zip", &buf, size); err != nil {
+		return "", 0, apperrors.E(op, err)
+	}
+	return key, size, nil
+}
+
+// expire deletes the archives of the exports past their retention
+func (s *DataExportService) expire(ctx context.Context) error {
+	exports, err := s.db.ExpiredExports(ctx, s.now())
+	if err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		if export.ObjectKey != "" {
+			if err := s.storage.remove(ctx, export.ObjectKey); err != nil {
+				return err
+			}
+		}
+		if err := s.db.ExpireExport(ctx, export.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
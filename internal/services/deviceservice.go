@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+)
+
+// maxUserAgentLength caps the user agents recorded for devices
+const maxUserAgentLength = 512
+
+// ErrDeviceNotFound is a database.ErrNotFound for devices that do not exist,
+// belong to another user or were signed out
+var ErrDeviceNotFound = fmt.Errorf("device %w", database.ErrNotFound)
+
+// platforms maps markers found in user agents to the platform they tell,
+// checked in order: TVs and phones mention the desktop systems they run on
+var platforms = []struct {
+	marker   string
+	platform string
+}{
+	{"SmartTV", "TV"},
+	{"Tizen", "TV"},
+	{"Web0S", "TV"},
+	{"AppleTV", "TV"},
+	{"Roku", "TV"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Android", "Android"},
+	{"CrOS", "ChromeOS"},
+	{"Windows", "Windows"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+// ListDevices returns the devices userID is signed in on, most recently
+// seen first, marking the one of the current session
+func (s *AuthService) ListDevices(ctx context.Context, userID int64, currentSessionID string) ([]models.Device, error) {
+	const op = "AuthService.ListDevices"
+
+	devices, err := s.db.ListDevices(ctx, userID, s.now())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	for i := range devices {
+		devices[i].Current = currentSessionID != "" && devices[i].SessionID == currentSessionID
+	}
+	return devices, nil
+}
+
+// RevokeDevice signs userID out of the device with id by revoking the
+// refresh tokens of its session. Access tokens already issued to it remain
+// valid until they expire.
+func (s *AuthService) RevokeDevice(ctx context.Context, userID, id int64) error {
+	const op = "AuthService.RevokeDevice"
+
+	now := s.now()
+	device, err := s.db.GetDevice(ctx, userID, id, now)
+	if errors.Is(err, database.ErrNotFound) {
+		return apperrors.E(op, ErrDeviceNotFound)
+	}
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	if err := s.db.RevokeDevice(ctx, device, now); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// saveDevice records the device of sessionID as seen at now. A session
+// keeps the user agent it started with; sessions started before devices
+// were recorded get one without.
+func (s *AuthService) saveDevice(ctx context.Context, userID int64, sessionID, userAgent string, now time.Time) error {
+	userAgent = strings.TrimSpace(userAgent)
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return s.db.SaveDevice(ctx, &models.Device{
+		UserID:     userID,
+		SessionID:  sessionID,
+		UserAgent:  userAgent,
+		Platform:   platformOf(userAgent),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	})
+}
+
+// platformOf returns the operating system userAgent runs on, or "Other"
+func platformOf(userAgent string) string {
+	for _, p := range platforms {
+		if strings.Contains(userAgent, p.marker) {
+			return p.platform
+		}
+	}
+	return "Other"
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/dryrun"
+
+	"github.com/uptrace/bun"
+)
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+// runInTx runs fn in a transaction that is committed, unless ctx belongs to
+// a dry run, in which case it is rolled back once fn has succeeded. Either
+// way fn's results are returned, so a dry run shows what would change.
+func runInTx(ctx context.Context, db *bun.DB, fn func(ctx context.Context, tx bun.Tx) error) error {
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := fn(ctx, tx); err != nil {
+			return err
+		}
+		if dryrun.FromContext(ctx) {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
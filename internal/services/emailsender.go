@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/config"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Email is a plain text message to one recipient
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// EmailSender delivers transactional email
+type EmailSender interface {
+	Send(ctx context.Context, email Email) error
+	// Ping checks that email can be handed over for delivery, for health
+	// checks
+	Ping(ctx context.Context) error
+}
+
+// NewEmailSender returns a sender using the configured SMTP server, or one
+// that logs messages instead when no server is configured
+func NewEmailSender(cfg config.EmailConfig, logger *zap.Logger) (EmailSender, error) {
+	if cfg.SMTPHost == "" {
+		return &logEmailSender{logger: logger}, nil
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email sender address %q: %w", cfg.From, err)
+	}
+	sender := &smtpEmailSender{
+		addr: net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		from: from,
+	}
+	if cfg.Username != "" {
+		sender.auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.SMTPHost)
+	}
+	return sender, nil
+}
+
+// smtpEmailSender sends email through an SMTP server, using STARTTLS when
+// the server offers it
+type smtpEmailSender struct {
+	addr string
+	auth smtp.Auth
+	from *mail.Address
+}
+
+func (s *smtpEmailSender) Send(ctx context.Context, email Email) error {
+	// Refuse header injection through the recipient or subject
+	if strings.ContainsAny(email.To+email.Subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", email.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{email.To}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// Ping connects to the SMTP server and greets it
+func (s *smtpEmailSender) Ping(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, _ := net.SplitHostPort(s.addr)
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	return client.Quit()
+}
+
+// logEmailSender logs email instead of sending it, for development. Bodies
+// are not logged, as they carry reset and verification tokens.
+type logEmailSender struct {
+	logger *zap.Logger
+}
+
+func (s *logEmailSender) Send(ctx context.Context, email Email) error {
+	s.logger.Info("email not sent, no SMTP server configured",
+		zap.String("to", email.To),
+		zap.String("subject", email.Subject),
+	)
+	return nil
+}
+
+func (s *logEmailSender) Ping(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/embedding"
+	"github.com/ndn/internal/models"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmbeddingsDisabled  = errors.New("embeddings are not configured")
+	ErrEmbeddingJobRunning = errors.New("an embedding job is already running")
+)
+
+// EmbeddingJob reports the progress of the current or last embedding run
+type EmbeddingJob struct {
+	Running    bool       `json:"running"`
+	Force      bool       `json:"force"`
+	Model      string     `json:"model" example:"text-embedding-3-small"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Scanned counts movies looked at and Embedded those whose embedding was
+	// (re)computed; the others were unchanged since their last embedding
+	Scanned  int    `json:"scanned" example:"1200"`
+	Embedded int    `json:"embedded" example:"35"`
+	Error    string `json:"error,omitempty"`
+}
+
+// EmbeddingService computes movie embeddings with the configured provider
+// and finds similar titles by nearest neighbour. Embeddings are computed by
+// a job started by an admin and run by Run, one at a time.
+type EmbeddingService struct {
+	db        *database.EmbeddingDB
+	provider  embedding.Provider
+	logger    *zap.Logger
+	batchSize int
+	requests  chan bool
+	now       func() time.Time
+
+	mu  sync.Mutex
+	job EmbeddingJob
+}
+
+// NewEmbeddingService returns a service using provider, which is nil when
+// embeddings are disabled
+func NewEmbeddingService(db *database.EmbeddingDB, provider embedding.Provider, cfg config.EmbeddingConfig, logger *zap.Logger) *EmbeddingService {
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 64
+	}
+
+	return &EmbeddingService{
+		db:        db,
+		provider:  provider,
+		logger:    logger,
+		batchSize: batchSize,
+		requests:  make(chan bool, 1),
+		now:       time.Now,
+	}
+}
+
+// Start queues an embedding job. Unless force is set, movies whose metadata
+// has not changed since they were embedded with the current model are
+// skipped.
+func (s *EmbeddingService) Start(force bool) (EmbeddingJob, error) {
+	if s.provider == nil {
+		return EmbeddingJob{}, ErrEmbeddingsDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.job.Running {
+		return s.job, ErrEmbeddingJobRunning
+	}
+	now := s.now()
+	s.job = EmbeddingJob{Running: true, Force: force, Model: s.provider.Model(), StartedAt: &now}
+	s.requests <- force
+	return s.job, nil
+}
+
+// Job returns the state of the current or last embedding job
+func (s *EmbeddingService) Job() EmbeddingJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.job
+}
+
+// Run executes queued embedding jobs until ctx is cancelled
+func (s *EmbeddingService) Run(ctx context.Context) {
+	if s.provider == nil {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case force := <-s.requests:
+			err := s.embedAll(ctx, force)
+			if err != nil && ctx.Err() == nil {
+				s.logger.Error("movie embedding job failed", zap.Error(err))
+			}
+
+			s.mu.Lock()
+			now := s.now()
+			s.job.Running = false
+			s.job.FinishedAt = &now
+			if err != nil {
+				s.job.Error = err.Error()
+			}
+			job := s.job
+			s.mu.Unlock()
+
+			s.logger.Info("movie embedding job finished",
+				zap.Int("scanned", job.Scanned),
+				zap.Int("embedded", job.Embedded),
+			)
+		}
+	}
+}
+
+// embedAll walks every movie in batches and embeds those that need it
+func (s *EmbeddingService) embedAll(ctx context.Context, force bool) error {
+	const op = "EmbeddingService.embedAll"
+
+	model := s.provider.Model()
+	var afterID int64
+	for {
+		movies, err := s.db.MoviesAfter(ctx, afterID, s.batchSize)
+		if err != nil {
+			return apperrors.E(op, err)
+		}
+		if len(movies) == 0 {
+			return nil
+		}
+		afterID = movies[len(movies)-1].ID
+
+		ids := make([]int64, len(movies))
+		for i, m := range movies {
+			ids[i] = m.ID
+		}
+		existing, err := s.db.GetEmbeddings(ctx, ids)
+		if err != nil {
+			return apperrors.E(op, err)
+		}
+		stored := make(map[int64]*models.MovieEmbedding, len(existing))
+		for _, e := range existing {
+			stored[e.MovieID] = e
+		}
+
+		var texts []string
+		var pending []*models.MovieEmbedding
+		for _, m := range movies {
+			text := embeddingText(&m)
+			hash := sha256.Sum256([]byte(text))
+			e := &models.MovieEmbedding{MovieID: m.ID, Model: model, SourceHash: hex.EncodeToString(hash[:])}
+			if old, ok := stored[m.ID]; ok && !force && old.Model == e.Model && old.SourceHash == e.SourceHash {
+				continue
+			}
+			texts = append(texts, text)
+			pending = append(pending, e)
+		}
+
+		if len(pending) > 0 {
+			vectors, err := s.provider.Embed(ctx, texts)
+			if err != nil {
+				return apperrors.E(op, err)
+			}
+			for i, e := range pending {
+				e.Embedding = vectors[i]
+			}
+			if err := s.db.SaveEmbeddings(ctx, pending); err != nil {
+				return apperrors.E(op, err)
+			}
+		}
+
+		s.mu.Lock()
+		s.job.Scanned += len(movies)
+		s.job.Embedded += len(pending)
+		s.mu.Unlock()
+
+		if len(movies) < s.batchSize {
+			return nil
+		}
+	}
+}
+
+// SimilarMovies returns up to limit movies nearest to movieID by embedding.
+// It fails with ErrEmbeddingsDisabled, or database.ErrNotFound when the movie
+// has not been embedded with the current model yet.
+func (s *EmbeddingService) SimilarMovies(ctx context.Context, movieID int64, limit int) ([]models.Movie, error) {
+	if s.provider == nil {
+		return nil, ErrEmbeddingsDisabled
+	}
+
+	movies, err := s.db.SimilarMovies(ctx, movieID, s.provider.Model(), limit)
+	if err != nil {
+		return nil, apperrors.E("EmbeddingService.SimilarMovies", err)
+	}
+	return movies, nil
+}
+
+// embeddingText is the text a movie is embedded from
+func embeddingText(m *models.Movie) string {
+	var b strings.Builder
+	b.WriteString("Title: " + m.Title + "\n")
+	if m.ReleaseYear > 0 {
+		b.WriteString("Year: " + strconv.Itoa(m.ReleaseYear) + "\n")
+	}
+	if len(m.Categories) > 0 {
+		b.WriteString("Categories: " + strings.Join(m.Categories, ", ") + "\n")
+	}
+	b.WriteString("Description: " + m.Description)
+	return b.String()
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/warehouse"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Warehouse tables rows are exported to, named like their Postgres sources
+const (
+	exportEventsTable     = "analytics_events"
+	exportMovieStatsTable = "movie_daily_stats"
+	exportUserStatsTable  = "user_daily_stats"
+
+	// exportTimeFormat is accepted for timestamps by both ClickHouse and BigQuery
+	exportTimeFormat = "2006-01-02 15:04:05.000"
+)
+
+var ErrUnknownSink = errors.New("unknown export sink")
+
+// ExportService ships raw analytics events and finalised daily rollups to
+// the configured warehouse sinks. Each sink has a checkpoint holding the last
+// event ID and rollup day it received, so exports resume where they stopped
+// and a failing sink does not hold back the others.
+type ExportService struct {
+	analyticsDB *database.AnalyticsDB
+	db          *database.ExportDB
+	sinks       map[string]warehouse.Sink
+	logger      *zap.Logger
+	interval    time.Duration
+	batchSize   int
+	lookback    time.Duration
+	now         func() time.Time
+
+	// mu serializes export runs with checkpoint resets
+	mu sync.Mutex
+}
+
+func NewExportService(
+	analyticsDB *database.AnalyticsDB,
+	db *database.ExportDB,
+	sinks map[string]warehouse.Sink,
+	cfg config.ExportConfig,
+	analyticsCfg config.AnalyticsConfig,
+	logger *zap.Logger,
+) *ExportService {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	// Rollup days are only final once they leave the rollup lookback window
+	lookback := analyticsCfg.RollupLookback
+	if lookback <= 0 {
+		lookback = maxEventAge
+	}
+
+	return &ExportService{
+		analyticsDB: analyticsDB,
+		db:          db,
+		sinks:       sinks,
+		logger:      logger,
+		interval:    interval,
+		batchSize:   batchSize,
+		lookback:    lookback,
+		now:         time.Now,
+	}
+}
+
+// Run exports to every sink on startup and then every interval until ctx is
+// cancelled. It returns at once when no sinks are configured.
+func (s *ExportService) Run(ctx context.Context) {
+	if len(s.sinks) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, name := range s.sinkNames() {
+			if err := s.Export(ctx, name); err != nil && ctx.Err() == nil {
+				s.logger.Error("analytics export failed", zap.String("sink", name), zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export ships everything new since the sink's checkpoint: events in batches
+// and then each finalised rollup day
+func (s *ExportService) Export(ctx context.Context, name string) error {
+	const op = "ExportService.Export"
+
+	sink, ok := s.sinks[name]
+	if !ok {
+		return ErrUnknownSink
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, err := s.db.GetCheckpoint(ctx, name)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	if err := s.exportEvents(ctx, sink, checkpoint); err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.exportRollups(ctx, sink, checkpoint); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *ExportService) exportEvents(ctx context.Context, sink warehouse.Sink, checkpoint *models.ExportCheckpoint) error {
+	for {
+		events, err := s.analyticsDB.EventsAfter(ctx, checkpoint.LastEventID, s.batchSize)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		rows := make([]warehouse.Row, len(events))
+		for i, e := range events {
+			rows[i] = eventRow(e)
+		}
+		if err := sink.Write(ctx, exportEventsTable, rows); err != nil {
+			return err
+		}
+
+		checkpoint.LastEventID = events[len(events)-1].ID
+		if err := s.db.SaveCheckpoint(ctx, checkpoint); err != nil {
+			return err
+		}
+		if len(events) < s.batchSize {
+			return nil
+		}
+	}
+}
+
+// exportRollups ships each rollup day after the checkpoint that will no
+// longer be recomputed
+func (s *ExportService) exportRollups(ctx context.Context, sink warehouse.Sink, checkpoint *models.ExportCheckpoint) error {
+	day := checkpoint.LastDay
+	if day.IsZero() {
+		first, err := s.analyticsDB.FirstStatsDay(ctx)
+		if err != nil || first.IsZero() {
+			return err
+		}
+		day = startOfDay(first)
+	} else {
+		day = startOfDay(day).AddDate(0, 0, 1)
+	}
+
+	final := startOfDay(s.now().Add(-s.lookback))
+	for ; day.Before(final); day = day.AddDate(0, 0, 1) {
+		movieStats, err := s.analyticsDB.MovieStatsOn(ctx, day)
+		if err != nil {
+			return err
+		}
+		userStats, err := s.analyticsDB.UserStatsOn(ctx, day)
+		if err != nil {
+			return err
+		}
+
+		movieRows := make([]warehouse.Row, len(movieStats))
+		for i, st := range movieStats {
+			movieRows[i] = movieStatsRow(st)
+		}
+		userRows := make([]warehouse.Row, len(userStats))
+		for i, st := range userStats {
+			userRows[i] = userStatsRow(st)
+		}
+		if err := sink.Write(ctx, exportMovieStatsTable, movieRows); err != nil {
+			return err
+		}
+		if err := sink.Write(ctx, exportUserStatsTable, userRows); err != nil {
+			return err
+		}
+
+		checkpoint.LastDay = day
+		if err := s.db.SaveCheckpoint(ctx, checkpoint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backfill rewinds a sink's checkpoint so events that occurred and rollup
+// days from from on are exported again on the next run. Raw events already
+// pruned by retention cannot be re-exported.
+func (s *ExportService) Backfill(ctx context.Context, name string, from time.Time) (*models.ExportCheckpoint, error) {
+	const op = "ExportService.Backfill"
+
+	if _, ok := s.sinks[name]; !ok {
+		return nil, ErrUnknownSink
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, err := s.db.GetCheckpoint(ctx, name)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	firstID, err := s.analyticsDB.FirstEventIDSince(ctx, startOfDay(from))
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if firstID > 0 && firstID <= checkpoint.LastEventID {
+		checkpoint.LastEventID = firstID - 1
+	}
+	if day := startOfDay(from).AddDate(0, 0, -1); checkpoint.LastDay.IsZero() || day.Before(checkpoint.LastDay) {
+		checkpoint.LastDay = day
+	}
+
+	if err := s.db.SaveCheckpoint(ctx, checkpoint); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return checkpoint, nil
+}
+
+// Checkpoints returns the progress of every configured sink
+func (s *ExportService) Checkpoints(ctx context.Context) ([]*models.ExportCheckpoint, error) {
+	checkpoints := make([]*models.ExportCheckpoint, 0, len(s.sinks))
+	for _, name := range s.sinkNames() {
+		checkpoint, err := s.db.GetCheckpoint(ctx, name)
+		if err != nil {
+			return nil, apperrors.E("ExportService.Checkpoints", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	return checkpoints, nil
+}
+
+func (s *ExportService) sinkNames() []string {
+	names := make([]string, 0, len(s.sinks))
+	for name := range s.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func eventRow(e *models.AnalyticsEvent) warehouse.Row {
+	var movieID *int64
+	if e.MovieID != 0 {
+		movieID = &e.MovieID
+	}
+	data := map[string]interface{}{
+		"id":               e.ID,
+		"type":             e.Type,
+		"user_id":          e.UserID,
+		"session_id":       e.SessionID,
+		"movie_id":         movieID,
+		"position_seconds": e.PositionSeconds,
+		"query":            e.Query,
+		"reason":           e.Reason,
+		"occurred_at":      e.OccurredAt.UTC().Format(exportTimeFormat),
+		"received_at":      e.ReceivedAt.UTC().Format(exportTimeFormat),
+	}
+	return warehouse.Row{ID: strconv.FormatInt(e.ID, 10), Data: data}
+}
+
+func movieStatsRow(st *models.MovieDailyStats) warehouse.Row {
+	day := st.Day.Format("2006-01-02")
+	return warehouse.Row{
+		ID: fmt.Sprintf("%d:%s", st.MovieID, day),
+		Data: map[string]interface{}{
+			"movie_id":      st.MovieID,
+			"day":           day,
+			"impressions":   st.Impressions,
+			"views":         st.Views,
+			"viewers":       st.Viewers,
+			"completions":   st.Completions,
+			"watch_seconds": st.WatchSeconds,
+		},
+	}
+}
+
+func userStatsRow(st *models.UserDailyStats) warehouse.Row {
+	day := st.Day.Format("2006-01-02")
+	return warehouse.Row{
+		ID: fmt.Sprintf("%d:%s", st.UserID, day),
+		Data: map[string]interface{}{
+			"user_id":       st.UserID,
+			"day":           day,
+			"views":         st.Views,
+			"titles":        st.Titles,
+			"completions":   st.Completions,
+			"watch_seconds": st.WatchSeconds,
+		},
+	}
+}
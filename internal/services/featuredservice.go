@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Audit actions and entity type of featured slots
+const (
+	AuditActionCreateFeaturedSlot = "create_featured_slot"
+	AuditActionUpdateFeaturedSlot = "update_featured_slot"
+	AuditActionDeleteFeaturedSlot = "delete_featured_slot"
+
+	auditEntityFeaturedSlot = "featured_slot"
+)
+
+var (
+	ErrInvalidFeaturedSlot    = errors.New("invalid featured slot")
+	ErrFeaturedTargetNotFound = errors.New("featured movie or collection not found")
+)
+
+// FeaturedItem is a featured slot in effect with the movie or collection it
+// features
+type FeaturedItem struct {
+	models.FeaturedSlot
+	Movie      *models.Movie
+	Collection *models.Collection
+}
+
+// FeaturedService schedules the banners of the home page. Every change is
+// recorded in the audit log.
+type FeaturedService struct {
+	db     *bun.DB
+	movies *MovieService
+	now    func() time.Time
+}
+
+func NewFeaturedService(db *bun.DB, movies *MovieService) *FeaturedService {
+	return &FeaturedService{db: db, movies: movies, now: time.Now}
+}
+
+// ListSlots returns every slot, or only those in effect now when activeOnly
+// is set, by descending priority
+func (s *FeaturedService) ListSlots(ctx context.Context, activeOnly bool) ([]models.FeaturedSlot, error) {
+	var slots []models.FeaturedSlot
+	query := s.db.NewSelect().
+		Model(&slots).
+		OrderExpr("priority DESC, id ASC")
+	if activeOnly {
+		activeAt(query, s.now())
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, apperrors.E("FeaturedService.ListSlots", err)
+	}
+	return slots, nil
+}
+
+func (s *FeaturedService) CreateSlot(ctx context.Context, slot *models.FeaturedSlot) error {
+	const op = "FeaturedService.CreateSlot"
+
+	if err := validateFeaturedSlot(slot); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := featuredTargetExists(ctx, tx, slot); err != nil {
+			return err
+		}
+
+		now := s.now()
+		slot.CreatedAt = now
+		slot.UpdatedAt = now
+		if _, err := tx.NewInsert().Model(slot).Exec(ctx); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditActionCreateFeaturedSlot, auditEntityFeaturedSlot, slot.ID, nil, slot)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *FeaturedService) UpdateSlot(ctx context.Context, slot *models.FeaturedSlot) error {
+	const op = "FeaturedService.UpdateSlot"
+
+	if err := validateFeaturedSlot(slot); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := featuredTargetExists(ctx, tx, slot); err != nil {
+			return err
+		}
+
+		before := &models.FeaturedSlot{ID: slot.ID}
+		err := tx.NewSelect().Model(before).WherePK().For("UPDATE").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("featured slot %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		slot.UpdatedAt = s.now()
+		err = tx.NewUpdate().
+			Model(slot).
+			ExcludeColumn("created_at").
+			WherePK().
+			Returning("created_at").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("featured slot %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, AuditActionUpdateFeaturedSlot, auditEntityFeaturedSlot, slot.ID, before, slot)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *FeaturedService) DeleteSlot(ctx context.Context, id int64) error {
+	const op = "FeaturedService.DeleteSlot"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		result, err := tx.NewDelete().
+			Model((*models.FeaturedSlot)(nil)).
+			Where("id = ?", id).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("featured slot %w", database.ErrNotFound)
+		}
+		return recordAudit(ctx, tx, AuditActionDeleteFeaturedSlot, auditEntityFeaturedSlot, id)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// ActiveSlots returns the slots in effect now, by descending priority, with
+// their targets. Slots featuring a movie that is not published, or above the
+// rating ceiling of the profile, or a hidden collection are left out. An
+// empty headline or image is filled in from the target.
+func (s *FeaturedService) ActiveSlots(ctx context.Context) ([]FeaturedItem, error) {
+	const op = "FeaturedService.ActiveSlots"
+
+	slots, err := s.ListSlots(ctx, true)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	var movieIDs, collectionIDs []int64
+	for _, slot := range slots {
+		if slot.MovieID != nil {
+			movieIDs = append(movieIDs, *slot.MovieID)
+		} else {
+			collectionIDs = append(collectionIDs, *slot.CollectionID)
+		}
+	}
+
+	movies, err := s.movies.publishedMoviesByID(ctx, movieIDs)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	collections := make(map[int64]*models.Collection)
+	if len(collectionIDs) > 0 {
+		var visible []models.Collection
+		err := s.db.NewSelect().
+			Model(&visible).
+			Where("col.id IN (?) AND col.hidden = false", bun.In(collectionIDs)).
+			Scan(ctx)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		for i := range visible {
+			collections[visible[i].ID] = &visible[i]
+		}
+	}
+
+	items := make([]FeaturedItem, 0, len(slots))
+	for _, slot := range slots {
+		item := FeaturedItem{FeaturedSlot: slot}
+		switch {
+		case slot.MovieID != nil && movies[*slot.MovieID] != nil:
+			item.Movie = movies[*slot.MovieID]
+			if item.Headline == "" {
+				item.Headline = item.Movie.Title
+			}
+			if item.ImageURL == "" {
+				item.ImageURL = item.Movie.PosterURL
+			}
+		case slot.CollectionID != nil && collections[*slot.CollectionID] != nil:
+			item.Collection = collections[*slot.CollectionID]
+			if item.Headline == "" {
+				item.Headline = item.Collection.Title
+			}
+		default:
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func validateFeaturedSlot(slot *models.FeaturedSlot) error {
+	slot.Headline = strings.TrimSpace(slot.Headline)
+	slot.ImageURL = strings.TrimSpace(slot.ImageURL)
+
+	switch {
+	case (slot.MovieID == nil) == (slot.CollectionID == nil):
+		return fmt.Errorf("%w: set either movie_id or collection_id", ErrInvalidFeaturedSlot)
+	case len(slot.Headline) > 255:
+		return fmt.Errorf("%w: headline must be at most 255 characters", ErrInvalidFeaturedSlot)
+	case !slot.StartsAt.IsZero() && !slot.EndsAt.IsZero() && !slot.EndsAt.After(slot.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalidFeaturedSlot)
+	}
+	return nil
+}
+
+// featuredTargetExists checks the movie or collection slot features exists
+func featuredTargetExists(ctx context.Context, db bun.IDB, slot *models.FeaturedSlot) error {
+	query := db.NewSelect()
+	if slot.MovieID != nil {
+		query.Model((*models.Movie)(nil)).Where("id = ?", *slot.MovieID)
+	} else {
+		query.Model((*models.Collection)(nil)).Where("id = ?", *slot.CollectionID)
+	}
+
+	exists, err := query.Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrFeaturedTargetNotFound
+	}
+	return nil
+}
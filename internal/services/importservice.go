@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/integrations"
+	"github.com/ndn/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/uptrace/bun"
+)
+
+// ExternalSourceTMDB is the external source of movies imported from TMDB
+const ExternalSourceTMDB = "tmdb"
+
+var (
+	ErrImportDisabled = errors.New("TMDB import is not configured")
+	// ErrIncompleteImport is returned for TMDB movies missing metadata every
+	// movie needs, such as the runtime of unreleased movies
+	ErrIncompleteImport = errors.New("TMDB movie is missing required metadata")
+)
+
+// genreAliases maps TMDB genres, lowercased, to other names local
+// categories commonly have for them
+var genreAliases = map[string][]string{
+	"science fiction": {"sci-fi", "scifi", "sci fi"},
+	"tv movie":        {"tv"},
+	"music":           {"musical"},
+	"family":          {"kids"},
+}
+
+// TMDBImport is the outcome of importing a movie from TMDB.
+// UnmappedGenres are its TMDB genres no local category matched.
+type TMDBImport struct {
+	Movie          *models.Movie
+	Created        bool
+	UnmappedGenres []string
+}
+
+// ImportService imports movie metadata from TMDB into the catalog
+type ImportService struct {
+	db     *bun.DB
+	tmdb   *integrations.TMDBClient
+	movies *MovieService
+}
+
+// NewImportService imports from tmdb, nil when imports are disabled
+func NewImportService(db *bun.DB, tmdb *integrations.TMDBClient, movies *MovieService) *ImportService {
+	return &ImportService{db: db, tmdb: tmdb, movies: movies}
+}
+
+// ImportTMDB creates the movie with TMDB ID tmdbID from its TMDB metadata,
+// or updates the one imported before. Its TMDB genres become the local
+// categories of the same name. What TMDB does not know about is kept on
+// updates: the video, the availability window and categories added
+// locally.
+func (s *ImportService) ImportTMDB(ctx context.Context, tmdbID int64) (*TMDBImport, error) {
+	const op = "ImportService.ImportTMDB"
+
+	if s.tmdb == nil {
+		return nil, apperrors.E(op, ErrImportDisabled)
+	}
+	external, err := s.tmdb.Movie(ctx, tmdbID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	categories, unmapped, err := s.mapGenres(ctx, external.Genres)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	movie := &models.Movie{
+		Title:          external.Title,
+		Description:    external.Overview,
+		ReleaseYear:    external.ReleaseYear,
+		Duration:       external.Runtime,
+		PosterURL:      external.PosterURL,
+		CategoryRefs:   categories,
+		ExternalSource: ExternalSourceTMDB,
+		ExternalID:     strconv.FormatInt(tmdbID, 10),
+	}
+
+	existing, err := s.movies.GetMovieByExternalID(ctx, movie.ExternalSource, movie.ExternalID)
+	switch {
+	case err == nil:
+		movie.VideoURL = existing.VideoURL
+		movie.AvailableFrom = existing.AvailableFrom
+		movie.AvailableUntil = existing.AvailableUntil
+		movie.CategoryRefs = mergeCategories(existing.CategoryRefs, categories)
+		if movie.Duration == 0 {
+			movie.Duration = existing.Duration
+		}
+		if movie.PosterURL == "" {
+			movie.PosterURL = existing.PosterURL
+		}
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, apperrors.E(op, err)
+	}
+	if movie.Title == "" || movie.Duration <= 0 {
+		return nil, apperrors.E(op, ErrIncompleteImport)
+	}
+
+	created, err := s.movies.UpsertMovieByExternalID(ctx, movie)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return &TMDBImport{Movie: movie, Created: created, UnmappedGenres: unmapped}, nil
+}
+
+// mapGenres returns the local categories matching genres, by name ignoring
+// case or by genreAliases, and the genres none matched
+func (s *ImportService) mapGenres(ctx context.Context, genres []string) ([]models.Category, []string, error) {
+	var all []models.Category
+	err := s.db.NewSelect().
+		Model(&all).
+		Column("id", "name").
+		Scan(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	byName := make(map[string]models.Category, len(all))
+	for _, category := range all {
+		byName[strings.ToLower(category.Name)] = category
+	}
+
+	categories := []models.Category{}
+	var unmapped []string
+	for _, genre := range genres {
+		key := strings.ToLower(genre)
+		category, ok := byName[key]
+		for _, alias := range genreAliases[key] {
+			if ok {
+				break
+			}
+			category, ok = byName[alias]
+		}
+		if ok {
+			categories = mergeCategories(categories, []models.Category{category})
+		} else {
+			unmapped = append(unmapped, genre)
+		}
+	}
+	return categories, unmapped, nil
+}
+
+// mergeCategories appends the categories of add missing from categories,
+// by ID
+func mergeCategories(categories, add []models.Category) []models.Category {
+	merged := append([]models.Category{}, categories...)
+	for _, category := range add {
+		found := false
+		for _, c := range merged {
+			if c.ID == category.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, category)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+)
+
+// Login throttling settings when not configured
+const (
+	defaultLoginBaseDelay       = time.Second
+	defaultLoginMaxDelay        = 15 * time.Minute
+	defaultLoginLockoutDuration = 30 * time.Minute
+	defaultLoginWindow          = time.Hour
+)
+
+var (
+	// ErrLoginThrottled is returned by Login when an email or IP address
+	// tries again too soon after failing
+	ErrLoginThrottled = errors.New("too many failed logins")
+	// ErrAccountLocked is returned by Login when an email address failed so
+	// often its account is locked
+	ErrAccountLocked = errors.New("account locked")
+)
+
+// LoginBlockedError is the ErrLoginThrottled or, when Locked, the
+// ErrAccountLocked of a login refused without checking its password.
+// Logins are accepted again after RetryAfter.
+type LoginBlockedError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *LoginBlockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Unwrap(), e.RetryAfter)
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	if e.Locked {
+		return ErrAccountLocked
+	}
+	return ErrLoginThrottled
+}
+
+// UnlockUser forgets the failed logins of the user with userID, lifting the
+// lock of their account
+func (s *AuthService) UnlockUser(ctx context.Context, userID int64) error {
+	const op = "AuthService.UnlockUser"
+
+	user, err := s.db.GetUser(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	if err := s.db.ClearLoginAttempts(ctx, loginEmailKey(user.Email)); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// loginKeys returns the keys failed logins for email from ip are counted
+// under, none when throttling is disabled. The email address comes first.
+func (s *AuthService) loginKeys(email, ip string) []string {
+	if !s.throttle.Enabled {
+		return nil
+	}
+	keys := []string{loginEmailKey(email)}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	return keys
+}
+
+// checkLogin returns a *LoginBlockedError when any of keys has failed too
+// recently, or is locked
+func (s *AuthService) checkLogin(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	attempts, err := s.db.GetLoginAttempts(ctx, keys)
+	if err != nil {
+		return err
+	}
+	return s.loginBlock(attempts, s.now())
+}
+
+// loginBlock returns a *LoginBlockedError when any of attempts is locked at
+// now, or failed too recently, lasting until all of them allow logging in
+func (s *AuthService) loginBlock(attempts []models.LoginAttempt, now time.Time) error {
+	var blocked *LoginBlockedError
+	for _, attempt := range attempts {
+		if now.Before(attempt.LockedUntil) {
+			return &LoginBlockedError{Locked: true, RetryAfter: attempt.LockedUntil.Sub(now)}
+		}
+		if now.Sub(attempt.LastFailedAt) >= s.throttle.Window {
+			continue
+		}
+		next := attempt.LastFailedAt.Add(s.loginDelay(attempt.Failures))
+		if now.Before(next) && (blocked == nil || next.Sub(now) > blocked.RetryAfter) {
+			blocked = &LoginBlockedError{RetryAfter: next.Sub(now)}
+		}
+	}
+	if blocked != nil {
+		return blocked
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed login under keys, locking the account
+// of the email address, the first key, once it failed too often
+func (s *AuthService) recordLoginFailure(ctx context.Context, keys []string) error {
+	now := s.now()
+	for i, key := range keys {
+		attempt, err := s.db.RecordLoginFailure(ctx, key, now, now.Add(-s.throttle.Window))
+		if err != nil {
+			return err
+		}
+		if i == 0 && s.throttle.LockoutAttempts > 0 && attempt.Failures >= s.throttle.LockoutAttempts {
+			if err := s.db.LockLogin(ctx, key, now.Add(s.throttle.LockoutDuration)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// loginDelay is how long to wait after the last of failures in a row before
+// logging in again: none for the free attempts, then the base delay
+// doubling with every failure, up to the max delay
+func (s *AuthService) loginDelay(failures int) time.Duration {
+	if failures < s.throttle.FreeAttempts {
+		return 0
+	}
+	delay := s.throttle.BaseDelay
+	for i := s.throttle.FreeAttempts; i < failures && delay < s.throttle.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.throttle.MaxDelay {
+		delay = s.throttle.MaxDelay
+	}
+	return delay
+}
+
+// loginThrottle fills in the durations cfg leaves unset
+func loginThrottle(cfg config.LoginThrottleConfig) config.LoginThrottleConfig {
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaultLoginBaseDelay
+	}
+	if cfg.MaxDelay <= 0 {
+		cfg.MaxDelay = defaultLoginMaxDelay
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = defaultLoginLockoutDuration
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultLoginWindow
+	}
+	return cfg
+}
+
+// loginEmailKey is the key failed logins for email are counted under,
+// whatever its case
+func loginEmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/models"
+	"testing"
+	"time"
+)
+
+func newThrottledAuthService(cfg config.LoginThrottleConfig) *AuthService {
+	return &AuthService{throttle: loginThrottle(cfg)}
+}
+
+func TestLoginDelay(t *testing.T) {
+	s := newThrottledAuthService(config.LoginThrottleConfig{
+		Enabled:      true,
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+	})
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := s.loginDelay(tt.failures); got != tt.want {
+			t.Errorf("loginDelay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginBlock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	s := newThrottledAuthService(config.LoginThrottleConfig{
+		Enabled:      true,
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		Window:       time.Hour,
+	})
+
+	tests := []struct {
+		name       string
+		attempts   []models.LoginAttempt
+		locked     bool
+		retryAfter time.Duration
+	}{
+		{
+			name: "no failures",
+		},
+		{
+			name:     "free attempts",
+			attempts: []models.LoginAttempt{{Key: "email:a@b.c", Failures: 1, LastFailedAt: now}},
+		},
+		{
+			name:       "backing off",
+			attempts:   []models.LoginAttempt{{Key: "email:a@b.c", Failures: 4, LastFailedAt: now.Add(-time.Second)}},
+			retryAfter: 3 * time.Second,
+		},
+		{
+			name:     "delay over",
+			attempts: []models.LoginAttempt{{Key: "email:a@b.c", Failures: 4, LastFailedAt: now.Add(-4 * time.Second)}},
+		},
+		{
+			name:     "failures outside the window",
+			attempts: []models.LoginAttempt{{Key: "email:a@b.c", Failures: 50, LastFailedAt: now.Add(-time.Hour)}},
+		},
+		{
+			name: "longest delay of all keys",
+			attempts: []models.LoginAttempt{
+				{Key: "email:a@b.c", Failures: 2, LastFailedAt: now},
+				{Key: "ip:10.0.0.1", Failures: 5, LastFailedAt: now},
+			},
+			retryAfter: 8 * time.Second,
+		},
+		{
+			name: "locked",
+			attempts: []models.LoginAttempt{
+				{Key: "ip:10.0.0.1", Failures: 5, LastFailedAt: now},
+				{Key: "email:a@b.c", Failures: 10, LastFailedAt: now.Add(-time.Hour), LockedUntil: now.Add(time.Minute)},
+			},
+			locked:     true,
+			retryAfter: time.Minute,
+		},
+		{
+			name:     "lock expired",
+			attempts: []models.LoginAttempt{{Key: "email:a@b.c", Failures: 10, LastFailedAt: now.Add(-time.Hour), LockedUntil: now}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.loginBlock(tt.attempts, now)
+			if tt.retryAfter == 0 {
+				if err != nil {
+					t.Fatalf("login blocked: %v", err)
+				}
+				return
+			}
+
+			var blocked *LoginBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("got %v, want a *LoginBlockedError", err)
+			}
+			if blocked.Locked != tt.locked || blocked.RetryAfter != tt.retryAfter {
+				t.Errorf("got locked %t, retry after %s, want %t, %s", blocked.Locked, blocked.RetryAfter, tt.locked, tt.retryAfter)
+			}
+			want := ErrLoginThrottled
+			if tt.locked {
+				want = ErrAccountLocked
+			}
+			if !errors.Is(err, want) {
+				t.Errorf("got %v, want %v", err, want)
+			}
+		})
+	}
+}
+
+func TestLoginKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		email   string
+		ip      string
+		want    []string
+	}{
+		{"disabled", false, "a@b.c", "10.0.0.1", nil},
+		{"email and IP", true, "a@b.c", "10.0.0.1", []string{"email:a@b.c", "ip:10.0.0.1"}},
+		{"email case", true, " A@B.c ", "", []string{"email:a@b.c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newThrottledAuthService(config.LoginThrottleConfig{Enabled: tt.enabled})
+			got := s.loginKeys(tt.email, tt.ip)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got keys %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got keys %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoginThrottleDefaults(t *testing.T) {
+	cfg := loginThrottle(config.LoginThrottleConfig{Enabled: true})
+	if cfg.BaseDelay != defaultLoginBaseDelay || cfg.MaxDelay != defaultLoginMaxDelay ||
+		cfg.LockoutDuration != defaultLoginLockoutDuration || cfg.Window != defaultLoginWindow {
+		t.Errorf("unset durations not defaulted: %+v", cfg)
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/ndn/internal/cache"
+)
+
+// movieGenerationKey counts changes to movies. Cached movie reads are keyed
+// by the generation they were read in, so bumping it drops all of them at
+// once, however many listings and filters were cached.
+const movieGenerationKey = "movies:generation"
+
+// cachedMovieRead decodes the cached value of key into v, a pointer, or on a
+// miss fills v with load and caches it. Errors from the cache are treated
+// as misses. load must read from the primary: a replica may not have replayed
+// the change that bumped the generation yet.
+func cachedMovieRead(ctx context.Context, c cache.Cache, key string, v interface{}, load func() error) error {
+	var generation int64
+	if _, err := c.Get(ctx, movieGenerationKey, &generation); err != nil {
+		return load()
+	}
+	key = fmt.Sprintf("movies:%d:%s", generation, key)
+
+	if ok, err := c.Get(ctx, key, v); err == nil && ok {
+		return nil
+	}
+	if err := load(); err != nil {
+		return err
+	}
+	// Best effort: the read succeeded even if caching it fails
+	_ = c.Set(ctx, key, v, 0)
+	return nil
+}
+
+// invalidateMovies drops every cached movie read. It is called once a
+// change to movies is committed, so no read of the old data can be cached
+// under the new generation.
+func invalidateMovies(ctx context.Context, c cache.Cache) {
+	// Cached reads expire on their own if the cache cannot be reached
+	_, _ = c.Incr(ctx, movieGenerationKey)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Limits of MovieFilter
+const (
+	MaxMovieSortKeys  = 3
+	MaxExcludedMovies = 100
+	maxMovieRating    = 10
+)
+
+var (
+	ErrInvalidMovieFilter      = errors.New("invalid movie filter")
+	ErrEmptyMovieFilterRange   = errors.New("lower bound of movie filter range is above its upper bound")
+	ErrConflictingMovieFilters = errors.New("conflicting movie filters")
+	ErrInvalidMovieSort        = errors.New("invalid movie sort key")
+)
+
+// MovieFilterError reports the filter a MovieFilter failed validation on,
+// named after its query parameter. Other is the filter it conflicts with, the
+// upper bound of an empty range, or the offending key of a sort.
+type MovieFilterError struct {
+	Param string
+	Other string
+	Err   error
+}
+
+func (e *MovieFilterError) Error() string {
+	if e.Other != "" {
+		return fmt.Sprintf("%s (%s): %v", e.Param, e.Other, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Param, e.Err)
+}
+
+func (e *MovieFilterError) Unwrap() error {
+	return e.Err
+}
+
+// movieSortColumns are the columns of the fields movies sort by
+var movieSortColumns = map[string]string{
+	"title":      "m.title",
+	"year":       "m.release_year",
+	"rating":     "m.rating",
+	"duration":   "m.duration",
+	"created_at": "m.created_at",
+}
+
+// Validate checks the values of the filter and that they can be combined:
+// year cannot be combined with year_from or year_to, ranges must not be
+// empty, and no category may be both included and excluded. The sort keys of
+// SortBy are a field, title, year, rating, duration or created_at, optionally
+// followed by _asc or _desc; each field may be sorted by once.
+func (f *MovieFilter) Validate() error {
+	switch {
+	case f.Year != nil && f.YearFrom != nil:
+		return &MovieFilterError{Param: "year", Other: "year_from", Err: ErrConflictingMovieFilters}
+	case f.Year != nil && f.YearTo != nil:
+		return &MovieFilterError{Param: "year", Other: "year_to", Err: ErrConflictingMovieFilters}
+	case f.YearFrom != nil && f.YearTo != nil && *f.YearFrom > *f.YearTo:
+		return &MovieFilterError{Param: "year_from", Other: "year_to", Err: ErrEmptyMovieFilterRange}
+	case f.DurationMin != nil && *f.DurationMin < 0:
+		return &MovieFilterError{Param: "duration_min", Err: ErrInvalidMovieFilter}
+	case f.DurationMax != nil && *f.DurationMax < 0:
+		return &MovieFilterError{Param: "duration_max", Err: ErrInvalidMovieFilter}
+	case f.DurationMin != nil && f.DurationMax != nil && *f.DurationMin > *f.DurationMax:
+		return &MovieFilterError{Param: "duration_min", Other: "duration_max", Err: ErrEmptyMovieFilterRange}
+	case f.RatingGTE != nil && (*f.RatingGTE < 0 || *f.RatingGTE > maxMovieRating):
+		return &MovieFilterError{Param: "rating_gte", Err: ErrInvalidMovieFilter}
+	case len(f.ExcludeIDs) > MaxExcludedMovies:
+		return &MovieFilterError{Param: "exclude_ids", Err: ErrInvalidMovieFilter}
+	}
+
+	for _, excluded := range f.ExcludeCategories {
+		for _, included := range f.Categories {
+			if strings.EqualFold(excluded, included) {
+				return &MovieFilterError{Param: "categories", Other: "exclude_categories", Err: ErrConflictingMovieFilters}
+			}
+		}
+	}
+
+	_, err := movieSortOrder(f.SortBy)
+	return err
+}
+
+// movieSortOrder returns the ORDER BY expressions of the sort keys of sortBy,
+// newest first when it is empty
+func movieSortOrder(sortBy string) ([]string, error) {
+	if strings.TrimSpace(sortBy) == "" {
+		return []string{"m.created_at DESC"}, nil
+	}
+
+	keys := strings.Split(sortBy, ",")
+	if len(keys) > MaxMovieSortKeys {
+		return nil, &MovieFilterError{Param: "sort_by", Other: keys[MaxMovieSortKeys], Err: ErrInvalidMovieSort}
+	}
+
+	order := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		field, direction := key, "ASC"
+		if f, found := strings.CutSuffix(key, "_desc"); found {
+			field, direction = f, "DESC"
+		} else if f, found := strings.CutSuffix(key, "_asc"); found {
+			field = f
+		}
+
+		column, ok := movieSortColumns[field]
+		if !ok || seen[field] {
+			return nil, &MovieFilterError{Param: "sort_by", Other: key, Err: ErrInvalidMovieSort}
+		}
+		seen[field] = true
+		order = append(order, column+" "+direction)
+	}
+	return order, nil
+}
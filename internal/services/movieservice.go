@@ -2,49 +2,210 @@ package services
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
 	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/notifications"
+	"slices"
+	"time"
 
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
+var (
+	ErrMovieExists           = errors.New("movie already exists")
+	ErrMovieTitleTaken       = errors.New("movie title already taken")
+	ErrNoBulkItems           = errors.New("no ids given")
+	ErrTooManyItems          = errors.New("too many ids in bulk request")
+	ErrTooManyMatches        = errors.New("filter matches too many movies")
+	ErrInvalidAvailability   = errors.New("available_until must be after available_from")
+	ErrInvalidMaturityRating = errors.New("invalid maturity rating")
+	ErrUnknownCategory       = errors.New("unknown category")
+)
+
+const (
+	// MaxBulkItems caps how many movie IDs a single bulk request may list
+	MaxBulkItems = 500
+	// MaxBulkFilterMatches caps how many movies a filter-based bulk request
+	// may touch
+	MaxBulkFilterMatches = 5000
+	// MaxBatchMovies caps how many movies GetMoviesByIDs looks up at once
+	MaxBatchMovies = 100
+)
+
+// Per-item outcomes of a bulk operation
+const (
+	BulkStatusDeleted        = "deleted"
+	BulkStatusRestored       = "restored"
+	BulkStatusNotFound       = "not_found"
+	BulkStatusAlreadyDeleted = "already_deleted"
+	BulkStatusNotDeleted     = "not_deleted"
+	BulkStatusFound          = "found" // by GetMoviesByIDs
+)
+
+type BulkItemResult struct {
+	ID     int64  `json:"id" example:"1"`
+	Status string `json:"status" example:"deleted"`
+}
+
+// MovieService manages the movie catalog. Movie lookups, listings and top
+// rated movies are read through the cache, which every change to movies
+// invalidates. Published movies are read translated into the locale each
+// request asks for, see LocalizeMovies. Public catalog reads go to a read
+// replica; admin reads, and reads made before changing a movie, go to the
+// primary, as does the rating ceiling of the profile browsing.
 type MovieService struct {
-	db *bun.DB
+	db            *bun.DB
+	replicas      *database.Replicas
+	cache         cache.Cache
+	notifications *notifications.Hub
+	releases      *ReleaseFeed
 }
 
-func NewMovieService(db *bun.DB) *MovieService {
-	return &MovieService{db: db}
+func NewMovieService(db *bun.DB, replicas *database.Replicas, c cache.Cache, hub *notifications.Hub, releases *ReleaseFeed) *MovieService {
+	return &MovieService{db: db, replicas: replicas, cache: c, notifications: hub, releases: releases}
 }
 
 type MovieFilter struct {
-	CategoryID *int64   `json:"category_id,omitempty"`
-	Search     string   `json:"search,omitempty"`
+	CategoryID *int64 `json:"category_id,omitempty"`
+	Search     string `json:"search,omitempty"`
+	// SortBy is a comma-separated list of up to MaxMovieSortKeys sort keys,
+	// such as year_desc,title_asc. See Validate.
 	SortBy     string   `json:"sort_by,omitempty"`
 	Categories []string `json:"categories,omitempty"`
 	Year       *int     `json:"year,omitempty"`
 	Page       int      `json:"page,omitempty"`
 	PageSize   int      `json:"page_size,omitempty"`
+	// CategorySlug limits the movies to those of the category with the slug
+	CategorySlug string `json:"category_slug,omitempty"`
+	// MaxMaturityRating leaves out movies rated above it, and unrated ones
+	MaxMaturityRating string `json:"max_maturity_rating,omitempty"`
+	// RatingGTE leaves out movies rated below it, and unrated ones
+	RatingGTE *float64 `json:"rating_gte,omitempty"`
+	// YearFrom and YearTo bound the release year, both included
+	YearFrom *int `json:"year_from,omitempty"`
+	YearTo   *int `json:"year_to,omitempty"`
+	// DurationMin and DurationMax bound the duration in minutes, both included
+	DurationMin *int `json:"duration_min,omitempty"`
+	DurationMax *int `json:"duration_max,omitempty"`
+	// ExcludeCategories leaves out the movies of the categories with the
+	// names, and of their sub-categories
+	ExcludeCategories []string `json:"exclude_categories,omitempty"`
+	// ExcludeIDs leaves out the movies with the IDs
+	ExcludeIDs []int64 `json:"exclude_ids,omitempty"`
 }
 
-func (s *MovieService) GetMovies(ctx context.Context, filter MovieFilter) ([]models.Movie, int, error) {
-	query := s.db.NewSelect().Model((*models.Movie)(nil))
+// MovieRelations selects the relations GetMovies and GetLocalizedMovie load
+// with movies. Relations left out are not queried.
+type MovieRelations struct {
+	Categories bool // CategoryRefs
+}
 
-	if filter.Search != "" {
-		query.Where("title ILIKE ? OR description ILIKE ?",
-			"%"+filter.Search+"%", "%"+filter.Search+"%")
+// AllMovieRelations loads every relation of movies
+var AllMovieRelations = MovieRelations{Categories: true}
+
+// movieListing is a cached page of GetMovies
+type movieListing struct {
+	Movies []models.Movie `json:"movies"`
+	Total  int            `json:"total"`
+}
+
+func (s *MovieService) GetMovies(ctx context.Context, filter MovieFilter, relations MovieRelations) ([]models.Movie, int, error) {
+	const op = "MovieService.GetMovies"
+
+	if err := filter.Validate(); err != nil {
+		return nil, 0, apperrors.E(op, err)
 	}
 
-	if filter.CategoryID != nil {
-		query.Join("JOIN movie_categories AS mc ON mc.movie_id = movie.id").
-			Where("mc.category_id = ?", *filter.CategoryID)
+	// The profile browsing is never shown movies above its rating ceiling
+	ceiling, err := profileRatingCeiling(ctx, s.db)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
 	}
+	filter.MaxMaturityRating = stricterRating(filter.MaxMaturityRating, ceiling)
 
-	if len(filter.Categories) > 0 {
-		query.Where("categories && ?", bun.In(filter.Categories))
+	key, err := json.Marshal(filter)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
 	}
 
-	if filter.Year != nil {
-		query.Where("release_year = ?", *filter.Year)
+	// Cached pages are read from the primary, which has every change
+	// invalidated, so a lagging replica cannot cache what they replaced
+	db := s.replicas.Reader()
+	var listing movieListing
+	err = cachedMovieRead(ctx, s.cache, "list:"+string(key), &listing, func() (err error) {
+		listing.Movies, listing.Total, err = s.getMovies(ctx, s.db, filter)
+		return err
+	})
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	if err := s.localizeMovies(ctx, db, listing.Movies); err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	if relations.Categories {
+		if err := s.loadCategories(ctx, db, listing.Movies); err != nil {
+			return nil, 0, apperrors.E(op, err)
+		}
+	}
+	return listing.Movies, listing.Total, nil
+}
+
+func (s *MovieService) getMovies(ctx context.Context, db bun.IDB, filter MovieFilter) ([]models.Movie, int, error) {
+	// Alone, a category slug lists the same movies as the category name,
+	// which the boosts of the category row are keyed by
+	if filter.CategorySlug != "" && len(filter.Categories) == 0 {
+		var name string
+		err := db.NewSelect().
+			Model((*models.Category)(nil)).
+			Column("name").
+			Where("slug = ?", filter.CategorySlug).
+			Scan(ctx, &name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return []models.Movie{}, 0, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		filter.CategorySlug, filter.Categories = "", []string{name}
+	}
+
+	query := db.NewSelect().Model((*models.Movie)(nil)).Apply(database.Published)
+	applyMovieFilter(query, filter)
+
+	// Editorial boosts of the listing: pinned movies are taken out of the
+	// organic results and placed at their positions afterwards, and boosted
+	// ones rank ahead of the rest
+	var pins []pinnedMovie
+	var boosted []int64
+	if boostQuery, category, ok := boostListing(filter); ok {
+		pinBoosts, weighted, err := activeBoosts(ctx, db, boostQuery, category, time.Now())
+		if err != nil {
+			return nil, 0, err
+		}
+
+		pins, err = s.pinnedMovies(ctx, db, pinBoosts, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(pins) > 0 {
+			ids := make([]int64, len(pins))
+			for i, p := range pins {
+				ids[i] = p.movie.ID
+			}
+			query.Where("m.id NOT IN (?)", bun.In(ids))
+		}
+
+		for _, b := range weighted {
+			boosted = append(boosted, b.MovieID)
+		}
 	}
 
 	// Get total count
@@ -52,6 +213,7 @@ func (s *MovieService) GetMovies(ctx context.Context, filter MovieFilter) ([]mod
 	if err != nil {
 		return nil, 0, err
 	}
+	total += len(pins)
 
 	// Apply pagination
 	if filter.Page <= 0 {
@@ -63,140 +225,1076 @@ func (s *MovieService) GetMovies(ctx context.Context, filter MovieFilter) ([]mod
 	offset := (filter.Page - 1) * filter.PageSize
 
 	// Apply sorting
-	switch filter.SortBy {
-	case "title_asc":
-		query.Order("title ASC")
-	case "title_desc":
-		query.Order("title DESC")
-	case "year_asc":
-		query.Order("release_year ASC")
-	case "year_desc":
-		query.Order("release_year DESC")
-	case "rating_desc":
-		query.Order("rating DESC")
-	default:
-		query.Order("created_at DESC")
+	if len(boosted) > 0 {
+		query.OrderExpr("array_position(?::bigint[], m.id) NULLS LAST", pgdialect.Array(boosted))
+	}
+	order, err := movieSortOrder(filter.SortBy)
+	if err != nil {
+		return nil, 0, err
+	}
+	query.Order(order...)
+
+	placePins(pins, total)
+	movies, err := paginatePinned(pins, offset, filter.PageSize, func(offset, limit int) ([]models.Movie, error) {
+		var movies []models.Movie
+		err := query.
+			Limit(limit).
+			Offset(offset).
+			Scan(ctx, &movies)
+		return movies, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return movies, total, nil
+}
+
+// pinnedMovies loads the movies of pin boosts that the filter shows. The
+// search term is ignored, so editors can pin titles it does not match.
+func (s *MovieService) pinnedMovies(ctx context.Context, db bun.IDB, boosts []models.EditorialBoost, filter MovieFilter) ([]pinnedMovie, error) {
+	if len(boosts) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, len(boosts))
+	for i, b := range boosts {
+		ids[i] = b.MovieID
 	}
 
 	var movies []models.Movie
-	err = query.
-		Limit(filter.PageSize).
-		Offset(offset).
-		Scan(ctx, &movies)
+	query := db.NewSelect().
+		Model(&movies).
+		Where("m.id IN (?)", bun.In(ids)).
+		Apply(database.Published)
+	filter.Search = ""
+	applyMovieFilter(query, filter)
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
 
-	return movies, total, err
+	byID := make(map[int64]models.Movie, len(movies))
+	for _, m := range movies {
+		byID[m.ID] = m
+	}
+
+	// A movie pinned twice keeps its first position
+	var pins []pinnedMovie
+	for _, b := range boosts {
+		if m, ok := byID[b.MovieID]; ok {
+			pins = append(pins, pinnedMovie{movie: m, at: b.Position - 1})
+			delete(byID, b.MovieID)
+		}
+	}
+	return pins, nil
+}
+
+// categoryTree returns a WITH clause selecting, as tree, the IDs and names of
+// the categories matching where and of all their sub-categories
+func categoryTree(where string) string {
+	return `WITH RECURSIVE tree AS (
+		SELECT id, name FROM categories WHERE ` + where + `
+		UNION
+		SELECT c.id, c.name FROM categories AS c JOIN tree ON c.parent_id = tree.id
+	)`
+}
+
+// inCategoryTree returns a condition matching the movies linked to a
+// category of categoryTree(where)
+func inCategoryTree(where string) string {
+	return "EXISTS (SELECT 1 FROM movie_categories AS mc WHERE mc.movie_id = m.id AND mc.category_id IN (" +
+		categoryTree(where) + " SELECT id FROM tree))"
+}
+
+// applyMovieFilter adds the WHERE clauses of filter to a movie query
+func applyMovieFilter(query *bun.SelectQuery, filter MovieFilter) {
+	if filter.Search != "" {
+		query.Where("title ILIKE ? OR description ILIKE ?",
+			"%"+filter.Search+"%", "%"+filter.Search+"%")
+	}
+
+	// Categories include the movies of their sub-categories
+	if filter.CategoryID != nil {
+		query.Where(inCategoryTree("id = ?"), *filter.CategoryID)
+	}
+
+	if len(filter.Categories) > 0 {
+		query.Where(inCategoryTree("name = ANY(?)"), pgdialect.Array(filter.Categories))
+	}
+
+	if filter.CategorySlug != "" {
+		query.Where(inCategoryTree("slug = ?"), filter.CategorySlug)
+	}
+
+	if filter.Year != nil {
+		query.Where("release_year = ?", *filter.Year)
+	}
+
+	if filter.MaxMaturityRating != "" {
+		query.Where("m.maturity_rating IN (?)", bun.In(ratingsUpTo(filter.MaxMaturityRating)))
+	}
+
+	if filter.RatingGTE != nil {
+		query.Where("m.rating >= ?", *filter.RatingGTE)
+	}
+
+	if filter.YearFrom != nil {
+		query.Where("m.release_year >= ?", *filter.YearFrom)
+	}
+	if filter.YearTo != nil {
+		query.Where("m.release_year <= ?", *filter.YearTo)
+	}
+
+	if filter.DurationMin != nil {
+		query.Where("m.duration >= ?", *filter.DurationMin)
+	}
+	if filter.DurationMax != nil {
+		query.Where("m.duration <= ?", *filter.DurationMax)
+	}
+
+	if len(filter.ExcludeCategories) > 0 {
+		query.Where("NOT "+inCategoryTree("name = ANY(?)"), pgdialect.Array(filter.ExcludeCategories))
+	}
+
+	if len(filter.ExcludeIDs) > 0 {
+		query.Where("m.id NOT IN (?)", bun.In(filter.ExcludeIDs))
+	}
 }
 
 func (s *MovieService) GetMovie(ctx context.Context, id int64) (*models.Movie, error) {
+	const op = "MovieService.GetMovie"
+
 	movie := new(models.Movie)
-	err := s.db.NewSelect().
+	err := cachedMovieRead(ctx, s.cache, fmt.Sprintf("id:%d", id), movie, func() error {
+		return s.db.NewSelect().
+			Model(movie).
+			Where("id = ?", id).
+			Scan(ctx)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.loadMovieCategories(ctx, s.db, movie); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movie, nil
+}
+
+// GetPublishedMovie returns the movie if it is shown publicly, so drafts
+// cannot be looked up by ID
+func (s *MovieService) GetPublishedMovie(ctx context.Context, id int64) (*models.Movie, error) {
+	const op = "MovieService.GetPublishedMovie"
+
+	movie, err := s.getPublishedMovie(ctx, s.db, id, AllMovieRelations)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movie, nil
+}
+
+func (s *MovieService) getPublishedMovie(ctx context.Context, db bun.IDB, id int64, relations MovieRelations) (*models.Movie, error) {
+	movie := new(models.Movie)
+	err := db.NewSelect().
 		Model(movie).
 		Where("id = ?", id).
+		Apply(database.Published).
 		Scan(ctx)
-	return movie, err
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("movie %w", database.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if relations.Categories {
+		if err := s.loadMovieCategories(ctx, db, movie); err != nil {
+			return nil, err
+		}
+	}
+	return movie, nil
 }
 
-func (s *MovieService) CreateMovie(ctx context.Context, movie *models.Movie) error {
-	exists, err := s.db.NewSelect().
-		Model((*models.Movie)(nil)).
-		Where("title = ?", movie.Title).
-		Exists(ctx)
+// GetLocalizedMovie is GetPublishedMovie with the movie translated for the
+// request of ctx, for showing it to clients, and only the relations given
+func (s *MovieService) GetLocalizedMovie(ctx context.Context, id int64, relations MovieRelations) (*models.Movie, error) {
+	const op = "MovieService.GetLocalizedMovie"
+
+	db := s.replicas.Reader()
+	movie, err := s.getPublishedMovie(ctx, db, id, relations)
 	if err != nil {
-		return err
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.localizeMovie(ctx, db, movie); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movie, nil
+}
+
+// GetMoviesByIDs returns the movies with the IDs, by ID, for clients showing
+// many movies at once, such as the watch history. Like GetLocalizedMovie, it
+// only returns published movies, translated and with their categories, and
+// leaves out those above the rating ceiling of the profile.
+func (s *MovieService) GetMoviesByIDs(ctx context.Context, ids []int64) (map[int64]*models.Movie, error) {
+	const op = "MovieService.GetMoviesByIDs"
+
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, ErrNoBulkItems
+	}
+	if len(ids) > MaxBatchMovies {
+		return nil, ErrTooManyItems
+	}
+
+	movies, err := s.publishedMoviesByID(ctx, ids)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movies, nil
+}
+
+// publishedMoviesByID returns the published movies of ids the viewer may
+// watch, localized and with their categories, by ID
+func (s *MovieService) publishedMoviesByID(ctx context.Context, ids []int64) (map[int64]*models.Movie, error) {
+	byID := make(map[int64]*models.Movie, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+
+	ceiling, err := profileRatingCeiling(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	db := s.replicas.Reader()
+	var movies []models.Movie
+	query := db.NewSelect().
+		Model(&movies).
+		Where("m.id IN (?)", bun.In(ids))
+	database.Published(query)
+	if ceiling != "" {
+		query.Where("m.maturity_rating IN (?)", bun.In(ratingsUpTo(ceiling)))
 	}
-	if exists {
-		return errors.New("movie already exists")
+	if err := query.Scan(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.localizeMovies(ctx, db, movies); err != nil {
+		return nil, err
+	}
+	if err := s.loadCategories(ctx, db, movies); err != nil {
+		return nil, err
+	}
+
+	for i := range movies {
+		byID[movies[i].ID] = &movies[i]
+	}
+	return byID, nil
+}
+
+func (s *MovieService) CreateMovie(ctx context.Context, movie *models.Movie) error {
+	const op = "MovieService.CreateMovie"
+
+	if err := validateMovie(movie); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			Where("title = ?", movie.Title).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrMovieExists
+		}
+
+		// Return the defaults filled in by the database, such as status
+		if err := tx.NewInsert().Model(movie).Returning("*").Scan(ctx); err != nil {
+			return err
+		}
+		if movie.CategoryRefs == nil {
+			movie.CategoryRefs = []models.Category{}
+		}
+		if err := setMovieCategories(ctx, tx, movie); err != nil {
+			return err
+		}
+		return publishMovieAdded(ctx, s.notifications, tx, movie)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
 	}
 
-	_, err = s.db.NewInsert().Model(movie).Exec(ctx)
-	return err
+	invalidateMovies(ctx, s.cache)
+	// Dry runs rolled back, and movies not shown yet are not released
+	if !dryrun.FromContext(ctx) && shownAt(movie, time.Now()) {
+		s.releases.publish(newRelease(movie))
+	}
+	return nil
 }
 
 func (s *MovieService) UpdateMovie(ctx context.Context, movie *models.Movie) error {
-	exists, err := s.db.NewSelect().
-		Model((*models.Movie)(nil)).
-		Where("title = ? AND id != ?", movie.Title, movie.ID).
-		Exists(ctx)
+	const op = "MovieService.UpdateMovie"
+
+	if err := validateMovie(movie); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			Where("title = ? AND id != ?", movie.Title, movie.ID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrMovieTitleTaken
+		}
+
+		_, err = tx.NewUpdate().
+			Model(movie).
+			WherePK().
+			OmitZero().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return setMovieCategories(ctx, tx, movie)
+	})
 	if err != nil {
-		return err
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+// GetMovieByExternalID returns the movie imported from source with its ID
+// there, whatever its status and even if deleted
+func (s *MovieService) GetMovieByExternalID(ctx context.Context, source, externalID string) (*models.Movie, error) {
+	const op = "MovieService.GetMovieByExternalID"
+
+	movie := new(models.Movie)
+	err := s.db.NewSelect().
+		Model(movie).
+		Where("external_source = ? AND external_id = ?", source, externalID).
+		WhereAllWithDeleted().
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.loadMovieCategories(ctx, s.db, movie); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movie, nil
+}
+
+// UpsertMovieByExternalID creates the movie, or updates the one already
+// imported with the same external source and ID, in a single statement so
+// importers can safely re-run. A soft-deleted movie imported again is
+// restored. It reports whether a new movie was created.
+func (s *MovieService) UpsertMovieByExternalID(ctx context.Context, movie *models.Movie) (bool, error) {
+	const op = "MovieService.UpsertMovieByExternalID"
+
+	if err := validateMovie(movie); err != nil {
+		return false, apperrors.E(op, err)
 	}
-	if exists {
-		return errors.New("movie title already taken")
+
+	var created bool
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			Where("title = ?", movie.Title).
+			Where("external_source IS DISTINCT FROM ? OR external_id IS DISTINCT FROM ?",
+				movie.ExternalSource, movie.ExternalID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrMovieTitleTaken
+		}
+
+		err = upsertMovieQuery(tx, movie).
+			Scan(ctx, &movie.ID, &movie.Status, &movie.CreatedAt, &movie.Rating, &created)
+		if err != nil {
+			return err
+		}
+		if err := setMovieCategories(ctx, tx, movie); err != nil || !created {
+			return err
+		}
+		return publishMovieAdded(ctx, s.notifications, tx, movie)
+	})
+	if err != nil {
+		return false, apperrors.E(op, err)
 	}
 
-	_, err = s.db.NewUpdate().
+	invalidateMovies(ctx, s.cache)
+	return created, nil
+}
+
+// upsertMovieQuery inserts movie, or updates the movie with the same
+// external source and ID, restoring it if it was soft-deleted, returning its
+// ID, status, creation time, rating and whether it was inserted
+func upsertMovieQuery(db bun.IDB, movie *models.Movie) *bun.InsertQuery {
+	return db.NewInsert().
 		Model(movie).
-		WherePK().
-		OmitZero().
-		Exec(ctx)
-	return err
+		On("CONFLICT (external_source, external_id) DO UPDATE").
+		Set("title = EXCLUDED.title").
+		Set("description = EXCLUDED.description").
+		Set("release_year = EXCLUDED.release_year").
+		Set("duration = EXCLUDED.duration").
+		Set("poster_url = EXCLUDED.poster_url").
+		Set("video_url = EXCLUDED.video_url").
+		Set("available_from = EXCLUDED.available_from").
+		Set("available_until = EXCLUDED.available_until").
+		Set("updated_at = EXCLUDED.updated_at").
+		Set("deleted_at = NULL").
+		// xmax is zero only for rows inserted by this statement
+		Returning("id, status, created_at, rating, (xmax = 0)")
 }
 
-func (s *MovieService) DeleteMovie(ctx context.Context, id int64) error {
-	// Delete associated records first
-	_, err := s.db.NewDelete().
-		Model((*models.MovieCategory)(nil)).
-		Where("movie_id = ?", id).
-		Exec(ctx)
+// PatchMovie writes every editable column of movie, including zero values,
+// so fields cleared by a patch are persisted
+func (s *MovieService) PatchMovie(ctx context.Context, movie *models.Movie) error {
+	const op = "MovieService.PatchMovie"
+
+	if err := validateMovie(movie); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			Where("title = ? AND id != ?", movie.Title, movie.ID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrMovieTitleTaken
+		}
+
+		movie.UpdatedAt = time.Now()
+		_, err = tx.NewUpdate().
+			Model(movie).
+			Column("title", "description", "release_year", "duration",
+				"poster_url", "video_url", "available_from",
+				"available_until", "updated_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		return setMovieCategories(ctx, tx, movie)
+	})
 	if err != nil {
-		return err
+		return apperrors.E(op, err)
 	}
 
-	_, err = s.db.NewDelete().
-		Model((*models.UserFavorite)(nil)).
-		Where("movie_id = ?", id).
-		Exec(ctx)
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+// SetPosterURL points the poster of a movie at url, such as an uploaded
+// image, and returns the updated movie
+func (s *MovieService) SetPosterURL(ctx context.Context, id int64, url string) (*models.Movie, error) {
+	const op = "MovieService.SetPosterURL"
+
+	movie := &models.Movie{ID: id, PosterURL: url, UpdatedAt: time.Now()}
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		return tx.NewUpdate().
+			Model(movie).
+			Column("poster_url", "updated_at").
+			WherePK().
+			Returning("*").
+			Scan(ctx)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
 	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	if err := s.loadMovieCategories(ctx, s.db, movie); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movie, nil
+}
+
+// setMovieCategories replaces the categories linked to movie with its
+// CategoryRefs, by ID, unless they are nil, and updates the category names
+// of the movie to match
+func setMovieCategories(ctx context.Context, tx bun.Tx, movie *models.Movie) error {
+	if movie.CategoryRefs == nil {
+		return nil
+	}
+
+	ids := make([]int64, len(movie.CategoryRefs))
+	for i, category := range movie.CategoryRefs {
+		ids[i] = category.ID
+	}
+	ids = uniqueIDs(ids)
+
+	categories := []models.Category{}
+	if len(ids) > 0 {
+		err := tx.NewSelect().
+			Model(&categories).
+			Where("id IN (?)", bun.In(ids)).
+			Order("display_order", "name").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+		if len(categories) != len(ids) {
+			return ErrUnknownCategory
+		}
+	}
+
+	query := tx.NewDelete().
+		Model((*models.MovieCategory)(nil)).
+		Where("movie_id = ?", movie.ID)
+	if len(ids) > 0 {
+		query.Where("category_id NOT IN (?)", bun.In(ids))
+	}
+	if _, err := query.Exec(ctx); err != nil {
 		return err
 	}
 
-	_, err = s.db.NewDelete().
+	names := make([]string, len(categories))
+	if len(categories) > 0 {
+		links := make([]models.MovieCategory, len(categories))
+		for i, category := range categories {
+			links[i] = models.MovieCategory{MovieID: movie.ID, CategoryID: category.ID}
+			names[i] = category.Name
+		}
+		_, err := tx.NewInsert().
+			Model(&links).
+			On("CONFLICT (movie_id, category_id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.NewUpdate().
 		Model((*models.Movie)(nil)).
-		Where("id = ?", id).
+		Set("categories = ?", pgdialect.Array(names)).
+		Where("id = ?", movie.ID).
+		WhereAllWithDeleted().
 		Exec(ctx)
-	return err
+	if err != nil {
+		return err
+	}
+	movie.Categories, movie.CategoryRefs = names, categories
+	return nil
+}
+
+// LoadCategories sets the CategoryRefs of movies to their categories
+func (s *MovieService) LoadCategories(ctx context.Context, movies []models.Movie) error {
+	return s.loadCategories(ctx, s.db, movies)
+}
+
+// loadCategories is LoadCategories reading from db
+func (s *MovieService) loadCategories(ctx context.Context, db bun.IDB, movies []models.Movie) error {
+	if err := database.LoadMovieCategories(ctx, db, movies); err != nil {
+		return apperrors.E("MovieService.LoadCategories", err)
+	}
+	return nil
+}
+
+// loadMovieCategories is loadCategories for a single movie
+func (s *MovieService) loadMovieCategories(ctx context.Context, db bun.IDB, movie *models.Movie) error {
+	movies := []models.Movie{*movie}
+	if err := s.loadCategories(ctx, db, movies); err != nil {
+		return err
+	}
+	movie.CategoryRefs = movies[0].CategoryRefs
+	return nil
+}
+
+// validateMovie checks the availability window and maturity rating of movie
+func validateMovie(movie *models.Movie) error {
+	if !validAvailability(movie) {
+		return ErrInvalidAvailability
+	}
+	if movie.MaturityRating != "" && !slices.Contains(models.ContentRatings, movie.MaturityRating) {
+		return ErrInvalidMaturityRating
+	}
+	return nil
+}
+
+// validAvailability reports whether the availability window of movie, if it
+// has both ends, ends after it starts
+func validAvailability(movie *models.Movie) bool {
+	return movie.AvailableFrom == nil || movie.AvailableUntil == nil ||
+		movie.AvailableUntil.After(*movie.AvailableFrom)
+}
+
+// Sizes of the pages of AdminListMovies
+const (
+	DefaultAdminMoviePageSize = 20
+	MaxAdminMoviePageSize     = 100
+)
+
+// AdminMovieFilter selects the movies of the admin listing. Zero fields
+// match every movie that is not deleted.
+type AdminMovieFilter struct {
+	Status         string `json:"status,omitempty"`
+	IncludeDeleted bool   `json:"include_deleted,omitempty"` // soft-deleted movies too
+	Page           int    `json:"page,omitempty"`
+	PageSize       int    `json:"page_size,omitempty"`
+}
+
+// AdminListMovies returns a page of the movies filter matches, whatever their
+// status, most recently updated first, and how many match in total. Pages
+// hold 20 movies unless set, and at most 100. Unlike GetMovies it reads
+// around the cache.
+func (s *MovieService) AdminListMovies(ctx context.Context, filter AdminMovieFilter) ([]models.Movie, int, error) {
+	const op = "MovieService.AdminListMovies"
+
+	if filter.Status != "" && !validMovieStatus(filter.Status) {
+		return nil, 0, apperrors.E(op, ErrInvalidMovieStatus)
+	}
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = DefaultAdminMoviePageSize
+	}
+	filter.PageSize = min(filter.PageSize, MaxAdminMoviePageSize)
+
+	var movies []models.Movie
+	query := s.db.NewSelect().
+		Model(&movies).
+		OrderExpr("m.updated_at DESC, m.id DESC").
+		Limit(filter.PageSize).
+		Offset((filter.Page - 1) * filter.PageSize)
+	if filter.Status != "" {
+		query.Where("m.status = ?", filter.Status)
+	}
+	if filter.IncludeDeleted {
+		query.WhereAllWithDeleted()
+	}
+
+	total, err := query.ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	if err := s.LoadCategories(ctx, movies); err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	return movies, total, nil
+}
+
+// DeleteMovie soft-deletes a movie, like BulkDeleteMovies, so it can be
+// restored until the trash is purged
+func (s *MovieService) DeleteMovie(ctx context.Context, id int64) error {
+	const op = "MovieService.DeleteMovie"
+
+	results, err := s.bulkSetDeleted(ctx, []int64{id}, true)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if results[0].Status != BulkStatusDeleted {
+		return apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+	return nil
+}
+
+// RestoreMovie undoes the soft delete of a movie, returning ErrNotDeleted
+// if it is not deleted
+func (s *MovieService) RestoreMovie(ctx context.Context, id int64) error {
+	const op = "MovieService.RestoreMovie"
+
+	results, err := s.bulkSetDeleted(ctx, []int64{id}, false)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	switch results[0].Status {
+	case BulkStatusNotFound:
+		return apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	case BulkStatusNotDeleted:
+		return apperrors.E(op, ErrNotDeleted)
+	}
+	return nil
+}
+
+// BulkDeleteMovies soft-deletes the given movies in one transaction so they
+// can be restored later. Categories and favorites are kept. Each ID gets its
+// own result; IDs that are missing or already deleted are skipped.
+func (s *MovieService) BulkDeleteMovies(ctx context.Context, ids []int64) ([]BulkItemResult, error) {
+	const op = "MovieService.BulkDeleteMovies"
+
+	results, err := s.bulkSetDeleted(ctx, ids, true)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return results, nil
+}
+
+// BulkRestoreMovies undoes a soft delete for the given movies in one
+// transaction. IDs that are missing or not deleted are skipped.
+func (s *MovieService) BulkRestoreMovies(ctx context.Context, ids []int64) ([]BulkItemResult, error) {
+	const op = "MovieService.BulkRestoreMovies"
+
+	results, err := s.bulkSetDeleted(ctx, ids, false)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return results, nil
+}
+
+func (s *MovieService) bulkSetDeleted(ctx context.Context, ids []int64, deleted bool) ([]BulkItemResult, error) {
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 {
+		return nil, ErrNoBulkItems
+	}
+	if len(ids) > MaxBulkItems {
+		return nil, ErrTooManyItems
+	}
+
+	results := make([]BulkItemResult, len(ids))
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		var movies []models.Movie
+		err := tx.NewSelect().
+			Model(&movies).
+			Column("id", "deleted_at").
+			Where("id IN (?)", bun.In(ids)).
+			WhereAllWithDeleted().
+			For("UPDATE").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		isDeleted := make(map[int64]bool, len(movies))
+		for _, m := range movies {
+			isDeleted[m.ID] = m.DeletedAt != nil
+		}
+
+		var targets []int64
+		for i, id := range ids {
+			results[i].ID = id
+			wasDeleted, found := isDeleted[id]
+			switch {
+			case !found:
+				results[i].Status = BulkStatusNotFound
+			case deleted && wasDeleted:
+				results[i].Status = BulkStatusAlreadyDeleted
+			case !deleted && !wasDeleted:
+				results[i].Status = BulkStatusNotDeleted
+			case deleted:
+				results[i].Status = BulkStatusDeleted
+				targets = append(targets, id)
+			default:
+				results[i].Status = BulkStatusRestored
+				targets = append(targets, id)
+			}
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+
+		action := AuditActionRestore
+		if deleted {
+			action = AuditActionDelete
+			_, err = tx.NewDelete().
+				Model((*models.Movie)(nil)).
+				Where("id IN (?)", bun.In(targets)).
+				Exec(ctx)
+		} else {
+			_, err = tx.NewUpdate().
+				Model((*models.Movie)(nil)).
+				Set("deleted_at = NULL").
+				Set("updated_at = ?", time.Now()).
+				Where("id IN (?)", bun.In(targets)).
+				WhereDeleted().
+				Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, id := range targets {
+			if err := recordAudit(ctx, tx, action, "movie", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return results, nil
+}
+
+type BulkCategoryResult struct {
+	CategoryID int64 `json:"category_id" example:"3"`
+	Matched    int   `json:"matched" example:"42"`
+	Updated    int   `json:"updated" example:"40"`
+}
+
+// BulkAssignCategory adds the category to (or, when add is false, removes it
+// from) every movie in ids, or every movie matching filter when ids is
+// empty. The categories array and movie_categories are updated together in
+// one transaction. Movies that already had the requested state are counted
+// as matched but not updated.
+func (s *MovieService) BulkAssignCategory(ctx context.Context, categoryID int64, add bool, ids []int64, filter *MovieFilter) (*BulkCategoryResult, error) {
+	const op = "MovieService.BulkAssignCategory"
+
+	ids = uniqueIDs(ids)
+	if len(ids) == 0 && filter == nil {
+		return nil, ErrNoBulkItems
+	}
+	if len(ids) > MaxBulkItems {
+		return nil, ErrTooManyItems
+	}
+
+	result := &BulkCategoryResult{CategoryID: categoryID}
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		category := new(models.Category)
+		err := tx.NewSelect().
+			Model(category).
+			Where("id = ?", categoryID).
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("category %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Resolve the movies to touch, locking them for the update
+		query := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			ColumnExpr("m.id").
+			For("UPDATE OF m")
+		if len(ids) > 0 {
+			query.Where("m.id IN (?)", bun.In(ids))
+		} else {
+			applyMovieFilter(query, *filter)
+			query.Limit(MaxBulkFilterMatches + 1)
+		}
+		var matched []int64
+		if err := query.Scan(ctx, &matched); err != nil {
+			return err
+		}
+		if len(matched) > MaxBulkFilterMatches {
+			return ErrTooManyMatches
+		}
+		result.Matched = len(matched)
+		if len(matched) == 0 {
+			return nil
+		}
+
+		var updated []int64
+		action := AuditActionRemoveCategory
+		if add {
+			action = AuditActionAddCategory
+			err = tx.NewUpdate().
+				Model((*models.Movie)(nil)).
+				Set("categories = array_append(COALESCE(categories, '{}'), ?)", category.Name).
+				Set("updated_at = ?", time.Now()).
+				Where("id IN (?)", bun.In(matched)).
+				Where("NOT (? = ANY(COALESCE(categories, '{}')))", category.Name).
+				Returning("id").
+				Scan(ctx, &updated)
+			if err != nil {
+				return err
+			}
+
+			links := make([]models.MovieCategory, len(matched))
+			for i, id := range matched {
+				links[i] = models.MovieCategory{MovieID: id, CategoryID: category.ID}
+			}
+			_, err = tx.NewInsert().
+				Model(&links).
+				On("CONFLICT (movie_id, category_id) DO NOTHING").
+				Exec(ctx)
+		} else {
+			err = tx.NewUpdate().
+				Model((*models.Movie)(nil)).
+				Set("categories = array_remove(categories, ?)", category.Name).
+				Set("updated_at = ?", time.Now()).
+				Where("id IN (?)", bun.In(matched)).
+				Where("? = ANY(categories)", category.Name).
+				Returning("id").
+				Scan(ctx, &updated)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.NewDelete().
+				Model((*models.MovieCategory)(nil)).
+				Where("category_id = ?", category.ID).
+				Where("movie_id IN (?)", bun.In(matched)).
+				Exec(ctx)
+		}
+		if err != nil {
+			return err
+		}
+		result.Updated = len(updated)
+
+		for _, id := range updated {
+			if err := recordAudit(ctx, tx, action, "movie", id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return result, nil
+}
+
+// uniqueIDs drops duplicates while keeping the order ids were given in
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
 }
 
 func (s *MovieService) GetRelatedMovies(ctx context.Context, movieID int64, limit int) ([]models.Movie, error) {
+	const op = "MovieService.GetRelatedMovies"
+
+	db := s.replicas.Reader()
+
 	// Get the categories of the current movie
 	var movie models.Movie
-	err := s.db.NewSelect().
+	err := db.NewSelect().
 		Model(&movie).
 		Where("id = ?", movieID).
+		Apply(database.Published).
 		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
 	if err != nil {
-		return nil, err
+		return nil, apperrors.E(op, err)
 	}
 
 	// Find movies with similar categories
 	var movies []models.Movie
-	err = s.db.NewSelect().
+	err = db.NewSelect().
 		Model(&movies).
 		Where("id != ?", movieID).
 		Where("categories && ?", bun.In(movie.Categories)).
-		Order("rating DESC").
+		Apply(database.Published).
+		Order("rating DESC", "rating_count DESC").
 		Limit(limit).
 		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.localizeMovies(ctx, db, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.loadCategories(ctx, db, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
 
-	return movies, err
+	return movies, nil
 }
 
 func (s *MovieService) GetTopRatedMovies(ctx context.Context, limit int) ([]models.Movie, error) {
+	db := s.replicas.Reader()
 	var movies []models.Movie
-	err := s.db.NewSelect().
-		Model(&movies).
-		Order("rating DESC").
-		Limit(limit).
-		Scan(ctx)
-	return movies, err
+	err := cachedMovieRead(ctx, s.cache, fmt.Sprintf("top_rated:%d", limit), &movies, func() error {
+		return s.db.NewSelect().
+			Model(&movies).
+			Apply(database.Published).
+			Order("rating DESC", "rating_count DESC").
+			Limit(limit).
+			Scan(ctx)
+	})
+	if err == nil {
+		err = s.localizeMovies(ctx, db, movies)
+	}
+	if err == nil {
+		err = s.loadCategories(ctx, db, movies)
+	}
+	if err != nil {
+		return nil, apperrors.E("MovieService.GetTopRatedMovies", err)
+	}
+	return movies, nil
 }
 
 func (s *MovieService) GetRecentlyAddedMovies(ctx context.Context, limit int) ([]models.Movie, error) {
+	db := s.replicas.Reader()
 	var movies []models.Movie
-	err := s.db.NewSelect().
+	err := db.NewSelect().
 		Model(&movies).
+		Apply(database.Published).
 		Order("created_at DESC").
 		Limit(limit).
 		Scan(ctx)
-	return movies, err
+	if err == nil {
+		err = s.localizeMovies(ctx, db, movies)
+	}
+	if err == nil {
+		err = s.loadCategories(ctx, db, movies)
+	}
+	if err != nil {
+		return nil, apperrors.E("MovieService.GetRecentlyAddedMovies", err)
+	}
+	return movies, nil
+}
+
+// UpcomingDay is the movies becoming available on a UTC day
+type UpcomingDay struct {
+	Day    time.Time      `json:"day"`
+	Movies []models.Movie `json:"movies"`
+}
+
+// UpcomingMovies returns the published movies whose availability window
+// opens within p, grouped by the day they become available. Days without
+// releases are left out.
+func (s *MovieService) UpcomingMovies(ctx context.Context, p Period) ([]UpcomingDay, error) {
+	db := s.replicas.Reader()
+	var movies []models.Movie
+	err := db.NewSelect().
+		Model(&movies).
+		Where("m.status = ?", models.MovieStatusPublished).
+		Where("m.available_from >= ? AND m.available_from < ?", p.From, p.end()).
+		OrderExpr("m.available_from, m.title").
+		Scan(ctx)
+	if err == nil {
+		err = s.localizeMovies(ctx, db, movies)
+	}
+	if err == nil {
+		err = s.loadCategories(ctx, db, movies)
+	}
+	if err != nil {
+		return nil, apperrors.E("MovieService.UpcomingMovies", err)
+	}
+
+	days := []UpcomingDay{}
+	for _, movie := range movies {
+		day := startOfDay(*movie.AvailableFrom)
+		if n := len(days); n == 0 || !days[n-1].Day.Equal(day) {
+			days = append(days, UpcomingDay{Day: day})
+		}
+		days[len(days)-1].Movies = append(days[len(days)-1].Movies, movie)
+	}
+	return days, nil
 }
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"database/sql"
+	"github.com/ndn/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"github.com/uptrace/bun/driver/pgdriver"
+)
+
+// newQueryDB returns a database for building queries, never connected to
+func newQueryDB(t *testing.T) *bun.DB {
+	t.Helper()
+	db := bun.NewDB(sql.OpenDB(pgdriver.NewConnector()), pgdialect.New())
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpsertMovieQueryRestoresDeletedMovies(t *testing.T) {
+	movie := &models.Movie{Title: "Alien", ExternalSource: "tmdb", ExternalID: "348"}
+	query := upsertMovieQuery(newQueryDB(t), movie).String()
+
+	_, update, ok := strings.Cut(query, "ON CONFLICT (external_source, external_id) DO UPDATE")
+	if !ok {
+		t.Fatalf("query does not update on an external ID conflict: %s", query)
+	}
+	if !strings.Contains(update, "deleted_at = NULL") {
+		t.Errorf("conflicting soft-deleted movies stay deleted: %s", query)
+	}
+}
+
+func TestApplyMovieFilterJoinsMovieCategories(t *testing.T) {
+	id := int64(3)
+	tests := []struct {
+		name   string
+		filter MovieFilter
+	}{
+		{"category ID", MovieFilter{CategoryID: &id}},
+		{"category names", MovieFilter{Categories: []string{"Drama"}}},
+		{"category slug", MovieFilter{CategorySlug: "sci-fi"}},
+		{"excluded categories", MovieFilter{ExcludeCategories: []string{"Horror"}}},
+	}
+
+	db := newQueryDB(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := db.NewSelect().Model((*models.Movie)(nil))
+			applyMovieFilter(query, tt.filter)
+			got := query.String()
+
+			if !strings.Contains(got, "FROM movie_categories AS mc WHERE mc.movie_id = m.id") {
+				t.Errorf("filter does not go through movie_categories: %s", got)
+			}
+			if strings.Contains(got, "m.categories") {
+				t.Errorf("filter reads the categories array: %s", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/i18n"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const maxTranslationTitleLength = 255
+
+var (
+	ErrInvalidLocale      = errors.New("invalid locale")
+	ErrInvalidTranslation = errors.New("translation needs a title or description")
+	// ErrTranslationNotFound is a database.ErrNotFound telling a missing
+	// translation apart from a missing movie
+	ErrTranslationNotFound = fmt.Errorf("translation %w", database.ErrNotFound)
+)
+
+// LocalizeMovies replaces the title and description of movies with their
+// translation into the most preferred locale of the request of ctx that
+// each has one for. A translation into a language serves its regional
+// variants too: es is shown when es-MX is asked for but missing.
+func (s *MovieService) LocalizeMovies(ctx context.Context, movies []models.Movie) error {
+	return s.localizeMovies(ctx, s.db, movies)
+}
+
+// localizeMovies is LocalizeMovies reading from db
+func (s *MovieService) localizeMovies(ctx context.Context, db bun.IDB, movies []models.Movie) error {
+	locales := localeCandidates(i18n.PreferencesFromContext(ctx))
+	if len(locales) == 0 || len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(movies))
+	for i := range movies {
+		ids[i] = movies[i].ID
+	}
+	var translations []models.MovieTranslation
+	err := db.NewSelect().
+		Model(&translations).
+		Where("movie_id IN (?)", bun.In(ids)).
+		Where("locale IN (?)", bun.In(locales)).
+		Scan(ctx)
+	if err != nil {
+		return apperrors.E("MovieService.LocalizeMovies", err)
+	}
+
+	rank := make(map[string]int, len(locales))
+	for i, locale := range locales {
+		rank[locale] = i
+	}
+	best := make(map[int64]*models.MovieTranslation)
+	for i := range translations {
+		t := &translations[i]
+		if current, ok := best[t.MovieID]; !ok || rank[t.Locale] < rank[current.Locale] {
+			best[t.MovieID] = t
+		}
+	}
+
+	for i := range movies {
+		t, ok := best[movies[i].ID]
+		if !ok {
+			continue
+		}
+		if t.Title != "" {
+			movies[i].Title = t.Title
+		}
+		if t.Description != "" {
+			movies[i].Description = t.Description
+		}
+	}
+	return nil
+}
+
+// localizeMovie is localizeMovies for a single movie
+func (s *MovieService) localizeMovie(ctx context.Context, db bun.IDB, movie *models.Movie) error {
+	movies := []models.Movie{*movie}
+	if err := s.localizeMovies(ctx, db, movies); err != nil {
+		return err
+	}
+	*movie = movies[0]
+	return nil
+}
+
+// ListTranslations returns the translations of a movie by locale
+func (s *MovieService) ListTranslations(ctx context.Context, movieID int64) ([]models.MovieTranslation, error) {
+	const op = "MovieService.ListTranslations"
+
+	exists, err := s.db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Where("m.id = ?", movieID).
+		Exists(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if !exists {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+
+	translations := []models.MovieTranslation{}
+	err = s.db.NewSelect().
+		Model(&translations).
+		Where("movie_id = ?", movieID).
+		Order("locale").
+		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return translations, nil
+}
+
+// PutTranslation stores the translation of a movie into its locale,
+// replacing any it has, and reports whether it was created. The locale is
+// normalised, such as pt-br to pt-BR.
+func (s *MovieService) PutTranslation(ctx context.Context, translation *models.MovieTranslation) (bool, error) {
+	const op = "MovieService.PutTranslation"
+
+	locale, ok := normalizeLanguage(translation.Locale)
+	if !ok {
+		return false, apperrors.E(op, ErrInvalidLocale)
+	}
+	translation.Locale = locale
+	translation.Title = strings.TrimSpace(translation.Title)
+	translation.Description = strings.TrimSpace(translation.Description)
+	if translation.Title == "" && translation.Description == "" {
+		return false, apperrors.E(op, ErrInvalidTranslation)
+	}
+	if len([]rune(translation.Title)) > maxTranslationTitleLength {
+		return false, apperrors.E(op, ErrInvalidTranslation)
+	}
+
+	created := false
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockMovie(ctx, tx, translation.MovieID, false); err != nil {
+			return err
+		}
+
+		var existing models.MovieTranslation
+		err := tx.NewSelect().
+			Model(&existing).
+			Column("created_at").
+			Where("movie_id = ? AND locale = ?", translation.MovieID, locale).
+			Scan(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		now := time.Now()
+		translation.UpdatedAt = now
+		if existing.CreatedAt.IsZero() {
+			created = true
+			translation.CreatedAt = now
+			_, err := tx.NewInsert().Model(translation).Exec(ctx)
+			return err
+		}
+
+		translation.CreatedAt = existing.CreatedAt
+		_, err = tx.NewUpdate().
+			Model(translation).
+			Column("title", "description", "updated_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return false, apperrors.E(op, err)
+	}
+	return created, nil
+}
+
+// DeleteTranslation deletes the translation of a movie into locale
+func (s *MovieService) DeleteTranslation(ctx context.Context, movieID int64, locale string) error {
+	const op = "MovieService.DeleteTranslation"
+
+	locale, ok := normalizeLanguage(locale)
+	if !ok {
+		return apperrors.E(op, ErrInvalidLocale)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().
+			Model((*models.MovieTranslation)(nil)).
+			Where("movie_id = ? AND locale = ?", movieID, locale).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrTranslationNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// localeCandidates lists the locales translations are looked up in for
+// language tags in order of preference: each tag, then the tags it is a
+// regional or script variant of, such as pt-BR then pt
+func localeCandidates(tags []string) []string {
+	var locales []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		locale, ok := normalizeLanguage(tag)
+		if !ok {
+			continue
+		}
+		for {
+			if !seen[locale] {
+				seen[locale] = true
+				locales = append(locales, locale)
+			}
+			i := strings.LastIndex(locale, "-")
+			if i < 0 {
+				break
+			}
+			locale = locale[:i]
+		}
+	}
+	return locales
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/notifications"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// movieNotification is the data of movie.added events
+type movieNotification struct {
+	MovieID   int64  `json:"movie_id"`
+	Title     string `json:"title"`
+	PosterURL string `json:"poster_url,omitempty"`
+}
+
+// videoNotification is the data of video.ready and video.failed events
+type videoNotification struct {
+	MovieID int64  `json:"movie_id"`
+	JobID   int64  `json:"job_id"`
+	Error   string `json:"error,omitempty"`
+}
+
+// exportNotification is the data of export.ready and export.failed events
+type exportNotification struct {
+	ExportID int64 `json:"export_id"`
+}
+
+// publishMovieAdded tells everyone about movie once tx commits, if it is
+// shown publicly already. Movies scheduled for later are not announced.
+func publishMovieAdded(ctx context.Context, hub *notifications.Hub, tx bun.IDB, movie *models.Movie) error {
+	if !shownAt(movie, time.Now()) {
+		return nil
+	}
+
+	return hub.PublishTx(ctx, tx, notifications.Everyone, notifications.EventMovieAdded, movieNotification{
+		MovieID:   movie.ID,
+		Title:     movie.Title,
+		PosterURL: movie.PosterURL,
+	})
+}
+
+// shownAt reports whether movie is shown publicly at now: published and
+// within its availability window
+func shownAt(movie *models.Movie, now time.Time) bool {
+	return movie.Status == models.MovieStatusPublished &&
+		(movie.AvailableFrom == nil || !movie.AvailableFrom.After(now)) &&
+		(movie.AvailableUntil == nil || movie.AvailableUntil.After(now))
+}
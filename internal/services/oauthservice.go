@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/metrics"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/tracecontext"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OAuth providers supported for social login
+const (
+	OAuthProviderGoogle = "google"
+	OAuthProviderGitHub = "github"
+)
+
+var (
+	ErrUnknownOAuthProvider = errors.New("unknown or disabled oauth provider")
+	ErrOAuthExchange        = errors.New("oauth provider rejected the sign in")
+	ErrOAuthEmailUnverified = errors.New("oauth account has no verified email")
+)
+
+// oauthEndpoints are the URLs of an OAuth provider and how to read the
+// signed in account from it
+type oauthEndpoints struct {
+	authURL       string
+	tokenURL      string
+	defaultScopes []string
+	identity      func(ctx context.Context, client *http.Client, accessToken string) (oauthIdentity, error)
+}
+
+var oauthProviders = map[string]oauthEndpoints{
+	OAuthProviderGoogle: {
+		authURL:       "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL:      "https://oauth2.googleapis.com/token",
+		defaultScopes: []string{"openid", "email", "profile"},
+		identity:      googleIdentity,
+	},
+	OAuthProviderGitHub: {
+		authURL:       "https://github.com/login/oauth/authorize",
+		tokenURL:      "https://github.com/login/oauth/access_token",
+		defaultScopes: []string{"read:user", "user:email"},
+		identity:      githubIdentity,
+	},
+}
+
+// oauthIdentity is the account a user signed in with at a provider
+type oauthIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type oauthProvider struct {
+	oauthEndpoints
+	cfg config.OAuthProviderConfig
+}
+
+// OAuthService logs users in with their Google or GitHub account using the
+// authorization code flow. A provider account is linked to the user with the
+// same verified email the first time it is used, creating the user if there
+// is none, and logging in issues the same tokens as a password login.
+type OAuthService struct {
+	db        *database.AuthDB
+	auth      *AuthService
+	metrics   *metrics.Metrics
+	providers map[string]oauthProvider
+	client    *http.Client
+	stateTTL  time.Duration
+}
+
+func NewOAuthService(db *database.AuthDB, auth *AuthService, m *metrics.Metrics, cfg config.OAuthConfig) *OAuthService {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	stateTTL := cfg.StateTTL
+	if stateTTL <= 0 {
+		stateTTL = 10 * time.Minute
+	}
+
+	providers := make(map[string]oauthProvider)
+	for name, providerCfg := range cfg.Providers {
+		endpoints, ok := oauthProviders[name]
+		if !ok || providerCfg.ClientID == "" {
+			continue
+		}
+		providers[name] = oauthProvider{oauthEndpoints: endpoints, cfg: providerCfg}
+	}
+
+	return &OAuthService{
+		db:        db,
+		auth:      auth,
+		metrics:   m,
+		providers: providers,
+		client:    tracecontext.NewClient(&http.Client{Timeout: timeout}),
+		stateTTL:  stateTTL,
+	}
+}
+
+// StateTTL is how long the state of a sign in started with AuthURL is valid
+func (s *OAuthService) StateTTL() time.Duration {
+	return s.stateTTL
+}
+
+// AuthURL starts a sign in with provider, returning the URL to send the user
+// to and the random state the callback must carry back. The caller keeps
+// state, e.g. in a cookie, to check it in the callback.
+func (s *OAuthService) AuthURL(provider string) (authURL, state string, err error) {
+	const op = "OAuthService.AuthURL"
+
+	p, ok := s.providers[provider]
+	if !ok {
+		return "", "", ErrUnknownOAuthProvider
+	}
+
+	state, err = randomHex(16)
+	if err != nil {
+		return "", "", apperrors.Errorf(op, "failed to generate state: %w", err)
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = p.defaultScopes
+	}
+	params := url.Values{
+		"response_type": {"code"},
+		"client_id":     {p.cfg.ClientID},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+	}
+	return p.authURL + "?" + params.Encode(), state, nil
+}
+
+// Callback completes a sign in with provider by exchanging code for the
+// user's account there and logging in the user linked to it, on the device
+// with userAgent
+func (s *OAuthService) Callback(ctx context.Context, provider, code, userAgent string) (*AuthResponse, error) {
+	const op = "OAuthService.Callback"
+
+	p, ok := s.providers[provider]
+	if !ok {
+		return nil, ErrUnknownOAuthProvider
+	}
+
+	accessToken, err := s.exchange(ctx, p, code)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	identity, err := p.identity(ctx, s.client, accessToken)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	user, err := s.linkedUser(ctx, provider, identity)
+	if errors.Is(err, ErrOAuthEmailUnverified) {
+		s.metrics.Login(metrics.LoginOAuth, false)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	s.metrics.Login(metrics.LoginOAuth, true)
+
+	resp, err := s.auth.issueTokens(ctx, user, "", 0, userAgent)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return resp, nil
+}
+
+// linkedUser returns the user linked to identity, linking it first to the
+// user with its email or to a new user. Only verified emails are linked, so
+// nobody can take over an account by claiming its email at a provider.
+func (s *OAuthService) linkedUser(ctx context.Context, provider string, identity oauthIdentity) (*models.User, error) {
+	user, err := s.db.GetUserByIdentity(ctx, provider, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrOAuthEmailUnverified
+	}
+
+	// New users have a random password until they set one with a reset
+	password, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := s.auth.hasher.Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	name := identity.Name
+	if name == "" {
+		name = strings.SplitN(identity.Email, "@", 2)[0]
+	}
+
+	newUser := &models.User{
+		Email:    identity.Email,
+		Password: hashedPassword,
+		Name:     name,
+	}
+	user, err = s.db.LinkIdentity(ctx, &models.UserIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}, newUser)
+	if err != nil {
+		return nil, err
+	}
+	if user == newUser {
+		s.metrics.Registration()
+	}
+	return user, nil
+}
+
+// exchange trades an authorization code for an access token at the provider
+func (s *OAuthService) exchange(ctx context.Context, p oauthProvider, code string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode token response with status %d: %w", resp.StatusCode, err)
+	}
+	// GitHub reports errors with status 200
+	if resp.StatusCode != http.StatusOK || token.Error != "" || token.AccessToken == "" {
+		return "", fmt.Errorf("%w: %s %s", ErrOAuthExchange, token.Error, token.ErrorDescription)
+	}
+	return token.AccessToken, nil
+}
+
+// oauthGet fetches endpoint of a provider API with accessToken and decodes
+// the JSON response into result
+func oauthGet(ctx context.Context, client *http.Client, endpoint, accessToken string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %d", ErrOAuthExchange, endpoint, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", endpoint, err)
+	}
+	return nil
+}
+
+func googleIdentity(ctx context.Context, client *http.Client, accessToken string) (oauthIdentity, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := oauthGet(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", accessToken, &info); err != nil {
+		return oauthIdentity{}, err
+	}
+	if info.Sub == "" {
+		return oauthIdentity{}, fmt.Errorf("%w: google returned no account ID", ErrOAuthExchange)
+	}
+	return oauthIdentity{
+		Subject:       info.Sub,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+		Name:          info.Name,
+	}, nil
+}
+
+func githubIdentity(ctx context.Context, client *http.Client, accessToken string) (oauthIdentity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+	}
+	if err := oauthGet(ctx, client, "https://api.github.com/user", accessToken, &user); err != nil {
+		return oauthIdentity{}, err
+	}
+	if user.ID == 0 {
+		return oauthIdentity{}, fmt.Errorf("%w: github returned no account ID", ErrOAuthExchange)
+	}
+
+	// The public profile email may be unverified, so use the primary
+	// verified one
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := oauthGet(ctx, client, "https://api.github.com/user/emails", accessToken, &emails); err != nil {
+		return oauthIdentity{}, err
+	}
+
+	identity := oauthIdentity{Subject: strconv.FormatInt(user.ID, 10), Name: user.Name}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			identity.Email = email.Email
+			identity.EmailVerified = true
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// Argon2id parameters when not configured, as recommended by OWASP
+const (
+	defaultArgon2Time       = 2
+	defaultArgon2Memory     = 19 * 1024
+	defaultArgon2Threads    = 1
+	defaultArgon2KeyLength  = 32
+	defaultArgon2SaltLength = 16
+)
+
+var errUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords with the configured algorithm and checks
+// them against hashes made by any supported one
+type PasswordHasher interface {
+	// Hash returns the encoded hash of password
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash
+	Verify(hash, password string) bool
+	// NeedsRehash reports whether hash was made by another algorithm, or
+	// with other parameters, than Hash uses
+	NeedsRehash(hash string) bool
+}
+
+// NewPasswordHasher returns the hasher of cfg, hashing with bcrypt unless
+// argon2id is configured
+func NewPasswordHasher(cfg config.PasswordConfig) (PasswordHasher, error) {
+	h := &passwordHasher{
+		bcrypt:   &bcryptHasher{cost: cfg.BcryptCost},
+		argon2id: newArgon2idHasher(cfg.Argon2),
+	}
+	if h.bcrypt.cost == 0 {
+		h.bcrypt.cost = bcrypt.DefaultCost
+	}
+
+	switch cfg.Algorithm {
+	case "", HashBcrypt:
+		h.current = h.bcrypt
+	case HashArgon2id:
+		h.current = h.argon2id
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+	return h, nil
+}
+
+// passwordHasher hashes with the current algorithm and verifies hashes with
+// the algorithm their format tells
+type passwordHasher struct {
+	current  PasswordHasher
+	bcrypt   *bcryptHasher
+	argon2id *argon2idHasher
+}
+
+func (h *passwordHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *passwordHasher) Verify(hash, password string) bool {
+	hasher, err := h.hasherOf(hash)
+	if err != nil {
+		return false
+	}
+	return hasher.Verify(hash, password)
+}
+
+func (h *passwordHasher) NeedsRehash(hash string) bool {
+	hasher, err := h.hasherOf(hash)
+	if err != nil || hasher != h.current {
+		return true
+	}
+	return hasher.NeedsRehash(hash)
+}
+
+func (h *passwordHasher) hasherOf(hash string) (PasswordHasher, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		return h.argon2id, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return h.bcrypt, nil
+	}
+	return nil, errUnknownPasswordHash
+}
+
+// bcryptHasher hashes with bcrypt at cost
+type bcryptHasher struct {
+	cost int
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	return string(hash), err
+}
+
+func (h *bcryptHasher) Verify(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != h.cost
+}
+
+// argon2idHasher hashes with Argon2id, encoding hashes in the PHC string
+// format, e.g. $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type argon2idHasher struct {
+	time       uint32
+	memory     uint32
+	threads    uint8
+	keyLength  uint32
+	saltLength uint32
+}
+
+func newArgon2idHasher(cfg config.Argon2Config) *argon2idHasher {
+	h := &argon2idHasher{
+		time:       cfg.Time,
+		memory:     cfg.Memory,
+		threads:    cfg.Threads,
+		keyLength:  cfg.KeyLength,
+		saltLength: cfg.SaltLength,
+	}
+	if h.time == 0 {
+		h.time = defaultArgon2Time
+	}
+	if h.memory == 0 {
+		h.memory = defaultArgon2Memory
+	}
+	if h.threads == 0 {
+		h.threads = defaultArgon2Threads
+	}
+	if h.keyLength == 0 {
+		h.keyLength = defaultArgon2KeyLength
+	}
+	if h.saltLength == 0 {
+		h.saltLength = defaultArgon2SaltLength
+	}
+	return h
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(hash, password string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := parseArgon2id(hash)
+	return err != nil || params.time != h.time || params.memory != h.memory || params.threads != h.threads ||
+		uint32(len(salt)) != h.saltLength || uint32(len(key)) != h.keyLength
+}
+
+// parseArgon2id decodes the parameters, salt and key of an Argon2id hash
+func parseArgon2id(hash string) (*argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+	params := new(argon2idHasher)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+	return params, salt, key, nil
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"github.com/ndn/internal/config"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters, so tests do not spend time hashing
+var (
+	testBcryptCost = bcrypt.MinCost
+	testArgon2     = config.Argon2Config{Time: 1, Memory: 64, Threads: 1}
+)
+
+func newTestHasher(t *testing.T, algorithm string) PasswordHasher {
+	t.Helper()
+	h, err := NewPasswordHasher(config.PasswordConfig{
+		Algorithm:  algorithm,
+		BcryptCost: testBcryptCost,
+		Argon2:     testArgon2,
+	})
+	if err != nil {
+		t.Fatalf("NewPasswordHasher(%q): %v", algorithm, err)
+	}
+	return h
+}
+
+func TestPasswordHasher(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		prefix    string
+	}{
+		{"default", "", "$2a$"},
+		{"bcrypt", HashBcrypt, "$2a$"},
+		{"argon2id", HashArgon2id, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHasher(t, tt.algorithm)
+			hash, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash %q does not start with %q", hash, tt.prefix)
+			}
+			if !h.Verify(hash, "correct horse") {
+				t.Error("password does not match its hash")
+			}
+			if h.Verify(hash, "correct horsE") {
+				t.Error("another password matches the hash")
+			}
+			if h.NeedsRehash(hash) {
+				t.Error("fresh hash needs rehashing")
+			}
+
+			again, err := h.Hash("correct horse")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if again == hash {
+				t.Error("hashes of the same password share a salt")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherMigratesAlgorithms(t *testing.T) {
+	hashers := map[string]PasswordHasher{
+		HashBcrypt:   newTestHasher(t, HashBcrypt),
+		HashArgon2id: newTestHasher(t, HashArgon2id),
+	}
+
+	for from, old := range hashers {
+		for to, current := range hashers {
+			if from == to {
+				continue
+			}
+			t.Run(from+" to "+to, func(t *testing.T) {
+				hash, err := old.Hash("s3cret!")
+				if err != nil {
+					t.Fatalf("Hash: %v", err)
+				}
+				if !current.Verify(hash, "s3cret!") {
+					t.Errorf("%s hasher does not verify %s hashes", to, from)
+				}
+				if !current.NeedsRehash(hash) {
+					t.Errorf("%s hash does not need rehashing with %s", from, to)
+				}
+			})
+		}
+	}
+}
+
+func TestPasswordHasherNeedsRehashOnNewParameters(t *testing.T) {
+	tests := []struct {
+		name string
+		old  config.PasswordConfig
+		cfg  config.PasswordConfig
+	}{
+		{
+			name: "bcrypt cost",
+			old:  config.PasswordConfig{Algorithm: HashBcrypt, BcryptCost: testBcryptCost},
+			cfg:  config.PasswordConfig{Algorithm: HashBcrypt, BcryptCost: testBcryptCost + 1},
+		},
+		{
+			name: "argon2id memory",
+			old:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: testArgon2},
+			cfg:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: config.Argon2Config{Time: 1, Memory: 128, Threads: 1}},
+		},
+		{
+			name: "argon2id time",
+			old:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: testArgon2},
+			cfg:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: config.Argon2Config{Time: 2, Memory: 64, Threads: 1}},
+		},
+		{
+			name: "argon2id key length",
+			old:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: testArgon2},
+			cfg:  config.PasswordConfig{Algorithm: HashArgon2id, Argon2: config.Argon2Config{Time: 1, Memory: 64, Threads: 1, KeyLength: 64}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, err := NewPasswordHasher(tt.old)
+			if err != nil {
+				t.Fatalf("NewPasswordHasher: %v", err)
+			}
+			current, err := NewPasswordHasher(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewPasswordHasher: %v", err)
+			}
+
+			hash, err := old.Hash("s3cret!")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !current.Verify(hash, "s3cret!") {
+				t.Error("hash made with other parameters does not verify")
+			}
+			if !current.NeedsRehash(hash) {
+				t.Error("hash made with other parameters does not need rehashing")
+			}
+		})
+	}
+}
+
+func TestPasswordHasherRejectsUnknownHashes(t *testing.T) {
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{"empty", ""},
+		{"plain text", "s3cret!"},
+		{"unknown algorithm", "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"unknown version", "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad parameters", "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5"},
+		{"bad salt", "$argon2id$v=19$m=64,t=1,p=1$!!$a2V5a2V5"},
+		{"missing key", "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$"},
+		{"truncated bcrypt", "$2a$04$abc"},
+	}
+
+	for _, algorithm := range []string{HashBcrypt, HashArgon2id} {
+		h := newTestHasher(t, algorithm)
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				if h.Verify(tt.hash, "s3cret!") {
+					t.Error("password matches an invalid hash")
+				}
+				if !h.NeedsRehash(tt.hash) {
+					t.Error("invalid hash does not need rehashing")
+				}
+			})
+		}
+	}
+}
+
+func TestNewPasswordHasherUnknownAlgorithm(t *testing.T) {
+	if _, err := NewPasswordHasher(config.PasswordConfig{Algorithm: "md5"}); err == nil {
+		t.Error("unknown algorithm accepted")
+	}
+}
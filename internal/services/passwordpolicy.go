@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/config"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password length limits when not configured. bcrypt ignores what follows
+// the first 72 bytes.
+const (
+	defaultMinPasswordLength = 8
+	defaultMaxPasswordLength = 72
+)
+
+var (
+	ErrPasswordTooLong = errors.New("password too long")
+	// ErrPasswordTooWeak is the error a *WeakPasswordError wraps
+	ErrPasswordTooWeak = errors.New("password too weak")
+)
+
+// Character classes a password policy may require
+const (
+	PasswordUpper  = "uppercase"
+	PasswordLower  = "lowercase"
+	PasswordDigit  = "digit"
+	PasswordSymbol = "symbol"
+)
+
+// WeakPasswordError is the ErrPasswordTooWeak of a password lacking the
+// character classes in Missing
+type WeakPasswordError struct {
+	Missing []string
+}
+
+func (e *WeakPasswordError) Error() string {
+	return fmt.Sprintf("%s: missing %s", ErrPasswordTooWeak, strings.Join(e.Missing, ", "))
+}
+
+func (e *WeakPasswordError) Unwrap() error {
+	return ErrPasswordTooWeak
+}
+
+// PasswordPolicy returns what new passwords must be
+func (s *AuthService) PasswordPolicy() config.PasswordPolicy {
+	return s.policy
+}
+
+// checkPassword returns ErrPasswordTooShort, ErrPasswordTooLong or a
+// *WeakPasswordError when password does not meet policy
+func checkPassword(policy config.PasswordPolicy, password string) error {
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > policy.MaxLength {
+		return ErrPasswordTooLong
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, PasswordUpper)
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, PasswordLower)
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, PasswordDigit)
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, PasswordSymbol)
+	}
+	if len(missing) > 0 {
+		return &WeakPasswordError{Missing: missing}
+	}
+	return nil
+}
+
+// passwordPolicy fills in the lengths cfg leaves unset
+func passwordPolicy(cfg config.PasswordPolicy) config.PasswordPolicy {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = defaultMinPasswordLength
+	}
+	if cfg.MaxLength <= 0 {
+		cfg.MaxLength = defaultMaxPasswordLength
+	}
+	return cfg
+}
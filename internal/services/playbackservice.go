@@ -0,0 +1,707 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/entitlements"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/playback"
+	"github.com/ndn/internal/tracecontext"
+	"github.com/ndn/internal/transcode"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	defaultPlaybackTTL = 4 * time.Hour
+	defaultDownloadTTL = 48 * time.Hour
+	defaultStreamIdle  = 2 * time.Minute
+
+	// streamRenewal spaces out the writes marking a stream as active
+	streamRenewal = 15 * time.Second
+	// maxPlaylistSize caps the size of master playlists read to drop the
+	// variants above a token's quality
+	maxPlaylistSize = 1 << 20
+)
+
+var (
+	ErrPlaybackDisabled    = errors.New("playback signing key is not configured")
+	ErrNoVideo             = errors.New("movie has no video")
+	ErrInvalidPlaybackFile = errors.New("invalid playback file")
+	ErrVideoUnavailable    = errors.New("video storage is unavailable")
+	ErrLocalVideo          = errors.New("local videos are streamed by movie ID")
+	ErrNotLocalVideo       = errors.New("movie video is not a local file")
+	ErrLocalVideosDisabled = errors.New("local video directory is not configured")
+	ErrVideoFileNotFound   = errors.New("video file not found")
+	ErrTooManyStreams      = errors.New("too many concurrent streams")
+	ErrQualityNotInPlan    = errors.New("rendition above the quality of the plan")
+	// ErrStreamNotFound is a database.ErrNotFound for streams that ended or
+	// belong to another user
+	ErrStreamNotFound = fmt.Errorf("stream %w", database.ErrNotFound)
+	// ErrStreamEnded is returned for playback tokens of streams that were
+	// replaced or ended before the tokens expired
+	ErrStreamEnded = errors.New("stream has ended")
+	// ErrNoActiveStream is returned to signed-in users streaming a local
+	// video without a token when they play no stream of it
+	ErrNoActiveStream = errors.New("no active stream of the movie")
+)
+
+// StreamLimitError is returned by Play when the user already plays as many
+// videos at once as their plan allows. Streams are the ones playing.
+type StreamLimitError struct {
+	Max     int
+	Streams []models.PlaybackSession
+}
+
+func (e *StreamLimitError) Error() string {
+	return fmt.Sprintf("%s: %d of %d", ErrTooManyStreams, len(e.Streams), e.Max)
+}
+
+func (e *StreamLimitError) Unwrap() error {
+	return ErrTooManyStreams
+}
+
+// Device is the player a stream is started on. ID is an identifier the
+// client keeps for the device, and Name a label the user recognizes it by,
+// such as "Living room TV"; both are optional.
+type Device struct {
+	ID   string
+	Name string
+}
+
+// forwardedHeaders are the request headers of players passed on when
+// streaming, so they can seek and revalidate
+var forwardedHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// Playback is a signed URL the video of a movie can be played from until
+// it expires. MaxHeight is the tallest HLS rendition it streams, zero for
+// any. Streams have a SessionID, which players send a heartbeat for every
+// HeartbeatInterval seconds while playing.
+type Playback struct {
+	URL               string    `json:"url" example:"https://api.example.com/api/stream/42.1767225600.9f86d081884c7d65/master.m3u8"`
+	Token             string    `json:"token" example:"42.1767225600.9f86d081884c7d65"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	MaxHeight         int       `json:"max_height,omitempty" example:"1080"`
+	SessionID         string    `json:"session_id,omitempty" example:"5d41402abc4b2a76b9719d911017c592"`
+	HeartbeatInterval int       `json:"heartbeat_interval,omitempty" example:"30"`
+}
+
+// PlaybackService issues signed, expiring playback URLs, so the VideoURL of
+// movies is never handed out, and streams the videos they grant access to.
+// A playback URL carries its token as a path segment before the file name,
+// so the playlists and segments an HLS player resolves relative to it carry
+// the token too.
+//
+// URLs follow the entitlements in the context they are issued in: their
+// token caps the HLS renditions they stream to the plan's maximum height.
+// Streams are tracked as playback sessions while their players send
+// heartbeats or fetch from the API, and count against the plan's
+// concurrent streams until they go idle.
+type PlaybackService struct {
+	db         *bun.DB
+	movies     *MovieService
+	client     *http.Client
+	key        []byte
+	cfg        config.PlaybackConfig
+	renditions []config.RenditionConfig
+	now        func() time.Time
+}
+
+// NewPlaybackService signs URLs with key. Without a key playback is
+// disabled. renditions are the ones videos are transcoded into, whose
+// heights quality caps are checked against.
+func NewPlaybackService(db *bun.DB, movies *MovieService, key string, cfg config.PlaybackConfig, renditions []config.RenditionConfig) *PlaybackService {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultPlaybackTTL
+	}
+	if cfg.DownloadTTL <= 0 {
+		cfg.DownloadTTL = defaultDownloadTTL
+	}
+	if cfg.StreamIdle <= 0 {
+		cfg.StreamIdle = defaultStreamIdle
+	}
+	if len(renditions) == 0 {
+		renditions = transcode.DefaultRenditions
+	}
+
+	return &PlaybackService{
+		db:     db,
+		movies: movies,
+		// Streams are bounded by the request context, not a client timeout
+		client:     tracecontext.NewClient(nil),
+		key:        []byte(key),
+		cfg:        cfg,
+		renditions: renditions,
+		now:        time.Now,
+	}
+}
+
+// StreamTimeout bounds a single streamed response, zero for no bound
+func (s *PlaybackService) StreamTimeout() time.Duration {
+	return s.cfg.StreamTimeout
+}
+
+// Play issues a playback URL for the video of a published movie and starts
+// a stream of it on device. streamURL is the API's stream route, used
+// unless a CDN is configured. Users already playing as many videos as
+// their plan allows get a StreamLimitError.
+func (s *PlaybackService) Play(ctx context.Context, movieID int64, streamURL string, device Device) (*Playback, error) {
+	const op = "PlaybackService.Play"
+
+	play, err := s.issue(ctx, movieID, streamURL, s.cfg.TTL, &device)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return play, nil
+}
+
+// Download issues a URL the video of a published movie can be downloaded
+// from, like Play but valid for DownloadTTL, so players can keep the video
+// to watch offline. Downloads do not count as streams. Callers check the
+// user's plan includes downloads.
+func (s *PlaybackService) Download(ctx context.Context, movieID int64, streamURL string) (*Playback, error) {
+	const op = "PlaybackService.Download"
+
+	play, err := s.issue(ctx, movieID, streamURL, s.cfg.DownloadTTL, nil)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return play, nil
+}
+
+// issue signs a URL for the video of movieID valid for ttl, capped to the
+// entitlements in ctx, and starts a stream of it on device, unless it is
+// nil
+func (s *PlaybackService) issue(ctx context.Context, movieID int64, streamURL string, ttl time.Duration, device *Device) (*Playback, error) {
+	if len(s.key) == 0 {
+		return nil, ErrPlaybackDisabled
+	}
+	movie, err := s.movies.GetPublishedMovie(ctx, movieID)
+	if err != nil {
+		return nil, err
+	}
+	if movie.VideoURL == "" {
+		return nil, ErrNoVideo
+	}
+
+	grant := playback.Grant{MovieID: movie.ID}
+	e, ok := entitlements.FromContext(ctx)
+	if ok {
+		grant.MaxHeight = e.MaxHeight
+	}
+	expires := s.now().Add(ttl).Truncate(time.Second)
+	token := playback.SignGrant(s.key, grant, expires)
+
+	play := &Playback{Token: token, ExpiresAt: expires}
+	if userID := UserIDFromContext(ctx); device != nil && userID != 0 {
+		session := &models.PlaybackSession{
+			ID:        streamID(token),
+			UserID:    userID,
+			MovieID:   movie.ID,
+			DeviceID:  strings.TrimSpace(device.ID),
+			Device:    strings.TrimSpace(device.Name),
+			ExpiresAt: expires,
+		}
+		if err := s.startStream(ctx, session, e.MaxStreams); err != nil {
+			return nil, err
+		}
+		play.SessionID = session.ID
+		play.HeartbeatInterval = int((s.cfg.StreamIdle / 4).Seconds())
+	}
+
+	// Local files are only reachable through the API
+	if playback.IsLocal(movie.VideoURL) {
+		play.URL = fmt.Sprintf("%s/%d?token=%s", strings.TrimSuffix(streamURL, "/"), movie.ID, token)
+		return play, nil
+	}
+
+	base := streamURL
+	if s.cfg.BaseURL != "" {
+		base = s.cfg.BaseURL
+	}
+	play.URL = strings.TrimSuffix(base, "/") + "/" + token + "/" + videoName(movie.VideoURL)
+	play.MaxHeight = grant.MaxHeight
+	return play, nil
+}
+
+// ListStreams returns the streams userID is playing, oldest first
+func (s *PlaybackService) ListStreams(ctx context.Context, userID int64) ([]models.PlaybackSession, error) {
+	const op = "PlaybackService.ListStreams"
+
+	streams, err := s.activeStreams(ctx, s.db, userID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return streams, nil
+}
+
+// Heartbeat keeps the stream of userID with id active. Players send one
+// every HeartbeatInterval of their Playback while playing, so streams
+// served by a CDN stay counted; once it fails with ErrStreamNotFound, the
+// stream has ended and the player stops.
+func (s *PlaybackService) Heartbeat(ctx context.Context, userID int64, id string) error {
+	const op = "PlaybackService.Heartbeat"
+
+	now := s.now()
+	res, err := s.db.NewUpdate().
+		Model((*models.PlaybackSession)(nil)).
+		Set("last_seen_at = ?", now).
+		Where("id = ? AND user_id = ?", id, userID).
+		Where("last_seen_at > ? AND expires_at > ?", now.Add(-s.cfg.StreamIdle), now).
+		Exec(ctx)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return apperrors.E(op, ErrStreamNotFound)
+	}
+	return nil
+}
+
+// EndStream ends the stream of userID with id, so it no longer counts
+// against their plan's concurrent streams and its token is refused. Its
+// player stops at its next heartbeat.
+func (s *PlaybackService) EndStream(ctx context.Context, userID int64, id string) error {
+	const op = "PlaybackService.EndStream"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		n, err := s.endStreams(ctx, tx, func(q *bun.DeleteQuery) *bun.DeleteQuery {
+			return q.Where("id = ? AND user_id = ?", id, userID)
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrStreamNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// endStreams deletes the sessions where selects, recording the ones whose
+// token has not expired as ended so their tokens are refused, and returns
+// how many it deleted
+func (s *PlaybackService) endStreams(ctx context.Context, tx bun.Tx, where func(*bun.DeleteQuery) *bun.DeleteQuery) (int, error) {
+	var removed []models.PlaybackSession
+	err := tx.NewDelete().
+		Model(&removed).
+		Apply(where).
+		Returning("id, expires_at").
+		Scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := s.now()
+	ended := make([]models.EndedStream, 0, len(removed))
+	for _, session := range removed {
+		if session.ExpiresAt.After(now) {
+			ended = append(ended, models.EndedStream{ID: session.ID, ExpiresAt: session.ExpiresAt})
+		}
+	}
+	if len(ended) > 0 {
+		_, err = tx.NewInsert().
+			Model(&ended).
+			On("CONFLICT (id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), nil
+}
+
+// Open verifies token and fetches file from where the video it grants
+// access to is stored: the video itself, or a playlist or segment next to
+// it. header carries the player's request headers. Tokens capped to a
+// height get master playlists without the variants above it, and no
+// renditions above it. The caller closes the response body.
+func (s *PlaybackService) Open(ctx context.Context, token, file string, header http.Header) (*http.Response, error) {
+	const op = "PlaybackService.Open"
+
+	if len(s.key) == 0 {
+		return nil, apperrors.E(op, ErrPlaybackDisabled)
+	}
+	grant, err := playback.Verify(s.key, token, s.now())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.touchStream(ctx, streamID(token)); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	// Tokens stop working once a movie is no longer shown publicly
+	movie, err := s.movies.GetPublishedMovie(ctx, grant.MovieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if movie.VideoURL == "" {
+		return nil, apperrors.E(op, ErrNoVideo)
+	}
+	if playback.IsLocal(movie.VideoURL) {
+		return nil, apperrors.E(op, ErrLocalVideo)
+	}
+	target, err := videoFile(movie.VideoURL, file)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if grant.MaxHeight > 0 && s.renditionHeight(file) > grant.MaxHeight {
+		return nil, apperrors.E(op, ErrQualityNotInPlan)
+	}
+	// Capped master playlists are rewritten, so they are fetched whole
+	capped := grant.MaxHeight > 0 && isMasterPlaylist(movie.VideoURL, file)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if !capped {
+		for _, name := range forwardedHeaders {
+			if value := header.Get(name); value != "" {
+				req.Header.Set(name, value)
+			}
+		}
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, apperrors.E(op, fmt.Errorf("%w: %w", ErrVideoUnavailable, err))
+	}
+	if capped && resp.StatusCode == http.StatusOK {
+		resp, err = s.capPlaylist(resp, grant.MaxHeight)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+	}
+	return resp, nil
+}
+
+// OpenLocal opens the local video file of a published movie, for callers
+// holding a playback token of the movie or, without one, signed-in users
+// playing a stream of it. Either way the stream is kept active, and refused
+// once it has ended. The caller closes the file.
+func (s *PlaybackService) OpenLocal(ctx context.Context, movieID int64, token string) (*os.File, error) {
+	const op = "PlaybackService.OpenLocal"
+
+	if len(s.key) == 0 {
+		return nil, apperrors.E(op, ErrPlaybackDisabled)
+	}
+	var stream string
+	if userID := UserIDFromContext(ctx); token == "" && userID != 0 {
+		id, err := s.activeStream(ctx, userID, movieID)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		stream = id
+	} else {
+		grant, err := playback.Verify(s.key, token, s.now())
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if grant.MovieID != movieID {
+			return nil, apperrors.E(op, playback.ErrInvalidToken)
+		}
+		stream = streamID(token)
+	}
+	if err := s.touchStream(ctx, stream); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	movie, err := s.movies.GetPublishedMovie(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if !playback.IsLocal(movie.VideoURL) {
+		return nil, apperrors.E(op, ErrNotLocalVideo)
+	}
+	if s.cfg.LocalDir == "" {
+		return nil, apperrors.E(op, ErrLocalVideosDisabled)
+	}
+	name, err := playback.LocalPath(movie.VideoURL)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	f, err := os.Open(filepath.Join(s.cfg.LocalDir, filepath.FromSlash(name)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, apperrors.E(op, ErrVideoFileNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return f, nil
+}
+
+// startStream records session, unless its user already plays maxStreams
+// videos, zero being no limit. Streams idle for StreamIdle have ended, and
+// an earlier stream on the same device is replaced, its token refused from
+// then on, so players restarting or switching videos do not count twice.
+func (s *PlaybackService) startStream(ctx context.Context, session *models.PlaybackSession, maxStreams int) error {
+	now := s.now()
+	return runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the user, so concurrent plays cannot exceed the limit
+		_, err := tx.NewSelect().
+			Model((*models.User)(nil)).
+			Column("id").
+			Where("id = ?", session.UserID).
+			For("UPDATE").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.endStreams(ctx, tx, func(q *bun.DeleteQuery) *bun.DeleteQuery {
+			return q.Where("user_id = ?", session.UserID).
+				WhereGroup(" AND ", func(q *bun.DeleteQuery) *bun.DeleteQuery {
+					q = q.Where("last_seen_at <= ?", now.Add(-s.cfg.StreamIdle)).
+						WhereOr("expires_at <= ?", now)
+					if session.DeviceID != "" {
+						q = q.WhereOr("device_id = ?", session.DeviceID)
+					}
+					return q
+				})
+		})
+		if err != nil {
+			return err
+		}
+		// Tokens of ended streams are refused only until they expire
+		_, err = tx.NewDelete().
+			Model((*models.EndedStream)(nil)).
+			Where("expires_at <= ?", now).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		if maxStreams > 0 {
+			streams, err := s.activeStreams(ctx, tx, session.UserID)
+			if err != nil {
+				return err
+			}
+			if len(streams) >= maxStreams {
+				return &StreamLimitError{Max: maxStreams, Streams: streams}
+			}
+		}
+
+		session.StartedAt = now
+		session.LastSeenAt = now
+		_, err = tx.NewInsert().Model(session).Exec(ctx)
+		return err
+	})
+}
+
+// activeStreams returns the streams of userID that have not gone idle or
+// expired, oldest first
+func (s *PlaybackService) activeStreams(ctx context.Context, db bun.IDB, userID int64) ([]models.PlaybackSession, error) {
+	now := s.now()
+	streams := make([]models.PlaybackSession, 0)
+	err := db.NewSelect().
+		Model(&streams).
+		Where("user_id = ?", userID).
+		Where("last_seen_at > ? AND expires_at > ?", now.Add(-s.cfg.StreamIdle), now).
+		Order("started_at").
+		Scan(ctx)
+	return streams, err
+}
+
+// activeStream returns the ID of the latest stream of movieID userID plays,
+// or ErrNoActiveStream
+func (s *PlaybackService) activeStream(ctx context.Context, userID, movieID int64) (string, error) {
+	now := s.now()
+	var id string
+	err := s.db.NewSelect().
+		Model((*models.PlaybackSession)(nil)).
+		Column("id").
+		Where("user_id = ? AND movie_id = ?", userID, movieID).
+		Where("last_seen_at > ? AND expires_at > ?", now.Add(-s.cfg.StreamIdle), now).
+		OrderExpr("started_at DESC").
+		Limit(1).
+		Scan(ctx, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNoActiveStream
+	}
+	return id, err
+}
+
+// touchStream keeps the stream with id, if it is tracked, active, and fails
+// with ErrStreamEnded once the stream was replaced or ended
+func (s *PlaybackService) touchStream(ctx context.Context, id string) error {
+	ended, err := s.db.NewSelect().
+		Model((*models.EndedStream)(nil)).
+		Where("id = ?", id).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if ended {
+		return ErrStreamEnded
+	}
+
+	now := s.now()
+	_, err = s.db.NewUpdate().
+		Model((*models.PlaybackSession)(nil)).
+		Set("last_seen_at = ?", now).
+		Where("id = ? AND last_seen_at < ?", id, now.Add(-streamRenewal)).
+		Exec(ctx)
+	return err
+}
+
+// streamID identifies the stream of token without storing the token
+func streamID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// renditionHeight is the height of the rendition file belongs to, zero for
+// files outside the directory of a known rendition
+func (s *PlaybackService) renditionHeight(file string) int {
+	dir, _, ok := strings.Cut(file, "/")
+	if !ok {
+		return 0
+	}
+	for _, r := range s.renditions {
+		if r.Name == dir {
+			return r.Height
+		}
+	}
+	return 0
+}
+
+// capPlaylist replaces the body of resp, an HLS master playlist, with one
+// without the variants taller than maxHeight
+func (s *PlaybackService) capPlaylist(resp *http.Response, maxHeight int) (*http.Response, error) {
+	defer resp.Body.Close()
+
+	playlist, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrVideoUnavailable, err)
+	}
+	if len(playlist) > maxPlaylistSize {
+		return nil, fmt.Errorf("%w: master playlist is too large", ErrVideoUnavailable)
+	}
+	body := s.dropVariants(string(playlist), maxHeight)
+
+	header := resp.Header.Clone()
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	// The body differs from the stored playlist
+	header.Del("ETag")
+	header.Del("Last-Modified")
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader([]byte(body))),
+		ContentLength: int64(len(body)),
+	}, nil
+}
+
+// dropVariants removes the variants of a master playlist taller than
+// maxHeight: those whose RESOLUTION says so or, without one, whose URI is
+// in the directory of a taller rendition
+func (s *PlaybackService) dropVariants(playlist string, maxHeight int) string {
+	lines := strings.Split(playlist, "\n")
+	kept := make([]string, 0, len(lines))
+	// The tags of the variant being read, up to its URI
+	var variant []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#EXT-X-STREAM-INF:"):
+			variant = []string{line}
+		case variant == nil:
+			kept = append(kept, line)
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			variant = append(variant, line)
+		default:
+			height := variantHeight(variant[0])
+			if height == 0 {
+				height = s.renditionHeight(trimmed)
+			}
+			if height <= maxHeight {
+				kept = append(kept, variant...)
+				kept = append(kept, line)
+			}
+			variant = nil
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// variantHeight is the height of the RESOLUTION attribute of an
+// EXT-X-STREAM-INF tag, zero when it has none
+func variantHeight(tag string) int {
+	_, attrs, _ := strings.Cut(tag, ":")
+	for _, attr := range strings.Split(attrs, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		if name != "RESOLUTION" {
+			continue
+		}
+		_, height, _ := strings.Cut(value, "x")
+		n, _ := strconv.Atoi(height)
+		return n
+	}
+	return 0
+}
+
+// isMasterPlaylist reports whether file is the video at videoURL itself,
+// and it is an HLS playlist
+func isMasterPlaylist(videoURL, file string) bool {
+	name := videoName(videoURL)
+	return (file == "" || file == name) && strings.HasSuffix(strings.ToLower(name), ".m3u8")
+}
+
+// videoName is the file name of the video at videoURL, such as
+// master.m3u8
+func videoName(videoURL string) string {
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return "video"
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "video"
+	}
+	return name
+}
+
+// videoFile resolves file against the video at videoURL. The video's own
+// name, or no name, is the video itself; anything else must lie in or
+// below the directory of the video.
+func videoFile(videoURL, file string) (string, error) {
+	if file == "" || file == videoName(videoURL) {
+		return videoURL, nil
+	}
+
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return "", err
+	}
+	for _, segment := range strings.Split(file, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", ErrInvalidPlaybackFile
+		}
+	}
+	u.Path = path.Join(path.Dir(u.Path), file)
+	u.RawPath = ""
+	u.RawQuery = ""
+	return u.String(), nil
+}
@@ -0,0 +1,378 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/uptrace/bun"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MaxProfiles caps how many profiles an account may have
+	MaxProfiles = 5
+
+	MaxProfileNameLength = 50
+	maxAvatarLength      = 500
+
+	// PINLength is the number of digits of parental PINs
+	PINLength = 4
+)
+
+var (
+	ErrInvalidProfile   = errors.New("invalid profile")
+	ErrTooManyProfiles  = errors.New("too many profiles")
+	ErrProfileNameTaken = errors.New("profile name already taken")
+	ErrInvalidPIN       = errors.New("invalid parental PIN")
+	ErrPINRequired      = errors.New("parental PIN missing or incorrect")
+	// ErrProfileNotFound is a database.ErrNotFound for a profile that does
+	// not exist or belongs to another user
+	ErrProfileNotFound = fmt.Errorf("profile %w", database.ErrNotFound)
+)
+
+// ProfileService manages the viewer profiles of accounts. Each profile has
+// favorites and watch history of its own; sessions select the profile they
+// act as with SelectProfile. A profile may have a parental PIN, which guards
+// its content restrictions and, unless it is a kids profile, selecting it.
+type ProfileService struct {
+	db   *bun.DB
+	auth *AuthService
+	now  func() time.Time
+}
+
+func NewProfileService(db *bun.DB, auth *AuthService) *ProfileService {
+	return &ProfileService{db: db, auth: auth, now: time.Now}
+}
+
+// ListProfiles returns the profiles of userID in the order they were created
+func (s *ProfileService) ListProfiles(ctx context.Context, userID int64) ([]models.Profile, error) {
+	const op = "ProfileService.ListProfiles"
+
+	profiles := make([]models.Profile, 0)
+	err := s.db.NewSelect().
+		Model(&profiles).
+		Where("user_id = ?", userID).
+		Order("id").
+		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return profiles, nil
+}
+
+// GetProfile returns the profile with id of userID
+func (s *ProfileService) GetProfile(ctx context.Context, userID, id int64) (*models.Profile, error) {
+	const op = "ProfileService.GetProfile"
+
+	profile, err := userProfile(ctx, s.db, userID, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return profile, nil
+}
+
+// CreateProfile adds profile to the account of its user, who may have up
+// to MaxProfiles profiles with distinct names
+func (s *ProfileService) CreateProfile(ctx context.Context, profile *models.Profile) error {
+	const op = "ProfileService.CreateProfile"
+
+	if err := normalizeProfile(profile); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		// Lock the user, so concurrent requests cannot exceed the limit
+		_, err := tx.NewSelect().
+			Model((*models.User)(nil)).
+			Column("id").
+			Where("id = ?", profile.UserID).
+			For("UPDATE").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		count, err := tx.NewSelect().
+			Model((*models.Profile)(nil)).
+			Where("user_id = ?", profile.UserID).
+			Count(ctx)
+		if err != nil {
+			return err
+		}
+		if count >= MaxProfiles {
+			return ErrTooManyProfiles
+		}
+		if err := checkProfileName(ctx, tx, profile); err != nil {
+			return err
+		}
+
+		now := s.now()
+		profile.CreatedAt = now
+		profile.UpdatedAt = now
+		_, err = tx.NewInsert().Model(profile).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateProfile replaces the name, avatar, kids flag and maximum content
+// rating of one of the user's profiles. Changing the kids flag or rating of
+// a profile with a parental PIN takes the PIN.
+func (s *ProfileService) UpdateProfile(ctx context.Context, profile *models.Profile, pin string) error {
+	const op = "ProfileService.UpdateProfile"
+
+	if err := normalizeProfile(profile); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		existing, err := userProfile(ctx, tx, profile.UserID, profile.ID)
+		if err != nil {
+			return err
+		}
+		if profile.IsKids != existing.IsKids || profile.MaxContentRating != existing.MaxContentRating {
+			if err := checkPIN(existing, pin); err != nil {
+				return err
+			}
+		}
+		if err := checkProfileName(ctx, tx, profile); err != nil {
+			return err
+		}
+
+		profile.PINHash = existing.PINHash
+		profile.CreatedAt = existing.CreatedAt
+		profile.UpdatedAt = s.now()
+		_, err = tx.NewUpdate().
+			Model(profile).
+			Column("name", "avatar", "is_kids", "max_content_rating", "updated_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// DeleteProfile deletes one of the user's profiles with its favorites and
+// watch history, taking its parental PIN if it has one. Sessions acting as
+// it fall back to the account once their access tokens expire.
+func (s *ProfileService) DeleteProfile(ctx context.Context, userID, id int64, pin string) error {
+	const op = "ProfileService.DeleteProfile"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		profile, err := userProfile(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		if err := checkPIN(profile, pin); err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().Model(profile).WherePK().Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// SetPIN sets the parental PIN of one of the user's profiles to pin, a
+// string of PINLength digits, or removes it when pin is empty. Changing or
+// removing a PIN takes the current one.
+func (s *ProfileService) SetPIN(ctx context.Context, userID, id int64, pin, currentPIN string) error {
+	const op = "ProfileService.SetPIN"
+
+	var hash string
+	if pin != "" {
+		if !validPIN(pin) {
+			return apperrors.E(op, ErrInvalidPIN)
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+		if err != nil {
+			return apperrors.E(op, err)
+		}
+		hash = string(hashed)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		profile, err := userProfile(ctx, tx, userID, id)
+		if err != nil {
+			return err
+		}
+		if err := checkPIN(profile, currentPIN); err != nil {
+			return err
+		}
+
+		profile.PINHash = hash
+		profile.UpdatedAt = s.now()
+		_, err = tx.NewUpdate().
+			Model(profile).
+			Column("pin_hash", "updated_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// SelectProfile exchanges a refresh token of userID, like
+// AuthService.RefreshToken, for tokens acting as the user's profile with
+// id, or as the account itself when id is 0. Selecting a profile that has a
+// parental PIN and is not a kids profile takes the PIN.
+func (s *ProfileService) SelectProfile(ctx context.Context, userID, id int64, pin, refreshToken string) (*AuthResponse, error) {
+	const op = "ProfileService.SelectProfile"
+
+	if id != 0 {
+		profile, err := userProfile(ctx, s.db, userID, id)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if !profile.IsKids {
+			if err := checkPIN(profile, pin); err != nil {
+				return nil, apperrors.E(op, err)
+			}
+		}
+	}
+
+	resp, err := s.auth.switchProfile(ctx, refreshToken, userID, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return resp, nil
+}
+
+func userProfile(ctx context.Context, db bun.IDB, userID, id int64) (*models.Profile, error) {
+	profile := new(models.Profile)
+	err := db.NewSelect().
+		Model(profile).
+		Where("id = ? AND user_id = ?", id, userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrProfileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// checkProfileName fails when another profile of the user has the name of
+// profile
+func checkProfileName(ctx context.Context, tx bun.Tx, profile *models.Profile) error {
+	taken, err := tx.NewSelect().
+		Model((*models.Profile)(nil)).
+		Where("user_id = ? AND name = ? AND id != ?", profile.UserID, profile.Name, profile.ID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrProfileNameTaken
+	}
+	return nil
+}
+
+// normalizeProfile trims the name and avatar of profile and validates it.
+// Kids profiles are limited to ContentRatingPG, which is also their default.
+func normalizeProfile(profile *models.Profile) error {
+	profile.Name = strings.TrimSpace(profile.Name)
+	profile.Avatar = strings.TrimSpace(profile.Avatar)
+	if profile.Name == "" || utf8.RuneCountInString(profile.Name) > MaxProfileNameLength || len(profile.Avatar) > maxAvatarLength {
+		return ErrInvalidProfile
+	}
+
+	rating := slices.Index(models.ContentRatings, profile.MaxContentRating)
+	if profile.MaxContentRating != "" && rating < 0 {
+		return ErrInvalidProfile
+	}
+	if profile.IsKids {
+		kidsRating := slices.Index(models.ContentRatings, models.ContentRatingPG)
+		if profile.MaxContentRating == "" {
+			profile.MaxContentRating = models.ContentRatingPG
+		} else if rating > kidsRating {
+			return ErrInvalidProfile
+		}
+	}
+	return nil
+}
+
+func validPIN(pin string) bool {
+	if len(pin) != PINLength {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPIN fails unless profile has no parental PIN or pin is it
+func checkPIN(profile *models.Profile, pin string) error {
+	if profile.PINHash == "" {
+		return nil
+	}
+	if pin == "" || bcrypt.CompareHashAndPassword([]byte(profile.PINHash), []byte(pin)) != nil {
+		return ErrPINRequired
+	}
+	return nil
+}
+
+// profileRatingCeiling returns the maximum content rating of the profile
+// the request acts as, or "" when it acts as an account, whose listings are
+// not restricted, or the profile has no maximum
+func profileRatingCeiling(ctx context.Context, db bun.IDB) (string, error) {
+	profileID := ProfileIDFromContext(ctx)
+	if profileID == 0 {
+		return "", nil
+	}
+
+	var rating sql.NullString
+	err := db.NewSelect().
+		Model((*models.Profile)(nil)).
+		Column("max_content_rating").
+		Where("id = ? AND user_id = ?", profileID, UserIDFromContext(ctx)).
+		Scan(ctx, &rating)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Deleted while its sessions' access tokens are still valid
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return rating.String, nil
+}
+
+// stricterRating returns the lower of two maximum content ratings, either
+// of which may be "" for none
+func stricterRating(a, b string) string {
+	if a == "" || (b != "" && slices.Index(models.ContentRatings, b) < slices.Index(models.ContentRatings, a)) {
+		return b
+	}
+	return a
+}
+
+// ratingsUpTo returns the content ratings up to and including rating. An
+// unknown rating is treated as the lowest one.
+func ratingsUpTo(rating string) []string {
+	return models.ContentRatings[:max(slices.Index(models.ContentRatings, rating), 0)+1]
+}
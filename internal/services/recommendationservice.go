@@ -0,0 +1,187 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"time"
+)
+
+// Recommendation reason codes. Clients report them back on analytics events
+// so clicks can be attributed to the reasons that drive them.
+const (
+	ReasonBecauseYouWatched = "because_you_watched"
+	ReasonBecauseYouLiked   = "because_you_liked"
+	ReasonPopularInCategory = "popular_in_category"
+	ReasonNewThisWeek       = "new_this_week"
+	ReasonTrending          = "trending"
+	ReasonTopRated          = "top_rated"
+)
+
+const (
+	// MaxRecommendations caps the number of titles recommended at once
+	MaxRecommendations = 100
+
+	// watchedSources and favoriteSources are how many recently watched and
+	// favorited movies seed "because you watched" and "because you liked"
+	// recommendations, and perReason how many titles each reason contributes
+	// at most
+	watchedSources  = 3
+	favoriteSources = 3
+	perReason       = 10
+	// favoriteCategoryWindow is how far back plays count towards a user's
+	// favourite category
+	favoriteCategoryWindow = 30 * 24 * time.Hour
+	newTitleAge            = 7 * 24 * time.Hour
+)
+
+// Reason explains why a title was recommended. MovieID is set for
+// because_you_watched and because_you_liked, and Category for
+// popular_in_category.
+type Reason struct {
+	Code     string `json:"code" example:"because_you_watched"`
+	Label    string `json:"label" example:"Because you watched The Matrix"`
+	MovieID  int64  `json:"movie_id,omitempty" example:"42"`
+	Category string `json:"category,omitempty" example:"Sci-Fi"`
+}
+
+// Recommendation is a recommended movie and why it was recommended
+type Recommendation struct {
+	Movie  models.Movie
+	Reason Reason
+}
+
+// RecommendationService recommends movies, each with the reason it was
+// picked, so clients can label rows by reason
+type RecommendationService struct {
+	db         *database.RecommendationDB
+	movies     *MovieService
+	embeddings *EmbeddingService
+	trending   *TrendingService
+	now        func() time.Time
+}
+
+func NewRecommendationService(db *database.RecommendationDB, movies *MovieService, embeddings *EmbeddingService, trending *TrendingService) *RecommendationService {
+	return &RecommendationService{
+		db:         db,
+		movies:     movies,
+		embeddings: embeddings,
+		trending:   trending,
+		now:        time.Now,
+	}
+}
+
+// Recommend returns up to limit movies for userID (0 for anonymous users),
+// or their profile when profileID is not 0, grouped by reason: titles similar to what the user watched recently or
+// marked as favorite, popular titles of the category they have the most
+// affinity for, new titles, trending ones and finally the top rated ones,
+// which fill the remaining slots. A movie is only recommended once, for the
+// first reason that picks it, and never when the user already watched it or
+// has it among their favorites.
+func (s *RecommendationService) Recommend(ctx context.Context, userID, profileID int64, limit int) ([]Recommendation, error) {
+	const op = "RecommendationService.Recommend"
+
+	seen := make(map[int64]bool)
+	var recs []Recommendation
+	add := func(movies []models.Movie, reason Reason) {
+		for _, m := range movies {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				recs = append(recs, Recommendation{Movie: m, Reason: reason})
+			}
+		}
+	}
+
+	if userID != 0 {
+		watched, err := s.db.RecentlyWatched(ctx, userID, watchedSources)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		favorites, err := s.db.RecentFavorites(ctx, userID, profileID, favoriteSources)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		for _, m := range append(watched, favorites...) {
+			seen[m.ID] = true
+		}
+		for _, w := range watched {
+			similar, err := s.similar(ctx, w.ID)
+			if err != nil {
+				return nil, apperrors.E(op, err)
+			}
+			add(similar, Reason{Code: ReasonBecauseYouWatched, Label: "Because you watched " + w.Title, MovieID: w.ID})
+		}
+		for _, f := range favorites {
+			similar, err := s.similar(ctx, f.ID)
+			if err != nil {
+				return nil, apperrors.E(op, err)
+			}
+			add(similar, Reason{Code: ReasonBecauseYouLiked, Label: "Because you liked " + f.Title, MovieID: f.ID})
+		}
+
+		category, err := s.db.FavoriteCategory(ctx, userID, profileID, s.now().Add(-favoriteCategoryWindow))
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if category != "" {
+			popular, err := s.db.PopularInCategory(ctx, category, perReason)
+			if err != nil {
+				return nil, apperrors.E(op, err)
+			}
+			add(popular, Reason{Code: ReasonPopularInCategory, Label: "Popular in " + category, Category: category})
+		}
+	}
+
+	fresh, err := s.db.NewMovies(ctx, s.now().Add(-newTitleAge), perReason)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	add(fresh, Reason{Code: ReasonNewThisWeek, Label: "New this week"})
+
+	trending, err := s.trending.TrendingMovies(ctx, 0, perReason)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	add(trending, Reason{Code: ReasonTrending, Label: "Trending now"})
+
+	// Top rated movies make sure new users, and anonymous ones, still get a
+	// full list when there is little history or trending data
+	if len(recs) < limit {
+		topRated, err := s.movies.GetTopRatedMovies(ctx, limit+len(seen))
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		add(topRated, Reason{Code: ReasonTopRated, Label: "Top rated"})
+	}
+
+	if len(recs) > limit {
+		recs = recs[:limit]
+	}
+
+	movies := make([]models.Movie, len(recs))
+	for i := range recs {
+		movies[i] = recs[i].Movie
+	}
+	if err := s.movies.LocalizeMovies(ctx, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.movies.LoadCategories(ctx, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	for i := range recs {
+		recs[i].Movie = movies[i]
+	}
+	return recs, nil
+}
+
+// similar returns movies nearest to movieID by embedding, or sharing its
+// categories when it has no embedding
+func (s *RecommendationService) similar(ctx context.Context, movieID int64) ([]models.Movie, error) {
+	movies, err := s.embeddings.SimilarMovies(ctx, movieID, perReason)
+	if errors.Is(err, ErrEmbeddingsDisabled) || errors.Is(err, database.ErrNotFound) {
+		return s.movies.GetRelatedMovies(ctx, movieID, perReason)
+	}
+	return movies, err
+}
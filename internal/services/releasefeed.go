@@ -0,0 +1,94 @@
+package services
+
+import (
+	"github.com/ndn/internal/models"
+	"sync"
+	"time"
+)
+
+// releaseBuffer is how many releases may queue for a subscriber before it
+// is dropped for being too slow
+const releaseBuffer = 16
+
+// Release is a movie that was just added to the public catalog
+type Release struct {
+	ID          int64     `json:"id" example:"1"`
+	Title       string    `json:"title" example:"The Matrix"`
+	ReleaseYear int       `json:"release_year" example:"1999"`
+	PosterURL   string    `json:"poster_url"`
+	Categories  []string  `json:"categories"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReleaseFeed is an in-process pub/sub of the movies created through this
+// instance. Unlike notifications, releases are not shared between instances
+// and are lost when nobody is subscribed.
+type ReleaseFeed struct {
+	mu          sync.Mutex
+	subscribers map[chan Release]struct{}
+	closed      bool
+}
+
+func NewReleaseFeed() *ReleaseFeed {
+	return &ReleaseFeed{subscribers: make(map[chan Release]struct{})}
+}
+
+// Subscribe returns a channel receiving the releases published from now on
+// and a function to unsubscribe. The channel is closed when the subscriber
+// falls behind or the feed closes.
+func (f *ReleaseFeed) Subscribe() (<-chan Release, func()) {
+	ch := make(chan Release, releaseBuffer)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	f.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subscribers[ch]; ok {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends release to every subscriber without waiting for them
+func (f *ReleaseFeed) publish(release Release) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subscribers {
+		select {
+		case ch <- release:
+		default:
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends every subscription, letting streams finish before shutdown
+func (f *ReleaseFeed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for ch := range f.subscribers {
+		delete(f.subscribers, ch)
+		close(ch)
+	}
+}
+
+func newRelease(movie *models.Movie) Release {
+	return Release{
+		ID:          movie.ID,
+		Title:       movie.Title,
+		ReleaseYear: movie.ReleaseYear,
+		PosterURL:   movie.PosterURL,
+		Categories:  movie.Categories,
+		CreatedAt:   movie.CreatedAt,
+	}
+}
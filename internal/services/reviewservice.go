@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	// MaxReviewPageSize caps how many reviews one page lists
+	MaxReviewPageSize = 100
+
+	maxReviewLength = 5000
+
+	// contentEntityReview is the entity type of flagged review text
+	contentEntityReview = "review"
+)
+
+var (
+	ErrInvalidReview   = errors.New("invalid review")
+	ErrReviewExists    = errors.New("movie already reviewed by user")
+	ErrReviewForbidden = errors.New("review belongs to another user")
+	// ErrReviewNotFound is a database.ErrNotFound telling a missing review
+	// apart from a missing movie
+	ErrReviewNotFound = fmt.Errorf("review %w", database.ErrNotFound)
+)
+
+// ReviewService manages users' reviews of movies and keeps each movie's
+// rating, the average score of its reviews, up to date as they are written.
+// Review text is screened by the content filter.
+type ReviewService struct {
+	db            *bun.DB
+	contentFilter *ContentFilterService
+	cache         cache.Cache
+	now           func() time.Time
+}
+
+func NewReviewService(db *bun.DB, contentFilter *ContentFilterService, c cache.Cache) *ReviewService {
+	return &ReviewService{db: db, contentFilter: contentFilter, cache: c, now: time.Now}
+}
+
+// ListReviews returns a page of the reviews of a publicly shown movie, newest
+// first, with their authors, and the total number of reviews
+func (s *ReviewService) ListReviews(ctx context.Context, movieID int64, page, pageSize int) ([]models.Review, int, error) {
+	const op = "ReviewService.ListReviews"
+
+	exists, err := s.db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Where("m.id = ?", movieID).
+		Apply(database.Published).
+		Exists(ctx)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	if !exists {
+		return nil, 0, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+
+	var reviews []models.Review
+	total, err := s.db.NewSelect().
+		Model(&reviews).
+		Relation("User", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Column("id", "name")
+		}).
+		Where("r.movie_id = ?", movieID).
+		OrderExpr("r.created_at DESC, r.id DESC").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	return reviews, total, nil
+}
+
+// CreateReview stores the review of a publicly shown movie and updates the
+// movie's rating. A user may review each movie once.
+func (s *ReviewService) CreateReview(ctx context.Context, review *models.Review) error {
+	const op = "ReviewService.CreateReview"
+
+	review.Text = strings.TrimSpace(review.Text)
+	if err := validateReview(review); err != nil {
+		return apperrors.E(op, err)
+	}
+	screening, err := s.contentFilter.Screen(ctx, review.Text)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	err = runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockMovie(ctx, tx, review.MovieID, true); err != nil {
+			return err
+		}
+
+		exists, err := tx.NewSelect().
+			Model((*models.Review)(nil)).
+			Where("user_id = ? AND movie_id = ?", review.UserID, review.MovieID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrReviewExists
+		}
+
+		now := s.now()
+		review.CreatedAt = now
+		review.UpdatedAt = now
+		if _, err := tx.NewInsert().Model(review).Exec(ctx); err != nil {
+			return err
+		}
+		if err := s.contentFilter.Flag(ctx, tx, contentEntityReview, review.ID, "text", review.Text, screening); err != nil {
+			return err
+		}
+		return updateMovieRating(ctx, tx, review.MovieID)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+// UpdateReview changes the score and text of userID's review of a movie and
+// updates the movie's rating
+func (s *ReviewService) UpdateReview(ctx context.Context, userID, movieID, reviewID int64, score int, text string) (*models.Review, error) {
+	const op = "ReviewService.UpdateReview"
+
+	review := &models.Review{Score: score, Text: strings.TrimSpace(text)}
+	if err := validateReview(review); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	screening, err := s.contentFilter.Screen(ctx, review.Text)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	err = runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockMovie(ctx, tx, movieID, false); err != nil {
+			return err
+		}
+		existing, err := movieReview(ctx, tx, movieID, reviewID)
+		if err != nil {
+			return err
+		}
+		if existing.UserID != userID {
+			return ErrReviewForbidden
+		}
+
+		existing.Score = review.Score
+		existing.Text = review.Text
+		existing.UpdatedAt = s.now()
+		review = existing
+		_, err = tx.NewUpdate().
+			Model(review).
+			Column("score", "text", "updated_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if err := s.contentFilter.Flag(ctx, tx, contentEntityReview, review.ID, "text", review.Text, screening); err != nil {
+			return err
+		}
+		return updateMovieRating(ctx, tx, movieID)
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return review, nil
+}
+
+// DeleteReview deletes a review of a movie on behalf of userID, who must have
+// written it or be an admin, and updates the movie's rating
+func (s *ReviewService) DeleteReview(ctx context.Context, userID, movieID, reviewID int64) error {
+	const op = "ReviewService.DeleteReview"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockMovie(ctx, tx, movieID, false); err != nil {
+			return err
+		}
+		review, err := movieReview(ctx, tx, movieID, reviewID)
+		if err != nil {
+			return err
+		}
+		if review.UserID != userID {
+			isAdmin, err := tx.NewSelect().
+				Model((*models.User)(nil)).
+				Where("id = ? AND is_admin", userID).
+				Exists(ctx)
+			if err != nil {
+				return err
+			}
+			if !isAdmin {
+				return ErrReviewForbidden
+			}
+		}
+
+		if _, err := tx.NewDelete().Model(review).WherePK().Exec(ctx); err != nil {
+			return err
+		}
+		return updateMovieRating(ctx, tx, movieID)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return nil
+}
+
+func validateReview(review *models.Review) error {
+	if review.Score < 1 || review.Score > 5 || len(review.Text) > maxReviewLength {
+		return ErrInvalidReview
+	}
+	return nil
+}
+
+// lockMovie locks the movie's row until the transaction ends, so concurrent
+// reviews of it recompute its rating one after the other. With published
+// set, only publicly shown movies are found.
+func lockMovie(ctx context.Context, tx bun.Tx, movieID int64, published bool) error {
+	query := tx.NewSelect().
+		Model((*models.Movie)(nil)).
+		Column("m.id").
+		Where("m.id = ?", movieID).
+		For("UPDATE")
+	if published {
+		query.Apply(database.Published)
+	}
+
+	var id int64
+	err := query.Scan(ctx, &id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("movie %w", database.ErrNotFound)
+	}
+	return err
+}
+
+func movieReview(ctx context.Context, tx bun.Tx, movieID, reviewID int64) (*models.Review, error) {
+	review := new(models.Review)
+	err := tx.NewSelect().
+		Model(review).
+		Where("id = ? AND movie_id = ?", reviewID, movieID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReviewNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// updateMovieRating sets the movie's rating to the average score of its
+// reviews, rounded to one decimal, or 0 when it has none
+func updateMovieRating(ctx context.Context, tx bun.Tx, movieID int64) error {
+	_, err := tx.NewUpdate().
+		Model((*models.Movie)(nil)).
+		Set("rating = COALESCE((SELECT ROUND(AVG(score), 1) FROM reviews WHERE movie_id = ?), 0)", movieID).
+		Set("rating_count = (SELECT COUNT(*) FROM reviews WHERE movie_id = ?)", movieID).
+		Where("id = ?", movieID).
+		Exec(ctx)
+	return err
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RollupService periodically aggregates raw analytics events into the daily
+// per-movie and per-user stats tables and prunes raw events once they are
+// past retention. Dashboards read the stats tables only, so raw events can be
+// dropped without losing history.
+type RollupService struct {
+	db        *database.AnalyticsDB
+	logger    *zap.Logger
+	interval  time.Duration
+	lookback  time.Duration
+	retention time.Duration
+	now       func() time.Time
+}
+
+func NewRollupService(db *database.AnalyticsDB, cfg config.AnalyticsConfig, logger *zap.Logger) *RollupService {
+	interval := cfg.RollupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	// Clients may report events up to maxEventAge late, so recent days are
+	// rolled up again on every run until no more events can arrive for them
+	lookback := cfg.RollupLookback
+	if lookback <= 0 {
+		lookback = maxEventAge
+	}
+
+	return &RollupService{
+		db:        db,
+		logger:    logger,
+		interval:  interval,
+		lookback:  lookback,
+		retention: cfg.RawRetention,
+		now:       time.Now,
+	}
+}
+
+// Run rolls up and prunes on startup and then every interval until ctx is
+// cancelled
+func (s *RollupService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("analytics rollup failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce rolls up every day that is new or still within the lookback
+// window, oldest first, then prunes expired raw events
+func (s *RollupService) RunOnce(ctx context.Context) error {
+	const op = "RollupService.RunOnce"
+
+	today := startOfDay(s.now())
+
+	last, err := s.db.LastRollupDay(ctx)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	from := startOfDay(s.now().Add(-s.lookback))
+	if last.IsZero() {
+		// First run: backfill from the oldest stored event
+		earliest, err := s.db.EarliestEventTime(ctx)
+		if err != nil {
+			return apperrors.E(op, err)
+		}
+		if !earliest.IsZero() && earliest.Before(from) {
+			from = startOfDay(earliest)
+		}
+	} else if next := startOfDay(last).AddDate(0, 0, 1); next.Before(from) {
+		// Catch up on days missed while the service was down
+		from = next
+	}
+
+	for day := from; !day.After(today); day = day.AddDate(0, 0, 1) {
+		if err := s.db.RollupDay(ctx, day); err != nil {
+			return apperrors.Errorf(op, "failed to roll up %s: %w", day.Format("2006-01-02"), err)
+		}
+	}
+
+	return s.prune(ctx, from)
+}
+
+// prune deletes raw events older than the retention period. Events from
+// rolledFrom on are kept even then, as those days are still rolled up again.
+func (s *RollupService) prune(ctx context.Context, rolledFrom time.Time) error {
+	const op = "RollupService.prune"
+
+	if s.retention <= 0 {
+		return nil
+	}
+
+	before := startOfDay(s.now().Add(-s.retention))
+	if before.After(rolledFrom) {
+		before = rolledFrom
+	}
+
+	pruned, err := s.db.PruneEvents(ctx, before)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if pruned > 0 {
+		s.logger.Info("pruned raw analytics events",
+			zap.Int64("events", pruned),
+			zap.Time("before", before),
+		)
+	}
+	return nil
+}
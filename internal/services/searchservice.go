@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"strings"
+)
+
+// Entity groups returned by Search
+const (
+	SearchGroupMovies      = "movies"
+	SearchGroupSeries      = "series"
+	SearchGroupCategories  = "categories"
+	SearchGroupCollections = "collections"
+)
+
+const (
+	// DefaultSearchGroupLimit and MaxSearchGroupLimit bound how many results
+	// each group of a search returns
+	DefaultSearchGroupLimit = 5
+	MaxSearchGroupLimit     = 50
+
+	maxSearchTermLength = 256
+	// maxSearchSuggestions caps the corrections offered for a search that
+	// matched nothing
+	maxSearchSuggestions = 5
+)
+
+var (
+	ErrInvalidSearchTerm = errors.New("invalid search term")
+	ErrUnknownSearchType = errors.New("unknown search type")
+)
+
+// SearchGroups lists the entity groups Search can return, in response order
+var SearchGroups = []string{SearchGroupMovies, SearchGroupSeries, SearchGroupCategories, SearchGroupCollections}
+
+// SearchResults groups the matches of a search by entity. A group is nil
+// when it was not requested. Suggestions is only set when no group matched
+// anything.
+type SearchResults struct {
+	Movies           []models.Movie
+	MoviesTotal      int
+	Series           []models.Series
+	SeriesTotal      int
+	Categories       []*models.Category
+	CategoriesTotal  int
+	Collections      []models.Collection
+	CollectionsTotal int
+	Suggestions      []string
+}
+
+// SearchService searches every kind of entity at once, so a search page
+// needs a single request. Terms are expanded with the synonym dictionary.
+type SearchService struct {
+	db       *database.SearchDB
+	synonyms *SynonymService
+	movies   *MovieService
+}
+
+func NewSearchService(db *database.SearchDB, synonyms *SynonymService, movies *MovieService) *SearchService {
+	return &SearchService{db: db, synonyms: synonyms, movies: movies}
+}
+
+// Search returns the best matches of term, or of any variant of it from the
+// synonym dictionary, in each group of limits, up to the group's limit.
+// Within a group, names equal to a variant rank first, then names starting
+// with one, then other matches. When nothing matches, similar titles, names
+// and synonyms are suggested instead.
+func (s *SearchService) Search(ctx context.Context, term string, limits map[string]int) (*SearchResults, error) {
+	const op = "SearchService.Search"
+
+	term = strings.TrimSpace(term)
+	if term == "" || len(term) > maxSearchTermLength {
+		return nil, apperrors.Errorf(op, "%w: must be 1 to %d characters", ErrInvalidSearchTerm, maxSearchTermLength)
+	}
+	for group, limit := range limits {
+		switch group {
+		case SearchGroupMovies, SearchGroupSeries, SearchGroupCategories, SearchGroupCollections:
+		default:
+			return nil, apperrors.Errorf(op, "%w %q", ErrUnknownSearchType, group)
+		}
+		if limit < 1 || limit > MaxSearchGroupLimit {
+			limits[group] = DefaultSearchGroupLimit
+		}
+	}
+
+	terms, err := s.synonyms.Expand(ctx, term)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	results := new(SearchResults)
+	if limit, ok := limits[SearchGroupMovies]; ok {
+		results.Movies, results.MoviesTotal, err = s.db.SearchMovies(ctx, terms, limit)
+		if err != nil {
+			return nil, apperrors.E(op, fmt.Errorf("failed to search movies: %w", err))
+		}
+		if err := s.movies.LocalizeMovies(ctx, results.Movies); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		if err := s.movies.LoadCategories(ctx, results.Movies); err != nil {
+			return nil, apperrors.E(op, err)
+		}
+	}
+	if limit, ok := limits[SearchGroupSeries]; ok {
+		results.Series, results.SeriesTotal, err = s.db.SearchSeries(ctx, terms, limit)
+		if err != nil {
+			return nil, apperrors.E(op, fmt.Errorf("failed to search series: %w", err))
+		}
+	}
+	if limit, ok := limits[SearchGroupCategories]; ok {
+		results.Categories, results.CategoriesTotal, err = s.db.SearchCategories(ctx, terms, limit)
+		if err != nil {
+			return nil, apperrors.E(op, fmt.Errorf("failed to search categories: %w", err))
+		}
+	}
+	if limit, ok := limits[SearchGroupCollections]; ok {
+		results.Collections, results.CollectionsTotal, err = s.db.SearchCollections(ctx, terms, limit)
+		if err != nil {
+			return nil, apperrors.E(op, fmt.Errorf("failed to search collections: %w", err))
+		}
+	}
+
+	if results.MoviesTotal == 0 && results.SeriesTotal == 0 && results.CategoriesTotal == 0 && results.CollectionsTotal == 0 {
+		results.Suggestions, err = s.db.Suggest(ctx, normalizeSearchTerm(term), maxSearchSuggestions)
+		if err != nil {
+			return nil, apperrors.E(op, fmt.Errorf("failed to suggest corrections: %w", err))
+		}
+	}
+	return results, nil
+}
+
+// normalizeSearchTerm folds a search term so lookups keyed by it match
+// regardless of case and spacing
+func normalizeSearchTerm(q string) string {
+	return strings.ToLower(strings.Join(strings.Fields(q), " "))
+}
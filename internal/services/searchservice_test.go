@@ -0,0 +1,17 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSearchRejectsUnknownGroups(t *testing.T) {
+	s := NewSearchService(nil, nil, nil)
+	for _, group := range []string{"people", "episodes", "Movies"} {
+		_, err := s.Search(context.Background(), "alien", map[string]int{SearchGroupMovies: 5, group: 5})
+		if !errors.Is(err, ErrUnknownSearchType) {
+			t.Errorf("Search with group %q = %v, want %v", group, err, ErrUnknownSearchType)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+var (
+	ErrSeriesExists  = errors.New("series already exists")
+	ErrSeasonExists  = errors.New("season number already taken")
+	ErrEpisodeExists = errors.New("episode number already taken")
+	// ErrSeriesNotFound, ErrSeasonNotFound and ErrEpisodeNotFound are
+	// database.ErrNotFound errors telling apart what is missing
+	ErrSeriesNotFound  = fmt.Errorf("series %w", database.ErrNotFound)
+	ErrSeasonNotFound  = fmt.Errorf("season %w", database.ErrNotFound)
+	ErrEpisodeNotFound = fmt.Errorf("episode %w", database.ErrNotFound)
+)
+
+// SeriesService manages TV series and their seasons and episodes. Seasons
+// are numbered within their series and episodes within their season.
+type SeriesService struct {
+	db  *bun.DB
+	now func() time.Time
+}
+
+func NewSeriesService(db *bun.DB) *SeriesService {
+	return &SeriesService{db: db, now: time.Now}
+}
+
+type SeriesFilter struct {
+	Search     string
+	Categories []string
+	Year       *int
+	Page       int
+	PageSize   int
+}
+
+// ListSeries returns a page of series matching filter, newest first, and
+// the total number of matches
+func (s *SeriesService) ListSeries(ctx context.Context, filter SeriesFilter) ([]models.Series, int, error) {
+	const op = "SeriesService.ListSeries"
+
+	var series []models.Series
+	query := s.db.NewSelect().Model(&series)
+	if filter.Search != "" {
+		query.Where("title ILIKE ? OR description ILIKE ?",
+			"%"+filter.Search+"%", "%"+filter.Search+"%")
+	}
+	if len(filter.Categories) > 0 {
+		query.Where("categories && ?", bun.In(filter.Categories))
+	}
+	if filter.Year != nil {
+		query.Where("release_year = ?", *filter.Year)
+	}
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = 20
+	}
+
+	total, err := query.
+		Order("created_at DESC", "id DESC").
+		Limit(filter.PageSize).
+		Offset((filter.Page - 1) * filter.PageSize).
+		ScanAndCount(ctx)
+	if err != nil {
+		return nil, 0, apperrors.E(op, err)
+	}
+	return series, total, nil
+}
+
+// GetSeries returns a series with its seasons and their episodes, in order
+func (s *SeriesService) GetSeries(ctx context.Context, id int64) (*models.Series, error) {
+	const op = "SeriesService.GetSeries"
+
+	series := new(models.Series)
+	err := s.db.NewSelect().
+		Model(series).
+		Relation("Seasons", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("sn.number ASC")
+		}).
+		Relation("Seasons.Episodes", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ep.number ASC")
+		}).
+		Where("sr.id = ?", id).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, ErrSeriesNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return series, nil
+}
+
+// GetSeason returns season number of a series with its episodes, in order
+func (s *SeriesService) GetSeason(ctx context.Context, seriesID int64, number int) (*models.Season, error) {
+	const op = "SeriesService.GetSeason"
+
+	season := new(models.Season)
+	err := s.db.NewSelect().
+		Model(season).
+		Relation("Episodes", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Order("ep.number ASC")
+		}).
+		Where("sn.series_id = ? AND sn.number = ?", seriesID, number).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, ErrSeasonNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return season, nil
+}
+
+func (s *SeriesService) GetEpisode(ctx context.Context, id int64) (*models.Episode, error) {
+	const op = "SeriesService.GetEpisode"
+
+	episode := new(models.Episode)
+	err := s.db.NewSelect().
+		Model(episode).
+		Where("id = ?", id).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, ErrEpisodeNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return episode, nil
+}
+
+func (s *SeriesService) CreateSeries(ctx context.Context, series *models.Series) error {
+	const op = "SeriesService.CreateSeries"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := seriesTitleFree(ctx, tx, series.Title, 0); err != nil {
+			return err
+		}
+
+		now := s.now()
+		series.CreatedAt = now
+		series.UpdatedAt = now
+		_, err := tx.NewInsert().Model(series).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateSeries replaces the details of a series. Its seasons are kept.
+func (s *SeriesService) UpdateSeries(ctx context.Context, series *models.Series) error {
+	const op = "SeriesService.UpdateSeries"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		if err := seriesTitleFree(ctx, tx, series.Title, series.ID); err != nil {
+			return err
+		}
+
+		series.UpdatedAt = s.now()
+		err := tx.NewUpdate().
+			Model(series).
+			Column("title", "description", "release_year", "poster_url", "categories", "updated_at").
+			WherePK().
+			Returning("created_at").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSeriesNotFound
+		}
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// DeleteSeries deletes a series with all its seasons and episodes
+func (s *SeriesService) DeleteSeries(ctx context.Context, id int64) error {
+	const op = "SeriesService.DeleteSeries"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		return deleteByID(ctx, tx, (*models.Series)(nil), id, ErrSeriesNotFound)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *SeriesService) CreateSeason(ctx context.Context, season *models.Season) error {
+	const op = "SeriesService.CreateSeason"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Series)(nil)).
+			Where("id = ?", season.SeriesID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrSeriesNotFound
+		}
+		if err := seasonNumberFree(ctx, tx, season); err != nil {
+			return err
+		}
+
+		now := s.now()
+		season.CreatedAt = now
+		season.UpdatedAt = now
+		_, err = tx.NewInsert().Model(season).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateSeason replaces the details of a season, including its number. The
+// season stays in its series.
+func (s *SeriesService) UpdateSeason(ctx context.Context, season *models.Season) error {
+	const op = "SeriesService.UpdateSeason"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model((*models.Season)(nil)).
+			Column("series_id").
+			Where("id = ?", season.ID).
+			Scan(ctx, &season.SeriesID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSeasonNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := seasonNumberFree(ctx, tx, season); err != nil {
+			return err
+		}
+
+		season.UpdatedAt = s.now()
+		return tx.NewUpdate().
+			Model(season).
+			Column("number", "title", "description", "release_year", "poster_url", "updated_at").
+			WherePK().
+			Returning("created_at").
+			Scan(ctx)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// DeleteSeason deletes a season with its episodes
+func (s *SeriesService) DeleteSeason(ctx context.Context, id int64) error {
+	const op = "SeriesService.DeleteSeason"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		return deleteByID(ctx, tx, (*models.Season)(nil), id, ErrSeasonNotFound)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *SeriesService) CreateEpisode(ctx context.Context, episode *models.Episode) error {
+	const op = "SeriesService.CreateEpisode"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		exists, err := tx.NewSelect().
+			Model((*models.Season)(nil)).
+			Where("id = ?", episode.SeasonID).
+			Exists(ctx)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrSeasonNotFound
+		}
+		if err := episodeNumberFree(ctx, tx, episode); err != nil {
+			return err
+		}
+
+		now := s.now()
+		episode.CreatedAt = now
+		episode.UpdatedAt = now
+		_, err = tx.NewInsert().Model(episode).Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// UpdateEpisode replaces the details of an episode, including its number.
+// The episode stays in its season.
+func (s *SeriesService) UpdateEpisode(ctx context.Context, episode *models.Episode) error {
+	const op = "SeriesService.UpdateEpisode"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model((*models.Episode)(nil)).
+			Column("season_id").
+			Where("id = ?", episode.ID).
+			Scan(ctx, &episode.SeasonID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrEpisodeNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := episodeNumberFree(ctx, tx, episode); err != nil {
+			return err
+		}
+
+		episode.UpdatedAt = s.now()
+		return tx.NewUpdate().
+			Model(episode).
+			Column("number", "title", "description", "duration", "video_url", "air_date", "updated_at").
+			WherePK().
+			Returning("created_at").
+			Scan(ctx)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+func (s *SeriesService) DeleteEpisode(ctx context.Context, id int64) error {
+	const op = "SeriesService.DeleteEpisode"
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		return deleteByID(ctx, tx, (*models.Episode)(nil), id, ErrEpisodeNotFound)
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// seriesTitleFree checks no series other than id has title
+func seriesTitleFree(ctx context.Context, tx bun.Tx, title string, id int64) error {
+	exists, err := tx.NewSelect().
+		Model((*models.Series)(nil)).
+		Where("title = ? AND id != ?", title, id).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrSeriesExists
+	}
+	return nil
+}
+
+// seasonNumberFree checks no other season of the series has the number of
+// season
+func seasonNumberFree(ctx context.Context, tx bun.Tx, season *models.Season) error {
+	exists, err := tx.NewSelect().
+		Model((*models.Season)(nil)).
+		Where("series_id = ? AND number = ? AND id != ?", season.SeriesID, season.Number, season.ID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrSeasonExists
+	}
+	return nil
+}
+
+// episodeNumberFree checks no other episode of the season has the number of
+// episode
+func episodeNumberFree(ctx context.Context, tx bun.Tx, episode *models.Episode) error {
+	exists, err := tx.NewSelect().
+		Model((*models.Episode)(nil)).
+		Where("season_id = ? AND number = ? AND id != ?", episode.SeasonID, episode.Number, episode.ID).
+		Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEpisodeExists
+	}
+	return nil
+}
+
+// deleteByID deletes the row of model with id, returning notFound when there
+// is none. Rows that belong to it are deleted by cascade.
+func deleteByID(ctx context.Context, tx bun.Tx, model interface{}, id int64, notFound error) error {
+	result, err := tx.NewDelete().
+		Model(model).
+		Where("id = ?", id).
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return notFound
+	}
+	return nil
+}
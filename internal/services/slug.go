@@ -0,0 +1,23 @@
+package services
+
+import "strings"
+
+// Slugify returns the slug of a name, for use in URLs: the name lowercased,
+// with every run of other characters than ASCII letters and digits replaced
+// by a hyphen. It is empty for names without any.
+func Slugify(name string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	// DefaultMaxPosterSize is the largest poster accepted, 5 MiB, unless
+	// configured otherwise
+	DefaultMaxPosterSize = 5 << 20
+
+	defaultStorageTimeout = 30 * time.Second
+)
+
+var (
+	ErrStorageDisabled  = errors.New("file storage is not configured")
+	errObjectNotFound   = errors.New("object not found")
+	ErrPosterTooLarge   = errors.New("poster is too large")
+	ErrUnsupportedImage = errors.New("unsupported image type")
+)
+
+// posterTypes maps the image types accepted as posters to the extension of
+// their objects
+var posterTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// contentTypes maps the extensions of uploaded files whose type the system
+// MIME tables may not know to their content type
+var contentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".ts":   "video/mp2t",
+}
+
+// StorageService stores uploaded files, such as movie posters, in an
+// S3-compatible bucket (Amazon S3, MinIO, ...) and returns the public URL
+// they are served from
+type StorageService struct {
+	client *minio.Client
+	cfg    config.StorageConfig
+}
+
+// NewStorageService connects to the configured bucket. Without an endpoint
+// uploads are disabled and fail with ErrStorageDisabled.
+func NewStorageService(cfg config.StorageConfig) (*StorageService, error) {
+	if cfg.Endpoint == "" {
+		return &StorageService{cfg: cfg}, nil
+	}
+
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+	return &StorageService{client: client, cfg: cfg}, nil
+}
+
+// Enabled reports whether a bucket is configured to store files in
+func (s *StorageService) Enabled() bool {
+	return s.client != nil
+}
+
+// Ping checks that the bucket can be reached and exists, for health checks
+func (s *StorageService) Ping(ctx context.Context) error {
+	if s.client == nil {
+		return ErrStorageDisabled
+	}
+	exists, err := s.client.BucketExists(ctx, s.cfg.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %q does not exist", s.cfg.Bucket)
+	}
+	return nil
+}
+
+// MaxPosterSize is the largest poster accepted, in bytes
+func (s *StorageService) MaxPosterSize() int64 {
+	if s.cfg.MaxPosterSize <= 0 {
+		return DefaultMaxPosterSize
+	}
+	return s.cfg.MaxPosterSize
+}
+
+// StorePoster stores image as a poster of movieID and returns its public
+// URL. The image type is detected from its content, not trusted from the
+// upload: JPEG, PNG and WebP are accepted. Each upload gets a new object so
+// CDNs never serve a replaced poster from cache.
+func (s *StorageService) StorePoster(ctx context.Context, movieID int64, image []byte) (string, error) {
+	const op = "StorageService.StorePoster"
+
+	if s.client == nil {
+		return "", apperrors.E(op, ErrStorageDisabled)
+	}
+	if int64(len(image)) > s.MaxPosterSize() {
+		return "", apperrors.E(op, ErrPosterTooLarge)
+	}
+	contentType := http.DetectContentType(image)
+	ext, ok := posterTypes[contentType]
+	if !ok {
+		return "", apperrors.E(op, ErrUnsupportedImage)
+	}
+
+	name, err := randomHex(8)
+	if err != nil {
+		return "", apperrors.E(op, err)
+	}
+	key := fmt.Sprintf("posters/movies/%d/%s%s", movieID, name, ext)
+	if err := s.put(ctx, key, contentType, image); err != nil {
+		return "", apperrors.E(op, err)
+	}
+	return s.objectURL(key), nil
+}
+
+func (s *StorageService) put(ctx context.Context, key, contentType string, data []byte) error {
+	timeout := s.cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultStorageTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := s.client.PutObject(ctx, s.cfg.Bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
+		// Objects are never replaced, so they may be cached for good
+		CacheControl: "public, max-age=31536000, immutable",
+	})
+	return err
+}
+
+// upload streams r, of size bytes or -1 when unknown, to the object at key.
+// Unlike put it is not bounded by the storage timeout, as large files can
+// take much longer; ctx bounds it instead.
+func (s *StorageService) upload(ctx context.Context, key, contentType string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.cfg.Bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+// uploadDir uploads every file under dir to the objects under prefix, at
+// the same relative paths
+func (s *StorageService) uploadDir(ctx context.Context, prefix, dir string) error {
+	return filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		contentType := contentTypes[filepath.Ext(name)]
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(name))
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		_, err = s.client.FPutObject(ctx, s.cfg.Bucket, path.Join(prefix, filepath.ToSlash(rel)), name, minio.PutObjectOptions{
+			ContentType:  contentType,
+			CacheControl: "public, max-age=31536000, immutable",
+		})
+		return err
+	})
+}
+
+// download copies the object at key to the file at name
+func (s *StorageService) download(ctx context.Context, key, name string) error {
+	return s.client.FGetObject(ctx, s.cfg.Bucket, key, name, minio.GetObjectOptions{})
+}
+
+// objectSize returns the size of the object at key, or errObjectNotFound
+func (s *StorageService) objectSize(ctx context.Context, key string) (int64, error) {
+	info, err := s.client.StatObject(ctx, s.cfg.Bucket, key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return 0, errObjectNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// presignUpload returns a URL the object at key can be uploaded to with a
+// PUT request, without credentials, until expiry has passed
+func (s *StorageService) presignUpload(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	u, err := s.client.PresignedPutObject(ctx, s.cfg.Bucket, key, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// presignDownload returns a URL the object at key can be downloaded from,
+// without credentials, until expiry has passed. Browsers save it as
+// filename.
+func (s *StorageService) presignDownload(ctx context.Context, key string, expiry time.Duration, filename string) (string, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	u, err := s.client.PresignedGetObject(ctx, s.cfg.Bucket, key, expiry, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// remove deletes the object at key
+func (s *StorageService) remove(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.cfg.Bucket, key, minio.RemoveObjectOptions{})
+}
+
+// objectURL is the public URL of the object at key: under the configured
+// public URL, usually a CDN, or else the bucket's own path-style URL
+func (s *StorageService) objectURL(key string) string {
+	if s.cfg.PublicURL != "" {
+		return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/" + key
+	}
+	u := url.URL{Scheme: "http", Host: s.cfg.Endpoint, Path: "/" + s.cfg.Bucket + "/" + key}
+	if s.cfg.UseSSL {
+		u.Scheme = "https"
+	}
+	return u.String()
+}
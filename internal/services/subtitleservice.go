@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/subtitle"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	// MaxSubtitleSize is the largest subtitle track accepted, 2 MiB
+	MaxSubtitleSize = 2 << 20
+
+	maxSubtitleLabelLength = 100
+)
+
+var (
+	ErrInvalidSubtitleLanguage = errors.New("invalid subtitle language")
+	ErrInvalidSubtitleLabel    = errors.New("invalid subtitle label")
+	ErrSubtitleTooLarge        = errors.New("subtitle track is too large")
+	// ErrSubtitleNotFound is a database.ErrNotFound telling a missing
+	// subtitle track apart from a missing movie
+	ErrSubtitleNotFound = fmt.Errorf("subtitle %w", database.ErrNotFound)
+)
+
+// languageTag is a BCP 47 language tag of a language, optional script and
+// region and other subtags, such as en, pt-BR or zh-Hant-TW
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// SubtitleService manages the subtitle tracks of movies, one per language.
+// Tracks are uploaded as SRT or WebVTT and stored as WebVTT, so players can
+// use them as they are.
+type SubtitleService struct {
+	db  *bun.DB
+	now func() time.Time
+}
+
+func NewSubtitleService(db *bun.DB) *SubtitleService {
+	return &SubtitleService{db: db, now: time.Now}
+}
+
+// ListSubtitles returns the subtitle tracks of a publicly shown movie by
+// language, without their content
+func (s *SubtitleService) ListSubtitles(ctx context.Context, movieID int64) ([]models.Subtitle, error) {
+	const op = "SubtitleService.ListSubtitles"
+
+	exists, err := s.db.NewSelect().
+		Model((*models.Movie)(nil)).
+		Where("m.id = ?", movieID).
+		Apply(database.Published).
+		Exists(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if !exists {
+		return nil, apperrors.E(op, fmt.Errorf("movie %w", database.ErrNotFound))
+	}
+
+	subtitles := []models.Subtitle{}
+	err = s.db.NewSelect().
+		Model(&subtitles).
+		ExcludeColumn("content").
+		Where("st.movie_id = ?", movieID).
+		OrderExpr("st.language").
+		Scan(ctx)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return subtitles, nil
+}
+
+// GetSubtitle returns the subtitle track of a publicly shown movie in
+// language
+func (s *SubtitleService) GetSubtitle(ctx context.Context, movieID int64, language string) (*models.Subtitle, error) {
+	const op = "SubtitleService.GetSubtitle"
+
+	language, ok := normalizeLanguage(language)
+	if !ok {
+		return nil, apperrors.E(op, ErrInvalidSubtitleLanguage)
+	}
+
+	track := new(models.Subtitle)
+	err := s.db.NewSelect().
+		Model(track).
+		Join("JOIN movies AS m ON m.id = st.movie_id AND m.deleted_at IS NULL").
+		Where("st.movie_id = ? AND st.language = ?", movieID, language).
+		Apply(database.Published).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, apperrors.E(op, ErrSubtitleNotFound)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return track, nil
+}
+
+// PutSubtitle converts data, an SRT or WebVTT track, to WebVTT and stores it
+// as the subtitle track of a movie in language, replacing any track the
+// movie has in that language. label names the track in players and
+// defaults to the language. It reports whether the track was created.
+func (s *SubtitleService) PutSubtitle(ctx context.Context, movieID int64, language, label string, data []byte) (*models.Subtitle, bool, error) {
+	const op = "SubtitleService.PutSubtitle"
+
+	language, ok := normalizeLanguage(language)
+	if !ok {
+		return nil, false, apperrors.E(op, ErrInvalidSubtitleLanguage)
+	}
+	label = strings.TrimSpace(label)
+	if label == "" {
+		label = language
+	}
+	if len([]rune(label)) > maxSubtitleLabelLength {
+		return nil, false, apperrors.E(op, ErrInvalidSubtitleLabel)
+	}
+	if len(data) > MaxSubtitleSize {
+		return nil, false, apperrors.E(op, ErrSubtitleTooLarge)
+	}
+	content, format, err := subtitle.ToWebVTT(data)
+	if err != nil {
+		return nil, false, apperrors.E(op, err)
+	}
+
+	track := &models.Subtitle{
+		MovieID:  movieID,
+		Language: language,
+		Label:    label,
+		Format:   format,
+		Content:  content,
+	}
+	created := false
+	err = runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		// Locking the movie serialises uploads of its tracks
+		if err := lockMovie(ctx, tx, movieID, false); err != nil {
+			return err
+		}
+
+		var existing models.Subtitle
+		err := tx.NewSelect().
+			Model(&existing).
+			Column("id", "created_at").
+			Where("movie_id = ? AND language = ?", movieID, language).
+			Scan(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		now := s.now()
+		track.UpdatedAt = now
+		if existing.ID == 0 {
+			created = true
+			track.CreatedAt = now
+			_, err := tx.NewInsert().Model(track).Exec(ctx)
+			return err
+		}
+
+		track.ID = existing.ID
+		track.CreatedAt = existing.CreatedAt
+		_, err = tx.NewUpdate().
+			Model(track).
+			Column("label", "format", "content", "updated_at").
+			WherePK().
+			Exec(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, false, apperrors.E(op, err)
+	}
+	return track, created, nil
+}
+
+// DeleteSubtitle deletes the subtitle track of a movie in language
+func (s *SubtitleService) DeleteSubtitle(ctx context.Context, movieID int64, language string) error {
+	const op = "SubtitleService.DeleteSubtitle"
+
+	language, ok := normalizeLanguage(language)
+	if !ok {
+		return apperrors.E(op, ErrInvalidSubtitleLanguage)
+	}
+
+	err := runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewDelete().
+			Model((*models.Subtitle)(nil)).
+			Where("movie_id = ? AND language = ?", movieID, language).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrSubtitleNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// normalizeLanguage checks tag is a language tag and writes it in its
+// conventional case, such as pt-BR or zh-Hant, so each language has one
+// track whatever case it is given in
+func normalizeLanguage(tag string) (string, bool) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if len(tag) > 35 || !languageTag.MatchString(tag) {
+		return "", false
+	}
+
+	subtags := strings.Split(tag, "-")
+	subtags[0] = strings.ToLower(subtags[0])
+	for i := 1; i < len(subtags); i++ {
+		switch {
+		case len(subtags[i]) == 2:
+			subtags[i] = strings.ToUpper(subtags[i])
+		case len(subtags[i]) == 4:
+			subtags[i] = strings.ToUpper(subtags[i][:1]) + strings.ToLower(subtags[i][1:])
+		default:
+			subtags[i] = strings.ToLower(subtags[i])
+		}
+	}
+	return strings.Join(subtags, "-"), true
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
+	"github.com/ndn/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// synonymCacheTTL bounds how long other instances keep serving synonyms
+	// that were changed elsewhere; changes made through this instance
+	// invalidate its cache right away
+	synonymCacheTTL = time.Minute
+
+	maxSynonymLength       = 255
+	maxSynonymAlternatives = 20
+	// maxSearchVariants caps how many terms one search expands into
+	maxSearchVariants = 10
+)
+
+var (
+	ErrInvalidSynonym = errors.New("invalid search synonym")
+	ErrSynonymExists  = errors.New("search synonym already exists")
+)
+
+// SynonymService manages the synonym dictionary and expands search terms
+// with it. Entries are cached in memory, as every search consults them.
+type SynonymService struct {
+	db  *database.SynonymDB
+	now func() time.Time
+
+	mu       sync.RWMutex
+	entries  []*models.SearchSynonym // nil until loaded
+	loadedAt time.Time
+	// generation changes on every invalidation, so a load racing with a
+	// change does not cache what it read before the change
+	generation int
+}
+
+func NewSynonymService(db *database.SynonymDB) *SynonymService {
+	return &SynonymService{db: db, now: time.Now}
+}
+
+func (s *SynonymService) GetSynonyms(ctx context.Context) ([]*models.SearchSynonym, error) {
+	synonyms, err := s.db.GetSynonyms(ctx)
+	if err != nil {
+		return nil, apperrors.E("SynonymService.GetSynonyms", err)
+	}
+	return synonyms, nil
+}
+
+func (s *SynonymService) CreateSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	const op = "SynonymService.CreateSynonym"
+
+	if err := s.checkSynonym(ctx, synonym); err != nil {
+		return apperrors.E(op, err)
+	}
+	if dryrun.FromContext(ctx) {
+		return nil
+	}
+	if err := s.db.CreateSynonym(ctx, synonym); err != nil {
+		return apperrors.E(op, err)
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *SynonymService) UpdateSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	const op = "SynonymService.UpdateSynonym"
+
+	if err := s.checkSynonym(ctx, synonym); err != nil {
+		return apperrors.E(op, err)
+	}
+	if dryrun.FromContext(ctx) {
+		current, err := s.db.GetSynonym(ctx, synonym.ID)
+		if err != nil {
+			return apperrors.E(op, err)
+		}
+		synonym.CreatedAt = current.CreatedAt
+		return nil
+	}
+	if err := s.db.UpdateSynonym(ctx, synonym); err != nil {
+		return apperrors.E(op, err)
+	}
+	s.invalidate()
+	return nil
+}
+
+func (s *SynonymService) DeleteSynonym(ctx context.Context, id int64) error {
+	if dryrun.FromContext(ctx) {
+		if _, err := s.db.GetSynonym(ctx, id); err != nil {
+			return apperrors.E("SynonymService.DeleteSynonym", err)
+		}
+		return nil
+	}
+	if err := s.db.DeleteSynonym(ctx, id); err != nil {
+		return apperrors.E("SynonymService.DeleteSynonym", err)
+	}
+	s.invalidate()
+	return nil
+}
+
+// checkSynonym normalises an entry and checks its term is not taken by
+// another entry
+func (s *SynonymService) checkSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	synonym.Term = normalizeSearchTerm(synonym.Term)
+	if synonym.Term == "" || len(synonym.Term) > maxSynonymLength {
+		return fmt.Errorf("%w: term must be 1 to %d characters", ErrInvalidSynonym, maxSynonymLength)
+	}
+
+	seen := map[string]bool{synonym.Term: true}
+	alternatives := make([]string, 0, len(synonym.Alternatives))
+	for _, alt := range synonym.Alternatives {
+		alt = normalizeSearchTerm(alt)
+		if len(alt) > maxSynonymLength {
+			return fmt.Errorf("%w: alternatives must be at most %d characters", ErrInvalidSynonym, maxSynonymLength)
+		}
+		if alt != "" && !seen[alt] {
+			seen[alt] = true
+			alternatives = append(alternatives, alt)
+		}
+	}
+	if len(alternatives) == 0 || len(alternatives) > maxSynonymAlternatives {
+		return fmt.Errorf("%w: between 1 and %d alternatives are required", ErrInvalidSynonym, maxSynonymAlternatives)
+	}
+	synonym.Alternatives = alternatives
+
+	exists, err := s.db.SynonymExists(ctx, synonym.Term, synonym.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrSynonymExists
+	}
+	return nil
+}
+
+// Expand returns the normalised term followed by the variants the dictionary
+// derives from it: for each entry whose term appears in it as whole words,
+// the term with that phrase replaced by each alternative
+func (s *SynonymService) Expand(ctx context.Context, term string) ([]string, error) {
+	entries, err := s.load(ctx)
+	if err != nil {
+		return nil, apperrors.E("SynonymService.Expand", err)
+	}
+
+	term = normalizeSearchTerm(term)
+	variants := []string{term}
+	seen := map[string]bool{term: true}
+	padded := " " + term + " "
+	for _, entry := range entries {
+		phrase := " " + entry.Term + " "
+		if !strings.Contains(padded, phrase) {
+			continue
+		}
+		for _, alt := range entry.Alternatives {
+			variant := strings.TrimSpace(strings.Replace(padded, phrase, " "+alt+" ", 1))
+			if !seen[variant] && len(variants) < maxSearchVariants {
+				seen[variant] = true
+				variants = append(variants, variant)
+			}
+		}
+	}
+	return variants, nil
+}
+
+// load returns the cached entries in term order, reloading them once they
+// have expired
+func (s *SynonymService) load(ctx context.Context) ([]*models.SearchSynonym, error) {
+	s.mu.RLock()
+	entries, loadedAt, generation := s.entries, s.loadedAt, s.generation
+	s.mu.RUnlock()
+	if entries != nil && s.now().Sub(loadedAt) < synonymCacheTTL {
+		return entries, nil
+	}
+
+	entries, err := s.db.GetSynonyms(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if entries == nil {
+		entries = []*models.SearchSynonym{}
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.entries = entries
+		s.loadedAt = s.now()
+	}
+	s.mu.Unlock()
+	return entries, nil
+}
+
+// invalidate drops the cached entries so the next search reloads them
+func (s *SynonymService) invalidate() {
+	s.mu.Lock()
+	s.entries = nil
+	s.generation++
+	s.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// Trash schedule when not configured
+const (
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval = time.Hour
+)
+
+// TrashService removes deleted movies and categories for good once they
+// have been deleted longer than the retention period. Until then admins can
+// restore them. Deleted accounts are purged by UserService on their own
+// schedule.
+type TrashService struct {
+	db            *bun.DB
+	categories    *database.CategoryDB
+	cache         cache.Cache
+	retention     time.Duration
+	purgeInterval time.Duration
+	logger        *zap.Logger
+	now           func() time.Time
+}
+
+func NewTrashService(db *bun.DB, categories *database.CategoryDB, c cache.Cache, cfg config.TrashConfig, logger *zap.Logger) *TrashService {
+	retention := cfg.Retention
+	if retention <= 0 {
+		retention = defaultTrashRetention
+	}
+	purgeInterval := cfg.PurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = defaultTrashPurgeInterval
+	}
+
+	return &TrashService{
+		db:            db,
+		categories:    categories,
+		cache:         c,
+		retention:     retention,
+		purgeInterval: purgeInterval,
+		logger:        logger,
+		now:           time.Now,
+	}
+}
+
+// Run purges the trash on startup and then every purge interval until ctx
+// is cancelled
+func (s *TrashService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Purge(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("trash purge failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Purge removes the movies and categories deleted longer than the retention
+// period ago for good. Movies go first, with their category links and
+// favorites; the rest of their data is deleted by the database along with
+// them.
+func (s *TrashService) Purge(ctx context.Context) error {
+	const op = "TrashService.Purge"
+
+	before := s.now().Add(-s.retention)
+
+	movies, err := s.purgeMovies(ctx, before)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if movies > 0 {
+		invalidateMovies(ctx, s.cache)
+		s.logger.Info("purged deleted movies", zap.Int64("count", movies))
+	}
+
+	categories, err := s.categories.PurgeDeletedCategories(ctx, before)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if categories > 0 {
+		s.logger.Info("purged deleted categories", zap.Int64("count", categories))
+	}
+	return nil
+}
+
+// purgeMovies deletes the movies deleted before before and returns how many
+// it deleted
+func (s *TrashService) purgeMovies(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		matching := tx.NewSelect().
+			Model((*models.Movie)(nil)).
+			Column("id").
+			WhereDeleted().
+			Where("deleted_at < ?", before)
+
+		_, err := tx.NewDelete().
+			Model((*models.MovieCategory)(nil)).
+			Where("movie_id IN (?)", matching).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewDelete().
+			Model((*models.UserFavorite)(nil)).
+			Where("movie_id IN (?)", matching).
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.NewDelete().
+			Model((*models.Movie)(nil)).
+			WhereDeleted().
+			Where("deleted_at < ?", before).
+			ForceDelete().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
+	"github.com/ndn/internal/models"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Bounds of the trending settings admins may choose
+const (
+	maxTrendingWindowDays = 365
+	maxTrendingAgeGravity = 4
+)
+
+// TrendingWindows are the windows, in days, trending movies can be listed
+// over besides the configured one
+var TrendingWindows = []int{1, 7, 30}
+
+var (
+	ErrInvalidTrendingSettings = errors.New("invalid trending settings")
+	ErrInvalidTrendingWindow   = errors.New("invalid trending window")
+)
+
+// TrendingService periodically scores movies by their recent plays, each
+// day's plays decaying exponentially with its age, normalised by how long
+// the movie has been in the catalog so new titles can surface. Scores are
+// stored so listing trending movies is a single indexed query.
+type TrendingService struct {
+	db       *database.TrendingDB
+	logger   *zap.Logger
+	interval time.Duration
+	defaults models.TrendingSettings
+	// recompute is signalled when the settings change
+	recompute chan struct{}
+	now       func() time.Time
+}
+
+func NewTrendingService(db *database.TrendingDB, cfg config.TrendingConfig, logger *zap.Logger) *TrendingService {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 15 * time.Minute
+	}
+	halfLife := cfg.HalfLife
+	if halfLife <= 0 {
+		halfLife = 72 * time.Hour
+	}
+	window := cfg.Window
+	if window <= 0 {
+		window = 30 * 24 * time.Hour
+	}
+
+	return &TrendingService{
+		db:       db,
+		logger:   logger,
+		interval: interval,
+		defaults: models.TrendingSettings{
+			HalfLifeHours: halfLife.Hours(),
+			WindowDays:    int(window / (24 * time.Hour)),
+			AgeGravity:    cfg.AgeGravity,
+		},
+		recompute: make(chan struct{}, 1),
+		now:       time.Now,
+	}
+}
+
+// Run computes scores on startup, then every interval and whenever the
+// settings change, until ctx is cancelled
+func (s *TrendingService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("trending computation failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.recompute:
+		}
+	}
+}
+
+// RunOnce recomputes every movie's trending score with the current settings
+func (s *TrendingService) RunOnce(ctx context.Context) error {
+	const op = "TrendingService.RunOnce"
+
+	settings, err := s.Settings(ctx)
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+	if err := s.db.ComputeScores(ctx, settings, TrendingWindows, s.now()); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// Settings returns the settings saved by an admin, or the configured
+// defaults
+func (s *TrendingService) Settings(ctx context.Context) (*models.TrendingSettings, error) {
+	settings, err := s.db.GetSettings(ctx)
+	if err != nil {
+		return nil, apperrors.E("TrendingService.Settings", err)
+	}
+	if settings == nil {
+		defaults := s.defaults
+		return &defaults, nil
+	}
+	return settings, nil
+}
+
+// UpdateSettings validates and saves new settings, then has scores
+// recomputed with them in the background
+func (s *TrendingService) UpdateSettings(ctx context.Context, settings *models.TrendingSettings) error {
+	const op = "TrendingService.UpdateSettings"
+
+	switch {
+	case settings.HalfLifeHours <= 0:
+		return apperrors.Errorf(op, "%w: half_life_hours must be positive", ErrInvalidTrendingSettings)
+	case settings.WindowDays < 1 || settings.WindowDays > maxTrendingWindowDays:
+		return apperrors.Errorf(op, "%w: window_days must be between 1 and %d", ErrInvalidTrendingSettings, maxTrendingWindowDays)
+	case settings.AgeGravity < 0 || settings.AgeGravity > maxTrendingAgeGravity:
+		return apperrors.Errorf(op, "%w: age_gravity must be between 0 and %d", ErrInvalidTrendingSettings, maxTrendingAgeGravity)
+	}
+	if dryrun.FromContext(ctx) {
+		return nil
+	}
+
+	if err := s.db.SaveSettings(ctx, settings); err != nil {
+		return apperrors.E(op, err)
+	}
+
+	select {
+	case s.recompute <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// TrendingMovies returns up to limit movies by descending trending score
+// over the last windowDays days, one of TrendingWindows, or over the
+// configured window when windowDays is 0
+func (s *TrendingService) TrendingMovies(ctx context.Context, windowDays, limit int) ([]models.Movie, error) {
+	const op = "TrendingService.TrendingMovies"
+
+	if windowDays == 0 {
+		movies, err := s.db.TrendingMovies(ctx, limit)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		return movies, nil
+	}
+
+	if !slices.Contains(TrendingWindows, windowDays) {
+		return nil, apperrors.E(op, ErrInvalidTrendingWindow)
+	}
+	movies, err := s.db.WindowTrendingMovies(ctx, windowDays, limit)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movies, nil
+}
@@ -2,47 +2,436 @@ package services
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/config"
 	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/dryrun"
 	"github.com/ndn/internal/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidRole = errors.New("invalid user role")
+	ErrEmailTaken  = errors.New("email already registered")
+	// ErrUserSuspended is returned when a suspended user signs in or uses
+	// one of their tokens
+	ErrUserSuspended = errors.New("user suspended")
+	// ErrAccountDeleted is returned when signing in to an account its user
+	// deleted, before it is purged
+	ErrAccountDeleted = errors.New("account deleted")
+	// ErrInvalidDateOfBirth is returned for dates of birth in the future or
+	// before 1900
+	ErrInvalidDateOfBirth = errors.New("invalid date of birth")
+	// ErrSelfModification is returned when admins try to demote, suspend or
+	// delete themselves, which could leave nobody to undo it
+	ErrSelfModification = errors.New("admins cannot demote, suspend or delete themselves")
+)
+
+// Sizes of the pages of ListUsers
+const (
+	DefaultUserPageSize = 20
+	MaxUserPageSize     = 100
+)
+
+// UserStatusUpdate changes whether a user is an admin and whether they are
+// suspended. Nil fields are left as they are.
+type UserStatusUpdate struct {
+	IsAdmin   *bool
+	Suspended *bool
+}
+
+// Account deletion schedule when not configured
+const (
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+	defaultPurgeInterval       = time.Hour
 )
 
+// UserService manages users on behalf of admins, stores the avatars users
+// upload, and removes the accounts their users deleted for good once the
+// deletion grace period is over
 type UserService struct {
-	db *database.UserDB
+	db            *database.UserDB
+	hasher        PasswordHasher
+	storage       *StorageService
+	policy        config.PasswordPolicy
+	gracePeriod   time.Duration
+	purgeInterval time.Duration
+	logger        *zap.Logger
+	now           func() time.Time
 }
 
-func NewUserService(db *database.UserDB) *UserService {
+func NewUserService(db *database.UserDB, hasher PasswordHasher, storage *StorageService, passwordCfg config.PasswordConfig, accountsCfg config.AccountsConfig, logger *zap.Logger) *UserService {
+	gracePeriod := accountsCfg.DeletionGracePeriod
+	if gracePeriod <= 0 {
+		gracePeriod = defaultDeletionGracePeriod
+	}
+	purgeInterval := accountsCfg.PurgeInterval
+	if purgeInterval <= 0 {
+		purgeInterval = defaultPurgeInterval
+	}
+
 	return &UserService{
-		db: db,
+		db:            db,
+		hasher:        hasher,
+		storage:       storage,
+		policy:        passwordPolicy(passwordCfg.Policy),
+		gracePeriod:   gracePeriod,
+		purgeInterval: purgeInterval,
+		logger:        logger,
+		now:           time.Now,
+	}
+}
+
+// Run purges deleted accounts on startup and then every purge interval until
+// ctx is cancelled
+func (s *UserService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PurgeDeletedAccounts(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("account purge failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeDeletedAccounts removes the accounts deleted longer than the grace
+// period ago for good, with their favorites, watch history and the rest of
+// their data
+func (s *UserService) PurgeDeletedAccounts(ctx context.Context) error {
+	const op = "UserService.PurgeDeletedAccounts"
+
+	n, err := s.db.PurgeDeletedUsers(ctx, s.now().Add(-s.gracePeriod))
+	if err != nil {
+		return apperrors.E(op, err)
 	}
+	if n > 0 {
+		s.logger.Info("purged deleted accounts", zap.Int64("count", n))
+	}
+	return nil
+}
+
+// PasswordPolicy returns what the passwords of created users must be
+func (s *UserService) PasswordPolicy() config.PasswordPolicy {
+	return s.policy
 }
 
 func (s *UserService) GetUser(ctx context.Context, id int64) (*models.User, error) {
+	const op = "UserService.GetUser"
+
 	user, err := s.db.GetUser(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, apperrors.E(op, err)
 	}
 	return user, nil
 }
 
-func (s *UserService) ListUsers(ctx context.Context) ([]*models.User, error) {
-	users, err := s.db.ListUsers(ctx)
+// UserFilter selects a page of the users ListUsers returns
+type UserFilter struct {
+	Query          string     `json:"q,omitempty"` // part of the email or name
+	IsAdmin        *bool      `json:"is_admin,omitempty"`
+	CreatedAfter   *time.Time `json:"created_after,omitempty"`
+	CreatedBefore  *time.Time `json:"created_before,omitempty"`
+	IncludeDeleted bool       `json:"include_deleted,omitempty"` // deleted accounts too, until purged
+	Page           int        `json:"page,omitempty"`
+	PageSize       int        `json:"page_size,omitempty"`
+}
+
+// ListUsers returns a page of the users filter matches, newest first, and
+// how many match in total. Pages hold 20 users unless set, and at most
+// MaxUserPageSize.
+func (s *UserService) ListUsers(ctx context.Context, filter UserFilter) ([]*models.User, int, error) {
+	const op = "UserService.ListUsers"
+
+	if filter.Page <= 0 {
+		filter.Page = 1
+	}
+	if filter.PageSize <= 0 {
+		filter.PageSize = DefaultUserPageSize
+	}
+	if filter.PageSize > MaxUserPageSize {
+		filter.PageSize = MaxUserPageSize
+	}
+
+	users, total, err := s.db.ListUsers(ctx, database.UserFilter{
+		Query:         filter.Query,
+		IsAdmin:       filter.IsAdmin,
+		CreatedAfter:  filter.CreatedAfter,
+		CreatedBefore: filter.CreatedBefore,
+		WithDeleted:   filter.IncludeDeleted,
+		Limit:         filter.PageSize,
+		Offset:        (filter.Page - 1) * filter.PageSize,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
+		return nil, 0, apperrors.E(op, err)
 	}
-	return users, nil
+	return users, total, nil
 }
 
 func (s *UserService) UpdateUser(ctx context.Context, id int64, name string) (*models.User, error) {
+	const op = "UserService.UpdateUser"
+
 	user, err := s.db.GetUser(ctx, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, apperrors.E(op, err)
 	}
 
 	user.Name = name
 	if err := s.db.UpdateUser(ctx, user); err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+		return nil, apperrors.E(op, err)
+	}
+
+	return user, nil
+}
+
+// SetAvatar stores image, resized to the AvatarSizes, as the avatar of the
+// user with id and returns the user with their new avatar
+func (s *UserService) SetAvatar(ctx context.Context, id int64, image []byte) (*models.User, error) {
+	const op = "UserService.SetAvatar"
+
+	if _, err := s.db.GetUser(ctx, id); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	urls, err := s.storage.StoreAvatar(ctx, id, image)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.db.SetAvatar(ctx, id, urls[DefaultAvatarSize], urls, s.now()); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	user, err := s.db.GetUser(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return user, nil
+}
+
+// ProfileDetails are the personal details of a user. A nil DateOfBirth
+// clears it.
+type ProfileDetails struct {
+	Bio         string
+	Avatar      string
+	DateOfBirth *time.Time
+}
+
+// GetProfileDetails returns the profile of the user with id, empty when
+// they have not filled it in yet
+func (s *UserService) GetProfileDetails(ctx context.Context, id int64) (*models.UserProfile, error) {
+	const op = "UserService.GetProfileDetails"
+
+	user, err := s.db.GetUser(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if user.Profile == nil {
+		return &models.UserProfile{UserID: user.ID}, nil
+	}
+	return user.Profile, nil
+}
+
+// UpdateProfileDetails replaces the personal details of the user with id,
+// creating their profile the first time. Setting an avatar URL other than
+// the uploaded avatar's drops the uploaded sizes.
+func (s *UserService) UpdateProfileDetails(ctx context.Context, id int64, details ProfileDetails) (*models.UserProfile, error) {
+	const op = "UserService.UpdateProfileDetails"
+
+	now := s.now()
+	if details.DateOfBirth != nil && (details.DateOfBirth.After(now) || details.DateOfBirth.Year() < 1900) {
+		return nil, apperrors.E(op, ErrInvalidDateOfBirth)
 	}
 
+	profile, err := s.GetProfileDetails(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if details.Avatar != profile.Avatar {
+		profile.AvatarURLs = nil
+	}
+	profile.Bio = details.Bio
+	profile.Avatar = details.Avatar
+	profile.DateOfBirth = time.Time{}
+	if details.DateOfBirth != nil {
+		profile.DateOfBirth = *details.DateOfBirth
+	}
+	if profile.CreatedAt.IsZero() {
+		profile.CreatedAt = now
+	}
+	profile.UpdatedAt = now
+
+	if err := s.db.SaveProfileDetails(ctx, profile); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return profile, nil
+}
+
+// MaxAvatarSize is the largest avatar accepted, in bytes
+func (s *UserService) MaxAvatarSize() int64 {
+	return s.storage.MaxAvatarSize()
+}
+
+// SetRole gives a user the viewer, editor or publisher role in the content
+// workflow
+func (s *UserService) SetRole(ctx context.Context, id int64, role string) (*models.User, error) {
+	const op = "UserService.SetRole"
+
+	switch role {
+	case models.RoleViewer, models.RoleEditor, models.RolePublisher:
+	default:
+		return nil, apperrors.E(op, ErrInvalidRole)
+	}
+
+	if dryrun.FromContext(ctx) {
+		user, err := s.db.GetUser(ctx, id)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		user.Role = role
+		return user, nil
+	}
+
+	user, err := s.db.SetRole(ctx, id, role)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return user, nil
+}
+
+// CreateUser creates a user, an admin when isAdmin, on behalf of an admin.
+// The password must meet the password policy.
+func (s *UserService) CreateUser(ctx context.Context, email, password, name string, isAdmin bool) (*models.User, error) {
+	const op = "UserService.CreateUser"
+
+	if err := checkPassword(s.policy, password); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	exists, err := s.db.UserExists(ctx, email)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if exists {
+		return nil, apperrors.E(op, ErrEmailTaken)
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return nil, apperrors.Errorf(op, "failed to hash password: %w", err)
+	}
+	now := s.now()
+	user := &models.User{
+		Email:     email,
+		Password:  hashedPassword,
+		Name:      name,
+		IsAdmin:   isAdmin,
+		Role:      models.RoleViewer,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if dryrun.FromContext(ctx) {
+		return user, nil
+	}
+
+	if err := s.db.CreateUser(ctx, user); err != nil {
+		return nil, apperrors.Errorf(op, "failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// UpdateStatus promotes a user to admin or demotes them, and suspends or
+// activates them. Admins cannot demote or suspend themselves.
+func (s *UserService) UpdateStatus(ctx context.Context, id int64, update UserStatusUpdate) (*models.User, error) {
+	const op = "UserService.UpdateStatus"
+
+	if id == UserIDFromContext(ctx) &&
+		(update.IsAdmin != nil && !*update.IsAdmin || update.Suspended != nil && *update.Suspended) {
+		return nil, apperrors.E(op, ErrSelfModification)
+	}
+
+	user, err := s.db.GetUser(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if update.IsAdmin != nil {
+		user.IsAdmin = *update.IsAdmin
+	}
+	if update.Suspended != nil {
+		switch {
+		case !*update.Suspended:
+			user.SuspendedAt = nil
+		case user.SuspendedAt == nil:
+			now := s.now()
+			user.SuspendedAt = &now
+		}
+	}
+	if dryrun.FromContext(ctx) {
+		return user, nil
+	}
+
+	if err := s.db.SetStatus(ctx, user); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return user, nil
+}
+
+// DeleteUser deletes a user, who can no longer sign in, like deleting their
+// account themselves. The account can be restored during the deletion grace
+// period, after which it is purged with everything they own, such as their
+// favorites, watch history, profiles and reviews. Admins cannot delete
+// themselves.
+func (s *UserService) DeleteUser(ctx context.Context, id int64) error {
+	const op = "UserService.DeleteUser"
+
+	if id == UserIDFromContext(ctx) {
+		return apperrors.E(op, ErrSelfModification)
+	}
+	if dryrun.FromContext(ctx) {
+		if _, err := s.db.GetUser(ctx, id); err != nil {
+			return apperrors.E(op, err)
+		}
+		return nil
+	}
+
+	if err := s.db.DeleteUser(ctx, id, s.now()); err != nil {
+		return apperrors.E(op, err)
+	}
+	return nil
+}
+
+// RestoreUser undoes the deletion of a user's account before it is purged,
+// returning ErrNotDeleted if it is not deleted
+func (s *UserService) RestoreUser(ctx context.Context, id int64) (*models.User, error) {
+	const op = "UserService.RestoreUser"
+
+	if _, err := s.db.GetUser(ctx, id); err == nil {
+		return nil, apperrors.E(op, ErrNotDeleted)
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return nil, apperrors.E(op, err)
+	}
+
+	if dryrun.FromContext(ctx) {
+		user, err := s.db.GetUserWithDeleted(ctx, id)
+		if err != nil {
+			return nil, apperrors.E(op, err)
+		}
+		user.DeletedAt = time.Time{}
+		return user, nil
+	}
+
+	if err := s.db.RestoreUser(ctx, id, s.now()); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	user, err := s.db.GetUser(ctx, id)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
 	return user, nil
 }
@@ -0,0 +1,376 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/notifications"
+	"github.com/ndn/internal/transcode"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultVideoUploadTimeout = 2 * time.Hour
+	defaultVideoUploadExpiry  = time.Hour
+	defaultTranscodePoll      = 10 * time.Second
+	defaultTranscodeTimeout   = 2 * time.Hour
+	defaultTranscodeAttempts  = 3
+)
+
+var (
+	ErrVideoTooLarge     = errors.New("video is too large")
+	ErrUnsupportedVideo  = errors.New("unsupported video type")
+	ErrVideoProcessing   = errors.New("the movie's video is being processed")
+	ErrVideoNotUploading = errors.New("no video upload was started for the movie")
+	ErrVideoNotUploaded  = errors.New("the video has not been uploaded")
+)
+
+// VideoUpload is a presigned URL the video of a movie is uploaded to, with
+// a PUT request, until it expires
+type VideoUpload struct {
+	UploadURL string    `json:"upload_url"`
+	Method    string    `json:"method" example:"PUT"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// VideoProcessing reports the processing state of a movie's video and its
+// latest transcoding job. VideoURL is the video played, which stays the
+// previous one until a new upload is ready.
+type VideoProcessing struct {
+	MovieID  int64                `json:"movie_id"`
+	Status   string               `json:"status,omitempty" example:"processing"`
+	VideoURL string               `json:"video_url"`
+	Error    string               `json:"error,omitempty"`
+	Job      *models.TranscodeJob `json:"job,omitempty"`
+}
+
+// VideoService takes video uploads for movies, directly or to presigned
+// storage URLs, and transcodes them into HLS renditions. Transcoding jobs
+// are queued in the database and run by Run in the instances configured to
+// transcode.
+type VideoService struct {
+	db            *database.VideoDB
+	storage       *StorageService
+	transcoder    *transcode.FFmpeg
+	cache         cache.Cache
+	notifications *notifications.Hub
+	cfg           config.VideoConfig
+	logger        *zap.Logger
+	wake          chan struct{}
+	now           func() time.Time
+}
+
+func NewVideoService(db *database.VideoDB, storage *StorageService, c cache.Cache, hub *notifications.Hub, cfg config.VideoConfig, logger *zap.Logger) *VideoService {
+	if cfg.UploadTimeout <= 0 {
+		cfg.UploadTimeout = defaultVideoUploadTimeout
+	}
+	if cfg.UploadURLExpiry <= 0 {
+		cfg.UploadURLExpiry = defaultVideoUploadExpiry
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultTranscodePoll
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = defaultTranscodeTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultTranscodeAttempts
+	}
+
+	return &VideoService{
+		db:            db,
+		storage:       storage,
+		transcoder:    transcode.New(cfg),
+		cache:         c,
+		notifications: hub,
+		cfg:           cfg,
+		logger:        logger,
+		wake:          make(chan struct{}, 1),
+		now:           time.Now,
+	}
+}
+
+// MaxUploadSize is the largest video accepted, in bytes, or zero for no
+// limit
+func (s *VideoService) MaxUploadSize() int64 {
+	return s.cfg.MaxUploadSize
+}
+
+// UploadTimeout is how long a direct upload may take
+func (s *VideoService) UploadTimeout() time.Duration {
+	return s.cfg.UploadTimeout
+}
+
+// Upload stores the video read from r, of size bytes or -1 when unknown, as
+// the new video of a movie and queues it for transcoding
+func (s *VideoService) Upload(ctx context.Context, movieID int64, contentType string, r io.Reader, size int64) (*VideoProcessing, error) {
+	const op = "VideoService.Upload"
+
+	if !strings.HasPrefix(contentType, "video/") {
+		return nil, apperrors.E(op, ErrUnsupportedVideo)
+	}
+	if s.cfg.MaxUploadSize > 0 && size > s.cfg.MaxUploadSize {
+		return nil, apperrors.E(op, ErrVideoTooLarge)
+	}
+	key, err := s.startUpload(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	if err := s.storage.upload(ctx, key, contentType, r, size); err != nil {
+		// The request may be gone, but the failure must still be recorded
+		failCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		if failErr := s.db.FailUpload(failCtx, movieID, key, "upload failed", s.now()); failErr != nil {
+			s.logger.Error("failed to record failed video upload", zap.Int64("movie_id", movieID), zap.Error(failErr))
+		}
+		invalidateMovies(failCtx, s.cache)
+		return nil, apperrors.E(op, err)
+	}
+
+	return s.enqueue(ctx, op, movieID, key)
+}
+
+// CreateUpload starts an upload of a new video for a movie and returns the
+// presigned URL it is uploaded to. CompleteUpload queues the video for
+// transcoding once it has been uploaded.
+func (s *VideoService) CreateUpload(ctx context.Context, movieID int64) (*VideoUpload, error) {
+	const op = "VideoService.CreateUpload"
+
+	key, err := s.startUpload(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	url, err := s.storage.presignUpload(ctx, key, s.cfg.UploadURLExpiry)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	return &VideoUpload{
+		UploadURL: url,
+		Method:    "PUT",
+		ExpiresAt: s.now().Add(s.cfg.UploadURLExpiry),
+	}, nil
+}
+
+// CompleteUpload checks that the video of the upload started by
+// CreateUpload has arrived and queues it for transcoding
+func (s *VideoService) CompleteUpload(ctx context.Context, movieID int64) (*VideoProcessing, error) {
+	const op = "VideoService.CompleteUpload"
+
+	if !s.storage.Enabled() {
+		return nil, apperrors.E(op, ErrStorageDisabled)
+	}
+	movie, err := s.db.GetVideo(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if movie.VideoStatus != models.VideoStatusUploading || movie.VideoSourceKey == "" {
+		return nil, apperrors.E(op, ErrVideoNotUploading)
+	}
+
+	size, err := s.storage.objectSize(ctx, movie.VideoSourceKey)
+	if errors.Is(err, errObjectNotFound) {
+		return nil, apperrors.E(op, ErrVideoNotUploaded)
+	}
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if s.cfg.MaxUploadSize > 0 && size > s.cfg.MaxUploadSize {
+		return nil, apperrors.E(op, ErrVideoTooLarge)
+	}
+
+	return s.enqueue(ctx, op, movieID, movie.VideoSourceKey)
+}
+
+// Status returns the processing state of a movie's video
+func (s *VideoService) Status(ctx context.Context, movieID int64) (*VideoProcessing, error) {
+	const op = "VideoService.Status"
+
+	movie, err := s.db.GetVideo(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	job, err := s.db.LatestJob(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	return &VideoProcessing{
+		MovieID:  movie.ID,
+		Status:   movie.VideoStatus,
+		VideoURL: movie.VideoURL,
+		Error:    movie.VideoError,
+		Job:      job,
+	}, nil
+}
+
+// startUpload picks the storage key of a new upload for a movie and marks
+// its video as uploading. A video still being transcoded cannot be
+// replaced.
+func (s *VideoService) startUpload(ctx context.Context, movieID int64) (string, error) {
+	if !s.storage.Enabled() {
+		return "", ErrStorageDisabled
+	}
+	movie, err := s.db.GetVideo(ctx, movieID)
+	if err != nil {
+		return "", err
+	}
+	if movie.VideoStatus == models.VideoStatusProcessing {
+		return "", ErrVideoProcessing
+	}
+
+	name, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("videos/movies/%d/source/%s", movieID, name)
+	if err := s.db.StartUpload(ctx, movieID, key, s.now()); err != nil {
+		return "", err
+	}
+	invalidateMovies(ctx, s.cache)
+	return key, nil
+}
+
+// enqueue queues the upload at key for transcoding and wakes the local
+// worker, if any
+func (s *VideoService) enqueue(ctx context.Context, op string, movieID int64, key string) (*VideoProcessing, error) {
+	job, err := s.db.Enqueue(ctx, movieID, key, s.now())
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	invalidateMovies(ctx, s.cache)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+
+	video, err := s.Status(ctx, movieID)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	video.Job = job
+	return video, nil
+}
+
+// Run transcodes queued videos, one at a time, until ctx is cancelled. It
+// only runs in instances configured to transcode.
+func (s *VideoService) Run(ctx context.Context) {
+	if !s.cfg.Transcode || !s.storage.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(s.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		now := s.now()
+		if err := s.db.RequeueStale(ctx, now.Add(-s.cfg.JobTimeout), s.cfg.MaxAttempts, now); err != nil && ctx.Err() == nil {
+			s.logger.Error("failed to requeue stale transcoding jobs", zap.Error(err))
+		}
+		for ctx.Err() == nil {
+			job, err := s.db.ClaimJob(ctx, s.now())
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("failed to claim transcoding job", zap.Error(err))
+				}
+				break
+			}
+			if job == nil {
+				break
+			}
+			s.process(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// process runs a claimed job and records its outcome. A job interrupted by
+// shutdown is released for another worker instead.
+func (s *VideoService) process(ctx context.Context, job *models.TranscodeJob) {
+	logger := s.logger.With(zap.Int64("job_id", job.ID), zap.Int64("movie_id", job.MovieID))
+	logger.Info("transcoding video", zap.Int("attempt", job.Attempts))
+
+	jobCtx, cancel := context.WithTimeout(ctx, s.cfg.JobTimeout)
+	videoURL, err := s.transcode(jobCtx, job)
+	cancel()
+
+	// Record the outcome even when shutting down
+	finishCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+
+	if ctx.Err() != nil {
+		if err := s.db.ReleaseJob(finishCtx, job.ID); err != nil {
+			logger.Error("failed to release transcoding job", zap.Error(err))
+		}
+		return
+	}
+
+	if err != nil {
+		logger.Error("transcoding failed", zap.Error(err))
+	}
+	if err := s.db.FinishJob(finishCtx, job, videoURL, err, s.now()); err != nil {
+		logger.Error("failed to record transcoding job", zap.Error(err))
+		return
+	}
+	invalidateMovies(finishCtx, s.cache)
+	if err == nil {
+		logger.Info("video ready", zap.String("video_url", videoURL))
+	}
+
+	// Tell the admins watching over uploads
+	event, data := notifications.EventVideoReady, videoNotification{MovieID: job.MovieID, JobID: job.ID}
+	if err != nil {
+		event, data.Error = notifications.EventVideoFailed, "transcoding failed"
+	}
+	if err := s.notifications.Publish(finishCtx, notifications.Admins, event, data); err != nil {
+		logger.Warn("failed to publish video notification", zap.Error(err))
+	}
+}
+
+// transcode downloads the source of job to the work directory, transcodes it
+// and uploads the renditions, returning the URL of their master playlist.
+// Each job gets its own prefix, so the renditions of a previous upload keep
+// playing until the movie switches over.
+func (s *VideoService) transcode(ctx context.Context, job *models.TranscodeJob) (string, error) {
+	const op = "VideoService.transcode"
+
+	dir, err := os.MkdirTemp(s.cfg.WorkDir, "transcode-")
+	if err != nil {
+		return "", apperrors.E(op, err)
+	}
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "source")
+	if err := s.storage.download(ctx, job.SourceKey, source); err != nil {
+		return "", apperrors.E(op, err)
+	}
+	out := filepath.Join(dir, "hls")
+	if err := s.transcoder.HLS(ctx, source, out); err != nil {
+		return "", apperrors.E(op, err)
+	}
+
+	prefix := fmt.Sprintf("videos/movies/%d/hls/%d", job.MovieID, job.ID)
+	if err := s.storage.uploadDir(ctx, prefix, out); err != nil {
+		return "", apperrors.E(op, err)
+	}
+	return s.storage.objectURL(prefix + "/" + transcode.MasterPlaylist), nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"github.com/ndn/internal/apperrors"
+	"time"
+)
+
+// Periods personal viewing statistics are reported over
+const (
+	ViewingPeriodMonth = "month"
+	ViewingPeriodYear  = "year"
+)
+
+// maxFavoriteGenres caps the genres listed in viewing statistics
+const maxFavoriteGenres = 5
+
+// FavoriteGenre is a category a user spent time watching
+type FavoriteGenre struct {
+	Category     string `json:"category" example:"Drama"`
+	Titles       int64  `json:"titles" example:"12"`
+	WatchSeconds int64  `json:"watch_seconds" example:"54000"`
+}
+
+// Streak is a run of consecutive days with something watched. From and To
+// are omitted when Days is 0.
+type Streak struct {
+	Days int        `json:"days" example:"6"`
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// ViewingStats sums up a user's viewing over a month or a year
+type ViewingStats struct {
+	Period          Period          `json:"period"`
+	WatchSeconds    int64           `json:"watch_seconds" example:"412800"`
+	TitlesWatched   int64           `json:"titles_watched" example:"48"`
+	TitlesCompleted int64           `json:"titles_completed" example:"31"`
+	ActiveDays      int             `json:"active_days" example:"97"`
+	FavoriteGenres  []FavoriteGenre `json:"favorite_genres"`
+	LongestStreak   Streak          `json:"longest_streak"`
+	CurrentStreak   Streak          `json:"current_streak"`
+}
+
+// ViewingPeriod returns the calendar month or year a user's viewing is
+// reported over. Month is ignored for years.
+func ViewingPeriod(kind string, year, month int) (Period, error) {
+	if year < 1 || year > 9999 {
+		return Period{}, ErrInvalidPeriod
+	}
+
+	switch kind {
+	case ViewingPeriodYear:
+		from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return NewPeriod(from, from.AddDate(1, 0, -1))
+	case ViewingPeriodMonth:
+		if month < 1 || month > 12 {
+			return Period{}, ErrInvalidPeriod
+		}
+		from := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		return NewPeriod(from, from.AddDate(0, 1, -1))
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+// UserStats reports the viewing of userID over the period:
+// watch time, titles watched and completed, favorite genres and streaks.
+// Stats come from the daily rollup, so today's viewing shows up tomorrow.
+func (s *AnalyticsService) UserStats(ctx context.Context, userID int64, p Period) (*ViewingStats, error) {
+	const op = "AnalyticsService.UserStats"
+
+	viewing, err := s.db.UserViewing(ctx, userID, p.From, p.To)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	genres, err := s.db.UserGenres(ctx, userID, p.From, p.To, maxFavoriteGenres)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	days, err := s.db.UserActiveDays(ctx, userID, p.From, p.To)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	today := startOfDay(s.now())
+	latest, err := s.db.LatestUserStreak(ctx, userID, today)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	stats := &ViewingStats{
+		Period:          p,
+		WatchSeconds:    viewing.WatchSeconds,
+		TitlesWatched:   viewing.TitlesWatched,
+		TitlesCompleted: viewing.TitlesCompleted,
+		ActiveDays:      len(days),
+		FavoriteGenres:  make([]FavoriteGenre, len(genres)),
+		LongestStreak:   longestStreak(days),
+	}
+	for i, g := range genres {
+		stats.FavoriteGenres[i] = FavoriteGenre{Category: g.Category, Titles: g.Titles, WatchSeconds: g.WatchSeconds}
+	}
+	// A streak is still running if it reached yesterday, as today's viewing
+	// has not been rolled up yet
+	if latest.Days > 0 && !latest.Last.Before(today.AddDate(0, 0, -1)) {
+		from, to := latest.Last.AddDate(0, 0, -(latest.Days-1)), latest.Last
+		stats.CurrentStreak = Streak{Days: latest.Days, From: &from, To: &to}
+	}
+	return stats, nil
+}
+
+// longestStreak returns the longest run of consecutive days in days, which
+// are in order, preferring the latest of equally long runs
+func longestStreak(days []time.Time) Streak {
+	var longest Streak
+	start := 0
+	for i := range days {
+		if i > 0 && !days[i].Equal(days[i-1].AddDate(0, 0, 1)) {
+			start = i
+		}
+		if n := i - start + 1; n >= longest.Days {
+			from, to := days[start], days[i]
+			longest = Streak{Days: n, From: &from, To: &to}
+		}
+	}
+	return longest
+}
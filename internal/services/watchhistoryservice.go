@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"time"
+)
+
+const (
+	// MaxContinueWatching caps how many movies the continue watching list
+	// returns
+	MaxContinueWatching = 50
+
+	maxDeviceLength = 100
+	// finishedFraction is how far into a movie a viewer must get for it to
+	// drop off their continue watching list
+	finishedFraction = 0.95
+)
+
+var ErrInvalidProgress = errors.New("invalid playback progress")
+
+// WatchHistoryService keeps where each user stopped in each movie, so
+// playback resumes there and unfinished movies can be offered again
+type WatchHistoryService struct {
+	db     *database.WatchHistoryDB
+	movies *MovieService
+	now    func() time.Time
+}
+
+func NewWatchHistoryService(db *database.WatchHistoryDB, movies *MovieService) *WatchHistoryService {
+	return &WatchHistoryService{db: db, movies: movies, now: time.Now}
+}
+
+// ContinueWatchingItem is a movie the user has not finished, with where they
+// stopped
+type ContinueWatchingItem struct {
+	Movie           models.Movie
+	PositionSeconds int
+	Device          string
+	LastWatchedAt   time.Time
+}
+
+// RecordProgress saves position as where userID, or their profile when
+// profileID is not 0, stopped in movieID on device
+func (s *WatchHistoryService) RecordProgress(ctx context.Context, userID, profileID, movieID int64, position int, device string) (*models.WatchHistory, error) {
+	const op = "WatchHistoryService.RecordProgress"
+
+	if position < 0 || len(device) > maxDeviceLength {
+		return nil, apperrors.E(op, ErrInvalidProgress)
+	}
+
+	entry := &models.WatchHistory{
+		UserID:          userID,
+		ProfileID:       profileID,
+		MovieID:         movieID,
+		PositionSeconds: position,
+		Device:          device,
+		LastWatchedAt:   s.now(),
+	}
+	if err := s.db.SaveProgress(ctx, entry); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return entry, nil
+}
+
+// ContinueWatching returns up to limit movies userID, or their profile when
+// profileID is not 0, started but has not finished, most recently watched
+// first
+func (s *WatchHistoryService) ContinueWatching(ctx context.Context, userID, profileID int64, limit int) ([]ContinueWatchingItem, error) {
+	const op = "WatchHistoryService.ContinueWatching"
+
+	entries, err := s.db.ContinueWatching(ctx, userID, profileID, finishedFraction, limit)
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	movies := make([]models.Movie, len(entries))
+	for i, entry := range entries {
+		movies[i] = entry.Movie
+	}
+	if err := s.movies.LocalizeMovies(ctx, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	if err := s.movies.LoadCategories(ctx, movies); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	items := make([]ContinueWatchingItem, len(entries))
+	for i, entry := range entries {
+		items[i] = ContinueWatchingItem{
+			Movie:           movies[i],
+			PositionSeconds: entry.PositionSeconds,
+			Device:          entry.Device,
+			LastWatchedAt:   entry.LastWatchedAt,
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/ndn/internal/apperrors"
+	"github.com/ndn/internal/cache"
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/database"
+	"github.com/ndn/internal/models"
+	"github.com/ndn/internal/notifications"
+	"time"
+
+	"github.com/uptrace/bun"
+	"go.uber.org/zap"
+)
+
+// defaultPublishInterval is how often scheduled movies are checked for
+// publication unless configured otherwise
+const defaultPublishInterval = time.Minute
+
+// Audit actions and entity type of publication state changes
+const (
+	AuditActionSetMovieStatus   = "set_movie_status"
+	AuditActionPublishScheduled = "publish_scheduled_movie"
+
+	auditEntityMovie = "movie"
+)
+
+var (
+	ErrInvalidMovieStatus  = errors.New("invalid movie status")
+	ErrInvalidTransition   = errors.New("movie cannot move to that status")
+	ErrTransitionForbidden = errors.New("role may not make this status change")
+	ErrMovieNotEditable    = errors.New("movie is not editable in its status")
+	ErrContentRoleRequired = errors.New("editor or publisher role required")
+	ErrInvalidPublishAt    = errors.New("publish_at must be in the future, and only given to schedule a movie")
+)
+
+type transition struct {
+	from, to string
+}
+
+// movieTransitions maps each allowed change of publication state to the
+// least role allowed to make it. Editors prepare drafts and submit them;
+// publishers approve, schedule, send back, archive and revive them.
+// Scheduling a scheduled movie again moves its publish_at.
+var movieTransitions = map[transition]string{
+	{models.MovieStatusDraft, models.MovieStatusInReview}:      models.RoleEditor,
+	{models.MovieStatusInReview, models.MovieStatusDraft}:      models.RoleEditor,
+	{models.MovieStatusInReview, models.MovieStatusPublished}:  models.RolePublisher,
+	{models.MovieStatusInReview, models.MovieStatusScheduled}:  models.RolePublisher,
+	{models.MovieStatusScheduled, models.MovieStatusScheduled}: models.RolePublisher,
+	{models.MovieStatusScheduled, models.MovieStatusPublished}: models.RolePublisher,
+	{models.MovieStatusScheduled, models.MovieStatusInReview}:  models.RolePublisher,
+	{models.MovieStatusPublished, models.MovieStatusArchived}:  models.RolePublisher,
+	{models.MovieStatusArchived, models.MovieStatusDraft}:      models.RolePublisher,
+	{models.MovieStatusArchived, models.MovieStatusScheduled}:  models.RolePublisher,
+	{models.MovieStatusArchived, models.MovieStatusPublished}:  models.RolePublisher,
+}
+
+var roleRank = map[string]int{
+	models.RoleViewer:    0,
+	models.RoleEditor:    1,
+	models.RolePublisher: 2,
+}
+
+// WorkflowService moves movies through the publication workflow, draft →
+// in_review → (scheduled →) published → archived, checking the role of the
+// user making each change. Only published movies are shown publicly; Run
+// publishes scheduled movies once their time comes.
+type WorkflowService struct {
+	db              *bun.DB
+	cache           cache.Cache
+	notifications   *notifications.Hub
+	logger          *zap.Logger
+	publishInterval time.Duration
+	now             func() time.Time
+}
+
+func NewWorkflowService(db *bun.DB, c cache.Cache, hub *notifications.Hub, cfg config.WorkflowConfig, logger *zap.Logger) *WorkflowService {
+	publishInterval := cfg.PublishInterval
+	if publishInterval <= 0 {
+		publishInterval = defaultPublishInterval
+	}
+
+	return &WorkflowService{
+		db:              db,
+		cache:           c,
+		notifications:   hub,
+		logger:          logger,
+		publishInterval: publishInterval,
+		now:             time.Now,
+	}
+}
+
+// ContentRole returns the workflow role of a user, treating admins as
+// publishers
+func (s *WorkflowService) ContentRole(ctx context.Context, userID int64) (string, error) {
+	user := new(models.User)
+	err := s.db.NewSelect().
+		Model(user).
+		Column("role", "is_admin").
+		Where("id = ?", userID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", apperrors.E("WorkflowService.ContentRole", fmt.Errorf("user %w", database.ErrNotFound))
+	}
+	if err != nil {
+		return "", apperrors.E("WorkflowService.ContentRole", err)
+	}
+
+	if user.IsAdmin {
+		return models.RolePublisher, nil
+	}
+	return user.Role, nil
+}
+
+// Movies returns the movies in status, or every movie not yet published when
+// status is empty, most recently updated first
+func (s *WorkflowService) Movies(ctx context.Context, status string) ([]models.Movie, error) {
+	const op = "WorkflowService.Movies"
+
+	var movies []models.Movie
+	query := s.db.NewSelect().Model(&movies).OrderExpr("m.updated_at DESC, m.id DESC")
+	if status == "" {
+		query.Where("m.status IN (?)", bun.In([]string{models.MovieStatusDraft, models.MovieStatusInReview}))
+	} else {
+		if !validMovieStatus(status) {
+			return nil, apperrors.E(op, ErrInvalidMovieStatus)
+		}
+		query.Where("m.status = ?", status)
+	}
+
+	if err := query.Scan(ctx); err != nil {
+		return nil, apperrors.E(op, err)
+	}
+	return movies, nil
+}
+
+// CheckEditable returns ErrMovieNotEditable unless role may edit the
+// metadata of movie: editors only while it is a draft, publishers always
+func (s *WorkflowService) CheckEditable(role string, movie *models.Movie) error {
+	if roleRank[role] >= roleRank[models.RolePublisher] {
+		return nil
+	}
+	if roleRank[role] < roleRank[models.RoleEditor] {
+		return apperrors.E("WorkflowService.CheckEditable", ErrContentRoleRequired)
+	}
+	if movie.Status != models.MovieStatusDraft {
+		return apperrors.E("WorkflowService.CheckEditable", ErrMovieNotEditable)
+	}
+	return nil
+}
+
+// SetStatus moves a movie to status on behalf of the user in ctx, if the
+// workflow allows the change from its current status and their role is
+// enough for it. Scheduling a movie takes the future time to publish it at,
+// publishAt, which other statuses do not. The change is recorded in the
+// audit log.
+func (s *WorkflowService) SetStatus(ctx context.Context, movieID int64, status string, publishAt *time.Time) (*models.Movie, error) {
+	const op = "WorkflowService.SetStatus"
+
+	if !validMovieStatus(status) {
+		return nil, apperrors.E(op, ErrInvalidMovieStatus)
+	}
+	if (status == models.MovieStatusScheduled) != (publishAt != nil) || publishAt != nil && !publishAt.After(s.now()) {
+		return nil, apperrors.E(op, ErrInvalidPublishAt)
+	}
+	role, err := s.ContentRole(ctx, UserIDFromContext(ctx))
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	movie := new(models.Movie)
+	err = runInTx(ctx, s.db, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(movie).
+			Where("id = ?", movieID).
+			For("UPDATE").
+			Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("movie %w", database.ErrNotFound)
+		}
+		if err != nil {
+			return err
+		}
+
+		required, ok := movieTransitions[transition{movie.Status, status}]
+		if !ok {
+			return ErrInvalidTransition
+		}
+		if roleRank[role] < roleRank[required] {
+			return ErrTransitionForbidden
+		}
+
+		before := movieStatusFields(movie)
+		movie.Status = status
+		movie.PublishAt = publishAt
+		movie.UpdatedAt = s.now()
+		_, err = tx.NewUpdate().
+			Model(movie).
+			Column("status", "publish_at", "updated_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+		if status == models.MovieStatusPublished {
+			if err := publishMovieAdded(ctx, s.notifications, tx, movie); err != nil {
+				return err
+			}
+		}
+		return recordChange(ctx, tx, AuditActionSetMovieStatus, auditEntityMovie, movie.ID, before, movieStatusFields(movie))
+	})
+	if err != nil {
+		return nil, apperrors.E(op, err)
+	}
+
+	invalidateMovies(ctx, s.cache)
+	return movie, nil
+}
+
+// Run publishes the scheduled movies whose time has come on startup, then
+// every publish interval, until ctx is cancelled
+func (s *WorkflowService) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.publishInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.PublishScheduled(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Error("publishing scheduled movies failed", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PublishScheduled publishes the scheduled movies whose publish_at has
+// passed. Each is recorded in the audit log, without an actor, and announced
+// like movies published by hand.
+func (s *WorkflowService) PublishScheduled(ctx context.Context) error {
+	const op = "WorkflowService.PublishScheduled"
+
+	var published int
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var movies []models.Movie
+		err := tx.NewSelect().
+			Model(&movies).
+			Where("m.status = ? AND m.publish_at <= ?", models.MovieStatusScheduled, s.now()).
+			OrderExpr("m.publish_at, m.id").
+			For("UPDATE SKIP LOCKED").
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		for i := range movies {
+			movie := &movies[i]
+			movie.Status = models.MovieStatusPublished
+			movie.PublishAt = nil
+			movie.UpdatedAt = s.now()
+			_, err := tx.NewUpdate().
+				Model(movie).
+				Column("status", "publish_at", "updated_at").
+				WherePK().
+				Exec(ctx)
+			if err != nil {
+				return err
+			}
+			if err := publishMovieAdded(ctx, s.notifications, tx, movie); err != nil {
+				return err
+			}
+			if err := recordAudit(ctx, tx, AuditActionPublishScheduled, auditEntityMovie, movie.ID); err != nil {
+				return err
+			}
+		}
+		published = len(movies)
+		return nil
+	})
+	if err != nil {
+		return apperrors.E(op, err)
+	}
+
+	if published > 0 {
+		s.logger.Info("published scheduled movies", zap.Int("count", published))
+		invalidateMovies(ctx, s.cache)
+	}
+	return nil
+}
+
+func validMovieStatus(status string) bool {
+	switch status {
+	case models.MovieStatusDraft, models.MovieStatusInReview, models.MovieStatusScheduled, models.MovieStatusPublished, models.MovieStatusArchived:
+		return true
+	}
+	return false
+}
+
+// movieStatusFields are the fields of movie the workflow changes, as they
+// are recorded in the audit log
+func movieStatusFields(movie *models.Movie) map[string]interface{} {
+	return map[string]interface{}{
+		"status":     movie.Status,
+		"publish_at": movie.PublishAt,
+	}
+}
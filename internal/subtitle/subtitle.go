@@ -0,0 +1,143 @@
+// Package subtitle converts uploaded subtitle tracks to WebVTT, the format
+// browsers and HLS players display captions in.
+package subtitle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formats of uploaded subtitle tracks
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+)
+
+var ErrInvalidSubtitle = errors.New("invalid subtitles")
+
+var (
+	// srtTimestamp is an SRT timestamp, such as 01:02:03,456. A dot before
+	// the milliseconds is accepted too, as some tools write one.
+	srtTimestamp = regexp.MustCompile(`^(\d{1,2}):(\d{2}):(\d{2})[,.](\d{3})$`)
+	// srtOnlyTags are formatting tags of SRT that WebVTT has no equivalent
+	// for: font tags and SSA override blocks such as {\an8}
+	srtOnlyTags = regexp.MustCompile(`(?i)</?font[^>]*>|\{\\[^}]*\}`)
+)
+
+// ToWebVTT converts data, an SRT or WebVTT track in UTF-8, to WebVTT and
+// returns it with the format it was in. WebVTT tracks are kept as they are,
+// with normalised line endings.
+func ToWebVTT(data []byte) (string, string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return "", "", fmt.Errorf("%w: not UTF-8", ErrInvalidSubtitle)
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if isWebVTT(text) {
+		if !strings.Contains(text, "-->") {
+			return "", "", fmt.Errorf("%w: no cues", ErrInvalidSubtitle)
+		}
+		return strings.TrimRight(text, "\n") + "\n", FormatVTT, nil
+	}
+
+	vtt, err := fromSRT(text)
+	if err != nil {
+		return "", "", err
+	}
+	return vtt, FormatSRT, nil
+}
+
+// isWebVTT reports whether text starts with the WebVTT signature, which may
+// be followed by a space or tab and a description
+func isWebVTT(text string) bool {
+	rest, ok := strings.CutPrefix(text, "WEBVTT")
+	return ok && (rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n')
+}
+
+// fromSRT converts the cues of an SRT track, blocks separated by blank
+// lines of an optional counter, a timing line and the cue text
+func fromSRT(text string) (string, error) {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+
+	cues := 0
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); {
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		// The counter is not needed as a cue identifier
+		if !strings.Contains(lines[i], "-->") {
+			i++
+		}
+		if i == len(lines) {
+			return "", fmt.Errorf("%w: line %d: missing cue timing", ErrInvalidSubtitle, i)
+		}
+		timing, err := srtTiming(lines[i])
+		if err != nil {
+			return "", fmt.Errorf("%w: line %d: %s", ErrInvalidSubtitle, i+1, err)
+		}
+		i++
+
+		b.WriteString("\n" + timing + "\n")
+		for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+			line := srtOnlyTags.ReplaceAllString(lines[i], "")
+			// The cue text may not contain the timing arrow
+			b.WriteString(strings.ReplaceAll(line, "-->", "--&gt;") + "\n")
+		}
+		cues++
+	}
+
+	if cues == 0 {
+		return "", fmt.Errorf("%w: no cues", ErrInvalidSubtitle)
+	}
+	return b.String(), nil
+}
+
+// srtTiming converts an SRT timing line, such as
+// "00:00:01,000 --> 00:00:04,000", to a WebVTT one. Coordinates some tools
+// append are dropped.
+func srtTiming(line string) (string, error) {
+	start, end, ok := strings.Cut(line, "-->")
+	if !ok {
+		return "", errors.New("missing cue timing")
+	}
+	if fields := strings.Fields(end); len(fields) > 0 {
+		end = fields[0]
+	}
+
+	from, err := srtTime(strings.TrimSpace(start))
+	if err != nil {
+		return "", err
+	}
+	to, err := srtTime(end)
+	if err != nil {
+		return "", err
+	}
+	// Timestamps have the same width, so they compare as strings
+	if to < from {
+		return "", errors.New("cue ends before it starts")
+	}
+	return from + " --> " + to, nil
+}
+
+// srtTime converts an SRT timestamp to a WebVTT one, hh:mm:ss.ttt
+func srtTime(s string) (string, error) {
+	m := srtTimestamp.FindStringSubmatch(s)
+	if m == nil || m[2] >= "60" || m[3] >= "60" {
+		return "", fmt.Errorf("invalid timestamp %q", s)
+	}
+	hours := m[1]
+	if len(hours) == 1 {
+		hours = "0" + hours
+	}
+	return hours + ":" + m[2] + ":" + m[3] + "." + m[4], nil
+}
@@ -0,0 +1,212 @@
+package tracecontext
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceparentHeader carries the trace ID, parent span ID and flags
+	TraceparentHeader = "traceparent"
+	// TracestateHeader carries vendor-specific trace data
+	TracestateHeader = "tracestate"
+
+	version       = "00"
+	flagSampled   = 0x01
+	maxTracestate = 512
+)
+
+var (
+	ErrInvalidTraceparent = errors.New("invalid traceparent header")
+
+	zeroTraceID [16]byte
+	zeroSpanID  [8]byte
+)
+
+// TraceContext identifies a span within a distributed trace as described by
+// the W3C Trace Context recommendation
+type TraceContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+type contextKey struct{}
+
+// New starts a fresh sampled trace
+func New() TraceContext {
+	var tc TraceContext
+	rand.Read(tc.TraceID[:])
+	rand.Read(tc.SpanID[:])
+	tc.Flags = flagSampled
+	return tc
+}
+
+// Child returns a new span in the same trace, keeping flags and tracestate
+func (tc TraceContext) Child() TraceContext {
+	child := tc
+	rand.Read(child.SpanID[:])
+	return child
+}
+
+// TraceIDString returns the trace ID as lowercase hex
+func (tc TraceContext) TraceIDString() string {
+	return hex.EncodeToString(tc.TraceID[:])
+}
+
+// SpanIDString returns the span ID as lowercase hex
+func (tc TraceContext) SpanIDString() string {
+	return hex.EncodeToString(tc.SpanID[:])
+}
+
+// Sampled reports whether the caller recorded this trace
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&flagSampled != 0
+}
+
+// Traceparent renders the traceparent header value
+func (tc TraceContext) Traceparent() string {
+	return version + "-" + tc.TraceIDString() + "-" + tc.SpanIDString() + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Parse decodes traceparent and tracestate header values
+func Parse(traceparent, tracestate string) (TraceContext, error) {
+	var tc TraceContext
+
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return tc, ErrInvalidTraceparent
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == version && len(parts) != 4 {
+		return tc, ErrInvalidTraceparent
+	}
+	if !decodeLowerHex(tc.TraceID[:], parts[1]) || tc.TraceID == zeroTraceID {
+		return tc, ErrInvalidTraceparent
+	}
+	if !decodeLowerHex(tc.SpanID[:], parts[2]) || tc.SpanID == zeroSpanID {
+		return tc, ErrInvalidTraceparent
+	}
+	var flags [1]byte
+	if !decodeLowerHex(flags[:], parts[3]) {
+		return tc, ErrInvalidTraceparent
+	}
+	tc.Flags = flags[0]
+
+	if len(tracestate) <= maxTracestate {
+		tc.TraceState = strings.TrimSpace(tracestate)
+	}
+
+	return tc, nil
+}
+
+func decodeLowerHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+// NewContext returns a copy of ctx carrying tc
+func NewContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, tc)
+}
+
+// FromContext returns the trace context stored in ctx, if any
+func FromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(contextKey{}).(TraceContext)
+	return tc, ok
+}
+
+// Extract reads trace headers from an incoming request. A missing or invalid
+// traceparent starts a new trace.
+func Extract(h http.Header) TraceContext {
+	tc, err := Parse(h.Get(TraceparentHeader), h.Get(TracestateHeader))
+	if err != nil {
+		return New()
+	}
+	return tc.Child()
+}
+
+// Inject writes the trace context from ctx into outgoing headers
+func Inject(ctx context.Context, h http.Header) {
+	tc, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	child := tc.Child()
+	h.Set(TraceparentHeader, child.Traceparent())
+	if child.TraceState != "" {
+		h.Set(TracestateHeader, child.TraceState)
+	}
+}
+
+// InjectMap writes the trace context from ctx into a message carrier such as
+// event metadata
+func InjectMap(ctx context.Context, carrier map[string]string) {
+	tc, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	child := tc.Child()
+	carrier[TraceparentHeader] = child.Traceparent()
+	if child.TraceState != "" {
+		carrier[TracestateHeader] = child.TraceState
+	}
+}
+
+// ExtractMap restores a trace context from a message carrier into ctx,
+// starting a new trace if the carrier has none
+func ExtractMap(ctx context.Context, carrier map[string]string) context.Context {
+	tc, err := Parse(carrier[TraceparentHeader], carrier[TracestateHeader])
+	if err != nil {
+		return NewContext(ctx, New())
+	}
+	return NewContext(ctx, tc.Child())
+}
+
+// Middleware accepts traceparent/tracestate from the caller (or starts a new
+// trace) and stores the server span in the request context
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tc := Extract(r.Header)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), tc)))
+	})
+}
+
+// Transport is an http.RoundTripper that propagates the trace context of
+// each outgoing request's context
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if _, ok := FromContext(req.Context()); ok {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(req.Context())
+		Inject(req.Context(), req.Header)
+	}
+	return base.RoundTrip(req)
+}
+
+// NewClient returns an http.Client that propagates trace context. Outbound
+// integrations should use it instead of http.DefaultClient.
+func NewClient(base *http.Client) *http.Client {
+	client := &http.Client{}
+	if base != nil {
+		*client = *base
+	}
+	client.Transport = &Transport{Base: client.Transport}
+	return client
+}
@@ -0,0 +1,134 @@
+// Package transcode converts uploaded videos into HLS renditions with
+// ffmpeg, so players can switch between qualities as bandwidth allows.
+package transcode
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ndn/internal/config"
+)
+
+// MasterPlaylist is the name of the playlist listing every rendition, the
+// one players are given
+const MasterPlaylist = "master.m3u8"
+
+const (
+	renditionPlaylist      = "index.m3u8"
+	defaultSegmentDuration = 6 * time.Second
+	// maxErrorOutput is how much of ffmpeg's error output is kept in errors
+	maxErrorOutput = 1024
+)
+
+// DefaultRenditions are transcoded when none are configured
+var DefaultRenditions = []config.RenditionConfig{
+	{Name: "1080p", Height: 1080, VideoBitrate: 5000, AudioBitrate: 192},
+	{Name: "720p", Height: 720, VideoBitrate: 2800, AudioBitrate: 128},
+	{Name: "480p", Height: 480, VideoBitrate: 1400, AudioBitrate: 128},
+	{Name: "360p", Height: 360, VideoBitrate: 800, AudioBitrate: 96},
+}
+
+// FFmpeg transcodes videos by running the ffmpeg binary
+type FFmpeg struct {
+	path       string
+	segment    time.Duration
+	renditions []config.RenditionConfig
+}
+
+// New returns a transcoder for the renditions of cfg
+func New(cfg config.VideoConfig) *FFmpeg {
+	path := cfg.FFmpeg
+	if path == "" {
+		path = "ffmpeg"
+	}
+	segment := cfg.SegmentDuration
+	if segment <= 0 {
+		segment = defaultSegmentDuration
+	}
+	renditions := cfg.Renditions
+	if len(renditions) == 0 {
+		renditions = DefaultRenditions
+	}
+
+	return &FFmpeg{path: path, segment: segment, renditions: renditions}
+}
+
+// HLS transcodes the video file input into dir: each rendition in a
+// directory named after it, with its playlist and segments, and the master
+// playlist at the top. Renditions are never scaled above the height of the
+// input.
+func (f *FFmpeg) HLS(ctx context.Context, input, dir string) error {
+	for _, rendition := range f.renditions {
+		out := filepath.Join(dir, rendition.Name)
+		if err := os.MkdirAll(out, 0o755); err != nil {
+			return err
+		}
+
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, f.path, f.args(input, out, rendition)...)
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("ffmpeg %s rendition: %w: %s", rendition.Name, err, lastOutput(stderr.String()))
+		}
+	}
+
+	return os.WriteFile(filepath.Join(dir, MasterPlaylist), []byte(f.masterPlaylist()), 0o644)
+}
+
+func (f *FFmpeg) args(input, out string, rendition config.RenditionConfig) []string {
+	seconds := strconv.FormatFloat(f.segment.Seconds(), 'f', -1, 64)
+	return []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", input,
+		// The first video stream, and the first audio stream if any
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", fmt.Sprintf("scale=-2:min(%d\\,ih)", rendition.Height),
+		"-c:v", "libx264", "-preset", "veryfast", "-profile:v", "main",
+		"-b:v", fmt.Sprintf("%dk", rendition.VideoBitrate),
+		"-maxrate", fmt.Sprintf("%dk", maxRate(rendition)),
+		"-bufsize", fmt.Sprintf("%dk", rendition.VideoBitrate*3/2),
+		// Keyframes on segment boundaries, so every rendition is cut at
+		// the same times and players can switch between them
+		"-force_key_frames", "expr:gte(t,n_forced*" + seconds + ")",
+		"-c:a", "aac", "-ac", "2",
+		"-b:a", fmt.Sprintf("%dk", rendition.AudioBitrate),
+		"-f", "hls",
+		"-hls_time", seconds,
+		"-hls_playlist_type", "vod",
+		"-hls_segment_filename", filepath.Join(out, "segment_%05d.ts"),
+		filepath.Join(out, renditionPlaylist),
+	}
+}
+
+// masterPlaylist lists the renditions in the order configured, advertising
+// their peak bandwidth
+func (f *FFmpeg) masterPlaylist() string {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, rendition := range f.renditions {
+		bandwidth := (maxRate(rendition) + rendition.AudioBitrate) * 1000
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d\n%s/%s\n", bandwidth, rendition.Name, renditionPlaylist)
+	}
+	return b.String()
+}
+
+// maxRate caps the video bitrate of rendition 7% above its average
+func maxRate(rendition config.RenditionConfig) int {
+	return rendition.VideoBitrate * 107 / 100
+}
+
+// lastOutput keeps the end of ffmpeg's output, where the error is
+func lastOutput(output string) string {
+	output = strings.TrimSpace(output)
+	if len(output) > maxErrorOutput {
+		output = output[len(output)-maxErrorOutput:]
+	}
+	return output
+}
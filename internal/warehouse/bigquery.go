@@ -0,0 +1,204 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ndn/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	bigQueryScope    = "https://www.googleapis.com/auth/bigquery.insertdata"
+	bigQueryEndpoint = "https://bigquery.googleapis.com/bigquery/v2"
+	defaultTokenURI  = "https://oauth2.googleapis.com/token"
+)
+
+// serviceAccount is the part of a Google service account key file needed to
+// obtain access tokens
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// BigQuery streams rows into BigQuery tables with the insertAll API,
+// authenticating as a service account. Row IDs are sent as insertId so
+// BigQuery drops rows retried shortly after a failed batch.
+type BigQuery struct {
+	project  string
+	dataset  string
+	account  serviceAccount
+	key      *rsa.PrivateKey
+	client   *http.Client
+	endpoint string
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func NewBigQuery(cfg config.ExportSink, client *http.Client) (*BigQuery, error) {
+	data, err := os.ReadFile(cfg.CredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials: %w", err)
+	}
+	var account serviceAccount
+	if err := json.Unmarshal(data, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = defaultTokenURI
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credentials private key: %w", err)
+	}
+
+	return &BigQuery{
+		project:  cfg.Project,
+		dataset:  cfg.Dataset,
+		account:  account,
+		key:      key,
+		client:   client,
+		endpoint: bigQueryEndpoint,
+	}, nil
+}
+
+type insertAllRow struct {
+	InsertID string                 `json:"insertId"`
+	JSON     map[string]interface{} `json:"json"`
+}
+
+type insertAllResponse struct {
+	InsertErrors []struct {
+		Index  int `json:"index"`
+		Errors []struct {
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	} `json:"insertErrors"`
+}
+
+func (b *BigQuery) Write(ctx context.Context, table string, rows []Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	token, err := b.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload := struct {
+		Rows []insertAllRow `json:"rows"`
+	}{Rows: make([]insertAllRow, len(rows))}
+	for i, row := range rows {
+		payload.Rows[i] = insertAllRow{InsertID: row.ID, JSON: row.Data}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode rows: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/projects/%s/datasets/%s/tables/%s/insertAll",
+		b.endpoint, url.PathEscape(b.project), url.PathEscape(b.dataset), url.PathEscape(table))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build bigquery request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to insert into bigquery table %s: %w", table, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("bigquery insert into %s failed with %d: %s", table, resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var result insertAllResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode bigquery response: %w", err)
+	}
+	if len(result.InsertErrors) > 0 {
+		first := result.InsertErrors[0]
+		reason := "unknown"
+		if len(first.Errors) > 0 {
+			reason = first.Errors[0].Reason + ": " + first.Errors[0].Message
+		}
+		return fmt.Errorf("bigquery rejected %d rows of %s, first at index %d (%s)", len(result.InsertErrors), table, first.Index, reason)
+	}
+	return nil
+}
+
+// accessToken returns a cached OAuth access token, exchanging a signed JWT
+// assertion for a new one when it is about to expire
+func (b *BigQuery) accessToken(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if b.token != "" && now.Before(b.expires.Add(-time.Minute)) {
+		return b.token, nil
+	}
+
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   b.account.ClientEmail,
+		"scope": bigQueryScope,
+		"aud":   b.account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(b.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token assertion: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.account.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("token endpoint responded with %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+
+	b.token = token.AccessToken
+	b.expires = now.Add(time.Duration(token.ExpiresIn) * time.Second)
+	return b.token, nil
+}
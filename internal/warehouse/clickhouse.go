@@ -0,0 +1,72 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/ndn/internal/config"
+)
+
+// ClickHouse inserts rows through the ClickHouse HTTP interface using the
+// JSONEachRow format, so no native driver is needed. Deduplication is left
+// to the table engine, e.g. ReplacingMergeTree.
+type ClickHouse struct {
+	url      string
+	database string
+	username string
+	password string
+	client   *http.Client
+}
+
+func NewClickHouse(cfg config.ExportSink, client *http.Client) *ClickHouse {
+	return &ClickHouse{
+		url:      cfg.URL,
+		database: cfg.Database,
+		username: cfg.Username,
+		password: cfg.Password,
+		client:   client,
+	}
+}
+
+func (c *ClickHouse) Write(ctx context.Context, table string, rows []Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, row := range rows {
+		if err := encoder.Encode(row.Data); err != nil {
+			return fmt.Errorf("failed to encode row %s: %w", row.ID, err)
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow", c.database, table)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/?"+url.Values{"query": {query}}.Encode(), &body)
+	if err != nil {
+		return fmt.Errorf("failed to build clickhouse request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if c.username != "" {
+		req.Header.Set("X-ClickHouse-User", c.username)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to insert into clickhouse table %s: %w", table, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("clickhouse insert into %s failed with %d: %s", table, resp.StatusCode, bytes.TrimSpace(message))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	return nil
+}
@@ -0,0 +1,58 @@
+// Package warehouse ships analytics rows to external data warehouses. Each
+// warehouse is a Sink; which sinks exist is decided by configuration.
+package warehouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+// Sink types accepted in configuration
+const (
+	TypeClickHouse = "clickhouse"
+	TypeBigQuery   = "bigquery"
+)
+
+// Row is one record to write. ID identifies the record so sinks that support
+// it can drop duplicates when a batch is retried.
+type Row struct {
+	ID   string
+	Data map[string]interface{}
+}
+
+// Sink writes rows into a table of an external warehouse. Tables are expected
+// to exist with columns named like the keys of Row.Data.
+type Sink interface {
+	Write(ctx context.Context, table string, rows []Row) error
+}
+
+// NewSinks builds a sink for every configured warehouse, keyed by name
+func NewSinks(cfg config.ExportConfig) (map[string]Sink, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	client := tracecontext.NewClient(&http.Client{Timeout: timeout})
+
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+	for name, sc := range cfg.Sinks {
+		switch sc.Type {
+		case TypeClickHouse:
+			sinks[name] = NewClickHouse(sc, client)
+		case TypeBigQuery:
+			sink, err := NewBigQuery(sc, client)
+			if err != nil {
+				return nil, fmt.Errorf("export sink %s: %w", name, err)
+			}
+			sinks[name] = sink
+		default:
+			return nil, fmt.Errorf("export sink %s: unknown type %q", name, sc.Type)
+		}
+	}
+	return sinks, nil
+}
@@ -0,0 +1,86 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"github.com/ndn/internal/tracecontext"
+)
+
+const (
+	// EventHeader names the event carried in the payload
+	EventHeader = "Webhook-Event"
+	// IDHeader uniquely identifies a delivery so receivers can deduplicate
+	IDHeader = "Webhook-Id"
+)
+
+// Sender delivers outbound webhooks, signing each body with the secret of the
+// endpoint it is sent to
+type Sender struct {
+	endpoints map[string]config.WebhookEndpoint
+	client    *http.Client
+	now       func() time.Time
+}
+
+func NewSender(cfg config.WebhookConfig) *Sender {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &Sender{
+		endpoints: cfg.Endpoints,
+		client:    tracecontext.NewClient(&http.Client{Timeout: timeout}),
+		now:       time.Now,
+	}
+}
+
+// Send marshals payload and POSTs it to the named endpoint. Non-2xx
+// responses are returned as errors so callers can retry.
+func (s *Sender) Send(ctx context.Context, endpoint, event string, payload interface{}) error {
+	ep, ok := s.endpoints[endpoint]
+	if !ok {
+		return fmt.Errorf("webhook endpoint %q is not configured", endpoint)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	id := newDeliveryID()
+	req.Header.Set(IDHeader, id)
+	req.Header.Set(SignatureHeader, Sign(ep.Secret, s.now(), Payload(id, body)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to deliver webhook to %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint %s responded with %d", endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+func newDeliveryID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
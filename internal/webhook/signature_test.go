@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPayload(t *testing.T) {
+	if got, want := string(Payload("evt_1", []byte(`{"a":1}`))), `evt_1.{"a":1}`; got != want {
+		t.Errorf("Payload = %q, want %q", got, want)
+	}
+	if got, want := string(Payload("evt_1", nil)), "evt_1."; got != want {
+		t.Errorf("Payload with no body = %q, want %q", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	signedAt := time.Unix(1_700_000_000, 0)
+	header := Sign("secret", signedAt, []byte("payload"))
+
+	if want := "t=1700000000,v1=" + Compute("secret", 1_700_000_000, []byte("payload")); header != want {
+		t.Errorf("Sign = %q, want %q", header, want)
+	}
+	if header == Sign("other", signedAt, []byte("payload")) {
+		t.Error("Sign gave the same signature under another secret")
+	}
+	if header == Sign("secret", signedAt.Add(time.Second), []byte("payload")) {
+		t.Error("Sign gave the same signature at another time")
+	}
+
+	timestamp, signatures, err := Parse(header)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if timestamp != signedAt.Unix() || len(signatures) != 1 {
+		t.Errorf("Parse = %d, %v, want %d and one signature", timestamp, signatures, signedAt.Unix())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	payload := Payload("evt_1", []byte(`{"type":"movie.created"}`))
+	valid := Sign("secret", now, payload)
+	signature := strings.TrimPrefix(valid, "t=1700000000,")
+
+	tests := []struct {
+		name    string
+		header  string
+		payload []byte
+		secrets []string
+		wantErr error
+	}{
+		{"valid", valid, payload, []string{"secret"}, nil},
+		{"rotated secret", valid, payload, []string{"old", "secret"}, nil},
+		{"several signatures", "t=1700000000,v1=deadbeef," + signature, payload, []string{"secret"}, nil},
+		{"skew within tolerance", Sign("secret", now.Add(4*time.Minute), payload), payload, []string{"secret"}, nil},
+		{"tampered body", valid, Payload("evt_1", []byte(`{"type":"movie.deleted"}`)), []string{"secret"}, ErrInvalidSignature},
+		{"tampered ID", valid, Payload("evt_2", []byte(`{"type":"movie.created"}`)), []string{"secret"}, ErrInvalidSignature},
+		{"tampered timestamp", "t=1700000001," + signature, payload, []string{"secret"}, ErrInvalidSignature},
+		{"wrong secret", valid, payload, []string{"other"}, ErrInvalidSignature},
+		{"expired", Sign("secret", now.Add(-6*time.Minute), payload), payload, []string{"secret"}, ErrTimestampExpired},
+		{"from the future", Sign("secret", now.Add(6*time.Minute), payload), payload, []string{"secret"}, ErrTimestampExpired},
+		{"missing", "", payload, []string{"secret"}, ErrMissingSignature},
+		{"no timestamp", signature, payload, []string{"secret"}, ErrMalformedHeader},
+		{"bad timestamp", "t=soon," + signature, payload, []string{"secret"}, ErrMalformedHeader},
+		{"no signature", "t=1700000000", payload, []string{"secret"}, ErrMalformedHeader},
+		{"unknown scheme only", "t=1700000000,v0=deadbeef", payload, []string{"secret"}, ErrMalformedHeader},
+		{"no separator", "t=1700000000,v1", payload, []string{"secret"}, ErrMalformedHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(tt.header, tt.payload, now, 5*time.Minute, tt.secrets...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReturnsSigningTime(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signedAt := now.Add(-time.Minute)
+
+	got, err := Verify(Sign("secret", signedAt, []byte("body")), []byte("body"), now, 0, "secret")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !got.Equal(signedAt) {
+		t.Errorf("Verify signed at %v, want %v", got, signedAt)
+	}
+}
@@ -0,0 +1,149 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ndn/internal/apierror"
+	"github.com/ndn/internal/config"
+	"go.uber.org/zap"
+)
+
+const (
+	// ProviderStripe names Stripe among the inbound providers. Its secrets
+	// include the billing webhook secret.
+	ProviderStripe = "stripe"
+	// StripeSignatureHeader carries the signature of Stripe events, in the
+	// format of SignatureHeader over their body alone
+	StripeSignatureHeader = "Stripe-Signature"
+
+	// maxInboundBody caps the size of inbound webhook bodies read for
+	// verification
+	maxInboundBody = 1 << 20
+)
+
+// Scheme is how a provider signs its deliveries: the header carrying the
+// signature, and the header carrying the delivery ID signed along with the
+// body as in Payload. Providers without an ID header sign their body alone,
+// and their deliveries are told apart by their signature.
+type Scheme struct {
+	SignatureHeader string
+	IDHeader        string
+}
+
+// schemes are those of the providers not signing like Sender does
+var schemes = map[string]Scheme{
+	ProviderStripe: {SignatureHeader: StripeSignatureHeader},
+}
+
+var defaultScheme = Scheme{SignatureHeader: SignatureHeader, IDHeader: IDHeader}
+
+// ErrMissingID is the error of deliveries without an ID
+var ErrMissingID = errors.New("missing webhook delivery ID")
+
+// Nonces remembers the IDs of the deliveries accepted, for window past the
+// time they were signed, returning an error for IDs already used or when
+// they cannot be checked. *replay.Store is one.
+type Nonces interface {
+	UseWithin(ctx context.Context, nonce string, ts time.Time, window time.Duration) error
+}
+
+// Verifier checks signatures on webhooks we receive from external providers
+// and rejects deliveries it has already accepted
+type Verifier struct {
+	secrets   map[string][]string
+	tolerance time.Duration
+	nonces    Nonces
+	logger    *zap.Logger
+	now       func() time.Time
+}
+
+func NewVerifier(cfg config.WebhookConfig, nonces Nonces, logger *zap.Logger) *Verifier {
+	tolerance := cfg.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	return &Verifier{
+		secrets:   cfg.Inbound,
+		tolerance: tolerance,
+		nonces:    nonces,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// Middleware rejects requests from provider whose body does not carry a
+// valid signature under its scheme, or whose delivery was already seen
+// within the replay window. The body is buffered and restored for the next
+// handler.
+func (v *Verifier) Middleware(provider string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secrets := v.secrets[provider]
+			if len(secrets) == 0 {
+				v.logger.Error("inbound webhook has no configured secret", zap.String("provider", provider))
+				sendError(w, r, "webhook_not_accepted", http.StatusNotFound)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxInboundBody+1))
+			if err != nil || len(body) > maxInboundBody {
+				sendError(w, r, "invalid_request_body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			scheme, ok := schemes[provider]
+			if !ok {
+				scheme = defaultScheme
+			}
+			header := r.Header.Get(scheme.SignatureHeader)
+
+			// The signature covers the delivery ID and timestamp, so neither
+			// can be changed to pass a captured body off as a new delivery
+			payload, nonce := body, header
+			if scheme.IDHeader != "" {
+				id := r.Header.Get(scheme.IDHeader)
+				if id == "" {
+					v.reject(w, r, provider, ErrMissingID, "missing_webhook_id", "header", scheme.IDHeader)
+					return
+				}
+				payload, nonce = Payload(id, body), id
+			}
+
+			signedAt, err := Verify(header, payload, v.now(), v.tolerance, secrets...)
+			if err != nil {
+				v.reject(w, r, provider, err, "invalid_webhook_signature")
+				return
+			}
+
+			// Older deliveries fail the timestamp check above, so the ID only
+			// needs to be remembered for the tolerance. Deliveries that cannot
+			// be checked are rejected too, and retried by the provider.
+			if err := v.nonces.UseWithin(r.Context(), provider+":"+nonce, signedAt, v.tolerance); err != nil {
+				v.reject(w, r, provider, err, "replayed_webhook")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (v *Verifier) reject(w http.ResponseWriter, r *http.Request, provider string, err error, code string, args ...interface{}) {
+	v.logger.Warn("rejected inbound webhook",
+		zap.String("provider", provider),
+		zap.String("path", r.URL.Path),
+		zap.Error(err),
+	)
+	sendError(w, r, code, http.StatusUnauthorized, args...)
+}
+
+func sendError(w http.ResponseWriter, r *http.Request, code string, status int, args ...interface{}) {
+	apierror.Write(w, r, status, code, args...)
+}
@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ndn/internal/config"
+	"go.uber.org/zap"
+)
+
+var errReplayed = errors.New("replayed")
+
+// memoryNonces is an in-memory Nonces
+type memoryNonces struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (n *memoryNonces) UseWithin(_ context.Context, nonce string, _ time.Time, _ time.Duration) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.seen[nonce] {
+		return errReplayed
+	}
+	n.seen[nonce] = true
+	return nil
+}
+
+func newTestVerifier(now time.Time) *Verifier {
+	v := NewVerifier(config.WebhookConfig{
+		Inbound: map[string][]string{
+			"partner":      {"partner-secret"},
+			ProviderStripe: {"whsec_old", "whsec_new"},
+		},
+	}, &memoryNonces{seen: make(map[string]bool)}, zap.NewNop())
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestVerifierMiddleware(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	v := newTestVerifier(now)
+
+	body := `{"type":"movie.created"}`
+	delivery := func(id, signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/partner", strings.NewReader(body))
+		if id != "" {
+			r.Header.Set(IDHeader, id)
+		}
+		r.Header.Set(SignatureHeader, signature)
+		return r
+	}
+	stripeEvent := func(signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/billing/webhook", strings.NewReader(body))
+		r.Header.Set(StripeSignatureHeader, signature)
+		return r
+	}
+	signed := Sign("partner-secret", now, Payload("d1", []byte(body)))
+	stripeSigned := Sign("whsec_new", now, []byte(body))
+
+	tests := []struct {
+		name     string
+		provider string
+		req      *http.Request
+		want     int
+	}{
+		{"signed", "partner", delivery("d1", signed), http.StatusNoContent},
+		{"redelivered", "partner", delivery("d1", signed), http.StatusUnauthorized},
+		{"ID changed", "partner", delivery("d2", signed), http.StatusUnauthorized},
+		{"missing ID", "partner", delivery("", signed), http.StatusUnauthorized},
+		{"expired", "partner", delivery("d3", Sign("partner-secret", now.Add(-time.Hour), Payload("d3", []byte(body)))), http.StatusUnauthorized},
+		{"malformed", "partner", delivery("d4", "v1=deadbeef"), http.StatusUnauthorized},
+		{"Stripe signed", ProviderStripe, stripeEvent(stripeSigned), http.StatusNoContent},
+		{"Stripe redelivered", ProviderStripe, stripeEvent(stripeSigned), http.StatusUnauthorized},
+		{"Stripe old secret", ProviderStripe, stripeEvent(Sign("whsec_old", now.Add(-time.Second), []byte(body))), http.StatusNoContent},
+		{"Stripe wrong secret", ProviderStripe, stripeEvent(Sign("partner-secret", now, []byte(body))), http.StatusUnauthorized},
+		{"unknown provider", "other", delivery("d5", Sign("partner-secret", now, Payload("d5", []byte(body)))), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := v.Middleware(tt.provider)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				got = string(b)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, tt.req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if rec.Code == http.StatusNoContent && got != body {
+				t.Errorf("handler read body %q, want %q", got, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_categories_display_order;
+ALTER TABLE categories DROP COLUMN IF EXISTS hidden;
+ALTER TABLE categories DROP COLUMN IF EXISTS display_order;
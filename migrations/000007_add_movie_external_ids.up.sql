@@ -0,0 +1,4 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_source VARCHAR(64);
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS external_id VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_movies_external ON movies (external_source, external_id);
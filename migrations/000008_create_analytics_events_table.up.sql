@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS analytics_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(32) NOT NULL,
+    user_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    session_id VARCHAR(64),
+    -- No foreign key so events outlive the movies they refer to
+    movie_id BIGINT NOT NULL,
+    position_seconds INTEGER,
+    query VARCHAR(256),
+    occurred_at TIMESTAMP NOT NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_analytics_events_occurred_at ON analytics_events (occurred_at);
+CREATE INDEX IF NOT EXISTS idx_analytics_events_movie ON analytics_events (movie_id, occurred_at);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS analytics_rollups;
+DROP TABLE IF EXISTS user_daily_stats;
+DROP TABLE IF EXISTS movie_daily_stats;
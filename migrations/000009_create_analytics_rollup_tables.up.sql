@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS movie_daily_stats (
+    movie_id BIGINT NOT NULL,
+    day DATE NOT NULL,
+    impressions BIGINT NOT NULL DEFAULT 0,
+    views BIGINT NOT NULL DEFAULT 0,
+    viewers BIGINT NOT NULL DEFAULT 0,
+    completions BIGINT NOT NULL DEFAULT 0,
+    watch_seconds BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (movie_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_daily_stats_day ON movie_daily_stats (day);
+
+CREATE TABLE IF NOT EXISTS user_daily_stats (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    titles BIGINT NOT NULL DEFAULT 0,
+    completions BIGINT NOT NULL DEFAULT 0,
+    watch_seconds BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_daily_stats_day ON user_daily_stats (day);
+
+-- Days whose raw events have been aggregated into the tables above
+CREATE TABLE IF NOT EXISTS analytics_rollups (
+    day DATE PRIMARY KEY,
+    rolled_up_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,7 @@
+-- Progress of each warehouse export sink
+CREATE TABLE IF NOT EXISTS export_checkpoints (
+    sink VARCHAR(64) PRIMARY KEY,
+    last_event_id BIGINT NOT NULL DEFAULT 0,
+    last_day DATE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+CREATE EXTENSION IF NOT EXISTS vector;
+
+-- One embedding per movie. The column has no fixed dimensions so the
+-- provider model can change; similarity search is exact, which is fast
+-- enough for a catalog of this size.
+CREATE TABLE IF NOT EXISTS movie_embeddings (
+    movie_id BIGINT PRIMARY KEY REFERENCES movies(id) ON DELETE CASCADE,
+    model VARCHAR(255) NOT NULL,
+    embedding vector NOT NULL,
+    -- SHA-256 of the embedded text, to skip movies whose metadata is unchanged
+    source_hash CHAR(64) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_embeddings_model ON movie_embeddings (model);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS movie_trending_scores;
+DROP TABLE IF EXISTS trending_settings;
@@ -0,0 +1,17 @@
+-- Trending score parameters overridden by an admin; a single row
+CREATE TABLE IF NOT EXISTS trending_settings (
+    id SMALLINT PRIMARY KEY CHECK (id = 1),
+    half_life_hours DOUBLE PRECISION NOT NULL,
+    window_days INTEGER NOT NULL,
+    age_gravity DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Scores of the last trending computation, replaced as a whole each time
+CREATE TABLE IF NOT EXISTS movie_trending_scores (
+    movie_id BIGINT PRIMARY KEY REFERENCES movies(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_trending_scores_score ON movie_trending_scores (score DESC);
@@ -0,0 +1,18 @@
+-- Movies promoted by editors in search results for a query, in a category
+-- row, or in the unfiltered catalog when neither is set. A position pins the
+-- movie there; otherwise the weight ranks it ahead of unboosted movies.
+CREATE TABLE IF NOT EXISTS editorial_boosts (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    query VARCHAR(255),
+    category VARCHAR(255),
+    position INTEGER CHECK (position > 0),
+    weight DOUBLE PRECISION NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (query IS NULL OR category IS NULL)
+);
+
+CREATE INDEX IF NOT EXISTS idx_editorial_boosts_context ON editorial_boosts (query, category);
@@ -0,0 +1 @@
+ALTER TABLE analytics_events DROP COLUMN IF EXISTS reason;
@@ -0,0 +1,3 @@
+-- Recommendation reason a title was shown or opened with, so clicks can be
+-- attributed to the reasons that drive them
+ALTER TABLE analytics_events ADD COLUMN IF NOT EXISTS reason VARCHAR(64);
@@ -0,0 +1,9 @@
+-- Search terms and the alternatives they also match: synonyms, alternate
+-- titles and correct spellings of common misspellings
+CREATE TABLE IF NOT EXISTS search_synonyms (
+    id BIGSERIAL PRIMARY KEY,
+    term VARCHAR(255) NOT NULL UNIQUE,
+    alternatives TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
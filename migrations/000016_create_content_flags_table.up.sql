@@ -0,0 +1,17 @@
+-- User-generated text flagged by the content filter, held for moderator
+-- review. Text the filter rejects is never stored.
+CREATE TABLE IF NOT EXISTS content_flags (
+    id BIGSERIAL PRIMARY KEY,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id BIGINT NOT NULL,
+    field VARCHAR(50) NOT NULL,
+    content TEXT NOT NULL,
+    reasons TEXT[] NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'removed')),
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_content_flags_status ON content_flags (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_content_flags_entity ON content_flags (entity_type, entity_id);
@@ -0,0 +1,6 @@
+-- Trigram similarity powers "did you mean" suggestions for searches that
+-- match nothing
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_movies_title_trgm ON movies USING GIN (LOWER(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_categories_name_trgm ON categories USING GIN (LOWER(name) gin_trgm_ops);
@@ -0,0 +1,20 @@
+-- A user's playback of one movie for one UTC day, kept after raw events are
+-- pruned for personal viewing statistics
+CREATE TABLE IF NOT EXISTS user_movie_daily_stats (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL,
+    day DATE NOT NULL,
+    completions BIGINT NOT NULL DEFAULT 0,
+    watch_seconds BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day, movie_id)
+);
+
+-- Backfill from the raw events still retained
+INSERT INTO user_movie_daily_stats (user_id, movie_id, day, completions, watch_seconds)
+SELECT user_id, movie_id, occurred_at::date,
+    COUNT(*) FILTER (WHERE type = 'complete'),
+    COALESCE(MAX(position_seconds), 0)
+FROM analytics_events
+WHERE user_id IS NOT NULL
+GROUP BY user_id, movie_id, occurred_at::date
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,4 @@
+ALTER TABLE users DROP COLUMN IF EXISTS role;
+
+DROP INDEX IF EXISTS idx_movies_status;
+ALTER TABLE movies DROP COLUMN IF EXISTS status;
@@ -0,0 +1,8 @@
+-- Publication state of movies; existing movies stay public
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'published'
+    CHECK (status IN ('draft', 'in_review', 'published', 'archived'));
+CREATE INDEX IF NOT EXISTS idx_movies_status ON movies(status);
+
+-- Role of users in the content workflow
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('viewer', 'editor', 'publisher'));
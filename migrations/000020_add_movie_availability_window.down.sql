@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_movies_available_from;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS available_until;
+ALTER TABLE movies DROP COLUMN IF EXISTS available_from;
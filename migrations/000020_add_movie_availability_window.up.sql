@@ -0,0 +1,6 @@
+-- Availability window of a movie: a published movie is shown publicly from
+-- available_from until available_until, either of which may be open
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS available_from TIMESTAMPTZ;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS available_until TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_movies_available_from ON movies(available_from) WHERE available_from IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Where each user last stopped in each movie, for resuming playback and the
+-- continue watching row
+CREATE TABLE IF NOT EXISTS watch_history (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    position_seconds INTEGER NOT NULL CHECK (position_seconds >= 0),
+    device VARCHAR(100) NOT NULL DEFAULT '',
+    last_watched_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_watch_history_user_last_watched ON watch_history(user_id, last_watched_at DESC);
@@ -0,0 +1,16 @@
+-- One review per user and movie. A movie's rating is the average score of
+-- its reviews, kept up to date with rating_count as reviews are written.
+CREATE TABLE IF NOT EXISTS reviews (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    score SMALLINT NOT NULL CHECK (score BETWEEN 1 AND 5),
+    text TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reviews_movie_created ON reviews(movie_id, created_at DESC);
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS rating_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,41 @@
+-- TV series, made of numbered seasons of numbered episodes. Each episode
+-- has its own video and duration, like a standalone movie.
+CREATE TABLE IF NOT EXISTS series (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    release_year INTEGER NOT NULL DEFAULT 0,
+    poster_url TEXT NOT NULL DEFAULT '',
+    categories TEXT[],
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS seasons (
+    id BIGSERIAL PRIMARY KEY,
+    series_id BIGINT NOT NULL REFERENCES series(id) ON DELETE CASCADE,
+    number INTEGER NOT NULL CHECK (number > 0),
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    release_year INTEGER NOT NULL DEFAULT 0,
+    poster_url TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (series_id, number)
+);
+
+CREATE TABLE IF NOT EXISTS episodes (
+    id BIGSERIAL PRIMARY KEY,
+    season_id BIGINT NOT NULL REFERENCES seasons(id) ON DELETE CASCADE,
+    number INTEGER NOT NULL CHECK (number > 0),
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    duration INTEGER NOT NULL CHECK (duration > 0),
+    video_url TEXT NOT NULL DEFAULT '',
+    air_date DATE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (season_id, number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_series_categories ON series USING GIN (categories);
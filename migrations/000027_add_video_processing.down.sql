@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS transcode_jobs;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS video_source_key;
+ALTER TABLE movies DROP COLUMN IF EXISTS video_error;
+ALTER TABLE movies DROP COLUMN IF EXISTS video_status;
@@ -0,0 +1,24 @@
+-- Processing state of the video uploaded for a movie. Movies whose video_url
+-- was set directly have no video_status.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS video_status VARCHAR(20)
+    CHECK (video_status IN ('uploading', 'processing', 'ready', 'failed'));
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS video_error TEXT;
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS video_source_key TEXT;
+
+-- Queue of uploaded videos to transcode into HLS renditions. Workers claim
+-- queued jobs with FOR UPDATE SKIP LOCKED, so any number of instances can
+-- share the queue.
+CREATE TABLE IF NOT EXISTS transcode_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    source_key TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_transcode_jobs_queued ON transcode_jobs (created_at) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_transcode_jobs_movie ON transcode_jobs (movie_id, created_at);
@@ -0,0 +1,13 @@
+-- Subtitle tracks of movies, one per language. Content is always WebVTT;
+-- format is the format the track was uploaded in.
+CREATE TABLE IF NOT EXISTS subtitles (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    language VARCHAR(35) NOT NULL,
+    label VARCHAR(100) NOT NULL DEFAULT '',
+    format VARCHAR(10) NOT NULL CHECK (format IN ('srt', 'vtt')),
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (movie_id, language)
+);
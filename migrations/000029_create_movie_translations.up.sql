@@ -0,0 +1,11 @@
+-- Title and description of movies in other locales, for clients asking for
+-- them with Accept-Language. Empty fields fall back to the movie's own.
+CREATE TABLE IF NOT EXISTS movie_translations (
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    locale VARCHAR(35) NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (movie_id, locale)
+);
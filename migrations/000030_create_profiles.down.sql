@@ -0,0 +1,13 @@
+ALTER TABLE IF EXISTS user_favorites DROP COLUMN IF EXISTS profile_id;
+
+-- Watch history of profiles cannot be merged into the account's
+DELETE FROM watch_history WHERE profile_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_watch_history_viewer_last_watched;
+DROP INDEX IF EXISTS idx_watch_history_viewer_movie;
+ALTER TABLE watch_history DROP COLUMN IF EXISTS profile_id;
+ALTER TABLE watch_history ADD PRIMARY KEY (user_id, movie_id);
+CREATE INDEX IF NOT EXISTS idx_watch_history_user_last_watched ON watch_history(user_id, last_watched_at DESC);
+
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS profile_id;
+
+DROP TABLE IF EXISTS profiles;
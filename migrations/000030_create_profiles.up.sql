@@ -0,0 +1,24 @@
+-- Viewer profiles of an account, each with its own favorites and watch
+-- history. Rows of those without a profile belong to the account itself.
+CREATE TABLE IF NOT EXISTS profiles (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    avatar VARCHAR(500) NOT NULL DEFAULT '',
+    is_kids BOOLEAN NOT NULL DEFAULT false,
+    max_content_rating VARCHAR(10),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- The profile a session acts as, kept when its refresh token is exchanged
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS profile_id BIGINT REFERENCES profiles(id) ON DELETE SET NULL;
+
+ALTER TABLE watch_history ADD COLUMN IF NOT EXISTS profile_id BIGINT REFERENCES profiles(id) ON DELETE CASCADE;
+ALTER TABLE watch_history DROP CONSTRAINT IF EXISTS watch_history_pkey;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_watch_history_viewer_movie ON watch_history(user_id, (COALESCE(profile_id, 0)), movie_id);
+DROP INDEX IF EXISTS idx_watch_history_user_last_watched;
+CREATE INDEX IF NOT EXISTS idx_watch_history_viewer_last_watched ON watch_history(user_id, (COALESCE(profile_id, 0)), last_watched_at DESC);
+
+ALTER TABLE IF EXISTS user_favorites ADD COLUMN IF NOT EXISTS profile_id BIGINT REFERENCES profiles(id) ON DELETE CASCADE;
@@ -0,0 +1,4 @@
+ALTER TABLE profiles DROP COLUMN IF EXISTS pin_hash;
+
+DROP INDEX IF EXISTS idx_movies_maturity_rating;
+ALTER TABLE movies DROP COLUMN IF EXISTS maturity_rating;
@@ -0,0 +1,9 @@
+-- Content rating of each movie, limited by the maximum of the profile
+-- browsing. Movies without one are only shown to profiles without a limit.
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS maturity_rating VARCHAR(10)
+    CHECK (maturity_rating IN ('G', 'PG', 'PG-13', 'R', 'NC-17'));
+
+CREATE INDEX IF NOT EXISTS idx_movies_maturity_rating ON movies(maturity_rating);
+
+-- bcrypt hash of the parental PIN guarding a profile, if any
+ALTER TABLE profiles ADD COLUMN IF NOT EXISTS pin_hash VARCHAR(255);
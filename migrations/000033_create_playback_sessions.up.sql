@@ -0,0 +1,13 @@
+-- Streams started by users of plans limiting concurrent streams, by the
+-- hash of their playback token. A stream is active while its player keeps
+-- fetching from it.
+CREATE TABLE IF NOT EXISTS playback_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_user ON playback_sessions(user_id, last_seen_at);
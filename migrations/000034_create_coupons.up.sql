@@ -0,0 +1,35 @@
+-- Promo codes discounting Checkout subscriptions, each backed by a Stripe
+-- coupon
+CREATE TABLE IF NOT EXISTS coupons (
+    id BIGSERIAL PRIMARY KEY,
+    code VARCHAR(50) NOT NULL UNIQUE,
+    description VARCHAR(200),
+    percent_off INTEGER CHECK (percent_off BETWEEN 1 AND 100),
+    amount_off_cents BIGINT CHECK (amount_off_cents > 0),
+    currency VARCHAR(3),
+    duration VARCHAR(10) NOT NULL CHECK (duration IN ('once', 'repeating', 'forever')),
+    duration_months INTEGER CHECK (duration_months > 0),
+    max_redemptions INTEGER NOT NULL DEFAULT 0 CHECK (max_redemptions >= 0),
+    times_redeemed INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP,
+    active BOOLEAN NOT NULL DEFAULT true,
+    stripe_coupon_id VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((percent_off IS NULL) <> (amount_off_cents IS NULL))
+);
+
+-- Coupons redeemed by users, once each, applied to their Checkout sessions
+-- until one completes
+CREATE TABLE IF NOT EXISTS coupon_redemptions (
+    id BIGSERIAL PRIMARY KEY,
+    coupon_id BIGINT NOT NULL REFERENCES coupons(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    checkout_session_id VARCHAR(255),
+    redeemed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    used_at TIMESTAMP,
+    UNIQUE (coupon_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_user ON coupon_redemptions(user_id) WHERE used_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_session ON coupon_redemptions(checkout_session_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_playback_sessions_device;
+ALTER TABLE playback_sessions DROP COLUMN IF EXISTS device;
+ALTER TABLE playback_sessions DROP COLUMN IF EXISTS device_id;
@@ -0,0 +1,5 @@
+-- Streams of every signed-in user are tracked, with the device they play on
+ALTER TABLE playback_sessions ADD COLUMN IF NOT EXISTS device_id VARCHAR(100);
+ALTER TABLE playback_sessions ADD COLUMN IF NOT EXISTS device VARCHAR(100);
+
+CREATE INDEX IF NOT EXISTS idx_playback_sessions_device ON playback_sessions(user_id, device_id);
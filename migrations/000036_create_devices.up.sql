@@ -0,0 +1,13 @@
+-- Devices users signed in from, one per session of refresh tokens. A device
+-- is listed while its session is active.
+CREATE TABLE IF NOT EXISTS devices (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id VARCHAR(32) NOT NULL UNIQUE,
+    user_agent TEXT,
+    platform VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_devices_user ON devices(user_id, last_seen_at);
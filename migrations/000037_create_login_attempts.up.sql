@@ -0,0 +1,10 @@
+-- Failed password logins in a row, per email address ("email:...") and per
+-- IP address ("ip:..."), to slow down guessing and lock accounts
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed ON login_attempts(last_failed_at);
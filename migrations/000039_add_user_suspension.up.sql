@@ -0,0 +1,3 @@
+-- Suspended users keep their account but can neither sign in nor use their
+-- tokens until an admin activates them again
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
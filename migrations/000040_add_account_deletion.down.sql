@@ -0,0 +1,5 @@
+DELETE FROM reviews WHERE user_id IS NULL;
+ALTER TABLE reviews ALTER COLUMN user_id SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,6 @@
+-- Accounts deleted by their users are soft-deleted, and removed for good
+-- after a grace period. Their reviews are kept without an author.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE reviews ALTER COLUMN user_id DROP NOT NULL;
@@ -0,0 +1,13 @@
+-- Single-use tokens emailed to the new address of a user changing their
+-- email, stored as SHA-256 hashes. The change applies once one is confirmed.
+CREATE TABLE IF NOT EXISTS email_change_tokens (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    new_email VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_change_tokens_user ON email_change_tokens(user_id);
@@ -0,0 +1 @@
+ALTER TABLE IF EXISTS user_profiles DROP COLUMN IF EXISTS avatar_urls;
@@ -0,0 +1,14 @@
+-- The personal details of users, one row each, created with their first
+-- change. avatar is the URL of the default size of the uploaded avatar and
+-- avatar_urls that of every size, by name.
+CREATE TABLE IF NOT EXISTS user_profiles (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    avatar TEXT,
+    bio TEXT,
+    date_of_birth TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS avatar_urls JSONB;
@@ -0,0 +1,18 @@
+-- URL-friendly names of categories: the name lowercased, with every run of
+-- other characters than ASCII letters and digits replaced by a hyphen.
+-- Existing categories whose slugs would clash, or be empty, get their ID
+-- appended.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS slug VARCHAR(255);
+
+UPDATE categories
+SET slug = trim(BOTH '-' FROM regexp_replace(lower(name), '[^a-z0-9]+', '-', 'g'))
+WHERE slug IS NULL;
+
+UPDATE categories c
+SET slug = trim(BOTH '-' FROM c.slug || '-' || c.id)
+WHERE c.slug = '' OR EXISTS (
+    SELECT 1 FROM categories o WHERE o.slug = c.slug AND o.id < c.id
+);
+
+ALTER TABLE categories ALTER COLUMN slug SET NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
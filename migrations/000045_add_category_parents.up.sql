@@ -0,0 +1,7 @@
+-- Categories may be sub-categories of another, such as genres of sub-genres.
+-- Categories with sub-categories cannot be deleted.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES categories(id) ON DELETE RESTRICT;
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_parent_id_check;
+ALTER TABLE categories ADD CONSTRAINT categories_parent_id_check CHECK (parent_id <> id);
+
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
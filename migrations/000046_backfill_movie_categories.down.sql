@@ -0,0 +1,3 @@
+-- The links and names backfilled are consistent with the previous schema,
+-- so there is nothing to undo
+SELECT 1;
@@ -0,0 +1,18 @@
+-- movie_categories is the source of truth for the categories of movies, and
+-- movies.categories a copy of their names kept in step by the application.
+-- Link every movie to the categories its names match, then rewrite the
+-- names from the links, dropping those no category has.
+INSERT INTO movie_categories (movie_id, category_id)
+SELECT m.id, c.id
+FROM movies m
+JOIN categories c ON c.name = ANY(m.categories)
+ON CONFLICT (movie_id, category_id) DO NOTHING;
+
+UPDATE movies m
+SET categories = ARRAY(
+    SELECT c.name
+    FROM movie_categories mc
+    JOIN categories c ON c.id = mc.category_id
+    WHERE mc.movie_id = m.id
+    ORDER BY c.display_order, c.name
+);
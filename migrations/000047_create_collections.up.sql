@@ -0,0 +1,24 @@
+-- Curated rows of movies shown on the home page, such as Staff Picks, in
+-- display order. Hidden collections are only listed to admins.
+CREATE TABLE IF NOT EXISTS collections (
+    id BIGSERIAL PRIMARY KEY,
+    slug VARCHAR(255) NOT NULL UNIQUE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    display_order INTEGER NOT NULL DEFAULT 0,
+    hidden BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- The movies of a collection, by position
+CREATE TABLE IF NOT EXISTS collection_items (
+    collection_id BIGINT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (collection_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_collection_items_position ON collection_items (collection_id, position);
+CREATE INDEX IF NOT EXISTS idx_collection_items_movie_id ON collection_items (movie_id);
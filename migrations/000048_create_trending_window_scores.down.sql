@@ -0,0 +1 @@
+DROP TABLE IF EXISTS movie_trending_window_scores;
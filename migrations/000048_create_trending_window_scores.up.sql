@@ -0,0 +1,11 @@
+-- Trending scores over the fixed windows listings may ask for, such as the
+-- last 7 days, replaced as a whole with movie_trending_scores each time
+CREATE TABLE IF NOT EXISTS movie_trending_window_scores (
+    window_days INTEGER NOT NULL,
+    movie_id BIGINT NOT NULL REFERENCES movies(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (window_days, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_movie_trending_window_scores_score ON movie_trending_window_scores (window_days, score DESC);
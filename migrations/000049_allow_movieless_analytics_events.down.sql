@@ -0,0 +1,2 @@
+DELETE FROM analytics_events WHERE movie_id IS NULL;
+ALTER TABLE analytics_events ALTER COLUMN movie_id SET NOT NULL;
@@ -0,0 +1,2 @@
+-- search events report a query without a movie
+ALTER TABLE analytics_events ALTER COLUMN movie_id DROP NOT NULL;
@@ -0,0 +1,20 @@
+-- Banners at the top of the home page, each featuring a movie or a
+-- collection between starts_at and ends_at, by descending priority
+CREATE TABLE IF NOT EXISTS featured_slots (
+    id BIGSERIAL PRIMARY KEY,
+    movie_id BIGINT REFERENCES movies(id) ON DELETE CASCADE,
+    collection_id BIGINT REFERENCES collections(id) ON DELETE CASCADE,
+    headline VARCHAR(255) NOT NULL DEFAULT '',
+    image_url TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP,
+    ends_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT featured_slots_one_target CHECK ((movie_id IS NULL) <> (collection_id IS NULL)),
+    CONSTRAINT featured_slots_schedule CHECK (ends_at IS NULL OR starts_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_featured_slots_priority ON featured_slots (priority DESC, id);
+CREATE INDEX IF NOT EXISTS idx_featured_slots_movie_id ON featured_slots (movie_id);
+CREATE INDEX IF NOT EXISTS idx_featured_slots_collection_id ON featured_slots (collection_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_movies_publish_at;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_publish_at_check;
+UPDATE movies SET status = 'in_review' WHERE status = 'scheduled';
+ALTER TABLE movies DROP COLUMN IF EXISTS publish_at;
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_status_check;
+ALTER TABLE movies ADD CONSTRAINT movies_status_check
+    CHECK (status IN ('draft', 'in_review', 'published', 'archived'));
@@ -0,0 +1,10 @@
+-- Movies approved for publication at a later time, published by a
+-- background job once publish_at has passed
+ALTER TABLE movies DROP CONSTRAINT IF EXISTS movies_status_check;
+ALTER TABLE movies ADD CONSTRAINT movies_status_check
+    CHECK (status IN ('draft', 'in_review', 'scheduled', 'published', 'archived'));
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS publish_at TIMESTAMP;
+ALTER TABLE movies ADD CONSTRAINT movies_publish_at_check
+    CHECK ((status = 'scheduled') = (publish_at IS NOT NULL));
+
+CREATE INDEX IF NOT EXISTS idx_movies_publish_at ON movies (publish_at) WHERE status = 'scheduled';
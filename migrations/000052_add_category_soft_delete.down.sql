@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_categories_deleted_at;
+DELETE FROM categories WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_categories_slug;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+DROP INDEX IF EXISTS idx_categories_name;
+ALTER TABLE categories ADD CONSTRAINT categories_name_key UNIQUE (name);
+ALTER TABLE categories DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,11 @@
+-- Deleted categories are kept, restorable, until purged. Names and slugs
+-- only need to be unique among the categories that are not deleted.
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+ALTER TABLE categories DROP CONSTRAINT IF EXISTS categories_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_name ON categories (name) WHERE deleted_at IS NULL;
+
+DROP INDEX IF EXISTS idx_categories_slug;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug) WHERE deleted_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_audit_log_actor;
+DROP INDEX IF EXISTS idx_audit_log_created_at;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS after;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS before;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS request_id;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS ip;
+ALTER TABLE audit_log DROP COLUMN IF EXISTS route;
+DELETE FROM audit_log WHERE entity_id IS NULL;
+ALTER TABLE audit_log ALTER COLUMN entity_id SET NOT NULL;
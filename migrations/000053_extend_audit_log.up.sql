@@ -0,0 +1,12 @@
+-- Every admin mutation is recorded, with the route and client it came from
+-- and the fields it changed. Entries of routes naming no entity by ID have
+-- no entity_id.
+ALTER TABLE audit_log ALTER COLUMN entity_id DROP NOT NULL;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS route VARCHAR(255);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS ip VARCHAR(64);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS request_id VARCHAR(128);
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS before JSONB;
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS after JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log (created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log (actor_id, created_at DESC);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ended_playback_streams;
@@ -0,0 +1,9 @@
+-- Streams ended before their playback token expired, replaced by a newer
+-- stream on the same device or ended by their user, by the hash of their
+-- token. Their tokens are refused until they expire.
+CREATE TABLE IF NOT EXISTS ended_playback_streams (
+    id VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ended_playback_streams_expires ON ended_playback_streams(expires_at);
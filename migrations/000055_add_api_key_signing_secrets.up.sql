@@ -0,0 +1,4 @@
+-- The secret API key clients sign their mutations with, returned once when
+-- the key is created. Keys created before have none and cannot make
+-- mutations; issue them a new key.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS signing_secret VARCHAR(64);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_collections_title_trgm;
+DROP INDEX IF EXISTS idx_series_title_trgm;
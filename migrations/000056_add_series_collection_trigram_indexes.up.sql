@@ -0,0 +1,4 @@
+-- Series and collection titles are suggested for searches that match
+-- nothing, like movie titles
+CREATE INDEX IF NOT EXISTS idx_series_title_trgm ON series USING GIN (LOWER(title) gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_collections_title_trgm ON collections USING GIN (LOWER(title) gin_trgm_ops);
@@ -0,0 +1 @@
+ALTER TABLE revoked_tokens DROP COLUMN IF EXISTS kept_session_id;
@@ -0,0 +1,3 @@
+-- Revocations by issue time may spare the tokens of one session, such as
+-- the one changing the user's password
+ALTER TABLE revoked_tokens ADD COLUMN IF NOT EXISTS kept_session_id VARCHAR(32);